@@ -44,7 +44,7 @@ func cmdInfo(args []string) error {
 	return siftool.Info(id, args[1])
 }
 
-// cmdDump extracts and output a data object from a SIF file to stdout.
+// cmdDump extracts and output a data object from a SIF file to stdout, or to a file.
 func cmdDump(args []string) error {
 	if len(args) != 2 {
 		return fmt.Errorf("usage")
@@ -55,5 +55,35 @@ func cmdDump(args []string) error {
 		return fmt.Errorf("while converting input descriptor id: %s", err)
 	}
 
-	return siftool.Dump(id, args[1])
+	return siftool.Dump(id, args[1], siftool.DumpOptions{
+		Output:          *output,
+		ClearQuarantine: *clearQuarantine,
+	})
+}
+
+// cmdHash displays digests of data objects or a SIF file to stdout.
+func cmdHash(args []string) error {
+	var id uint64
+	switch len(args) {
+	case 1:
+	case 2:
+		var err error
+		if id, err = strconv.ParseUint(args[0], 10, 32); err != nil {
+			return fmt.Errorf("while converting input descriptor id: %s", err)
+		}
+		args = args[1:]
+	default:
+		return fmt.Errorf("usage")
+	}
+
+	return siftool.Hash(args[0], *alg, id, *all)
+}
+
+// cmdStat displays a map of the layout of a SIF file to stdout.
+func cmdStat(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage")
+	}
+
+	return siftool.Stat(args[0])
 }
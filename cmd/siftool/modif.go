@@ -20,10 +20,24 @@ var partfs = flag.Int64("partfs", -1, "")
 var partarch = flag.Int64("partarch", -1, "")
 var signhash = flag.Int64("signhash", -1, "")
 var signentity = flag.String("signentity", "", "")
+var sbomformat = flag.Int64("sbomformat", -1, "")
+var ocimediatype = flag.String("ocimediatype", "", "")
+var ocidigest = flag.String("ocidigest", "", "")
 var groupid = flag.Int64("groupid", sif.DescrUnusedGroup, "")
 var link = flag.Int64("link", sif.DescrUnusedLink, "")
 var alignment = flag.Int("alignment", 0, "")
 var filename = flag.String("filename", "", "")
+var sparse = flag.Bool("sparse", false, "")
+var compress = flag.String("compress", "", "")
+var output = flag.String("output", "", "")
+var inPlace = flag.Bool("in-place", false, "")
+var dryRun = flag.Bool("dry-run", false, "")
+var clearQuarantine = flag.Bool("clear-quarantine", false, "")
+var alg = flag.String("alg", "sha256", "")
+var all = flag.Bool("all", false, "")
+var specfile = flag.String("f", "", "")
+var size = flag.Int64("size", 0, "")
+var digest = flag.String("digest", "", "")
 
 func cmdNew(args []string) error {
 	if len(args) != 1 {
@@ -33,27 +47,77 @@ func cmdNew(args []string) error {
 	return siftool.New(args[0])
 }
 
+func cmdBuild(args []string) error {
+	if len(args) != 1 || *specfile == "" {
+		return fmt.Errorf("usage")
+	}
+
+	return siftool.Build(*specfile, args[0])
+}
+
 func cmdAdd(args []string) error {
 	if len(args) != 2 {
 		return fmt.Errorf("usage")
 	}
 
 	opts := siftool.AddOptions{
-		Datatype:   datatype,
-		Parttype:   parttype,
-		Partfs:     partfs,
-		Partarch:   partarch,
-		Signhash:   signhash,
-		Signentity: signentity,
-		Groupid:    groupid,
-		Link:       link,
-		Alignment:  alignment,
-		Filename:   filename,
+		Datatype:     datatype,
+		Parttype:     parttype,
+		Partfs:       partfs,
+		Partarch:     partarch,
+		Signhash:     signhash,
+		Signentity:   signentity,
+		SBOMFormat:   sbomformat,
+		OCIMediaType: ocimediatype,
+		OCIDigest:    ocidigest,
+		Groupid:      groupid,
+		Link:         link,
+		Alignment:    alignment,
+		Filename:     filename,
+		Sparse:       sparse,
+		Compress:     compress,
 	}
 
 	return siftool.Add(args[0], args[1], opts)
 }
 
+func cmdPlaceholder(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage")
+	}
+
+	return siftool.Placeholder(args[0], *datatype, *size, *digest, *groupid)
+}
+
+func cmdBind(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage")
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("while converting input descriptor id: %s", err)
+	}
+
+	opts := siftool.AddOptions{
+		Datatype:     datatype,
+		Parttype:     parttype,
+		Partfs:       partfs,
+		Partarch:     partarch,
+		Signhash:     signhash,
+		Signentity:   signentity,
+		SBOMFormat:   sbomformat,
+		OCIMediaType: ocimediatype,
+		OCIDigest:    ocidigest,
+		Groupid:      groupid,
+		Link:         link,
+		Alignment:    alignment,
+		Filename:     filename,
+	}
+
+	return siftool.Bind(args[1], id, args[2], opts)
+}
+
 func cmdDel(args []string) error {
 	if len(args) != 2 {
 		return fmt.Errorf("usage")
@@ -79,3 +143,25 @@ func cmdSetPrim(args []string) error {
 
 	return siftool.Setprim(id, args[0])
 }
+
+func cmdRepair(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage")
+	}
+
+	if *inPlace {
+		if *output != "" {
+			return fmt.Errorf("-in-place and -output are mutually exclusive")
+		}
+		return siftool.RepairInPlace(args[0])
+	}
+	return siftool.Repair(args[0], *output, *clearQuarantine)
+}
+
+func cmdCompact(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage")
+	}
+
+	return siftool.Compact(args[0], *dryRun)
+}
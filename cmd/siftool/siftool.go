@@ -29,10 +29,17 @@ The commands are:
 	list     list object descriptors from SIF files
 	info     display detailed information of object descriptors
 	dump     extract and output (stdout) data objects from SIF files
+	hash     display digests of data objects or SIF files
 	new      create a new empty SIF image file
 	add      add a data object to a SIF file
 	del      delete a specified object descriptor and data from SIF file
 	setprim  set primary system partition
+	repair   report truncated data objects, or repair damaged SIF files
+	compact  reclaim space left in a SIF file by deleted data objects
+	stat     display a map of the layout of a SIF file
+	build    assemble a SIF file from a JSON spec
+	placeholder reserve space for a data object bound later
+	bind     fill a placeholder with a data object
 	version  package version
 	help     this help
 `
@@ -51,7 +58,7 @@ var version = "unknown"
 
 func cmdVersion(args []string) error {
 	fmt.Printf("siftool version %s %s/%s\n", version, runtime.GOOS, runtime.GOARCH)
-	fmt.Printf("SIF spec versions supported: <= %s\n", sif.HdrVersion)
+	fmt.Printf("SIF spec versions supported: <= %s\n", sif.HdrVersionMax)
 	return nil
 }
 
@@ -75,7 +82,17 @@ func main() {
 			`usage: info descriptorid containerfile
 `},
 		"dump": {"dump", cmdDump, "" +
-			`usage: dump descriptorid containerfile
+			`usage: dump [OPTIONS] descriptorid containerfile
+	-output       write the data object to a file, rather than stdout
+	-clear-quarantine
+	              on macOS, clear the quarantine attribute of the output file
+`},
+		"hash": {"hash", cmdHash, "" +
+			`usage: hash [OPTIONS] [descriptorid] containerfile
+	-alg          hash algorithm: sha256, sha384 or sha512
+	              [default: sha256]
+	-all          display the digest of each data object, rather than of
+	              the SIF file
 `},
 		"new": {"new", cmdNew, "" +
 			`usage: new containerfile
@@ -85,7 +102,10 @@ func main() {
 	-datatype     the type of data to add
 	              [NEEDED, no default]:
 	                1-Deffile,   2-EnvVar,    3-Labels,
-	                4-Partition, 5-Signature, 6-GenericJSON
+	                4-Partition, 5-Signature, 6-GenericJSON,
+	                7-Generic,   8-CryptoMessage, 9-BuildLog,
+	                10-Bundle,   11-HealthCheck, 12-SBOM,
+	                13-OCIConfig, 14-OCIBlob
 	-parttype     the type of partition (with -datatype 4-Partition)
 	              [NEEDED, no default]:
 	                1-System,    2-PrimSys,   3-Data,
@@ -107,16 +127,60 @@ func main() {
 	-signentity   the entity that signs (with -datatype 5-Signature)
 	              [NEEDED, no default]:
 	                example: 433FE984155206BD962725E20E8713472A879943
+	-sbomformat   the SBOM format used (with -datatype 12-SBOM)
+	              [NEEDED, no default]:
+	                1-CycloneDX-JSON, 2-CycloneDX-XML,
+	                3-SPDX-JSON,      4-SPDX-TagValue
+	-ocimediatype the OCI media type of the data (with -datatype 13-OCIConfig or 14-OCIBlob)
+	              [NEEDED, no default]:
+	                example: application/vnd.oci.image.layer.v1.tar+gzip
+	-ocidigest    the OCI digest of the data (with -datatype 13-OCIConfig or 14-OCIBlob)
+	              [default: computed from dataobjectfile]
 	-groupid      set groupid [default: DescrUnusedGroup]
 	-link         set link pointer [default: DescrUnusedLink]
 	-alignment    set alignment constraint [default: aligned on page size]
 	-filename     set logical filename/handle [default: input filename]
+	-sparse       leave blocks of zeros as holes in the SIF file
+	-compress     compress the data object: gzip [default: none]
 `},
 		"del": {"del", cmdDel, "" +
 			`usage: del descriptorid containerfile
 `},
 		"setprim": {"setprim", cmdSetPrim, "" +
 			`usage: setprim descriptorid containerfile
+`},
+		"repair": {"repair", cmdRepair, "" +
+			`usage: repair [OPTIONS] containerfile
+	-output       write a repaired SIF file containing only complete data objects
+	-in-place     repair inconsistencies in the descriptor table and global header in place
+	-clear-quarantine
+	              on macOS, clear the quarantine attribute of the output file
+`},
+		"compact": {"compact", cmdCompact, "" +
+			`usage: compact [OPTIONS] containerfile
+	-dry-run      report the space that would be reclaimed, without modifying the file
+`},
+		"stat": {"stat", cmdStat, "" +
+			`usage: stat containerfile
+`},
+		"build": {"build", cmdBuild, "" +
+			`usage: build -f specfile containerfile
+	-f            JSON spec describing the objects and signing of the image
+`},
+		"placeholder": {"placeholder", cmdPlaceholder, "" +
+			`usage: placeholder [OPTIONS] containerfile
+	-datatype     the type of data to be bound, as for add
+	              [NEEDED, no default]
+	-size         the space to reserve, in bytes
+	              [NEEDED, no default]
+	-digest       the approved digest of the data to be bound
+	              [default: any data]
+	-groupid      set groupid, which should not be signed
+	              [default: 0]
+`},
+		"bind": {"bind", cmdBind, "" +
+			`usage: bind [OPTIONS] descriptorid containerfile dataobjectfile|-
+	              options are as for add, and -datatype must match the placeholder
 `},
 		"help": {"help", cmdHelp, "" +
 			`usage: help
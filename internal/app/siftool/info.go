@@ -9,7 +9,11 @@
 package siftool
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"os"
@@ -47,18 +51,39 @@ func List(file string) error {
 		}
 	}()
 
-	fmt.Println("Container id:", fimg.Header.ID)
-	fmt.Println("Created on:  ", time.Unix(fimg.Header.Ctime, 0).UTC())
-	fmt.Println("Modified on: ", time.Unix(fimg.Header.Mtime, 0).UTC())
+	fmt.Println(sif.Message("Container id:"), fimg.Header.ID)
+	fmt.Printf("%-13s %v\n", sif.Message("Created on:"), time.Unix(fimg.Header.Ctime, 0).UTC())
+	fmt.Printf("%-13s %v\n", sif.Message("Modified on:"), time.Unix(fimg.Header.Mtime, 0).UTC())
 	fmt.Println("----------------------------------------------------")
 
-	fmt.Println("Descriptor list:")
+	fmt.Println(sif.Message("Descriptor list:"))
 
 	fmt.Print(fimg.FmtDescrList())
 
+	warnContentMismatch(&fimg, 0)
+
 	return nil
 }
 
+// warnContentMismatch writes a warning to stderr for each data object in fimg whose content does
+// not match its declared type. If id is non-zero, only the data object with that ID is checked.
+// Content is not checked if the image is truncated.
+func warnContentMismatch(fimg *sif.FileImage, id uint32) {
+	if _, err := fimg.CheckTruncated(); err != nil {
+		fmt.Fprintln(os.Stderr, sif.Message("Warning:"), err)
+		return
+	}
+
+	for i, v := range fimg.DescrArr {
+		if !v.Used || (id != 0 && v.ID != id) {
+			continue
+		}
+		if _, err := fimg.DescrArr[i].CheckContent(fimg); err != nil {
+			fmt.Fprintln(os.Stderr, sif.Message("Warning:"), err)
+		}
+	}
+}
+
 // Info displays detailed info about a descriptor from a SIF file.
 func Info(descr uint64, file string) error {
 	fimg, err := sif.LoadContainer(file, true)
@@ -73,11 +98,20 @@ func Info(descr uint64, file string) error {
 
 	fmt.Print(fimg.FmtDescrInfo(uint32(descr)))
 
+	warnContentMismatch(&fimg, uint32(descr))
+
 	return nil
 }
 
-// Dump extracts and outputs a data object from a SIF file.
-func Dump(descr uint64, file string) error {
+// DumpOptions contains the options when extracting a data object from a SIF file.
+type DumpOptions struct {
+	Output          string // file to write the data object to, rather than stdout
+	ClearQuarantine bool   // on macOS, clear the quarantine attribute of the output file
+}
+
+// Dump extracts and outputs a data object from a SIF file. On macOS, a data object written to a
+// file inherits the quarantine attribute of the SIF file, unless opts.ClearQuarantine is set.
+func Dump(descr uint64, file string, opts DumpOptions) error {
 	fimg, err := sif.LoadContainer(file, true)
 	if err != nil {
 		return err
@@ -93,10 +127,10 @@ func Dump(descr uint64, file string) error {
 			continue
 		}
 		if v.ID == uint32(descr) {
-			if _, err := fimg.Fp.Seek(v.Fileoff, 0); err != nil {
-				return fmt.Errorf("while seeking to data object: %s", err)
+			if opts.Output != "" {
+				return dumpToFile(&fimg, &v, file, opts)
 			}
-			if _, err := io.CopyN(os.Stdout, fimg.Fp, v.Filelen); err != nil {
+			if _, err := io.Copy(os.Stdout, v.GetReader(&fimg)); err != nil {
 				return fmt.Errorf("while copying data object to stdout: %s", err)
 			}
 			return nil
@@ -105,3 +139,197 @@ func Dump(descr uint64, file string) error {
 
 	return fmt.Errorf("descriptor not in range or currently unused")
 }
+
+// dumpToFile writes the data object described by d, from the SIF file at path loaded as fimg, to
+// the file named by opts.Output.
+func dumpToFile(fimg *sif.FileImage, d *sif.Descriptor, path string, opts DumpOptions) error {
+	f, err := os.OpenFile(opts.Output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, d.GetReader(fimg)); err != nil {
+		f.Close()
+		return fmt.Errorf("while copying data object to %s: %s", opts.Output, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return setOutputQuarantine(path, opts.Output, opts.ClearQuarantine)
+}
+
+// hashAlgorithms maps the names of the algorithms supported by Hash to their hash functions.
+var hashAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// digest returns the digest of the content read from r using the named algorithm, of the form
+// "<alg>:<hex>".
+func digest(alg string, r io.Reader) (string, error) {
+	h := hashAlgorithms[alg]()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return alg + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Hash displays digests of a SIF file, computed with the named algorithm. If id is not zero, the
+// digest of the data object with that id is displayed. If all is true, the digest of each data
+// object is displayed, along with its id. Otherwise, the digest of the entire file is displayed.
+// The digest of a data object is computed over its data as extracted by Dump.
+func Hash(file, alg string, id uint64, all bool) error {
+	if _, ok := hashAlgorithms[alg]; !ok {
+		return fmt.Errorf("hash algorithm not supported: %q", alg)
+	}
+	if id != 0 && all {
+		return fmt.Errorf("a descriptor id cannot be combined with all")
+	}
+
+	fimg, err := sif.LoadContainer(file, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := fimg.UnloadContainer(); err != nil {
+			log.Printf("Error unloading container: %v", err)
+		}
+	}()
+
+	switch {
+	case id != 0:
+		d, err := fimg.GetDescriptor(sif.WithID(uint32(id)))
+		if err != nil {
+			return fmt.Errorf("descriptor not in range or currently unused")
+		}
+
+		dg, err := digest(alg, d.GetReader(&fimg))
+		if err != nil {
+			return fmt.Errorf("while hashing data object: %s", err)
+		}
+		fmt.Println(dg)
+
+	case all:
+		for _, d := range fimg.GetDescriptors() {
+			dg, err := digest(alg, d.GetReader(&fimg))
+			if err != nil {
+				return fmt.Errorf("while hashing data object %d: %s", d.ID, err)
+			}
+			fmt.Printf("%-4d %s\n", d.ID, dg)
+		}
+
+	default:
+		dg, err := digest(alg, io.NewSectionReader(fimg.Fp, 0, fimg.Filesize))
+		if err != nil {
+			return fmt.Errorf("while hashing SIF file: %s", err)
+		}
+		fmt.Println(dg)
+	}
+
+	return nil
+}
+
+// statMapWidth is the number of cells in the layout map displayed by Stat.
+const statMapWidth = 64
+
+// statMapChar returns the character representing extents of kind k in the layout map.
+func statMapChar(k sif.ExtentKind) byte {
+	switch k {
+	case sif.ExtentHeader:
+		return 'H'
+	case sif.ExtentDescriptors:
+		return 'D'
+	case sif.ExtentObject:
+		return '#'
+	}
+	return '.'
+}
+
+// statMap returns a map of layout, in which each cell represents an equal share of a file of the
+// specified size, and shows the kind of extent occupying most of that share.
+func statMap(layout []sif.Extent, size int64) string {
+	cells := make([]byte, statMapWidth)
+	for i := range cells {
+		start := int64(i) * size / statMapWidth
+		end := int64(i+1) * size / statMapWidth
+
+		cells[i] = ' '
+		var most int64
+		for _, e := range layout {
+			lo, hi := e.Offset, e.Offset+e.Size
+			if lo < start {
+				lo = start
+			}
+			if hi > end {
+				hi = end
+			}
+			if n := hi - lo; n > most {
+				most = n
+				cells[i] = statMapChar(e.Kind)
+			}
+		}
+	}
+	return string(cells)
+}
+
+// percent returns n as a percentage of total.
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// Stat displays a map of the layout of a SIF file, showing the space used by the global header,
+// descriptor table and each data object, and the free space between them.
+func Stat(file string) error {
+	fimg, err := sif.LoadContainer(file, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := fimg.UnloadContainer(); err != nil {
+			log.Printf("Error unloading container: %v", err)
+		}
+	}()
+
+	layout := fimg.Layout()
+	size := fimg.Filesize
+
+	fmt.Printf("%s %s (%d bytes)\n\n", sif.Message("Layout of"), file, size)
+	fmt.Printf("[%s]\n", statMap(layout, size))
+	fmt.Printf(" H=%s  D=%s  #=%s  .=%s\n\n",
+		sif.ExtentHeader, sif.ExtentDescriptors, sif.ExtentObject, sif.ExtentFree)
+
+	fmt.Printf("%-12s %-12s %7s  %s\n", "Offset", "Size", "Share", "Extent")
+	totals := make(map[sif.ExtentKind]int64)
+	for _, e := range layout {
+		desc := e.Kind.String()
+		if e.Kind == sif.ExtentObject {
+			if d, _, err := fimg.GetFromDescrID(e.ID); err == nil {
+				desc = fmt.Sprintf("%s %d (%s, %s)", e.Kind, e.ID, d.Datatype, d.GetName())
+			}
+		}
+		fmt.Printf("%-12d %-12d %6.1f%%  %s\n", e.Offset, e.Size, percent(e.Size, size), desc)
+		totals[e.Kind] += e.Size
+	}
+	fmt.Println("----------------------------------------------------")
+
+	for _, t := range []struct {
+		label string
+		kind  sif.ExtentKind
+	}{
+		{"Header:", sif.ExtentHeader},
+		{"Descriptors:", sif.ExtentDescriptors},
+		{"Objects:", sif.ExtentObject},
+		{"Free:", sif.ExtentFree},
+	} {
+		n := totals[t.kind]
+		fmt.Printf("%-13s %12d bytes %6.1f%%\n", sif.Message(t.label), n, percent(n, size))
+	}
+	fmt.Printf("%-13s %12d of %d\n", sif.Message("Dfree:"), fimg.Header.Dfree, fimg.Header.Dtotal)
+
+	return nil
+}
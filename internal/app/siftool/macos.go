@@ -0,0 +1,61 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package siftool
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// On macOS, files downloaded from the network carry a quarantine attribute, and Gatekeeper refuses
+// to run executables that carry it. Files written from the contents of a SIF file inherit its
+// quarantine attribute, so that extraction does not strip the provenance of downloaded content.
+// Where the content is trusted, the attribute may be cleared from the files written instead. On
+// other platforms, extended attributes are left alone.
+//
+// Copying files from macOS to file systems that cannot hold resource forks or extended attributes
+// leaves AppleDouble files, named "._" followed by the name of the original, holding them. These
+// are easily mistaken for data, and are refused as data object files.
+
+// quarantineAttr is the extended attribute holding the quarantine information of a file on macOS.
+const quarantineAttr = "com.apple.quarantine"
+
+// appleDoubleMagic begins every AppleDouble file.
+var appleDoubleMagic = []byte{0x00, 0x05, 0x16, 0x07}
+
+// checkDataFile returns an error if the file at path, opened as fp, holds the resource fork or
+// AppleDouble metadata of a file rather than its data.
+func checkDataFile(path string, fp *os.File) error {
+	if strings.Contains(filepath.ToSlash(path), "/..namedfork/") {
+		return fmt.Errorf("%s is a resource fork, not data", path)
+	}
+
+	if !strings.HasPrefix(filepath.Base(path), "._") {
+		return nil
+	}
+
+	magic := make([]byte, len(appleDoubleMagic))
+	if _, err := fp.ReadAt(magic, 0); err != nil {
+		return nil
+	}
+	if bytes.Equal(magic, appleDoubleMagic) {
+		return fmt.Errorf("%s is an AppleDouble file holding macOS metadata, not data", path)
+	}
+	return nil
+}
+
+// setOutputQuarantine applies the quarantine attribute of the SIF file at src, if any, to the file
+// at dst, which was written from its contents. If clear is true, any quarantine attribute is
+// removed from dst instead.
+func setOutputQuarantine(src, dst string, clear bool) error {
+	if clear {
+		return clearQuarantine(dst)
+	}
+	return copyQuarantine(src, dst)
+}
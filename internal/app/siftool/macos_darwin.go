@@ -0,0 +1,50 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build darwin
+// +build darwin
+
+package siftool
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// xattr runs the xattr utility with args, returning its output. If the attribute operated on is
+// not present, ok is false.
+func xattr(args ...string) (out []byte, ok bool, err error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("/usr/bin/xattr", args...)
+	cmd.Stderr = &stderr
+
+	if out, err = cmd.Output(); err != nil {
+		if strings.Contains(stderr.String(), "No such xattr") {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("xattr %s: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, true, nil
+}
+
+// copyQuarantine applies the quarantine attribute of the file at src, if any, to the file at dst.
+func copyQuarantine(src, dst string) error {
+	value, ok, err := xattr("-p", quarantineAttr, src)
+	if err != nil || !ok {
+		return err
+	}
+
+	_, _, err = xattr("-w", quarantineAttr, string(bytes.TrimSpace(value)), dst)
+	return err
+}
+
+// clearQuarantine removes the quarantine attribute from the file at path, if present.
+func clearQuarantine(path string) error {
+	_, _, err := xattr("-d", quarantineAttr, path)
+	return err
+}
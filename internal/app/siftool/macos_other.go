@@ -0,0 +1,19 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build !darwin
+// +build !darwin
+
+package siftool
+
+// copyQuarantine does nothing, as quarantine attributes are specific to macOS.
+func copyQuarantine(src, dst string) error {
+	return nil
+}
+
+// clearQuarantine does nothing, as quarantine attributes are specific to macOS.
+func clearQuarantine(path string) error {
+	return nil
+}
@@ -9,12 +9,17 @@
 package siftool
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 
 	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/integrity"
 	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
 )
 
 // New creates a new empty SIF file.
@@ -36,44 +41,67 @@ func New(file string) error {
 
 // AddOptions contains the options when adding a section to a SIF file.
 type AddOptions struct {
-	Datatype   *int64
-	Parttype   *int64
-	Partfs     *int64
-	Partarch   *int64
-	Signhash   *int64
-	Signentity *string
-	Groupid    *int64
-	Link       *int64
-	Alignment  *int
-	Filename   *string
+	Datatype     *int64
+	Parttype     *int64
+	Partfs       *int64
+	Partarch     *int64
+	Signhash     *int64
+	Signentity   *string
+	SBOMFormat   *int64
+	OCIMediaType *string
+	OCIDigest    *string
+	Groupid      *int64
+	Link         *int64
+	Alignment    *int
+	Filename     *string
+	Sparse       *bool
+	Compress     *string
 }
 
-// Add adds a data object to a SIF file.
-func Add(containerFile, dataFile string, opts AddOptions) error {
-	var err error
-	var d sif.Datatype
-	var a string
-
-	switch *opts.Datatype {
+// optDatatype returns the datatype selected by the value n of the -datatype flag.
+func optDatatype(n int64) (sif.Datatype, error) {
+	switch n {
 	case 1:
-		d = sif.DataDeffile
+		return sif.DataDeffile, nil
 	case 2:
-		d = sif.DataEnvVar
+		return sif.DataEnvVar, nil
 	case 3:
-		d = sif.DataLabels
+		return sif.DataLabels, nil
 	case 4:
-		d = sif.DataPartition
+		return sif.DataPartition, nil
 	case 5:
-		d = sif.DataSignature
+		return sif.DataSignature, nil
 	case 6:
-		d = sif.DataGenericJSON
+		return sif.DataGenericJSON, nil
 	case 7:
-		d = sif.DataGeneric
+		return sif.DataGeneric, nil
 	case 8:
-		d = sif.DataCryptoMessage
+		return sif.DataCryptoMessage, nil
+	case 9:
+		return sif.DataBuildLog, nil
+	case 10:
+		return sif.DataBundle, nil
+	case 11:
+		return sif.DataHealthCheck, nil
+	case 12:
+		return sif.DataSBOM, nil
+	case 13:
+		return sif.DataOCIConfig, nil
+	case 14:
+		return sif.DataOCIBlob, nil
 	default:
 		log.Printf("error: -datatype flag is required with a valid range\n\n")
-		return fmt.Errorf("usage")
+		return 0, fmt.Errorf("usage")
+	}
+}
+
+// withInput calls fn with a DescriptorInput for dataFile, described by opts.
+func withInput(dataFile string, opts AddOptions, fn func(sif.DescriptorInput) error) error {
+	var a string
+
+	d, err := optDatatype(*opts.Datatype)
+	if err != nil {
+		return err
 	}
 
 	if *opts.Filename == "" {
@@ -87,6 +115,13 @@ func Add(containerFile, dataFile string, opts AddOptions) error {
 		Link:      uint32(*opts.Link),
 		Alignment: *opts.Alignment,
 		Fname:     *opts.Filename,
+		Sparse:    opts.Sparse != nil && *opts.Sparse,
+	}
+
+	if opts.Compress != nil {
+		if input.Compression, err = sif.ParseCompression(*opts.Compress); err != nil {
+			return err
+		}
 	}
 
 	if dataFile == "-" {
@@ -99,6 +134,10 @@ func Add(containerFile, dataFile string, opts AddOptions) error {
 		}
 		defer fp.Close()
 
+		if err := checkDataFile(dataFile, fp); err != nil {
+			return err
+		}
+
 		input.Fp = fp
 
 		fi, err := fp.Stat()
@@ -153,10 +192,77 @@ func Add(containerFile, dataFile string, opts AddOptions) error {
 		if err := input.SetSignExtra(sif.Hashtype(*opts.Signhash), *opts.Signentity); err != nil {
 			return err
 		}
+	} else if d == sif.DataSBOM {
+		if *opts.SBOMFormat == -1 {
+			return fmt.Errorf("with sbom datatype, -sbomformat must be passed")
+		}
+
+		if err := input.SetSBOMExtra(sif.SBOMFormat(*opts.SBOMFormat)); err != nil {
+			return err
+		}
+	} else if d == sif.DataOCIConfig || d == sif.DataOCIBlob {
+		if *opts.OCIMediaType == "" {
+			return fmt.Errorf("with oci datatypes, -ocimediatype must be passed")
+		}
+
+		digest := *opts.OCIDigest
+		if digest == "" {
+			if dataFile == "-" {
+				return fmt.Errorf("with oci datatypes read from stdin, -ocidigest must be passed")
+			}
+
+			rs := input.Fp.(io.ReadSeeker)
+			if digest, err = sif.OCIDigest(rs); err != nil {
+				return err
+			}
+			if _, err := rs.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+
+		if err := input.SetOCIBlobExtra(*opts.OCIMediaType, digest); err != nil {
+			return err
+		}
+	}
+
+	return fn(input)
+}
+
+// Add adds a data object to a SIF file.
+func Add(containerFile, dataFile string, opts AddOptions) error {
+	return withInput(dataFile, opts, func(input sif.DescriptorInput) error {
+		// load SIF image file
+		fimg, err := sif.LoadContainer(containerFile, false, sif.OptLoadSignalGuard(true))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := fimg.UnloadContainer(); err != nil {
+				log.Printf("Error unloading container: %v", err)
+			}
+		}()
+
+		// add new data object to SIF file
+		return fimg.AddObject(input)
+	})
+}
+
+// Placeholder adds a placeholder object to a SIF file, reserving size bytes for a data object of
+// the type selected by datatype, to be filled in later by Bind. If digest is not empty, only
+// content with that digest may be bound to the placeholder.
+func Placeholder(containerFile string, datatype, size int64, digest string, groupid int64) error {
+	d, err := optDatatype(datatype)
+	if err != nil {
+		return err
+	}
+
+	input, err := sif.NewPlaceholderInput(d, size, digest)
+	if err != nil {
+		return err
 	}
+	input.Groupid = sif.DescrGroupMask | uint32(groupid)
 
-	// load SIF image file
-	fimg, err := sif.LoadContainer(containerFile, false)
+	fimg, err := sif.LoadContainer(containerFile, false, sif.OptLoadSignalGuard(true))
 	if err != nil {
 		return err
 	}
@@ -166,17 +272,36 @@ func Add(containerFile, dataFile string, opts AddOptions) error {
 		}
 	}()
 
-	// add new data object to SIF file
-	if err = fimg.AddObject(input); err != nil {
-		return err
-	}
+	return fimg.AddObject(input)
+}
 
-	return nil
+// Bind fills the placeholder object with the specified ID in a SIF file with a data object, and
+// reports the digest of the data bound.
+func Bind(containerFile string, id uint64, dataFile string, opts AddOptions) error {
+	return withInput(dataFile, opts, func(input sif.DescriptorInput) error {
+		fimg, err := sif.LoadContainer(containerFile, false, sif.OptLoadSignalGuard(true))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := fimg.UnloadContainer(); err != nil {
+				log.Printf("Error unloading container: %v", err)
+			}
+		}()
+
+		digest, err := fimg.Bind(uint32(id), input)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(sif.Message("Bound object %d with digest %s\n"), id, digest)
+
+		return nil
+	})
 }
 
 // Del deletes a specified object descriptor and data from the SIF file.
 func Del(descr uint64, file string) error {
-	fimg, err := sif.LoadContainer(file, false)
+	fimg, err := sif.LoadContainer(file, false, sif.OptLoadSignalGuard(true))
 	if err != nil {
 		return err
 	}
@@ -203,7 +328,7 @@ func Del(descr uint64, file string) error {
 
 // Setprim sets the primary system partition of the SIF file.
 func Setprim(descr uint64, file string) error {
-	fimg, err := sif.LoadContainer(file, false)
+	fimg, err := sif.LoadContainer(file, false, sif.OptLoadSignalGuard(true))
 	if err != nil {
 		return err
 	}
@@ -227,3 +352,194 @@ func Setprim(descr uint64, file string) error {
 
 	return fmt.Errorf("descriptor not in range or currently unused")
 }
+
+// Repair reports the data objects of a SIF file that are truncated. If output is not empty, a
+// repaired SIF file containing only complete data objects is written to output. On macOS, output
+// inherits the quarantine attribute of file, unless clearQuarantine is true.
+func Repair(file, output string, clearQuarantine bool) error {
+	fimg, err := sif.LoadContainer(file, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := fimg.UnloadContainer(); err != nil {
+			log.Printf("Error unloading container: %v", err)
+		}
+	}()
+
+	tos, err := fimg.CheckTruncated()
+	if err == nil {
+		fmt.Println(sif.Message("Image is not truncated"))
+		return nil
+	} else if !errors.Is(err, sif.ErrTruncated) {
+		return err
+	}
+
+	fmt.Println(err)
+	for _, to := range tos {
+		fmt.Printf(sif.Message("Object %d: %d of %d bytes missing\n"), to.ID, to.Missing, to.Filelen)
+	}
+
+	if output == "" {
+		return nil
+	}
+
+	if _, err := fimg.Repair(output); err != nil {
+		return err
+	}
+	if err := setOutputQuarantine(file, output, clearQuarantine); err != nil {
+		return err
+	}
+	fmt.Printf(sif.Message("Wrote repaired image to %s, removing %d object(s)\n"), output, len(tos))
+
+	return nil
+}
+
+// RepairInPlace repairs the structure of a SIF file in place, reporting each problem repaired and
+// any that remain.
+func RepairInPlace(file string) error {
+	fimg, err := sif.LoadContainer(file, false, sif.OptLoadIgnoreDescrChecksum(true))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := fimg.UnloadContainer(); err != nil {
+			log.Printf("Error unloading container: %v", err)
+		}
+	}()
+
+	r, err := sif.RepairInPlace(&fimg)
+	if err != nil {
+		return err
+	}
+
+	if len(r.Repaired) == 0 {
+		fmt.Println(sif.Message("No repairs needed"))
+	}
+	for _, p := range r.Repaired {
+		fmt.Printf(sif.Message("Repaired: %v\n"), p)
+	}
+	for _, p := range r.Remaining.Problems {
+		fmt.Printf(sif.Message("Not repaired: %v\n"), p)
+	}
+
+	return r.Remaining.Err()
+}
+
+// Compact reclaims the space left in a SIF file by deleted data objects, reporting the number of
+// objects moved and bytes reclaimed. If dryRun is true, the space that would be reclaimed is
+// reported, and the file is not modified.
+func Compact(file string, dryRun bool) error {
+	fimg, err := sif.LoadContainer(file, dryRun)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := fimg.UnloadContainer(); err != nil {
+			log.Printf("Error unloading container: %v", err)
+		}
+	}()
+
+	p, err := fimg.PlanCompact()
+	if err != nil {
+		return err
+	}
+
+	if p.Moved == 0 && p.Reclaimable == 0 {
+		fmt.Println(sif.Message("Image is already compact"))
+		return nil
+	}
+
+	if dryRun {
+		fmt.Printf(sif.Message("Compacting would move %d object(s), reclaiming %d bytes\n"), p.Moved, p.Reclaimable)
+		return nil
+	}
+
+	if err := fimg.Compact(); err != nil {
+		return err
+	}
+	fmt.Printf(sif.Message("Compacted image, moving %d object(s) and reclaiming %d bytes\n"), p.Moved, p.Reclaimable)
+
+	return nil
+}
+
+// signingEntity returns the first entity with a private key in the keyring at path.
+func signingEntity(path string) (*openpgp.Entity, error) {
+	el, err := integrity.LoadKeyRings(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range el {
+		if e.PrivateKey != nil {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("no private key found in %s", path)
+}
+
+// sign signs the object groups of the SIF file at path with e. If groups is empty, all object
+// groups are signed.
+func sign(path string, e *openpgp.Entity, groups []uint32) error {
+	fimg, err := sif.LoadContainer(path, false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := fimg.UnloadContainer(); err != nil {
+			log.Printf("Error unloading container: %v", err)
+		}
+	}()
+
+	opts := []integrity.SignerOpt{integrity.OptSignWithEntity(e)}
+	for _, g := range groups {
+		opts = append(opts, integrity.OptSignGroup(g))
+	}
+
+	s, err := integrity.NewSigner(&fimg, opts...)
+	if err != nil {
+		return err
+	}
+	return s.Sign()
+}
+
+// Build creates a SIF file at output from the JSON spec read from specFile, and carries out the
+// signing instructions of the spec in order. Sources and keys are read relative to the spec.
+func Build(specFile, output string) error {
+	f, err := os.Open(specFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s, err := sif.ReadSpec(f)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(specFile)
+
+	if err := sif.BuildSpec(s, dir, output); err != nil {
+		return err
+	}
+
+	for _, ss := range s.Sign {
+		key := ss.Key
+		if !filepath.IsAbs(key) {
+			key = filepath.Join(dir, key)
+		}
+
+		e, err := signingEntity(key)
+		if err != nil {
+			return err
+		}
+
+		// Each instruction reloads the image, as signing grows the file.
+		if err := sign(output, e, ss.Groups); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf(sif.Message("Built %s with %d object(s)\n"), output, len(s.Objects))
+
+	return nil
+}
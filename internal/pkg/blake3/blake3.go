@@ -0,0 +1,268 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+// Package blake3 implements the BLAKE3 hash function, producing 256-bit digests in the default
+// (unkeyed) mode.
+//
+// BLAKE3 is considerably faster than SHA-2, but is not approved for use under FIPS 140. It is
+// intended for integrity checks that are not signed, where speed matters more than compliance.
+//
+// This implementation follows the reference implementation, and is written for clarity rather
+// than speed. It does not use SIMD instructions, and does not hash chunks in parallel.
+package blake3
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	// Size is the size of a BLAKE3 digest in bytes.
+	Size = 32
+
+	// BlockSize is the block size of BLAKE3 in bytes.
+	BlockSize = 64
+
+	chunkLen = 1024
+
+	flagChunkStart = 1 << 0
+	flagChunkEnd   = 1 << 1
+	flagParent     = 1 << 2
+	flagRoot       = 1 << 3
+)
+
+var iv = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+var msgPermutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+// g is the quarter-round function, mixing message words mx and my into state s.
+func g(s *[16]uint32, a, b, c, d int, mx, my uint32) {
+	s[a] += s[b] + mx
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] += s[b] + my
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+// round mixes message block m into state s, first by column and then by diagonal.
+func round(s, m *[16]uint32) {
+	g(s, 0, 4, 8, 12, m[0], m[1])
+	g(s, 1, 5, 9, 13, m[2], m[3])
+	g(s, 2, 6, 10, 14, m[4], m[5])
+	g(s, 3, 7, 11, 15, m[6], m[7])
+	g(s, 0, 5, 10, 15, m[8], m[9])
+	g(s, 1, 6, 11, 12, m[10], m[11])
+	g(s, 2, 7, 8, 13, m[12], m[13])
+	g(s, 3, 4, 9, 14, m[14], m[15])
+}
+
+// permute reorders the words of message block m between rounds.
+func permute(m *[16]uint32) {
+	var p [16]uint32
+	for i, j := range msgPermutation {
+		p[i] = m[j]
+	}
+	*m = p
+}
+
+// compress applies the BLAKE3 compression function to message block m, using chaining value cv.
+func compress(cv *[8]uint32, m [16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		iv[0], iv[1], iv[2], iv[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+
+	for i := 0; i < 7; i++ {
+		round(&s, &m)
+		if i < 6 {
+			permute(&m)
+		}
+	}
+
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+	return s
+}
+
+// words returns block b as little-endian words.
+func words(b *[BlockSize]byte) (m [16]uint32) {
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return m
+}
+
+// first8 returns the first eight words of s, which form a chaining value.
+func first8(s [16]uint32) (cv [8]uint32) {
+	copy(cv[:], s[:8])
+	return cv
+}
+
+// output holds the inputs to the final compression of a node in the tree, which is performed
+// either to obtain its chaining value, or to obtain the root digest.
+type output struct {
+	cv       [8]uint32
+	m        [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o output) chainingValue() [8]uint32 {
+	return first8(compress(&o.cv, o.m, o.counter, o.blockLen, o.flags))
+}
+
+func (o output) rootDigest() (d [Size]byte) {
+	for i, w := range first8(compress(&o.cv, o.m, 0, o.blockLen, o.flags|flagRoot)) {
+		binary.LittleEndian.PutUint32(d[4*i:], w)
+	}
+	return d
+}
+
+// parentOutput returns the output of the parent node of chaining values left and right.
+func parentOutput(left, right [8]uint32) output {
+	var m [16]uint32
+	copy(m[:8], left[:])
+	copy(m[8:], right[:])
+	return output{cv: iv, m: m, blockLen: BlockSize, flags: flagParent}
+}
+
+// chunkState holds the state of the chunk being hashed.
+type chunkState struct {
+	cv               [8]uint32
+	counter          uint64
+	block            [BlockSize]byte
+	blockLen         int
+	blocksCompressed int
+}
+
+func newChunkState(counter uint64) chunkState {
+	return chunkState{cv: iv, counter: counter}
+}
+
+func (cs *chunkState) len() int {
+	return BlockSize*cs.blocksCompressed + cs.blockLen
+}
+
+func (cs *chunkState) startFlag() uint32 {
+	if cs.blocksCompressed == 0 {
+		return flagChunkStart
+	}
+	return 0
+}
+
+func (cs *chunkState) update(p []byte) {
+	for len(p) > 0 {
+		// The last block of a chunk is compressed by output, so a full block is compressed only
+		// once more input is known to follow it.
+		if cs.blockLen == BlockSize {
+			cs.cv = first8(compress(&cs.cv, words(&cs.block), cs.counter, BlockSize, cs.startFlag()))
+			cs.blocksCompressed++
+			cs.block = [BlockSize]byte{}
+			cs.blockLen = 0
+		}
+
+		n := copy(cs.block[cs.blockLen:], p)
+		cs.blockLen += n
+		p = p[n:]
+	}
+}
+
+func (cs *chunkState) output() output {
+	return output{
+		cv:       cs.cv,
+		m:        words(&cs.block),
+		counter:  cs.counter,
+		blockLen: uint32(cs.blockLen),
+		flags:    cs.startFlag() | flagChunkEnd,
+	}
+}
+
+// digest implements hash.Hash.
+type digest struct {
+	chunk    chunkState
+	stack    [54][8]uint32 // Chaining values of completed subtrees, enough for 2^64 bytes.
+	stackLen int
+}
+
+// New returns a new hash.Hash computing the BLAKE3 digest.
+func New() hash.Hash {
+	return &digest{chunk: newChunkState(0)}
+}
+
+// Sum256 returns the BLAKE3 digest of b.
+func Sum256(b []byte) [Size]byte {
+	var d digest
+	d.Reset()
+	d.Write(b) // nolint:errcheck
+	return d.sum()
+}
+
+func (d *digest) Size() int      { return Size }
+func (d *digest) BlockSize() int { return BlockSize }
+
+func (d *digest) Reset() {
+	d.chunk = newChunkState(0)
+	d.stackLen = 0
+}
+
+// addChunkChainingValue adds the chaining value cv of a completed chunk to the tree, where total
+// is the number of chunks completed. Each trailing zero bit of total marks a subtree completed by
+// the chunk, whose chaining values are merged.
+func (d *digest) addChunkChainingValue(cv [8]uint32, total uint64) {
+	for total&1 == 0 {
+		d.stackLen--
+		cv = parentOutput(d.stack[d.stackLen], cv).chainingValue()
+		total >>= 1
+	}
+	d.stack[d.stackLen] = cv
+	d.stackLen++
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	n := len(p)
+
+	for len(p) > 0 {
+		// A chunk is completed only once more input is known to follow it, as the final chunk
+		// is the root node if it is the only one.
+		if d.chunk.len() == chunkLen {
+			cv := d.chunk.output().chainingValue()
+			total := d.chunk.counter + 1
+			d.addChunkChainingValue(cv, total)
+			d.chunk = newChunkState(total)
+		}
+
+		take := chunkLen - d.chunk.len()
+		if take > len(p) {
+			take = len(p)
+		}
+		d.chunk.update(p[:take])
+		p = p[take:]
+	}
+	return n, nil
+}
+
+// sum returns the digest of the data written so far, without modifying the state of d.
+func (d *digest) sum() [Size]byte {
+	o := d.chunk.output()
+	for i := d.stackLen - 1; i >= 0; i-- {
+		o = parentOutput(d.stack[i], o.chainingValue())
+	}
+	return o.rootDigest()
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	s := d.sum()
+	return append(b, s[:]...)
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package blake3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// testInput returns the input of length n used by the official BLAKE3 test vectors.
+func testInput(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+// Digests from the official BLAKE3 test vectors, truncated to 256 bits.
+var testVectors = []struct {
+	name string
+	n    int
+	want string
+}{
+	{"Empty", 0, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+	{"OneChunkLess", 1023, "10108970eeda3eb932baac1428c7a2163b0e924c9a9e25b35bba72b28f70bd11"},
+	{"OneChunk", 1024, "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+	{"OneChunkMore", 1025, "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+	{"TwoChunks", 2048, "e776b6028c7cd22a4d0ba182a8bf62205d2ef576467e838ed6f2529b85fba24a"},
+	{"TwoChunksMore", 2049, "5f4d72f40d7a5f82b15ca2b2e44b1de3c2ef86c426c95c1af0b6879522563030"},
+	{"ThreeChunks", 3072, "b98cb0ff3623be03326b373de6b9095218513e64f1ee2edd2525c7ad1e5cffd2"},
+	{"EightChunksMore", 8193, "bab6c09cb8ce8cf459261398d2e7aef35700bf488116ceb94a36d0f5f1b7bc3b"},
+	{"OneHundredChunks", 102400, "bc3e3d41a1146b069abffad3c0d44860cf664390afce4d9661f7902e7943e085"},
+}
+
+func TestSum256(t *testing.T) {
+	for _, tt := range testVectors {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sum256(testInput(tt.n))
+
+			if want := tt.want; hex.EncodeToString(got[:]) != want {
+				t.Errorf("got digest %x, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDigest_Write(t *testing.T) {
+	for _, tt := range testVectors {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := testInput(tt.n)
+
+			// Write in pieces that do not align with blocks or chunks.
+			for _, size := range []int{1, 63, 65, 1000, 1025} {
+				h := New()
+
+				for r := bytes.NewReader(b); r.Len() > 0; {
+					p := make([]byte, size)
+					n, _ := r.Read(p)
+					if _, err := h.Write(p[:n]); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				// Sum must not modify the state of the hash.
+				if got, want := hex.EncodeToString(h.Sum(nil)), tt.want; got != want {
+					t.Errorf("size %v: got digest %v, want %v", size, got, want)
+				}
+				if got, want := hex.EncodeToString(h.Sum(nil)), tt.want; got != want {
+					t.Errorf("size %v: got second digest %v, want %v", size, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDigest_Reset(t *testing.T) {
+	h := New()
+	if _, err := h.Write(testInput(4096)); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Reset()
+
+	if got, want := hex.EncodeToString(h.Sum(nil)), testVectors[0].want; got != want {
+		t.Errorf("got digest %v, want %v", got, want)
+	}
+	if got, want := h.Size(), Size; got != want {
+		t.Errorf("got size %v, want %v", got, want)
+	}
+}
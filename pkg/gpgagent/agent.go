@@ -0,0 +1,179 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+// Package gpgagent implements a client for gpg-agent, allowing signatures to be created without
+// private key material entering the process.
+//
+// To sign a SIF image using a key held by a running gpg-agent:
+//
+//	a, err := gpgagent.Dial("")
+//	...
+//	defer a.Close()
+//
+//	signer, err := a.Signer(e.PrimaryKey)
+//	...
+//	s, err := integrity.NewSigner(f, integrity.OptSignWithSigner(e.PrimaryKey, signer))
+package gpgagent
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var errUnexpectedResponse = errors.New("unexpected response from agent")
+
+// Error records an error reported by the agent.
+type Error struct {
+	Code    int    // Error code reported by the agent.
+	Message string // Description reported by the agent.
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gpg-agent: %v (%d)", e.Message, e.Code)
+}
+
+// Agent is a connection to a gpg-agent. It is safe for concurrent use.
+type Agent struct {
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// socketPath returns the path of the agent socket, as reported by gpgconf.
+func socketPath() (string, error) {
+	out, err := exec.Command("gpgconf", "--list-dirs", "agent-socket").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate agent socket: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Dial connects to the gpg-agent listening on the socket at path. If path is empty, the location
+// of the socket is obtained using gpgconf, which also starts the agent if required.
+func Dial(path string) (*Agent, error) {
+	if path == "" {
+		p, err := socketPath()
+		if err != nil {
+			return nil, err
+		}
+		path = p
+
+		// Ensure the agent is running.
+		if err := exec.Command("gpgconf", "--launch", "gpg-agent").Run(); err != nil {
+			return nil, fmt.Errorf("failed to launch agent: %w", err)
+		}
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Agent{conn: conn, r: bufio.NewReader(conn)}
+
+	// Consume greeting.
+	if _, err := a.readResponse(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Close closes the connection to the agent.
+func (a *Agent) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.conn.Close()
+}
+
+// readResponse reads lines from the agent until a final response is received, and returns any
+// data sent.
+func (a *Agent) readResponse() ([]byte, error) {
+	var data []byte
+
+	for {
+		line, err := a.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "OK" || strings.HasPrefix(line, "OK "):
+			return data, nil
+
+		case strings.HasPrefix(line, "ERR "):
+			e := &Error{}
+			if _, err := fmt.Sscanf(line, "ERR %d", &e.Code); err != nil {
+				return nil, fmt.Errorf("%w: %q", errUnexpectedResponse, line)
+			}
+			if f := strings.SplitN(line, " ", 3); len(f) == 3 {
+				e.Message = f[2]
+			}
+			return nil, e
+
+		case strings.HasPrefix(line, "D "):
+			data = append(data, unescape(line[2:])...)
+
+		case strings.HasPrefix(line, "INQUIRE "):
+			// Inquiries not relevant to signing (such as notification of pinentry launch) are
+			// answered with no data.
+			if _, err := fmt.Fprint(a.conn, "END\n"); err != nil {
+				return nil, err
+			}
+
+		case strings.HasPrefix(line, "S ") || strings.HasPrefix(line, "#") || line == "":
+			// Status lines and comments are ignored.
+
+		default:
+			return nil, fmt.Errorf("%w: %q", errUnexpectedResponse, line)
+		}
+	}
+}
+
+// transact sends each command to the agent in turn, and returns the data sent in response to the
+// last.
+func (a *Agent) transact(cmds ...string) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var data []byte
+	for _, cmd := range cmds {
+		if _, err := fmt.Fprintf(a.conn, "%s\n", cmd); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if data, err = a.readResponse(); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// unescape decodes the percent-encoding used for data lines in the Assuan protocol.
+func unescape(s string) []byte {
+	b := bytes.Buffer{}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.Bytes()
+}
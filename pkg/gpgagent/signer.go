@@ -0,0 +1,152 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package gpgagent
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1" // nolint:gosec // Keygrips are defined in terms of SHA-1.
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+var (
+	errKeyTypeUnsupported  = errors.New("key type not supported")
+	errHashUnsupported     = errors.New("hash algorithm not supported")
+	errSignatureMalformed  = errors.New("malformed signature from agent")
+	errSignatureNotPresent = errors.New("signature value not present in agent response")
+)
+
+// hashNames maps hash algorithms to the names understood by the agent.
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA1:   "sha1",
+	crypto.SHA224: "sha224",
+	crypto.SHA256: "sha256",
+	crypto.SHA384: "sha384",
+	crypto.SHA512: "sha512",
+}
+
+// keygrip returns the keygrip of pub, which the agent uses to identify key material.
+func keygrip(pub *packet.PublicKey) ([]byte, error) {
+	switch pk := pub.PublicKey.(type) {
+	case *rsa.PublicKey:
+		// The modulus is hashed as an unsigned big-endian integer, with a leading zero byte if
+		// the most significant bit is set.
+		n := pk.N.Bytes()
+		if len(n) > 0 && n[0]&0x80 != 0 {
+			n = append([]byte{0}, n...)
+		}
+		sum := sha1.Sum(n) // nolint:gosec // Keygrips are defined in terms of SHA-1.
+		return sum[:], nil
+
+	default:
+		return nil, fmt.Errorf("%w: %T", errKeyTypeUnsupported, pub.PublicKey)
+	}
+}
+
+// signer is a crypto.Signer backed by a key held by the agent.
+type signer struct {
+	a    *Agent
+	pub  *rsa.PublicKey
+	grip []byte
+}
+
+// Signer returns a crypto.Signer that creates signatures using the private key corresponding to
+// pub, which must be held by the agent. Only RSA keys are supported.
+func (a *Agent) Signer(pub *packet.PublicKey) (crypto.Signer, error) {
+	grip, err := keygrip(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	// keygrip only succeeds for RSA keys.
+	return &signer{a: a, pub: pub.PublicKey.(*rsa.PublicKey), grip: grip}, nil
+}
+
+// Public returns the public key corresponding to the private key held by the agent.
+func (s *signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign requests that the agent sign digest, which must be the result of hashing a larger message
+// using the hash function specified by opts. The agent may prompt the user for a passphrase, or
+// to confirm the operation. The rand argument is ignored.
+func (s *signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	name, ok := hashNames[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", errHashUnsupported, opts.HashFunc())
+	}
+
+	data, err := s.a.transact(
+		"RESET",
+		fmt.Sprintf("SIGKEY %X", s.grip),
+		fmt.Sprintf("SETHASH --hash=%s %X", name, digest),
+		"PKSIGN",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := parseRSASignature(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The agent strips leading zero bytes, but callers expect a signature the size of the
+	// modulus.
+	if n := s.pub.Size(); len(sig) < n {
+		sig = append(make([]byte, n-len(sig)), sig...)
+	}
+	return sig, nil
+}
+
+// parseRSASignature extracts the signature value from a canonical S-expression of the form
+// (sig-val (rsa (s <value>))).
+func parseRSASignature(b []byte) ([]byte, error) {
+	var (
+		atoms []string
+		depth int
+	)
+
+	for len(b) > 0 {
+		switch b[0] {
+		case '(':
+			depth++
+			b = b[1:]
+
+		case ')':
+			if depth--; depth < 0 {
+				return nil, errSignatureMalformed
+			}
+			b = b[1:]
+
+		default:
+			i := bytes.IndexByte(b, ':')
+			if i < 1 {
+				return nil, errSignatureMalformed
+			}
+			n, err := strconv.Atoi(string(b[:i]))
+			if err != nil || n < 0 || len(b[i+1:]) < n {
+				return nil, errSignatureMalformed
+			}
+			atoms = append(atoms, string(b[i+1:i+1+n]))
+			b = b[i+1+n:]
+		}
+	}
+	if depth != 0 {
+		return nil, errSignatureMalformed
+	}
+
+	if len(atoms) != 4 || atoms[0] != "sig-val" || atoms[1] != "rsa" || atoms[2] != "s" {
+		return nil, errSignatureNotPresent
+	}
+	return []byte(atoms[3]), nil
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package gpgagent
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// getTestEntity returns a fixed test PGP entity.
+func getTestEntity(t *testing.T) *openpgp.Entity {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", "private.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	el, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(el), 1; got != want {
+		t.Fatalf("got %v entities, want %v", got, want)
+	}
+	return el[0]
+}
+
+// startTestAgent starts a gpg-agent in a temporary home directory, imports the test key into it,
+// and returns the path of its socket. The test is skipped if GnuPG is not installed.
+func startTestAgent(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+
+	// Keep the path short, as socket paths are limited in length.
+	home, err := ioutil.TempDir("/tmp", "gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(home) })
+
+	run := func(name string, args ...string) string {
+		cmd := exec.Command(name, args...)
+		cmd.Env = append(os.Environ(), "GNUPGHOME="+home)
+
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%v %v: %v", name, strings.Join(args, " "), err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	run("gpg", "--batch", "--import", filepath.Join("testdata", "private.asc"))
+	t.Cleanup(func() { run("gpgconf", "--kill", "gpg-agent") })
+
+	return run("gpgconf", "--list-dirs", "agent-socket")
+}
+
+func TestKeygrip(t *testing.T) {
+	e := getTestEntity(t)
+
+	tests := []struct {
+		name     string
+		pub      *packet.PublicKey
+		wantGrip string
+		wantErr  error
+	}{
+		{
+			name:     "RSA",
+			pub:      e.PrimaryKey,
+			wantGrip: "2F0F9827E94E27B8B6C11675803CC363E8ECF7D9",
+		},
+		{
+			name:    "Unsupported",
+			pub:     &packet.PublicKey{},
+			wantErr: errKeyTypeUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			grip, err := keygrip(tt.pub)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if err == nil {
+				if got, want := strings.ToUpper(hex.EncodeToString(grip)), tt.wantGrip; got != want {
+					t.Errorf("got keygrip %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRSASignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		wantSig []byte
+		wantErr error
+	}{
+		{
+			name:    "OK",
+			b:       []byte("(7:sig-val(3:rsa(1:s3:a:b)))"),
+			wantSig: []byte("a:b"),
+		},
+		{
+			name:    "Unbalanced",
+			b:       []byte("(7:sig-val(3:rsa(1:s3:abc))"),
+			wantErr: errSignatureMalformed,
+		},
+		{
+			name:    "ExtraClose",
+			b:       []byte("(7:sig-val(3:rsa(1:s3:abc))))"),
+			wantErr: errSignatureMalformed,
+		},
+		{
+			name:    "ShortAtom",
+			b:       []byte("(7:sig-val(3:rsa(1:s9:abc)))"),
+			wantErr: errSignatureMalformed,
+		},
+		{
+			name:    "BadLength",
+			b:       []byte("(7:sig-val(3:rsa(1:sx:abc)))"),
+			wantErr: errSignatureMalformed,
+		},
+		{
+			name:    "NotRSA",
+			b:       []byte("(7:sig-val(5:ecdsa(1:r3:abc)(1:s3:abc)))"),
+			wantErr: errSignatureNotPresent,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := parseRSASignature(tt.b)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if got, want := sig, tt.wantSig; !bytes.Equal(got, want) {
+				t.Errorf("got signature %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []byte
+	}{
+		{"Plain", "abc", []byte("abc")},
+		{"Escaped", "a%25b%0Ac%0d", []byte("a%b\nc\r")},
+		{"Truncated", "ab%2", []byte("ab%2")},
+		{"Invalid", "a%zzb", []byte("a%zzb")},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := unescape(tt.s), tt.want; !bytes.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestAgent_Signer(t *testing.T) {
+	path := startTestAgent(t)
+
+	a, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	e := getTestEntity(t)
+
+	s, err := a.Signer(e.PrimaryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, ok := s.Public().(*rsa.PublicKey)
+	if !ok {
+		t.Fatalf("got public key of type %T", s.Public())
+	}
+
+	t.Run("UnsupportedHash", func(t *testing.T) {
+		if _, err := s.Sign(nil, make([]byte, 16), crypto.MD5); !errors.Is(err, errHashUnsupported) {
+			t.Fatalf("got error %v, want %v", err, errHashUnsupported)
+		}
+	})
+
+	t.Run("SHA256", func(t *testing.T) {
+		digest := sha256.Sum256([]byte("hello"))
+
+		sig, err := s.Sign(nil, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
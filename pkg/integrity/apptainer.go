@@ -0,0 +1,57 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+var errApptainerIncompatible = errors.New("not supported by Apptainer")
+
+// OptSignApptainerCompat specifies that signature(s) be generated so that they verify in the
+// Apptainer fork of this module, as well as in this package. Signatures are made with version 1
+// metadata, as with OptSignMetadataVersion(1).
+//
+// Apptainer neither records nor checks identity, epoch or role claims, and does not extend prior
+// signatures, so these options are refused rather than silently going unchecked. Apptainer cannot
+// load images of SIF versions later than sif.HdrVersion1, so signing such images is refused.
+//
+// Compatibility is checked against the metadata schema of Apptainer only, and not against images
+// signed by Apptainer itself.
+func OptSignApptainerCompat() SignerOpt {
+	return func(s *Signer) error {
+		s.apptainer = true
+		s.version = metadataVersion1
+		return nil
+	}
+}
+
+// checkApptainerCompat returns an error if the signature(s) specified by s would not verify in
+// Apptainer.
+func (s *Signer) checkApptainerCompat() error {
+	if v := s.f.Header.GetVersion(); v > sif.HdrVersion1 {
+		return fmt.Errorf("%w: SIF version %v", errApptainerIncompatible, v)
+	}
+	if s.version != metadataVersion1 {
+		return fmt.Errorf("%w: metadata version %v", errApptainerIncompatible, s.version)
+	}
+	if s.identity != nil {
+		return fmt.Errorf("%w: identity claim", errApptainerIncompatible)
+	}
+	if s.epoch != 0 {
+		return fmt.Errorf("%w: epoch claim", errApptainerIncompatible)
+	}
+	if s.role != "" {
+		return fmt.Errorf("%w: role claim", errApptainerIncompatible)
+	}
+	if s.extend {
+		return fmt.Errorf("%w: incremental signing", errApptainerIncompatible)
+	}
+	return nil
+}
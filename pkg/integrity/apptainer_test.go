@@ -0,0 +1,235 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+// apptainerMetadata mirrors the signed metadata understood by the Apptainer fork of this module,
+// which predates metadata versioning and claims.
+type apptainerMetadata struct {
+	Version int `json:"version"`
+	Header  struct {
+		Digest string `json:"digest"`
+	} `json:"header"`
+	Objects []struct {
+		RelativeID       uint32 `json:"relativeId"`
+		DescriptorDigest string `json:"descriptorDigest"`
+		ObjectDigest     string `json:"objectDigest"`
+	} `json:"objects"`
+}
+
+// checkApptainerSignatures checks that each signature in f is made over an image Apptainer can
+// load, and holds version 1 metadata that decodes strictly into the fields Apptainer understands.
+//
+// This checks the signatures against the metadata schema of Apptainer only. No images signed by
+// Apptainer itself are checked in, so this does not establish interoperability by itself.
+func checkApptainerSignatures(t *testing.T, f *sif.FileImage, kr openpgp.KeyRing) {
+	t.Helper()
+
+	if got, want := f.Header.GetVersion(), sif.HdrVersion1; got != want {
+		t.Errorf("got SIF version %v, want %v", got, want)
+	}
+
+	sigs := getDescriptors(f, sif.WithDataType(sif.DataSignature))
+	if len(sigs) == 0 {
+		t.Fatal("no signatures found")
+	}
+
+	for _, sig := range sigs {
+		_, plaintext, _, err := verifyAndDecode(readObject(f, sig), kr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(plaintext))
+		dec.DisallowUnknownFields()
+
+		var am apptainerMetadata
+		if err := dec.Decode(&am); err != nil {
+			t.Fatalf("signature %v: %v", sig.ID, err)
+		}
+		if got, want := am.Version, 1; got != want {
+			t.Errorf("signature %v: got metadata version %v, want %v", sig.ID, got, want)
+		}
+
+		groupID := sig.Link &^ sif.DescrGroupMask
+
+		ods, err := getGroupObjects(f, groupID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(am.Objects), len(ods); got != want {
+			t.Fatalf("signature %v: got %v objects, want %v", sig.ID, got, want)
+		}
+
+		// Apptainer identifies objects by their position within the group, in ascending ID order.
+		sort.Slice(ods, func(i, j int) bool { return ods[i].ID < ods[j].ID })
+		for i, om := range am.Objects {
+			if got, want := om.RelativeID, ods[i].ID-ods[0].ID; got != want {
+				t.Errorf("signature %v: got relative ID %v, want %v", sig.ID, got, want)
+			}
+		}
+	}
+}
+
+func TestOptSignApptainerCompat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-apptainer-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oneGroup, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oneGroup.UnloadContainer() // nolint:errcheck
+
+	// Apptainer cannot load images of later SIF versions.
+	cinfo := sif.CreateInfo{
+		Pathname:   filepath.Join(dir, "v2.sif"),
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion2,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{{
+			Datatype: sif.DataGeneric,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     sif.DescrUnusedLink,
+			Size:     4,
+			Data:     []byte("data"),
+		}},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+	version2, err := sif.LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer version2.UnloadContainer() // nolint:errcheck
+
+	tests := []struct {
+		name    string
+		f       *sif.FileImage
+		opts    []SignerOpt
+		wantErr error
+	}{
+		{name: "OK", f: &oneGroup},
+		{name: "Version2Image", f: &version2, wantErr: errApptainerIncompatible},
+		{
+			name:    "MetadataVersion4",
+			f:       &oneGroup,
+			opts:    []SignerOpt{OptSignMetadataVersion(4)},
+			wantErr: errApptainerIncompatible,
+		},
+		{
+			name:    "Identity",
+			f:       &oneGroup,
+			opts:    []SignerOpt{OptSignWithIdentity("user/collection/image:tag", "")},
+			wantErr: errApptainerIncompatible,
+		},
+		{
+			name:    "Epoch",
+			f:       &oneGroup,
+			opts:    []SignerOpt{OptSignWithEpoch(1)},
+			wantErr: errApptainerIncompatible,
+		},
+		{
+			name:    "Role",
+			f:       &oneGroup,
+			opts:    []SignerOpt{OptSignWithRole("built-by")},
+			wantErr: errApptainerIncompatible,
+		},
+		{
+			name:    "Incremental",
+			f:       &oneGroup,
+			opts:    []SignerOpt{OptSignIncremental()},
+			wantErr: errApptainerIncompatible,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSigner(tt.f, append([]SignerOpt{OptSignApptainerCompat()}, tt.opts...)...)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if err == nil {
+				for _, gs := range s.signers {
+					if got, want := gs.mdVersion, metadataVersion1; got != want {
+						t.Errorf("got metadata version %v, want %v", got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestSignApptainerCompat checks that signatures made in Apptainer compatibility mode hold
+// metadata in the schema understood by Apptainer, and verify in this package.
+func TestSignApptainerCompat(t *testing.T) {
+	e := getTestEntity(t)
+	kr := openpgp.EntityList{e}
+
+	for _, name := range []string{"one-group.sif", "two-groups.sif"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			f, err := sif.LoadContainerFp(tf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSigner(&f, OptSignWithEntity(e), OptSignApptainerCompat())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Sign(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err = sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			checkApptainerSignatures(t, &f, kr)
+
+			v, err := NewVerifier(&f, OptVerifyWithKeyRing(kr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Verify(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
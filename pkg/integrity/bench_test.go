@@ -0,0 +1,201 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"crypto"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+// The default object size keeps benchmarks quick enough for CI. Performance work should report
+// numbers at realistic scales, for example:
+//
+//	go test -run=^$ -bench=. -benchtime=3x -integrity.bench-size=1073741824 ./pkg/integrity
+//	go test -run=^$ -bench=. -benchtime=1x -integrity.bench-size=10737418240 ./pkg/integrity
+var benchSize = flag.Int64("integrity.bench-size", 16<<20, "size in bytes of data objects used in benchmarks")
+
+// benchObjects is the number of data objects in benchmark images.
+const benchObjects = 2
+
+// syntheticPattern is the block of pseudo-random bytes repeated by syntheticReader.
+var syntheticPattern = func() []byte {
+	b := make([]byte, 1<<16)
+	for i, x := 0, uint32(2463534242); i < len(b); i++ {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		b[i] = byte(x)
+	}
+	return b
+}()
+
+// syntheticReader produces a deterministic stream of bytes without holding the whole object in
+// memory, and cheaply enough not to dominate benchmark results.
+type syntheticReader struct {
+	n int
+}
+
+func (r *syntheticReader) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		m := copy(b[n:], syntheticPattern[r.n:])
+		r.n = (r.n + m) % len(syntheticPattern)
+		n += m
+	}
+	return n, nil
+}
+
+// createBenchImage creates an image in a temporary directory containing n synthetic objects of
+// the given size in a single group, and returns its path. The image is removed when the
+// benchmark completes.
+func createBenchImage(b *testing.B, n int, size int64) string {
+	b.Helper()
+
+	dir, err := ioutil.TempDir("", "integrity-bench-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+
+	cinfo := sif.CreateInfo{
+		Pathname:   filepath.Join(dir, "bench.sif"),
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+	}
+	for i := 0; i < n; i++ {
+		cinfo.InputDescr = append(cinfo.InputDescr, sif.DescriptorInput{
+			Datatype: sif.DataGeneric,
+			Groupid:  sif.DescrGroupMask | 1,
+			Link:     sif.DescrUnusedLink,
+			Fname:    "synthetic",
+			Fp:       io.LimitReader(&syntheticReader{}, size),
+			Size:     size,
+		})
+	}
+
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		b.Fatal(err)
+	}
+	return cinfo.Pathname
+}
+
+// loadBenchImage loads the image at path, unloading it when the benchmark completes.
+func loadBenchImage(b *testing.B, path string, rdonly bool) *sif.FileImage {
+	b.Helper()
+
+	f, err := sif.LoadContainer(path, rdonly)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { f.UnloadContainer() }) // nolint:errcheck
+	return &f
+}
+
+func BenchmarkHashValue(b *testing.B) {
+	for _, h := range []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		h := h
+
+		b.Run(h.String(), func(b *testing.B) {
+			b.SetBytes(*benchSize)
+
+			for i := 0; i < b.N; i++ {
+				if _, err := hashValue(h, io.LimitReader(&syntheticReader{}, *benchSize)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchParallelism are the numbers of objects hashed concurrently compared by benchmarks of
+// signing and verification.
+var benchParallelism = []int{1, benchObjects}
+
+func BenchmarkSign(b *testing.B) {
+	e := getTestEntity(b)
+	path := createBenchImage(b, benchObjects, *benchSize)
+
+	for _, n := range benchParallelism {
+		opt := OptSignParallelism(n)
+
+		b.Run(fmt.Sprintf("Parallel%d", n), func(b *testing.B) {
+			b.SetBytes(benchObjects * *benchSize)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				// Sign a fresh copy each time, so signatures do not accumulate.
+				b.StopTimer()
+				tf, err := tempFileFrom(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				f, err := sif.LoadContainerFp(tf, false)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				s, err := NewSigner(&f, OptSignWithEntity(e), opt)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := s.Sign(); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				f.UnloadContainer() // nolint:errcheck
+				os.Remove(tf.Name())
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	e := getTestEntity(b)
+	path := createBenchImage(b, benchObjects, *benchSize)
+
+	s, err := NewSigner(loadBenchImage(b, path, false), OptSignWithEntity(e))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := s.Sign(); err != nil {
+		b.Fatal(err)
+	}
+
+	f := loadBenchImage(b, path, true)
+
+	for _, n := range benchParallelism {
+		opt := OptVerifyParallelism(n)
+
+		b.Run(fmt.Sprintf("Parallel%d", n), func(b *testing.B) {
+			b.SetBytes(benchObjects * *benchSize)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				v, err := NewVerifier(f, OptVerifyWithKeyRing(openpgp.EntityList{e}), opt)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := v.Verify(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
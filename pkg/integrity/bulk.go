@@ -0,0 +1,98 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// ImageVerifyResult describes the result of verifying an image with VerifyImages.
+type ImageVerifyResult struct {
+	Index int            // Index of the image in the slice passed to VerifyImages.
+	Image *sif.FileImage // Image verified.
+	Err   error          // Error encountered verifying the image, or nil if verification succeeded.
+}
+
+// verifyImage verifies f using a Verifier configured with opts, stopping once ctx is done.
+func verifyImage(ctx context.Context, f *sif.FileImage, opts []VerifierOpt) error {
+	v, err := NewVerifier(f, opts...)
+	if err != nil {
+		return err
+	}
+	return v.VerifyContext(ctx)
+}
+
+// VerifyImages verifies images concurrently, using a Verifier configured with opts for each, and
+// sends the result for each image on the returned channel, in order of completion. At most n
+// images are verified at once. If n is less than 1, the number of CPUs is used.
+//
+// The returned channel is unbuffered, so verification proceeds no faster than results are
+// received. The channel is closed once a result has been sent for each image. If ctx is done
+// first, no further images are verified, results for images being verified at the time may be
+// discarded, and the channel is closed once their verification stops. The caller must receive
+// from the channel until it is closed, or cancel ctx.
+//
+// Any callback supplied with OptVerifyCallback may be called concurrently.
+func VerifyImages(ctx context.Context, images []*sif.FileImage, n int, opts ...VerifierOpt) <-chan ImageVerifyResult {
+	if n < 1 {
+		n = runtime.NumCPU()
+	}
+	if n > len(images) {
+		n = len(images)
+	}
+
+	indexes := make(chan int)
+	results := make(chan ImageVerifyResult)
+
+	go func() {
+		defer close(indexes)
+
+		for i := range images {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+
+	for w := 0; w < n; w++ {
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				r := ImageVerifyResult{
+					Index: i,
+					Image: images[i],
+					Err:   verifyImage(ctx, images[i], opts),
+				}
+
+				select {
+				case results <- r:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestVerifyImages(t *testing.T) {
+	names := []string{
+		"one-group-signed.sif",
+		"two-groups-signed.sif",
+		"one-group.sif",
+		"two-groups-signed.sif",
+	}
+
+	images := make([]*sif.FileImage, 0, len(names))
+	for _, name := range names {
+		f, err := sif.LoadContainer(filepath.Join("testdata", "images", name), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.UnloadContainer() // nolint:errcheck
+
+		images = append(images, &f)
+	}
+
+	kr := openpgp.EntityList{getTestEntity(t)}
+
+	tests := []struct {
+		name string
+		n    int
+	}{
+		{name: "Default", n: 0},
+		{name: "Serial", n: 1},
+		{name: "Concurrent", n: 2},
+		{name: "MoreWorkersThanImages", n: 8},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[int]bool)
+
+			for r := range VerifyImages(context.Background(), images, tt.n, OptVerifyWithKeyRing(kr)) {
+				if seen[r.Index] {
+					t.Errorf("image %d: duplicate result", r.Index)
+				}
+				seen[r.Index] = true
+
+				if r.Image != images[r.Index] {
+					t.Errorf("image %d: got wrong image", r.Index)
+				}
+
+				wantErr := error(nil)
+				if names[r.Index] == "one-group.sif" {
+					wantErr = &SignatureNotFoundError{}
+				}
+				if got := r.Err; !errors.Is(got, wantErr) {
+					t.Errorf("image %d: got error %v, want %v", r.Index, got, wantErr)
+				}
+			}
+
+			if got, want := len(seen), len(images); got != want {
+				t.Errorf("got %v results, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyImagesCancel(t *testing.T) {
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group-signed.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	images := []*sif.FileImage{&f, &f, &f}
+	kr := openpgp.EntityList{getTestEntity(t)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for r := range VerifyImages(ctx, images, 2, OptVerifyWithKeyRing(kr)) {
+		t.Errorf("image %d: unexpected result after cancellation", r.Index)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+var errNumberNotCanonical = errors.New("number cannot be canonically encoded")
+
+// maxSafeInteger is the largest integer that can be exactly represented in an IEEE 754 double,
+// and therefore reproduced by any JSON implementation.
+const maxSafeInteger = 1<<53 - 1
+
+// canonicalJSON returns the canonical JSON encoding of v, as described by RFC 8785. Object keys
+// are sorted, insignificant whitespace is omitted, and strings are escaped minimally.
+//
+// Only integer numbers with a magnitude no greater than 2^53-1 are supported, as these have a
+// single unambiguous representation. Other numbers result in errNumberNotCanonical.
+func canonicalJSON(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode to generic values, preserving the exact representation of numbers.
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var x interface{}
+	if err := dec.Decode(&x); err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	if err := writeCanonical(&buf, x); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonical writes the canonical JSON encoding of the generic JSON value x to buf.
+func writeCanonical(buf *bytes.Buffer, x interface{}) error {
+	switch x := x.(type) {
+	case nil:
+		buf.WriteString("null")
+
+	case bool:
+		buf.WriteString(strconv.FormatBool(x))
+
+	case json.Number:
+		n, err := strconv.ParseInt(x.String(), 10, 64)
+		if err != nil || n > maxSafeInteger || n < -maxSafeInteger {
+			return fmt.Errorf("%w: %v", errNumberNotCanonical, x)
+		}
+		buf.WriteString(strconv.FormatInt(n, 10))
+
+	case string:
+		writeCanonicalString(buf, x)
+
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, v := range x {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, v); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, x[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", x)
+	}
+	return nil
+}
+
+// writeCanonicalString writes s to buf as a JSON string, escaping only those characters that
+// must be escaped.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[r>>4])
+				buf.WriteByte(hex[r&0xf])
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// lessUTF16 reports whether a sorts before b when compared as arrays of UTF-16 code units.
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    string
+		wantErr error
+	}{
+		{name: "Null", v: nil, want: `null`},
+		{name: "Bool", v: true, want: `true`},
+		{name: "Integer", v: -42, want: `-42`},
+		{name: "MaxSafeInteger", v: int64(maxSafeInteger), want: `9007199254740991`},
+		{name: "UnsafeInteger", v: int64(maxSafeInteger + 1), wantErr: errNumberNotCanonical},
+		{name: "Float", v: 1.5, wantErr: errNumberNotCanonical},
+		{name: "Array", v: []int{3, 1, 2}, want: `[3,1,2]`},
+		{
+			name: "Struct",
+			v: struct {
+				B int `json:"b"`
+				A int `json:"a"`
+			}{1, 2},
+			want: `{"a":2,"b":1}`,
+		},
+		{
+			name: "Nested",
+			v:    map[string]interface{}{"z": map[string]int{"y": 1, "x": 2}, "a": []string{"c"}},
+			want: `{"a":["c"],"z":{"x":2,"y":1}}`,
+		},
+		{
+			// RFC 8785 sorts by UTF-16 code units, which orders U+1F600 (a surrogate pair) before
+			// U+FB33, unlike a sort on UTF-8 bytes or code points.
+			name: "KeyOrderUTF16",
+			v:    map[string]int{"דּ": 1, "\U0001f600": 2, "é": 3, "e": 4},
+			want: "{\"e\":4,\"é\":3,\"\U0001f600\":2,\"דּ\":1}",
+		},
+		{
+			name: "StringEscapes",
+			v:    "\"\\\b\f\n\r\t\x01\x1f/<>& é",
+			want: "\"\\\"\\\\\\b\\f\\n\\r\\t\\u0001\\u001f/<>& é\"",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := canonicalJSON(tt.v)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if err == nil {
+				if got, want := string(b), tt.want; got != want {
+					t.Errorf("got %s, want %s", got, want)
+				}
+
+				// Canonical encoding must be stable.
+				var x interface{}
+				if err := json.Unmarshal(b, &x); err != nil {
+					t.Fatal(err)
+				}
+				if c, err := canonicalJSON(x); err != nil {
+					t.Error(err)
+				} else if got, want := string(c), tt.want; got != want {
+					t.Errorf("got %s after round trip, want %s", got, want)
+				}
+			}
+		})
+	}
+}
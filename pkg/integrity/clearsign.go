@@ -7,20 +7,40 @@ package integrity
 
 import (
 	"bytes"
+	"crypto"
 	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
+	"time"
 
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/clearsign"
 	"golang.org/x/crypto/openpgp/packet"
 )
 
-var errClearsignedMsgNotFound = errors.New("clearsigned message not found")
+var (
+	errClearsignedMsgNotFound  = errors.New("clearsigned message not found")
+	errSignaturePacketNotFound = errors.New("signature packet not found")
+)
 
-// signAndEncodeJSON encodes v, clear-signs it with privateKey, and writes it to w. If config is
-// nil, sensible defaults are used.
+// signAndEncodeJSON encodes v using canonical JSON encoding, clear-signs it with privateKey, and
+// writes it to w. If config is nil, sensible defaults are used.
 func signAndEncodeJSON(w io.Writer, v interface{}, privateKey *packet.PrivateKey, config *packet.Config) error {
+	b, err := canonicalJSON(v)
+	if err != nil {
+		return err
+	}
+	return signAndEncode(w, b, privateKey, config)
+}
+
+// signAndEncode clear-signs b with privateKey, and writes it to w. If config is nil, sensible
+// defaults are used.
+func signAndEncode(w io.Writer, b []byte, privateKey *packet.PrivateKey, config *packet.Config) error {
+	if err := checkFIPSSigning(privateKey, config); err != nil {
+		return err
+	}
+
 	// Get clearsign encoder.
 	plaintext, err := clearsign.Encode(w, privateKey, config)
 	if err != nil {
@@ -28,8 +48,8 @@ func signAndEncodeJSON(w io.Writer, v interface{}, privateKey *packet.PrivateKey
 	}
 	defer plaintext.Close()
 
-	// Wrap clearsign encoder with JSON encoder.
-	return json.NewEncoder(plaintext).Encode(v)
+	_, err = plaintext.Write(b)
+	return err
 }
 
 // verifyAndDecodeJSON reads the first clearsigned message in data, verifies its signature, and
@@ -58,9 +78,61 @@ func verifyAndDecode(data []byte, kr openpgp.KeyRing) (*openpgp.Entity, []byte,
 		return nil, nil, rest, errClearsignedMsgNotFound
 	}
 
+	sig, err := ioutil.ReadAll(b.ArmoredSignature.Body)
+	if err != nil {
+		return nil, nil, rest, err
+	}
+
+	// In FIPS mode, refuse a signature using a hash that is not approved before checking it.
+	var sp signaturePacket
+	if FIPSMode() {
+		if sp, err = readSignaturePacket(bytes.NewReader(sig)); err != nil {
+			return nil, nil, rest, err
+		}
+		if err := checkFIPSHash(sp.hash); err != nil {
+			return nil, nil, rest, err
+		}
+	}
+
 	// Check signature.
-	e, err := openpgp.CheckDetachedSignature(kr, bytes.NewReader(b.Bytes), b.ArmoredSignature.Body)
-	return e, b.Plaintext, rest, err
+	e, err := openpgp.CheckDetachedSignature(kr, bytes.NewReader(b.Bytes), bytes.NewReader(sig))
+	if err != nil {
+		return e, b.Plaintext, rest, err
+	}
+
+	// In FIPS mode, refuse a signature made with a key that is not approved.
+	if err := checkFIPSEntity(e, sp.keyID); err != nil {
+		return e, b.Plaintext, rest, err
+	}
+
+	return e, b.Plaintext, rest, nil
+}
+
+// signaturePacket describes the signature packet of a clearsigned message.
+type signaturePacket struct {
+	keyID   uint64      // Key ID of the issuer, or zero if not recorded.
+	hash    crypto.Hash // Hash algorithm used by the signature.
+	created time.Time   // Creation time of the signature.
+}
+
+// readSignaturePacket reads a signature packet from r.
+func readSignaturePacket(r io.Reader) (signaturePacket, error) {
+	p, err := packet.Read(r)
+	if err != nil {
+		return signaturePacket{}, err
+	}
+
+	switch sp := p.(type) {
+	case *packet.Signature:
+		var keyID uint64
+		if sp.IssuerKeyId != nil {
+			keyID = *sp.IssuerKeyId
+		}
+		return signaturePacket{keyID, sp.Hash, sp.CreationTime}, nil
+	case *packet.SignatureV3:
+		return signaturePacket{sp.IssuerKeyId, sp.Hash, sp.CreationTime}, nil
+	}
+	return signaturePacket{}, errSignaturePacketNotFound
 }
 
 // isLegacySignature reads the first clearsigned message in data, and returns true if the plaintext
@@ -72,7 +144,12 @@ func isLegacySignature(data []byte) (bool, error) {
 		return false, errClearsignedMsgNotFound
 	}
 
+	return isLegacyPlaintext(b.Plaintext), nil
+}
+
+// isLegacyPlaintext returns true if plaintext is that of a legacy signature.
+func isLegacyPlaintext(plaintext []byte) bool {
 	// The plaintext of legacy signatures always begins with "SIFHASH", and non-legacy signatures
 	// never do, as they are JSON.
-	return bytes.HasPrefix(b.Plaintext, []byte("SIFHASH:\n")), nil
+	return bytes.HasPrefix(plaintext, []byte("SIFHASH:\n"))
 }
@@ -0,0 +1,128 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+var errDifferentialLegacy = errors.New("differential verification not supported by legacy signatures")
+
+// VerifiedObject records a data object whose data was found to match the digest recorded in a
+// signature.
+type VerifiedObject struct {
+	ID     uint32 `json:"id"`     // Object ID.
+	Offset int64  `json:"offset"` // Offset of the object data in the image.
+	Length int64  `json:"length"` // Length of the object data.
+	Mtime  int64  `json:"mtime"`  // Modification time of the object descriptor.
+	Digest string `json:"digest"` // Digest recorded in the signature, of format "alg:value".
+}
+
+// Manifest records the data objects of an image verified by a Verifier. It may be stored
+// alongside an image, such as one cached on a node, and supplied to a later Verifier using
+// OptVerifyDifferential.
+type Manifest struct {
+	ImageID string           `json:"imageId"` // ID of the image verified.
+	Objects []VerifiedObject `json:"objects"` // Objects verified, sorted by ID.
+}
+
+// digestString returns d in the format of VerifiedObject.Digest.
+func digestString(d digest) string {
+	return fmt.Sprintf("%s:%x", supportedAlgorithms[d.hash], d.value)
+}
+
+// newVerifiedObject returns a VerifiedObject recording od, verified against om.
+func newVerifiedObject(od *sif.Descriptor, om objectMetadata) VerifiedObject {
+	return VerifiedObject{
+		ID:     od.ID,
+		Offset: od.Fileoff,
+		Length: od.Filelen,
+		Mtime:  od.Mtime,
+		Digest: digestString(om.ObjectDigest),
+	}
+}
+
+// unchanged returns true if m records that the data of od was verified against the digest in om,
+// and the extent and modification time of od have not changed since.
+func (m *Manifest) unchanged(od *sif.Descriptor, om objectMetadata) bool {
+	return m.contains(newVerifiedObject(od, om))
+}
+
+// unchanged returns true if the data of od need not be hashed to verify it against om, as it is
+// recorded as verified in the manifest supplied to v.
+func (v *groupVerifier) unchanged(od *sif.Descriptor, om objectMetadata) bool {
+	return v.prior != nil && v.prior.unchanged(od, om)
+}
+
+// record adds the objects in ids, verified against im, to the objects verified by v.
+func (v *groupVerifier) record(im imageMetadata, ids []uint32) {
+	for _, id := range ids {
+		om, _, err := im.metadataForObject(id)
+		if err != nil {
+			continue
+		}
+		for _, od := range v.ods {
+			if od.ID == id {
+				v.seen = append(v.seen, newVerifiedObject(od, om))
+			}
+		}
+	}
+}
+
+// OptVerifyDifferential supplies the manifest m, produced by Manifest following an earlier
+// verification of the same image. Signatures, the global header and object descriptors are
+// verified as usual, but the data of an object is not hashed if m records that it was verified
+// against the same digest, and its offset, length and modification time are unchanged. This
+// allows images that are frequently re-checked, such as those cached on nodes, to be verified
+// quickly.
+//
+// A manifest for a different image is ignored. As object data is not hashed, modification of the
+// data in place is not detected, so m must be stored where it cannot be tampered with, and
+// differential verification is only appropriate where the image file itself is protected from
+// modification other than by replacement. Legacy signatures do not support differential
+// verification.
+func OptVerifyDifferential(m Manifest) VerifierOpt {
+	return func(v *Verifier) error {
+		v.prior = &m
+		return nil
+	}
+}
+
+// Manifest returns a manifest recording the data objects verified by the most recent verification,
+// for use with OptVerifyDifferential. Objects skipped using a manifest supplied by
+// OptVerifyDifferential are included.
+func (v *Verifier) Manifest() Manifest {
+	m := Manifest{ImageID: v.f.GetHeader().ID.String()}
+
+	for _, t := range v.tasks {
+		gv, ok := t.(*groupVerifier)
+		if !ok {
+			continue
+		}
+		for _, vo := range gv.seen {
+			if !m.contains(vo) {
+				m.Objects = append(m.Objects, vo)
+			}
+		}
+	}
+
+	sort.SliceStable(m.Objects, func(i, j int) bool { return m.Objects[i].ID < m.Objects[j].ID })
+	return m
+}
+
+// contains returns true if m contains vo.
+func (m *Manifest) contains(vo VerifiedObject) bool {
+	for _, o := range m.Objects {
+		if o == vo {
+			return true
+		}
+	}
+	return false
+}
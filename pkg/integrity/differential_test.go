@@ -0,0 +1,114 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"crypto"
+	"errors"
+	"hash"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestVerifier_Differential(t *testing.T) {
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group-signed.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	var n int
+	RegisterHash(crypto.SHA256, func() hash.Hash {
+		return countingHash{crypto.SHA256.New(), &n}
+	})
+	defer RegisterHash(crypto.SHA256, nil)
+
+	kr := openpgp.EntityList{getTestEntity(t)}
+
+	// verify returns the manifest of a verification using opts, along with the number of bytes
+	// hashed.
+	verify := func(t *testing.T, opts ...VerifierOpt) (Manifest, int) {
+		n = 0
+
+		v, err := NewVerifier(&f, append(opts, OptVerifyWithKeyRing(kr))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Verify(); err != nil {
+			t.Fatal(err)
+		}
+		return v.Manifest(), n
+	}
+
+	full, fullHashed := verify(t)
+
+	if got, want := full.ImageID, f.Header.ID.String(); got != want {
+		t.Errorf("got image ID %v, want %v", got, want)
+	}
+	if got, want := len(full.Objects), 2; got != want {
+		t.Fatalf("got %v objects, want %v", got, want)
+	}
+
+	var dataLen int
+	for i, vo := range full.Objects {
+		od, err := getObject(&f, vo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && vo.ID < full.Objects[i-1].ID {
+			t.Errorf("got object %v after object %v", vo.ID, full.Objects[i-1].ID)
+		}
+		if vo.Offset != od.Fileoff || vo.Length != od.Filelen || vo.Mtime != od.Mtime {
+			t.Errorf("object %v: got %+v, want extent %v+%v", vo.ID, vo, od.Fileoff, od.Filelen)
+		}
+		dataLen += int(od.Filelen)
+	}
+
+	moved := Manifest{ImageID: full.ImageID, Objects: append([]VerifiedObject(nil), full.Objects...)}
+	moved.Objects[0].Offset++
+
+	other := Manifest{ImageID: "other", Objects: full.Objects}
+
+	tests := []struct {
+		name       string
+		m          Manifest
+		wantHashed int
+	}{
+		{"Unchanged", full, fullHashed - dataLen},
+		{"Moved", moved, fullHashed - dataLen + int(full.Objects[1].Length)},
+		{"OtherImage", other, fullHashed},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m, hashed := verify(t, OptVerifyDifferential(tt.m))
+
+			if got, want := hashed, tt.wantHashed; got != want {
+				t.Errorf("got %v bytes hashed, want %v", got, want)
+			}
+			if got, want := len(m.Objects), len(full.Objects); got != want {
+				t.Errorf("got %v objects in manifest, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewVerifier_DifferentialLegacy(t *testing.T) {
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group-signed-legacy.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	_, err = NewVerifier(&f, OptVerifyLegacy(), OptVerifyDifferential(Manifest{}))
+	if got, want := err, errDifferentialLegacy; !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+}
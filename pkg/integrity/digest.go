@@ -12,9 +12,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"strings"
 
+	"github.com/sylabs/sif/internal/pkg/blake3"
 	"github.com/sylabs/sif/pkg/sif"
 )
 
@@ -24,6 +26,14 @@ var (
 	errDigestMalformed = errors.New("digest malformed")
 )
 
+// BLAKE3 identifies the BLAKE3 hash function, which the crypto package does not define. BLAKE3 is
+// considerably faster than SHA-2, but is not approved for use under FIPS 140. It is available for
+// integrity checks that are not signed, such as data object checksums, and is never used unless
+// selected. It is not supported for signatures.
+const BLAKE3 = crypto.Hash(0x100)
+
+// supportedAlgorithms holds the hash functions supported for signatures. BLAKE3 is deliberately
+// absent.
 var supportedAlgorithms = map[crypto.Hash]string{
 	crypto.SHA1:   "sha1",
 	crypto.SHA224: "sha224",
@@ -32,14 +42,52 @@ var supportedAlgorithms = map[crypto.Hash]string{
 	crypto.SHA512: "sha512",
 }
 
+// hashFuncs holds hash implementations registered with RegisterHash.
+var hashFuncs = map[crypto.Hash]func() hash.Hash{}
+
+// RegisterHash registers a function that returns a new instance of hash function h, to be used in
+// place of the implementation registered with the crypto package when signing and verifying. This
+// allows an optimized implementation to be selected, such as one using SIMD instructions on
+// AMD64, or the cryptography extensions on ARM64. If f is nil, any implementation previously
+// registered for h is removed.
+//
+// RegisterHash is intended to be called from an init function, and is not safe for concurrent
+// use with signing or verification.
+func RegisterHash(h crypto.Hash, f func() hash.Hash) {
+	if f == nil {
+		delete(hashFuncs, h)
+		return
+	}
+	hashFuncs[h] = f
+}
+
+// newHash returns a new instance of hash function h, using the implementation registered with
+// RegisterHash if there is one. If h is not available, errHashUnavailable is returned. In FIPS
+// mode, an AlgorithmNotApprovedError is returned if h is not approved.
+func newHash(h crypto.Hash) (hash.Hash, error) {
+	if err := checkFIPSHash(h); err != nil {
+		return nil, err
+	}
+	if f, ok := hashFuncs[h]; ok {
+		return f(), nil
+	}
+	if h == BLAKE3 {
+		return blake3.New(), nil
+	}
+	if !h.Available() {
+		return nil, errHashUnavailable
+	}
+	return h.New(), nil
+}
+
 // hashValue calculates a digest by applying hash function h to the contents read from r. If h is
 // not available, errHashUnavailable is returned.
 func hashValue(h crypto.Hash, r io.Reader) ([]byte, error) {
-	if !h.Available() {
-		return nil, errHashUnavailable
+	w, err := newHash(h)
+	if err != nil {
+		return nil, err
 	}
 
-	w := h.New()
 	if _, err := io.Copy(w, r); err != nil {
 		return nil, err
 	}
@@ -83,6 +131,8 @@ func hashType(ht sif.Hashtype) (crypto.Hash, error) {
 		return crypto.SHA384, nil
 	case sif.HashSHA512:
 		return crypto.SHA512, nil
+	case sif.HashBLAKE3:
+		return BLAKE3, nil
 	}
 	return 0, errHashUnsupported
 }
@@ -11,6 +11,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"hash"
 	"io"
 	"reflect"
 	"strings"
@@ -32,6 +33,12 @@ func TestNewLegacyDigest(t *testing.T) {
 			ht:        0,
 			wantError: errHashUnsupported,
 		},
+		{
+			name:      "HashBLAKE3",
+			ht:        sif.HashBLAKE3,
+			text:      "SIFHASH:\n6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85\n",
+			wantError: errHashUnsupported,
+		},
 		{
 			name:      "DigestMalformed",
 			ht:        sif.HashSHA256,
@@ -251,3 +258,58 @@ func TestDigest_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+// countingHash wraps a hash.Hash, counting the bytes written to it.
+type countingHash struct {
+	hash.Hash
+	n *int
+}
+
+func (h countingHash) Write(b []byte) (int, error) {
+	*h.n += len(b)
+	return h.Hash.Write(b)
+}
+
+func TestRegisterHash(t *testing.T) {
+	var n int
+	RegisterHash(crypto.SHA256, func() hash.Hash {
+		return countingHash{crypto.SHA256.New(), &n}
+	})
+	defer RegisterHash(crypto.SHA256, nil)
+
+	d, err := newDigestReader(crypto.SHA256, strings.NewReader("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 4; got != want {
+		t.Errorf("got %v bytes hashed by registered implementation, want %v", got, want)
+	}
+
+	RegisterHash(crypto.SHA256, nil)
+
+	ok, err := d.matches(strings.NewReader("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("digest from registered implementation does not match")
+	}
+	if got, want := n, 4; got != want {
+		t.Errorf("got %v bytes hashed by removed implementation, want %v", got, want)
+	}
+}
+
+func TestBLAKE3(t *testing.T) {
+	value, err := hashValue(BLAKE3, strings.NewReader("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(value), "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"; got != want {
+		t.Errorf("got value %v, want %v", got, want)
+	}
+
+	// BLAKE3 digests are not supported in signatures.
+	if _, err := newDigest(BLAKE3, value); !errors.Is(err, errHashUnsupported) {
+		t.Errorf("got error %v, want %v", err, errHashUnsupported)
+	}
+}
@@ -23,6 +23,19 @@ Finally, to apply the signature(s):
 
 	err := s.Sign()
 
+When objects are appended to an image that is already signed, the new objects may be signed
+without hashing the existing objects again, by extending the prior signature made by the same
+entity. The verifier treats the prior signature and the signature extending it as one:
+
+	s, err := integrity.NewSigner(f, OptSignWithEntity(e), OptSignIncremental())
+
+Keys held in a key management service or hardware token may be referenced by URI, once a provider
+for the URI scheme has been registered:
+
+	err := integrity.RegisterKeyProvider("awskms", p)
+
+	s, err := integrity.NewSigner(f, OptSignWithKeyURI("awskms:///alias/image-signing"))
+
 Verify
 
 To examine and/or verify digital signatures in a SIF, create a Verifier:
@@ -42,5 +55,197 @@ on object group 1 only:
 Finally, to perform cryptographic verification:
 
 	err := v.Verify()
+
+To present the result of each signature as it is verified, in the same form as other tools:
+
+	cb := func(r VerifyResult) bool {
+		fmt.Print(FmtVerifySummary(r))
+		return false
+	}
+
+	v, err := NewVerifier(f, OptVerifyWithKeyRing(kr), OptVerifyCallback(cb))
+
+FmtVerifyAudit formats a detailed description of a result, suitable for recording in an audit log.
+
+To verify an image that may be mounted, or otherwise in use, by a cooperating process, load it
+with a shared lock. Any number of processes may hold a shared lock at once, while a process
+modifying the image, such as to add a signature, must hold an exclusive lock. The descriptors
+verified therefore cannot change until the image is unloaded:
+
+	f, err := sif.LoadContainer(path, true, sif.OptLoadLock(true))
+
+Signing and verification of large images may be cancelled, or bounded by a deadline, using
+SignContext and VerifyContext in place of Sign and Verify.
+
+To give quick feedback, such as in an interactive tool, verification may be limited to a time
+budget. If the budget is exhausted, Verify returns an error wrapping ErrVerifyIncomplete, and a
+full check may be scheduled for later:
+
+	v, err := NewVerifier(f, OptVerifyWithKeyRing(kr), OptVerifyTimeBudget(time.Second))
+
+To verify many images at once, with at most n verified concurrently, receive the result for each
+image from the channel returned by VerifyImages. Cancelling ctx stops verification early:
+
+	for r := range VerifyImages(ctx, images, n, OptVerifyWithKeyRing(kr)) {
+		...
+	}
+
+To use the keyrings of Apptainer and Singularity, as found in their standard locations, in place
+of a keyring supplied by the caller:
+
+	v, err := NewVerifier(f, OptVerifyWithDiscoveredKeyRings())
+
+Images held by other backends, such as images fetched lazily from a remote store, may be verified
+by supplying an implementation of ImageReader in place of a *sif.FileImage:
+
+	v, err := NewVerifier(r, OptVerifyWithKeyRing(kr))
+
+Identity
+
+To bind signature(s) to the name and URI an image is published under, supply an identity claim
+when signing:
+
+	s, err := integrity.NewSigner(f, OptSignWithEntity(e), OptSignWithIdentity(name, uri))
+
+To require that signatures claim the identity of the reference an image was retrieved from:
+
+	v, err := NewVerifier(f, OptVerifyWithKeyRing(kr), OptVerifyIdentity(name, uri))
+
+To protect against rollback to an older image, supply an epoch claim that increases with each
+release when signing, and require a minimum epoch when verifying:
+
+	s, err := integrity.NewSigner(f, OptSignWithEntity(e), OptSignWithEpoch(epoch))
+
+	v, err := NewVerifier(f, OptVerifyWithKeyRing(kr), OptVerifyMinEpoch(minEpoch))
+
+Roles
+
+To record the capacity in which an entity signs, such as the builder of an image or a reviewer
+approving its definition file, supply a role claim when signing. Objects may be signed
+individually, so that each is approved by the appropriate party:
+
+	s, err := integrity.NewSigner(f, OptSignWithEntity(e), OptSignObjects(id), OptSignWithRole("approved-by-security"))
+
+To enforce separation of duties, require that signatures covering an object claim each of a set of
+roles, with each role claimed by a different entity:
+
+	v, err := NewVerifier(f, OptVerifyWithKeyRing(kr), OptVerifyObject(id), OptVerifyRoles("built-by", "approved-by-security"))
+
+Waivers
+
+Where an image cannot be fully signed, a signed waiver may exempt specific findings, such as a data
+object that is not part of an object group, until it expires:
+
+	wv, err := NewWaiver(f, []uint32{id}, nil, reason, expires)
+
+	err = SignWaiver(w, wv, e)
+
+To apply waivers, supply them when verifying, and record the waivers applied for audit:
+
+	v, err := NewVerifier(f, OptVerifyWithKeyRing(kr), OptVerifyWaiver(b))
+
+	err = v.Verify()
+
+	aws := v.AppliedWaivers()
+
+Inspect
+
+To catalogue the signatures in a SIF without verifying them, such as when taking an inventory of
+who signed what, use InspectSignatures. No key material is required, and nothing it reports
+should be trusted until the signature is verified:
+
+	sis, err := InspectSignatures(f)
+
+Notation
+
+Signatures compatible with Notation (Notary v2) are created using an X.509 certificate chain in
+place of PGP key material, and stored as JWS envelopes:
+
+	s, err := NewNotationSigner(f, key, certs)
+
+	err = s.Sign()
+
+To verify Notation signatures, supply the trusted root certificates:
+
+	v, err := NewNotationVerifier(f, roots)
+
+	err = v.Verify()
+
+Post-Quantum Signatures
+
+The envelope format and algorithm identifiers for post-quantum signatures, such as ML-DSA, are
+defined so that images may carry them without changes to the on-disk format. No implementation
+is included. In builds with the experimental sif_experimental_pq build tag, an implementation
+may be registered, and used to sign images:
+
+	RegisterPQAlgorithm(PQAlgorithmMLDSA65, verify)
+
+	s, err := NewPQSigner(f, key)
+
+	err = s.Sign()
+
+Post-quantum signatures are verified with the encoded public key of the signer. Where no
+implementation of the algorithm is registered, an error wrapping ErrPQAlgorithmUnsupported is
+returned. Registered implementations are not part of a validated module, so post-quantum
+signatures are refused in FIPS mode:
+
+	v, err := NewPQVerifier(f, PQAlgorithmMLDSA65, pub)
+
+	err = v.Verify()
+
+OCI Registries
+
+A SIF image stored as an artifact in an OCI registry may be verified against detached signatures
+stored alongside it, following the cosign tag convention. The artifact is identified by digest,
+and the contents of the image are checked against the artifact manifest:
+
+	v, err := NewOCIVerifier(pub)
+
+	err = v.Verify(ctx, "registry.example.com/org/repo@sha256:...", r)
+
+Air-Gapped Transfer
+
+For controlled transfer into an air-gapped environment, an image may be exported to a single
+archive, along with detached signatures and a verification policy. The archive carries a
+versioned manifest holding the checksum of each entry:
+
+	err := Export(w, f, OptExportSignature("release.sig", sig), OptExportPolicy(policy))
+
+On import, each entry is checked against the manifest, and the image is written to w:
+
+	a, err := Import(r, w)
+
+Hash Implementations
+
+Hashing dominates the cost of signing and verifying large images. By default, the
+implementations registered with the crypto package are used. An optimized implementation, such
+as one using SIMD instructions, may be selected in its place, typically from a file guarded by a
+build tag in the main package:
+
+	func init() {
+		integrity.RegisterHash(crypto.SHA256, sha256simd.New)
+	}
+
+BLAKE3 is available for integrity checks that are not signed, where speed matters more than FIPS
+compliance. It is never used unless selected, and is not supported for signatures.
+
+Where an image is re-checked frequently, such as one cached on a node, the manifest of a previous
+verification may be supplied to skip hashing data objects whose extent and signed digest are
+unchanged. Signatures and descriptors are still verified:
+
+	err = v.Verify()
+	m := v.Manifest()
+
+	v, err = NewVerifier(f, OptVerifyWithKeyRing(kr), OptVerifyDifferential(m))
+
+FIPS Mode
+
+Deployments built against a FIPS 140 validated module, such as BoringCrypto, may restrict signing
+and verification to approved algorithms. Where a signature, key or digest uses an algorithm that
+is not approved, an error wrapping an AlgorithmNotApprovedError is returned:
+
+	func init() {
+		integrity.SetFIPSMode(true)
+	}
 */
 package integrity
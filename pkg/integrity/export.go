@@ -0,0 +1,366 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// An export archive is a tar archive holding a SIF image, along with any detached signatures and
+// verification policy to be transferred with it. The first entry of the archive is a manifest,
+// listing the name, kind, size and SHA-256 checksum of each of the remaining entries. The
+// manifest carries a format version, which is incremented whenever the archive format changes in
+// a way that older readers cannot accept.
+
+var (
+	errExportNilImage        = errors.New("image is nil")
+	errExportNameInvalid     = errors.New("name invalid")
+	errExportNameDuplicate   = errors.New("name duplicated")
+	errExportManifestMissing = errors.New("manifest missing")
+	errExportVersion         = errors.New("export format version not supported")
+	errExportEntryUnexpected = errors.New("unexpected archive entry")
+	errExportEntryMissing    = errors.New("archive entry missing")
+	errExportImageCount      = errors.New("archive must contain exactly one image")
+)
+
+// ErrExportChecksumMismatch is the error returned when the content of an export archive does not
+// match its manifest.
+var ErrExportChecksumMismatch = errors.New("export checksum mismatch")
+
+const (
+	// ExportFormatVersion is the version of the export archive format written by Export.
+	ExportFormatVersion = 1
+
+	exportManifestName = "manifest.json"
+	exportImageName    = "image.sif"
+	exportPolicyName   = "policy"
+	exportSigDir       = "signatures"
+)
+
+// ExportKind describes the content of an entry in an export archive.
+type ExportKind string
+
+// List of export archive entry kinds.
+const (
+	ExportImage     ExportKind = "image"     // SIF image
+	ExportSignature ExportKind = "signature" // detached signature of the image
+	ExportPolicy    ExportKind = "policy"    // verification policy for the image
+)
+
+// ExportEntry describes an entry in an export archive.
+type ExportEntry struct {
+	Name   string     `json:"name"`   // Name of the entry within the archive.
+	Kind   ExportKind `json:"kind"`   // Content of the entry.
+	Size   int64      `json:"size"`   // Size of the entry, in bytes.
+	SHA256 string     `json:"sha256"` // Hex-encoded SHA-256 checksum of the entry.
+}
+
+// ExportManifest is the manifest of an export archive.
+type ExportManifest struct {
+	FormatVersion int           `json:"formatVersion"`
+	Created       time.Time     `json:"created"`
+	Entries       []ExportEntry `json:"entries"`
+}
+
+// exportOpts accumulates export options.
+type exportOpts struct {
+	sigs   map[string][]byte
+	policy []byte
+	t      time.Time
+}
+
+// ExportOpt are used to specify export options.
+type ExportOpt func(*exportOpts) error
+
+// OptExportSignature includes the detached signature b in the export archive, under name. The
+// signature is transferred as is, and is not verified by Export or Import.
+func OptExportSignature(name string, b []byte) ExportOpt {
+	return func(eo *exportOpts) error {
+		if name == "" || path.Base(name) != name || name == "." || name == ".." {
+			return fmt.Errorf("%w: %q", errExportNameInvalid, name)
+		}
+		if _, ok := eo.sigs[name]; ok {
+			return fmt.Errorf("%w: %q", errExportNameDuplicate, name)
+		}
+		eo.sigs[name] = b
+		return nil
+	}
+}
+
+// OptExportPolicy includes the verification policy b in the export archive. The policy is
+// transferred as is, and is not interpreted by Export or Import.
+func OptExportPolicy(b []byte) ExportOpt {
+	return func(eo *exportOpts) error {
+		eo.policy = b
+		return nil
+	}
+}
+
+// OptExportTime sets the creation time recorded in the export archive. By default, the current
+// time is used.
+func OptExportTime(t time.Time) ExportOpt {
+	return func(eo *exportOpts) error {
+		eo.t = t
+		return nil
+	}
+}
+
+// checksum returns the hex-encoded SHA-256 checksum of the data read from r, and its size.
+func checksum(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// writeExportEntry writes a tar entry named name holding size bytes read from r to tw.
+func writeExportEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	hdr := tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := tw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+	_, err := io.CopyN(tw, r, size)
+	return err
+}
+
+// Export writes an export archive to w, holding image f, along with the detached signatures and
+// verification policy specified by opts. The archive may be read with Import.
+func Export(w io.Writer, f *sif.FileImage, opts ...ExportOpt) error {
+	if f == nil {
+		return fmt.Errorf("integrity: %w", errExportNilImage)
+	}
+
+	eo := exportOpts{
+		sigs: make(map[string][]byte),
+		t:    time.Now(),
+	}
+	for _, opt := range opts {
+		if err := opt(&eo); err != nil {
+			return fmt.Errorf("integrity: %w", err)
+		}
+	}
+	t := eo.t.UTC().Truncate(time.Second)
+
+	image := io.NewSectionReader(f.Fp, 0, f.Filesize)
+	sum, size, err := checksum(image)
+	if err != nil {
+		return fmt.Errorf("integrity: %w", err)
+	}
+
+	m := ExportManifest{
+		FormatVersion: ExportFormatVersion,
+		Created:       t,
+		Entries:       []ExportEntry{{Name: exportImageName, Kind: ExportImage, Size: size, SHA256: sum}},
+	}
+
+	names := make([]string, 0, len(eo.sigs))
+	for name := range eo.sigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make(map[string][]byte)
+	for _, name := range names {
+		b := eo.sigs[name]
+		sum, size, _ := checksum(bytes.NewReader(b))
+		name = path.Join(exportSigDir, name)
+		m.Entries = append(m.Entries, ExportEntry{Name: name, Kind: ExportSignature, Size: size, SHA256: sum})
+		files[name] = b
+	}
+
+	if eo.policy != nil {
+		sum, size, _ := checksum(bytes.NewReader(eo.policy))
+		m.Entries = append(m.Entries, ExportEntry{Name: exportPolicyName, Kind: ExportPolicy, Size: size, SHA256: sum})
+		files[exportPolicyName] = eo.policy
+	}
+
+	mb, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return fmt.Errorf("integrity: %w", err)
+	}
+
+	tw := tar.NewWriter(w)
+
+	if err := writeExportEntry(tw, exportManifestName, int64(len(mb)), t, bytes.NewReader(mb)); err != nil {
+		return fmt.Errorf("integrity: %w", err)
+	}
+
+	for _, e := range m.Entries {
+		r := io.Reader(bytes.NewReader(files[e.Name]))
+		if e.Kind == ExportImage {
+			r = io.NewSectionReader(f.Fp, 0, f.Filesize)
+		}
+
+		// The image is read again as it is written, so check it has not changed since it was
+		// summed.
+		h := sha256.New()
+		if err := writeExportEntry(tw, e.Name, e.Size, t, io.TeeReader(r, h)); err != nil {
+			return fmt.Errorf("integrity: %w", err)
+		}
+		if hex.EncodeToString(h.Sum(nil)) != e.SHA256 {
+			return fmt.Errorf("integrity: %w: %v", ErrExportChecksumMismatch, e.Name)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("integrity: %w", err)
+	}
+	return nil
+}
+
+// ExportArchive describes the content of an export archive read by Import.
+type ExportArchive struct {
+	Manifest   ExportManifest    // Manifest of the archive.
+	Signatures map[string][]byte // Detached signatures, by name.
+	Policy     []byte            // Verification policy, or nil if the archive contains none.
+}
+
+// checkedReader computes the SHA-256 checksum of data read through it.
+type checkedReader struct {
+	r io.Reader
+	h hash.Hash
+}
+
+func (cr *checkedReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.h.Write(p[:n]) // nolint:errcheck
+	return n, err
+}
+
+// readExportManifest reads the manifest of an export archive from tr, and checks it describes a
+// supported archive.
+func readExportManifest(tr *tar.Reader) (map[string]ExportEntry, ExportManifest, error) {
+	var m ExportManifest
+
+	hdr, err := tr.Next()
+	if err == io.EOF || (err == nil && hdr.Name != exportManifestName) {
+		return nil, m, errExportManifestMissing
+	} else if err != nil {
+		return nil, m, err
+	}
+
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, m, fmt.Errorf("decoding manifest: %w", err)
+	}
+	if m.FormatVersion < 1 || m.FormatVersion > ExportFormatVersion {
+		return nil, m, fmt.Errorf("%w: %d", errExportVersion, m.FormatVersion)
+	}
+
+	entries := make(map[string]ExportEntry)
+	images := 0
+	for _, e := range m.Entries {
+		if _, ok := entries[e.Name]; ok || e.Name == exportManifestName {
+			return nil, m, fmt.Errorf("%w: %q", errExportNameDuplicate, e.Name)
+		}
+		switch e.Kind {
+		case ExportImage:
+			images++
+		case ExportSignature:
+			if path.Dir(e.Name) != exportSigDir {
+				return nil, m, fmt.Errorf("%w: %q", errExportNameInvalid, e.Name)
+			}
+		case ExportPolicy:
+		default:
+			return nil, m, fmt.Errorf("%w: %q of kind %q", errExportEntryUnexpected, e.Name, e.Kind)
+		}
+		entries[e.Name] = e
+	}
+	if images != 1 {
+		return nil, m, errExportImageCount
+	}
+
+	return entries, m, nil
+}
+
+// Import reads an export archive written by Export from r. The image is written to w, and the
+// detached signatures and verification policy are returned. The size and checksum of each entry
+// in the archive is checked against the manifest, and ErrExportChecksumMismatch is returned if
+// either does not match.
+//
+// As the image is written to w as it is read, data may have been written to w when an error is
+// returned, and the caller must then discard it.
+func Import(r io.Reader, w io.Writer) (*ExportArchive, error) {
+	tr := tar.NewReader(r)
+
+	entries, m, err := readExportManifest(tr)
+	if err != nil {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+
+	a := ExportArchive{
+		Manifest:   m,
+		Signatures: make(map[string][]byte),
+	}
+
+	seen := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+
+		e, ok := entries[hdr.Name]
+		if !ok || seen[hdr.Name] {
+			return nil, fmt.Errorf("integrity: %w: %q", errExportEntryUnexpected, hdr.Name)
+		}
+		seen[hdr.Name] = true
+
+		if hdr.Size != e.Size {
+			return nil, fmt.Errorf("integrity: %w: %v: size %d, expected %d",
+				ErrExportChecksumMismatch, e.Name, hdr.Size, e.Size)
+		}
+
+		cr := &checkedReader{r: tr, h: sha256.New()}
+		switch e.Kind {
+		case ExportImage:
+			_, err = io.Copy(w, cr)
+		case ExportSignature:
+			a.Signatures[path.Base(e.Name)], err = ioutil.ReadAll(cr)
+		case ExportPolicy:
+			a.Policy, err = ioutil.ReadAll(cr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+
+		if got := hex.EncodeToString(cr.h.Sum(nil)); got != e.SHA256 {
+			return nil, fmt.Errorf("integrity: %w: %v", ErrExportChecksumMismatch, e.Name)
+		}
+	}
+
+	for _, e := range m.Entries {
+		if !seen[e.Name] {
+			return nil, fmt.Errorf("integrity: %w: %q", errExportEntryMissing, e.Name)
+		}
+	}
+
+	return &a, nil
+}
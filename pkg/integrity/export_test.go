@@ -0,0 +1,252 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// archiveEntry is an entry in a tar archive.
+type archiveEntry struct {
+	name string
+	data []byte
+}
+
+// readArchive returns the entries of the tar archive b.
+func readArchive(t *testing.T, b []byte) []archiveEntry {
+	var entries []archiveEntry
+
+	tr := tar.NewReader(bytes.NewReader(b))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, archiveEntry{hdr.Name, data})
+	}
+}
+
+// writeArchive returns a tar archive containing entries.
+func writeArchive(t *testing.T, entries []archiveEntry) []byte {
+	var b bytes.Buffer
+
+	tw := tar.NewWriter(&b)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestExportImport(t *testing.T) {
+	path := filepath.Join("testdata", "images", "one-group-signed.sif")
+
+	f, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	image, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := []byte("-----BEGIN PGP SIGNATURE-----\n")
+	policy := []byte(`{"require":"signed"}`)
+	created := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	var b bytes.Buffer
+	err = Export(&b, &f,
+		OptExportSignature("release.sig", sig),
+		OptExportPolicy(policy),
+		OptExportTime(created),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := b.Bytes()
+
+	// Round trip.
+	var out bytes.Buffer
+	a, err := Import(bytes.NewReader(archive), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), image) {
+		t.Error("imported image does not match")
+	}
+	if got, want := a.Signatures, map[string][]byte{"release.sig": sig}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got signatures %q, want %q", got, want)
+	}
+	if got, want := a.Policy, policy; !bytes.Equal(got, want) {
+		t.Errorf("got policy %q, want %q", got, want)
+	}
+	if got, want := a.Manifest.FormatVersion, ExportFormatVersion; got != want {
+		t.Errorf("got format version %v, want %v", got, want)
+	}
+	if got, want := a.Manifest.Created, created; !got.Equal(want) {
+		t.Errorf("got created %v, want %v", got, want)
+	}
+
+	entries := readArchive(t, archive)
+	if got, want := len(entries), 4; got != want {
+		t.Fatalf("got %v entries, want %v", got, want)
+	}
+
+	// with returns a copy of entries, with entry i modified by fn.
+	with := func(i int, fn func(e *archiveEntry)) []archiveEntry {
+		c := append([]archiveEntry(nil), entries...)
+		fn(&c[i])
+		return c
+	}
+
+	// withManifest returns a copy of entries, with the manifest modified by fn.
+	withManifest := func(fn func(m *ExportManifest)) []archiveEntry {
+		return with(0, func(e *archiveEntry) {
+			var m ExportManifest
+			if err := json.Unmarshal(e.data, &m); err != nil {
+				t.Fatal(err)
+			}
+			fn(&m)
+			b, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.data = b
+		})
+	}
+
+	corruptImage := append([]byte(nil), image...)
+	corruptImage[len(corruptImage)-1] ^= 0xff
+
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		wantErr error
+	}{
+		{
+			name:    "ManifestMissing",
+			entries: entries[1:],
+			wantErr: errExportManifestMissing,
+		},
+		{
+			name:    "Version",
+			entries: withManifest(func(m *ExportManifest) { m.FormatVersion = ExportFormatVersion + 1 }),
+			wantErr: errExportVersion,
+		},
+		{
+			name:    "ImageCorrupt",
+			entries: with(1, func(e *archiveEntry) { e.data = corruptImage }),
+			wantErr: ErrExportChecksumMismatch,
+		},
+		{
+			name:    "SignatureSize",
+			entries: with(2, func(e *archiveEntry) { e.data = append(e.data, '\n') }),
+			wantErr: ErrExportChecksumMismatch,
+		},
+		{
+			name:    "EntryMissing",
+			entries: entries[:3],
+			wantErr: errExportEntryMissing,
+		},
+		{
+			name:    "EntryUnexpected",
+			entries: append(append([]archiveEntry(nil), entries...), archiveEntry{"extra", nil}),
+			wantErr: errExportEntryUnexpected,
+		},
+		{
+			name:    "EntryRepeated",
+			entries: append(append([]archiveEntry(nil), entries...), entries[3]),
+			wantErr: errExportEntryUnexpected,
+		},
+		{
+			name: "SignatureOutsideDir",
+			entries: withManifest(func(m *ExportManifest) {
+				m.Entries[1].Name = "release.sig"
+			}),
+			wantErr: errExportNameInvalid,
+		},
+		{
+			name: "NoImage",
+			entries: withManifest(func(m *ExportManifest) {
+				m.Entries = m.Entries[1:]
+			}),
+			wantErr: errExportImageCount,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Import(bytes.NewReader(writeArchive(t, tt.entries)), ioutil.Discard)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestExportOpts(t *testing.T) {
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	tests := []struct {
+		name    string
+		f       *sif.FileImage
+		opts    []ExportOpt
+		wantErr error
+	}{
+		{"NilImage", nil, nil, errExportNilImage},
+		{"NameEmpty", &f, []ExportOpt{OptExportSignature("", nil)}, errExportNameInvalid},
+		{"NamePath", &f, []ExportOpt{OptExportSignature("../a.sig", nil)}, errExportNameInvalid},
+		{
+			name:    "NameDuplicate",
+			f:       &f,
+			opts:    []ExportOpt{OptExportSignature("a.sig", nil), OptExportSignature("a.sig", nil)},
+			wantErr: errExportNameDuplicate,
+		},
+		{"NoSignatures", &f, nil, nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := Export(ioutil.Discard, tt.f, tt.opts...)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
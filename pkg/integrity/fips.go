@@ -0,0 +1,133 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+	"sync/atomic"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// fipsMode is non-zero when FIPS mode is enabled.
+var fipsMode int32
+
+// SetFIPSMode enables or disables FIPS mode. In FIPS mode, signing and verification are restricted
+// to algorithms approved under FIPS 140, as required for deployments built against a validated
+// module such as BoringCrypto. Hash functions are restricted to SHA-2, and keys to RSA keys of at
+// least 2048 bits, and ECDSA keys on the P-256, P-384 and P-521 curves. Where an algorithm that is
+// not approved is encountered, an error wrapping an AlgorithmNotApprovedError is returned.
+//
+// FIPS mode applies to the whole package, and is disabled by default. It is intended to be set
+// from an init function, before any signing or verification takes place.
+func SetFIPSMode(b bool) {
+	var v int32
+	if b {
+		v = 1
+	}
+	atomic.StoreInt32(&fipsMode, v)
+}
+
+// FIPSMode returns true if FIPS mode is enabled.
+func FIPSMode() bool {
+	return atomic.LoadInt32(&fipsMode) != 0
+}
+
+// AlgorithmNotApprovedError records an error when FIPS mode is enabled, and an algorithm that is
+// not FIPS approved is encountered.
+type AlgorithmNotApprovedError struct {
+	Algorithm string // Name of the algorithm, such as "SHA-1" or "RSA-1024".
+}
+
+func (e *AlgorithmNotApprovedError) Error() string {
+	if e.Algorithm == "" {
+		return "algorithm not FIPS approved"
+	}
+	return fmt.Sprintf("algorithm %v not FIPS approved", e.Algorithm)
+}
+
+// Is compares e against target. If target is an AlgorithmNotApprovedError and matches e or target
+// has an empty Algorithm, true is returned.
+func (e *AlgorithmNotApprovedError) Is(target error) bool {
+	t, ok := target.(*AlgorithmNotApprovedError)
+	if !ok {
+		return false
+	}
+	return e.Algorithm == t.Algorithm || t.Algorithm == ""
+}
+
+// checkFIPSHash returns an AlgorithmNotApprovedError if FIPS mode is enabled, and h is not FIPS
+// approved.
+func checkFIPSHash(h crypto.Hash) error {
+	if !FIPSMode() {
+		return nil
+	}
+
+	switch h {
+	case crypto.SHA224, crypto.SHA256, crypto.SHA384, crypto.SHA512:
+		return nil
+	case BLAKE3:
+		return &AlgorithmNotApprovedError{Algorithm: "BLAKE3"}
+	}
+	return &AlgorithmNotApprovedError{Algorithm: h.String()}
+}
+
+// checkFIPSPublicKey returns an AlgorithmNotApprovedError if FIPS mode is enabled, and pub is not
+// a key of a FIPS approved algorithm and size.
+func checkFIPSPublicKey(pub crypto.PublicKey) error {
+	if !FIPSMode() {
+		return nil
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if bits := pub.N.BitLen(); bits < 2048 {
+			return &AlgorithmNotApprovedError{Algorithm: fmt.Sprintf("RSA-%d", bits)}
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+			return nil
+		}
+		return &AlgorithmNotApprovedError{Algorithm: "ECDSA " + pub.Curve.Params().Name}
+	case ed25519.PublicKey:
+		return &AlgorithmNotApprovedError{Algorithm: "Ed25519"}
+	}
+	return &AlgorithmNotApprovedError{Algorithm: fmt.Sprintf("%T", pub)}
+}
+
+// checkFIPSEntity returns an AlgorithmNotApprovedError if FIPS mode is enabled, and the key of e
+// with the specified id is not a key of a FIPS approved algorithm and size. If e has no key with
+// the specified id, the primary key of e is checked.
+func checkFIPSEntity(e *openpgp.Entity, keyID uint64) error {
+	if !FIPSMode() {
+		return nil
+	}
+
+	pk := e.PrimaryKey
+	for _, sk := range e.Subkeys {
+		if sk.PublicKey != nil && sk.PublicKey.KeyId == keyID {
+			pk = sk.PublicKey
+		}
+	}
+	return checkFIPSPublicKey(pk.PublicKey)
+}
+
+// checkFIPSSigning returns an AlgorithmNotApprovedError if FIPS mode is enabled, and signing with
+// privateKey according to config would use an algorithm that is not FIPS approved.
+func checkFIPSSigning(privateKey *packet.PrivateKey, config *packet.Config) error {
+	if err := checkFIPSHash(config.Hash()); err != nil {
+		return err
+	}
+	return checkFIPSPublicKey(privateKey.PublicKey.PublicKey)
+}
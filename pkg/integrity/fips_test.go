@@ -0,0 +1,166 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestAlgorithmNotApprovedError_Is(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"Match", &AlgorithmNotApprovedError{"SHA-1"}, &AlgorithmNotApprovedError{"SHA-1"}, true},
+		{"Any", &AlgorithmNotApprovedError{"SHA-1"}, &AlgorithmNotApprovedError{}, true},
+		{"Mismatch", &AlgorithmNotApprovedError{"SHA-1"}, &AlgorithmNotApprovedError{"MD5"}, false},
+		{"Other", &AlgorithmNotApprovedError{"SHA-1"}, errHashUnsupported, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFIPSMode_Hash(t *testing.T) {
+	tests := []struct {
+		name    string
+		h       crypto.Hash
+		wantErr error
+	}{
+		{"SHA1", crypto.SHA1, &AlgorithmNotApprovedError{"SHA-1"}},
+		{"SHA256", crypto.SHA256, nil},
+		{"SHA384", crypto.SHA384, nil},
+		{"BLAKE3", BLAKE3, &AlgorithmNotApprovedError{"BLAKE3"}},
+	}
+
+	SetFIPSMode(true)
+	defer SetFIPSMode(false)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newHash(tt.h); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFIPSMode_SignAndVerify(t *testing.T) {
+	e := getTestEntity(t)
+
+	// A key too small to be approved.
+	small, err := openpgp.NewEntity("small", "", "", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		e       *openpgp.Entity
+		hash    crypto.Hash
+		wantErr error
+	}{
+		{"Approved", e, crypto.SHA256, nil},
+		{"HashNotApproved", e, crypto.SHA1, &AlgorithmNotApprovedError{"SHA-1"}},
+		{"KeyNotApproved", small, crypto.SHA256, &AlgorithmNotApprovedError{"RSA-1024"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			config := packet.Config{DefaultHash: tt.hash, Time: fixedTime}
+
+			// Sign outside FIPS mode, so that verification can be attempted.
+			var b bytes.Buffer
+			if err := signAndEncodeJSON(&b, testType{1, 2}, tt.e.PrivateKey, &config); err != nil {
+				t.Fatal(err)
+			}
+
+			SetFIPSMode(true)
+			defer SetFIPSMode(false)
+
+			var v testType
+			if _, _, err := verifyAndDecodeJSON(b.Bytes(), &v, openpgp.EntityList{tt.e}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got verify error %v, want %v", err, tt.wantErr)
+			}
+
+			if err := signAndEncodeJSON(&bytes.Buffer{}, testType{1, 2}, tt.e.PrivateKey, &config); !errors.Is(err, tt.wantErr) { // nolint:lll
+				t.Errorf("got sign error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFIPSMode_Verifier(t *testing.T) {
+	e := getTestEntity(t)
+
+	tests := []struct {
+		name string
+		path string
+		opts []VerifierOpt
+	}{
+		{"Signed", "one-group-signed.sif", nil},
+		{"Legacy", "one-group-signed-legacy-group.sif", []VerifierOpt{OptVerifyLegacy()}},
+	}
+
+	SetFIPSMode(true)
+	defer SetFIPSMode(false)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := sif.LoadContainer(filepath.Join("testdata", "images", tt.path), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			opts := append([]VerifierOpt{OptVerifyWithKeyRing(openpgp.EntityList{e})}, tt.opts...)
+
+			v, err := NewVerifier(&f, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := v.Verify(); err != nil {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
+
+func TestFIPSMode_OCIVerifier(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetFIPSMode(true)
+	defer SetFIPSMode(false)
+
+	if _, err := NewOCIVerifier(pub); !errors.Is(err, &AlgorithmNotApprovedError{"Ed25519"}) {
+		t.Errorf("got error %v, want %v", err, &AlgorithmNotApprovedError{"Ed25519"})
+	}
+}
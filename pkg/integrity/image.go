@@ -0,0 +1,60 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// ImageReader provides the read access to a SIF image required to verify it. It is implemented by
+// *sif.FileImage. Alternative implementations allow images held by other backends, such as images
+// fetched lazily from a remote store, to be verified, and allow verification to be tested against
+// fakes.
+type ImageReader interface {
+	// GetHeader returns the global header of the image.
+	GetHeader() *sif.Header
+
+	// GetDescriptors returns the used descriptors selected by all filters, in descriptor table
+	// order. If no filters are supplied, all used descriptors are returned.
+	GetDescriptors(filters ...sif.DescriptorFilter) []sif.Descriptor
+
+	// GetObjectReadSeeker returns an io.ReadSeeker that reads the data object associated with
+	// descriptor d, as stored in the image.
+	GetObjectReadSeeker(d sif.Descriptor) io.ReadSeeker
+}
+
+// isNilImage returns true if f is nil, or holds a nil *sif.FileImage.
+func isNilImage(f ImageReader) bool {
+	if fimg, ok := f.(*sif.FileImage); ok {
+		return fimg == nil
+	}
+	return f == nil
+}
+
+// getDescriptors returns the used descriptors in f selected by all filters, in descriptor table
+// order.
+func getDescriptors(f ImageReader, filters ...sif.DescriptorFilter) []*sif.Descriptor {
+	ds := f.GetDescriptors(filters...)
+
+	ods := make([]*sif.Descriptor, 0, len(ds))
+	for i := range ds {
+		ods = append(ods, &ds[i])
+	}
+	return ods
+}
+
+// readObject returns the data object in f associated with descriptor od. If the data object
+// cannot be read, nil is returned.
+func readObject(f ImageReader, od *sif.Descriptor) []byte {
+	b, err := ioutil.ReadAll(f.GetObjectReadSeeker(*od))
+	if err != nil {
+		return nil
+	}
+	return b
+}
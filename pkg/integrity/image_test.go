@@ -0,0 +1,143 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+// fakeImage is an ImageReader holding the header and descriptors of an image in memory, and
+// reading data objects from a bytes.Reader.
+type fakeImage struct {
+	h  sif.Header
+	ds []sif.Descriptor
+	r  *bytes.Reader
+}
+
+// newFakeImage returns a fakeImage holding the image at path. If corrupt is not nil, it is called
+// to modify the image data before it is read.
+func newFakeImage(t *testing.T, path string, corrupt func(f *fakeImage, b []byte)) *fakeImage {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := sif.LoadContainerReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	f := &fakeImage{h: fimg.Header, ds: fimg.GetDescriptors()}
+	if corrupt != nil {
+		corrupt(f, b)
+	}
+	f.r = bytes.NewReader(b)
+
+	return f
+}
+
+func (f *fakeImage) GetHeader() *sif.Header {
+	return &f.h
+}
+
+func (f *fakeImage) GetDescriptors(filters ...sif.DescriptorFilter) []sif.Descriptor {
+	var ds []sif.Descriptor
+	for _, d := range f.ds {
+		selected := true
+		for _, fn := range filters {
+			selected = selected && fn(d)
+		}
+		if selected {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+func (f *fakeImage) GetObjectReadSeeker(d sif.Descriptor) io.ReadSeeker {
+	return io.NewSectionReader(f.r, d.Fileoff, d.Filelen)
+}
+
+func TestVerifier_VerifyImageReader(t *testing.T) {
+	kr := openpgp.EntityList{getTestEntity(t)}
+	path := filepath.Join("testdata", "images", "two-groups-signed.sif")
+
+	tests := []struct {
+		name    string
+		corrupt func(f *fakeImage, b []byte)
+		opts    []VerifierOpt
+		wantErr error
+	}{
+		{
+			name: "OK",
+		},
+		{
+			name: "OptVerifyObject",
+			opts: []VerifierOpt{OptVerifyObject(3)},
+		},
+		{
+			name: "ObjectIntegrity",
+			corrupt: func(f *fakeImage, b []byte) {
+				b[f.ds[0].Fileoff] ^= 0xff
+			},
+			wantErr: &ObjectIntegrityError{ID: 1},
+		},
+		{
+			name: "HeaderIntegrity",
+			corrupt: func(f *fakeImage, b []byte) {
+				f.h.Launch[0] ^= 0xff
+			},
+			wantErr: ErrHeaderIntegrity,
+		},
+		{
+			name: "DescriptorIntegrity",
+			corrupt: func(f *fakeImage, b []byte) {
+				f.ds[0].Ctime++
+			},
+			wantErr: &DescriptorIntegrityError{ID: 1},
+		},
+		{
+			name: "SignatureNotFound",
+			corrupt: func(f *fakeImage, b []byte) {
+				var ds []sif.Descriptor
+				for _, d := range f.ds {
+					if d.Datatype != sif.DataSignature {
+						ds = append(ds, d)
+					}
+				}
+				f.ds = ds
+			},
+			wantErr: &SignatureNotFoundError{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeImage(t, path, tt.corrupt)
+
+			v, err := NewVerifier(f, append([]VerifierOpt{OptVerifyWithKeyRing(kr)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := v.Verify(), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
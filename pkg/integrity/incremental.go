@@ -0,0 +1,207 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+var (
+	errPriorNotFound     = errors.New("prior signature not found")
+	errPriorVersion      = errors.New("prior signature metadata version mismatch")
+	errObjectSignedTwice = errors.New("object signed more than once in signature chain")
+	errNoNewObjects      = errors.New("no objects to sign that are not covered by prior signature")
+)
+
+// priorMetadata refers to the signature extended by an incremental signature. The objects covered
+// by the prior signature are covered by the incremental signature, without being hashed again.
+type priorMetadata struct {
+	Digest digest `json:"digest"` // Digest of the prior signature object.
+}
+
+// getPriorMetadata returns priorMetadata referring to the signature object with content data,
+// using hash algorithm h.
+func getPriorMetadata(data []byte, h crypto.Hash) (*priorMetadata, error) {
+	d, err := newDigestReader(h, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &priorMetadata{Digest: d}, nil
+}
+
+// refersTo returns true if pm refers to the signature object with content data.
+func (pm priorMetadata) refersTo(data []byte) (bool, error) {
+	return pm.Digest.matches(bytes.NewReader(data))
+}
+
+// decodeSignature verifies signature sig using keyring kr, and returns the decoded image metadata
+// and signing entity. If the signature extends a prior signature, the prior signature is verified
+// in turn, and the objects it covers are added to the returned image metadata.
+//
+// If an invalid signature is encountered, a SignatureNotValidError is returned.
+func (v *groupVerifier) decodeSignature(sig *sif.Descriptor, kr openpgp.KeyRing) (imageMetadata, *openpgp.Entity, error) { // nolint:lll
+	// Verify signature and decode image metadata.
+	var im imageMetadata
+	e, _, err := verifyAndDecodeJSON(readObject(v.f, sig), &im, kr)
+	if err != nil {
+		return im, e, &SignatureNotValidError{ID: sig.ID, Err: err}
+	}
+
+	// Get minimum object ID in group, and use this to populate absolute object IDs in im.
+	minID, err := getGroupMinObjectID(v.f, v.groupID)
+	if err != nil {
+		return im, e, err
+	}
+	im.populateAbsoluteObjectIDs(minID)
+
+	// Ensure signing entity matches fingerprint in descriptor.
+	fp, err := sig.GetEntity()
+	if err != nil {
+		return im, e, err
+	}
+	if !bytes.Equal(e.PrimaryKey.Fingerprint[:], fp[:20]) {
+		return im, e, errFingerprintMismatch
+	}
+
+	if im.Prior != nil {
+		if err := v.extendWithPrior(&im, kr); err != nil {
+			return im, e, err
+		}
+	}
+
+	return im, e, nil
+}
+
+// extendWithPrior verifies the prior signature referred to by im using keyring kr, and inserts
+// the objects it covers ahead of those in im.
+func (v *groupVerifier) extendWithPrior(im *imageMetadata, kr openpgp.KeyRing) error {
+	sigs, err := getGroupSignatures(v.f, v.groupID, false)
+	if err != nil {
+		return err
+	}
+
+	for _, sig := range sigs {
+		if ok, err := im.Prior.refersTo(readObject(v.f, sig)); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+
+		prior, _, err := v.decodeSignature(sig, kr)
+		if err != nil {
+			return fmt.Errorf("prior signature: %w", err)
+		}
+
+		if prior.Version != im.Version {
+			return fmt.Errorf("%w: version %v, want %v", errPriorVersion, prior.Version, im.Version)
+		}
+
+		for _, om := range im.Objects {
+			if _, _, err := prior.metadataForObject(om.id); err == nil {
+				return fmt.Errorf("object %d: %w", om.id, errObjectSignedTwice)
+			}
+		}
+
+		im.Objects = append(prior.Objects, im.Objects...)
+		return nil
+	}
+
+	return errPriorNotFound
+}
+
+// chainHeads returns the signatures in sigs that are not extended by another signature in sigs.
+// Signatures extended by an incremental signature are verified along with it, rather than on
+// their own. Signatures that cannot be verified using keyring kr are assumed not to extend
+// another, and are returned, so that the failure is reported when they are verified.
+func (v *groupVerifier) chainHeads(sigs []*sif.Descriptor, kr openpgp.KeyRing) ([]*sif.Descriptor, error) {
+	var priors []*priorMetadata
+	for _, sig := range sigs {
+		var im imageMetadata
+		if _, _, err := verifyAndDecodeJSON(readObject(v.f, sig), &im, kr); err == nil && im.Prior != nil {
+			priors = append(priors, im.Prior)
+		}
+	}
+
+	heads := make([]*sif.Descriptor, 0, len(sigs))
+	for _, sig := range sigs {
+		extended := false
+		for _, pm := range priors {
+			ok, err := pm.refersTo(readObject(v.f, sig))
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				extended = true
+				break
+			}
+		}
+
+		if !extended {
+			heads = append(heads, sig)
+		}
+	}
+
+	return heads, nil
+}
+
+// priorSignature returns a reference to the most recent signature of the group made by e, along
+// with the objects specified by gs that it does not cover. If the group has no such signature, a
+// nil reference is returned along with all objects specified by gs.
+func (gs *groupSigner) priorSignature(e *openpgp.Entity) (*priorMetadata, []*sif.Descriptor, error) {
+	sigs, err := getGroupSignatures(gs.f, gs.id, false)
+	if errors.Is(err, &SignatureNotFoundError{}) {
+		return nil, gs.ods, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// Select the most recent signature made by e.
+	var sig *sif.Descriptor
+	for _, s := range sigs {
+		fp, err := s.GetEntity()
+		if err != nil {
+			return nil, nil, err
+		}
+		if bytes.Equal(e.PrimaryKey.Fingerprint[:], fp[:20]) && (sig == nil || s.ID > sig.ID) {
+			sig = s
+		}
+	}
+	if sig == nil {
+		return nil, gs.ods, nil
+	}
+
+	// Determine the objects covered by the prior signature, without hashing them.
+	v := groupVerifier{f: gs.f, groupID: gs.id}
+	im, _, err := v.decodeSignature(sig, openpgp.EntityList{e})
+	if err != nil {
+		return nil, nil, fmt.Errorf("prior signature: %w", err)
+	}
+	if im.Version != metadataVersion4 {
+		return nil, nil, fmt.Errorf("%w: version %v, want %v", errPriorVersion, im.Version, metadataVersion4)
+	}
+
+	ods := make([]*sif.Descriptor, 0, len(gs.ods))
+	for _, od := range gs.ods {
+		if _, _, err := im.metadataForObject(od.ID); err != nil {
+			ods = append(ods, od)
+		}
+	}
+	if len(ods) == 0 {
+		return nil, nil, errNoNewObjects
+	}
+
+	pm, err := getPriorMetadata(sig.GetData(gs.f), gs.mdHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pm, ods, nil
+}
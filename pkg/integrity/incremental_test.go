@@ -0,0 +1,205 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+// addGroupObject appends a generic data object containing data to group 1 of f.
+func addGroupObject(t *testing.T, f *sif.FileImage, data string) {
+	t.Helper()
+
+	di := sif.DescriptorInput{
+		Datatype: sif.DataGeneric,
+		Groupid:  sif.DescrGroupMask | 1,
+		Link:     sif.DescrUnusedLink,
+		Size:     int64(len(data)),
+		Fname:    "appended",
+		Data:     []byte(data),
+	}
+	if err := f.AddObject(di); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signImage adds signature(s) to f using e, according to opts.
+func signImage(t *testing.T, f *sif.FileImage, e *openpgp.Entity, opts ...SignerOpt) error {
+	t.Helper()
+
+	s, err := NewSigner(f, append([]SignerOpt{OptSignWithEntity(e)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Sign()
+}
+
+func TestSigner_SignIncremental(t *testing.T) {
+	e := getTestEntity(t)
+
+	addObject := func(t *testing.T, f *sif.FileImage) {
+		addGroupObject(t, f, "appended")
+	}
+	sign := func(t *testing.T, f *sif.FileImage) {
+		if err := signImage(t, f, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signIncremental := func(t *testing.T, f *sif.FileImage) {
+		if err := signImage(t, f, e, OptSignIncremental()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		steps       []func(t *testing.T, f *sif.FileImage)
+		wantSignErr error
+		corrupt     bool
+		wantObjects int      // objects hashed by the last signature
+		wantPrior   bool     // last signature refers to a prior signature
+		wantSigned  []uint32 // objects covered, as reported by the verifier
+		wantErr     error
+	}{
+		{
+			name:        "NoPrior",
+			steps:       []func(t *testing.T, f *sif.FileImage){addObject},
+			wantObjects: 3,
+			wantSigned:  []uint32{1, 2, 3},
+		},
+		{
+			name:        "Extend",
+			steps:       []func(t *testing.T, f *sif.FileImage){sign, addObject},
+			wantObjects: 1,
+			wantPrior:   true,
+			wantSigned:  []uint32{1, 2, 4},
+		},
+		{
+			name:        "ExtendTwice",
+			steps:       []func(t *testing.T, f *sif.FileImage){sign, addObject, signIncremental, addObject},
+			wantObjects: 1,
+			wantPrior:   true,
+			wantSigned:  []uint32{1, 2, 4, 6},
+		},
+		{
+			name:        "NothingNew",
+			steps:       []func(t *testing.T, f *sif.FileImage){sign},
+			wantSignErr: errNoNewObjects,
+		},
+		{
+			name:        "CorruptPriorObject",
+			steps:       []func(t *testing.T, f *sif.FileImage){sign, addObject},
+			corrupt:     true,
+			wantObjects: 1,
+			wantPrior:   true,
+			wantSigned:  []uint32{1, 2, 4},
+			wantErr:     &ObjectIntegrityError{ID: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+			tf.Close()
+
+			// Reload the image after each step, as objects added to an image are not visible
+			// through its mapping until it is reloaded.
+			for _, step := range tt.steps {
+				f, err := sif.LoadContainer(tf.Name(), false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				step(t, &f)
+				if err := f.UnloadContainer(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f, err := sif.LoadContainer(tf.Name(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := signImage(t, &f, e, OptSignIncremental()), tt.wantSignErr; !errors.Is(got, want) {
+				f.UnloadContainer() // nolint:errcheck
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantSignErr != nil {
+				return
+			}
+
+			if tt.corrupt {
+				w, err := os.OpenFile(tf.Name(), os.O_RDWR, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.WriteAt([]byte{0xff}, 32768); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f, err = sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			// Check the most recent signature hashes only the expected objects.
+			sigs, err := getGroupSignatures(&f, 1, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var im imageMetadata
+			if _, _, err := verifyAndDecodeJSON(sigs[len(sigs)-1].GetData(&f), &im, openpgp.EntityList{e}); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(im.Objects), tt.wantObjects; got != want {
+				t.Errorf("got %v objects, want %v", got, want)
+			}
+			if got, want := im.Prior != nil, tt.wantPrior; got != want {
+				t.Errorf("got prior %v, want %v", got, want)
+			}
+
+			// Check the verifier treats the signature chain as a single signature.
+			var signed [][]uint32
+			cb := func(r VerifyResult) bool {
+				signed = append(signed, r.Signed())
+				return false
+			}
+
+			v, err := NewVerifier(&f, OptVerifyWithKeyRing(openpgp.EntityList{e}), OptVerifyCallback(cb))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := v.Verify(), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if got, want := signed, [][]uint32{tt.wantSigned}; !reflect.DeepEqual(got, want) {
+				t.Errorf("got signed %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// SignatureInfo describes a signature as recorded in an image. The details it holds are parsed
+// from the signature without verifying it, so they are claims rather than facts.
+type SignatureInfo struct {
+	ID       uint32 // ID of the signature object.
+	GroupID  uint32 // ID of the object group the signature is linked to, or zero.
+	LinkedID uint32 // ID of the data object the signature is linked to, or zero.
+	Legacy   bool   // Whether the signature is a legacy signature.
+
+	Fingerprint   []byte      // Fingerprint of the signing key, as recorded in the descriptor.
+	KeyID         uint64      // Key ID of the issuer, as recorded in the signature packet.
+	SignatureHash crypto.Hash // Hash algorithm used by the signature packet.
+	DigestHash    crypto.Hash // Hash algorithm used to compute the signed digests.
+	Created       time.Time   // Creation time recorded in the signature packet.
+	Objects       []uint32    // IDs of the data objects the signature claims to cover.
+	Role          string      // Role asserted by the signer, if any.
+
+	// Err is set if the signature could not be parsed, in which case the fields above may be
+	// incomplete.
+	Err error
+}
+
+// InspectSignatures returns details of each PGP signature in f, in descriptor order. Signatures
+// are parsed, but not verified, so no key material is required.
+//
+// A signature that cannot be parsed does not cause an error to be returned. Instead, the Err
+// field of its SignatureInfo is set.
+func InspectSignatures(f ImageReader) ([]SignatureInfo, error) {
+	if isNilImage(f) {
+		return nil, fmt.Errorf("integrity: %w", errNilFileImage)
+	}
+
+	sigs := getDescriptors(f, sif.WithDataType(sif.DataSignature))
+
+	sis := make([]SignatureInfo, 0, len(sigs))
+	for _, sig := range sigs {
+		si := SignatureInfo{ID: sig.ID}
+
+		if sig.Link&sif.DescrGroupMask != 0 {
+			si.GroupID = sig.Link &^ sif.DescrGroupMask
+		} else if sig.Link != sif.DescrUnusedLink {
+			si.LinkedID = sig.Link
+		}
+
+		if err := si.inspect(f, sig); err != nil {
+			si.Err = fmt.Errorf("integrity: signature object %d: %w", sig.ID, err)
+		}
+
+		sis = append(sis, si)
+	}
+	return sis, nil
+}
+
+// inspect populates si from signature object sig in f.
+func (si *SignatureInfo) inspect(f ImageReader, sig *sif.Descriptor) error {
+	e, err := sig.GetEntity()
+	if err != nil {
+		return err
+	}
+	si.Fingerprint = append([]byte(nil), e[:20]...)
+
+	b, _ := clearsign.Decode(readObject(f, sig))
+	if b == nil {
+		return errClearsignedMsgNotFound
+	}
+
+	if err := si.inspectPacket(b); err != nil {
+		return err
+	}
+
+	if isLegacyPlaintext(b.Plaintext) {
+		return si.inspectLegacy(f, sig)
+	}
+
+	var im imageMetadata
+	if err := json.Unmarshal(b.Plaintext, &im); err != nil {
+		return err
+	}
+
+	si.DigestHash = im.Header.Digest.hash
+	si.Role = im.Role
+
+	minID, err := getGroupMinObjectID(f, si.GroupID)
+	if err != nil {
+		return err
+	}
+	im.populateAbsoluteObjectIDs(minID)
+
+	for _, om := range im.Objects {
+		si.Objects = append(si.Objects, om.id)
+	}
+	return nil
+}
+
+// inspectPacket populates si from the signature packet of clearsigned message b.
+func (si *SignatureInfo) inspectPacket(b *clearsign.Block) error {
+	sp, err := readSignaturePacket(b.ArmoredSignature.Body)
+	if err != nil {
+		return err
+	}
+
+	si.KeyID = sp.keyID
+	si.SignatureHash = sp.hash
+	si.Created = sp.created
+	return nil
+}
+
+// inspectLegacy populates si from legacy signature object sig in f. Legacy signatures cover
+// either the object group or the data object they are linked to.
+func (si *SignatureInfo) inspectLegacy(f ImageReader, sig *sif.Descriptor) error {
+	si.Legacy = true
+
+	ht, err := sig.GetHashType()
+	if err != nil {
+		return err
+	}
+	if si.DigestHash, err = hashType(ht); err != nil {
+		return err
+	}
+
+	if si.GroupID == 0 {
+		si.Objects = []uint32{si.LinkedID}
+		return nil
+	}
+
+	ods, err := getGroupObjects(f, si.GroupID)
+	if err != nil {
+		return err
+	}
+	for _, od := range ods {
+		si.Objects = append(si.Objects, od.ID)
+	}
+	return nil
+}
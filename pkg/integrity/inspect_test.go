@@ -0,0 +1,149 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+func TestInspectSignatures(t *testing.T) {
+	e := getTestEntity(t)
+
+	type sig struct {
+		id         uint32
+		groupID    uint32
+		linkedID   uint32
+		legacy     bool
+		digestHash crypto.Hash
+		objects    []uint32
+	}
+
+	tests := []struct {
+		name     string
+		image    string
+		nilImage bool
+		wantSigs []sig
+		wantErr  error
+	}{
+		{
+			name:     "NilFileImage",
+			nilImage: true,
+			wantErr:  errNilFileImage,
+		},
+		{
+			name:  "Unsigned",
+			image: "one-group.sif",
+		},
+		{
+			name:  "OneGroupSigned",
+			image: "one-group-signed.sif",
+			wantSigs: []sig{
+				{id: 3, groupID: 1, digestHash: crypto.SHA256, objects: []uint32{1, 2}},
+			},
+		},
+		{
+			name:  "TwoGroupsSigned",
+			image: "two-groups-signed.sif",
+			wantSigs: []sig{
+				{id: 4, groupID: 1, digestHash: crypto.SHA256, objects: []uint32{1, 2}},
+				{id: 5, groupID: 2, digestHash: crypto.SHA256, objects: []uint32{3}},
+			},
+		},
+		{
+			name:  "LegacyObject",
+			image: "one-group-signed-legacy.sif",
+			wantSigs: []sig{
+				{id: 3, linkedID: 2, legacy: true, digestHash: crypto.SHA384, objects: []uint32{2}},
+			},
+		},
+		{
+			name:  "LegacyGroup",
+			image: "one-group-signed-legacy-group.sif",
+			wantSigs: []sig{
+				{id: 3, groupID: 1, legacy: true, digestHash: crypto.SHA384, objects: []uint32{1, 2}},
+			},
+		},
+		{
+			name:  "LegacyAll",
+			image: "two-groups-signed-legacy-all.sif",
+			wantSigs: []sig{
+				{id: 4, linkedID: 1, legacy: true, digestHash: crypto.SHA384, objects: []uint32{1}},
+				{id: 5, linkedID: 2, legacy: true, digestHash: crypto.SHA384, objects: []uint32{2}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var f *sif.FileImage
+			if !tt.nilImage {
+				fimg, err := sif.LoadContainer(filepath.Join("testdata", "images", tt.image), true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer fimg.UnloadContainer() // nolint:errcheck
+
+				f = &fimg
+			}
+
+			sis, err := InspectSignatures(f)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if got, want := len(sis), len(tt.wantSigs); got != want {
+				t.Fatalf("got %v signatures, want %v", got, want)
+			}
+
+			for i, si := range sis {
+				ws := tt.wantSigs[i]
+
+				if si.Err != nil {
+					t.Fatalf("signature %v: unexpected error: %v", si.ID, si.Err)
+				}
+
+				if got, want := si.ID, ws.id; got != want {
+					t.Errorf("got ID %v, want %v", got, want)
+				}
+				if got, want := si.GroupID, ws.groupID; got != want {
+					t.Errorf("got group ID %v, want %v", got, want)
+				}
+				if got, want := si.LinkedID, ws.linkedID; got != want {
+					t.Errorf("got linked ID %v, want %v", got, want)
+				}
+				if got, want := si.Legacy, ws.legacy; got != want {
+					t.Errorf("got legacy %v, want %v", got, want)
+				}
+				if got, want := si.Fingerprint, e.PrimaryKey.Fingerprint[:]; !bytes.Equal(got, want) {
+					t.Errorf("got fingerprint %X, want %X", got, want)
+				}
+				if got, want := si.KeyID, e.PrimaryKey.KeyId; got != want {
+					t.Errorf("got key ID %X, want %X", got, want)
+				}
+				if got, want := si.SignatureHash, crypto.SHA256; got != want {
+					t.Errorf("got signature hash %v, want %v", got, want)
+				}
+				if got, want := si.DigestHash, ws.digestHash; got != want {
+					t.Errorf("got digest hash %v, want %v", got, want)
+				}
+				if si.Created.IsZero() {
+					t.Error("got zero creation time")
+				}
+				if got, want := si.Objects, ws.objects; !reflect.DeepEqual(got, want) {
+					t.Errorf("got objects %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+var errNoKeyRing = errors.New("no keyring found")
+
+const (
+	apptainerKeysDirEnv    = "APPTAINER_KEYSDIR"
+	singularitySypgpDirEnv = "SINGULARITY_SYPGPDIR"
+)
+
+// Global keyrings are installed under the system configuration directory chosen when Apptainer or
+// Singularity was built. The common choices are listed.
+var globalKeyRingPaths = []string{
+	"/usr/local/etc/apptainer/global-pgp-public",
+	"/etc/apptainer/global-pgp-public",
+	"/usr/local/etc/singularity/global-pgp-public",
+	"/etc/singularity/global-pgp-public",
+}
+
+// keyRingPaths returns the paths of public keyrings in standard locations, in order of precedence,
+// looking up environment variables with getenv.
+func keyRingPaths(getenv func(string) string) []string {
+	var paths []string
+
+	// Keyring directories may be overridden by environment variable.
+	if dir := getenv(apptainerKeysDirEnv); dir != "" {
+		paths = append(paths, filepath.Join(dir, "pgp-public"))
+	}
+	if dir := getenv(singularitySypgpDirEnv); dir != "" {
+		paths = append(paths, filepath.Join(dir, "pgp-public"))
+	}
+
+	if home := getenv("HOME"); home != "" {
+		paths = append(paths,
+			filepath.Join(home, ".apptainer", "keys", "pgp-public"),
+			filepath.Join(home, ".singularity", "sypgp", "pgp-public"),
+		)
+	}
+
+	return append(paths, globalKeyRingPaths...)
+}
+
+// KeyRingPaths returns the paths of public keyrings in the standard locations used by Apptainer
+// and Singularity, in order of precedence. The paths are not checked for existence.
+//
+// The per-user keyring directories may be overridden by the APPTAINER_KEYSDIR and
+// SINGULARITY_SYPGPDIR environment variables. Otherwise, they are located in the home directory of
+// the user. These are followed by the global keyrings of Apptainer and Singularity.
+func KeyRingPaths() []string {
+	return keyRingPaths(os.Getenv)
+}
+
+// readKeyRing reads the keyring at path, which may be binary or ASCII armored.
+func readKeyRing(path string) (openpgp.EntityList, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	el, err := openpgp.ReadKeyRing(bytes.NewReader(b))
+	if err != nil {
+		if el, aerr := openpgp.ReadArmoredKeyRing(bytes.NewReader(b)); aerr == nil {
+			return el, nil
+		}
+		return nil, fmt.Errorf("reading keyring %s: %w", path, err)
+	}
+	return el, nil
+}
+
+// loadKeyRings reads the keyrings at paths, skipping paths that do not exist.
+func loadKeyRings(paths []string) (openpgp.EntityList, error) {
+	if len(paths) == 0 {
+		paths = KeyRingPaths()
+	}
+
+	var el openpgp.EntityList
+	found := false
+
+	for _, path := range paths {
+		kr, err := readKeyRing(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		found = true
+		el = append(el, kr...)
+	}
+
+	if !found {
+		return nil, errNoKeyRing
+	}
+	return el, nil
+}
+
+// LoadKeyRings reads the keyrings at paths, and returns the entities they contain. Paths that do
+// not exist are skipped. If paths is empty, the keyrings returned by KeyRingPaths are read. If no
+// keyring is found, an error is returned.
+func LoadKeyRings(paths ...string) (openpgp.EntityList, error) {
+	el, err := loadKeyRings(paths)
+	if err != nil {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+	return el, nil
+}
+
+// OptVerifyWithDiscoveredKeyRings specifies that key material should be loaded from the keyrings
+// at paths, as described by LoadKeyRings. If paths is empty, the standard Apptainer and
+// Singularity keyrings are used.
+func OptVerifyWithDiscoveredKeyRings(paths ...string) VerifierOpt {
+	return func(v *Verifier) error {
+		el, err := loadKeyRings(paths)
+		if err != nil {
+			return err
+		}
+		v.keyRing = el
+		return nil
+	}
+}
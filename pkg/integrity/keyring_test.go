@@ -0,0 +1,156 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestKeyRingPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "None",
+			want: globalKeyRingPaths,
+		},
+		{
+			name: "Home",
+			env:  map[string]string{"HOME": "/home/user"},
+			want: append([]string{
+				"/home/user/.apptainer/keys/pgp-public",
+				"/home/user/.singularity/sypgp/pgp-public",
+			}, globalKeyRingPaths...),
+		},
+		{
+			name: "Env",
+			env: map[string]string{
+				"HOME":                 "/home/user",
+				"APPTAINER_KEYSDIR":    "/apptainer",
+				"SINGULARITY_SYPGPDIR": "/singularity",
+			},
+			want: append([]string{
+				"/apptainer/pgp-public",
+				"/singularity/pgp-public",
+				"/home/user/.apptainer/keys/pgp-public",
+				"/home/user/.singularity/sypgp/pgp-public",
+			}, globalKeyRingPaths...),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string { return tt.env[key] }
+
+			if got, want := keyRingPaths(getenv), tt.want; !reflect.DeepEqual(got, want) {
+				t.Errorf("got paths %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadKeyRings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "integrity-keyring-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := getTestEntity(t)
+
+	// Binary keyring, as written by Apptainer and Singularity.
+	binaryPath := filepath.Join(dir, "pgp-public")
+	f, err := os.Create(binaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// ASCII armored keyring.
+	armoredPath := filepath.Join(dir, "pgp-public.asc")
+	f, err = os.Create(armoredPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := armor.Encode(f, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	f.Close()
+
+	invalidPath := filepath.Join(dir, "invalid")
+	if err := ioutil.WriteFile(invalidPath, []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	missingPath := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name         string
+		paths        []string
+		wantEntities int
+		wantErr      error
+	}{
+		{"Missing", []string{missingPath}, 0, errNoKeyRing},
+		{"Binary", []string{missingPath, binaryPath}, 1, nil},
+		{"Armored", []string{armoredPath}, 1, nil},
+		{"Both", []string{binaryPath, armoredPath}, 2, nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			el, err := LoadKeyRings(tt.paths...)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if got, want := len(el), tt.wantEntities; got != want {
+				t.Errorf("got %v entities, want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := LoadKeyRings(binaryPath, invalidPath); err == nil {
+			t.Error("got nil error, want error")
+		}
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group-signed.sif"), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.UnloadContainer() // nolint:errcheck
+
+		v, err := NewVerifier(&f, OptVerifyWithDiscoveredKeyRings(missingPath, binaryPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Verify(); err != nil {
+			t.Error(err)
+		}
+	})
+}
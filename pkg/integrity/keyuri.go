@@ -0,0 +1,110 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+var (
+	errKeySchemeInvalid     = errors.New("key URI scheme invalid")
+	errKeySchemeUnsupported = errors.New("key URI scheme not supported")
+)
+
+// KeyProvider returns a crypto.Signer for the key identified by uri, such as a key held in a cloud
+// key management service or hardware token, and the PGP public key corresponding to it.
+//
+// The PGP public key determines the fingerprint recorded in signatures, which depends on its
+// creation time as well as its key material. A provider must therefore return a public key with
+// the same creation time each time it is called for the same key.
+type KeyProvider func(uri *url.URL) (*packet.PublicKey, crypto.Signer, error)
+
+var (
+	keyProvidersMu sync.RWMutex
+	keyProviders   = make(map[string]KeyProvider)
+)
+
+// schemeRegexp matches a URI scheme, as defined by RFC 3986.
+var schemeRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+
+// RegisterKeyProvider makes the key provider p available for key URIs with the given scheme, such
+// as "awskms", "gcpkms", "azurekeyvault" or "pkcs11". Schemes are case-insensitive. If
+// RegisterKeyProvider is called twice with the same scheme, the second registration replaces the
+// first. If p is nil, the provider is unregistered.
+//
+// This package does not implement any provider, so callers register those suitable for the keys
+// they expect to use, typically from an init function.
+func RegisterKeyProvider(scheme string, p KeyProvider) error {
+	if !schemeRegexp.MatchString(scheme) {
+		return fmt.Errorf("integrity: %w: %q", errKeySchemeInvalid, scheme)
+	}
+	scheme = strings.ToLower(scheme)
+
+	keyProvidersMu.Lock()
+	defer keyProvidersMu.Unlock()
+
+	if p == nil {
+		delete(keyProviders, scheme)
+	} else {
+		keyProviders[scheme] = p
+	}
+	return nil
+}
+
+// KeyProviders returns the sorted schemes of registered key providers.
+func KeyProviders() []string {
+	keyProvidersMu.RLock()
+	defer keyProvidersMu.RUnlock()
+
+	schemes := make([]string, 0, len(keyProviders))
+	for scheme := range keyProviders {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// getKeyProvider returns the key provider registered for scheme.
+func getKeyProvider(scheme string) (KeyProvider, bool) {
+	keyProvidersMu.RLock()
+	defer keyProvidersMu.RUnlock()
+
+	p, ok := keyProviders[strings.ToLower(scheme)]
+	return p, ok
+}
+
+// OptSignWithKeyURI specifies that signature(s) be generated using the key identified by uri
+// (such as "awskms:///alias/image-signing" or "pkcs11:token=ci;object=signing"). The backend is
+// selected by the scheme of uri, from the providers registered with RegisterKeyProvider, and is
+// used as described by OptSignWithSigner.
+func OptSignWithKeyURI(uri string) SignerOpt {
+	return func(s *Signer) error {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return err
+		}
+
+		p, ok := getKeyProvider(u.Scheme)
+		if !ok {
+			return fmt.Errorf("%w: %q", errKeySchemeUnsupported, u.Scheme)
+		}
+
+		pub, signer, err := p(u)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", uri, err)
+		}
+		return OptSignWithSigner(pub, signer)(s)
+	}
+}
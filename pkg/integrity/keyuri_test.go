@@ -0,0 +1,183 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"crypto"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestRegisterKeyProvider(t *testing.T) {
+	p := func(uri *url.URL) (*packet.PublicKey, crypto.Signer, error) {
+		return nil, nil, nil
+	}
+
+	tests := []struct {
+		name    string
+		scheme  string
+		wantErr error
+	}{
+		{name: "Empty", scheme: "", wantErr: errKeySchemeInvalid},
+		{name: "LeadingDigit", scheme: "1kms", wantErr: errKeySchemeInvalid},
+		{name: "Colon", scheme: "awskms:", wantErr: errKeySchemeInvalid},
+		{name: "OK", scheme: "testkms"},
+		{name: "Punctuation", scheme: "test+kms.v1-a"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := RegisterKeyProvider(tt.scheme, p)
+			defer RegisterKeyProvider(tt.scheme, nil) // nolint:errcheck
+
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestKeyProviders(t *testing.T) {
+	p := func(uri *url.URL) (*packet.PublicKey, crypto.Signer, error) {
+		return nil, nil, nil
+	}
+
+	for _, scheme := range []string{"testkms-b", "TestKMS-A"} {
+		if err := RegisterKeyProvider(scheme, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := KeyProviders(), []string{"testkms-a", "testkms-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got providers %v, want %v", got, want)
+	}
+
+	for _, scheme := range []string{"testkms-a", "TESTKMS-B"} {
+		if err := RegisterKeyProvider(scheme, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := KeyProviders(); len(got) != 0 {
+		t.Errorf("got providers %v, want none", got)
+	}
+}
+
+func TestOptSignWithKeyURI(t *testing.T) {
+	e := getTestEntity(t)
+
+	errProvider := errors.New("provider error")
+
+	var gotURI *url.URL
+	err := RegisterKeyProvider("testkms", func(uri *url.URL) (*packet.PublicKey, crypto.Signer, error) {
+		gotURI = uri
+		if uri.Opaque == "fail" {
+			return nil, nil, errProvider
+		}
+		return e.PrimaryKey, opaqueSigner{e.PrivateKey.PrivateKey.(crypto.Signer)}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RegisterKeyProvider("testkms", nil) // nolint:errcheck
+
+	tests := []struct {
+		name       string
+		uri        string
+		wantErr    error
+		wantOpaque string
+	}{
+		{
+			name:    "NoScheme",
+			uri:     "alias/image-signing",
+			wantErr: errKeySchemeUnsupported,
+		},
+		{
+			name:    "UnknownScheme",
+			uri:     "otherkms:///alias/image-signing",
+			wantErr: errKeySchemeUnsupported,
+		},
+		{
+			name:       "ProviderError",
+			uri:        "testkms:fail",
+			wantErr:    errProvider,
+			wantOpaque: "fail",
+		},
+		{
+			name:       "Opaque",
+			uri:        "testkms:token=ci;object=signing",
+			wantOpaque: "token=ci;object=signing",
+		},
+		{
+			name: "Hierarchical",
+			uri:  "TESTKMS:///alias/image-signing",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			gotURI = nil
+
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			f, err := sif.LoadContainerFp(tf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSigner(&f, OptSignWithKeyURI(tt.uri))
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if gotURI != nil {
+				if got, want := gotURI.Opaque, tt.wantOpaque; got != want {
+					t.Errorf("got opaque %q, want %q", got, want)
+				}
+			}
+
+			if err == nil {
+				if err := s.Sign(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr == nil {
+				f, err := sif.LoadContainer(tf.Name(), true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.UnloadContainer() // nolint:errcheck
+
+				v, err := NewVerifier(&f, OptVerifyWithKeyRing(openpgp.EntityList{e}))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := v.Verify(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -64,10 +64,25 @@ func tempFileFrom(path string) (tf *os.File, err error) {
 }
 
 // getTestEntity returns a fixed test PGP entity.
-func getTestEntity(t *testing.T) *openpgp.Entity {
+func getTestEntity(t testing.TB) *openpgp.Entity {
 	t.Helper()
 
-	f, err := os.Open(filepath.Join("testdata", "keys", "private.asc"))
+	return getTestEntityFrom(t, "private.asc")
+}
+
+// getTestEncryptedEntity returns a fixed test PGP entity, with a private key encrypted using the
+// passphrase "test".
+func getTestEncryptedEntity(t testing.TB) *openpgp.Entity {
+	t.Helper()
+
+	return getTestEntityFrom(t, "encrypted.asc")
+}
+
+// getTestEntityFrom returns the test PGP entity read from the named key file.
+func getTestEntityFrom(t testing.TB, name string) *openpgp.Entity {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", "keys", name))
 	if err != nil {
 		t.Fatal(err)
 	}
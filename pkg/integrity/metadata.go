@@ -9,9 +9,11 @@ import (
 	"bytes"
 	"crypto"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/sylabs/sif/pkg/sif"
 )
@@ -20,12 +22,27 @@ var (
 	errObjectNotSigned      = errors.New("object not signed")
 	errSignedObjectNotFound = errors.New("signed object not found")
 	errMinimumIDInvalid     = errors.New("minimum ID value invalid")
+
+	errMetadataVersionUnsupported = errors.New("metadata version not supported")
+	errMetadataNotCanonical       = errors.New("metadata not canonically encoded")
 )
 
 // ErrHeaderIntegrity is the error returned when the integrity of the SIF global header is
 // compromised.
 var ErrHeaderIntegrity = errors.New("header integrity compromised")
 
+// ErrObjectOrderIntegrity is the error returned when the order of signed data objects within the
+// SIF descriptor table does not match the order in which they were signed.
+var ErrObjectOrderIntegrity = errors.New("data object order integrity compromised")
+
+// ErrIdentityMismatch is the error returned when the identity claimed by a signature does not
+// match the expected identity.
+var ErrIdentityMismatch = errors.New("identity claim mismatch")
+
+// ErrEpochRollback is the error returned when the epoch claimed by a signature is less than the
+// minimum epoch required.
+var ErrEpochRollback = errors.New("epoch rollback")
+
 // DescriptorIntegrityError records an error in cryptographic verification of a data object
 // descriptor.
 type DescriptorIntegrityError struct {
@@ -71,8 +88,9 @@ func (e *ObjectIntegrityError) Is(target error) bool {
 	return e.ID == t.ID || t.ID == 0
 }
 
-// writeHeader writes the integrity-protected fields of h to w.
-func writeHeader(w io.Writer, h sif.Header) error {
+// writeHeader writes the integrity-protected fields of h to w. The set of fields protected
+// depends on the metadata version v.
+func writeHeader(w io.Writer, h sif.Header, v mdVersion) error {
 	fields := []interface{}{
 		h.Launch,
 		h.Magic,
@@ -80,6 +98,13 @@ func writeHeader(w io.Writer, h sif.Header) error {
 		h.ID,
 	}
 
+	if v >= metadataVersion3 {
+		fields = append(fields,
+			h.Arch,
+			h.Ctime,
+		)
+	}
+
 	for _, f := range fields {
 		if err := binary.Write(w, binary.LittleEndian, f); err != nil {
 			return err
@@ -88,8 +113,9 @@ func writeHeader(w io.Writer, h sif.Header) error {
 	return nil
 }
 
-// writeDescriptor writes the integrity-protected fields of od to w.
-func writeDescriptor(w io.Writer, relativeID uint32, od sif.Descriptor) error {
+// writeDescriptor writes the integrity-protected fields of od to w. The set of fields protected
+// depends on the metadata version v.
+func writeDescriptor(w io.Writer, relativeID uint32, od sif.Descriptor, v mdVersion) error {
 	fields := []interface{}{
 		od.Datatype,
 		od.Used,
@@ -103,6 +129,12 @@ func writeDescriptor(w io.Writer, relativeID uint32, od sif.Descriptor) error {
 		od.Extra,
 	}
 
+	if v >= metadataVersion4 {
+		fields = append(fields,
+			od.Groupid,
+		)
+	}
+
 	for _, f := range fields {
 		if err := binary.Write(w, binary.LittleEndian, f); err != nil {
 			return err
@@ -115,10 +147,10 @@ type headerMetadata struct {
 	Digest digest `json:"digest"`
 }
 
-// getHeaderMetadata returns headerMetadata for hdr, using hash algorithm h.
-func getHeaderMetadata(hdr sif.Header, h crypto.Hash) (headerMetadata, error) {
+// getHeaderMetadata returns headerMetadata for hdr, using hash algorithm h and metadata version v.
+func getHeaderMetadata(hdr sif.Header, h crypto.Hash, v mdVersion) (headerMetadata, error) {
 	b := bytes.Buffer{}
-	if err := writeHeader(&b, hdr); err != nil {
+	if err := writeHeader(&b, hdr, v); err != nil {
 		return headerMetadata{}, err
 	}
 
@@ -130,12 +162,12 @@ func getHeaderMetadata(hdr sif.Header, h crypto.Hash) (headerMetadata, error) {
 	return headerMetadata{Digest: d}, nil
 }
 
-// matches verifies hdr matches the metadata in hm.
+// matches verifies hdr matches the metadata in hm, which was produced with metadata version v.
 //
 // If the SIF global header does not match, ErrHeaderIntegrity is returned.
-func (hm headerMetadata) matches(hdr sif.Header) error {
+func (hm headerMetadata) matches(hdr sif.Header, v mdVersion) error {
 	b := bytes.Buffer{}
-	if err := writeHeader(&b, hdr); err != nil {
+	if err := writeHeader(&b, hdr, v); err != nil {
 		return err
 	}
 
@@ -156,13 +188,13 @@ type objectMetadata struct {
 }
 
 // getObjectMetadata returns objectMetadata for object with relativeID, descriptor od and content r
-// using hash algorithm h.
-func getObjectMetadata(relativeID uint32, od sif.Descriptor, r io.Reader, h crypto.Hash) (objectMetadata, error) {
+// using hash algorithm h and metadata version v. If r is nil, the object digest is not populated.
+func getObjectMetadata(relativeID uint32, od sif.Descriptor, r io.Reader, h crypto.Hash, v mdVersion) (objectMetadata, error) { // nolint:lll
 	om := objectMetadata{RelativeID: relativeID, id: od.ID}
 
 	// Write integrity-protected fields from object descriptor to buffer.
 	b := bytes.Buffer{}
-	if err := writeDescriptor(&b, relativeID, od); err != nil {
+	if err := writeDescriptor(&b, relativeID, od, v); err != nil {
 		return objectMetadata{}, err
 	}
 
@@ -174,11 +206,13 @@ func getObjectMetadata(relativeID uint32, od sif.Descriptor, r io.Reader, h cryp
 	om.DescriptorDigest = d
 
 	// Calculate digest on object data.
-	d, err = newDigestReader(h, r)
-	if err != nil {
-		return objectMetadata{}, err
+	if r != nil {
+		d, err = newDigestReader(h, r)
+		if err != nil {
+			return objectMetadata{}, err
+		}
+		om.ObjectDigest = d
 	}
-	om.ObjectDigest = d
 
 	return om, nil
 }
@@ -188,49 +222,158 @@ func (om *objectMetadata) populateAbsoluteID(minID uint32) {
 	om.id = minID + om.RelativeID
 }
 
-// matches verifies the object in f described by od matches the metadata in om.
+// matches verifies the object in f described by od matches the metadata in om, which was produced
+// with metadata version v.
 //
 // If the data object descriptor does not match, a DescriptorIntegrityError is returned. If the
 // data object does not match, a ObjectIntegrityError is returned.
-func (om objectMetadata) matches(f *sif.FileImage, od *sif.Descriptor) error {
-	b := bytes.Buffer{}
-	if err := writeDescriptor(&b, om.RelativeID, *od); err != nil {
+func (om objectMetadata) matches(f ImageReader, od *sif.Descriptor, v mdVersion) error {
+	if err := om.matchesDescriptor(od, v); err != nil {
 		return err
 	}
 
-	if ok, err := om.DescriptorDigest.matches(&b); err != nil {
+	if ok, err := om.ObjectDigest.matches(f.GetObjectReadSeeker(*od)); err != nil {
 		return err
 	} else if !ok {
-		return &DescriptorIntegrityError{ID: od.ID}
+		return &ObjectIntegrityError{ID: od.ID}
 	}
+	return nil
+}
 
-	if ok, err := om.ObjectDigest.matches(od.GetReadSeeker(f)); err != nil {
+// matchesDigest verifies the descriptor od matches the metadata in om, which was produced with
+// metadata version v, and that d, the digest of the data object, matches that in om.
+//
+// If the data object descriptor does not match, a DescriptorIntegrityError is returned. If the
+// data object does not match, a ObjectIntegrityError is returned.
+func (om objectMetadata) matchesDigest(od *sif.Descriptor, v mdVersion, d digest) error {
+	if err := om.matchesDescriptor(od, v); err != nil {
 		return err
-	} else if !ok {
+	}
+
+	if !bytes.Equal(d.value, om.ObjectDigest.value) {
 		return &ObjectIntegrityError{ID: od.ID}
 	}
 	return nil
 }
 
+// matchesDescriptor verifies the descriptor od matches the metadata in om, without reading the
+// object data.
+//
+// If the descriptor does not match, a DescriptorIntegrityError is returned.
+func (om objectMetadata) matchesDescriptor(od *sif.Descriptor, v mdVersion) error {
+	b := bytes.Buffer{}
+	if err := writeDescriptor(&b, om.RelativeID, *od, v); err != nil {
+		return err
+	}
+
+	if ok, err := om.DescriptorDigest.matches(&b); err != nil {
+		return err
+	} else if !ok {
+		return &DescriptorIntegrityError{ID: od.ID}
+	}
+	return nil
+}
+
 type mdVersion int
 
 const (
 	metadataVersion1 mdVersion = iota + 1
+	metadataVersion2           // Canonical JSON encoding (RFC 8785).
+	metadataVersion3           // Header arch and creation time are integrity-protected.
+	metadataVersion4           // Object group membership and ordering are integrity-protected.
 )
 
+// identityMetadata is a claim binding an image to a human-readable name, and optionally the URI
+// from which it is expected to be retrieved.
+type identityMetadata struct {
+	Name string `json:"name"`
+	URI  string `json:"uri,omitempty"`
+}
+
+// matches verifies the identity claimed in idm matches want. If want.URI is empty, only the name
+// is compared.
+//
+// If the claim does not match, an error wrapping ErrIdentityMismatch is returned.
+func (idm *identityMetadata) matches(want identityMetadata) error {
+	if idm == nil {
+		return fmt.Errorf("%w: no identity claimed", ErrIdentityMismatch)
+	}
+	if idm.Name != want.Name {
+		return fmt.Errorf("%w: name %q, want %q", ErrIdentityMismatch, idm.Name, want.Name)
+	}
+	if want.URI != "" && idm.URI != want.URI {
+		return fmt.Errorf("%w: URI %q, want %q", ErrIdentityMismatch, idm.URI, want.URI)
+	}
+	return nil
+}
+
 type imageMetadata struct {
-	Version mdVersion        `json:"version"`
-	Header  headerMetadata   `json:"header"`
-	Objects []objectMetadata `json:"objects"`
+	Version  mdVersion         `json:"version"`
+	Header   headerMetadata    `json:"header"`
+	Objects  []objectMetadata  `json:"objects"`
+	Identity *identityMetadata `json:"identity,omitempty"`
+	Epoch    uint64            `json:"epoch,omitempty"`
+	Role     string            `json:"role,omitempty"`
+	Prior    *priorMetadata    `json:"prior,omitempty"`
+}
+
+// checkEpoch verifies the epoch claimed in im is at least min. An image that claims no epoch is
+// treated as having epoch zero.
+//
+// If the claimed epoch is less than min, an error wrapping ErrEpochRollback is returned.
+func (im imageMetadata) checkEpoch(min uint64) error {
+	if im.Epoch < min {
+		return fmt.Errorf("%w: epoch %d, want at least %d", ErrEpochRollback, im.Epoch, min)
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes image metadata from b. If the metadata version is not supported,
+// errMetadataVersionUnsupported is returned. If the metadata version requires canonical encoding
+// and b is not canonically encoded, errMetadataNotCanonical is returned.
+func (im *imageMetadata) UnmarshalJSON(b []byte) error {
+	type rawImageMetadata imageMetadata
+
+	var raw rawImageMetadata
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	switch raw.Version {
+	case metadataVersion1:
+	case metadataVersion2, metadataVersion3, metadataVersion4:
+		c, err := canonicalJSON(raw)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(b, c) {
+			return errMetadataNotCanonical
+		}
+	default:
+		return fmt.Errorf("%w: %v", errMetadataVersionUnsupported, raw.Version)
+	}
+
+	*im = imageMetadata(raw)
+	return nil
+}
+
+// encode returns the JSON encoding of im. Metadata of version 2 and later is canonically encoded.
+// Version 1 metadata is encoded as by implementations that predate canonical encoding.
+func (im imageMetadata) encode() ([]byte, error) {
+	if im.Version == metadataVersion1 {
+		return json.Marshal(im)
+	}
+	return canonicalJSON(im)
 }
 
-// getImageMetadata returns populated imageMetadata for object descriptors ods in f, using hash
-// algorithm h.
-func getImageMetadata(f *sif.FileImage, minID uint32, ods []*sif.Descriptor, h crypto.Hash) (imageMetadata, error) {
-	im := imageMetadata{Version: metadataVersion1}
+// getImageMetadata returns populated imageMetadata of version v for object descriptors ods in f,
+// using hash algorithm h. Where digests holds the digest of the data of an object, calculated
+// using h, it is used rather than reading the data.
+func getImageMetadata(f ImageReader, minID uint32, ods []*sif.Descriptor, h crypto.Hash, v mdVersion, digests map[uint32]digest) (imageMetadata, error) { // nolint:lll
+	im := imageMetadata{Version: v}
 
 	// Add header metadata.
-	hm, err := getHeaderMetadata(f.Header, h)
+	hm, err := getHeaderMetadata(*f.GetHeader(), h, im.Version)
 	if err != nil {
 		return imageMetadata{}, err
 	}
@@ -242,16 +385,66 @@ func getImageMetadata(f *sif.FileImage, minID uint32, ods []*sif.Descriptor, h c
 			return imageMetadata{}, errMinimumIDInvalid
 		}
 
-		om, err := getObjectMetadata(od.ID-minID, *od, od.GetReadSeeker(f), h)
+		d, ok := digests[od.ID]
+		ok = ok && d.hash == h
+
+		var r io.Reader
+		if !ok {
+			r = f.GetObjectReadSeeker(*od)
+		}
+
+		om, err := getObjectMetadata(od.ID-minID, *od, r, h, im.Version)
 		if err != nil {
 			return imageMetadata{}, err
 		}
+		if ok {
+			om.ObjectDigest = d
+		}
 		im.Objects = append(im.Objects, om)
 	}
 
 	return im, nil
 }
 
+// getGroupMetadata returns the canonical JSON encoding of the image metadata covering the objects
+// in the group with the specified groupID, using SHA-256.
+func getGroupMetadata(f *sif.FileImage, groupID uint32) ([]byte, error) {
+	ods, err := getGroupObjects(f, groupID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ods, func(i, j int) bool { return ods[i].ID < ods[j].ID })
+
+	md, err := getImageMetadata(f, ods[0].ID, ods, crypto.SHA256, metadataVersion4, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image metadata: %w", err)
+	}
+
+	return canonicalJSON(md)
+}
+
+// verifyGroupMetadata verifies that im describes exactly the objects in the group with the
+// specified groupID, and that the objects match the metadata.
+func verifyGroupMetadata(f *sif.FileImage, groupID uint32, im imageMetadata) error {
+	ods, err := getGroupObjects(f, groupID)
+	if err != nil {
+		return err
+	}
+
+	minID, err := getGroupMinObjectID(f, groupID)
+	if err != nil {
+		return err
+	}
+	im.populateAbsoluteObjectIDs(minID)
+
+	if err := im.objectIDsMatch(ods); err != nil {
+		return err
+	}
+
+	_, err = im.matches(f, ods, nil, nil)
+	return err
+}
+
 // populateAbsoluteObjectIDs populates the absolute object ID of each object in im by adding minID
 // to the relative ID of each object in im.
 func (im *imageMetadata) populateAbsoluteObjectIDs(minID uint32) {
@@ -285,37 +478,61 @@ func (im imageMetadata) objectIDsMatch(ods []*sif.Descriptor) error {
 	return nil
 }
 
-// metadataForObject retrieves the objectMetadata for object specified by id.
-func (im imageMetadata) metadataForObject(id uint32) (objectMetadata, error) {
-	for _, om := range im.Objects {
+// metadataForObject retrieves the objectMetadata for object specified by id, and its index within
+// im.
+func (im imageMetadata) metadataForObject(id uint32) (objectMetadata, int, error) {
+	for i, om := range im.Objects {
 		if om.id == id {
-			return om, nil
+			return om, i, nil
 		}
 	}
-	return objectMetadata{}, fmt.Errorf("object %d: %w", id, errObjectNotSigned)
+	return objectMetadata{}, 0, fmt.Errorf("object %d: %w", id, errObjectNotSigned)
 }
 
 // matches verifies the header and objects described by ods match the metadata in im.
 //
 // If the SIF global header does not match, ErrHeaderIntegrity is returned. If the data object
 // descriptor does not match, a DescriptorIntegrityError is returned. If the data object does not
-// match, a ObjectIntegrityError is returned.
-func (im imageMetadata) matches(f *sif.FileImage, ods []*sif.Descriptor) ([]uint32, error) {
+// match, a ObjectIntegrityError is returned. If the metadata version protects object ordering and
+// the objects described by ods are not in the order they were signed, an error wrapping
+// ErrObjectOrderIntegrity is returned.
+//
+// If unchanged is not nil, and reports that the data of an object is unchanged since it was last
+// verified, only the descriptor of that object is verified. Where digests holds the digest of the
+// data of an object, calculated using the hash algorithm recorded in im, it is used rather than
+// reading the data.
+func (im imageMetadata) matches(f ImageReader, ods []*sif.Descriptor, unchanged func(*sif.Descriptor, objectMetadata) bool, digests map[uint32]digest) ([]uint32, error) { // nolint:lll
 	verified := make([]uint32, 0, len(ods))
 
 	// Verify header metadata.
-	if err := im.Header.matches(f.Header); err != nil {
+	if err := im.Header.matches(*f.GetHeader(), im.Version); err != nil {
 		return verified, err
 	}
 
 	// Verify data object metadata.
+	last := -1
 	for _, od := range ods {
-		om, err := im.metadataForObject(od.ID)
+		om, i, err := im.metadataForObject(od.ID)
 		if err != nil {
 			return verified, err
 		}
 
-		if err := om.matches(f, od); err != nil {
+		if im.Version >= metadataVersion4 {
+			if i < last {
+				return verified, fmt.Errorf("object %d: %w", od.ID, ErrObjectOrderIntegrity)
+			}
+			last = i
+		}
+
+		if unchanged != nil && unchanged(od, om) {
+			if err := om.matchesDescriptor(od, im.Version); err != nil {
+				return verified, err
+			}
+		} else if d, ok := digests[od.ID]; ok && d.hash == om.ObjectDigest.hash {
+			if err := om.matchesDigest(od, im.Version, d); err != nil {
+				return verified, err
+			}
+		} else if err := om.matches(f, od, im.Version); err != nil {
 			return verified, err
 		}
 
@@ -29,7 +29,7 @@ func TestWriteHeader(t *testing.T) {
 	}
 	copy(h.Launch[:], sif.HdrLaunch)
 	copy(h.Magic[:], sif.HdrMagic)
-	copy(h.Version[:], sif.HdrVersion)
+	copy(h.Version[:], sif.HdrVersion1)
 	copy(h.Arch[:], sif.HdrArchAMD64)
 
 	tests := []struct {
@@ -90,16 +90,29 @@ func TestWriteHeader(t *testing.T) {
 		}},
 	}
 
-	for _, tt := range tests {
-		tt := tt
-		t.Run(tt.name, func(t *testing.T) {
-			b := bytes.Buffer{}
-			if err := writeHeader(&b, tt.modFunc(h)); err != nil {
-				t.Fatal(err)
-			}
+	versions := []struct {
+		name    string
+		version mdVersion
+	}{
+		{"Version1", metadataVersion1},
+		{"Version3", metadataVersion3},
+	}
 
-			if err := verifyGolden(t.Name(), &b); err != nil {
-				t.Errorf("failed to verify golden: %v", err)
+	for _, v := range versions {
+		v := v
+		t.Run(v.name, func(t *testing.T) {
+			for _, tt := range tests {
+				tt := tt
+				t.Run(tt.name, func(t *testing.T) {
+					b := bytes.Buffer{}
+					if err := writeHeader(&b, tt.modFunc(h), v.version); err != nil {
+						t.Fatal(err)
+					}
+
+					if err := verifyGolden(t.Name(), &b); err != nil {
+						t.Errorf("failed to verify golden: %v", err)
+					}
+				})
 			}
 		})
 	}
@@ -122,6 +135,7 @@ func TestWriteDescriptor(t *testing.T) {
 	tests := []struct {
 		name       string
 		relativeID uint32
+		version    mdVersion
 		modFunc    func(*sif.Descriptor)
 	}{
 		{
@@ -144,6 +158,15 @@ func TestWriteDescriptor(t *testing.T) {
 			name:    "Groupid",
 			modFunc: func(od *sif.Descriptor) { od.Groupid++ },
 		},
+		{
+			name:    "Version4",
+			version: metadataVersion4,
+		},
+		{
+			name:    "GroupidVersion4",
+			version: metadataVersion4,
+			modFunc: func(od *sif.Descriptor) { od.Groupid++ },
+		},
 		{
 			name:    "Link",
 			modFunc: func(od *sif.Descriptor) { od.Link++ },
@@ -194,8 +217,13 @@ func TestWriteDescriptor(t *testing.T) {
 				tt.modFunc(&od)
 			}
 
+			version := tt.version
+			if version == 0 {
+				version = metadataVersion1
+			}
+
 			b := bytes.Buffer{}
-			if err := writeDescriptor(&b, tt.relativeID, od); err != nil {
+			if err := writeDescriptor(&b, tt.relativeID, od, version); err != nil {
 				t.Fatal(err)
 			}
 
@@ -214,13 +242,14 @@ func TestGetHeaderMetadata(t *testing.T) {
 	}
 	copy(h.Launch[:], sif.HdrLaunch)
 	copy(h.Magic[:], sif.HdrMagic)
-	copy(h.Version[:], sif.HdrVersion)
+	copy(h.Version[:], sif.HdrVersion1)
 	copy(h.Arch[:], sif.HdrArchAMD64)
 
 	tests := []struct {
 		name    string
 		header  sif.Header
 		hash    crypto.Hash
+		version mdVersion
 		wantErr error
 	}{
 		{name: "HashUnavailable", hash: crypto.MD4, wantErr: errHashUnavailable},
@@ -230,12 +259,18 @@ func TestGetHeaderMetadata(t *testing.T) {
 		{name: "SHA256", header: h, hash: crypto.SHA256},
 		{name: "SHA384", header: h, hash: crypto.SHA384},
 		{name: "SHA512", header: h, hash: crypto.SHA512},
+		{name: "Version3", header: h, hash: crypto.SHA256, version: metadataVersion3},
 	}
 
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			md, err := getHeaderMetadata(tt.header, tt.hash)
+			version := tt.version
+			if version == 0 {
+				version = metadataVersion1
+			}
+
+			md, err := getHeaderMetadata(tt.header, tt.hash, version)
 			if got, want := err, tt.wantErr; !errors.Is(got, want) {
 				t.Fatalf("got error %v, want %v", got, want)
 			}
@@ -267,6 +302,7 @@ func TestGetObjectMetadata(t *testing.T) {
 		od         sif.Descriptor
 		r          io.Reader
 		hash       crypto.Hash
+		version    mdVersion
 		wantErr    error
 	}{
 		{name: "HashUnavailable", hash: crypto.MD4, wantErr: errHashUnavailable},
@@ -277,12 +313,18 @@ func TestGetObjectMetadata(t *testing.T) {
 		{name: "SHA256", od: od, r: strings.NewReader("blah"), hash: crypto.SHA256},
 		{name: "SHA384", od: od, r: strings.NewReader("blah"), hash: crypto.SHA384},
 		{name: "SHA512", od: od, r: strings.NewReader("blah"), hash: crypto.SHA512},
+		{name: "Version4", od: od, r: strings.NewReader("blah"), hash: crypto.SHA256, version: metadataVersion4},
 	}
 
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			md, err := getObjectMetadata(tt.relativeID, tt.od, tt.r, tt.hash)
+			version := tt.version
+			if version == 0 {
+				version = metadataVersion1
+			}
+
+			md, err := getObjectMetadata(tt.relativeID, tt.od, tt.r, tt.hash, version)
 			if got, want := err, tt.wantErr; !errors.Is(got, want) {
 				t.Fatalf("got error %v, want %v", got, want)
 			}
@@ -322,6 +364,7 @@ func TestGetImageMetadata(t *testing.T) {
 		minID   uint32
 		ods     []*sif.Descriptor
 		hash    crypto.Hash
+		version mdVersion
 		wantErr error
 	}{
 		{name: "HashUnavailable", hash: crypto.MD4, wantErr: errHashUnavailable},
@@ -334,26 +377,223 @@ func TestGetImageMetadata(t *testing.T) {
 		{name: "SHA256", minID: 1, ods: []*sif.Descriptor{od1, od2}, hash: crypto.SHA256},
 		{name: "SHA384", minID: 1, ods: []*sif.Descriptor{od1, od2}, hash: crypto.SHA384},
 		{name: "SHA512", minID: 1, ods: []*sif.Descriptor{od1, od2}, hash: crypto.SHA512},
+		{name: "Version1", minID: 1, ods: []*sif.Descriptor{od1, od2}, hash: crypto.SHA256, version: metadataVersion1},
 	}
 
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			md, err := getImageMetadata(&f, tt.minID, tt.ods, tt.hash)
+			version := tt.version
+			if version == 0 {
+				version = metadataVersion4
+			}
+
+			md, err := getImageMetadata(&f, tt.minID, tt.ods, tt.hash, version, nil)
 			if got, want := err, tt.wantErr; !errors.Is(got, want) {
 				t.Fatalf("got error %v, want %v", got, want)
 			}
 
 			if err == nil {
-				b := bytes.Buffer{}
-				if err := json.NewEncoder(&b).Encode(md); err != nil {
+				b, err := md.encode()
+				if err != nil {
 					t.Fatal(err)
 				}
 
-				if err := verifyGolden(t.Name(), &b); err != nil {
+				if err := verifyGolden(t.Name(), bytes.NewReader(b)); err != nil {
 					t.Errorf("failed to verify golden: %v", err)
 				}
 			}
 		})
 	}
 }
+
+func TestImageMetadata_Matches(t *testing.T) {
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	od1, _, err := f.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	od2, _, err := f.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Descriptor with modified group membership, but otherwise identical to od2.
+	regrouped := *od2
+	regrouped.Groupid = sif.DescrGroupMask | 2
+
+	tests := []struct {
+		name    string
+		version mdVersion
+		ods     []*sif.Descriptor
+		wantErr error
+	}{
+		{name: "OK", version: metadataVersion4, ods: []*sif.Descriptor{od1, od2}},
+		{name: "Subset", version: metadataVersion4, ods: []*sif.Descriptor{od2}},
+		{name: "Reordered", version: metadataVersion4, ods: []*sif.Descriptor{od2, od1}, wantErr: ErrObjectOrderIntegrity},
+		{name: "ReorderedVersion3", version: metadataVersion3, ods: []*sif.Descriptor{od2, od1}},
+		{
+			name:    "Regrouped",
+			version: metadataVersion4,
+			ods:     []*sif.Descriptor{od1, &regrouped},
+			wantErr: &DescriptorIntegrityError{ID: 2},
+		},
+		{name: "RegroupedVersion3", version: metadataVersion3, ods: []*sif.Descriptor{od1, &regrouped}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			im := imageMetadata{Version: tt.version}
+
+			hm, err := getHeaderMetadata(f.Header, crypto.SHA256, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			im.Header = hm
+
+			for _, od := range []*sif.Descriptor{od1, od2} {
+				om, err := getObjectMetadata(od.ID-1, *od, od.GetReadSeeker(&f), crypto.SHA256, tt.version)
+				if err != nil {
+					t.Fatal(err)
+				}
+				im.Objects = append(im.Objects, om)
+			}
+			im.populateAbsoluteObjectIDs(1)
+
+			if _, err := im.matches(&f, tt.ods, nil, nil); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImageMetadata_UnmarshalJSON(t *testing.T) {
+	header := `"header":{"digest":"sha256:` + strings.Repeat("0", 64) + `"}`
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{
+			name:    "VersionUnsupported",
+			data:    `{` + header + `,"objects":[],"version":5}`,
+			wantErr: errMetadataVersionUnsupported,
+		},
+		{
+			name: "Version1",
+			data: `{"version":1,` + header + `,"objects":[]}`,
+		},
+		{
+			name:    "Version2NotCanonical",
+			data:    `{"version":2,` + header + `,"objects":[]}`,
+			wantErr: errMetadataNotCanonical,
+		},
+		{
+			name:    "Version2Whitespace",
+			data:    `{` + header + `, "objects":[],"version":2}`,
+			wantErr: errMetadataNotCanonical,
+		},
+		{
+			name: "Version2",
+			data: `{` + header + `,"objects":[],"version":2}`,
+		},
+		{
+			name: "Version4",
+			data: `{` + header + `,"objects":[],"version":4}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var im imageMetadata
+
+			err := json.Unmarshal([]byte(tt.data), &im)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestIdentityMetadata_Matches(t *testing.T) {
+	claim := &identityMetadata{Name: "user/collection/image:tag", URI: "library://user/collection/image:tag"}
+
+	tests := []struct {
+		name    string
+		idm     *identityMetadata
+		want    identityMetadata
+		wantErr error
+	}{
+		{
+			name:    "NoClaim",
+			want:    identityMetadata{Name: "user/collection/image:tag"},
+			wantErr: ErrIdentityMismatch,
+		},
+		{
+			name:    "NameMismatch",
+			idm:     claim,
+			want:    identityMetadata{Name: "user/collection/other:tag"},
+			wantErr: ErrIdentityMismatch,
+		},
+		{
+			name:    "URIMismatch",
+			idm:     claim,
+			want:    identityMetadata{Name: "user/collection/image:tag", URI: "oras://example.com/image:tag"},
+			wantErr: ErrIdentityMismatch,
+		},
+		{
+			name: "NameOnly",
+			idm:  claim,
+			want: identityMetadata{Name: "user/collection/image:tag"},
+		},
+		{
+			name: "NameAndURI",
+			idm:  claim,
+			want: *claim,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := tt.idm.matches(tt.want), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestImageMetadata_CheckEpoch(t *testing.T) {
+	tests := []struct {
+		name    string
+		epoch   uint64
+		min     uint64
+		wantErr error
+	}{
+		{name: "NoClaimNotRequired"},
+		{name: "NoClaim", min: 1, wantErr: ErrEpochRollback},
+		{name: "Rollback", epoch: 41, min: 42, wantErr: ErrEpochRollback},
+		{name: "Equal", epoch: 42, min: 42},
+		{name: "Greater", epoch: 43, min: 42},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			im := imageMetadata{Epoch: tt.epoch}
+
+			if got, want := im.checkEpoch(tt.min), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
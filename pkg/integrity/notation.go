@@ -0,0 +1,572 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+var (
+	errCertChainEmpty           = errors.New("certificate chain empty")
+	errNotationKeyUnsupported   = errors.New("key type not supported")
+	errNotationEnvelopeInvalid  = errors.New("notation envelope invalid")
+	errNotationPayloadInvalid   = errors.New("notation payload invalid")
+	errNotationSignatureInvalid = errors.New("notation signature invalid")
+)
+
+// ErrNotationSignatureNotFound is the error returned when no Notation signature is found for an
+// object group.
+var ErrNotationSignatureNotFound = errors.New("notation signature not found")
+
+// Notation (Notary v2) signatures are stored as JWS envelopes in cryptographic message objects,
+// linked to the object group they cover. The payload describes a target artifact, as with any
+// Notation signature. As signatures are stored within the image, the target artifact cannot be
+// the image itself. Instead, it is the canonical JSON encoding of the image metadata used for PGP
+// signatures, which is carried in an annotation so that verifiers need not reproduce it.
+const (
+	notationPayloadType       = "application/vnd.cncf.notary.payload.v1+json"
+	notationSigningScheme     = "notary.x509"
+	notationHeaderScheme      = "io.cncf.notary.signingScheme"
+	notationMediaTypeMetadata = "application/vnd.sylabs.sif.metadata.v1+json"
+	notationAnnotationGroup   = "io.sylabs.sif.group"
+	notationAnnotationMD      = "io.sylabs.sif.metadata"
+)
+
+// notationDescriptor describes the artifact covered by a Notation signature.
+type notationDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// notationPayload is the payload of a Notation signature.
+type notationPayload struct {
+	TargetArtifact notationDescriptor `json:"targetArtifact"`
+}
+
+// jwsProtectedHeader is the integrity-protected header of a Notation JWS envelope.
+type jwsProtectedHeader struct {
+	Algorithm     string    `json:"alg"`
+	ContentType   string    `json:"cty"`
+	Critical      []string  `json:"crit"`
+	SigningScheme string    `json:"io.cncf.notary.signingScheme"`
+	SigningTime   time.Time `json:"io.cncf.notary.signingTime"`
+}
+
+// jwsUnprotectedHeader is the unprotected header of a Notation JWS envelope.
+type jwsUnprotectedHeader struct {
+	CertChain [][]byte `json:"x5c"` // DER-encoded certificates, leaf first.
+}
+
+// jwsEnvelope is a JWS in flattened JSON serialization.
+type jwsEnvelope struct {
+	Payload   string               `json:"payload"`
+	Protected string               `json:"protected"`
+	Header    jwsUnprotectedHeader `json:"header"`
+	Signature string               `json:"signature"`
+}
+
+// jwsAlgorithm returns the JWS algorithm and associated hash used to sign with pub, following the
+// key size to algorithm mapping used by Notation.
+func jwsAlgorithm(pub crypto.PublicKey) (string, crypto.Hash, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		switch bits := pub.N.BitLen(); {
+		case bits >= 4096:
+			return "PS512", crypto.SHA512, nil
+		case bits >= 3072:
+			return "PS384", crypto.SHA384, nil
+		case bits >= 2048:
+			return "PS256", crypto.SHA256, nil
+		}
+
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return "ES256", crypto.SHA256, nil
+		case elliptic.P384():
+			return "ES384", crypto.SHA384, nil
+		case elliptic.P521():
+			return "ES512", crypto.SHA512, nil
+		}
+	}
+	return "", 0, fmt.Errorf("%w: %T", errNotationKeyUnsupported, pub)
+}
+
+// signJWS returns a JWS envelope containing payload, signed with key. The certificate chain certs
+// must begin with the certificate corresponding to key.
+func signJWS(payload []byte, key crypto.Signer, certs []*x509.Certificate, t time.Time) (jwsEnvelope, error) {
+	alg, h, err := jwsAlgorithm(key.Public())
+	if err != nil {
+		return jwsEnvelope{}, err
+	}
+
+	ph, err := json.Marshal(jwsProtectedHeader{
+		Algorithm:     alg,
+		ContentType:   notationPayloadType,
+		Critical:      []string{notationHeaderScheme},
+		SigningScheme: notationSigningScheme,
+		SigningTime:   t.UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		return jwsEnvelope{}, err
+	}
+
+	env := jwsEnvelope{
+		Payload:   base64.RawURLEncoding.EncodeToString(payload),
+		Protected: base64.RawURLEncoding.EncodeToString(ph),
+	}
+	for _, c := range certs {
+		env.Header.CertChain = append(env.Header.CertChain, c.Raw)
+	}
+
+	d := h.New()
+	d.Write([]byte(env.Protected + "." + env.Payload)) // nolint:errcheck
+
+	var opts crypto.SignerOpts = h
+	if _, ok := key.Public().(*rsa.PublicKey); ok {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h}
+	}
+
+	sig, err := key.Sign(rand.Reader, d.Sum(nil), opts)
+	if err != nil {
+		return jwsEnvelope{}, err
+	}
+
+	// JWS encodes ECDSA signatures as fixed-size R || S, rather than ASN.1.
+	if pub, ok := key.Public().(*ecdsa.PublicKey); ok {
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+			return jwsEnvelope{}, err
+		}
+
+		n := (pub.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*n)
+		rs.R.FillBytes(sig[:n])
+		rs.S.FillBytes(sig[n:])
+	}
+
+	env.Signature = base64.RawURLEncoding.EncodeToString(sig)
+	return env, nil
+}
+
+// verifyJWS verifies the signature of env, and that its certificate chain leads to roots and is
+// valid at time t. On success, the payload of env is returned.
+//
+// The signing time recorded in the protected header is chosen by the signer, so it is not used to
+// validate the certificate chain. Only a signing time attested by a trusted timestamp authority
+// could be, and timestamp countersignatures are not supported.
+func verifyJWS(env jwsEnvelope, roots *x509.CertPool, t time.Time) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(env.Protected)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotationEnvelopeInvalid, err)
+	}
+
+	var ph jwsProtectedHeader
+	if err := json.Unmarshal(b, &ph); err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotationEnvelopeInvalid, err)
+	}
+
+	if ph.ContentType != notationPayloadType {
+		return nil, fmt.Errorf("%w: unexpected content type %q", errNotationEnvelopeInvalid, ph.ContentType)
+	}
+	if ph.SigningScheme != notationSigningScheme {
+		return nil, fmt.Errorf("%w: unsupported signing scheme %q", errNotationEnvelopeInvalid, ph.SigningScheme)
+	}
+	for _, c := range ph.Critical {
+		if c != notationHeaderScheme {
+			return nil, fmt.Errorf("%w: unsupported critical header %q", errNotationEnvelopeInvalid, c)
+		}
+	}
+
+	// Verify certificate chain.
+	if len(env.Header.CertChain) == 0 {
+		return nil, fmt.Errorf("%w: %v", errNotationEnvelopeInvalid, errCertChainEmpty)
+	}
+
+	certs := make([]*x509.Certificate, 0, len(env.Header.CertChain))
+	for _, der := range env.Header.CertChain {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errNotationEnvelopeInvalid, err)
+		}
+		certs = append(certs, c)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   t,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, err
+	}
+
+	// Verify signature.
+	alg, h, err := jwsAlgorithm(certs[0].PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if alg != ph.Algorithm {
+		return nil, fmt.Errorf("%w: algorithm %q, want %q", errNotationSignatureInvalid, ph.Algorithm, alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(env.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotationEnvelopeInvalid, err)
+	}
+
+	d := h.New()
+	d.Write([]byte(env.Protected + "." + env.Payload)) // nolint:errcheck
+
+	switch pub := certs[0].PublicKey.(type) {
+	case *rsa.PublicKey:
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h}
+		if err := rsa.VerifyPSS(pub, h, d.Sum(nil), sig, opts); err != nil {
+			return nil, errNotationSignatureInvalid
+		}
+
+	case *ecdsa.PublicKey:
+		n := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*n {
+			return nil, errNotationSignatureInvalid
+		}
+		r, s := new(big.Int).SetBytes(sig[:n]), new(big.Int).SetBytes(sig[n:])
+		if !ecdsa.Verify(pub, d.Sum(nil), r, s) {
+			return nil, errNotationSignatureInvalid
+		}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotationEnvelopeInvalid, err)
+	}
+	return payload, nil
+}
+
+// getNotationPayload returns the Notation payload covering the objects in the group with the
+// specified groupID.
+func getNotationPayload(f *sif.FileImage, groupID uint32) ([]byte, error) {
+	b, err := getGroupMetadata(f, groupID)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+
+	return canonicalJSON(notationPayload{
+		TargetArtifact: notationDescriptor{
+			MediaType: notationMediaTypeMetadata,
+			Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+			Size:      int64(len(b)),
+			Annotations: map[string]string{
+				notationAnnotationGroup: strconv.FormatUint(uint64(groupID), 10),
+				notationAnnotationMD:    base64.StdEncoding.EncodeToString(b),
+			},
+		},
+	})
+}
+
+// verifyNotationPayload verifies that the Notation payload b covers the group with the specified
+// groupID, and that the objects in the group match the metadata it describes.
+func verifyNotationPayload(f *sif.FileImage, groupID uint32, b []byte) error {
+	var p notationPayload
+	if err := json.Unmarshal(b, &p); err != nil {
+		return fmt.Errorf("%w: %v", errNotationPayloadInvalid, err)
+	}
+	ta := p.TargetArtifact
+
+	if ta.MediaType != notationMediaTypeMetadata {
+		return fmt.Errorf("%w: unexpected media type %q", errNotationPayloadInvalid, ta.MediaType)
+	}
+	if got, want := ta.Annotations[notationAnnotationGroup], strconv.FormatUint(uint64(groupID), 10); got != want {
+		return fmt.Errorf("%w: signature covers group %q, want %q", errNotationPayloadInvalid, got, want)
+	}
+
+	mdb, err := base64.StdEncoding.DecodeString(ta.Annotations[notationAnnotationMD])
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNotationPayloadInvalid, err)
+	}
+	sum := sha256.Sum256(mdb)
+	if ta.Digest != "sha256:"+hex.EncodeToString(sum[:]) || ta.Size != int64(len(mdb)) {
+		return fmt.Errorf("%w: metadata does not match target artifact", errNotationPayloadInvalid)
+	}
+
+	var im imageMetadata
+	if err := json.Unmarshal(mdb, &im); err != nil {
+		return fmt.Errorf("%w: %v", errNotationPayloadInvalid, err)
+	}
+
+	return verifyGroupMetadata(f, groupID, im)
+}
+
+// NotationSigner describes a SIF image signer that produces Notation (Notary v2) compatible
+// signatures.
+type NotationSigner struct {
+	f        *sif.FileImage      // SIF image to sign.
+	key      crypto.Signer       // Signing key.
+	certs    []*x509.Certificate // Certificate chain, leaf first.
+	groupIDs []uint32            // Groups to sign.
+	t        time.Time           // Signing time, or zero to use current time.
+}
+
+// NotationSignerOpt are used to configure s.
+type NotationSignerOpt func(s *NotationSigner) error
+
+// OptNotationSignGroup specifies that a signature be applied to cover all objects in the group
+// with the specified groupID. This may be called multiple times to add multiple group signatures.
+func OptNotationSignGroup(groupID uint32) NotationSignerOpt {
+	return func(s *NotationSigner) error {
+		if _, err := getGroupObjects(s.f, groupID); err != nil {
+			return err
+		}
+		s.groupIDs = append(s.groupIDs, groupID)
+		return nil
+	}
+}
+
+// OptNotationSignTime specifies t as the signing time recorded in signature(s).
+func OptNotationSignTime(t time.Time) NotationSignerOpt {
+	return func(s *NotationSigner) error {
+		s.t = t
+		return nil
+	}
+}
+
+// NewNotationSigner returns a NotationSigner to add Notation signature(s) to f using key, which
+// must correspond to the leaf certificate of the chain certs.
+//
+// RSA keys of at least 2048 bits, and ECDSA keys on the P-256, P-384 and P-521 curves are
+// supported. By default, one signature is added per object group in f. To override this
+// behavior, use OptNotationSignGroup.
+func NewNotationSigner(f *sif.FileImage, key crypto.Signer, certs []*x509.Certificate, opts ...NotationSignerOpt) (*NotationSigner, error) { // nolint:lll
+	if f == nil {
+		return nil, fmt.Errorf("integrity: %w", errNilFileImage)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("integrity: %w", errCertChainEmpty)
+	}
+	if k, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(certs[0].PublicKey) {
+		return nil, fmt.Errorf("integrity: %w", errSignerKeyMismatch)
+	}
+	if _, _, err := jwsAlgorithm(key.Public()); err != nil {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+
+	s := NotationSigner{f: f, key: key, certs: certs}
+
+	for _, opt := range opts {
+		if err := opt(&s); err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+	}
+
+	if len(s.groupIDs) == 0 {
+		ids, err := getGroupIDs(f)
+		if err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+		s.groupIDs = ids
+	}
+
+	return &s, nil
+}
+
+// Sign adds Notation signature(s) as specified by s.
+func (s *NotationSigner) Sign() error {
+	t := s.t
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	for _, groupID := range s.groupIDs {
+		payload, err := getNotationPayload(s.f, groupID)
+		if err != nil {
+			return fmt.Errorf("integrity: %w", err)
+		}
+
+		env, err := signJWS(payload, s.key, s.certs, t)
+		if err != nil {
+			return fmt.Errorf("integrity: failed to sign: %w", err)
+		}
+
+		b, err := json.Marshal(env)
+		if err != nil {
+			return fmt.Errorf("integrity: %w", err)
+		}
+
+		di := sif.DescriptorInput{
+			Datatype: sif.DataCryptoMessage,
+			Groupid:  sif.DescrUnusedGroup,
+			Link:     sif.DescrGroupMask | groupID,
+			Size:     int64(len(b)),
+			Fp:       bytes.NewReader(b),
+		}
+		if err := di.SetCryptoMsgExtra(sif.FormatJWS, sif.MessageNotationSignature); err != nil {
+			return fmt.Errorf("integrity: failed to set signature metadata: %w", err)
+		}
+
+		if err := s.f.AddObject(di); err != nil {
+			return fmt.Errorf("integrity: failed to add object: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// NotationVerifier describes a SIF image verifier for Notation (Notary v2) signatures.
+type NotationVerifier struct {
+	f        *sif.FileImage // SIF image to verify.
+	roots    *x509.CertPool // Trusted root certificates.
+	groupIDs []uint32       // Groups to verify.
+	t        time.Time      // Validation time, or zero to use current time.
+}
+
+// NotationVerifierOpt are used to configure v.
+type NotationVerifierOpt func(v *NotationVerifier) error
+
+// OptNotationVerifyGroup specifies that the group with the specified groupID be verified. This
+// may be called multiple times to verify multiple groups.
+func OptNotationVerifyGroup(groupID uint32) NotationVerifierOpt {
+	return func(v *NotationVerifier) error {
+		if _, err := getGroupObjects(v.f, groupID); err != nil {
+			return err
+		}
+		v.groupIDs = append(v.groupIDs, groupID)
+		return nil
+	}
+}
+
+// OptNotationVerifyTime specifies t as the time at which certificate chains are validated, in
+// place of the current time. The signing time recorded in a signature is chosen by the signer, and
+// is never used for validation.
+func OptNotationVerifyTime(t time.Time) NotationVerifierOpt {
+	return func(v *NotationVerifier) error {
+		v.t = t
+		return nil
+	}
+}
+
+// NewNotationVerifier returns a NotationVerifier to verify Notation signature(s) in f, which must
+// have been issued by a certificate chaining to one of roots. Signing certificates must permit code
+// signing, and the chain must be valid at the current time, or the time specified with
+// OptNotationVerifyTime.
+//
+// By default, all object groups in f are verified. To override this behavior, use
+// OptNotationVerifyGroup.
+func NewNotationVerifier(f *sif.FileImage, roots *x509.CertPool, opts ...NotationVerifierOpt) (*NotationVerifier, error) { // nolint:lll
+	if f == nil {
+		return nil, fmt.Errorf("integrity: %w", errNilFileImage)
+	}
+
+	v := NotationVerifier{f: f, roots: roots}
+
+	for _, opt := range opts {
+		if err := opt(&v); err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+	}
+
+	if len(v.groupIDs) == 0 {
+		ids, err := getGroupIDs(f)
+		if err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+		v.groupIDs = ids
+	}
+
+	return &v, nil
+}
+
+// getNotationSignatures returns the Notation signatures linked to the group with the specified
+// groupID.
+func getNotationSignatures(f *sif.FileImage, groupID uint32) ([]*sif.Descriptor, error) {
+	ods, _, err := f.GetLinkedDescrsByType(groupID|sif.DescrGroupMask, sif.DataCryptoMessage)
+	if err != nil && !errors.Is(err, sif.ErrNotFound) {
+		return nil, err
+	}
+
+	var sigs []*sif.Descriptor
+	for _, od := range ods {
+		if ft, err := od.GetFormatType(); err != nil || ft != sif.FormatJWS {
+			continue
+		}
+		if mt, err := od.GetMessageType(); err != nil || mt != sif.MessageNotationSignature {
+			continue
+		}
+		sigs = append(sigs, od)
+	}
+
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("%w: group %d", ErrNotationSignatureNotFound, groupID)
+	}
+	return sigs, nil
+}
+
+// verifyGroup verifies the group with the specified groupID. Verification succeeds if any of the
+// Notation signatures linked to the group is valid.
+func (v *NotationVerifier) verifyGroup(groupID uint32, t time.Time) error {
+	sigs, err := getNotationSignatures(v.f, groupID)
+	if err != nil {
+		return err
+	}
+
+	for _, sig := range sigs {
+		var env jwsEnvelope
+		if err = json.Unmarshal(sig.GetData(v.f), &env); err != nil {
+			err = fmt.Errorf("%w: %v", errNotationEnvelopeInvalid, err)
+			continue
+		}
+
+		var payload []byte
+		if payload, err = verifyJWS(env, v.roots, t); err != nil {
+			continue
+		}
+
+		if err = verifyNotationPayload(v.f, groupID, payload); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Verify performs verification of Notation signatures as specified by v.
+func (v *NotationVerifier) Verify() error {
+	t := v.t
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	for _, groupID := range v.groupIDs {
+		if err := v.verifyGroup(groupID, t); err != nil {
+			return fmt.Errorf("integrity: %w", err)
+		}
+	}
+	return nil
+}
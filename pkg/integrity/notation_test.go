@@ -0,0 +1,293 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// errUnknownAuthority is substituted for x509.UnknownAuthorityError in test expectations, as the
+// latter cannot be compared using errors.Is.
+var errUnknownAuthority = errors.New("unknown authority")
+
+// errCertExpired is substituted for an expired x509.CertificateInvalidError in test expectations.
+var errCertExpired = errors.New("certificate expired")
+
+// getTestCertChain returns a code signing certificate for key, issued by a newly generated root
+// certificate authority, and a pool containing the root.
+func getTestCertChain(t *testing.T, key crypto.Signer) ([]*x509.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             fixedTime().Add(-time.Hour),
+		NotAfter:              fixedTime().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    fixedTime().Add(-time.Hour),
+		NotAfter:     fixedTime().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	return []*x509.Certificate{leaf}, roots
+}
+
+func TestNewNotationSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, _ := getTestCertChain(t, key)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakCerts, _ := getTestCertChain(t, weak)
+
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "two-groups.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	tests := []struct {
+		name         string
+		fi           *sif.FileImage
+		key          crypto.Signer
+		certs        []*x509.Certificate
+		opts         []NotationSignerOpt
+		wantErr      error
+		wantGroupIDs []uint32
+	}{
+		{name: "NilFileImage", key: key, certs: certs, wantErr: errNilFileImage},
+		{name: "NoCerts", fi: &f, key: key, wantErr: errCertChainEmpty},
+		{name: "KeyMismatch", fi: &f, key: other, certs: certs, wantErr: errSignerKeyMismatch},
+		{name: "KeyUnsupported", fi: &f, key: weak, certs: weakCerts, wantErr: errNotationKeyUnsupported},
+		{
+			name:    "GroupNotFound",
+			fi:      &f,
+			key:     key,
+			certs:   certs,
+			opts:    []NotationSignerOpt{OptNotationSignGroup(3)},
+			wantErr: errGroupNotFound,
+		},
+		{name: "Defaults", fi: &f, key: key, certs: certs, wantGroupIDs: []uint32{1, 2}},
+		{
+			name:         "OptNotationSignGroup",
+			fi:           &f,
+			key:          key,
+			certs:        certs,
+			opts:         []NotationSignerOpt{OptNotationSignGroup(2)},
+			wantGroupIDs: []uint32{2},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewNotationSigner(tt.fi, tt.key, tt.certs, tt.opts...)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if err == nil {
+				if got, want := s.groupIDs, tt.wantGroupIDs; !equalIDs(got, want) {
+					t.Errorf("got group IDs %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+// equalIDs returns true if a and b contain the same IDs in the same order.
+func equalIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNotationSignVerify(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecCerts, ecRoots := getTestCertChain(t, ecKey)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaCerts, rsaRoots := getTestCertChain(t, rsaKey)
+
+	tests := []struct {
+		name       string
+		key        crypto.Signer
+		certs      []*x509.Certificate
+		roots      *x509.CertPool
+		tamper     bool
+		verifyTime time.Time
+		wantErr    error
+	}{
+		{name: "ECDSA", key: ecKey, certs: ecCerts, roots: ecRoots},
+		{name: "RSA", key: rsaKey, certs: rsaCerts, roots: rsaRoots},
+		{name: "UntrustedRoot", key: ecKey, certs: ecCerts, roots: rsaRoots, wantErr: errUnknownAuthority},
+		{name: "ObjectTampered", key: ecKey, certs: ecCerts, roots: ecRoots, tamper: true, wantErr: &ObjectIntegrityError{}},
+		// The signing time falls within the validity period of the chain, but is not trusted.
+		{name: "Expired", key: ecKey, certs: ecCerts, roots: ecRoots, verifyTime: fixedTime().Add(2 * time.Hour), wantErr: errCertExpired}, // nolint:lll
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			f, err := sif.LoadContainerFp(tf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewNotationSigner(&f, tt.key, tt.certs, OptNotationSignTime(fixedTime()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Sign(); err != nil {
+				t.Fatal(err)
+			}
+
+			od, err := getObject(&f, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			off, _ := od.Extent()
+
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.tamper {
+				tf, err := os.OpenFile(tf.Name(), os.O_RDWR, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := tf.WriteAt([]byte{0xff}, off); err != nil {
+					t.Fatal(err)
+				}
+				tf.Close()
+			}
+
+			f, err = sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			// The signature must not be mistaken for a PGP signature.
+			if _, err := getGroupSignatures(&f, 1, false); err == nil {
+				t.Error("notation signature found as PGP signature")
+			}
+
+			verifyTime := tt.verifyTime
+			if verifyTime.IsZero() {
+				verifyTime = fixedTime()
+			}
+
+			v, err := NewNotationVerifier(&f, tt.roots, OptNotationVerifyTime(verifyTime))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = v.Verify()
+			if target := (x509.UnknownAuthorityError{}); errors.As(err, &target) {
+				err = errUnknownAuthority
+			}
+			if target := (x509.CertificateInvalidError{}); errors.As(err, &target) && target.Reason == x509.Expired {
+				err = errCertExpired
+			}
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNotationVerifier_NoSignature(t *testing.T) {
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group-signed.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	v, err := NewNotationVerifier(&f, x509.NewCertPool())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Verify(); !errors.Is(err, ErrNotationSignatureNotFound) {
+		t.Fatalf("got error %v, want %v", err, ErrNotationSignatureNotFound)
+	}
+}
@@ -0,0 +1,496 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+var (
+	errReferenceInvalid     = errors.New("reference invalid")
+	errDigestMismatch       = errors.New("digest mismatch")
+	errSIFLayerNotFound     = errors.New("SIF layer not found in manifest")
+	errUnexpectedStatus     = errors.New("unexpected HTTP status")
+	errSimpleSigningInvalid = errors.New("simple signing payload invalid")
+	errOCIKeyUnsupported    = errors.New("key type not supported")
+	errOCISignatureInvalid  = errors.New("OCI signature invalid")
+	errOCINotFound          = errors.New("OCI content not found")
+	errOCIContentTooLarge   = errors.New("OCI content too large")
+	errOCIChallengeInvalid  = errors.New("authentication challenge invalid")
+)
+
+// ErrOCISignatureNotFound is the error returned when no valid detached signature is found in an
+// OCI registry.
+var ErrOCISignatureNotFound = errors.New("OCI signature not found")
+
+// Detached signatures follow the cosign convention. For an artifact with manifest digest
+// "sha256:<hex>", signatures are stored in the same repository, in an image manifest tagged
+// "sha256-<hex>.sig". Each layer of that manifest is a simple signing payload identifying the
+// artifact, with the signature of the payload held in a layer annotation.
+const (
+	ociMediaTypeManifest       = "application/vnd.oci.image.manifest.v1+json"
+	ociMediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	ociMediaTypeSimpleSigning  = "application/vnd.dev.cosign.simplesigning.v1+json"
+	ociAnnotationSignature     = "dev.cosignproject.cosign/signature"
+	ociSimpleSigningType       = "cosign container image signature"
+)
+
+// ociMaxContentSize is the maximum size of content retrieved from a registry. Only manifests,
+// signature payloads and tokens are retrieved, so content larger than this is not expected.
+const ociMaxContentSize = 4 << 20
+
+// ociDescriptor describes content stored in an OCI registry.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest is an OCI image manifest.
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// simpleSigningPayload is a simple signing payload, as produced by cosign.
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// ociReference identifies an artifact by digest within a repository of an OCI registry.
+type ociReference struct {
+	registry   string // Registry host, with optional port.
+	repository string // Repository name.
+	digest     string // Manifest digest, in the form "sha256:<hex>".
+}
+
+// parseOCIReference parses ref, which must be of the form "registry/repository@sha256:<hex>".
+func parseOCIReference(ref string) (ociReference, error) {
+	name, digest := ref, ""
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		name, digest = ref[:i], ref[i+1:]
+	}
+
+	if !strings.HasPrefix(digest, "sha256:") {
+		return ociReference{}, fmt.Errorf("%w: %q does not contain a sha256 digest", errReferenceInvalid, ref)
+	}
+	if b, err := hex.DecodeString(strings.TrimPrefix(digest, "sha256:")); err != nil || len(b) != sha256.Size {
+		return ociReference{}, fmt.Errorf("%w: %q contains an invalid digest", errReferenceInvalid, ref)
+	}
+
+	i := strings.Index(name, "/")
+	if i <= 0 || i == len(name)-1 {
+		return ociReference{}, fmt.Errorf("%w: %q does not contain a registry and repository", errReferenceInvalid, ref)
+	}
+
+	return ociReference{registry: name[:i], repository: name[i+1:], digest: digest}, nil
+}
+
+// signatureTag returns the tag under which detached signatures of r are stored.
+func (r ociReference) signatureTag() string {
+	return strings.Replace(r.digest, ":", "-", 1) + ".sig"
+}
+
+// sha256Digest returns the digest of b in the form "sha256:<hex>".
+func sha256Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// OCIVerifier describes a verifier of detached signatures stored in an OCI registry.
+type OCIVerifier struct {
+	pub    crypto.PublicKey // Public key to verify signatures with.
+	client *http.Client     // Client used to access the registry.
+	scheme string           // URL scheme used to access the registry.
+
+	mu    sync.Mutex // Protects token.
+	token string     // Bearer token obtained from the registry authorization service, if any.
+}
+
+// OCIVerifierOpt are used to configure v.
+type OCIVerifierOpt func(v *OCIVerifier) error
+
+// OptOCIVerifyHTTPClient specifies c be used to access the registry. The client may be used to
+// supply credentials, such as by way of its Transport. Where the registry challenges the client to
+// obtain a bearer token, as Docker Hub and GitHub Container Registry do, c is also used to request
+// the token from the authorization service named in the challenge.
+func OptOCIVerifyHTTPClient(c *http.Client) OCIVerifierOpt {
+	return func(v *OCIVerifier) error {
+		v.client = c
+		return nil
+	}
+}
+
+// OptOCIVerifyPlainHTTP specifies the registry be accessed over plain HTTP, rather than HTTPS.
+// This should only be used with registries on trusted networks.
+func OptOCIVerifyPlainHTTP() OCIVerifierOpt {
+	return func(v *OCIVerifier) error {
+		v.scheme = "http"
+		return nil
+	}
+}
+
+// NewOCIVerifier returns an OCIVerifier that verifies detached signatures using pub, which must be
+// an ECDSA, RSA or Ed25519 public key. In FIPS mode, Ed25519 keys are refused.
+func NewOCIVerifier(pub crypto.PublicKey, opts ...OCIVerifierOpt) (*OCIVerifier, error) {
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("integrity: %w: %T", errOCIKeyUnsupported, pub)
+	}
+	if err := checkFIPSPublicKey(pub); err != nil {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+
+	v := &OCIVerifier{pub: pub, client: http.DefaultClient, scheme: "https"}
+
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+	}
+
+	return v, nil
+}
+
+// readContent reads the body of res, which must not exceed ociMaxContentSize bytes.
+func readContent(res *http.Response) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, ociMaxContentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > ociMaxContentSize {
+		return nil, fmt.Errorf("%w: %v exceeds %d bytes", errOCIContentTooLarge, res.Request.URL, ociMaxContentSize)
+	}
+	return b, nil
+}
+
+// parseBearerChallenge parses the parameters of a bearer challenge, as found in the
+// WWW-Authenticate header of a response. The realm parameter is required.
+func parseBearerChallenge(h string) (map[string]string, error) {
+	const scheme = "bearer "
+	if len(h) < len(scheme) || !strings.EqualFold(h[:len(scheme)], scheme) {
+		return nil, fmt.Errorf("%w: unsupported scheme in %q", errOCIChallengeInvalid, h)
+	}
+
+	params := make(map[string]string)
+	for s := strings.TrimSpace(h[len(scheme):]); s != ""; {
+		i := strings.Index(s, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%w: %q", errOCIChallengeInvalid, h)
+		}
+		key, val := strings.ToLower(strings.TrimSpace(s[:i])), ""
+		s = strings.TrimSpace(s[i+1:])
+
+		// Values may be quoted, in which case they may contain commas, such as in a scope
+		// requesting several actions.
+		if strings.HasPrefix(s, `"`) {
+			j := strings.Index(s[1:], `"`)
+			if j < 0 {
+				return nil, fmt.Errorf("%w: %q", errOCIChallengeInvalid, h)
+			}
+			val, s = s[1:j+1], s[j+2:]
+		} else {
+			j := strings.Index(s, ",")
+			if j < 0 {
+				j = len(s)
+			}
+			val, s = strings.TrimSpace(s[:j]), s[j:]
+		}
+		params[key] = val
+
+		s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), ","))
+	}
+
+	if params["realm"] == "" {
+		return nil, fmt.Errorf("%w: no realm in %q", errOCIChallengeInvalid, h)
+	}
+	return params, nil
+}
+
+// getToken obtains a bearer token from the authorization service named in challenge h.
+func (v *OCIVerifier) getToken(ctx context.Context, h string) (string, error) {
+	params, err := parseBearerChallenge(h)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errOCIChallengeInvalid, err)
+	}
+	q := u.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %v: %v", errUnexpectedStatus, u, res.Status)
+	}
+
+	b, err := readContent(res)
+	if err != nil {
+		return "", err
+	}
+
+	// Registries return the token as token, access_token, or both.
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return "", fmt.Errorf("decoding token: %w", err)
+	}
+	if t.Token == "" {
+		t.Token = t.AccessToken
+	}
+	if t.Token == "" {
+		return "", fmt.Errorf("%w: no token returned by %v", errOCIChallengeInvalid, u)
+	}
+	return t.Token, nil
+}
+
+// do sends a GET request for u. If the registry responds with a bearer challenge, a token is
+// obtained and the request is sent again. The token is retained for use in later requests.
+func (v *OCIVerifier) do(ctx context.Context, u, accept string) (*http.Response, error) {
+	send := func(token string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return v.client.Do(req)
+	}
+
+	v.mu.Lock()
+	token := v.token
+	v.mu.Unlock()
+
+	res, err := send(token)
+	if err != nil {
+		return nil, err
+	}
+
+	h := res.Header.Get("WWW-Authenticate")
+	if res.StatusCode != http.StatusUnauthorized || h == "" {
+		return res, nil
+	}
+	res.Body.Close()
+
+	if token, err = v.getToken(ctx, h); err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	v.token = token
+	v.mu.Unlock()
+
+	return send(token)
+}
+
+// get retrieves the named content from the repository identified by r, verifying the content
+// against digest if it is not empty. If the content does not exist, an error wrapping
+// errOCINotFound is returned.
+func (v *OCIVerifier) get(ctx context.Context, r ociReference, kind, name, accept, digest string) ([]byte, error) {
+	u := fmt.Sprintf("%s://%s/v2/%s/%s/%s", v.scheme, r.registry, r.repository, kind, name)
+
+	res, err := v.do(ctx, u, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %v", errOCINotFound, u)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %v: %v", errUnexpectedStatus, u, res.Status)
+	}
+
+	b, err := readContent(res)
+	if err != nil {
+		return nil, err
+	}
+
+	if digest != "" && sha256Digest(b) != digest {
+		return nil, fmt.Errorf("%w: %v", errDigestMismatch, u)
+	}
+	return b, nil
+}
+
+// getManifest retrieves the manifest named name from the repository identified by r.
+func (v *OCIVerifier) getManifest(ctx context.Context, r ociReference, name, digest string) (ociManifest, error) {
+	b, err := v.get(ctx, r, "manifests", name, ociMediaTypeManifest+", "+ociMediaTypeDockerManifest, digest)
+	if err != nil {
+		return ociManifest{}, err
+	}
+
+	var m ociManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return ociManifest{}, err
+	}
+	return m, nil
+}
+
+// verifySignature verifies that sig is a valid signature of payload.
+func (v *OCIVerifier) verifySignature(payload, sig []byte) error {
+	sum := sha256.Sum256(payload)
+
+	switch pub := v.pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, sum[:], sig) {
+			return errOCISignatureInvalid
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+			return errOCISignatureInvalid
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, payload, sig) {
+			return errOCISignatureInvalid
+		}
+	}
+	return nil
+}
+
+// verifyLayer verifies the signature layer l of the signature manifest associated with r.
+func (v *OCIVerifier) verifyLayer(ctx context.Context, r ociReference, l ociDescriptor) error {
+	sig, err := base64.StdEncoding.DecodeString(l.Annotations[ociAnnotationSignature])
+	if err != nil {
+		return err
+	}
+
+	payload, err := v.get(ctx, r, "blobs", l.Digest, "", l.Digest)
+	if err != nil {
+		return err
+	}
+
+	if err := v.verifySignature(payload, sig); err != nil {
+		return err
+	}
+
+	var p simpleSigningPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("%w: %v", errSimpleSigningInvalid, err)
+	}
+	if p.Critical.Type != ociSimpleSigningType {
+		return fmt.Errorf("%w: unexpected type %q", errSimpleSigningInvalid, p.Critical.Type)
+	}
+	if got, want := p.Critical.Image.DockerManifestDigest, r.digest; got != want {
+		return fmt.Errorf("%w: signature covers %v, want %v", errSimpleSigningInvalid, got, want)
+	}
+	if got, want := p.Critical.Identity.DockerReference, r.registry+"/"+r.repository; got != want {
+		return fmt.Errorf("%w: signature identifies %v, want %v", errSimpleSigningInvalid, got, want)
+	}
+	return nil
+}
+
+// Verify verifies a SIF image stored as an artifact in an OCI registry, using detached signatures
+// stored alongside it. The artifact is identified by ref, which must be of the form
+// "registry/repository@sha256:<hex>". The contents of the SIF image are read from image, and must
+// match the SIF layer of the artifact manifest.
+//
+// Verification succeeds if any signature is valid. If the registry holds no signatures of the
+// artifact, an error wrapping ErrOCISignatureNotFound is returned. Otherwise, if no valid signature
+// is found, the error encountered verifying the last signature examined is returned.
+func (v *OCIVerifier) Verify(ctx context.Context, ref string, image io.Reader) error {
+	r, err := parseOCIReference(ref)
+	if err != nil {
+		return fmt.Errorf("integrity: %w", err)
+	}
+
+	// Check the image matches the artifact identified by ref.
+	m, err := v.getManifest(ctx, r, r.digest, r.digest)
+	if err != nil {
+		return fmt.Errorf("integrity: failed to get artifact manifest: %w", err)
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(h, image)
+	if err != nil {
+		return fmt.Errorf("integrity: %w", err)
+	}
+	digest := "sha256:" + hex.EncodeToString(h.Sum(nil))
+
+	found := false
+	for _, l := range m.Layers {
+		if l.MediaType == sif.MediaTypeSIF && l.Digest == digest && l.Size == n {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("integrity: %w: %v", errSIFLayerNotFound, digest)
+	}
+
+	// Check signatures. Only the absence of the signature manifest indicates there are none.
+	sm, err := v.getManifest(ctx, r, r.signatureTag(), "")
+	if errors.Is(err, errOCINotFound) {
+		return fmt.Errorf("integrity: %w: %v", ErrOCISignatureNotFound, ref)
+	} else if err != nil {
+		return fmt.Errorf("integrity: failed to get signature manifest: %w", err)
+	}
+
+	err = fmt.Errorf("%w: %v", ErrOCISignatureNotFound, ref)
+	for _, l := range sm.Layers {
+		if l.MediaType != ociMediaTypeSimpleSigning {
+			continue
+		}
+		if err = v.verifyLayer(ctx, r, l); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("integrity: %w", err)
+}
@@ -0,0 +1,369 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// testRegistry is a minimal in-memory OCI registry serving a single repository. If token is not
+// empty, clients must obtain it from the registry's token endpoint in response to a bearer
+// challenge.
+type testRegistry struct {
+	repo      string
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	token     string
+}
+
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var m map[string][]byte
+	var name string
+
+	if reg.token != "" {
+		if r.URL.Path == "/token" {
+			if got, want := r.URL.Query().Get("scope"), "repository:"+reg.repo+":pull"; got != want {
+				http.Error(w, "unexpected scope", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": reg.token}) // nolint:errcheck
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+reg.token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="http://%s/token",service="test",scope="repository:%s:pull"`, r.Host, reg.repo))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	p := strings.TrimPrefix(r.URL.Path, "/v2/"+reg.repo)
+	switch {
+	case strings.HasPrefix(p, "/manifests/"):
+		m, name = reg.manifests, strings.TrimPrefix(p, "/manifests/")
+	case strings.HasPrefix(p, "/blobs/"):
+		m, name = reg.blobs, strings.TrimPrefix(p, "/blobs/")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	b, ok := m[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(b) // nolint:errcheck
+}
+
+// putManifest stores manifest m in reg, under tag if it is not empty, and returns its digest.
+func (reg *testRegistry) putManifest(t *testing.T, m ociManifest, tag string) string {
+	t.Helper()
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := sha256Digest(b)
+	reg.manifests[d] = b
+	if tag != "" {
+		reg.manifests[tag] = b
+	}
+	return d
+}
+
+// putBlob stores b in reg, and returns a descriptor for it.
+func (reg *testRegistry) putBlob(mediaType string, b []byte) ociDescriptor {
+	d := sha256Digest(b)
+	reg.blobs[d] = b
+	return ociDescriptor{MediaType: mediaType, Digest: d, Size: int64(len(b))}
+}
+
+// signPayload returns a base64 encoded signature of payload using key.
+func signPayload(t *testing.T, key crypto.Signer, payload []byte) string {
+	t.Helper()
+
+	digest, opts := payload, crypto.SignerOpts(crypto.Hash(0))
+	if _, ok := key.(ed25519.PrivateKey); !ok {
+		sum := sha256.Sum256(payload)
+		digest, opts = sum[:], crypto.SHA256
+	}
+
+	sig, err := key.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func TestParseOCIReference(t *testing.T) {
+	const d = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name    string
+		ref     string
+		wantRef ociReference
+		wantErr error
+	}{
+		{name: "NoDigest", ref: "example.com/repo:latest", wantErr: errReferenceInvalid},
+		{name: "BadDigest", ref: "example.com/repo@sha256:0123", wantErr: errReferenceInvalid},
+		{name: "NoRepository", ref: "example.com@" + d, wantErr: errReferenceInvalid},
+		{
+			name:    "OK",
+			ref:     "example.com:5000/org/repo@" + d,
+			wantRef: ociReference{registry: "example.com:5000", repository: "org/repo", digest: d},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseOCIReference(tt.ref)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if got, want := r, tt.wantRef; got != want {
+				t.Errorf("got reference %+v, want %+v", got, want)
+			}
+
+			if err == nil {
+				if got, want := r.signatureTag(), "sha256-"+d[len("sha256:"):]+".sig"; got != want {
+					t.Errorf("got signature tag %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewOCIVerifier(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewOCIVerifier(key); !errors.Is(err, errOCIKeyUnsupported) {
+		t.Errorf("got error %v, want %v", err, errOCIKeyUnsupported)
+	}
+
+	if _, err := NewOCIVerifier(key.Public()); err != nil {
+		t.Errorf("got error %v, want nil", err)
+	}
+}
+
+func TestOCIVerifier_Verify(t *testing.T) {
+	image, err := ioutil.ReadFile(filepath.Join("testdata", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const repo = "org/image"
+
+	tests := []struct {
+		name        string
+		key         crypto.Signer
+		verifyKey   crypto.PublicKey
+		image       []byte
+		noSignature bool
+		noArtifact  bool
+		token       string
+		largeSig    bool
+		payloadType string
+		otherDigest bool
+		wantErr     error
+	}{
+		{name: "ECDSA", key: ecKey, verifyKey: ecKey.Public()},
+		{name: "RSA", key: rsaKey, verifyKey: rsaKey.Public()},
+		{name: "Ed25519", key: edKey, verifyKey: edKey.Public()},
+		{name: "WrongKey", key: rsaKey, verifyKey: ecKey.Public(), wantErr: errOCISignatureInvalid},
+		{name: "ImageMismatch", key: ecKey, verifyKey: ecKey.Public(), image: image[1:], wantErr: errSIFLayerNotFound},
+		{name: "NoSignature", key: ecKey, verifyKey: ecKey.Public(), noSignature: true, wantErr: ErrOCISignatureNotFound},
+		{name: "NoArtifact", key: ecKey, verifyKey: ecKey.Public(), noArtifact: true, wantErr: errOCINotFound},
+		{name: "BearerToken", key: ecKey, verifyKey: ecKey.Public(), token: "secret"},
+		{name: "SignatureTooLarge", key: ecKey, verifyKey: ecKey.Public(), largeSig: true, wantErr: errOCIContentTooLarge},
+		{
+			name:        "PayloadType",
+			key:         ecKey,
+			verifyKey:   ecKey.Public(),
+			payloadType: "other",
+			wantErr:     errSimpleSigningInvalid,
+		},
+		{
+			name:        "PayloadDigest",
+			key:         ecKey,
+			verifyKey:   ecKey.Public(),
+			otherDigest: true,
+			wantErr:     errSimpleSigningInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			reg := &testRegistry{
+				repo:      repo,
+				manifests: make(map[string][]byte),
+				blobs:     make(map[string][]byte),
+				token:     tt.token,
+			}
+
+			s := httptest.NewServer(reg)
+			defer s.Close()
+
+			u, err := url.Parse(s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Push the image as an artifact.
+			digest := reg.putManifest(t, ociManifest{
+				SchemaVersion: 2,
+				MediaType:     ociMediaTypeManifest,
+				Config:        reg.putBlob("application/vnd.sylabs.sif.config.v1+json", []byte("{}")),
+				Layers:        []ociDescriptor{reg.putBlob(sif.MediaTypeSIF, image)},
+			}, "latest")
+
+			ref := ociReference{registry: u.Host, repository: repo, digest: digest}
+
+			// Push a signature of the artifact.
+			if !tt.noSignature {
+				var p simpleSigningPayload
+				p.Critical.Identity.DockerReference = u.Host + "/" + repo
+				p.Critical.Image.DockerManifestDigest = digest
+				p.Critical.Type = ociSimpleSigningType
+				if tt.payloadType != "" {
+					p.Critical.Type = tt.payloadType
+				}
+				if tt.otherDigest {
+					p.Critical.Image.DockerManifestDigest = sha256Digest(nil)
+				}
+
+				payload, err := json.Marshal(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				l := reg.putBlob(ociMediaTypeSimpleSigning, payload)
+				l.Annotations = map[string]string{ociAnnotationSignature: signPayload(t, tt.key, payload)}
+
+				reg.putManifest(t, ociManifest{
+					SchemaVersion: 2,
+					MediaType:     ociMediaTypeManifest,
+					Config:        reg.putBlob("application/vnd.oci.image.config.v1+json", []byte("{}")),
+					Layers:        []ociDescriptor{l},
+				}, ref.signatureTag())
+			}
+			if tt.largeSig {
+				reg.manifests[ref.signatureTag()] = bytes.Repeat([]byte(" "), ociMaxContentSize+1)
+			}
+			if tt.noArtifact {
+				delete(reg.manifests, digest)
+			}
+
+			v, err := NewOCIVerifier(tt.verifyKey, OptOCIVerifyPlainHTTP(), OptOCIVerifyHTTPClient(s.Client()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			img := image
+			if tt.image != nil {
+				img = tt.image
+			}
+
+			err = v.Verify(context.Background(), u.Host+"/"+repo+"@"+digest, bytes.NewReader(img))
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseBearerChallenge(t *testing.T) {
+	tests := []struct {
+		name    string
+		h       string
+		want    map[string]string
+		wantErr error
+	}{
+		{
+			name: "DockerHub",
+			h:    `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"`, // nolint:lll
+			want: map[string]string{
+				"realm":   "https://auth.docker.io/token",
+				"service": "registry.docker.io",
+				"scope":   "repository:library/alpine:pull",
+			},
+		},
+		{
+			name: "CommaInScope",
+			h:    `bearer realm="https://ghcr.io/token", scope="repository:org/image:pull,push", service="ghcr.io"`,
+			want: map[string]string{
+				"realm":   "https://ghcr.io/token",
+				"service": "ghcr.io",
+				"scope":   "repository:org/image:pull,push",
+			},
+		},
+		{
+			name: "Unquoted",
+			h:    `Bearer realm=https://example.com/token,service=example.com`,
+			want: map[string]string{"realm": "https://example.com/token", "service": "example.com"},
+		},
+		{name: "Basic", h: `Basic realm="registry"`, wantErr: errOCIChallengeInvalid},
+		{name: "NoRealm", h: `Bearer service="example.com"`, wantErr: errOCIChallengeInvalid},
+		{name: "Unterminated", h: `Bearer realm="https://example.com/token`, wantErr: errOCIChallengeInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBearerChallenge(tt.h)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) && tt.wantErr == nil {
+				t.Errorf("got parameters %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
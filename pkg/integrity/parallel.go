@@ -0,0 +1,134 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"crypto"
+	"runtime"
+	"sync"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// parallelism returns the number of objects to hash concurrently when n is requested.
+func parallelism(n int) int {
+	if n < 1 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// OptSignParallelism specifies that the data of up to n objects in a group be hashed concurrently
+// when signing. If n is less than 1, the number of CPUs is used. By default, objects are hashed one
+// at a time. The image must permit its objects to be read concurrently, as a *sif.FileImage does.
+func OptSignParallelism(n int) SignerOpt {
+	return func(s *Signer) error {
+		s.parallel = parallelism(n)
+		return nil
+	}
+}
+
+// OptVerifyParallelism specifies that the data of up to n objects covered by a signature be hashed
+// concurrently when verifying. If n is less than 1, the number of CPUs is used. By default, objects
+// are hashed one at a time. Legacy signatures are always verified one object at a time. The image
+// must permit its objects to be read concurrently, as a *sif.FileImage does.
+func OptVerifyParallelism(n int) VerifierOpt {
+	return func(v *Verifier) error {
+		v.parallel = parallelism(n)
+		return nil
+	}
+}
+
+// hashObjects calculates the digests of the data of objects ods in f using hash algorithm h,
+// hashing up to n objects concurrently, and returns them by object ID. Objects that cannot be
+// hashed are omitted, so that the error is reported when the object is hashed again in turn.
+func hashObjects(f ImageReader, ods []*sif.Descriptor, h crypto.Hash, n int) map[uint32]digest {
+	if n > len(ods) {
+		n = len(ods)
+	}
+
+	ds := make([]digest, len(ods))
+	errs := make([]error, len(ods))
+
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+
+	for w := 0; w < n; w++ {
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				ds[i], errs[i] = newDigestReader(h, f.GetObjectReadSeeker(*ods[i]))
+			}
+		}()
+	}
+
+	for i := range ods {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	m := make(map[uint32]digest, len(ods))
+	for i, od := range ods {
+		if errs[i] == nil {
+			m[od.ID] = ds[i]
+		}
+	}
+	return m
+}
+
+// objectDigests returns the digests of the data of objects ods to be signed by gs, by object ID.
+// If gs hashes objects concurrently, the objects without a precomputed digest are hashed.
+// Otherwise, only precomputed digests are returned, and the remaining objects are hashed as their
+// metadata is obtained.
+func (gs *groupSigner) objectDigests(ods []*sif.Descriptor) map[uint32]digest {
+	var todo []*sif.Descriptor
+	for _, od := range ods {
+		if d, ok := gs.digests[od.ID]; !ok || d.hash != gs.mdHash {
+			todo = append(todo, od)
+		}
+	}
+	if gs.parallel < 2 || len(todo) < 2 {
+		return gs.digests
+	}
+
+	m := hashObjects(gs.f, todo, gs.mdHash, gs.parallel)
+	for id, d := range gs.digests {
+		if _, ok := m[id]; !ok {
+			m[id] = d
+		}
+	}
+	return m
+}
+
+// objectDigests returns the digests of the data of objects ods to be verified by v against im, by
+// object ID. If v hashes objects concurrently, the objects not recorded as unchanged since an
+// earlier verification are hashed. Otherwise, nil is returned, and objects are hashed as they are
+// verified.
+func (v *groupVerifier) objectDigests(im imageMetadata, ods []*sif.Descriptor) map[uint32]digest {
+	if v.parallel < 2 {
+		return nil
+	}
+
+	var h crypto.Hash
+	var todo []*sif.Descriptor
+	for _, od := range ods {
+		om, _, err := im.metadataForObject(od.ID)
+		if err != nil || v.unchanged(od, om) {
+			continue
+		}
+		h = om.ObjectDigest.hash
+		todo = append(todo, od)
+	}
+	if len(todo) < 2 {
+		return nil
+	}
+
+	return hashObjects(v.f, todo, h, v.parallel)
+}
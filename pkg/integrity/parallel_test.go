@@ -0,0 +1,156 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestHashObjects(t *testing.T) {
+	f := newFakeImage(t, filepath.Join("testdata", "images", "two-groups.sif"), nil)
+
+	var ods []*sif.Descriptor
+	want := make(map[uint32]digest)
+	for i := range f.ds {
+		od := &f.ds[i]
+		ods = append(ods, od)
+
+		d, err := newDigestReader(crypto.SHA256, f.GetObjectReadSeeker(*od))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[od.ID] = d
+	}
+
+	for _, n := range []int{1, 2, len(ods), len(ods) + 1} {
+		n := n
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			if got := hashObjects(f, ods, crypto.SHA256, n); !reflect.DeepEqual(got, want) {
+				t.Errorf("got digests %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSigner_SignParallel(t *testing.T) {
+	e := getTestEntity(t)
+
+	for _, n := range []int{0, 1, 2} {
+		n := n
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "two-groups.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			tf.Close()
+
+			f, err := sif.LoadContainer(tf.Name(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSigner(&f, OptSignWithEntity(e), OptSignParallelism(n))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Sign(); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err = sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			v, err := NewVerifier(&f, OptVerifyWithKeyRing(openpgp.EntityList{e}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Verify(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestVerifier_VerifyParallel(t *testing.T) {
+	kr := openpgp.EntityList{getTestEntity(t)}
+
+	tests := []struct {
+		name    string
+		path    string
+		corrupt func(f *fakeImage, b []byte)
+		wantErr error
+	}{
+		{
+			name: "OK",
+			path: "two-groups-signed.sif",
+		},
+		{
+			name: "OKVersion4",
+			path: "two-groups-signed-v4.sif",
+		},
+		{
+			name: "ObjectIntegrity",
+			path: "two-groups-signed.sif",
+			corrupt: func(f *fakeImage, b []byte) {
+				b[f.ds[1].Fileoff] ^= 0xff
+			},
+			wantErr: &ObjectIntegrityError{ID: 2},
+		},
+		{
+			name: "ObjectIntegrityFirst",
+			path: "two-groups-signed.sif",
+			corrupt: func(f *fakeImage, b []byte) {
+				b[f.ds[0].Fileoff] ^= 0xff
+				b[f.ds[1].Fileoff] ^= 0xff
+			},
+			wantErr: &ObjectIntegrityError{ID: 1},
+		},
+		{
+			name: "DescriptorIntegrity",
+			path: "two-groups-signed.sif",
+			corrupt: func(f *fakeImage, b []byte) {
+				f.ds[1].Ctime++
+			},
+			wantErr: &DescriptorIntegrityError{ID: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		for _, n := range []int{0, 1, 2} {
+			n := n
+			t.Run(fmt.Sprintf("%v/%v", tt.name, n), func(t *testing.T) {
+				f := newFakeImage(t, filepath.Join("testdata", "images", tt.path), tt.corrupt)
+
+				v, err := NewVerifier(f, OptVerifyWithKeyRing(kr), OptVerifyParallelism(n))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got, want := v.Verify(), tt.wantErr; !errors.Is(got, want) {
+					t.Fatalf("got error %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
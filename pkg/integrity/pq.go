@@ -0,0 +1,271 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+var (
+	errPQEnvelopeInvalid  = errors.New("post-quantum signature envelope invalid")
+	errPQSignatureInvalid = errors.New("post-quantum signature invalid")
+	errPQKeyMismatch      = errors.New("post-quantum signature made with another key")
+)
+
+// ErrPQAlgorithmUnsupported is the error returned when a post-quantum signature algorithm is not
+// supported by this build.
+var ErrPQAlgorithmUnsupported = errors.New("post-quantum signature algorithm not supported")
+
+// ErrPQSignatureNotFound is the error returned when no post-quantum signature is found for an
+// object group.
+var ErrPQSignatureNotFound = errors.New("post-quantum signature not found")
+
+// Post-quantum signatures are stored as JSON envelopes in cryptographic message objects, linked
+// to the object group they cover. The envelope records the algorithm, an identifier of the public
+// key, and the canonical JSON encoding of the image metadata used for PGP signatures, which is
+// signed following a prefix binding the envelope version and algorithm. The format is fixed ahead
+// of the standardization of implementations, so that images signed by experimental builds remain
+// readable as support matures.
+//
+// No implementation of any algorithm is included. Builds with the sif_experimental_pq build tag
+// may register implementations with RegisterPQAlgorithm, and sign images with PQSigner. Other
+// builds recognize post-quantum signatures, but PQVerifier reports ErrPQAlgorithmUnsupported.
+const (
+	pqEnvelopeVersion = 1
+	pqSigningPrefix   = "sif-pq-signature"
+)
+
+// PQAlgorithm identifies a post-quantum signature algorithm.
+type PQAlgorithm string
+
+// Post-quantum signature algorithms.
+const (
+	PQAlgorithmMLDSA44 PQAlgorithm = "ML-DSA-44" // FIPS 204, security category 2
+	PQAlgorithmMLDSA65 PQAlgorithm = "ML-DSA-65" // FIPS 204, security category 3
+	PQAlgorithmMLDSA87 PQAlgorithm = "ML-DSA-87" // FIPS 204, security category 5
+)
+
+// pqEnvelope is the envelope of a post-quantum signature.
+type pqEnvelope struct {
+	Version   int         `json:"version"`
+	Algorithm PQAlgorithm `json:"alg"`
+	KeyID     string      `json:"kid"`
+	Payload   string      `json:"payload"`
+	Signature string      `json:"sig"`
+}
+
+// pqVerifyFunc reports whether sig is a valid signature of msg by public key pub.
+type pqVerifyFunc func(pub, msg, sig []byte) bool
+
+var (
+	pqMu        sync.RWMutex
+	pqVerifiers = make(map[PQAlgorithm]pqVerifyFunc)
+)
+
+// pqVerifier returns the verification function registered for alg.
+func pqVerifier(alg PQAlgorithm) (pqVerifyFunc, error) {
+	pqMu.RLock()
+	defer pqMu.RUnlock()
+
+	fn, ok := pqVerifiers[alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrPQAlgorithmUnsupported, alg)
+	}
+	return fn, nil
+}
+
+// checkFIPSPQ returns an AlgorithmNotApprovedError if FIPS mode is enabled. Implementations of
+// post-quantum algorithms are registered by the caller, and are not part of a validated module.
+func checkFIPSPQ(alg PQAlgorithm) error {
+	if FIPSMode() {
+		return &AlgorithmNotApprovedError{Algorithm: string(alg)}
+	}
+	return nil
+}
+
+// pqKeyID returns the identifier of public key pub, as recorded in an envelope.
+func pqKeyID(pub []byte) string {
+	sum := sha256.Sum256(pub)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// pqSigningInput returns the message signed by a post-quantum signature over payload using alg.
+func pqSigningInput(alg PQAlgorithm, payload []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s.v%d\n%s\n", pqSigningPrefix, pqEnvelopeVersion, alg)
+	b.Write(payload)
+	return b.Bytes()
+}
+
+// verifyPQ verifies the signature held in env using alg and public key pub, and returns the
+// signed payload.
+func verifyPQ(env pqEnvelope, alg PQAlgorithm, pub []byte) ([]byte, error) {
+	if env.Version != pqEnvelopeVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", errPQEnvelopeInvalid, env.Version)
+	}
+	if env.Algorithm != alg {
+		return nil, fmt.Errorf("%w: algorithm %q, want %q", errPQKeyMismatch, env.Algorithm, alg)
+	}
+	if env.KeyID != pqKeyID(pub) {
+		return nil, fmt.Errorf("%w: key %v", errPQKeyMismatch, env.KeyID)
+	}
+
+	if err := checkFIPSPQ(alg); err != nil {
+		return nil, err
+	}
+
+	verify, err := pqVerifier(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPQEnvelopeInvalid, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(env.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPQEnvelopeInvalid, err)
+	}
+
+	if !verify(pub, pqSigningInput(alg, payload), sig) {
+		return nil, errPQSignatureInvalid
+	}
+	return payload, nil
+}
+
+// getPQSignatures returns the post-quantum signatures linked to the group with the specified
+// groupID.
+func getPQSignatures(f *sif.FileImage, groupID uint32) ([]*sif.Descriptor, error) {
+	ods, _, err := f.GetLinkedDescrsByType(groupID|sif.DescrGroupMask, sif.DataCryptoMessage)
+	if err != nil && !errors.Is(err, sif.ErrNotFound) {
+		return nil, err
+	}
+
+	var sigs []*sif.Descriptor
+	for _, od := range ods {
+		if ft, err := od.GetFormatType(); err != nil || ft != sif.FormatSigEnvelope {
+			continue
+		}
+		if mt, err := od.GetMessageType(); err != nil || mt != sif.MessagePQSignature {
+			continue
+		}
+		sigs = append(sigs, od)
+	}
+
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("%w: group %d", ErrPQSignatureNotFound, groupID)
+	}
+	return sigs, nil
+}
+
+// verifyPQGroup verifies the group with the specified groupID in f using alg and public key pub.
+// Verification succeeds if any of the post-quantum signatures linked to the group is valid.
+func verifyPQGroup(f *sif.FileImage, groupID uint32, alg PQAlgorithm, pub []byte) error {
+	sigs, err := getPQSignatures(f, groupID)
+	if err != nil {
+		return err
+	}
+
+	for _, sig := range sigs {
+		var env pqEnvelope
+		if err = json.Unmarshal(sig.GetData(f), &env); err != nil {
+			err = fmt.Errorf("%w: %v", errPQEnvelopeInvalid, err)
+			continue
+		}
+
+		var payload []byte
+		if payload, err = verifyPQ(env, alg, pub); err != nil {
+			continue
+		}
+
+		var im imageMetadata
+		if err = json.Unmarshal(payload, &im); err != nil {
+			err = fmt.Errorf("%w: %v", errPQEnvelopeInvalid, err)
+			continue
+		}
+
+		if err = verifyGroupMetadata(f, groupID, im); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// PQVerifier describes a SIF image verifier for post-quantum signatures.
+type PQVerifier struct {
+	f        *sif.FileImage // SIF image to verify.
+	alg      PQAlgorithm    // Signature algorithm.
+	pub      []byte         // Encoded public key.
+	groupIDs []uint32       // Groups to verify.
+}
+
+// PQVerifierOpt are used to configure v.
+type PQVerifierOpt func(v *PQVerifier) error
+
+// OptPQVerifyGroup specifies that the group with the specified groupID be verified. This may be
+// called multiple times to verify multiple groups.
+func OptPQVerifyGroup(groupID uint32) PQVerifierOpt {
+	return func(v *PQVerifier) error {
+		if _, err := getGroupObjects(v.f, groupID); err != nil {
+			return err
+		}
+		v.groupIDs = append(v.groupIDs, groupID)
+		return nil
+	}
+}
+
+// NewPQVerifier returns a PQVerifier to verify post-quantum signature(s) in f made using
+// algorithm alg, with the private key corresponding to the encoded public key pub. Where no
+// implementation of alg is registered, an error wrapping ErrPQAlgorithmUnsupported is returned.
+//
+// By default, all object groups in f are verified. To override this behavior, use
+// OptPQVerifyGroup.
+func NewPQVerifier(f *sif.FileImage, alg PQAlgorithm, pub []byte, opts ...PQVerifierOpt) (*PQVerifier, error) {
+	if f == nil {
+		return nil, fmt.Errorf("integrity: %w", errNilFileImage)
+	}
+	if _, err := pqVerifier(alg); err != nil {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+
+	v := PQVerifier{f: f, alg: alg, pub: pub}
+
+	for _, opt := range opts {
+		if err := opt(&v); err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+	}
+
+	if len(v.groupIDs) == 0 {
+		ids, err := getGroupIDs(f)
+		if err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+		v.groupIDs = ids
+	}
+
+	return &v, nil
+}
+
+// Verify performs verification of post-quantum signatures as specified by v.
+func (v *PQVerifier) Verify() error {
+	for _, groupID := range v.groupIDs {
+		if err := verifyPQGroup(v.f, groupID, v.alg, v.pub); err != nil {
+			return fmt.Errorf("integrity: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+//go:build sif_experimental_pq
+// +build sif_experimental_pq
+
+package integrity
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// RegisterPQAlgorithm registers verify as the implementation of post-quantum signature algorithm
+// alg, replacing any implementation previously registered. The verify function reports whether
+// sig is a valid signature of msg by the encoded public key pub.
+//
+// RegisterPQAlgorithm is experimental, and only available in builds with the sif_experimental_pq
+// build tag.
+func RegisterPQAlgorithm(alg PQAlgorithm, verify func(pub, msg, sig []byte) bool) {
+	pqMu.Lock()
+	defer pqMu.Unlock()
+
+	pqVerifiers[alg] = verify
+}
+
+// PQKey is a post-quantum private key.
+type PQKey interface {
+	// Algorithm returns the signature algorithm of the key.
+	Algorithm() PQAlgorithm
+
+	// Public returns the encoded public key corresponding to the key.
+	Public() []byte
+
+	// Sign returns the signature of msg.
+	Sign(msg []byte) ([]byte, error)
+}
+
+// PQSigner describes a SIF image signer that produces post-quantum signatures.
+type PQSigner struct {
+	f        *sif.FileImage // SIF image to sign.
+	key      PQKey          // Signing key.
+	groupIDs []uint32       // Groups to sign.
+}
+
+// PQSignerOpt are used to configure s.
+type PQSignerOpt func(s *PQSigner) error
+
+// OptPQSignGroup specifies that a signature be applied to cover all objects in the group with the
+// specified groupID. This may be called multiple times to add multiple group signatures.
+func OptPQSignGroup(groupID uint32) PQSignerOpt {
+	return func(s *PQSigner) error {
+		if _, err := getGroupObjects(s.f, groupID); err != nil {
+			return err
+		}
+		s.groupIDs = append(s.groupIDs, groupID)
+		return nil
+	}
+}
+
+// NewPQSigner returns a PQSigner to add post-quantum signature(s) to f using key. An implementation
+// of the algorithm of key must be registered with RegisterPQAlgorithm, so that signatures may be
+// verified. By default, one signature is added per object group in f. To override this behavior,
+// use OptPQSignGroup.
+//
+// NewPQSigner is experimental, and only available in builds with the sif_experimental_pq build
+// tag.
+func NewPQSigner(f *sif.FileImage, key PQKey, opts ...PQSignerOpt) (*PQSigner, error) {
+	if f == nil {
+		return nil, fmt.Errorf("integrity: %w", errNilFileImage)
+	}
+	if err := checkFIPSPQ(key.Algorithm()); err != nil {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+	if _, err := pqVerifier(key.Algorithm()); err != nil {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+
+	s := PQSigner{f: f, key: key}
+
+	for _, opt := range opts {
+		if err := opt(&s); err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+	}
+
+	if len(s.groupIDs) == 0 {
+		ids, err := getGroupIDs(f)
+		if err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+		s.groupIDs = ids
+	}
+
+	return &s, nil
+}
+
+// signPQ returns an envelope holding the signature of payload by key.
+func signPQ(key PQKey, payload []byte) (pqEnvelope, error) {
+	alg := key.Algorithm()
+
+	sig, err := key.Sign(pqSigningInput(alg, payload))
+	if err != nil {
+		return pqEnvelope{}, err
+	}
+
+	return pqEnvelope{
+		Version:   pqEnvelopeVersion,
+		Algorithm: alg,
+		KeyID:     pqKeyID(key.Public()),
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	}, nil
+}
+
+// Sign adds post-quantum signature(s) as specified by s.
+func (s *PQSigner) Sign() error {
+	for _, groupID := range s.groupIDs {
+		payload, err := getGroupMetadata(s.f, groupID)
+		if err != nil {
+			return fmt.Errorf("integrity: %w", err)
+		}
+
+		env, err := signPQ(s.key, payload)
+		if err != nil {
+			return fmt.Errorf("integrity: failed to sign: %w", err)
+		}
+
+		b, err := json.Marshal(env)
+		if err != nil {
+			return fmt.Errorf("integrity: %w", err)
+		}
+
+		di := sif.DescriptorInput{
+			Datatype: sif.DataCryptoMessage,
+			Groupid:  sif.DescrUnusedGroup,
+			Link:     sif.DescrGroupMask | groupID,
+			Size:     int64(len(b)),
+			Fp:       bytes.NewReader(b),
+		}
+		if err := di.SetCryptoMsgExtra(sif.FormatSigEnvelope, sif.MessagePQSignature); err != nil {
+			return fmt.Errorf("integrity: failed to set signature metadata: %w", err)
+		}
+
+		if err := s.f.AddObject(di); err != nil {
+			return fmt.Errorf("integrity: failed to add object: %w", err)
+		}
+	}
+
+	return nil
+}
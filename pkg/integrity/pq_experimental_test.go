@@ -0,0 +1,79 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+//go:build sif_experimental_pq
+// +build sif_experimental_pq
+
+package integrity
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+func TestPQSignVerify(t *testing.T) {
+	key := testPQKey{pub: []byte("public key")}
+
+	tf, err := tempFileFrom(filepath.Join("testdata", "images", "two-groups.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tf.Name())
+
+	f, err := sif.LoadContainerFp(tf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An implementation of the algorithm must be registered to sign.
+	if _, err := NewPQSigner(&f, key); !errors.Is(err, ErrPQAlgorithmUnsupported) {
+		t.Fatalf("got error %v, want %v", err, ErrPQAlgorithmUnsupported)
+	}
+
+	RegisterPQAlgorithm(testPQAlgorithm, verifyTestPQ)
+	defer func() {
+		pqMu.Lock()
+		delete(pqVerifiers, testPQAlgorithm)
+		pqMu.Unlock()
+	}()
+
+	s, err := NewPQSigner(&f, key, OptPQSignGroup(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = sif.LoadContainer(tf.Name(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	v, err := NewPQVerifier(&f, testPQAlgorithm, key.pub, OptPQVerifyGroup(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(); err != nil {
+		t.Error(err)
+	}
+
+	v, err = NewPQVerifier(&f, testPQAlgorithm, key.pub, OptPQVerifyGroup(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v.Verify(), ErrPQSignatureNotFound; !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+}
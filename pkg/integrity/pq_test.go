@@ -0,0 +1,245 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// testPQAlgorithm is a stand-in for a post-quantum signature algorithm, where the signature of a
+// message is the SHA-256 digest of the public key followed by the message.
+const testPQAlgorithm PQAlgorithm = "TEST"
+
+type testPQKey struct {
+	pub []byte
+}
+
+func (k testPQKey) Algorithm() PQAlgorithm { return testPQAlgorithm }
+
+func (k testPQKey) Public() []byte { return k.pub }
+
+func (k testPQKey) Sign(msg []byte) ([]byte, error) {
+	sum := sha256.Sum256(append(append([]byte(nil), k.pub...), msg...))
+	return sum[:], nil
+}
+
+func verifyTestPQ(pub, msg, sig []byte) bool {
+	want, _ := testPQKey{pub}.Sign(msg)
+	return bytes.Equal(sig, want)
+}
+
+// withTestPQ registers an implementation of testPQAlgorithm while fn is called.
+func withTestPQ(fn func()) {
+	pqMu.Lock()
+	pqVerifiers[testPQAlgorithm] = verifyTestPQ
+	pqMu.Unlock()
+
+	defer func() {
+		pqMu.Lock()
+		delete(pqVerifiers, testPQAlgorithm)
+		pqMu.Unlock()
+	}()
+
+	fn()
+}
+
+// testPQEnvelope returns an envelope holding the signature of payload by k.
+func testPQEnvelope(k testPQKey, payload []byte) pqEnvelope {
+	sig, _ := k.Sign(pqSigningInput(testPQAlgorithm, payload))
+	return pqEnvelope{
+		Version:   pqEnvelopeVersion,
+		Algorithm: testPQAlgorithm,
+		KeyID:     pqKeyID(k.pub),
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	}
+}
+
+func TestVerifyPQ(t *testing.T) {
+	key := testPQKey{pub: []byte("public key")}
+	payload := []byte("payload")
+	env := testPQEnvelope(key, payload)
+
+	tests := []struct {
+		name     string
+		env      func(e pqEnvelope) pqEnvelope
+		alg      PQAlgorithm
+		pub      []byte
+		fips     bool
+		register bool
+		wantErr  error
+	}{
+		{name: "OK", alg: testPQAlgorithm, pub: key.pub, register: true},
+		{name: "Unsupported", alg: testPQAlgorithm, pub: key.pub, wantErr: ErrPQAlgorithmUnsupported},
+		{
+			name:     "FIPS",
+			alg:      testPQAlgorithm,
+			pub:      key.pub,
+			fips:     true,
+			register: true,
+			wantErr:  &AlgorithmNotApprovedError{Algorithm: string(testPQAlgorithm)},
+		},
+		{
+			name:     "Version",
+			env:      func(e pqEnvelope) pqEnvelope { e.Version++; return e },
+			alg:      testPQAlgorithm,
+			pub:      key.pub,
+			register: true,
+			wantErr:  errPQEnvelopeInvalid,
+		},
+		{name: "Algorithm", alg: PQAlgorithmMLDSA65, pub: key.pub, register: true, wantErr: errPQKeyMismatch},
+		{name: "Key", alg: testPQAlgorithm, pub: []byte("other key"), register: true, wantErr: errPQKeyMismatch},
+		{
+			name: "Payload",
+			env: func(e pqEnvelope) pqEnvelope {
+				e.Payload = base64.StdEncoding.EncodeToString([]byte("other payload"))
+				return e
+			},
+			alg:      testPQAlgorithm,
+			pub:      key.pub,
+			register: true,
+			wantErr:  errPQSignatureInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			e := env
+			if tt.env != nil {
+				e = tt.env(e)
+			}
+
+			if tt.fips {
+				SetFIPSMode(true)
+				defer SetFIPSMode(false)
+			}
+
+			var b []byte
+			var err error
+			if tt.register {
+				withTestPQ(func() { b, err = verifyPQ(e, tt.alg, tt.pub) })
+			} else {
+				b, err = verifyPQ(e, tt.alg, tt.pub)
+			}
+
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err == nil && !bytes.Equal(b, payload) {
+				t.Errorf("got payload %q, want %q", b, payload)
+			}
+		})
+	}
+}
+
+func TestPQVerifier(t *testing.T) {
+	key := testPQKey{pub: []byte("public key")}
+
+	tests := []struct {
+		name    string
+		sign    bool
+		tamper  bool
+		wantErr error
+	}{
+		{name: "OK", sign: true},
+		{name: "NotSigned", wantErr: ErrPQSignatureNotFound},
+		{name: "ObjectTampered", sign: true, tamper: true, wantErr: &ObjectIntegrityError{}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			f, err := sif.LoadContainerFp(tf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.sign {
+				payload, err := getGroupMetadata(&f, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := json.Marshal(testPQEnvelope(key, payload))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				di := sif.DescriptorInput{
+					Datatype: sif.DataCryptoMessage,
+					Groupid:  sif.DescrUnusedGroup,
+					Link:     sif.DescrGroupMask | 1,
+					Size:     int64(len(b)),
+					Fp:       bytes.NewReader(b),
+				}
+				if err := di.SetCryptoMsgExtra(sif.FormatSigEnvelope, sif.MessagePQSignature); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.AddObject(di); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			od, err := getObject(&f, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			off, _ := od.Extent()
+
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.tamper {
+				tf, err := os.OpenFile(tf.Name(), os.O_RDWR, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := tf.WriteAt([]byte{0xff}, off); err != nil {
+					t.Fatal(err)
+				}
+				tf.Close()
+			}
+
+			f, err = sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			// Without a registered implementation, the algorithm is not supported.
+			if _, err := NewPQVerifier(&f, testPQAlgorithm, key.pub); !errors.Is(err, ErrPQAlgorithmUnsupported) {
+				t.Errorf("got error %v, want %v", err, ErrPQAlgorithmUnsupported)
+			}
+
+			withTestPQ(func() {
+				v, err := NewPQVerifier(&f, testPQAlgorithm, key.pub)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got, want := v.Verify(), tt.wantErr; !errors.Is(got, want) {
+					t.Errorf("got error %v, want %v", got, want)
+				}
+			})
+		})
+	}
+}
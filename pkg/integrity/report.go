@@ -0,0 +1,94 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+// entityName returns the name of the primary identity of e. If no identity is marked primary, the
+// first identity in lexical order is used, so that output is deterministic.
+func entityName(e *openpgp.Entity) string {
+	names := make([]string, 0, len(e.Identities))
+	for name, id := range e.Identities {
+		if id.SelfSignature != nil && id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			return name
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// signerString returns a description of the entity that produced the signature described by r.
+func signerString(r VerifyResult) string {
+	e := r.Entity()
+	if e == nil || e.PrimaryKey == nil {
+		return sif.Message("unknown signer")
+	}
+	if name := entityName(e); name != "" {
+		return fmt.Sprintf("%s (%X)", name, e.PrimaryKey.Fingerprint)
+	}
+	return fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+}
+
+// idsString returns a comma-separated list of ids.
+func idsString(ids []uint32) string {
+	if len(ids) == 0 {
+		return sif.Message("NONE")
+	}
+	s := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s = append(s, strconv.FormatUint(uint64(id), 10))
+	}
+	return strings.Join(s, ", ")
+}
+
+// FmtVerifySummary formats a one-line summary of the verification result r, suitable for
+// presenting to a user as each signature is verified, such as from a VerifyCallback.
+func FmtVerifySummary(r VerifyResult) string {
+	if err := r.Error(); err != nil {
+		return fmt.Sprintf(sif.Message("Signature %d: verification FAILED: %v")+"\n", r.Signature(), err)
+	}
+	return fmt.Sprintf(sif.Message("Signature %d: objects %s verified, signed by %s")+"\n",
+		r.Signature(), idsString(r.Verified()), signerString(r))
+}
+
+// FmtVerifyAudit formats a detailed description of the verification result r, suitable for
+// recording in an audit log.
+func FmtVerifyAudit(r VerifyResult) string {
+	const width = 12
+
+	status := sif.Message("Verified")
+	if r.Error() != nil {
+		status = sif.Message("FAILED")
+	}
+
+	s := fmt.Sprintln(auditLabel("Signature:", width), r.Signature())
+	s += fmt.Sprintln(auditLabel("Status:", width), status)
+	s += fmt.Sprintln(auditLabel("Signer:", width), signerString(r))
+	s += fmt.Sprintln(auditLabel("Signed:", width), idsString(r.Signed()))
+	s += fmt.Sprintln(auditLabel("Verified:", width), idsString(r.Verified()))
+	if err := r.Error(); err != nil {
+		s += fmt.Sprintln(auditLabel("Error:", width), err)
+	}
+	return s
+}
+
+// auditLabel returns the translation of msg, padded with spaces to width runes, for aligning the
+// values that follow it.
+func auditLabel(msg string, width int) string {
+	return fmt.Sprintf("%-*s", width, sif.Message(msg))
+}
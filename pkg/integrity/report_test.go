@@ -0,0 +1,118 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func getTestResults(t *testing.T) []struct {
+	name string
+	r    VerifyResult
+} {
+	e := getTestEntity(t)
+
+	anon := &openpgp.Entity{PrimaryKey: e.PrimaryKey, Identities: map[string]*openpgp.Identity{}}
+
+	im := imageMetadata{Objects: []objectMetadata{{id: 1}, {id: 2}}}
+
+	return []struct {
+		name string
+		r    VerifyResult
+	}{
+		{
+			name: "Verified",
+			r:    result{signature: 3, im: im, verified: []uint32{1, 2}, e: e},
+		},
+		{
+			name: "NoIdentity",
+			r:    result{signature: 3, im: im, verified: []uint32{1, 2}, e: anon},
+		},
+		{
+			name: "ObjectIntegrity",
+			r:    result{signature: 3, im: im, verified: []uint32{1}, e: e, err: &ObjectIntegrityError{ID: 2}},
+		},
+		{
+			name: "UnknownSigner",
+			r:    result{signature: 3, im: im, err: &SignatureNotValidError{ID: 3}},
+		},
+		{
+			name: "Legacy",
+			r: legacyResult{
+				signature: 4,
+				ods:       []*sif.Descriptor{{ID: 1}},
+				e:         e,
+			},
+		},
+	}
+}
+
+func TestFmtVerifySummary(t *testing.T) {
+	for _, tt := range getTestResults(t) {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyGolden(t.Name(), strings.NewReader(FmtVerifySummary(tt.r))); err != nil {
+				t.Fatalf("failed to verify golden: %v", err)
+			}
+		})
+	}
+}
+
+func TestFmtVerifyAudit(t *testing.T) {
+	for _, tt := range getTestResults(t) {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyGolden(t.Name(), strings.NewReader(FmtVerifyAudit(tt.r))); err != nil {
+				t.Fatalf("failed to verify golden: %v", err)
+			}
+		})
+	}
+}
+
+func TestEntityName(t *testing.T) {
+	primary := true
+
+	tests := []struct {
+		name string
+		ids  map[string]*openpgp.Identity
+		want string
+	}{
+		{
+			name: "None",
+			want: "",
+		},
+		{
+			name: "Lexical",
+			ids: map[string]*openpgp.Identity{
+				"b": {SelfSignature: &packet.Signature{}},
+				"a": {SelfSignature: &packet.Signature{}},
+			},
+			want: "a",
+		},
+		{
+			name: "Primary",
+			ids: map[string]*openpgp.Identity{
+				"b": {SelfSignature: &packet.Signature{IsPrimaryId: &primary}},
+				"a": {SelfSignature: &packet.Signature{}},
+			},
+			want: "b",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := entityName(&openpgp.Entity{Identities: tt.ids}), tt.want; got != want {
+				t.Errorf("got name %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -42,6 +42,11 @@ func (r result) Entity() *openpgp.Entity {
 	return r.e
 }
 
+// Role returns the role claimed by the signature, or an empty string if none is claimed.
+func (r result) Role() string {
+	return r.im.Role
+}
+
 // Error returns an error describing the reason verification failed, or nil if verification was
 // successful.
 func (r result) Error() error {
@@ -82,6 +87,11 @@ func (r legacyResult) Entity() *openpgp.Entity {
 	return r.e
 }
 
+// Role returns an empty string, as legacy signatures do not support role claims.
+func (r legacyResult) Role() string {
+	return ""
+}
+
 // Error returns an error describing the reason verification failed, or nil if verification was
 // successful.
 func (r legacyResult) Error() error {
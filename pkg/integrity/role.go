@@ -0,0 +1,155 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+var (
+	errRoleInvalid            = errors.New("role invalid")
+	errRoleLegacy             = errors.New("role claims not supported by legacy signatures")
+	errSignatureNotApplicable = errors.New("signature does not cover objects")
+)
+
+// ErrRoleNotClaimed is the error returned when no valid signature covering an object claims a
+// required role.
+var ErrRoleNotClaimed = errors.New("role not claimed")
+
+// ErrRoleSeparation is the error returned when the roles required of the signatures covering an
+// object are claimed, but not by a distinct entity for each role.
+var ErrRoleSeparation = errors.New("roles not claimed by distinct entities")
+
+// roleRegexp matches valid roles, such as "built-by" or "approved-by-security".
+var roleRegexp = regexp.MustCompile(`^[a-z0-9]+([-._][a-z0-9]+)*$`)
+
+// checkRole returns an error if role is not valid.
+func checkRole(role string) error {
+	if !roleRegexp.MatchString(role) {
+		return fmt.Errorf("%w: %q", errRoleInvalid, role)
+	}
+	return nil
+}
+
+// OptSignWithRole specifies that signature(s) include a claim that the signing entity signs in the
+// specified role, such as "built-by" or "approved-by-security". Roles consist of lower case letters
+// and digits, separated by single hyphens, periods or underscores. A verifier can require roles
+// using OptVerifyRoles, so that, for example, a definition file must be signed both by its author
+// and by a separate reviewer.
+func OptSignWithRole(role string) SignerOpt {
+	return func(s *Signer) error {
+		if err := checkRole(role); err != nil {
+			return err
+		}
+		s.role = role
+		return nil
+	}
+}
+
+// OptVerifyRoles requires that, for each role, a valid signature covering each object verified
+// claims the role. Where more than one role is required, each must be claimed by a different
+// entity, so that no single entity can satisfy separate duties. Role claims are added to
+// signatures using OptSignWithRole. Legacy signatures do not support role claims.
+//
+// Roles are most useful with objects that are signed individually, using OptSignObjects, and
+// verified individually, using OptVerifyObject.
+func OptVerifyRoles(roles ...string) VerifierOpt {
+	return func(v *Verifier) error {
+		for _, role := range roles {
+			if err := checkRole(role); err != nil {
+				return err
+			}
+			if !containsRole(v.roles, role) {
+				v.roles = append(v.roles, role)
+			}
+		}
+		return nil
+	}
+}
+
+// containsRole returns true if roles contains role.
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// covered returns the descriptors in ods of objects covered by im, in the order given.
+func (im imageMetadata) covered(ods []*sif.Descriptor) []*sif.Descriptor {
+	var covered []*sif.Descriptor
+	for _, od := range ods {
+		if _, _, err := im.metadataForObject(od.ID); err == nil {
+			covered = append(covered, od)
+		}
+	}
+	return covered
+}
+
+// roleClaims records, for each object, the fingerprints of the entities claiming each role in
+// valid signatures covering the object.
+type roleClaims map[uint32]map[string][][20]byte
+
+// add records the claim of role by e, in a valid signature covering the objects with the
+// specified ids.
+func (rc roleClaims) add(role string, ids []uint32, e *openpgp.Entity) {
+	if role == "" || e == nil {
+		return
+	}
+
+	for _, id := range ids {
+		if rc[id] == nil {
+			rc[id] = make(map[string][][20]byte)
+		}
+		rc[id][role] = append(rc[id][role], e.PrimaryKey.Fingerprint)
+	}
+}
+
+// check verifies that each of roles is claimed for the object with the specified id, by a
+// distinct entity for each role.
+//
+// If a role is not claimed, an error wrapping ErrRoleNotClaimed is returned. If the roles are not
+// claimed by distinct entities, an error wrapping ErrRoleSeparation is returned.
+func (rc roleClaims) check(id uint32, roles []string) error {
+	for _, role := range roles {
+		if len(rc[id][role]) == 0 {
+			return fmt.Errorf("object %d: %w: %q", id, ErrRoleNotClaimed, role)
+		}
+	}
+
+	if !assignRoles(roles, rc[id], make(map[[20]byte]bool)) {
+		return fmt.Errorf("object %d: %w", id, ErrRoleSeparation)
+	}
+	return nil
+}
+
+// assignRoles returns true if each of roles can be assigned to a distinct entity that claims it,
+// excluding those in used.
+func assignRoles(roles []string, claims map[string][][20]byte, used map[[20]byte]bool) bool {
+	if len(roles) == 0 {
+		return true
+	}
+
+	for _, fp := range claims[roles[0]] {
+		if used[fp] {
+			continue
+		}
+
+		used[fp] = true
+		if assignRoles(roles[1:], claims, used) {
+			return true
+		}
+		used[fp] = false
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestOptSignWithRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		wantErr error
+	}{
+		{"OK", "built-by", nil},
+		{"Separators", "approved-by.security_team", nil},
+		{"Empty", "", errRoleInvalid},
+		{"UpperCase", "Built-By", errRoleInvalid},
+		{"LeadingSeparator", "-built-by", errRoleInvalid},
+		{"RepeatedSeparator", "built--by", errRoleInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var s Signer
+			if got, want := OptSignWithRole(tt.role)(&s), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if tt.wantErr == nil && s.role != tt.role {
+				t.Errorf("got role %q, want %q", s.role, tt.role)
+			}
+		})
+	}
+}
+
+func TestOptVerifyRoles(t *testing.T) {
+	var v Verifier
+	if err := OptVerifyRoles("built-by", "approved-by-security", "built-by")(&v); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v.roles, []string{"built-by", "approved-by-security"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got roles %v, want %v", got, want)
+	}
+
+	if got, want := OptVerifyRoles("Built By")(&v), errRoleInvalid; !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+}
+
+func TestNewVerifier_RolesLegacy(t *testing.T) {
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group-signed-legacy.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	_, err = NewVerifier(&f, OptVerifyLegacy(), OptVerifyRoles("built-by"))
+	if got, want := err, errRoleLegacy; !errors.Is(got, want) {
+		t.Fatalf("got error %v, want %v", got, want)
+	}
+}
+
+func TestVerifier_VerifyRoles(t *testing.T) {
+	e := getTestEntity(t)
+
+	// The test key files hold the same key, so generate a distinct entity.
+	e2, err := openpgp.NewEntity("Reviewer", "", "reviewer@test.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kr := openpgp.EntityList{e, e2}
+
+	// roleSig describes a signature covering an object, claiming a role.
+	type roleSig struct {
+		e    *openpgp.Entity
+		role string
+		id   uint32
+	}
+
+	tests := []struct {
+		name      string
+		sigs      []roleSig
+		roles     []string
+		wantRoles []string // roles reported for object 1, in the order verified
+		wantErr   error
+	}{
+		{
+			name:      "NoRolesRequired",
+			sigs:      []roleSig{{e, "built-by", 1}},
+			wantRoles: []string{"built-by"},
+		},
+		{
+			name:      "Claimed",
+			sigs:      []roleSig{{e, "built-by", 1}},
+			roles:     []string{"built-by"},
+			wantRoles: []string{"built-by"},
+		},
+		{
+			name:      "Separated",
+			sigs:      []roleSig{{e, "built-by", 1}, {e2, "approved-by-security", 1}},
+			roles:     []string{"built-by", "approved-by-security"},
+			wantRoles: []string{"built-by", "approved-by-security"},
+		},
+		{
+			name:      "OtherObjectSkipped",
+			sigs:      []roleSig{{e, "built-by", 1}, {e2, "approved-by-security", 2}},
+			roles:     []string{"built-by"},
+			wantRoles: []string{"built-by"},
+		},
+		{
+			name:    "NotClaimed",
+			sigs:    []roleSig{{e, "built-by", 1}},
+			roles:   []string{"built-by", "approved-by-security"},
+			wantErr: ErrRoleNotClaimed,
+		},
+		{
+			name:    "ClaimedForOtherObject",
+			sigs:    []roleSig{{e, "built-by", 1}, {e2, "approved-by-security", 2}},
+			roles:   []string{"built-by", "approved-by-security"},
+			wantErr: ErrRoleNotClaimed,
+		},
+		{
+			name:    "NotSeparated",
+			sigs:    []roleSig{{e, "built-by", 1}, {e, "approved-by-security", 1}},
+			roles:   []string{"built-by", "approved-by-security"},
+			wantErr: ErrRoleSeparation,
+		},
+		{
+			name: "SeparatedByAssignment",
+			sigs: []roleSig{
+				{e, "built-by", 1},
+				{e, "approved-by-security", 1},
+				{e2, "built-by", 1},
+			},
+			roles:     []string{"built-by", "approved-by-security"},
+			wantRoles: []string{"built-by", "approved-by-security", "built-by"},
+		},
+		{
+			name:    "NotCovered",
+			sigs:    []roleSig{{e, "built-by", 2}},
+			wantErr: &SignatureNotFoundError{ID: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+			tf.Close()
+
+			for _, rs := range tt.sigs {
+				f, err := sif.LoadContainer(tf.Name(), false)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := signImage(t, &f, rs.e, OptSignWithRole(rs.role), OptSignObjects(rs.id)); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := f.UnloadContainer(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f, err := sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			var roles []string
+			cb := func(r VerifyResult) bool {
+				roles = append(roles, r.Role())
+				return false
+			}
+
+			v, err := NewVerifier(&f,
+				OptVerifyWithKeyRing(kr),
+				OptVerifyObject(1),
+				OptVerifyRoles(tt.roles...),
+				OptVerifyCallback(cb),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := v.Verify(), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if tt.wantErr == nil {
+				if got, want := roles, tt.wantRoles; !reflect.DeepEqual(got, want) {
+					t.Errorf("got roles %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
@@ -44,46 +44,39 @@ func insertSorted(s []uint32, vals ...uint32) []uint32 {
 // getObject returns the descriptor in f associated with the object with identifier id. If multiple
 // such objects are found, errMultipleObjectsFound is returned. If no such object is found,
 // errObjectNotFound is returned.
-func getObject(f *sif.FileImage, id uint32) (*sif.Descriptor, error) {
+func getObject(f ImageReader, id uint32) (*sif.Descriptor, error) {
 	if id == 0 {
 		return nil, errInvalidObjectID
 	}
 
-	od, _, err := f.GetFromDescrID(id)
-	switch {
-	case errors.Is(err, sif.ErrMultValues):
-		err = errMultipleObjectsFound
-	case errors.Is(err, sif.ErrNotFound):
-		err = errObjectNotFound
+	ods := getDescriptors(f, sif.WithID(id))
+	switch len(ods) {
+	case 0:
+		return nil, errObjectNotFound
+	case 1:
+		return ods[0], nil
+	default:
+		return nil, errMultipleObjectsFound
 	}
-	return od, err
 }
 
 // getGroupObjects returns all descriptors in f that are contained in the object group with
 // identifier groupID. If no such object group is found, errGroupNotFound is returned.
-func getGroupObjects(f *sif.FileImage, groupID uint32) ([]*sif.Descriptor, error) {
+func getGroupObjects(f ImageReader, groupID uint32) ([]*sif.Descriptor, error) {
 	if groupID == 0 {
 		return nil, errInvalidGroupID
 	}
 
-	ods, _, err := f.GetFromDescr(sif.Descriptor{
-		Groupid: groupID | sif.DescrGroupMask,
-	})
-	if errors.Is(err, sif.ErrNotFound) {
-		err = errGroupNotFound
+	ods := getDescriptors(f, sif.WithGroup(groupID))
+	if len(ods) == 0 {
+		return nil, errGroupNotFound
 	}
-	return ods, err
+	return ods, nil
 }
 
 // getNonGroupObjects returns all descriptors in f that are not contained within an object group.
-func getNonGroupObjects(f *sif.FileImage) ([]*sif.Descriptor, error) {
-	ods, _, err := f.GetFromDescr(sif.Descriptor{
-		Groupid: sif.DescrUnusedGroup,
-	})
-	if errors.Is(err, sif.ErrNotFound) {
-		err = nil
-	}
-	return ods, err
+func getNonGroupObjects(f ImageReader) ([]*sif.Descriptor, error) {
+	return getDescriptors(f, func(d sif.Descriptor) bool { return d.Groupid == sif.DescrUnusedGroup }), nil
 }
 
 // SignatureNotFoundError records an error attempting to locate one or more signatures for a data
@@ -119,39 +112,37 @@ func (e *SignatureNotFoundError) Is(target error) bool {
 // getObjectSignatures returns all descriptors in f that contain signature objects linked to the
 // object with identifier id. If no such signatures are found, a SignatureNotFoundError is
 // returned.
-func getObjectSignatures(f *sif.FileImage, id uint32) ([]*sif.Descriptor, error) {
+func getObjectSignatures(f ImageReader, id uint32) ([]*sif.Descriptor, error) {
 	if id == 0 {
 		return nil, errInvalidObjectID
 	}
 
-	sigs, _, err := f.GetLinkedDescrsByType(id, sif.DataSignature)
-	if errors.Is(err, sif.ErrNotFound) {
-		err = &SignatureNotFoundError{ID: id}
+	sigs := getDescriptors(f, sif.WithLinkedID(id), sif.WithDataType(sif.DataSignature))
+	if len(sigs) == 0 {
+		return nil, &SignatureNotFoundError{ID: id}
 	}
-	return sigs, err
+	return sigs, nil
 }
 
 // getGroupSignatures returns descriptors in f that contain signature objects linked to the object
 // group with identifier groupID. If legacy is true, only legacy signatures are considered.
 // Otherwise, only non-legacy signatures are considered. If no such signatures are found, a
 // SignatureNotFoundError is returned.
-func getGroupSignatures(f *sif.FileImage, groupID uint32, legacy bool) ([]*sif.Descriptor, error) {
+func getGroupSignatures(f ImageReader, groupID uint32, legacy bool) ([]*sif.Descriptor, error) {
 	if groupID == 0 {
 		return nil, errInvalidGroupID
 	}
 
 	// Get list of signature blocks linked to group.
-	ods, _, err := f.GetLinkedDescrsByType(groupID|sif.DescrGroupMask, sif.DataSignature)
-	if errors.Is(err, sif.ErrNotFound) {
+	ods := getDescriptors(f, sif.WithLinkedGroup(groupID), sif.WithDataType(sif.DataSignature))
+	if len(ods) == 0 {
 		return nil, &SignatureNotFoundError{IsGroup: true, ID: groupID}
-	} else if err != nil {
-		return nil, err
 	}
 
 	// Filter signatures based on legacy flag.
 	sigs := make([]*sif.Descriptor, 0, len(ods))
 	for _, od := range ods {
-		isLegacy, err := isLegacySignature(od.GetData(f))
+		isLegacy, err := isLegacySignature(readObject(f, od))
 		if err != nil {
 			return nil, err
 		}
@@ -164,13 +155,13 @@ func getGroupSignatures(f *sif.FileImage, groupID uint32, legacy bool) ([]*sif.D
 		return nil, &SignatureNotFoundError{IsGroup: true, ID: groupID}
 	}
 
-	return sigs, err
+	return sigs, nil
 }
 
 // getGroupMinObjectID returns the minimum ID from the set of descriptors in f that are contained
 // in the object group with identifier groupID. If no such object group is found, errGroupNotFound
 // is returned.
-func getGroupMinObjectID(f *sif.FileImage, groupID uint32) (uint32, error) {
+func getGroupMinObjectID(f ImageReader, groupID uint32) (uint32, error) {
 	ods, err := getGroupObjects(f, groupID)
 	if err != nil {
 		return 0, err
@@ -187,11 +178,8 @@ func getGroupMinObjectID(f *sif.FileImage, groupID uint32) (uint32, error) {
 
 // getGroupIDs returns all identifiers for the groups contained in f, sorted by ID. If no groups
 // are present, errNoGroupsFound is returned.
-func getGroupIDs(f *sif.FileImage) (groupIDs []uint32, err error) {
-	for _, od := range f.DescrArr {
-		if !od.Used {
-			continue
-		}
+func getGroupIDs(f ImageReader) (groupIDs []uint32, err error) {
+	for _, od := range f.GetDescriptors() {
 		if od.Groupid == sif.DescrUnusedGroup {
 			continue
 		}
@@ -7,6 +7,7 @@ package integrity
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"encoding/hex"
 	"errors"
@@ -22,6 +23,10 @@ var (
 	errNoObjectsSpecified = errors.New("no objects specified")
 	errUnexpectedGroupID  = errors.New("unexpected group ID")
 	errNilFileImage       = errors.New("nil file image")
+	errIdentityNameEmpty  = errors.New("identity name empty")
+	errEpochZero          = errors.New("epoch must be non-zero")
+	errSignerKeyMismatch  = errors.New("signer does not correspond to public key")
+	errIncrementalVersion = errors.New("incremental signing requires metadata version 4")
 )
 
 // ErrNoKeyMaterial is the error returned when no key material was provided.
@@ -48,8 +53,15 @@ type groupSigner struct {
 	id        uint32            // Group ID.
 	ods       []*sif.Descriptor // Descriptors of object(s) to sign.
 	mdHash    crypto.Hash       // Hash type for metadata.
+	mdVersion mdVersion         // Metadata version.
 	sigConfig *packet.Config    // Configuration for signature.
 	sigHash   sif.Hashtype      // SIF hash type for signature.
+	identity  *identityMetadata // Identity claim, if any.
+	epoch     uint64            // Epoch claim, if non-zero.
+	role      string            // Role claim, if any.
+	extend    bool              // If true, extend the prior signature made by the signing entity.
+	digests   map[uint32]digest // Precomputed digests of object data, by object ID.
+	parallel  int               // Number of objects to hash concurrently.
 }
 
 // groupSignerOpt are used to configure gs.
@@ -102,9 +114,10 @@ func optSignGroupSignatureConfig(c *packet.Config) groupSignerOpt {
 // use optSignGroupSignatureConfig().
 func newGroupSigner(f *sif.FileImage, groupID uint32, opts ...groupSignerOpt) (*groupSigner, error) {
 	gs := groupSigner{
-		f:      f,
-		id:     groupID,
-		mdHash: crypto.SHA256,
+		f:         f,
+		id:        groupID,
+		mdHash:    crypto.SHA256,
+		mdVersion: metadataVersion4,
 	}
 
 	// Apply options.
@@ -160,15 +173,32 @@ func (gs *groupSigner) signWithEntity(e *openpgp.Entity) (sif.DescriptorInput, e
 		return sif.DescriptorInput{}, err
 	}
 
+	// If extending a prior signature, sign only the objects it does not cover.
+	ods := gs.ods
+	var prior *priorMetadata
+	if gs.extend {
+		if prior, ods, err = gs.priorSignature(e); err != nil {
+			return sif.DescriptorInput{}, err
+		}
+	}
+
 	// Get metadata for the image.
-	md, err := getImageMetadata(gs.f, minID, gs.ods, gs.mdHash)
+	md, err := getImageMetadata(gs.f, minID, ods, gs.mdHash, gs.mdVersion, gs.objectDigests(ods))
 	if err != nil {
 		return sif.DescriptorInput{}, fmt.Errorf("failed to get image metadata: %w", err)
 	}
+	md.Identity = gs.identity
+	md.Epoch = gs.epoch
+	md.Role = gs.role
+	md.Prior = prior
 
 	// Sign and encode image metadata.
+	enc, err := md.encode()
+	if err != nil {
+		return sif.DescriptorInput{}, fmt.Errorf("failed to encode image metadata: %w", err)
+	}
 	b := bytes.Buffer{}
-	if err := signAndEncodeJSON(&b, md, e.PrivateKey, gs.sigConfig); err != nil {
+	if err := signAndEncode(&b, enc, e.PrivateKey, gs.sigConfig); err != nil {
 		return sif.DescriptorInput{}, fmt.Errorf("failed to encode signature: %w", err)
 	}
 
@@ -187,11 +217,24 @@ func (gs *groupSigner) signWithEntity(e *openpgp.Entity) (sif.DescriptorInput, e
 	return di, nil
 }
 
+// PassphraseCallback is called to obtain the passphrase needed to decrypt the private key of
+// entity e, such as by prompting the user or querying an agent.
+type PassphraseCallback func(e *openpgp.Entity) ([]byte, error)
+
 // Signer describes a SIF image signer.
 type Signer struct {
-	f       *sif.FileImage  // SIF image to sign.
-	signers []*groupSigner  // Signer for each group.
-	e       *openpgp.Entity // Entity to use to generate signature(s).
+	f         *sif.FileImage     // SIF image to sign.
+	signers   []*groupSigner     // Signer for each group.
+	e         *openpgp.Entity    // Entity to use to generate signature(s).
+	identity  *identityMetadata  // Identity claim to include in signature(s).
+	epoch     uint64             // Epoch claim to include in signature(s).
+	role      string             // Role claim to include in signature(s).
+	extend    bool               // Extend prior signature(s) rather than replacing them.
+	passCB    PassphraseCallback // Callback to obtain passphrase for encrypted private key.
+	digests   map[uint32]digest  // Precomputed digests of object data, by object ID.
+	version   mdVersion          // Metadata version, if not the latest.
+	apptainer bool               // Generate signature(s) that verify in Apptainer.
+	parallel  int                // Number of objects to hash concurrently.
 }
 
 // SignerOpt are used to configure s.
@@ -205,6 +248,117 @@ func OptSignWithEntity(e *openpgp.Entity) SignerOpt {
 	}
 }
 
+// OptSignWithSigner specifies that signature(s) be generated by signer, which holds the private
+// key corresponding to the PGP public key pub. This allows signing to be delegated to a backend
+// such as a hardware token or key agent, so that private key material never enters the process.
+//
+// Only RSA and ECDSA keys are supported.
+func OptSignWithSigner(pub *packet.PublicKey, signer crypto.Signer) SignerOpt {
+	return func(s *Signer) error {
+		if k, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); ok && !k.Equal(pub.PublicKey) {
+			return errSignerKeyMismatch
+		}
+
+		s.e = &openpgp.Entity{
+			PrimaryKey: pub,
+			PrivateKey: &packet.PrivateKey{PublicKey: *pub, PrivateKey: signer},
+		}
+		return nil
+	}
+}
+
+// OptSignWithPassphraseCallback registers cb as the callback used to obtain a passphrase when the
+// private key of the signing entity is encrypted. The decrypted key is held only for the duration
+// of Sign, and the entity supplied by the caller is not modified.
+func OptSignWithPassphraseCallback(cb PassphraseCallback) SignerOpt {
+	return func(s *Signer) error {
+		s.passCB = cb
+		return nil
+	}
+}
+
+// OptSignWithIdentity specifies that signature(s) include a claim binding the image to the
+// human-readable name (such as "user/collection/image:tag"), and optionally the URI from which the
+// image is expected to be retrieved (such as "library://user/collection/image:tag"). A verifier
+// can check the claim using OptVerifyIdentity, to detect substitution of one image signed by a
+// trusted entity for another.
+func OptSignWithIdentity(name, uri string) SignerOpt {
+	return func(s *Signer) error {
+		if name == "" {
+			return errIdentityNameEmpty
+		}
+		s.identity = &identityMetadata{Name: name, URI: uri}
+		return nil
+	}
+}
+
+// OptSignWithEpoch specifies that signature(s) include a claim that the image is of the specified
+// epoch, such as a release number or build timestamp, which must be non-zero. Each image published
+// under an identity should claim an epoch greater than or equal to that of its predecessor. A
+// verifier can check the claim using OptVerifyMinEpoch, to detect an older image being served in
+// place of a newer one.
+func OptSignWithEpoch(epoch uint64) SignerOpt {
+	return func(s *Signer) error {
+		if epoch == 0 {
+			return errEpochZero
+		}
+		s.epoch = epoch
+		return nil
+	}
+}
+
+// OptSignMetadataVersion specifies that signature(s) be generated using metadata of version v,
+// rather than the latest version. Version 1 metadata is understood by all implementations that
+// support non-legacy signatures, including those that predate canonical encoding, such as the
+// Apptainer fork of this module, but does not protect the arch and creation time of the image, or
+// the group membership and order of objects. Versions 1 through 4 are supported. Incremental
+// signing requires version 4.
+func OptSignMetadataVersion(v int) SignerOpt {
+	return func(s *Signer) error {
+		if v < int(metadataVersion1) || v > int(metadataVersion4) {
+			return fmt.Errorf("%w: %v", errMetadataVersionUnsupported, v)
+		}
+		s.version = mdVersion(v)
+		return nil
+	}
+}
+
+// OptSignIncremental specifies that, where the signing entity has already signed an object group,
+// the new signature extends the most recent such signature rather than replacing it. Only the
+// objects not covered by the prior signature are hashed, along with a reference to the prior
+// signature, so objects appended to a large image that is already signed can be signed without
+// hashing the image again. The verifier checks the prior signature along with the new one, and
+// treats them as a single signature covering the objects of both.
+//
+// Where the signing entity has not signed an object group, a complete signature is added. Where
+// the prior signature covers all objects to be signed, Sign returns an error.
+func OptSignIncremental() SignerOpt {
+	return func(s *Signer) error {
+		s.extend = true
+		return nil
+	}
+}
+
+// OptSignObjectDigest specifies value as the digest of the data of the object with the specified
+// id, calculated using hash function h, so that the data need not be read again when signing. The
+// digest may be obtained as the object is added to the image, using the Hashes field of
+// sif.DescriptorInput. The caller is responsible for ensuring the digest matches the data of the
+// object; a mismatch is not detected until the signature is verified. The digest is used only
+// where h is the hash function used for signature metadata, which is SHA-256.
+func OptSignObjectDigest(id uint32, h crypto.Hash, value []byte) SignerOpt {
+	return func(s *Signer) error {
+		d, err := newDigest(h, value)
+		if err != nil {
+			return err
+		}
+		if s.digests == nil {
+			s.digests = make(map[uint32]digest)
+		}
+		s.digests[id] = d
+		return nil
+	}
+}
+
 // OptSignGroup specifies that a signature be applied to cover all objects in the group with the
 // specified groupID. This may be called multiple times to add multiple group signatures.
 func OptSignGroup(groupID uint32) SignerOpt {
@@ -304,25 +458,89 @@ func NewSigner(f *sif.FileImage, opts ...SignerOpt) (*Signer, error) {
 		}
 	}
 
+	if s.apptainer {
+		if err := s.checkApptainerCompat(); err != nil {
+			return nil, fmt.Errorf("integrity: %w", err)
+		}
+	}
+
+	if s.extend && s.version != 0 && s.version < metadataVersion4 {
+		return nil, fmt.Errorf("integrity: %w", errIncrementalVersion)
+	}
+
+	// Apply identity, epoch and role claims, incremental signing, precomputed digests, parallelism
+	// and the metadata version, to all signers, regardless of the order options were supplied in.
+	for _, gs := range s.signers {
+		gs.identity = s.identity
+		gs.epoch = s.epoch
+		gs.role = s.role
+		gs.extend = s.extend
+		gs.digests = s.digests
+		gs.parallel = s.parallel
+		if s.version != 0 {
+			gs.mdVersion = s.version
+		}
+	}
+
 	return &s, nil
 }
 
+// decryptedEntity returns a copy of the signing entity with a decrypted private key. If the
+// private key is encrypted, the passphrase callback is used to obtain the passphrase.
+func (s *Signer) decryptedEntity() (*openpgp.Entity, error) {
+	if s.e.PrivateKey == nil || !s.e.PrivateKey.Encrypted || s.passCB == nil {
+		return s.e, nil
+	}
+
+	passphrase, err := s.passCB(s.e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain passphrase: %w", err)
+	}
+
+	// Decrypt a copy of the key, so the caller's entity remains encrypted.
+	pk := *s.e.PrivateKey
+	if err := pk.Decrypt(passphrase); err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+
+	e := *s.e
+	e.PrivateKey = &pk
+	return &e, nil
+}
+
 // Sign adds digital signatures as specified by s.
 //
 // If key material was not provided when s was created, Sign returns an error wrapping
-// ErrNoKeyMaterial.
+// ErrNoKeyMaterial. If the private key is encrypted, the callback registered with
+// OptSignWithPassphraseCallback is used to obtain the passphrase required to decrypt it.
 func (s *Signer) Sign() error {
+	return s.SignContext(context.Background())
+}
+
+// SignContext is like Sign, but stops once ctx is done, returning an error wrapping the error of
+// ctx. The context is checked before each signature is generated, and while each is added to the
+// image. Signatures already added to the image are kept.
+func (s *Signer) SignContext(ctx context.Context) error {
 	if s.e == nil {
 		return fmt.Errorf("integrity: %w", ErrNoKeyMaterial)
 	}
 
+	e, err := s.decryptedEntity()
+	if err != nil {
+		return fmt.Errorf("integrity: %w", err)
+	}
+
 	for _, gs := range s.signers {
-		di, err := gs.signWithEntity(s.e)
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("integrity: %w", err)
+		}
+
+		di, err := gs.signWithEntity(e)
 		if err != nil {
 			return fmt.Errorf("integrity: %w", err)
 		}
 
-		if err := s.f.AddObject(di); err != nil {
+		if err := s.f.AddObjectContext(ctx, di); err != nil {
 			return fmt.Errorf("integrity: failed to add object: %w", err)
 		}
 	}
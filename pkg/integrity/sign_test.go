@@ -6,8 +6,13 @@
 package integrity
 
 import (
+	"context"
 	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"errors"
+	"hash"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -15,6 +20,7 @@ import (
 
 	"github.com/sylabs/sif/pkg/sif"
 	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
 	"golang.org/x/crypto/openpgp/packet"
 )
 
@@ -346,6 +352,7 @@ func TestGroupSigner_SignWithEntity(t *testing.T) {
 				id:        1,
 				ods:       []*sif.Descriptor{d1},
 				mdHash:    crypto.MD4,
+				mdVersion: metadataVersion4,
 				sigConfig: &config,
 			},
 			e:       e,
@@ -358,6 +365,7 @@ func TestGroupSigner_SignWithEntity(t *testing.T) {
 				id:        1,
 				ods:       []*sif.Descriptor{d1},
 				mdHash:    crypto.SHA1,
+				mdVersion: metadataVersion4,
 				sigConfig: &config,
 			},
 			e:       encrypted,
@@ -370,6 +378,7 @@ func TestGroupSigner_SignWithEntity(t *testing.T) {
 				id:        1,
 				ods:       []*sif.Descriptor{d1},
 				mdHash:    crypto.SHA1,
+				mdVersion: metadataVersion4,
 				sigConfig: &config,
 			},
 			e: e,
@@ -381,6 +390,7 @@ func TestGroupSigner_SignWithEntity(t *testing.T) {
 				id:        1,
 				ods:       []*sif.Descriptor{d2},
 				mdHash:    crypto.SHA1,
+				mdVersion: metadataVersion4,
 				sigConfig: &config,
 			},
 			e: e,
@@ -392,6 +402,19 @@ func TestGroupSigner_SignWithEntity(t *testing.T) {
 				id:        1,
 				ods:       []*sif.Descriptor{d1, d2},
 				mdHash:    crypto.SHA1,
+				mdVersion: metadataVersion4,
+				sigConfig: &config,
+			},
+			e: e,
+		},
+		{
+			name: "Group1Version1",
+			gs: groupSigner{
+				f:         &twoGroups,
+				id:        1,
+				ods:       []*sif.Descriptor{d1, d2},
+				mdHash:    crypto.SHA1,
+				mdVersion: metadataVersion1,
 				sigConfig: &config,
 			},
 			e: e,
@@ -403,6 +426,7 @@ func TestGroupSigner_SignWithEntity(t *testing.T) {
 				id:        2,
 				ods:       []*sif.Descriptor{d3},
 				mdHash:    crypto.SHA1,
+				mdVersion: metadataVersion4,
 				sigConfig: &config,
 			},
 			e: e,
@@ -641,6 +665,24 @@ func TestNewSigner(t *testing.T) {
 			opts:    []SignerOpt{OptSignObjects(0)},
 			wantErr: errInvalidObjectID,
 		},
+		{
+			name:    "EpochZero",
+			fi:      &oneGroupImage,
+			opts:    []SignerOpt{OptSignWithEpoch(0)},
+			wantErr: errEpochZero,
+		},
+		{
+			name:    "MetadataVersionUnsupported",
+			fi:      &oneGroupImage,
+			opts:    []SignerOpt{OptSignMetadataVersion(5)},
+			wantErr: errMetadataVersionUnsupported,
+		},
+		{
+			name:    "IncrementalVersion1",
+			fi:      &oneGroupImage,
+			opts:    []SignerOpt{OptSignIncremental(), OptSignMetadataVersion(1)},
+			wantErr: errIncrementalVersion,
+		},
 		{
 			name:             "OneGroupDefaultObjects",
 			fi:               &oneGroupImage,
@@ -829,3 +871,297 @@ func TestSigner_Sign(t *testing.T) {
 		})
 	}
 }
+
+func TestSigner_SignPassphraseCallback(t *testing.T) {
+	e := getTestEntity(t)
+
+	errPrompt := errors.New("prompt failed")
+
+	tests := []struct {
+		name    string
+		cb      PassphraseCallback
+		wantErr error
+	}{
+		{
+			name:    "NoCallback",
+			wantErr: pgperrors.InvalidArgumentError("signing key A20C27EE7FF7BA84 is encrypted"),
+		},
+		{
+			name:    "CallbackError",
+			cb:      func(*openpgp.Entity) ([]byte, error) { return nil, errPrompt },
+			wantErr: errPrompt,
+		},
+		{
+			name:    "WrongPassphrase",
+			cb:      func(*openpgp.Entity) ([]byte, error) { return []byte("wrong"), nil },
+			wantErr: pgperrors.StructuralError("private key checksum failure"),
+		},
+		{
+			name: "OK",
+			cb: func(e *openpgp.Entity) ([]byte, error) {
+				if _, ok := e.Identities["Unit Test <unit@test.com>"]; !ok {
+					t.Errorf("unexpected entity %v", e.Identities)
+				}
+				return []byte("test"), nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted := getTestEncryptedEntity(t)
+
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			f, err := sif.LoadContainerFp(tf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSigner(&f, OptSignWithEntity(encrypted), OptSignWithPassphraseCallback(tt.cb))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := s.Sign(), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			// The caller's entity must not be decrypted as a side effect.
+			if !encrypted.PrivateKey.Encrypted {
+				t.Error("private key of entity was decrypted")
+			}
+
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr == nil {
+				f, err := sif.LoadContainer(tf.Name(), true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.UnloadContainer() // nolint:errcheck
+
+				v, err := NewVerifier(&f, OptVerifyWithKeyRing(openpgp.EntityList{e}))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := v.Verify(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// opaqueSigner hides the concrete type of a crypto.Signer, as is the case for signers backed by
+// hardware tokens or key agents.
+type opaqueSigner struct{ crypto.Signer }
+
+func TestSigner_SignWithSigner(t *testing.T) {
+	e := getTestEntity(t)
+
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		signer  crypto.Signer
+		wantErr error
+	}{
+		{
+			name:    "KeyMismatch",
+			signer:  opaqueSigner{other},
+			wantErr: errSignerKeyMismatch,
+		},
+		{
+			name:   "OK",
+			signer: opaqueSigner{e.PrivateKey.PrivateKey.(crypto.Signer)},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			f, err := sif.LoadContainerFp(tf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSigner(&f, OptSignWithSigner(e.PrimaryKey, tt.signer))
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if err == nil {
+				if err := s.Sign(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr == nil {
+				f, err := sif.LoadContainer(tf.Name(), true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.UnloadContainer() // nolint:errcheck
+
+				v, err := NewVerifier(&f, OptVerifyWithKeyRing(openpgp.EntityList{e}))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := v.Verify(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSigner_SignContext(t *testing.T) {
+	tf, err := tempFileFrom(filepath.Join("testdata", "images", "two-groups.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tf.Name())
+
+	f, err := sif.LoadContainerFp(tf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	s, err := NewSigner(&f, OptSignWithEntity(getTestEntity(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if got, want := s.SignContext(ctx), context.Canceled; !errors.Is(got, want) {
+		t.Fatalf("got error %v, want %v", got, want)
+	}
+	if _, _, err := f.GetLinkedDescrsByType(sif.DescrGroupMask|1, sif.DataSignature); err == nil {
+		t.Error("signature added after cancellation")
+	}
+
+	if err := s.SignContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSigner_SignObjectDigest(t *testing.T) {
+	e := getTestEntity(t)
+
+	sum := func(s string) []byte {
+		b := sha256.Sum256([]byte(s))
+		return b[:]
+	}
+
+	tests := []struct {
+		name        string
+		h           crypto.Hash
+		value       []byte // if nil, the digest computed while adding the object is used
+		wantSignErr error
+		wantErr     error
+	}{
+		{name: "AddTime", h: crypto.SHA256},
+		{name: "Mismatch", h: crypto.SHA256, value: sum("other"), wantErr: &ObjectIntegrityError{ID: 3}},
+		{name: "OtherHash", h: crypto.SHA512, value: make([]byte, crypto.SHA512.Size())},
+		{name: "Malformed", h: crypto.SHA256, value: []byte{1}, wantSignErr: errDigestMalformed},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+			tf.Close()
+
+			f, err := sif.LoadContainer(tf.Name(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h := sha256.New()
+			di := sif.DescriptorInput{
+				Datatype: sif.DataGeneric,
+				Groupid:  sif.DescrGroupMask | 1,
+				Link:     sif.DescrUnusedLink,
+				Size:     8,
+				Fname:    "appended",
+				Data:     []byte("appended"),
+				Hashes:   []hash.Hash{h},
+			}
+			if err := f.AddObject(di); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			value := tt.value
+			if value == nil {
+				value = h.Sum(nil)
+			}
+
+			f, err = sif.LoadContainer(tf.Name(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSigner(&f, OptSignWithEntity(e), OptSignObjectDigest(3, tt.h, value))
+			if got, want := err, tt.wantSignErr; !errors.Is(got, want) {
+				f.UnloadContainer() // nolint:errcheck
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				f.UnloadContainer() // nolint:errcheck
+				return
+			}
+			if err := s.Sign(); err != nil {
+				f.UnloadContainer() // nolint:errcheck
+				t.Fatal(err)
+			}
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err = sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			v, err := NewVerifier(&f, OptVerifyWithKeyRing(openpgp.EntityList{e}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := v.Verify(), tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
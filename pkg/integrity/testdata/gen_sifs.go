@@ -105,6 +105,18 @@ func generateImages() error {
 				partPrimSysGroup1,
 			},
 			sign: true,
+			signOpts: []integrity.SignerOpt{
+				integrity.OptSignWithEntity(e),
+				integrity.OptSignMetadataVersion(1),
+			},
+		},
+		{
+			path: "one-group-signed-v4.sif",
+			dis: []sif.DescriptorInput{
+				partSystemGroup1,
+				partPrimSysGroup1,
+			},
+			sign: true,
 			signOpts: []integrity.SignerOpt{
 				integrity.OptSignWithEntity(e),
 			},
@@ -127,6 +139,19 @@ func generateImages() error {
 				partSystemGroup2,
 			},
 			sign: true,
+			signOpts: []integrity.SignerOpt{
+				integrity.OptSignWithEntity(e),
+				integrity.OptSignMetadataVersion(1),
+			},
+		},
+		{
+			path: "two-groups-signed-v4.sif",
+			dis: []sif.DescriptorInput{
+				partSystemGroup1,
+				partPrimSysGroup1,
+				partSystemGroup2,
+			},
+			sign: true,
 			signOpts: []integrity.SignerOpt{
 				integrity.OptSignWithEntity(e),
 			},
@@ -0,0 +1,70 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"errors"
+	"io"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+var errNilURing = errors.New("nil io_uring")
+
+// OptVerifyWithURing specifies that the data of objects be read using u when they are hashed,
+// rather than through the image. This keeps several reads in flight per object, which can improve
+// throughput where reading is bound by system call overhead. u must have been created with
+// sif.NewURing for the image being verified, and should not be closed until verification is
+// complete. Where sif.NewURing returns an error wrapping sif.ErrURingUnsupported, this option
+// should be omitted.
+func OptVerifyWithURing(u *sif.URing) VerifierOpt {
+	return func(v *Verifier) error {
+		if u == nil {
+			return errNilURing
+		}
+		v.uring = u
+		return nil
+	}
+}
+
+// uringImage is an ImageReader that reads the data of objects in full using io_uring.
+type uringImage struct {
+	ImageReader
+	u *sif.URing
+}
+
+// GetObjectReadSeeker returns an io.ReadSeeker that reads the data object associated with
+// descriptor d, as stored in the image. When the object is copied from its start, as when it is
+// hashed, it is read using io_uring.
+func (f uringImage) GetObjectReadSeeker(d sif.Descriptor) io.ReadSeeker {
+	return &uringObjectReader{ReadSeeker: f.ImageReader.GetObjectReadSeeker(d), u: f.u, d: d}
+}
+
+// uringObjectReader reads a data object through the image, other than when it is copied by
+// io.Copy from its start.
+type uringObjectReader struct {
+	io.ReadSeeker
+	u *sif.URing
+	d sif.Descriptor
+}
+
+// WriteTo writes the remainder of the data object to w. If nothing has been read yet, the object
+// is read using io_uring.
+func (r *uringObjectReader) WriteTo(w io.Writer) (int64, error) {
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if pos != 0 {
+		return io.Copy(w, r.ReadSeeker)
+	}
+
+	n, err := r.u.CopyObject(w, &r.d)
+	if _, serr := r.Seek(n, io.SeekStart); err == nil {
+		err = serr
+	}
+	return n, err
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestOptVerifyWithURing(t *testing.T) {
+	kr := openpgp.EntityList{getTestEntity(t)}
+
+	if _, err := NewVerifier(&sif.FileImage{}, OptVerifyWithURing(nil)); !errors.Is(err, errNilURing) {
+		t.Fatalf("got error %v, want %v", err, errNilURing)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		corrupt bool
+		wantErr error
+	}{
+		{name: "OneGroup", path: "one-group-signed.sif"},
+		{name: "TwoGroups", path: "two-groups-signed-v4.sif"},
+		{name: "Corrupt", path: "one-group-signed.sif", corrupt: true, wantErr: &ObjectIntegrityError{ID: 1}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", tt.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+			defer tf.Close()
+
+			f, err := sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			if tt.corrupt {
+				d, _, err := f.GetFromDescrID(1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := tf.WriteAt([]byte{0xff}, d.Fileoff); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			u, err := sif.NewURing(&f, 2, 64)
+			if errors.Is(err, sif.ErrURingUnsupported) {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer u.Close() // nolint:errcheck
+
+			v, err := NewVerifier(&f, OptVerifyWithKeyRing(kr), OptVerifyWithURing(u))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := v.Verify(), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestURingObjectReader(t *testing.T) {
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	u, err := sif.NewURing(&f, 2, 64)
+	if errors.Is(err, sif.ErrURingUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close() // nolint:errcheck
+
+	ui := uringImage{ImageReader: &f, u: u}
+
+	for _, od := range f.GetDescriptors() {
+		od := od
+		t.Run(od.GetName(), func(t *testing.T) {
+			want, err := ioutil.ReadAll(f.GetObjectReadSeeker(od))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Copied from the start, the object is read using io_uring.
+			r := ui.GetObjectReadSeeker(od)
+
+			var b bytes.Buffer
+			if _, err := io.Copy(&b, r); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b.Bytes(), want) {
+				t.Error("data does not match")
+			}
+
+			// The reader is left at the end of the object.
+			if pos, err := r.Seek(0, io.SeekCurrent); err != nil {
+				t.Fatal(err)
+			} else if got, want := pos, int64(len(want)); got != want {
+				t.Errorf("got offset %v, want %v", got, want)
+			}
+
+			// Copied after a partial read, the remainder is read through the image.
+			r = ui.GetObjectReadSeeker(od)
+			if _, err := r.Read(make([]byte, 1)); err != nil {
+				t.Fatal(err)
+			}
+
+			b.Reset()
+			if _, err := io.Copy(&b, r); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b.Bytes(), want[1:]) {
+				t.Error("remaining data does not match")
+			}
+		})
+	}
+}
@@ -7,11 +7,13 @@ package integrity
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/sylabs/sif/pkg/sif"
 	"golang.org/x/crypto/openpgp"
@@ -20,8 +22,15 @@ import (
 var (
 	errFingerprintMismatch = errors.New("fingerprint in descriptor does not correspond to signing entity")
 	errNonGroupedObject    = errors.New("non-signature object not associated with object group")
+	errIdentityLegacy      = errors.New("identity claims not supported by legacy signatures")
+	errEpochLegacy         = errors.New("epoch claims not supported by legacy signatures")
+	errTimeBudgetInvalid   = errors.New("time budget must be positive")
 )
 
+// ErrVerifyIncomplete is the error returned when verification stops before all tasks are
+// complete, because the time budget set with OptVerifyTimeBudget is exhausted.
+var ErrVerifyIncomplete = errors.New("verification incomplete")
+
 // SignatureNotValidError records an error when an invalid signature is encountered.
 type SignatureNotValidError struct {
 	ID  uint32 // Signature object ID.
@@ -71,6 +80,9 @@ type VerifyResult interface {
 	// Entity returns the signing entity, or nil if the signing entity could not be determined.
 	Entity() *openpgp.Entity
 
+	// Role returns the role claimed by the signature, or an empty string if none is claimed.
+	Role() string
+
 	// Error returns an error describing the reason verification failed, or nil if verification was
 	// successful.
 	Error() error
@@ -82,16 +94,23 @@ type VerifyResult interface {
 type VerifyCallback func(r VerifyResult) (ignoreError bool)
 
 type groupVerifier struct {
-	f        *sif.FileImage    // SIF image to verify.
+	f        ImageReader       // SIF image to verify.
 	cb       VerifyCallback    // Verification callback.
 	groupID  uint32            // Object group ID.
 	ods      []*sif.Descriptor // Object descriptors.
 	subsetOK bool              // If true, permit ods to be a subset of the objects in signatures.
+	identity *identityMetadata // If not nil, identity that signatures must claim.
+	minEpoch uint64            // Minimum epoch that signatures must claim.
+	roles    []string          // Roles that signatures covering each object must claim.
+	prior    *Manifest         // If not nil, objects verified previously.
+	parallel int               // Number of objects to hash concurrently.
+
+	seen []VerifiedObject // Objects verified by the most recent verification.
 }
 
 // newGroupVerifier constructs a new group verifier, optionally limited to objects described by
 // ods. If no descriptors are supplied, verify all objects in group.
-func newGroupVerifier(f *sif.FileImage, cb VerifyCallback, groupID uint32, ods ...*sif.Descriptor) (*groupVerifier, error) { // nolint:lll
+func newGroupVerifier(f ImageReader, cb VerifyCallback, groupID uint32, ods ...*sif.Descriptor) (*groupVerifier, error) { // nolint:lll
 	v := groupVerifier{f: f, cb: cb, groupID: groupID, ods: ods}
 
 	if len(ods) == 0 {
@@ -127,39 +146,38 @@ func (v *groupVerifier) fingerprints() ([][20]byte, error) {
 // of a data object descriptor fails, a DescriptorIntegrityError is returned. If verification of a
 // data object fails, a ObjectIntegrityError is returned.
 func (v *groupVerifier) verifySignature(sig *sif.Descriptor, kr openpgp.KeyRing) (imageMetadata, []uint32, *openpgp.Entity, error) { // nolint:lll
-	// Verify signature and decode image metadata.
-	var im imageMetadata
-	e, _, err := verifyAndDecodeJSON(sig.GetData(v.f), &im, kr)
+	// Verify signature and decode image metadata, including that of any prior signature.
+	im, e, err := v.decodeSignature(sig, kr)
 	if err != nil {
-		return im, nil, e, &SignatureNotValidError{ID: sig.ID, Err: err}
+		return im, nil, e, err
 	}
 
-	// Get minimum object ID in group, and use this to populate absolute object IDs in im.
-	minID, err := getGroupMinObjectID(v.f, v.groupID)
-	if err != nil {
-		return im, nil, e, err
+	// Ensure identity claim matches, if requested.
+	if v.identity != nil {
+		if err := im.Identity.matches(*v.identity); err != nil {
+			return im, nil, e, err
+		}
 	}
-	im.populateAbsoluteObjectIDs(minID)
 
-	// Ensure signing entity matches fingerprint in descriptor.
-	fp, err := sig.GetEntity()
-	if err != nil {
+	// Ensure epoch claim is not rolled back.
+	if err := im.checkEpoch(v.minEpoch); err != nil {
 		return im, nil, e, err
 	}
-	if !bytes.Equal(e.PrimaryKey.Fingerprint[:], fp[:20]) {
-		return im, nil, e, errFingerprintMismatch
-	}
 
 	// If an object subset is not permitted, verify our set of IDs match exactly what is in the
-	// image metadata.
+	// image metadata. Otherwise, verify the objects of the subset covered by the signature, such
+	// as where objects in the group are signed individually.
+	ods := v.ods
 	if !v.subsetOK {
 		if err := im.objectIDsMatch(v.ods); err != nil {
 			return im, nil, e, err
 		}
+	} else if ods = im.covered(v.ods); len(ods) == 0 {
+		return im, nil, e, errSignatureNotApplicable
 	}
 
 	// Verify header and object integrity.
-	verified, err := im.matches(v.f, v.ods)
+	verified, err := im.matches(v.f, ods, v.unchanged, v.objectDigests(im, ods))
 	if err != nil {
 		return im, verified, e, err
 	}
@@ -182,13 +200,34 @@ func (v *groupVerifier) verifyWithKeyRing(kr openpgp.KeyRing) error {
 		return err
 	}
 
+	// Signatures extended by incremental signatures are verified along with them.
+	if sigs, err = v.chainHeads(sigs, kr); err != nil {
+		return err
+	}
+
+	covered := make(map[uint32]bool)
+	claims := make(roleClaims)
+
 	for _, sig := range sigs {
 		im, verified, e, err := v.verifySignature(sig, kr)
+		if errors.Is(err, errSignatureNotApplicable) {
+			continue
+		}
+		v.record(im, verified)
+
+		if err == nil {
+			claims.add(im.Role, verified, e)
+		}
 
 		// Call verify callback, if applicable.
 		if v.cb != nil {
 			r := result{signature: sig.ID, im: im, verified: verified, e: e, err: err}
-			if ignoreError := v.cb(r); ignoreError {
+			if ignoreError := v.cb(r); ignoreError && err != nil {
+				// The objects covered by the signature may not be known, so all are treated as
+				// covered.
+				for _, od := range v.ods {
+					covered[od.ID] = true
+				}
 				err = nil
 			}
 		}
@@ -196,20 +235,35 @@ func (v *groupVerifier) verifyWithKeyRing(kr openpgp.KeyRing) error {
 		if err != nil {
 			return err
 		}
+
+		for _, id := range verified {
+			covered[id] = true
+		}
+	}
+
+	// Each object must be covered by a signature, and the signatures covering it must claim the
+	// required roles.
+	for _, od := range v.ods {
+		if !covered[od.ID] {
+			return &SignatureNotFoundError{ID: od.ID}
+		}
+		if err := claims.check(od.ID, v.roles); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
 type legacyGroupVerifier struct {
-	f       *sif.FileImage    // SIF image to verify.
+	f       ImageReader       // SIF image to verify.
 	cb      VerifyCallback    // Verification callback.
 	groupID uint32            // Object group ID.
 	ods     []*sif.Descriptor // Object descriptors.
 }
 
 // newLegacyGroupVerifier constructs a new legacy group verifier.
-func newLegacyGroupVerifier(f *sif.FileImage, cb VerifyCallback, groupID uint32) (*legacyGroupVerifier, error) {
+func newLegacyGroupVerifier(f ImageReader, cb VerifyCallback, groupID uint32) (*legacyGroupVerifier, error) {
 	ods, err := getGroupObjects(f, groupID)
 	if err != nil {
 		return nil, err
@@ -236,7 +290,7 @@ func (v *legacyGroupVerifier) fingerprints() ([][20]byte, error) {
 // If verification of a data object fails, a ObjectIntegrityError is returned.
 func (v *legacyGroupVerifier) verifySignature(sig *sif.Descriptor, kr openpgp.KeyRing) (*openpgp.Entity, error) {
 	// Verify signature and decode plaintext.
-	e, b, _, err := verifyAndDecode(sig.GetData(v.f), kr)
+	e, b, _, err := verifyAndDecode(readObject(v.f, sig), kr)
 	if err != nil {
 		return e, &SignatureNotValidError{ID: sig.ID, Err: err}
 	}
@@ -265,7 +319,7 @@ func (v *legacyGroupVerifier) verifySignature(sig *sif.Descriptor, kr openpgp.Ke
 	// Get reader covering all non-signature objects.
 	rs := make([]io.Reader, 0, len(v.ods))
 	for _, od := range v.ods {
-		rs = append(rs, od.GetReadSeeker(v.f))
+		rs = append(rs, v.f.GetObjectReadSeeker(*od))
 	}
 	r := io.MultiReader(rs...)
 
@@ -312,13 +366,13 @@ func (v *legacyGroupVerifier) verifyWithKeyRing(kr openpgp.KeyRing) error {
 }
 
 type legacyObjectVerifier struct {
-	f  *sif.FileImage  // SIF image to verify.
+	f  ImageReader     // SIF image to verify.
 	cb VerifyCallback  // Verification callback.
 	od *sif.Descriptor // Object descriptor.
 }
 
 // newLegacyObjectVerifier constructs a new legacy object verifier.
-func newLegacyObjectVerifier(f *sif.FileImage, cb VerifyCallback, id uint32) (*legacyObjectVerifier, error) {
+func newLegacyObjectVerifier(f ImageReader, cb VerifyCallback, id uint32) (*legacyObjectVerifier, error) {
 	od, err := getObject(f, id)
 	if err != nil {
 		return nil, err
@@ -345,7 +399,7 @@ func (v *legacyObjectVerifier) fingerprints() ([][20]byte, error) {
 // If verification of a data object fails, a ObjectIntegrityError is returned.
 func (v *legacyObjectVerifier) verifySignature(sig *sif.Descriptor, kr openpgp.KeyRing) (*openpgp.Entity, error) {
 	// Verify signature and decode plaintext.
-	e, b, _, err := verifyAndDecode(sig.GetData(v.f), kr)
+	e, b, _, err := verifyAndDecode(readObject(v.f, sig), kr)
 	if err != nil {
 		return e, &SignatureNotValidError{ID: sig.ID, Err: err}
 	}
@@ -372,7 +426,7 @@ func (v *legacyObjectVerifier) verifySignature(sig *sif.Descriptor, kr openpgp.K
 	}
 
 	// Verify object integrity.
-	if ok, err := d.matches(v.od.GetReadSeeker(v.f)); err != nil {
+	if ok, err := d.matches(v.f.GetObjectReadSeeker(*v.od)); err != nil {
 		return e, err
 	} else if !ok {
 		return e, &ObjectIntegrityError{ID: v.od.ID}
@@ -420,14 +474,26 @@ type verifyTask interface {
 
 // Verifier describes a SIF image verifier.
 type Verifier struct {
-	f *sif.FileImage // SIF image to verify.
-
-	keyRing     openpgp.KeyRing // Keyring to use for verification.
-	groups      []uint32        // Data object group(s) selected for verification.
-	objects     []uint32        // Individual data object(s) selected for verification.
-	isLegacy    bool            // Enable verification of legacy signature(s).
-	isLegacyAll bool            // Verify legacy sigs of all of non-signature objects in a group.
-	cb          VerifyCallback  // Verification callback.
+	f ImageReader // SIF image to verify.
+
+	keyRing     openpgp.KeyRing   // Keyring to use for verification.
+	groups      []uint32          // Data object group(s) selected for verification.
+	objects     []uint32          // Individual data object(s) selected for verification.
+	isLegacy    bool              // Enable verification of legacy signature(s).
+	isLegacyAll bool              // Verify legacy sigs of all of non-signature objects in a group.
+	cb          VerifyCallback    // Verification callback.
+	identity    *identityMetadata // Identity that signature(s) must claim.
+	minEpoch    uint64            // Minimum epoch that signature(s) must claim.
+	roles       []string          // Roles that signature(s) covering each object must claim.
+	budget      time.Duration     // Time allowed for verification, or zero if unlimited.
+	waivers     [][]byte          // Signed waivers supplied externally.
+	imgWaivers  bool              // Consider signed waivers stored in the image.
+	prior       *Manifest         // Manifest of an earlier verification.
+	parallel    int               // Number of objects to hash concurrently.
+	uring       *sif.URing        // If not nil, used to read the data of objects.
+
+	applied  []AppliedWaiver  // Waivers applied by the most recent verification.
+	rejected []RejectedWaiver // Waivers rejected by the most recent verification.
 
 	tasks []verifyTask // Slice of verification tasks.
 }
@@ -495,6 +561,64 @@ func OptVerifyLegacyAll() VerifierOpt {
 	}
 }
 
+// OptVerifyIdentity requires that each signature verified claims the image identity name, and
+// uri if it is not empty. This should be set to the reference used to retrieve the image, so that
+// an image signed by a trusted entity cannot be substituted for another. Identity claims are added
+// to signatures using OptSignWithIdentity. Legacy signatures do not support identity claims.
+func OptVerifyIdentity(name, uri string) VerifierOpt {
+	return func(v *Verifier) error {
+		if name == "" {
+			return errIdentityNameEmpty
+		}
+		v.identity = &identityMetadata{Name: name, URI: uri}
+		return nil
+	}
+}
+
+// OptVerifyMinEpoch requires that each signature verified claims an image epoch of at least min.
+// This should be set to the epoch of the most recent image accepted under the same identity, so
+// that an older image signed by a trusted entity cannot be served in its place. Epoch claims are
+// added to signatures using OptSignWithEpoch, and signatures without one are treated as claiming
+// epoch zero. Legacy signatures do not support epoch claims.
+func OptVerifyMinEpoch(min uint64) VerifierOpt {
+	return func(v *Verifier) error {
+		v.minEpoch = min
+		return nil
+	}
+}
+
+// OptVerifyTimeBudget limits the time spent by Verify to approximately d. The budget is checked
+// between verification tasks, each of which verifies the signatures of an object group or object,
+// so at least one task is always performed. If the budget is exhausted while tasks remain, Verify
+// returns an error wrapping ErrVerifyIncomplete. Results for the signatures verified before then
+// are reported to any callback supplied with OptVerifyCallback.
+func OptVerifyTimeBudget(d time.Duration) VerifierOpt {
+	return func(v *Verifier) error {
+		if d <= 0 {
+			return errTimeBudgetInvalid
+		}
+		v.budget = d
+		return nil
+	}
+}
+
+// OptVerifyWaiver supplies the signed waiver b, produced by SignWaiver, to exempt findings from
+// causing verification to fail. This may be called multiple times to supply more than one waiver.
+func OptVerifyWaiver(b []byte) VerifierOpt {
+	return func(v *Verifier) error {
+		v.waivers = append(v.waivers, b)
+		return nil
+	}
+}
+
+// OptVerifyImageWaivers enables consideration of signed waivers stored in the image by AddWaiver.
+func OptVerifyImageWaivers() VerifierOpt {
+	return func(v *Verifier) error {
+		v.imgWaivers = true
+		return nil
+	}
+}
+
 // OptVerifyCallback registers cb as the verification callback, which is called after each
 // signature is verified.
 func OptVerifyCallback(cb VerifyCallback) VerifierOpt {
@@ -505,7 +629,7 @@ func OptVerifyCallback(cb VerifyCallback) VerifierOpt {
 }
 
 // getTasks returns verification tasks corresponding to groupIDs and objectIDs.
-func getTasks(f *sif.FileImage, cb VerifyCallback, groupIDs []uint32, objectIDs []uint32) ([]verifyTask, error) {
+func getTasks(f ImageReader, cb VerifyCallback, groupIDs []uint32, objectIDs []uint32) ([]verifyTask, error) {
 	t := make([]verifyTask, 0, len(groupIDs)+len(objectIDs))
 
 	for _, groupID := range groupIDs {
@@ -533,7 +657,7 @@ func getTasks(f *sif.FileImage, cb VerifyCallback, groupIDs []uint32, objectIDs
 }
 
 // getLegacyTasks returns legacy verification tasks corresponding to groupIDs and objectIDs.
-func getLegacyTasks(f *sif.FileImage, cb VerifyCallback, groupIDs []uint32, objectIDs []uint32) ([]verifyTask, error) {
+func getLegacyTasks(f ImageReader, cb VerifyCallback, groupIDs []uint32, objectIDs []uint32) ([]verifyTask, error) {
 	t := make([]verifyTask, 0, len(groupIDs)+len(objectIDs))
 
 	for _, groupID := range groupIDs {
@@ -556,7 +680,7 @@ func getLegacyTasks(f *sif.FileImage, cb VerifyCallback, groupIDs []uint32, obje
 }
 
 // NewVerifier returns a Verifier to examine and/or verify digital signatures(s) in f according to
-// opts.
+// opts. The image f is typically a *sif.FileImage, but may be any implementation of ImageReader.
 //
 // Verify requires key material be provided. OptVerifyWithKeyRing can be used for this purpose. Key
 // material is not required for routines that do not perform cryptographic verification, such as
@@ -565,8 +689,8 @@ func getLegacyTasks(f *sif.FileImage, cb VerifyCallback, groupIDs []uint32, obje
 // By default, the returned Verifier will consider non-legacy signatures for all object groups. To
 // override this behavior, consider using OptVerifyGroup, OptVerifyObject, OptVerifyLegacy, and/or
 // OptVerifyLegacyAll.
-func NewVerifier(f *sif.FileImage, opts ...VerifierOpt) (*Verifier, error) {
-	if f == nil {
+func NewVerifier(f ImageReader, opts ...VerifierOpt) (*Verifier, error) {
+	if isNilImage(f) {
 		return nil, fmt.Errorf("integrity: %w", errNilFileImage)
 	}
 
@@ -579,12 +703,33 @@ func NewVerifier(f *sif.FileImage, opts ...VerifierOpt) (*Verifier, error) {
 		}
 	}
 
+	// Read the data of objects using io_uring, if requested.
+	if v.uring != nil {
+		f = uringImage{ImageReader: f, u: v.uring}
+		v.f = f
+	}
+
+	if v.isLegacy && v.identity != nil {
+		return nil, fmt.Errorf("integrity: %w", errIdentityLegacy)
+	}
+	if v.isLegacy && v.minEpoch != 0 {
+		return nil, fmt.Errorf("integrity: %w", errEpochLegacy)
+	}
+	if v.isLegacy && v.prior != nil {
+		return nil, fmt.Errorf("integrity: %w", errDifferentialLegacy)
+	}
+	if v.isLegacy && len(v.roles) > 0 {
+		return nil, fmt.Errorf("integrity: %w", errRoleLegacy)
+	}
+
+	// A manifest for a different image is ignored.
+	if v.prior != nil && v.prior.ImageID != f.GetHeader().ID.String() {
+		v.prior = nil
+	}
+
 	// If "legacy all" mode selected, add all non-signature objects that are in a group.
 	if v.isLegacyAll {
-		for _, od := range f.DescrArr {
-			if !od.Used {
-				continue
-			}
+		for _, od := range f.GetDescriptors() {
 			if od.Datatype == sif.DataSignature {
 				continue
 			}
@@ -615,6 +760,17 @@ func NewVerifier(f *sif.FileImage, opts ...VerifierOpt) (*Verifier, error) {
 	}
 	v.tasks = t
 
+	// Apply identity, epoch and role requirements, any prior manifest, and parallelism, to tasks.
+	for _, t := range v.tasks {
+		if gv, ok := t.(*groupVerifier); ok {
+			gv.identity = v.identity
+			gv.minEpoch = v.minEpoch
+			gv.roles = v.roles
+			gv.prior = v.prior
+			gv.parallel = v.parallel
+		}
+	}
+
 	return v, nil
 }
 
@@ -690,26 +846,99 @@ func (v *Verifier) AllSignedBy() ([][20]byte, error) {
 // returned. If verification of a data object descriptor fails, an error wrapping a
 // DescriptorIntegrityError is returned. If verification of a data object fails, an error wrapping
 // a ObjectIntegrityError is returned.
+//
+// If a time budget was set with OptVerifyTimeBudget, and it is exhausted before all tasks are
+// performed, an error wrapping ErrVerifyIncomplete is returned.
+//
+// If waivers were supplied with OptVerifyWaiver or OptVerifyImageWaivers, a data object that is
+// not part of an object group, or an object group without signatures, does not cause verification
+// to fail if an unexpired waiver exempts it. A waiver that is not signed by an entity in the
+// verification keyring, or does not apply to the image, is rejected. A rejected waiver causes
+// verification to fail only if it would have exempted a finding, in which case the reason it was
+// rejected is returned. The waivers applied and rejected are reported by AppliedWaivers and
+// RejectedWaivers.
 func (v *Verifier) Verify() error {
+	return v.VerifyContext(context.Background())
+}
+
+// VerifyContext is like Verify, but stops once ctx is done, returning an error wrapping the error
+// of ctx. The context is checked before each verification task, each of which verifies the
+// signatures of an object group or object.
+func (v *Verifier) VerifyContext(ctx context.Context) error {
 	if v.keyRing == nil {
 		return fmt.Errorf("integrity: %w", ErrNoKeyMaterial)
 	}
 
-	// All non-signature objects must be contained in an object group.
+	ws, err := newWaiverSet(v, time.Now())
+	if err != nil {
+		return fmt.Errorf("integrity: %w", err)
+	}
+	defer func() { v.applied, v.rejected = ws.applied, ws.rejected }()
+
+	// All non-signature objects must be contained in an object group, unless waived.
 	ods, err := getNonGroupObjects(v.f)
 	if err != nil {
 		return fmt.Errorf("integrity: %w", err)
 	}
 	for _, od := range ods {
-		if od.Datatype != sif.DataSignature {
-			return fmt.Errorf("integrity: %w", errNonGroupedObject)
+		if od.Datatype == sif.DataSignature || (v.imgWaivers && isWaiverObject(od)) {
+			continue
+		}
+		if err := ws.waiveObject(od); err != nil {
+			return fmt.Errorf("integrity: %w", err)
 		}
 	}
 
 	for _, t := range v.tasks {
-		if err := t.verifyWithKeyRing(v.keyRing); err != nil {
+		if gv, ok := t.(*groupVerifier); ok {
+			gv.seen = nil
+		}
+	}
+
+	start := time.Now()
+
+	for i, t := range v.tasks {
+		if err := ctx.Err(); err != nil {
 			return fmt.Errorf("integrity: %w", err)
 		}
+
+		if err := t.verifyWithKeyRing(v.keyRing); err != nil {
+			if err := ws.waiveError(err, taskGroupID(t)); err != nil {
+				return fmt.Errorf("integrity: %w", err)
+			}
+		}
+
+		if remaining := len(v.tasks) - i - 1; v.budget > 0 && remaining > 0 && time.Since(start) >= v.budget {
+			return fmt.Errorf("integrity: %w: time budget of %v exhausted with %d of %d tasks remaining",
+				ErrVerifyIncomplete, v.budget, remaining, len(v.tasks))
+		}
 	}
 	return nil
 }
+
+// taskGroupID returns the ID of the object group verified by t, or zero if t verifies individual
+// objects.
+func taskGroupID(t verifyTask) uint32 {
+	switch t := t.(type) {
+	case *groupVerifier:
+		if !t.subsetOK {
+			return t.groupID
+		}
+	case *legacyGroupVerifier:
+		return t.groupID
+	}
+	return 0
+}
+
+// AppliedWaivers returns the waivers that exempted findings during the most recent verification,
+// in the order they were applied, for recording in an audit log.
+func (v *Verifier) AppliedWaivers() []AppliedWaiver {
+	return v.applied
+}
+
+// RejectedWaivers returns the unexpired waivers that were rejected during the most recent
+// verification, as they were not signed by an entity in the verification keyring, or do not apply
+// to the image.
+func (v *Verifier) RejectedWaivers() []RejectedWaiver {
+	return v.rejected
+}
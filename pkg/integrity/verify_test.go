@@ -6,12 +6,17 @@
 package integrity
 
 import (
+	"context"
 	"errors"
 	"io"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
+	uuid "github.com/satori/go.uuid"
 	"github.com/sylabs/sif/pkg/sif"
 	"golang.org/x/crypto/openpgp"
 	pgperrors "golang.org/x/crypto/openpgp/errors"
@@ -1133,3 +1138,552 @@ func TestVerifier_Verify(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifier_TestVectors(t *testing.T) {
+	kr := openpgp.EntityList{getTestEntity(t)}
+
+	tests := []struct {
+		name        string
+		opts        []VerifierOpt
+		wantErr     error
+		wantVersion mdVersion
+	}{
+		{name: "empty.sif", wantErr: errNoGroupsFound},
+		{name: "one-group.sif", wantErr: &SignatureNotFoundError{}},
+		{name: "one-group-signed.sif", wantVersion: metadataVersion1},
+		{name: "one-group-signed-v4.sif", wantVersion: metadataVersion4},
+		{name: "one-group-signed-legacy.sif", opts: []VerifierOpt{OptVerifyLegacy(), OptVerifyObject(2)}},
+		{name: "one-group-signed-legacy-group.sif", opts: []VerifierOpt{OptVerifyLegacy()}},
+		{name: "one-group-signed-legacy-all.sif", opts: []VerifierOpt{OptVerifyLegacyAll()}},
+		{name: "two-groups.sif", wantErr: &SignatureNotFoundError{}},
+		{name: "two-groups-signed.sif", wantVersion: metadataVersion1},
+		{name: "two-groups-signed-v4.sif", wantVersion: metadataVersion4},
+		{name: "two-groups-signed-legacy.sif", opts: []VerifierOpt{OptVerifyLegacy(), OptVerifyObject(2)}},
+		{name: "two-groups-signed-legacy-group.sif", opts: []VerifierOpt{OptVerifyLegacy(), OptVerifyGroup(1)}},
+		{
+			name: "two-groups-signed-legacy-all.sif",
+			opts: []VerifierOpt{OptVerifyLegacy(), OptVerifyObject(1), OptVerifyObject(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := sif.LoadContainer(filepath.Join("testdata", "images", tt.name), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			v, err := NewVerifier(&f, append(tt.opts, OptVerifyWithKeyRing(kr))...)
+			if err == nil {
+				err = v.Verify()
+			}
+
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if tt.wantVersion != 0 {
+				for _, sig := range getDescriptors(&f, sif.WithDataType(sif.DataSignature)) {
+					var im imageMetadata
+					if _, _, err := verifyAndDecodeJSON(readObject(&f, sig), &im, kr); err != nil {
+						t.Fatal(err)
+					}
+					if got, want := im.Version, tt.wantVersion; got != want {
+						t.Errorf("signature %v: got metadata version %v, want %v", sig.ID, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	e := getTestEntity(t)
+
+	tests := []struct {
+		name        string
+		inputFile   string
+		opts        []SignerOpt
+		wantVersion mdVersion
+	}{
+		{name: "OneGroup", inputFile: "one-group.sif", wantVersion: metadataVersion4},
+		{name: "TwoGroups", inputFile: "two-groups.sif", wantVersion: metadataVersion4},
+		{
+			name:        "OneGroupVersion1",
+			inputFile:   "one-group.sif",
+			opts:        []SignerOpt{OptSignMetadataVersion(1)},
+			wantVersion: metadataVersion1,
+		},
+		{
+			name:        "TwoGroupsVersion1",
+			inputFile:   "two-groups.sif",
+			opts:        []SignerOpt{OptSignMetadataVersion(1)},
+			wantVersion: metadataVersion1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", tt.inputFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			f, err := sif.LoadContainerFp(tf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSigner(&f, append(tt.opts, OptSignWithEntity(e))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Sign(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Reload the image, as verification must not depend on in-memory state of the signer.
+			f, err = sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			for _, sig := range getDescriptors(&f, sif.WithDataType(sif.DataSignature)) {
+				var im imageMetadata
+				if _, _, err := verifyAndDecodeJSON(readObject(&f, sig), &im, openpgp.EntityList{e}); err != nil {
+					t.Fatal(err)
+				}
+				if got, want := im.Version, tt.wantVersion; got != want {
+					t.Errorf("signature %v: got metadata version %v, want %v", sig.ID, got, want)
+				}
+			}
+
+			v, err := NewVerifier(&f, OptVerifyWithKeyRing(openpgp.EntityList{e}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Verify(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestVerifier_HeaderIntegrity(t *testing.T) {
+	e := getTestEntity(t)
+
+	tests := []struct {
+		name    string
+		modFunc func(h *sif.Header)
+		wantErr error
+	}{
+		{name: "Unmodified", modFunc: func(h *sif.Header) {}},
+		{name: "Mtime", modFunc: func(h *sif.Header) { h.Mtime++ }},
+		{name: "ID", modFunc: func(h *sif.Header) { h.ID[0]++ }, wantErr: ErrHeaderIntegrity},
+		{name: "Arch", modFunc: func(h *sif.Header) { copy(h.Arch[:], sif.HdrArchS390x) }, wantErr: ErrHeaderIntegrity},
+		{name: "Ctime", modFunc: func(h *sif.Header) { h.Ctime++ }, wantErr: ErrHeaderIntegrity},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			f, err := sif.LoadContainerFp(tf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSigner(&f, OptSignWithEntity(e))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Sign(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err = sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			tt.modFunc(&f.Header)
+
+			v, err := NewVerifier(&f, OptVerifyWithKeyRing(openpgp.EntityList{e}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := v.Verify(), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifier_Identity(t *testing.T) {
+	e := getTestEntity(t)
+
+	const (
+		name = "user/collection/image:tag"
+		uri  = "library://user/collection/image:tag"
+	)
+
+	tests := []struct {
+		name       string
+		signOpts   []SignerOpt
+		verifyOpts []VerifierOpt
+		wantErr    error
+	}{
+		{
+			name:       "NameEmpty",
+			verifyOpts: []VerifierOpt{OptVerifyIdentity("", uri)},
+			wantErr:    errIdentityNameEmpty,
+		},
+		{
+			name:       "Legacy",
+			verifyOpts: []VerifierOpt{OptVerifyLegacy(), OptVerifyIdentity(name, uri)},
+			wantErr:    errIdentityLegacy,
+		},
+		{
+			name:       "NoClaim",
+			verifyOpts: []VerifierOpt{OptVerifyIdentity(name, "")},
+			wantErr:    ErrIdentityMismatch,
+		},
+		{
+			name:       "NameMismatch",
+			signOpts:   []SignerOpt{OptSignWithIdentity(name, uri)},
+			verifyOpts: []VerifierOpt{OptVerifyIdentity("user/collection/other:tag", "")},
+			wantErr:    ErrIdentityMismatch,
+		},
+		{
+			name:       "URIMismatch",
+			signOpts:   []SignerOpt{OptSignWithIdentity(name, uri)},
+			verifyOpts: []VerifierOpt{OptVerifyIdentity(name, "library://user/collection/other:tag")},
+			wantErr:    ErrIdentityMismatch,
+		},
+		{
+			name:     "NotRequired",
+			signOpts: []SignerOpt{OptSignWithIdentity(name, uri)},
+		},
+		{
+			name:       "NameMatch",
+			signOpts:   []SignerOpt{OptSignWithIdentity(name, uri)},
+			verifyOpts: []VerifierOpt{OptVerifyIdentity(name, "")},
+		},
+		{
+			name:       "NameAndURIMatch",
+			signOpts:   []SignerOpt{OptSignGroup(1), OptSignWithIdentity(name, uri)},
+			verifyOpts: []VerifierOpt{OptVerifyIdentity(name, uri)},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			f, err := sif.LoadContainerFp(tf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSigner(&f, append(tt.signOpts, OptSignWithEntity(e))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Sign(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err = sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			v, err := NewVerifier(&f, append(tt.verifyOpts, OptVerifyWithKeyRing(openpgp.EntityList{e}))...)
+			if err == nil {
+				err = v.Verify()
+			}
+
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifier_Epoch(t *testing.T) {
+	e := getTestEntity(t)
+
+	tests := []struct {
+		name       string
+		signOpts   []SignerOpt
+		verifyOpts []VerifierOpt
+		wantErr    error
+	}{
+		{
+			name:       "Legacy",
+			verifyOpts: []VerifierOpt{OptVerifyLegacy(), OptVerifyMinEpoch(1)},
+			wantErr:    errEpochLegacy,
+		},
+		{
+			name:       "NoClaim",
+			verifyOpts: []VerifierOpt{OptVerifyMinEpoch(1)},
+			wantErr:    ErrEpochRollback,
+		},
+		{
+			name:       "Rollback",
+			signOpts:   []SignerOpt{OptSignWithEpoch(41)},
+			verifyOpts: []VerifierOpt{OptVerifyMinEpoch(42)},
+			wantErr:    ErrEpochRollback,
+		},
+		{
+			name:     "NotRequired",
+			signOpts: []SignerOpt{OptSignWithEpoch(42)},
+		},
+		{
+			name:       "Equal",
+			signOpts:   []SignerOpt{OptSignWithEpoch(42)},
+			verifyOpts: []VerifierOpt{OptVerifyMinEpoch(42)},
+		},
+		{
+			name:       "Greater",
+			signOpts:   []SignerOpt{OptSignGroup(1), OptSignWithEpoch(43)},
+			verifyOpts: []VerifierOpt{OptVerifyMinEpoch(42)},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := tempFileFrom(filepath.Join("testdata", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+
+			f, err := sif.LoadContainerFp(tf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSigner(&f, append(tt.signOpts, OptSignWithEntity(e))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Sign(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err = sif.LoadContainer(tf.Name(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer() // nolint:errcheck
+
+			v, err := NewVerifier(&f, append(tt.verifyOpts, OptVerifyWithKeyRing(openpgp.EntityList{e}))...)
+			if err == nil {
+				err = v.Verify()
+			}
+
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// slowVerifier is a verification task that takes d to perform, recording the number of times it
+// is performed in n.
+type slowVerifier struct {
+	mockVerifier
+	d time.Duration
+	n *int
+}
+
+func (v slowVerifier) verifyWithKeyRing(kr openpgp.KeyRing) error {
+	*v.n++
+	time.Sleep(v.d)
+	return v.err
+}
+
+func TestVerifier_TimeBudget(t *testing.T) {
+	oneGroupSignedImage, err := sif.LoadContainer(filepath.Join("testdata", "images", "one-group-signed.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oneGroupSignedImage.UnloadContainer() // nolint:errcheck
+
+	if _, err := NewVerifier(&oneGroupSignedImage, OptVerifyTimeBudget(0)); !errors.Is(err, errTimeBudgetInvalid) {
+		t.Errorf("got error %v, want %v", err, errTimeBudgetInvalid)
+	}
+
+	tests := []struct {
+		name    string
+		budget  time.Duration
+		tasks   int
+		wantN   int
+		wantErr error
+	}{
+		{name: "Unlimited", tasks: 3, wantN: 3},
+		{name: "Sufficient", budget: time.Hour, tasks: 3, wantN: 3},
+		{name: "Exhausted", budget: time.Millisecond, tasks: 3, wantN: 1, wantErr: ErrVerifyIncomplete},
+		{name: "ExhaustedLastTask", budget: time.Millisecond, tasks: 1, wantN: 1},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := 0
+
+			v := Verifier{
+				f:       &oneGroupSignedImage,
+				keyRing: openpgp.EntityList{getTestEntity(t)},
+				budget:  tt.budget,
+			}
+			for i := 0; i < tt.tasks; i++ {
+				v.tasks = append(v.tasks, slowVerifier{d: 2 * time.Millisecond, n: &n})
+			}
+
+			if got, want := v.Verify(), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if got, want := n, tt.wantN; got != want {
+				t.Errorf("got %v tasks performed, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifier_VerifyContext(t *testing.T) {
+	f, err := sif.LoadContainer(filepath.Join("testdata", "images", "two-groups-signed.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	v, err := NewVerifier(&f, OptVerifyWithKeyRing(openpgp.EntityList{getTestEntity(t)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if got, want := v.VerifyContext(ctx), context.Canceled; !errors.Is(got, want) {
+		t.Fatalf("got error %v, want %v", got, want)
+	}
+
+	if err := v.VerifyContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestVerifier_VerifyBoundTemplate checks that the signature of a template image remains valid
+// once its placeholder is bound.
+func TestVerifier_VerifyBoundTemplate(t *testing.T) {
+	tf, err := ioutil.TempFile("", "template-*.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tf.Name())
+	tf.Close()
+
+	ph, err := sif.NewPlaceholderInput(sif.DataGeneric, 64, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ph.Groupid = sif.DescrGroupMask | 2
+
+	cinfo := sif.CreateInfo{
+		Pathname:   tf.Name(),
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{
+			{
+				Datatype: sif.DataDeffile,
+				Groupid:  sif.DescrDefaultGroup,
+				Link:     sif.DescrUnusedLink,
+				Size:     8,
+				Fname:    "deffile",
+				Data:     []byte("skeleton"),
+			},
+			ph,
+		},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	// withImage calls fn with the template image, loaded read-write.
+	withImage := func(fn func(f *sif.FileImage) error) {
+		f, err := sif.LoadContainer(tf.Name(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.UnloadContainer() // nolint:errcheck
+
+		if err := fn(&f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	withImage(func(f *sif.FileImage) error {
+		s, err := NewSigner(f, OptSignWithEntity(getTestEntity(t)), OptSignGroup(1))
+		if err != nil {
+			return err
+		}
+		return s.Sign()
+	})
+
+	withImage(func(f *sif.FileImage) error {
+		_, err := f.Bind(2, sif.DescriptorInput{
+			Datatype: sif.DataGeneric,
+			Size:     4,
+			Fname:    "data",
+			Data:     []byte("data"),
+		})
+		return err
+	})
+
+	withImage(func(f *sif.FileImage) error {
+		v, err := NewVerifier(f, OptVerifyWithKeyRing(openpgp.EntityList{getTestEntity(t)}), OptVerifyGroup(1))
+		if err != nil {
+			return err
+		}
+		return v.Verify()
+	})
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+var (
+	errWaiverImageEmpty    = errors.New("waiver image ID empty")
+	errWaiverExpiryMissing = errors.New("waiver expiry missing")
+	errWaiverEmpty         = errors.New("waiver exempts no findings")
+	errWaiverImageMismatch = errors.New("waiver does not apply to image")
+	errWaiverInvalid       = errors.New("waiver invalid")
+)
+
+// WaiverName is the name of data objects holding waivers within an image.
+const WaiverName = "sif-waiver.asc"
+
+// WaivedObject identifies a data object that is exempt from being signed. The object is
+// identified by its content as well as its ID, so that the waiver does not apply if the object is
+// modified.
+type WaivedObject struct {
+	ID     uint32 `json:"id"`     // ID of the data object.
+	Digest string `json:"digest"` // Digest of the object data, of the form "sha256:<hex>".
+}
+
+// WaivedGroup identifies an object group that is exempt from being signed. The group is identified
+// by the objects it contains, so that the waiver does not apply if an object is added to or removed
+// from the group, or modified.
+type WaivedGroup struct {
+	ID      uint32         `json:"id"`      // ID of the object group.
+	Objects []WaivedObject `json:"objects"` // Data objects in the group.
+}
+
+// Waiver exempts specific findings from causing verification of an image to fail. A waiver is
+// clear-signed with SignWaiver, and is only applied if it was signed by an entity in the keyring
+// used for verification, and has not expired.
+type Waiver struct {
+	ImageID string         `json:"imageID"`           // ID of the image the waiver applies to.
+	Objects []WaivedObject `json:"objects,omitempty"` // Data objects exempt from being signed.
+	Groups  []WaivedGroup  `json:"groups,omitempty"`  // Object groups exempt from being signed.
+	Reason  string         `json:"reason"`            // Reason the waiver was granted.
+	Expires time.Time      `json:"expires"`           // Time after which the waiver does not apply.
+}
+
+// AppliedWaiver records a waiver that exempted a finding during verification.
+type AppliedWaiver struct {
+	Waiver
+	Entity *openpgp.Entity // Entity that signed the waiver.
+	Source uint32          // ID of the data object holding the waiver, or zero if supplied externally.
+}
+
+// RejectedWaiver records a waiver that could not be applied during verification, as it was not
+// signed by an entity in the keyring used for verification, or does not apply to the image. If the
+// signature could not be verified, the contents of the waiver must not be trusted.
+type RejectedWaiver struct {
+	Waiver
+	Source uint32 // ID of the data object holding the waiver, or zero if supplied externally.
+	Err    error  // Reason the waiver was rejected.
+}
+
+// waivedObjects returns the IDs and digests of the data objects ods in f.
+func waivedObjects(f ImageReader, ods []*sif.Descriptor) ([]WaivedObject, error) {
+	wos := make([]WaivedObject, 0, len(ods))
+	for _, od := range ods {
+		digest, err := sif.OCIDigest(f.GetObjectReadSeeker(*od))
+		if err != nil {
+			return nil, err
+		}
+		wos = append(wos, WaivedObject{ID: od.ID, Digest: digest})
+	}
+	return wos, nil
+}
+
+// NewWaiver returns a waiver for the image f, exempting objects and object groups from being
+// signed until expires. The waiver records the digest of each object, and of each object in the
+// groups.
+func NewWaiver(f *sif.FileImage, objects []uint32, groups []uint32, reason string, expires time.Time) (Waiver, error) {
+	wv := Waiver{
+		ImageID: f.Header.ID.String(),
+		Reason:  reason,
+		Expires: expires.UTC(),
+	}
+
+	for _, id := range objects {
+		od, err := getObject(f, id)
+		if err != nil {
+			return Waiver{}, fmt.Errorf("integrity: %w", err)
+		}
+
+		wos, err := waivedObjects(f, []*sif.Descriptor{od})
+		if err != nil {
+			return Waiver{}, fmt.Errorf("integrity: %w", err)
+		}
+		wv.Objects = append(wv.Objects, wos...)
+	}
+
+	for _, id := range groups {
+		ods, err := getGroupObjects(f, id)
+		if err != nil {
+			return Waiver{}, fmt.Errorf("integrity: %w", err)
+		}
+
+		wos, err := waivedObjects(f, ods)
+		if err != nil {
+			return Waiver{}, fmt.Errorf("integrity: %w", err)
+		}
+		wv.Groups = append(wv.Groups, WaivedGroup{ID: id, Objects: wos})
+	}
+
+	return wv, nil
+}
+
+// SignWaiver clear-signs wv with the private key of e, and writes it to w. The signed waiver may
+// be supplied to a Verifier with OptVerifyWaiver, or stored in the image with AddWaiver.
+func SignWaiver(w io.Writer, wv Waiver, e *openpgp.Entity) error {
+	switch {
+	case wv.ImageID == "":
+		return fmt.Errorf("integrity: %w", errWaiverImageEmpty)
+	case wv.Expires.IsZero():
+		return fmt.Errorf("integrity: %w", errWaiverExpiryMissing)
+	case len(wv.Objects) == 0 && len(wv.Groups) == 0:
+		return fmt.Errorf("integrity: %w", errWaiverEmpty)
+	case e == nil || e.PrivateKey == nil:
+		return fmt.Errorf("integrity: %w", ErrNoKeyMaterial)
+	}
+
+	if err := signAndEncodeJSON(w, wv, e.PrivateKey, nil); err != nil {
+		return fmt.Errorf("integrity: failed to encode waiver: %w", err)
+	}
+	return nil
+}
+
+// AddWaiver adds the signed waiver b to f, as a data object named WaiverName that is not part of
+// an object group. Waivers stored in an image are only considered by a Verifier created with
+// OptVerifyImageWaivers.
+func AddWaiver(f *sif.FileImage, b []byte) error {
+	di := sif.DescriptorInput{
+		Datatype: sif.DataGeneric,
+		Groupid:  sif.DescrUnusedGroup,
+		Link:     sif.DescrUnusedLink,
+		Size:     int64(len(b)),
+		Fname:    WaiverName,
+		Fp:       bytes.NewReader(b),
+	}
+
+	if err := f.AddObject(di); err != nil {
+		return fmt.Errorf("integrity: %w", err)
+	}
+	return nil
+}
+
+// isWaiverObject returns true if od holds a waiver.
+func isWaiverObject(od *sif.Descriptor) bool {
+	return od.Datatype == sif.DataGeneric && od.Groupid == sif.DescrUnusedGroup && od.GetName() == WaiverName
+}
+
+// decodeWaiver returns the contents of the clear-signed waiver b, without verifying its signature.
+// If b cannot be decoded, a zero Waiver is returned.
+func decodeWaiver(b []byte) Waiver {
+	var wv Waiver
+	if cb, _ := clearsign.Decode(b); cb != nil {
+		json.Unmarshal(cb.Plaintext, &wv) // nolint:errcheck
+	}
+	return wv
+}
+
+// waiverSet holds the waivers that apply to an image.
+type waiverSet struct {
+	f        ImageReader
+	waivers  []AppliedWaiver
+	rejected []RejectedWaiver
+	applied  []AppliedWaiver
+	digests  map[uint32]string // Digests of object data, by object ID.
+}
+
+// newWaiverSet verifies and decodes the waivers supplied to v, and those stored in the image if
+// requested. Waivers that have expired at time now are discarded. A waiver that is not signed by
+// an entity in the keyring of v, does not apply to the image, or has no expiry, is rejected. A
+// rejected waiver does not cause verification to fail unless it would have exempted a finding.
+func newWaiverSet(v *Verifier, now time.Time) (*waiverSet, error) {
+	ws := &waiverSet{f: v.f, digests: make(map[uint32]string)}
+
+	add := func(b []byte, source uint32) {
+		var wv Waiver
+		e, _, err := verifyAndDecodeJSON(b, &wv, v.keyRing)
+		switch {
+		case err != nil:
+			wv = decodeWaiver(b)
+			err = fmt.Errorf("%w: %v", errWaiverInvalid, err)
+		case wv.ImageID != v.f.GetHeader().ID.String():
+			err = fmt.Errorf("%w: image ID %v", errWaiverImageMismatch, wv.ImageID)
+		case wv.Expires.IsZero():
+			err = errWaiverExpiryMissing
+		}
+
+		if !wv.Expires.IsZero() && !now.Before(wv.Expires) {
+			return
+		}
+
+		if err != nil {
+			ws.rejected = append(ws.rejected, RejectedWaiver{Waiver: wv, Source: source, Err: err})
+		} else {
+			ws.waivers = append(ws.waivers, AppliedWaiver{Waiver: wv, Entity: e, Source: source})
+		}
+	}
+
+	for _, b := range v.waivers {
+		add(b, 0)
+	}
+
+	if v.imgWaivers {
+		ods, err := getNonGroupObjects(v.f)
+		if err != nil {
+			return nil, err
+		}
+		for _, od := range ods {
+			if isWaiverObject(od) {
+				add(readObject(v.f, od), od.ID)
+			}
+		}
+	}
+
+	return ws, nil
+}
+
+// digest returns the digest of the data of od, of the form "sha256:<hex>".
+func (ws *waiverSet) digest(od *sif.Descriptor) (string, error) {
+	if d, ok := ws.digests[od.ID]; ok {
+		return d, nil
+	}
+
+	d, err := sif.OCIDigest(ws.f.GetObjectReadSeeker(*od))
+	if err != nil {
+		return "", err
+	}
+	ws.digests[od.ID] = d
+	return d, nil
+}
+
+// matchesObject returns true if wos identifies od by ID and digest.
+func (ws *waiverSet) matchesObject(wos []WaivedObject, od *sif.Descriptor) (bool, error) {
+	for _, o := range wos {
+		if o.ID != od.ID {
+			continue
+		}
+
+		d, err := ws.digest(od)
+		if err != nil {
+			return false, err
+		}
+		if o.Digest == d {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// apply records the first waiver for which match returns true as applied, and returns nil. If no
+// waiver matches, and a rejected waiver would have matched, an error describing why it was
+// rejected is returned. Otherwise, notWaived is returned.
+func (ws *waiverSet) apply(match func(wv Waiver) (bool, error), notWaived error) error {
+	for _, aw := range ws.waivers {
+		if ok, err := match(aw.Waiver); err != nil {
+			return err
+		} else if ok {
+			ws.applied = append(ws.applied, aw)
+			return nil
+		}
+	}
+
+	for _, rw := range ws.rejected {
+		if ok, err := match(rw.Waiver); err != nil {
+			return err
+		} else if ok {
+			if rw.Source != 0 {
+				return fmt.Errorf("object %d: %w", rw.Source, rw.Err)
+			}
+			return rw.Err
+		}
+	}
+
+	return notWaived
+}
+
+// waiveObject returns nil if a waiver exempts the data object od from being signed. Otherwise, it
+// returns an error describing why od is not waived.
+func (ws *waiverSet) waiveObject(od *sif.Descriptor) error {
+	return ws.apply(func(wv Waiver) (bool, error) {
+		return ws.matchesObject(wv.Objects, od)
+	}, errNonGroupedObject)
+}
+
+// waiveError returns nil if err reports that the object group groupID is not signed, and a waiver
+// exempts the group, holding the same objects, from being signed. Otherwise, it returns an error
+// describing why err is not waived.
+func (ws *waiverSet) waiveError(err error, groupID uint32) error {
+	if groupID == 0 || !errors.Is(err, &SignatureNotFoundError{ID: groupID, IsGroup: true}) {
+		return err
+	}
+
+	return ws.apply(func(wv Waiver) (bool, error) {
+		for _, g := range wv.Groups {
+			if g.ID != groupID {
+				continue
+			}
+
+			ods, err := getGroupObjects(ws.f, groupID)
+			if err != nil {
+				return false, err
+			}
+			if len(ods) != len(g.Objects) {
+				continue
+			}
+
+			ok := true
+			for _, od := range ods {
+				if ok, err = ws.matchesObject(g.Objects, od); err != nil {
+					return false, err
+				} else if !ok {
+					break
+				}
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	}, err)
+}
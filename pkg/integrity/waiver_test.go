@@ -0,0 +1,313 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestSignWaiver(t *testing.T) {
+	e := getTestEntity(t)
+	expires := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		wv      Waiver
+		e       *openpgp.Entity
+		wantErr error
+	}{
+		{"ImageEmpty", Waiver{Groups: []WaivedGroup{{ID: 1}}, Expires: expires}, e, errWaiverImageEmpty},
+		{"ExpiryMissing", Waiver{ImageID: "id", Groups: []WaivedGroup{{ID: 1}}}, e, errWaiverExpiryMissing},
+		{"Empty", Waiver{ImageID: "id", Expires: expires}, e, errWaiverEmpty},
+		{"NoEntity", Waiver{ImageID: "id", Groups: []WaivedGroup{{ID: 1}}, Expires: expires}, nil, ErrNoKeyMaterial},
+		{"OK", Waiver{ImageID: "id", Groups: []WaivedGroup{{ID: 1}}, Expires: expires}, e, nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if got, want := SignWaiver(&b, tt.wv, tt.e), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifier_VerifyWaiver(t *testing.T) {
+	e := getTestEntity(t)
+
+	tf, err := ioutil.TempFile("", "waiver-*.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tf.Name())
+	tf.Close()
+
+	cinfo := sif.CreateInfo{
+		Pathname:   tf.Name(),
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{
+			{
+				Datatype: sif.DataDeffile,
+				Groupid:  sif.DescrDefaultGroup,
+				Link:     sif.DescrUnusedLink,
+				Size:     8,
+				Fname:    "deffile",
+				Data:     []byte("deffile!"),
+			},
+			{
+				Datatype: sif.DataGeneric,
+				Groupid:  sif.DescrUnusedGroup,
+				Link:     sif.DescrUnusedLink,
+				Size:     8,
+				Fname:    "unsigned",
+				Data:     []byte("unsigned"),
+			},
+			{
+				Datatype: sif.DataGeneric,
+				Groupid:  sif.DescrGroupMask | 2,
+				Link:     sif.DescrUnusedLink,
+				Size:     8,
+				Fname:    "unsigned-group",
+				Data:     []byte("unsigned"),
+			},
+		},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	// load reloads the image, so that objects added to it are mapped.
+	var f sif.FileImage
+	load := func() {
+		if f.Fp != nil {
+			if err := f.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if f, err = sif.LoadContainer(tf.Name(), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load()
+	defer func() { f.UnloadContainer() }() // nolint:errcheck
+
+	s, err := NewSigner(&f, OptSignWithEntity(e), OptSignGroup(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign(); err != nil {
+		t.Fatal(err)
+	}
+	load()
+
+	other, err := openpgp.NewEntity("Other", "", "other@test.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signAs returns a waiver for f with the specified exemptions and expiry, signed by e.
+	signAs := func(e *openpgp.Entity, objects, groups []uint32, expires time.Time, edit func(wv *Waiver)) []byte {
+		wv, err := NewWaiver(&f, objects, groups, "pending review", expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if edit != nil {
+			edit(&wv)
+		}
+
+		var b bytes.Buffer
+		if err := SignWaiver(&b, wv, e); err != nil {
+			t.Fatal(err)
+		}
+		return b.Bytes()
+	}
+
+	// sign returns a signed waiver for f with the specified exemptions and expiry.
+	sign := func(objects, groups []uint32, expires time.Time, edit func(wv *Waiver)) []byte {
+		return signAs(e, objects, groups, expires, edit)
+	}
+
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	objectWaiver := sign([]uint32{2}, nil, future, nil)
+	groupWaiver := sign(nil, []uint32{2}, future, nil)
+
+	imageMismatch := func(wv *Waiver) {
+		wv.ImageID = uuid.NewV4().String()
+	}
+
+	tests := []struct {
+		name         string
+		kr           openpgp.KeyRing
+		waivers      [][]byte
+		wantErr      error
+		wantApplied  int
+		wantRejected int
+	}{
+		{
+			name:    "NoWaiver",
+			kr:      openpgp.EntityList{e},
+			wantErr: errNonGroupedObject,
+		},
+		{
+			name:    "ObjectOnly",
+			kr:      openpgp.EntityList{e},
+			waivers: [][]byte{objectWaiver},
+			wantErr: &SignatureNotFoundError{ID: 2, IsGroup: true},
+		},
+		{
+			name:        "ObjectAndGroup",
+			kr:          openpgp.EntityList{e},
+			waivers:     [][]byte{objectWaiver, groupWaiver},
+			wantApplied: 2,
+		},
+		{
+			name:        "Combined",
+			kr:          openpgp.EntityList{e},
+			waivers:     [][]byte{sign([]uint32{2}, []uint32{2}, future, nil)},
+			wantApplied: 2,
+		},
+		{
+			name:    "Expired",
+			kr:      openpgp.EntityList{e},
+			waivers: [][]byte{sign([]uint32{2}, []uint32{2}, past, nil)},
+			wantErr: errNonGroupedObject,
+		},
+		{
+			name: "DigestMismatch",
+			kr:   openpgp.EntityList{e},
+			waivers: [][]byte{sign([]uint32{2}, []uint32{2}, future, func(wv *Waiver) {
+				wv.Objects[0].Digest = "sha256:0000"
+			})},
+			wantErr: errNonGroupedObject,
+		},
+		{
+			name: "GroupDigestMismatch",
+			kr:   openpgp.EntityList{e},
+			waivers: [][]byte{objectWaiver, sign(nil, []uint32{2}, future, func(wv *Waiver) {
+				wv.Groups[0].Objects[0].Digest = "sha256:0000"
+			})},
+			wantErr: &SignatureNotFoundError{ID: 2, IsGroup: true},
+		},
+		{
+			name: "GroupObjectsMismatch",
+			kr:   openpgp.EntityList{e},
+			waivers: [][]byte{objectWaiver, sign(nil, []uint32{2}, future, func(wv *Waiver) {
+				wv.Groups[0].Objects = nil
+			})},
+			wantErr: &SignatureNotFoundError{ID: 2, IsGroup: true},
+		},
+		{
+			name:    "ImageMismatch",
+			kr:      openpgp.EntityList{e},
+			waivers: [][]byte{sign([]uint32{2}, nil, future, imageMismatch)},
+			wantErr: errWaiverImageMismatch,
+		},
+		{
+			name:    "Untrusted",
+			kr:      openpgp.EntityList{e},
+			waivers: [][]byte{signAs(other, []uint32{2}, nil, future, nil)},
+			wantErr: errWaiverInvalid,
+		},
+		{
+			name: "UnusableNotNeeded",
+			kr:   openpgp.EntityList{e},
+			waivers: [][]byte{
+				objectWaiver,
+				groupWaiver,
+				sign([]uint32{2}, nil, future, imageMismatch),
+				signAs(other, []uint32{2}, nil, future, nil),
+				[]byte("not a waiver"),
+			},
+			wantApplied:  2,
+			wantRejected: 3,
+		},
+		{
+			name: "UnusableExpired",
+			kr:   openpgp.EntityList{e},
+			waivers: [][]byte{
+				objectWaiver,
+				groupWaiver,
+				sign([]uint32{2}, nil, past, imageMismatch),
+			},
+			wantApplied: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []VerifierOpt{OptVerifyWithKeyRing(tt.kr)}
+			for _, b := range tt.waivers {
+				opts = append(opts, OptVerifyWaiver(b))
+			}
+
+			v, err := NewVerifier(&f, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := v.Verify(), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if got, want := len(v.AppliedWaivers()), tt.wantApplied; tt.wantErr == nil && got != want {
+				t.Errorf("got %v applied waivers, want %v", got, want)
+			}
+			if got, want := len(v.RejectedWaivers()), tt.wantRejected; tt.wantErr == nil && got != want {
+				t.Errorf("got %v rejected waivers, want %v", got, want)
+			}
+		})
+	}
+
+	// Waivers stored in the image are only considered on request.
+	if err := AddWaiver(&f, sign([]uint32{2}, []uint32{2}, future, nil)); err != nil {
+		t.Fatal(err)
+	}
+	load()
+
+	for _, imageWaivers := range []bool{false, true} {
+		opts := []VerifierOpt{OptVerifyWithKeyRing(openpgp.EntityList{e})}
+		if imageWaivers {
+			opts = append(opts, OptVerifyImageWaivers())
+		}
+
+		v, err := NewVerifier(&f, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = v.Verify()
+		if imageWaivers && err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+		if !imageWaivers && !errors.Is(err, errNonGroupedObject) {
+			t.Errorf("got error %v, want %v", err, errNonGroupedObject)
+		}
+
+		if imageWaivers {
+			for _, aw := range v.AppliedWaivers() {
+				if got, want := aw.Source, uint32(5); got != want {
+					t.Errorf("got waiver source %v, want %v", got, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+)
+
+// ErrNotMapped is the code for when an operation requires a memory mapped image, but the image is
+// accessed through buffered I/O.
+var ErrNotMapped = errors.New("image is not memory mapped")
+
+// Advice describes how memory mapped data is expected to be accessed, allowing the kernel to
+// tune read-ahead and caching accordingly.
+type Advice int
+
+// List of supported advice.
+const (
+	AdviceNormal     Advice = iota // no special treatment
+	AdviceSequential               // expect sequential access, read ahead aggressively
+	AdviceRandom                   // expect random access, disable read ahead
+	AdviceWillNeed                 // expect access in the near future, start reading now
+	AdviceDontNeed                 // do not expect access in the near future, free cached pages
+)
+
+// madvise returns the madvise(2) advice corresponding to a.
+func (a Advice) madvise() (int, error) {
+	switch a {
+	case AdviceNormal:
+		return syscall.MADV_NORMAL, nil
+	case AdviceSequential:
+		return syscall.MADV_SEQUENTIAL, nil
+	case AdviceRandom:
+		return syscall.MADV_RANDOM, nil
+	case AdviceWillNeed:
+		return syscall.MADV_WILLNEED, nil
+	case AdviceDontNeed:
+		return syscall.MADV_DONTNEED, nil
+	}
+	return 0, fmt.Errorf("unknown advice %d", a)
+}
+
+// mappedData returns the page aligned region of the memory mapping of fimg that holds the data
+// object associated with descriptor d.
+func (d *Descriptor) mappedData(fimg *FileImage) ([]byte, error) {
+	if fimg.Amodebuf {
+		return nil, ErrNotMapped
+	}
+
+	if !d.inMapping(fimg) {
+		return nil, fmt.Errorf("data object %d extends past end of mapping", d.ID)
+	}
+
+	start := d.Fileoff &^ int64(syscall.Getpagesize()-1)
+	return fimg.Filedata[start : d.Fileoff+d.Filelen], nil
+}
+
+// Advise advises the kernel how the data object associated with descriptor d will be accessed
+// through the memory mapping of image fimg. If fimg is not memory mapped, Advise does nothing, as
+// buffered I/O is not affected by the advice.
+func (d *Descriptor) Advise(fimg *FileImage, a Advice) error {
+	advice, err := a.madvise()
+	if err != nil {
+		return err
+	}
+
+	b, err := d.mappedData(fimg)
+	if errors.Is(err, ErrNotMapped) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(b) == 0 {
+		return nil
+	}
+	if err := madvise(b, advice); err != nil {
+		return fmt.Errorf("while advising on data object %d: %s", d.ID, err)
+	}
+	return nil
+}
+
+// GetMappedReadSeeker returns an io.ReadSeeker that reads the data object associated with
+// descriptor d directly from the memory mapping of image fimg, after advising the kernel of the
+// expected access pattern a. This suits workloads such as verification of images larger than
+// RAM, where AdviceSequential lets the kernel read ahead and drop pages once they are consumed.
+//
+// If fimg is not memory mapped, ErrNotMapped is returned, and GetReadSeeker should be used
+// instead.
+func (d *Descriptor) GetMappedReadSeeker(fimg *FileImage, a Advice) (io.ReadSeeker, error) {
+	if fimg.Amodebuf {
+		return nil, ErrNotMapped
+	}
+
+	if err := d.Advise(fimg, a); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(fimg.Filedata[d.Fileoff : d.Fileoff+d.Filelen]), nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdvise(t *testing.T) {
+	fimg, err := LoadContainer(filepath.Join("testdata", "testcontainer2.sif"), true)
+	if err != nil {
+		t.Fatalf("failed to load container: %v", err)
+	}
+	defer func() {
+		if err := fimg.UnloadContainer(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	descr, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatalf("failed to get descriptor: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		advice   Advice
+		buffered bool
+		wantErr  bool
+	}{
+		{"Normal", AdviceNormal, false, false},
+		{"Sequential", AdviceSequential, false, false},
+		{"Random", AdviceRandom, false, false},
+		{"WillNeed", AdviceWillNeed, false, false},
+		{"DontNeed", AdviceDontNeed, false, false},
+		{"Unknown", Advice(-1), false, true},
+		{"Buffered", AdviceSequential, true, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fimg.Amodebuf = tt.buffered // apply hack to fake buffered I/O
+			defer func() { fimg.Amodebuf = false }()
+
+			if err := descr.Advise(&fimg, tt.advice); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetMappedReadSeeker(t *testing.T) {
+	fimg, err := LoadContainer(filepath.Join("testdata", "testcontainer2.sif"), true)
+	if err != nil {
+		t.Fatalf("failed to load container: %v", err)
+	}
+	defer func() {
+		if err := fimg.UnloadContainer(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// Get the signature block
+	descr, _, err := fimg.GetFromDescrID(3)
+	if err != nil {
+		t.Fatalf("failed to get descriptor: %v", err)
+	}
+
+	rs, err := descr.GetMappedReadSeeker(&fimg, AdviceSequential)
+	if err != nil {
+		t.Fatalf("failed to get mapped reader: %v", err)
+	}
+
+	b, err := ioutil.ReadAll(rs)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if got, want := string(b[5:10]), "BEGIN"; got != want {
+		t.Errorf("got data %#v, want %#v", got, want)
+	}
+
+	fimg.Amodebuf = true // apply hack to fake buffered I/O
+	defer func() { fimg.Amodebuf = false }()
+
+	if _, err := descr.GetMappedReadSeeker(&fimg, AdviceSequential); !errors.Is(err, ErrNotMapped) {
+		t.Errorf("got error %v, want %v", err, ErrNotMapped)
+	}
+}
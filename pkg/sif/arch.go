@@ -0,0 +1,201 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// By default, the global header Arch field is derived from the primary system partition, and is
+// maintained as partitions are added, deleted, or made primary. Images that contain partitions
+// for more than one architecture may instead set the header Arch explicitly, following which it
+// is left unchanged until automatic derivation is restored.
+//
+// Setting the header Arch to HdrArchMulti marks the image as multi-architecture. A
+// multi-architecture image may contain one primary system partition per architecture, which may
+// be located with GetPartPrimSysForArch. The PrimPartID of such an image is that of the primary
+// system partition for the architecture of the running program, if any.
+
+var (
+	errArchInvalid             = errors.New("architecture not supported")
+	errArchExplicitUnsupported = errors.New("explicit architecture requires SIF version 02 or later")
+	errArchMultiPrimary        = errors.New("image contains primary partitions for more than one architecture")
+)
+
+// IsMultiArch returns true if the image may contain primary system partitions for more than one
+// architecture, as indicated by a global header Arch field of HdrArchMulti.
+func (fimg *FileImage) IsMultiArch() bool {
+	return fimg.Header.GetArch() == HdrArchMulti
+}
+
+// primParts returns the indices of the primary system partitions of the image. If arch is not
+// empty, only partitions for SIF arch code arch are returned.
+func (fimg *FileImage) primParts(arch string) ([]int, error) {
+	var indices []int
+
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataPartition {
+			continue
+		}
+
+		ptype, err := v.GetPartType()
+		if err != nil {
+			return nil, err
+		}
+		if ptype != PartPrimSys {
+			continue
+		}
+
+		if arch != "" {
+			a, err := v.GetArch()
+			if err != nil {
+				return nil, err
+			}
+			if trimZeroBytes(a[:]) != arch {
+				continue
+			}
+		}
+
+		indices = append(indices, i)
+	}
+
+	return indices, nil
+}
+
+// GetPartPrimSysForArch returns the primary system partition for the architecture goarch, which
+// is specified as a Go GOARCH value. Unlike GetPartPrimSys, this may be used with
+// multi-architecture images. If the image contains no primary system partition for goarch,
+// ErrNotFound is returned.
+func (fimg *FileImage) GetPartPrimSysForArch(goarch string) (*Descriptor, int, error) {
+	arch := GetSIFArch(goarch)
+	if arch == HdrArchUnknown || arch == HdrArchMulti {
+		return nil, -1, fmt.Errorf("%w: %q", errArchInvalid, goarch)
+	}
+
+	indices, err := fimg.primParts(arch)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	switch len(indices) {
+	case 0:
+		return nil, -1, ErrNotFound
+	case 1:
+		return &fimg.DescrArr[indices[0]], indices[0], nil
+	default:
+		return nil, -1, ErrMultValues
+	}
+}
+
+// setPrimPartID sets PrimPartID to the ID of the primary system partition of the image, or of
+// the primary system partition for the running architecture for a multi-architecture image. If
+// there is no such partition, PrimPartID is set to zero.
+func (fimg *FileImage) setPrimPartID() {
+	var d *Descriptor
+	if fimg.IsMultiArch() {
+		d, _, _ = fimg.GetPartPrimSysForArch(runtime.GOARCH)
+	} else {
+		d, _, _ = fimg.GetPartPrimSys()
+	}
+
+	fimg.PrimPartID = 0
+	if d != nil {
+		fimg.PrimPartID = d.ID
+	}
+}
+
+// IsArchExplicit returns true if the global header Arch field of the image is set explicitly,
+// rather than derived from the primary system partition.
+func (fimg *FileImage) IsArchExplicit() bool {
+	return fimg.flags&hdrFlagArchExplicit != 0
+}
+
+// deriveArch sets the global header Arch field to arch, the architecture of the primary system
+// partition, unless the header Arch is set explicitly.
+func (fimg *FileImage) deriveArch(arch [HdrArchLen]byte) {
+	if !fimg.IsArchExplicit() {
+		copy(fimg.Header.Arch[:], arch[:])
+	}
+}
+
+// primPartArch returns the architecture of the primary system partition, or HdrArchUnknown if the
+// image does not contain one.
+func (fimg *FileImage) primPartArch() ([HdrArchLen]byte, error) {
+	var arch [HdrArchLen]byte
+
+	d, _, err := fimg.GetPartPrimSys()
+	if errors.Is(err, ErrNotFound) {
+		copy(arch[:], HdrArchUnknown)
+		return arch, nil
+	} else if err != nil {
+		return arch, err
+	}
+
+	return d.GetArch()
+}
+
+// SetArch sets the global header Arch field to the SIF arch code arch (such as HdrArchAMD64), and
+// marks it as explicit, so that it is no longer derived from the primary system partition. This
+// is intended for images containing partitions for more than one architecture. Setting an
+// explicit arch requires an image of SIF version 02 or later.
+//
+// If arch is empty, automatic derivation is restored, and the header Arch is updated from the
+// primary system partition. This may be used to correct the header Arch of an image of any
+// version.
+//
+// Setting arch to HdrArchMulti marks the image as multi-architecture, so that primary system
+// partitions for more than one architecture may be added. Once an image contains more than one
+// primary system partition, it cannot be set to any other arch.
+func (fimg *FileImage) SetArch(arch string) error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+
+	if arch != HdrArchMulti {
+		indices, err := fimg.primParts("")
+		if err != nil {
+			return err
+		}
+		if len(indices) > 1 {
+			return errArchMultiPrimary
+		}
+	}
+
+	if arch == "" {
+		a, err := fimg.primPartArch()
+		if err != nil {
+			return err
+		}
+		fimg.flags &^= hdrFlagArchExplicit
+		fimg.deriveArch(a)
+	} else {
+		if arch != HdrArchUnknown && GetGoArch(arch) == "unknown" {
+			return fmt.Errorf("%w: %q", errArchInvalid, arch)
+		}
+		if !hasHeaderExt(fimg.Header.GetVersion()) {
+			return errArchExplicitUnsupported
+		}
+
+		var a [HdrArchLen]byte
+		copy(a[:], arch)
+		fimg.Header.Arch = a
+		fimg.flags |= hdrFlagArchExplicit
+	}
+	fimg.setPrimPartID()
+
+	fimg.Header.Mtime = fimg.now()
+	if err := writeHeader(fimg); err != nil {
+		return err
+	}
+
+	if err := fimg.Fp.Sync(); err != nil {
+		return fmt.Errorf("while sync'ing SIF file: %s", err)
+	}
+
+	return nil
+}
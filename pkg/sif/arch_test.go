@@ -0,0 +1,251 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestSetArch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-arch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	part := func(t *testing.T, pt Parttype, arch string) DescriptorInput {
+		di := DescriptorInput{
+			Datatype: DataPartition,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     4,
+			Fname:    "part",
+			Data:     []byte("part"),
+		}
+		if err := di.SetPartExtra(FsSquash, pt, arch); err != nil {
+			t.Fatal(err)
+		}
+		return di
+	}
+
+	create := func(t *testing.T, name, version string) string {
+		cinfo := CreateInfo{
+			Pathname:   filepath.Join(dir, name),
+			Launchstr:  HdrLaunch,
+			Sifversion: version,
+			ID:         uuid.NewV4(),
+			InputDescr: []DescriptorInput{
+				part(t, PartPrimSys, HdrArchAMD64),
+				part(t, PartSystem, HdrArchARM64),
+			},
+		}
+		if _, err := CreateContainer(cinfo); err != nil {
+			t.Fatal(err)
+		}
+		return cinfo.Pathname
+	}
+
+	checkArch := func(t *testing.T, fimg *FileImage, want string) {
+		t.Helper()
+
+		if got := fimg.Header.GetArch(); got != want {
+			t.Errorf("got arch %q, want %q", got, want)
+		}
+	}
+
+	t.Run("Explicit", func(t *testing.T) {
+		path := create(t, "explicit.sif", HdrVersion2)
+
+		fimg, err := LoadContainer(path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkArch(t, &fimg, HdrArchAMD64)
+
+		if err := fimg.SetArch("98"); !errors.Is(err, errArchInvalid) {
+			t.Errorf("got error %v, want %v", err, errArchInvalid)
+		}
+
+		if err := fimg.SetArch(HdrArchUnknown); err != nil {
+			t.Fatal(err)
+		}
+
+		// The explicit arch must survive a change of primary partition, and a reload.
+		if err := fimg.SetPrimPart(2); err != nil {
+			t.Fatal(err)
+		}
+		checkArch(t, &fimg, HdrArchUnknown)
+
+		if err := fimg.UnloadContainer(); err != nil {
+			t.Fatal(err)
+		}
+
+		fimg, err = LoadContainer(path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		if !fimg.IsArchExplicit() {
+			t.Error("arch not explicit after reload")
+		}
+		checkArch(t, &fimg, HdrArchUnknown)
+
+		// Restoring derivation must pick up the arch of the new primary partition.
+		if err := fimg.SetArch(""); err != nil {
+			t.Fatal(err)
+		}
+		if fimg.IsArchExplicit() {
+			t.Error("arch explicit after restoring derivation")
+		}
+		checkArch(t, &fimg, HdrArchARM64)
+	})
+
+	t.Run("Version1", func(t *testing.T) {
+		path := create(t, "v1.sif", HdrVersion1)
+
+		fimg, err := LoadContainer(path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		if err := fimg.SetArch(HdrArchARM64); !errors.Is(err, errArchExplicitUnsupported) {
+			t.Errorf("got error %v, want %v", err, errArchExplicitUnsupported)
+		}
+
+		// A mismatched header arch may be corrected on images of any version.
+		copy(fimg.Header.Arch[:], HdrArchS390x)
+		if err := fimg.SetArch(""); err != nil {
+			t.Fatal(err)
+		}
+		checkArch(t, &fimg, HdrArchAMD64)
+	})
+}
+
+func TestMultiArch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-arch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	part := func(t *testing.T, pt Parttype, arch string) DescriptorInput {
+		di := DescriptorInput{
+			Datatype: DataPartition,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     4,
+			Fname:    "part",
+			Data:     []byte("part"),
+		}
+		if err := di.SetPartExtra(FsSquash, pt, arch); err != nil {
+			t.Fatal(err)
+		}
+		return di
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "multi.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion2,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			part(t, PartPrimSys, HdrArchAMD64),
+			part(t, PartSystem, HdrArchARM64),
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second primary partition requires a multi-architecture image.
+	if err := fimg.AddObject(part(t, PartPrimSys, HdrArchARM64)); err == nil {
+		t.Fatal("unexpected success adding second primary partition")
+	}
+
+	if err := fimg.SetArch(HdrArchMulti); err != nil {
+		t.Fatal(err)
+	}
+	if !fimg.IsMultiArch() {
+		t.Error("image not multi-architecture")
+	}
+	if err := fimg.AddObject(part(t, PartPrimSys, HdrArchARM64)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err = LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	// Only one primary partition is permitted per architecture.
+	if err := fimg.AddObject(part(t, PartPrimSys, HdrArchAMD64)); err == nil {
+		t.Error("unexpected success adding second amd64 primary partition")
+	}
+
+	if got, want := GetGoArch(fimg.Header.GetArch()), "multi"; got != want {
+		t.Errorf("got arch %q, want %q", got, want)
+	}
+	if _, _, err := fimg.GetPartPrimSys(); !errors.Is(err, ErrMultValues) {
+		t.Errorf("got error %v, want %v", err, ErrMultValues)
+	}
+
+	checkPrimPart := func(t *testing.T, goarch string, wantID uint32, wantErr error) {
+		t.Helper()
+
+		d, _, err := fimg.GetPartPrimSysForArch(goarch)
+		if got, want := err, wantErr; !errors.Is(got, want) {
+			t.Fatalf("%v: got error %v, want %v", goarch, got, want)
+		}
+		if err == nil && d.ID != wantID {
+			t.Errorf("%v: got partition %v, want %v", goarch, d.ID, wantID)
+		}
+	}
+
+	checkPrimPart(t, "amd64", 1, nil)
+	checkPrimPart(t, "arm64", 3, nil)
+	checkPrimPart(t, "s390x", 0, ErrNotFound)
+	checkPrimPart(t, "multi", 0, errArchInvalid)
+
+	// Setting a primary partition demotes only that of the same architecture.
+	if err := fimg.SetPrimPart(2); err != nil {
+		t.Fatal(err)
+	}
+	checkPrimPart(t, "amd64", 1, nil)
+	checkPrimPart(t, "arm64", 2, nil)
+
+	var wantPrimPartID uint32
+	if d, _, err := fimg.GetPartPrimSysForArch(runtime.GOARCH); err == nil {
+		wantPrimPartID = d.ID
+	}
+	if got, want := fimg.PrimPartID, wantPrimPartID; got != want {
+		t.Errorf("got primary partition %v, want %v", got, want)
+	}
+
+	if err := fimg.SetArch(HdrArchAMD64); !errors.Is(err, errArchMultiPrimary) {
+		t.Errorf("got error %v, want %v", err, errArchMultiPrimary)
+	}
+	if err := fimg.SetArch(""); !errors.Is(err, errArchMultiPrimary) {
+		t.Errorf("got error %v, want %v", err, errArchMultiPrimary)
+	}
+}
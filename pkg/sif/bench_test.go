@@ -0,0 +1,325 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// The default object size keeps benchmarks quick enough for CI. Performance work should report
+// numbers at realistic scales, for example:
+//
+//	go test -run=^$ -bench=. -benchtime=3x -sif.bench-size=1073741824 ./pkg/sif
+//	go test -run=^$ -bench=. -benchtime=1x -sif.bench-size=10737418240 ./pkg/sif
+var benchSize = flag.Int64("sif.bench-size", 16<<20, "size in bytes of data objects used in benchmarks")
+
+// benchObjects is the number of data objects in benchmark images.
+const benchObjects = 4
+
+// syntheticPattern is the block of pseudo-random bytes repeated by syntheticReader.
+var syntheticPattern = func() []byte {
+	b := make([]byte, 1<<16)
+	for i, x := 0, uint32(2463534242); i < len(b); i++ {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		b[i] = byte(x)
+	}
+	return b
+}()
+
+// syntheticReader produces a deterministic stream of bytes without holding the whole object in
+// memory, and cheaply enough not to dominate benchmark results.
+type syntheticReader struct {
+	n int
+}
+
+func (r *syntheticReader) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		m := copy(b[n:], syntheticPattern[r.n:])
+		r.n = (r.n + m) % len(syntheticPattern)
+		n += m
+	}
+	return n, nil
+}
+
+// syntheticInput returns a DescriptorInput for a generic data object of the given size.
+func syntheticInput(size int64) DescriptorInput {
+	return DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "synthetic",
+		Fp:       io.LimitReader(&syntheticReader{}, size),
+		Size:     size,
+	}
+}
+
+// createBenchImage creates an image in dir containing n synthetic objects of the given size.
+func createBenchImage(tb testing.TB, dir string, n int, size int64) string {
+	tb.Helper()
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "bench.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+	}
+	for i := 0; i < n; i++ {
+		cinfo.InputDescr = append(cinfo.InputDescr, syntheticInput(size))
+	}
+
+	if _, err := CreateContainer(cinfo); err != nil {
+		tb.Fatal(err)
+	}
+	return cinfo.Pathname
+}
+
+// benchDir returns a temporary directory, removed when the benchmark completes.
+func benchDir(b *testing.B) string {
+	b.Helper()
+
+	dir, err := ioutil.TempDir("", "sif-bench-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func BenchmarkCreateContainer(b *testing.B) {
+	dir := benchDir(b)
+
+	b.SetBytes(benchObjects * *benchSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		createBenchImage(b, dir, benchObjects, *benchSize)
+	}
+}
+
+func BenchmarkLoadContainer(b *testing.B) {
+	path := createBenchImage(b, benchDir(b), benchObjects, *benchSize)
+
+	for _, rdonly := range []bool{true, false} {
+		name := "ReadWrite"
+		if rdonly {
+			name = "ReadOnly"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fimg, err := LoadContainer(path, rdonly)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := fimg.UnloadContainer(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFmtDescrList(b *testing.B) {
+	path := createBenchImage(b, benchDir(b), benchObjects, *benchSize)
+
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = fimg.FmtDescrList()
+	}
+}
+
+func BenchmarkGetData(b *testing.B) {
+	path := createBenchImage(b, benchDir(b), 1, *benchSize)
+
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(d.Filelen)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := io.Copy(ioutil.Discard, d.GetReadSeeker(&fimg)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetMappedReadSeeker(b *testing.B) {
+	path := createBenchImage(b, benchDir(b), 1, *benchSize)
+
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, a := range []struct {
+		name   string
+		advice Advice
+	}{
+		{name: "Normal", advice: AdviceNormal},
+		{name: "Sequential", advice: AdviceSequential},
+		{name: "WillNeed", advice: AdviceWillNeed},
+	} {
+		a := a
+
+		b.Run(a.name, func(b *testing.B) {
+			b.SetBytes(d.Filelen)
+
+			for i := 0; i < b.N; i++ {
+				rs, err := d.GetMappedReadSeeker(&fimg, a.advice)
+				if err != nil {
+					b.Fatal(err)
+				}
+				// Hide WriterTo, so that the data is actually read.
+				if _, err := io.Copy(ioutil.Discard, struct{ io.Reader }{rs}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// loadBenchImage creates an image in dir containing n synthetic objects of the given size, and
+// loads it read-write with opts.
+func loadBenchImage(b *testing.B, dir string, n int, size int64, opts ...LoadOpt) FileImage {
+	b.Helper()
+
+	fimg, err := LoadContainer(createBenchImage(b, dir, n, size), false, opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return fimg
+}
+
+// benchBufferSizes are the buffer sizes compared by benchmarks of copying and moving data objects.
+var benchBufferSizes = []int{32 << 10, DefaultBufferSize, 8 << 20}
+
+func BenchmarkAddObject(b *testing.B) {
+	for _, size := range benchBufferSizes {
+		opt := OptLoadBufferSize(size)
+
+		b.Run(fmt.Sprintf("Buffer%dK", size>>10), func(b *testing.B) {
+			dir := benchDir(b)
+
+			b.SetBytes(*benchSize)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				// Start from an empty image each time, so disk usage does not grow with b.N.
+				b.StopTimer()
+				fimg := loadBenchImage(b, dir, 0, 0, opt)
+				b.StartTimer()
+
+				if err := fimg.AddObject(syntheticInput(*benchSize)); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				if err := fimg.UnloadContainer(); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func BenchmarkCompact(b *testing.B) {
+	for _, size := range benchBufferSizes {
+		opt := OptLoadBufferSize(size)
+
+		b.Run(fmt.Sprintf("Buffer%dK", size>>10), func(b *testing.B) {
+			dir := benchDir(b)
+
+			b.SetBytes(*benchSize)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				fimg := loadBenchImage(b, dir, 2, *benchSize, opt)
+				b.StartTimer()
+
+				// Deleting the first object moves the second into its place.
+				if err := fimg.DeleteObject(1, DelCompact); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				if err := fimg.UnloadContainer(); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func BenchmarkDeleteObject(b *testing.B) {
+	for _, flags := range []struct {
+		name  string
+		flags int
+	}{
+		{name: "Zero", flags: DelZero},
+		{name: "Compact", flags: DelCompact},
+	} {
+		flags := flags
+
+		b.Run(flags.name, func(b *testing.B) {
+			dir := benchDir(b)
+
+			b.SetBytes(*benchSize)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				fimg := loadBenchImage(b, dir, 1, *benchSize)
+				b.StartTimer()
+
+				if err := fimg.DeleteObject(1, flags.flags); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				if err := fimg.UnloadContainer(); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
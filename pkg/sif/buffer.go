@@ -0,0 +1,35 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import "errors"
+
+// DefaultBufferSize is the size of the buffer through which data objects are copied into an image,
+// and moved within it, if not specified.
+const DefaultBufferSize = 1 << 20
+
+var errBufferSize = errors.New("buffer size must not be negative")
+
+// OptLoadBufferSize specifies the size of the buffer through which data objects are copied into
+// the image, and moved within it when the image is compacted or its descriptor table is grown. If
+// n is zero, DefaultBufferSize is used.
+func OptLoadBufferSize(n int) LoadOpt {
+	return func(lo *loadOpts) error {
+		if n < 0 {
+			return errBufferSize
+		}
+		lo.bufferSize = n
+		return nil
+	}
+}
+
+// buffer returns a buffer through which data objects of fimg are copied.
+func (fimg *FileImage) buffer() []byte {
+	if fimg.bufferSize > 0 {
+		return make([]byte, fimg.bufferSize)
+	}
+	return make([]byte, DefaultBufferSize)
+}
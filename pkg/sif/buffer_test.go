@@ -0,0 +1,133 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestCreateBufferSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-buffer-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	payload := bytes.Repeat([]byte("buffered"), 1000)
+
+	tests := []struct {
+		name       string
+		bufferSize int
+		wantErr    error
+	}{
+		{name: "Default"},
+		{name: "Small", bufferSize: 7},
+		{name: "Negative", bufferSize: -1, wantErr: errBufferSize},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				ID:         uuid.NewV4(),
+				BufferSize: tt.bufferSize,
+				InputDescr: []DescriptorInput{
+					{
+						Datatype: DataGeneric,
+						Groupid:  DescrDefaultGroup,
+						Link:     DescrUnusedLink,
+						Size:     int64(len(payload)),
+						Fname:    "generic",
+						// Hide WriterTo, so that data is copied through the buffer.
+						Fp: struct{ io.Reader }{bytes.NewReader(payload)},
+					},
+				},
+			}
+
+			_, err := CreateContainer(cinfo)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			d, _, err := fimg.GetFromDescrID(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(d.GetData(&fimg), payload) {
+				t.Error("data does not match")
+			}
+		})
+	}
+}
+
+func TestOptLoadBufferSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-buffer-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	payloads := [][]byte{
+		[]byte("first"),
+		bytes.Repeat([]byte{2}, 5000),
+		[]byte("third"),
+	}
+
+	tests := []struct {
+		name       string
+		bufferSize int
+		wantErr    error
+	}{
+		{name: "Default"},
+		{name: "Small", bufferSize: 7},
+		{name: "Negative", bufferSize: -1, wantErr: errBufferSize},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".sif")
+			createCompactTestImage(t, path, payloads, []int{0, 0, 0})
+
+			fimg, err := LoadContainer(path, false, OptLoadBufferSize(tt.bufferSize))
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			if err := fimg.DeleteObject(1, DelCompact); err != nil {
+				t.Fatal(err)
+			}
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			checkCompacted(t, path, map[uint32][]byte{2: payloads[1], 3: payloads[2]})
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A build log object records how an image was produced, as a sequence of events appended during
+// image assembly. Events are stored one JSON object per line, so a log may be written
+// incrementally as the build progresses. The steps of the build, with their timings and exit
+// codes, are derived by replaying the events.
+
+var (
+	errBuildStepNotStarted = errors.New("build step not started")
+	errBuildStepRunning    = errors.New("build step already running")
+)
+
+// BuildLogName is the default name of build log objects.
+const BuildLogName = "build-log.jsonl"
+
+// BuildEventType represents the type of a build log event.
+type BuildEventType string
+
+// List of supported build log event types.
+const (
+	BuildEventStepStart BuildEventType = "step-start" // a build step started
+	BuildEventStepEnd   BuildEventType = "step-end"   // a build step finished
+	BuildEventMessage   BuildEventType = "message"    // informational message
+)
+
+// BuildEvent represents an event recorded in a build log.
+type BuildEvent struct {
+	Time     time.Time      `json:"time"`
+	Type     BuildEventType `json:"type"`
+	Step     string         `json:"step,omitempty"`
+	ExitCode int            `json:"exitCode,omitempty"`
+	Message  string         `json:"message,omitempty"`
+}
+
+// BuildStep represents a build step, as derived from the events of a build log.
+type BuildStep struct {
+	Name     string       // name of the step
+	Start    time.Time    // time the step started
+	End      time.Time    // time the step finished, if Finished
+	ExitCode int          // exit code of the step, if Finished
+	Finished bool         // whether the step finished
+	Messages []BuildEvent // messages recorded while the step was running
+}
+
+// BuildLog represents a structured image build log.
+type BuildLog struct {
+	Events []BuildEvent
+}
+
+// Append appends event e to l.
+func (l *BuildLog) Append(e BuildEvent) {
+	l.Events = append(l.Events, e)
+}
+
+// StartStep records that the named build step started at time t.
+func (l *BuildLog) StartStep(name string, t time.Time) {
+	l.Append(BuildEvent{Time: t, Type: BuildEventStepStart, Step: name})
+}
+
+// EndStep records that the named build step finished at time t with exitCode.
+func (l *BuildLog) EndStep(name string, t time.Time, exitCode int) {
+	l.Append(BuildEvent{Time: t, Type: BuildEventStepEnd, Step: name, ExitCode: exitCode})
+}
+
+// Message records an informational message at time t, associated with the named build step if
+// step is not empty.
+func (l *BuildLog) Message(step string, t time.Time, msg string) {
+	l.Append(BuildEvent{Time: t, Type: BuildEventMessage, Step: step, Message: msg})
+}
+
+// Steps replays the events of l, returning the build steps in the order they started. Steps that
+// started but did not finish are returned with Finished set to false.
+func (l *BuildLog) Steps() ([]BuildStep, error) {
+	var steps []BuildStep
+	running := make(map[string]int) // index of running steps, by name
+
+	for _, e := range l.Events {
+		switch e.Type {
+		case BuildEventStepStart:
+			if _, ok := running[e.Step]; ok {
+				return nil, fmt.Errorf("%w: %q", errBuildStepRunning, e.Step)
+			}
+			running[e.Step] = len(steps)
+			steps = append(steps, BuildStep{Name: e.Step, Start: e.Time})
+
+		case BuildEventStepEnd:
+			i, ok := running[e.Step]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", errBuildStepNotStarted, e.Step)
+			}
+			delete(running, e.Step)
+
+			steps[i].End = e.Time
+			steps[i].ExitCode = e.ExitCode
+			steps[i].Finished = true
+
+		case BuildEventMessage:
+			if i, ok := running[e.Step]; ok {
+				steps[i].Messages = append(steps[i].Messages, e)
+			}
+		}
+	}
+
+	return steps, nil
+}
+
+// WriteTo writes the events of l to w, one JSON object per line.
+func (l *BuildLog) WriteTo(w io.Writer) (int64, error) {
+	cw := countWriter{w: w}
+	enc := json.NewEncoder(&cw)
+
+	for _, e := range l.Events {
+		if err := enc.Encode(e); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ReadBuildLog reads a build log from r, as written by BuildLog.WriteTo. Blank lines are ignored.
+func ReadBuildLog(r io.Reader) (*BuildLog, error) {
+	l := BuildLog{}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		b := bytes.TrimSpace(s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		var e BuildEvent
+		if err := json.Unmarshal(b, &e); err != nil {
+			return nil, fmt.Errorf("decoding build log event: %s", err)
+		}
+		l.Events = append(l.Events, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading build log: %s", err)
+	}
+
+	return &l, nil
+}
+
+// NewBuildLogInput returns a DescriptorInput for a build log object containing the events of l,
+// in the default object group.
+func NewBuildLogInput(l *BuildLog) (DescriptorInput, error) {
+	b := bytes.Buffer{}
+	if _, err := l.WriteTo(&b); err != nil {
+		return DescriptorInput{}, err
+	}
+
+	return DescriptorInput{
+		Datatype: DataBuildLog,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(b.Len()),
+		Fname:    BuildLogName,
+		Data:     b.Bytes(),
+	}, nil
+}
+
+// GetBuildLog reads the build log from the data object described by d.
+func (d *Descriptor) GetBuildLog(fimg *FileImage) (*BuildLog, error) {
+	if d.Datatype != DataBuildLog {
+		return nil, fmt.Errorf("expected DataBuildLog, got %v", d.Datatype)
+	}
+	return ReadBuildLog(d.GetReadSeeker(fimg))
+}
+
+// GetBuildLog reads the build log of the image. If the image contains no build log, ErrNotFound
+// is returned. If it contains more than one, ErrMultValues is returned.
+func (fimg *FileImage) GetBuildLog() (*BuildLog, error) {
+	ds, _, err := fimg.GetFromDescr(Descriptor{Datatype: DataBuildLog})
+	if err != nil {
+		return nil, err
+	}
+	if len(ds) > 1 {
+		return nil, ErrMultValues
+	}
+	return ds[0].GetBuildLog(fimg)
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestBuildLogSteps(t *testing.T) {
+	t0 := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		build     func(l *BuildLog)
+		wantSteps []BuildStep
+		wantErr   error
+	}{
+		{
+			name: "Steps",
+			build: func(l *BuildLog) {
+				l.StartStep("bootstrap", t0)
+				l.Message("bootstrap", t0.Add(time.Second), "pulling base")
+				l.Message("", t0.Add(time.Second), "unrelated")
+				l.EndStep("bootstrap", t0.Add(2*time.Second), 0)
+				l.StartStep("post", t0.Add(3*time.Second))
+				l.EndStep("post", t0.Add(5*time.Second), 1)
+				l.StartStep("test", t0.Add(6*time.Second))
+			},
+			wantSteps: []BuildStep{
+				{
+					Name:     "bootstrap",
+					Start:    t0,
+					End:      t0.Add(2 * time.Second),
+					Finished: true,
+					Messages: []BuildEvent{
+						{Time: t0.Add(time.Second), Type: BuildEventMessage, Step: "bootstrap", Message: "pulling base"},
+					},
+				},
+				{Name: "post", Start: t0.Add(3 * time.Second), End: t0.Add(5 * time.Second), ExitCode: 1, Finished: true},
+				{Name: "test", Start: t0.Add(6 * time.Second)},
+			},
+		},
+		{
+			name: "NotStarted",
+			build: func(l *BuildLog) {
+				l.EndStep("post", t0, 0)
+			},
+			wantErr: errBuildStepNotStarted,
+		},
+		{
+			name: "AlreadyRunning",
+			build: func(l *BuildLog) {
+				l.StartStep("post", t0)
+				l.StartStep("post", t0)
+			},
+			wantErr: errBuildStepRunning,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var l BuildLog
+			tt.build(&l)
+
+			steps, err := l.Steps()
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if got, want := steps, tt.wantSteps; !reflect.DeepEqual(got, want) {
+				t.Errorf("got steps %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadBuildLog(t *testing.T) {
+	r := strings.NewReader(`{"time":"2020-06-01T12:00:00Z","type":"step-start","step":"post"}
+
+{"time":"2020-06-01T12:00:01Z","type":"step-end","step":"post","exitCode":2}
+`)
+
+	l, err := ReadBuildLog(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(l.Events), 2; got != want {
+		t.Fatalf("got %v events, want %v", got, want)
+	}
+	if got, want := l.Events[1].ExitCode, 2; got != want {
+		t.Errorf("got exit code %v, want %v", got, want)
+	}
+
+	if _, err := ReadBuildLog(strings.NewReader("{bad")); err == nil {
+		t.Error("unexpected success reading invalid build log")
+	}
+}
+
+func TestGetBuildLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-buildlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t0 := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var l BuildLog
+	l.StartStep("post", t0)
+	l.EndStep("post", t0.Add(time.Minute), 0)
+
+	input, err := NewBuildLogInput(&l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{input},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	got, err := fimg.GetBuildLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, &l) {
+		t.Errorf("got build log %+v, want %+v", got, &l)
+	}
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.GetName(), BuildLogName; got != want {
+		t.Errorf("got name %v, want %v", got, want)
+	}
+	if got, want := d.GetMediaType(), "application/vnd.sylabs.sif.object.buildlog.v1"; got != want {
+		t.Errorf("got media type %v, want %v", got, want)
+	}
+
+	empty := FileImage{}
+	if _, err := empty.GetBuildLog(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrNotFound)
+	}
+}
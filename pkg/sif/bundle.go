@@ -0,0 +1,179 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+)
+
+// A bundle object holds a number of small named files, such as configuration files, in a single
+// data object, so that embedding them does not exhaust the descriptor table. Files are framed as
+// a tar archive, so a bundle may also be extracted with standard tools.
+
+var (
+	errBundleEmpty         = errors.New("bundle contains no files")
+	errBundleNameInvalid   = errors.New("bundle file name invalid")
+	errBundleNameDuplicate = errors.New("bundle file name duplicated")
+)
+
+// BundleName is the default name of bundle objects.
+const BundleName = "bundle.tar"
+
+// BundleFile represents a file held in a bundle object.
+type BundleFile struct {
+	Name string // slash-separated relative path of the file
+	Data []byte // content of the file
+}
+
+// BundleEntry describes a file held in a bundle object.
+type BundleEntry struct {
+	Name string // slash-separated relative path of the file
+	Size int64  // size of the file, in bytes
+}
+
+// checkBundleName returns an error if name is not a clean, relative, slash-separated path.
+func checkBundleName(name string) error {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name ||
+		name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("%w: %q", errBundleNameInvalid, name)
+	}
+	return nil
+}
+
+// writeBundle writes files to w, framed as a tar archive. Headers are fixed apart from the name
+// and size of each file, so that the same files always produce the same bundle.
+func writeBundle(w io.Writer, files []BundleFile) error {
+	if len(files) == 0 {
+		return errBundleEmpty
+	}
+
+	names := make(map[string]bool)
+	tw := tar.NewWriter(w)
+
+	for _, f := range files {
+		if err := checkBundleName(f.Name); err != nil {
+			return err
+		}
+		if names[f.Name] {
+			return fmt.Errorf("%w: %q", errBundleNameDuplicate, f.Name)
+		}
+		names[f.Name] = true
+
+		h := tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.Name,
+			Size:     int64(len(f.Data)),
+			Mode:     0644,
+			ModTime:  time.Unix(0, 0),
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(&h); err != nil {
+			return fmt.Errorf("writing bundle file %q: %s", f.Name, err)
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return fmt.Errorf("writing bundle file %q: %s", f.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("writing bundle: %s", err)
+	}
+	return nil
+}
+
+// NewBundleInput returns a DescriptorInput for a bundle object holding files, in the default
+// object group. Each file must have a unique, clean, relative name.
+func NewBundleInput(files []BundleFile) (DescriptorInput, error) {
+	b := bytes.Buffer{}
+	if err := writeBundle(&b, files); err != nil {
+		return DescriptorInput{}, err
+	}
+
+	return DescriptorInput{
+		Datatype: DataBundle,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(b.Len()),
+		Fname:    BundleName,
+		Data:     b.Bytes(),
+	}, nil
+}
+
+// walkBundle calls fn for each regular file in the bundle object described by d, until fn
+// returns false.
+func (d *Descriptor) walkBundle(fimg *FileImage, fn func(h *tar.Header, r io.Reader) (bool, error)) error {
+	if d.Datatype != DataBundle {
+		return fmt.Errorf("expected DataBundle, got %v", d.Datatype)
+	}
+
+	tr := tar.NewReader(d.GetReadSeeker(fimg))
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading bundle: %s", err)
+		}
+
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		more, err := fn(h, tr)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// GetBundleEntries returns the files held in the bundle object described by d, in the order they
+// are stored.
+func (d *Descriptor) GetBundleEntries(fimg *FileImage) ([]BundleEntry, error) {
+	var entries []BundleEntry
+
+	err := d.walkBundle(fimg, func(h *tar.Header, _ io.Reader) (bool, error) {
+		entries = append(entries, BundleEntry{Name: h.Name, Size: h.Size})
+		return true, nil
+	})
+	return entries, err
+}
+
+// GetBundleFile returns the content of the file with the specified name held in the bundle object
+// described by d. If the bundle holds no such file, an error wrapping ErrNotFound is returned.
+func (d *Descriptor) GetBundleFile(fimg *FileImage, name string) ([]byte, error) {
+	var b []byte
+	found := false
+
+	err := d.walkBundle(fimg, func(h *tar.Header, r io.Reader) (bool, error) {
+		if h.Name != name {
+			return true, nil
+		}
+
+		var err error
+		if b, err = ioutil.ReadAll(r); err != nil {
+			return false, fmt.Errorf("reading bundle file %q: %s", name, err)
+		}
+		found = true
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("bundle file %q: %w", name, ErrNotFound)
+	}
+	return b, nil
+}
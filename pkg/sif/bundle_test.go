@@ -0,0 +1,154 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestNewBundleInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []BundleFile
+		wantErr error
+	}{
+		{name: "Empty", wantErr: errBundleEmpty},
+		{name: "NameEmpty", files: []BundleFile{{Name: ""}}, wantErr: errBundleNameInvalid},
+		{name: "NameAbsolute", files: []BundleFile{{Name: "/etc/passwd"}}, wantErr: errBundleNameInvalid},
+		{name: "NameParent", files: []BundleFile{{Name: "../passwd"}}, wantErr: errBundleNameInvalid},
+		{name: "NameUnclean", files: []BundleFile{{Name: "etc//passwd"}}, wantErr: errBundleNameInvalid},
+		{
+			name:    "NameDuplicate",
+			files:   []BundleFile{{Name: "a.conf"}, {Name: "a.conf"}},
+			wantErr: errBundleNameDuplicate,
+		},
+		{name: "OK", files: []BundleFile{{Name: "etc/a.conf", Data: []byte("a")}, {Name: "b.conf"}}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := NewBundleInput(tt.files)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if err == nil {
+				if got, want := SniffContent(input.Data, true), ContentTar; got != want {
+					t.Errorf("got content %v, want %v", got, want)
+				}
+
+				// The same files must always produce the same bundle.
+				again, err := NewBundleInput(tt.files)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(input.Data, again.Data) {
+					t.Error("bundle not reproducible")
+				}
+			}
+		})
+	}
+}
+
+func TestGetBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-bundle-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []BundleFile{
+		{Name: "etc/resolv.conf", Data: []byte("nameserver 192.0.2.1\n")},
+		{Name: "etc/hosts", Data: []byte("127.0.0.1 localhost\n")},
+		{Name: "empty", Data: []byte{}},
+	}
+
+	input, err := NewBundleInput(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generic := DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     4,
+		Fname:    "generic",
+		Data:     []byte("data"),
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{input, generic},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.GetName(), BundleName; got != want {
+		t.Errorf("got name %v, want %v", got, want)
+	}
+	if _, err := d.CheckContent(&fimg); err != nil {
+		t.Errorf("unexpected content error: %v", err)
+	}
+
+	entries, err := d.GetBundleEntries(&fimg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BundleEntry{
+		{Name: "etc/resolv.conf", Size: 21},
+		{Name: "etc/hosts", Size: 20},
+		{Name: "empty", Size: 0},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got entries %+v, want %+v", entries, want)
+	}
+
+	for _, f := range files {
+		b, err := d.GetBundleFile(&fimg, f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, f.Data) {
+			t.Errorf("%s: got %q, want %q", f.Name, b, f.Data)
+		}
+	}
+
+	if _, err := d.GetBundleFile(&fimg, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrNotFound)
+	}
+
+	g, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.GetBundleEntries(&fimg); err == nil {
+		t.Error("unexpected success listing generic object")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+var (
+	// ErrNoFreeDescriptor is the code for when the descriptor table of an image has no free entry.
+	ErrNoFreeDescriptor = errors.New("no descriptor table free entry")
+
+	// ErrInsufficientSpace is the code for when there is not enough space to store a data object.
+	ErrInsufficientSpace = errors.New("insufficient space for data object")
+)
+
+var errObjectSizeInvalid = errors.New("data object size invalid")
+
+// CanAdd reports whether a data object of the given datatype and size, in bytes, can be added to
+// the image with AddObject, using the default alignment. If not, the reason is returned as an
+// error. The image must not be sealed, the datatype must be known, and a free descriptor must be
+// available, or the descriptor table must be able to grow to provide one. The data section of the
+// image must also be able to grow to hold the object, having been moved to make room for a grown
+// descriptor table if required: images stored on block devices are limited by the size of the
+// device, and images stored in regular files by the space available to the file system.
+//
+// CanAdd allows tools to plan additions before copying large amounts of data. Since the file
+// system is shared, space available when CanAdd is called may not be available to AddObject.
+func (fimg *FileImage) CanAdd(size int64, datatype Datatype) (bool, error) {
+	if err := fimg.checkWritable(); err != nil {
+		return false, err
+	}
+
+	if size < 0 {
+		return false, fmt.Errorf("%w: %d", errObjectSizeInvalid, size)
+	}
+
+	if !isKnownDatatype(datatype) {
+		return false, fmt.Errorf("%w: datatype %#x", ErrUnknownType, int32(datatype))
+	}
+
+	// Growing the descriptor table may require the data section to be moved.
+	var delta int64
+	if fimg.Header.Dfree == 0 {
+		_, d, err := fimg.canGrowDescriptors()
+		if err != nil {
+			return false, err
+		}
+		delta = d
+	}
+
+	// Objects are appended to the data section, at the next aligned offset.
+	off := nextAligned(fimg.Header.Dataoff+delta+fimg.Header.Datalen, os.Getpagesize())
+	end := off + size
+	if end < off {
+		return false, fmt.Errorf("%w: size %d overflows image", ErrInsufficientSpace, size)
+	}
+
+	avail, err := fimg.availableSpace()
+	if err != nil {
+		return false, err
+	}
+	if need := end - fimg.Filesize; need > avail {
+		return false, fmt.Errorf("%w: need %d bytes, %d available", ErrInsufficientSpace, need, avail)
+	}
+
+	return true, nil
+}
+
+// availableSpace returns the number of bytes by which the image may grow beyond its current size.
+func (fimg *FileImage) availableSpace() (int64, error) {
+	info, err := fimg.Fp.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("getting image file info: %s", err)
+	}
+
+	// The size of a block device is fixed.
+	if info.Mode()&os.ModeDevice != 0 {
+		return 0, nil
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Fstatfs(int(fimg.Fp.Fd()), &st); err != nil {
+		return 0, fmt.Errorf("getting file system info: %s", err)
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
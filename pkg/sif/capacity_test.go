@@ -0,0 +1,111 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestCanAdd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-capacity-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	generic := DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     4,
+		Fname:    "generic",
+		Data:     []byte("data"),
+	}
+
+	// images of HdrVersion2 have a fixed descriptor table
+	create := func(t *testing.T, name string, inputs ...DescriptorInput) string {
+		cinfo := CreateInfo{
+			Pathname:   filepath.Join(dir, name),
+			Launchstr:  HdrLaunch,
+			Sifversion: HdrVersion2,
+			ID:         uuid.NewV4(),
+			InputDescr: inputs,
+			DescrCount: 2,
+		}
+		if _, err := CreateContainer(cinfo); err != nil {
+			t.Fatal(err)
+		}
+		return cinfo.Pathname
+	}
+
+	tests := []struct {
+		name     string
+		inputs   []DescriptorInput
+		seal     bool
+		size     int64
+		datatype Datatype
+		wantErr  error
+	}{
+		{name: "OK", inputs: []DescriptorInput{generic}, size: 1024, datatype: DataGeneric},
+		{name: "Empty", size: 0, datatype: DataDeffile},
+		{name: "SizeNegative", size: -1, datatype: DataGeneric, wantErr: errObjectSizeInvalid},
+		{name: "UnknownDatatype", size: 1, datatype: 0x4fff, wantErr: ErrUnknownType},
+		{
+			name:     "NoFreeDescriptor",
+			inputs:   []DescriptorInput{generic, generic},
+			size:     1,
+			datatype: DataGeneric,
+			wantErr:  ErrNoFreeDescriptor,
+		},
+		{name: "Sealed", seal: true, size: 1, datatype: DataGeneric, wantErr: ErrSealed},
+		{name: "TooLarge", size: math.MaxInt64 / 2, datatype: DataGeneric, wantErr: ErrInsufficientSpace},
+		{name: "Overflow", size: math.MaxInt64, datatype: DataGeneric, wantErr: ErrInsufficientSpace},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fimg, err := LoadContainer(create(t, tt.name+".sif", tt.inputs...), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			if tt.seal {
+				if err := fimg.Seal(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ok, err := fimg.CanAdd(tt.size, tt.datatype)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if got, want := ok, tt.wantErr == nil; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("AddObject", func(t *testing.T) {
+		fimg, err := LoadContainer(create(t, "add.sif", generic, generic), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		if err := fimg.AddObject(generic); !errors.Is(err, ErrNoFreeDescriptor) {
+			t.Errorf("got error %v, want %v", err, ErrNoFreeDescriptor)
+		}
+	})
+}
@@ -0,0 +1,422 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Build caches hosting many similar images may store data objects once, in a shared
+// content-addressed store, rather than in every image. A thin image retains the header and
+// descriptors of the original, but its data objects are replaced by a table of references to the
+// store. A thin image may be materialized into a standalone image identical to the original, so
+// signatures and seals remain valid.
+
+var (
+	// ErrNotInStore is the code for when content is not present in a content-addressed store.
+	ErrNotInStore = errors.New("content not in store")
+
+	// ErrThin is the code for when an operation requires the data of a thin image, which is held
+	// in a content-addressed store.
+	ErrThin = errors.New("image is thin")
+)
+
+var (
+	errThinUnsupported = errors.New("thin images require SIF version 02 or later")
+	errDigestInvalid   = errors.New("digest invalid")
+	errDigestMismatch  = errors.New("digest mismatch")
+	errRefInvalid      = errors.New("external reference invalid")
+)
+
+// ExternalRefsName is the name of the object holding the references of a thin image.
+const ExternalRefsName = "sif-external-refs.json"
+
+// ExternalRef describes a data object of a thin image, held in a content-addressed store.
+type ExternalRef struct {
+	ID       uint32 `json:"id"`
+	Digest   string `json:"digest"`
+	Fileoff  int64  `json:"fileoff"`
+	Filelen  int64  `json:"filelen"`
+	Storelen int64  `json:"storelen"`
+}
+
+// ExternalRefs is the content of the object holding the references of a thin image. The layout
+// of the original image is recorded, so that it may be materialized exactly.
+type ExternalRefs struct {
+	Mtime   int64         `json:"mtime"`
+	Datalen int64         `json:"datalen"`
+	Objects []ExternalRef `json:"objects"`
+}
+
+// Store is a content-addressed store of data object content. Content is identified by a digest of
+// the form "sha256:<hex>".
+type Store interface {
+	// Put adds the content read from r to the store, under digest. If the store already holds
+	// content with digest, r need not be read.
+	Put(digest string, r io.Reader) error
+
+	// Open returns a reader for the content with digest. If the store does not hold content with
+	// digest, an error wrapping ErrNotInStore is returned.
+	Open(digest string) (io.ReadCloser, error)
+}
+
+// DirStore is a Store that holds content in files within a directory, named by digest.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore returns a Store that holds content in files within dir, which is created if it does
+// not exist. The store may be shared by any number of images and processes.
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "sha256"), 0755); err != nil {
+		return nil, fmt.Errorf("creating store: %s", err)
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// path returns the path of the file holding content with digest.
+func (s *DirStore) path(digest string) (string, error) {
+	hexDigest := strings.TrimPrefix(digest, "sha256:")
+	if b, err := hex.DecodeString(hexDigest); err != nil || len(b) != sha256.Size ||
+		hexDigest == digest {
+		return "", fmt.Errorf("%w: %q", errDigestInvalid, digest)
+	}
+	return filepath.Join(s.dir, "sha256", hexDigest), nil
+}
+
+// Put adds the content read from r to the store, under digest. The content is verified against
+// digest before it is added.
+func (s *DirStore) Put(digest string, r io.Reader) error {
+	path, err := s.path(digest)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	// Content is written to a temporary file, and renamed into place once verified, so that
+	// concurrent readers never observe partial content.
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		return fmt.Errorf("writing content: %s", err)
+	}
+	if got := "sha256:" + hex.EncodeToString(h.Sum(nil)); got != digest {
+		return fmt.Errorf("%w: got %s, want %s", errDigestMismatch, got, digest)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing content: %s", err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Open returns a reader for the content with digest.
+func (s *DirStore) Open(digest string) (io.ReadCloser, error) {
+	path, err := s.path(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotInStore, digest)
+	}
+	return f, err
+}
+
+// IsThin returns true if the data objects of the image are held in a content-addressed store.
+func (fimg *FileImage) IsThin() bool {
+	return fimg.flags&hdrFlagThin != 0
+}
+
+// isThin returns true if the data object associated with descriptor d is held in a
+// content-addressed store rather than in fimg. Only the references themselves are held in a thin
+// image.
+func (d *Descriptor) isThin(fimg *FileImage) bool {
+	return fimg.IsThin() && !d.isExternalRefs()
+}
+
+// isExternalRefs returns true if d holds the references of a thin image.
+func (d *Descriptor) isExternalRefs() bool {
+	return d.Datatype == DataGenericJSON && d.GetName() == ExternalRefsName
+}
+
+// getExternalRefs returns the references of a thin image, and the index of the descriptor that
+// holds them.
+func (fimg *FileImage) getExternalRefs() (ExternalRefs, int, error) {
+	for i, d := range fimg.DescrArr {
+		if !d.Used || !d.isExternalRefs() {
+			continue
+		}
+
+		var refs ExternalRefs
+		if err := json.NewDecoder(d.readSeeker(fimg)).Decode(&refs); err != nil {
+			return ExternalRefs{}, 0, fmt.Errorf("decoding external references: %s", err)
+		}
+		return refs, i, nil
+	}
+	return ExternalRefs{}, 0, fmt.Errorf("external references: %w", ErrNotFound)
+}
+
+// checkExternalRefs checks that the data objects described by refs lie within a data section
+// starting at dataoff, and do not overlap. As refs are read from the thin image, they are not
+// trusted to describe a valid layout.
+func checkExternalRefs(refs ExternalRefs, dataoff int64) error {
+	if refs.Datalen < 0 {
+		return fmt.Errorf("%w: data section length %d", errRefInvalid, refs.Datalen)
+	}
+	end, err := addSize(dataoff, refs.Datalen)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRefInvalid, err)
+	}
+
+	objs := make([]ExternalRef, len(refs.Objects))
+	copy(objs, refs.Objects)
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Fileoff < objs[j].Fileoff })
+
+	prev := dataoff
+	for _, ref := range objs {
+		if ref.Filelen < 0 || ref.Storelen < 0 {
+			return fmt.Errorf("%w: object %d: negative length", errRefInvalid, ref.ID)
+		}
+		if ref.Fileoff < prev {
+			return fmt.Errorf("%w: object %d: offset %d overlaps data section or another object",
+				errRefInvalid, ref.ID, ref.Fileoff)
+		}
+		objEnd, err := addSize(ref.Fileoff, ref.Filelen)
+		if err != nil {
+			return fmt.Errorf("%w: object %d: %v", errRefInvalid, ref.ID, err)
+		}
+		if objEnd > end {
+			return fmt.Errorf("%w: object %d: ends at %d, beyond end of data section at %d",
+				errRefInvalid, ref.ID, objEnd, end)
+		}
+		prev = objEnd
+	}
+	return nil
+}
+
+// WriteThin adds the data objects of the image to store s, and writes a thin image to the file at
+// path, in which the data objects are replaced by references to s. A descriptor must be free to
+// hold the references. The image may be restored from the thin image with Materialize.
+//
+// Thin images may be listed and inspected, but their data may not be read, and they may not be
+// modified. Writing a thin image requires an image of SIF version 02 or later. The thin image is
+// created with the permissions of the image, plus write permission for the owner.
+func (fimg *FileImage) WriteThin(path string, s Store) error {
+	if fimg.IsThin() {
+		return ErrThin
+	}
+	if !hasHeaderExt(fimg.Header.GetVersion()) {
+		return errThinUnsupported
+	}
+	if fimg.Header.Dfree == 0 {
+		return ErrNoFreeDescriptor
+	}
+
+	refs := ExternalRefs{
+		Mtime:   fimg.Header.Mtime,
+		Datalen: fimg.Header.Datalen,
+		Objects: []ExternalRef{},
+	}
+
+	for _, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(h, d.GetReadSeeker(fimg)); err != nil {
+			return fmt.Errorf("computing digest of object %d: %s", d.ID, err)
+		}
+		digest := "sha256:" + hex.EncodeToString(h.Sum(nil))
+
+		if err := s.Put(digest, d.GetReadSeeker(fimg)); err != nil {
+			return fmt.Errorf("storing object %d: %w", d.ID, err)
+		}
+
+		refs.Objects = append(refs.Objects, ExternalRef{
+			ID:       d.ID,
+			Digest:   digest,
+			Fileoff:  d.Fileoff,
+			Filelen:  d.Filelen,
+			Storelen: d.Storelen,
+		})
+	}
+
+	b, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+
+	timg, err := copyTopOfFile(fimg, path)
+	if err != nil {
+		return err
+	}
+	defer timg.UnloadContainer() // nolint:errcheck
+
+	// Detach the data objects, and add the references in their place.
+	for i := range timg.DescrArr {
+		if timg.DescrArr[i].Used {
+			timg.DescrArr[i].Fileoff = 0
+			timg.DescrArr[i].Storelen = 0
+		}
+	}
+	timg.Header.Datalen = 0
+	flags := timg.flags
+	timg.flags = 0
+
+	err = timg.AddObject(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(b)),
+		Fname:    ExternalRefsName,
+		Data:     b,
+	})
+	if err != nil {
+		return fmt.Errorf("adding external references: %w", err)
+	}
+
+	timg.flags = flags | hdrFlagThin
+	if err := writeHeader(timg); err != nil {
+		return err
+	}
+
+	if err := timg.Fp.Sync(); err != nil {
+		return fmt.Errorf("while sync'ing thin SIF file: %s", err)
+	}
+
+	return nil
+}
+
+// Materialize writes a standalone image to the file at path, reading the data objects of the thin
+// image from store s. The standalone image is identical to the image from which the thin image
+// was written. The content of each data object is verified against its reference. As with
+// WriteThin, the file created is no more accessible to others than the thin image.
+func (fimg *FileImage) Materialize(path string, s Store) error {
+	if !fimg.IsThin() {
+		return fmt.Errorf("materializing image: %w", ErrNotFound)
+	}
+
+	refs, index, err := fimg.getExternalRefs()
+	if err != nil {
+		return err
+	}
+	if err := checkExternalRefs(refs, fimg.Header.Dataoff); err != nil {
+		return err
+	}
+
+	mimg, err := copyTopOfFile(fimg, path)
+	if err != nil {
+		return err
+	}
+	defer mimg.UnloadContainer() // nolint:errcheck
+
+	// Remove the references, restoring the descriptor table of the original image.
+	if err := resetDescriptor(mimg, index); err != nil {
+		return err
+	}
+	mimg.Header.Dfree++
+
+	for _, ref := range refs.Objects {
+		d, _, err := mimg.GetFromDescrID(ref.ID)
+		if err != nil {
+			return fmt.Errorf("object %d: %w", ref.ID, err)
+		}
+		d.Fileoff = ref.Fileoff
+		d.Filelen = ref.Filelen
+		d.Storelen = ref.Storelen
+
+		if err := materializeObject(mimg, s, ref); err != nil {
+			return fmt.Errorf("object %d: %w", ref.ID, err)
+		}
+	}
+
+	if err := writeDescriptors(mimg); err != nil {
+		return err
+	}
+
+	mimg.Header.Datalen = refs.Datalen
+	mimg.Header.Mtime = refs.Mtime
+	mimg.flags &^= hdrFlagThin
+	if err := writeHeader(mimg); err != nil {
+		return err
+	}
+
+	if err := mimg.Fp.Sync(); err != nil {
+		return fmt.Errorf("while sync'ing materialized SIF file: %s", err)
+	}
+
+	return nil
+}
+
+// materializeObject writes the content referenced by ref, read from store s, to fimg.
+func materializeObject(fimg *FileImage, s Store, ref ExternalRef) error {
+	rc, err := s.Open(ref.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if _, err := fimg.Fp.Seek(ref.Fileoff, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking to data object offset: %s", err)
+	}
+
+	// read at most one byte more than expected, so that excess content is detected without
+	// overwriting the data objects that follow
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(fimg.Fp, h), io.LimitReader(rc, ref.Filelen+1))
+	if err != nil {
+		return fmt.Errorf("writing data object: %s", err)
+	}
+
+	if got := "sha256:" + hex.EncodeToString(h.Sum(nil)); got != ref.Digest || n != ref.Filelen {
+		return fmt.Errorf("%w: got %s (%d bytes), want %s (%d bytes)",
+			errDigestMismatch, got, n, ref.Digest, ref.Filelen)
+	}
+	return nil
+}
+
+// copyTopOfFile writes the global header and descriptor table of fimg to a new file at path, and
+// loads it read-write. The file is created with the permissions given by fimg.fileMode.
+func copyTopOfFile(fimg *FileImage, path string) (*FileImage, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fimg.fileMode())
+	if err != nil {
+		return nil, fmt.Errorf("container file creation failed: %s", err)
+	}
+
+	if _, err := io.Copy(f, io.NewSectionReader(fimg.Fp, 0, fimg.Header.Dataoff)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("copying image: %s", err)
+	}
+
+	cimg, err := LoadContainerFp(f, false)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &cimg, nil
+}
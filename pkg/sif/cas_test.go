@@ -0,0 +1,285 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestWriteThin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-cas-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewDirStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	part := DescriptorInput{
+		Datatype: DataPartition,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     8192,
+		Fname:    "part",
+		Data:     bytes.Repeat([]byte{0xaa}, 8192),
+	}
+	if err := part.SetPartExtra(FsSquash, PartPrimSys, HdrArchAMD64); err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(t *testing.T, name, version string, deffile string, seal bool) string {
+		cinfo := CreateInfo{
+			Pathname:   filepath.Join(dir, name),
+			Launchstr:  HdrLaunch,
+			Sifversion: version,
+			ID:         uuid.NewV4(),
+			InputDescr: []DescriptorInput{
+				{
+					Datatype: DataDeffile,
+					Groupid:  DescrDefaultGroup,
+					Link:     DescrUnusedLink,
+					Size:     int64(len(deffile)),
+					Fname:    "deffile",
+					Data:     []byte(deffile),
+				},
+				part,
+			},
+		}
+		if _, err := CreateContainer(cinfo); err != nil {
+			t.Fatal(err)
+		}
+
+		if seal {
+			fimg, err := LoadContainer(cinfo.Pathname, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fimg.Seal(); err != nil {
+				t.Fatal(err)
+			}
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return cinfo.Pathname
+	}
+
+	writeThin := func(t *testing.T, path string) string {
+		fimg, err := LoadContainer(path, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		thinPath := path + ".thin"
+		if err := fimg.WriteThin(thinPath, s); err != nil {
+			t.Fatal(err)
+		}
+		return thinPath
+	}
+
+	// Two images sharing a partition are written thin, and the partition is stored once.
+	pathA := create(t, "a.sif", HdrVersion2, "bootstrap: a\n", true)
+	pathB := create(t, "b.sif", HdrVersion2, "bootstrap: b\n", false)
+	thinA := writeThin(t, pathA)
+	thinB := writeThin(t, pathB)
+
+	fis, err := ioutil.ReadDir(filepath.Join(dir, "store", "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two deffiles, one partition, and the manifest of the sealed image.
+	if got, want := len(fis), 4; got != want {
+		t.Errorf("got %v objects in store, want %v", got, want)
+	}
+
+	t.Run("Thin", func(t *testing.T) {
+		fimg, err := LoadContainer(thinB, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		if !fimg.IsThin() {
+			t.Error("image not thin")
+		}
+		if err := fimg.AddObject(part); !errors.Is(err, ErrThin) {
+			t.Errorf("got error %v, want %v", err, ErrThin)
+		}
+		if err := fimg.WriteThin(filepath.Join(dir, "thin.thin"), s); !errors.Is(err, ErrThin) {
+			t.Errorf("got error %v, want %v", err, ErrThin)
+		}
+
+		d, _, err := fimg.GetFromDescrID(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := d.GetData(&fimg); b != nil {
+			t.Errorf("got data %q, want nil", b)
+		}
+		if _, err := ioutil.ReadAll(d.GetReadSeeker(&fimg)); !errors.Is(err, ErrThin) {
+			t.Errorf("got error %v, want %v", err, ErrThin)
+		}
+		if _, err := ioutil.ReadAll(d.GetReader(&fimg)); !errors.Is(err, ErrThin) {
+			t.Errorf("got error %v, want %v", err, ErrThin)
+		}
+	})
+
+	for _, tt := range []struct {
+		name, path, thin string
+		sealed           bool
+	}{
+		{"Sealed", pathA, thinA, true},
+		{"Unsealed", pathB, thinB, false},
+	} {
+		tt := tt
+		t.Run("Materialize"+tt.name, func(t *testing.T) {
+			fimg, err := LoadContainer(tt.thin, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			if got, want := fimg.IsSealed(), tt.sealed; got != want {
+				t.Errorf("got sealed %v, want %v", got, want)
+			}
+
+			path := tt.thin + ".sif"
+			if err := fimg.Materialize(path, s); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := ioutil.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Error("materialized image differs from original")
+			}
+		})
+	}
+
+	t.Run("NotInStore", func(t *testing.T) {
+		empty, err := NewDirStore(filepath.Join(dir, "empty"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fimg, err := LoadContainer(thinB, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		if err := fimg.Materialize(filepath.Join(dir, "missing.sif"), empty); !errors.Is(err, ErrNotInStore) {
+			t.Errorf("got error %v, want %v", err, ErrNotInStore)
+		}
+	})
+
+	t.Run("DigestMismatch", func(t *testing.T) {
+		if err := s.Put("sha256:"+string(bytes.Repeat([]byte("0"), 64)), bytes.NewReader([]byte("x"))); !errors.Is(err, errDigestMismatch) {
+			t.Errorf("got error %v, want %v", err, errDigestMismatch)
+		}
+		if err := s.Put("md5:00", bytes.NewReader(nil)); !errors.Is(err, errDigestInvalid) {
+			t.Errorf("got error %v, want %v", err, errDigestInvalid)
+		}
+	})
+
+	t.Run("Version1", func(t *testing.T) {
+		fimg, err := LoadContainer(create(t, "v1.sif", HdrVersion1, "bootstrap: v1\n", false), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		if err := fimg.WriteThin(filepath.Join(dir, "v1.thin"), s); !errors.Is(err, errThinUnsupported) {
+			t.Errorf("got error %v, want %v", err, errThinUnsupported)
+		}
+	})
+}
+
+func TestCheckExternalRefs(t *testing.T) {
+	const dataoff = 4096
+
+	tests := []struct {
+		name    string
+		refs    ExternalRefs
+		wantErr error
+	}{
+		{
+			name: "Valid",
+			refs: ExternalRefs{Datalen: 300, Objects: []ExternalRef{
+				{ID: 2, Fileoff: dataoff + 100, Filelen: 200, Storelen: 200},
+				{ID: 1, Fileoff: dataoff, Filelen: 100, Storelen: 100},
+			}},
+		},
+		{
+			name:    "DatalenNegative",
+			refs:    ExternalRefs{Datalen: -1},
+			wantErr: errRefInvalid,
+		},
+		{
+			name: "BeforeData",
+			refs: ExternalRefs{Datalen: 100, Objects: []ExternalRef{
+				{ID: 1, Fileoff: 0, Filelen: 100},
+			}},
+			wantErr: errRefInvalid,
+		},
+		{
+			name: "BeyondData",
+			refs: ExternalRefs{Datalen: 100, Objects: []ExternalRef{
+				{ID: 1, Fileoff: dataoff, Filelen: 101},
+			}},
+			wantErr: errRefInvalid,
+		},
+		{
+			name: "LengthNegative",
+			refs: ExternalRefs{Datalen: 100, Objects: []ExternalRef{
+				{ID: 1, Fileoff: dataoff + 50, Filelen: -50},
+			}},
+			wantErr: errRefInvalid,
+		},
+		{
+			name: "Overflow",
+			refs: ExternalRefs{Datalen: 100, Objects: []ExternalRef{
+				{ID: 1, Fileoff: dataoff, Filelen: math.MaxInt64},
+			}},
+			wantErr: errRefInvalid,
+		},
+		{
+			name: "Overlap",
+			refs: ExternalRefs{Datalen: 300, Objects: []ExternalRef{
+				{ID: 1, Fileoff: dataoff, Filelen: 200},
+				{ID: 2, Fileoff: dataoff + 100, Filelen: 200},
+			}},
+			wantErr: errRefInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkExternalRefs(tt.refs, dataoff); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
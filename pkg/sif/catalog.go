@@ -0,0 +1,55 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MessageCatalog translates user-facing messages, allowing distributions to localize output
+// without patching. Messages are identified by their US English text. Messages that contain
+// formatting verbs, such as "Object %d", are translated before formatting, and translations
+// must contain the same verbs.
+type MessageCatalog interface {
+	// Message returns the translation of msg. If no translation is available, msg is returned.
+	Message(msg string) string
+}
+
+var (
+	catalogMu sync.RWMutex
+	catalog   MessageCatalog
+)
+
+// SetMessageCatalog sets the catalog used to translate user-facing messages, such as those
+// produced by FmtHeader, FmtDescrList and FmtDescrInfo. If c is nil, messages are not translated.
+//
+// Output intended for machines is never translated. This includes the String methods of type
+// values, which are recorded in manifests, and errors, which callers may match against.
+func SetMessageCatalog(c MessageCatalog) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	catalog = c
+}
+
+// Message returns the translation of the user-facing message msg, using the catalog set by
+// SetMessageCatalog. If no catalog is set, msg is returned.
+func Message(msg string) string {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	if catalog == nil {
+		return msg
+	}
+	return catalog.Message(msg)
+}
+
+// label returns the translation of msg, padded with spaces to width runes, for aligning the
+// values that follow it.
+func label(msg string, width int) string {
+	return fmt.Sprintf("%-*s", width, Message(msg))
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"testing"
+)
+
+type mapCatalog map[string]string
+
+func (c mapCatalog) Message(msg string) string {
+	if s, ok := c[msg]; ok {
+		return s
+	}
+	return msg
+}
+
+func TestSetMessageCatalog(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatalf(`Could not load test container: %v`, err)
+	}
+	defer func() {
+		if err := fimg.UnloadContainer(); err != nil {
+			t.Errorf("Error unloading container: %v", err)
+		}
+	}()
+
+	SetMessageCatalog(mapCatalog{
+		"Descr slot#:": "Emplacement :",
+		"Datatype:":    "Type :",
+		"Link:":        "Lien :",
+		"NONE":         "AUCUN",
+		"Def.FILE":     "Fichier.DEF",
+	})
+	defer SetMessageCatalog(nil)
+
+	const expectInfo = `Emplacement : 0
+  Type :     Fichier.DEF
+  ID:        1
+  Used:      true
+  Groupid:   1
+  Lien :     AUCUN
+  Fileoff:   32768
+  Filelen:   62
+  Ctime:     2018-08-14 07:45:59 +0000 UTC
+  Mtime:     2018-08-14 07:45:59 +0000 UTC
+  UID:       1002
+  Gid:       1002
+  Name:      busybox.deffile
+`
+
+	if got, want := fimg.FmtDescrInfo(1), expectInfo; got != want {
+		t.Errorf("Expected info:\n%q\nBut got:\n%q", want, got)
+	}
+
+	// Machine formats must not be translated.
+	if got, want := DataDeffile.String(), "Def.FILE"; got != want {
+		t.Errorf("got datatype %q, want %q", got, want)
+	}
+
+	SetMessageCatalog(nil)
+
+	if got, want := Message("NONE"), "NONE"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
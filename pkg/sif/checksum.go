@@ -0,0 +1,154 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/sylabs/sif/internal/pkg/blake3"
+)
+
+// A checksum of a data object may be recorded as it is written, by setting the Checksum field of
+// its DescriptorInput. The hash type and digest are recorded in a trailer in the Extra field of
+// its descriptor, ahead of the compression trailer, and after any datatype specific data. The
+// checksum covers the data as stored, so it may be checked with VerifyData without decompressing
+// the object, and without a signature. Unlike a signature, a checksum detects corruption, but
+// not tampering.
+//
+// Where the speed of checking large objects matters more than FIPS compliance, HashBLAKE3 may be
+// selected in place of SHA-2. BLAKE3 is not FIPS approved, and is only ever used when requested.
+// It is not supported for signatures.
+//
+// As for compression, OCI config and blob objects use the whole of the Extra field, and cannot
+// record a checksum. Their OCI digest may be checked with CheckOCIDigest instead.
+
+var (
+	errChecksumUnsupported = errors.New("checksum unsupported")
+	errStreamChecksum      = errors.New("streamed data object cannot be checksummed")
+
+	// ErrNoChecksum is returned when a data object has no checksum recorded.
+	ErrNoChecksum = errors.New("no checksum recorded")
+
+	// ErrChecksumMismatch is returned when a data object does not match its recorded checksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// checksumMagic identifies the checksum trailer of a descriptor.
+const checksumMagic = "SIFC"
+
+// checksumTrailer is stored in the Extra field of a data object with a recorded checksum,
+// immediately before the compression trailer.
+type checksumTrailer struct {
+	Magic    [4]byte
+	Hashtype Hashtype
+	Digest   [sha512.Size]byte
+}
+
+// checksumTrailerOff is the offset of the checksum trailer within the Extra field.
+var checksumTrailerOff = compressionTrailerOff - binary.Size(checksumTrailer{})
+
+// newChecksumHash returns a hash.Hash to compute a checksum of type ht.
+func newChecksumHash(ht Hashtype) (hash.Hash, error) {
+	switch ht {
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashSHA384:
+		return sha512.New384(), nil
+	case HashSHA512:
+		return sha512.New(), nil
+	case HashBLAKE3:
+		return blake3.New(), nil
+	}
+	return nil, fmt.Errorf("%w: hash type %v", errChecksumUnsupported, ht)
+}
+
+// checkChecksum returns an error if a checksum of type ht cannot be recorded for data objects of
+// type dt. A zero ht requests no checksum.
+func checkChecksum(dt Datatype, ht Hashtype) error {
+	if ht == 0 {
+		return nil
+	}
+	if _, err := newChecksumHash(ht); err != nil {
+		return err
+	}
+
+	if dt == DataOCIConfig || dt == DataOCIBlob {
+		return fmt.Errorf("%w: %v objects", errChecksumUnsupported, dt)
+	}
+	return nil
+}
+
+// checksum returns the checksum trailer of d, if any.
+func (d *Descriptor) checksum() (checksumTrailer, bool) {
+	var t checksumTrailer
+	b := bytes.NewReader(d.Extra[checksumTrailerOff:])
+	if err := binary.Read(b, binary.LittleEndian, &t); err != nil {
+		return checksumTrailer{}, false
+	}
+	if string(t.Magic[:]) != checksumMagic || t.Hashtype == 0 {
+		return checksumTrailer{}, false
+	}
+	return t, true
+}
+
+// setChecksum stores t as the checksum trailer of d. If t does not hold a checksum, the Extra
+// field of d is left unchanged.
+func (d *Descriptor) setChecksum(t checksumTrailer) {
+	if t.Hashtype == 0 {
+		return
+	}
+
+	copy(t.Magic[:], checksumMagic)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, t) // nolint:errcheck
+	copy(d.Extra[checksumTrailerOff:], b.Bytes())
+}
+
+// GetChecksum returns the hash type and digest of the checksum recorded for the data object
+// described by d. If no checksum is recorded, an error wrapping ErrNoChecksum is returned.
+func (d *Descriptor) GetChecksum() (Hashtype, []byte, error) {
+	t, ok := d.checksum()
+	if !ok {
+		return 0, nil, fmt.Errorf("object %d: %w", d.ID, ErrNoChecksum)
+	}
+
+	h, err := newChecksumHash(t.Hashtype)
+	if err != nil {
+		return 0, nil, err
+	}
+	return t.Hashtype, t.Digest[:h.Size()], nil
+}
+
+// VerifyData checks the data object described by d, as stored in fimg, against the checksum
+// recorded in d. If no checksum is recorded, an error wrapping ErrNoChecksum is returned. If the
+// data does not match, an error wrapping ErrChecksumMismatch is returned.
+func (d *Descriptor) VerifyData(fimg *FileImage) error {
+	ht, want, err := d.GetChecksum()
+	if err != nil {
+		return err
+	}
+
+	h, err := newChecksumHash(ht)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, d.GetReadSeeker(fimg)); err != nil {
+		return fmt.Errorf("reading data object %d: %s", d.ID, err)
+	}
+
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return fmt.Errorf("object %d: %w", d.ID, ErrChecksumMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestVerifyData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-checksum-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := []byte("some data to be checked")
+
+	tests := []struct {
+		name        string
+		checksum    Hashtype
+		compression Compression
+		corrupt     bool
+		wantErr     error
+	}{
+		{name: "None", wantErr: ErrNoChecksum},
+		{name: "SHA256", checksum: HashSHA256},
+		{name: "SHA384", checksum: HashSHA384},
+		{name: "SHA512", checksum: HashSHA512},
+		{name: "BLAKE3", checksum: HashBLAKE3},
+		{name: "Compressed", checksum: HashSHA256, compression: CompressionGzip},
+		{name: "Corrupt", checksum: HashSHA256, corrupt: true, wantErr: ErrChecksumMismatch},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			part := DescriptorInput{
+				Datatype:    DataPartition,
+				Groupid:     DescrDefaultGroup,
+				Link:        DescrUnusedLink,
+				Size:        int64(len(data)),
+				Fname:       "rootfs",
+				Data:        data,
+				Compression: tt.compression,
+				Checksum:    tt.checksum,
+			}
+			if err := part.SetPartExtra(FsSquash, PartSystem, HdrArchAMD64); err != nil {
+				t.Fatal(err)
+			}
+
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				ID:         uuid.NewV4(),
+				InputDescr: []DescriptorInput{part},
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the checksum must survive changes to the datatype specific data
+			if err := fimg.SetPrimPart(1); err != nil {
+				t.Fatal(err)
+			}
+
+			d, _, err := fimg.GetFromDescrID(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			off := d.Fileoff
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.corrupt {
+				f, err := os.OpenFile(cinfo.Pathname, os.O_RDWR, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteAt([]byte("S"), off); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if fimg, err = LoadContainer(cinfo.Pathname, true); err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			if d, _, err = fimg.GetFromDescrID(1); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := d.GetCompression(), tt.compression; got != want {
+				t.Errorf("got compression %v, want %v", got, want)
+			}
+
+			if got, want := d.VerifyData(&fimg), tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+
+			if tt.checksum == HashSHA256 && tt.compression == CompressionNone && !tt.corrupt {
+				ht, digest, err := d.GetChecksum()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := ht, HashSHA256; got != want {
+					t.Errorf("got hash type %v, want %v", got, want)
+				}
+				if got, want := digest, sha256.Sum256(data); string(got) != string(want[:]) {
+					t.Errorf("got digest %x, want %x", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestChecksumUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-checksum-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		datatype Datatype
+		checksum Hashtype
+	}{
+		{"HashType", DataGeneric, HashBLAKE2B},
+		{"OCIBlob", DataOCIBlob, HashSHA256},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				ID:         uuid.NewV4(),
+				InputDescr: []DescriptorInput{{
+					Datatype: tt.datatype,
+					Groupid:  DescrDefaultGroup,
+					Link:     DescrUnusedLink,
+					Size:     4,
+					Fname:    "data",
+					Data:     []byte("data"),
+					Checksum: tt.checksum,
+				}},
+			}
+			if _, err := CreateContainer(cinfo); !errors.Is(err, errChecksumUnsupported) {
+				t.Errorf("got error %v, want %v", err, errChecksumUnsupported)
+			}
+		})
+	}
+}
+
+func TestCreateContainerWriterChecksum(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			{
+				Datatype: DataDeffile,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     8,
+				Fname:    "deffile",
+				Data:     []byte("deffile!"),
+				Checksum: HashSHA256,
+			},
+		},
+	}
+
+	t.Run("Stream", func(t *testing.T) {
+		var buf bytes.Buffer
+		if got, want := CreateContainerWriter(&buf, cinfo), errStreamChecksum; !errors.Is(got, want) {
+			t.Errorf("got error %v, want %v", got, want)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("got %v bytes written, want 0", buf.Len())
+		}
+	})
+
+	t.Run("Seekable", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "sif-checksum-*.sif")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+
+		err = CreateContainerWriter(f, cinfo)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fimg, err := LoadContainer(f.Name(), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		d, _, err := fimg.GetFromDescrID(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.VerifyData(&fimg); err != nil {
+			t.Errorf("failed to verify data: %v", err)
+		}
+	})
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A chunk manifest records the digests of the fixed size chunks of a data object, so that after a
+// partial modification or download of the object, only the chunks affected need be hashed again or
+// transferred. Chunk manifests may be stored in an image, as an object linked to the data object
+// they describe.
+
+// DefaultChunkSize is the chunk size used by AddChunkManifest when none is specified.
+const DefaultChunkSize = 4 << 20
+
+// ChunkManifestName is the name of chunk manifest objects within an image.
+const ChunkManifestName = "sif-chunks.json"
+
+var (
+	errChunkSizeInvalid  = errors.New("chunk size invalid")
+	errChunkIndexInvalid = errors.New("chunk index invalid")
+	errChunkManifest     = errors.New("chunk manifest inconsistent")
+)
+
+// ChunkManifest records the digests of the chunks of a data object.
+type ChunkManifest struct {
+	ChunkSize int64    `json:"chunkSize"` // size of each chunk, except the last
+	Size      int64    `json:"size"`      // size of the data object
+	Digests   []string `json:"digests"`   // digest of each chunk, of the form "sha256:<hex>"
+	Root      string   `json:"root"`      // digest of the concatenated chunk digests
+}
+
+// chunkDigest returns the digest of b, of the form "sha256:<hex>".
+func chunkDigest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// rootDigest returns the digest of the concatenation of digests.
+func rootDigest(digests []string) string {
+	h := sha256.New()
+	for _, d := range digests {
+		io.WriteString(h, d) // nolint:errcheck
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// NewChunkManifest returns a ChunkManifest describing the data read from r, in chunks of
+// chunkSize bytes.
+func NewChunkManifest(r io.Reader, chunkSize int64) (ChunkManifest, error) {
+	if chunkSize <= 0 {
+		return ChunkManifest{}, fmt.Errorf("%w: %d", errChunkSizeInvalid, chunkSize)
+	}
+
+	m := ChunkManifest{ChunkSize: chunkSize, Digests: []string{}}
+
+	b := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, b)
+		if n > 0 {
+			m.Digests = append(m.Digests, chunkDigest(b[:n]))
+			m.Size += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return ChunkManifest{}, err
+		}
+	}
+
+	m.Root = rootDigest(m.Digests)
+	return m, nil
+}
+
+// Chunks returns the number of chunks described by m.
+func (m ChunkManifest) Chunks() int {
+	return len(m.Digests)
+}
+
+// ChunksInRange returns the indices of the chunks that hold any of the n bytes at offset off,
+// such as those affected by a modification of that range.
+func (m ChunkManifest) ChunksInRange(off, n int64) []int {
+	if n <= 0 || off >= m.Size || m.ChunkSize <= 0 {
+		return nil
+	}
+	if off < 0 {
+		n, off = n+off, 0
+	}
+	if off+n > m.Size {
+		n = m.Size - off
+	}
+
+	var chunks []int
+	for i := off / m.ChunkSize; i*m.ChunkSize < off+n; i++ {
+		chunks = append(chunks, int(i))
+	}
+	return chunks
+}
+
+// check returns an error if m is not internally consistent.
+func (m ChunkManifest) check() error {
+	if m.ChunkSize <= 0 {
+		return fmt.Errorf("%w: %d", errChunkSizeInvalid, m.ChunkSize)
+	}
+	if want := (m.Size + m.ChunkSize - 1) / m.ChunkSize; int64(len(m.Digests)) != want {
+		return fmt.Errorf("%w: %d digests for %d chunks", errChunkManifest, len(m.Digests), want)
+	}
+	if rootDigest(m.Digests) != m.Root {
+		return fmt.Errorf("%w: root digest mismatch", errChunkManifest)
+	}
+	return nil
+}
+
+// Verify checks the data read from r against the chunk digests of m, and returns the indices of
+// the chunks that do not match, in ascending order. If chunks are specified, only those chunks are
+// checked. Otherwise, all chunks are checked. A chunk that cannot be read in full, such as one not
+// yet downloaded, does not match.
+func (m ChunkManifest) Verify(r io.ReaderAt, chunks ...int) ([]int, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+
+	if len(chunks) == 0 {
+		chunks = make([]int, len(m.Digests))
+		for i := range chunks {
+			chunks[i] = i
+		}
+	}
+
+	var bad []int
+	b := make([]byte, m.ChunkSize)
+
+	for _, i := range chunks {
+		if i < 0 || i >= len(m.Digests) {
+			return nil, fmt.Errorf("%w: %d", errChunkIndexInvalid, i)
+		}
+
+		off := int64(i) * m.ChunkSize
+		size := m.ChunkSize
+		if off+size > m.Size {
+			size = m.Size - off
+		}
+
+		n, err := r.ReadAt(b[:size], off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		if int64(n) != size || chunkDigest(b[:n]) != m.Digests[i] {
+			bad = insertSortedInt(bad, i)
+		}
+	}
+
+	return bad, nil
+}
+
+// insertSortedInt inserts i into the sorted slice s, unless s already contains it.
+func insertSortedInt(s []int, i int) []int {
+	for j, v := range s {
+		if v == i {
+			return s
+		}
+		if v > i {
+			return append(s[:j], append([]int{i}, s[j:]...)...)
+		}
+	}
+	return append(s, i)
+}
+
+// GetChunkManifest returns the chunk manifest stored in the image for the data object with the
+// specified id. If no chunk manifest is stored for the object, ErrNotFound is returned.
+func (fimg *FileImage) GetChunkManifest(id uint32) (ChunkManifest, error) {
+	d, err := fimg.GetDescriptor(
+		WithDataType(DataGenericJSON),
+		WithName(ChunkManifestName),
+		WithLinkedID(id),
+	)
+	if err != nil {
+		return ChunkManifest{}, err
+	}
+
+	var m ChunkManifest
+	if err := json.NewDecoder(d.GetReader(fimg)).Decode(&m); err != nil {
+		return ChunkManifest{}, fmt.Errorf("decoding chunk manifest: %s", err)
+	}
+	return m, nil
+}
+
+// AddChunkManifest computes the chunk manifest of the data object with the specified id, in chunks
+// of chunkSize bytes, and stores it in the image as an object linked to the data object and in the
+// same object group. If chunkSize is zero, DefaultChunkSize is used. If a chunk manifest is already
+// stored for the object, it is replaced.
+func (fimg *FileImage) AddChunkManifest(id uint32, chunkSize int64) (ChunkManifest, error) {
+	if err := fimg.checkWritable(); err != nil {
+		return ChunkManifest{}, err
+	}
+
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return ChunkManifest{}, err
+	}
+
+	m, err := NewChunkManifest(descr.GetReader(fimg), chunkSize)
+	if err != nil {
+		return ChunkManifest{}, err
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return ChunkManifest{}, err
+	}
+
+	input := DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  descr.Groupid,
+		Link:     id,
+		Size:     int64(len(b)),
+		Fname:    ChunkManifestName,
+		Data:     b,
+	}
+
+	d, err := fimg.GetDescriptor(WithDataType(DataGenericJSON), WithName(ChunkManifestName), WithLinkedID(id))
+	if errors.Is(err, ErrNotFound) {
+		if err := fimg.AddObject(input); err != nil {
+			return ChunkManifest{}, err
+		}
+		return m, fimg.remap()
+	} else if err != nil {
+		return ChunkManifest{}, err
+	}
+	return m, fimg.ReplaceObject(d.ID, input)
+}
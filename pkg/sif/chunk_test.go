@@ -0,0 +1,215 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestNewChunkManifest(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		chunkSize  int64
+		wantChunks int
+		wantErr    error
+	}{
+		{"Empty", nil, 4, 0, nil},
+		{"Exact", []byte("01234567"), 4, 2, nil},
+		{"Partial", []byte("0123456789"), 4, 3, nil},
+		{"ChunkSizeZero", []byte("0123"), 0, 0, errChunkSizeInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewChunkManifest(bytes.NewReader(tt.data), tt.chunkSize)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			if got, want := m.Chunks(), tt.wantChunks; got != want {
+				t.Errorf("got %v chunks, want %v", got, want)
+			}
+			if got, want := m.Size, int64(len(tt.data)); got != want {
+				t.Errorf("got size %v, want %v", got, want)
+			}
+
+			bad, err := m.Verify(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bad) != 0 {
+				t.Errorf("got mismatched chunks %v, want none", bad)
+			}
+		})
+	}
+}
+
+func TestChunkManifestChunksInRange(t *testing.T) {
+	m := ChunkManifest{ChunkSize: 4, Size: 10}
+
+	tests := []struct {
+		name string
+		off  int64
+		n    int64
+		want []int
+	}{
+		{"First", 0, 4, []int{0}},
+		{"Span", 3, 2, []int{0, 1}},
+		{"Last", 9, 1, []int{2}},
+		{"Beyond", 8, 100, []int{2}},
+		{"Negative", -2, 3, []int{0}},
+		{"Empty", 4, 0, nil},
+		{"After", 10, 1, nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := m.ChunksInRange(tt.off, tt.n), tt.want; !reflect.DeepEqual(got, want) {
+				t.Errorf("got chunks %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestChunkManifestVerify(t *testing.T) {
+	data := []byte("0123456789")
+
+	m, err := NewChunkManifest(bytes.NewReader(data), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modified := append([]byte(nil), data...)
+	modified[5] = 'x'
+
+	tampered := m
+	tampered.Digests = append([]string(nil), m.Digests...)
+	tampered.Digests[0] = chunkDigest([]byte("abcd"))
+
+	tests := []struct {
+		name    string
+		m       ChunkManifest
+		data    []byte
+		chunks  []int
+		want    []int
+		wantErr error
+	}{
+		{"Match", m, data, nil, nil, nil},
+		{"Modified", m, modified, nil, []int{1}, nil},
+		{"ModifiedUnchecked", m, modified, []int{0, 2}, nil, nil},
+		{"Truncated", m, data[:6], nil, []int{1, 2}, nil},
+		{"IndexInvalid", m, data, []int{3}, nil, errChunkIndexInvalid},
+		{"Tampered", tampered, data, nil, nil, errChunkManifest},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Verify(bytes.NewReader(tt.data), tt.chunks...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got chunks %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddChunkManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-chunk-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("0123456789"), 10)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "chunk.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			{
+				Datatype: DataGeneric,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     int64(len(data)),
+				Fname:    "generic",
+				Data:     data,
+			},
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	if _, err := fimg.GetChunkManifest(1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, ErrNotFound)
+	}
+
+	if _, err := fimg.AddChunkManifest(1, 16); err != nil {
+		t.Fatal(err)
+	}
+
+	// Adding a manifest again replaces it.
+	want, err := fimg.AddChunkManifest(1, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := fimg.GetChunkManifest(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got manifest %+v, want %+v", m, want)
+	}
+	if got, want := len(fimg.GetDescriptors(WithName(ChunkManifestName))), 1; got != want {
+		t.Errorf("got %v manifests, want %v", got, want)
+	}
+
+	d, err := fimg.GetDescriptor(WithName(ChunkManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.Groupid, uint32(DescrDefaultGroup); got != want {
+		t.Errorf("got group %#x, want %#x", got, want)
+	}
+
+	descr, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := m.Verify(descr.GetReader(&fimg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bad) != 0 {
+		t.Errorf("got mismatched chunks %v, want none", bad)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import "time"
+
+// Clock is a source of the current time, used for the timestamps recorded when an image is
+// created or modified. Supplying a Clock allows tests and build systems to control the timestamps
+// recorded, without fixing them as for a reproducible image.
+type Clock interface {
+	Now() time.Time
+}
+
+// OptLoadClock specifies the source of the timestamps recorded when the image is modified. By
+// default, the system clock is used.
+func OptLoadClock(c Clock) LoadOpt {
+	return func(lo *loadOpts) error {
+		lo.clock = c
+		return nil
+	}
+}
+
+// now returns the timestamp to record for a change to fimg.
+func (fimg *FileImage) now() int64 {
+	if fimg.repro != nil {
+		return fimg.repro.time
+	}
+	if fimg.clock != nil {
+		return fimg.clock.Now().Unix()
+	}
+	return time.Now().Unix()
+}
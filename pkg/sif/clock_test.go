@@ -0,0 +1,102 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// fixedClock is a Clock that always returns the same time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestClock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-clock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	modified := created.Add(time.Hour)
+
+	input := DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     4,
+		Fname:    "generic",
+		Data:     []byte("data"),
+	}
+
+	tests := []struct {
+		name         string
+		reproducible bool
+		wantCreated  int64
+	}{
+		{"Clock", false, created.Unix()},
+		{"Reproducible", true, 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:     filepath.Join(dir, tt.name+".sif"),
+				Launchstr:    HdrLaunch,
+				Sifversion:   HdrVersion,
+				ID:           uuid.NewV4(),
+				InputDescr:   []DescriptorInput{input},
+				Reproducible: tt.reproducible,
+				Clock:        fixedClock(created),
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, false, OptLoadClock(fixedClock(modified)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			if got, want := fimg.Header.Ctime, tt.wantCreated; got != want {
+				t.Errorf("got header ctime %v, want %v", got, want)
+			}
+			d, _, err := fimg.GetFromDescrID(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := d.Ctime, tt.wantCreated; got != want {
+				t.Errorf("got object ctime %v, want %v", got, want)
+			}
+
+			// modifications are timestamped by the clock supplied when loading
+			if err := fimg.AddObject(input); err != nil {
+				t.Fatal(err)
+			}
+			if err := fimg.SetObjectName(1, "renamed"); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := fimg.Header.Mtime, modified.Unix(); got != want {
+				t.Errorf("got header mtime %v, want %v", got, want)
+			}
+			for _, d := range fimg.GetDescriptors() {
+				if got, want := d.Mtime, modified.Unix(); got != want {
+					t.Errorf("object %v: got mtime %v, want %v", d.ID, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"sort"
+)
+
+// maxPreservedAlignment is the largest alignment of a data object that is preserved when data
+// objects are moved within an image.
+const maxPreservedAlignment = 1 << 20
+
+// compactMove describes the relocation of a data object during compaction.
+type compactMove struct {
+	index    int   // index of the descriptor in the descriptor table
+	fileoff  int64 // new offset of the data object
+	storelen int64 // new length of the data object, including alignment
+}
+
+// compactAlignment returns the alignment of a data object at offset off to preserve during
+// compaction. This is the largest power of two that divides off, up to maxPreservedAlignment.
+func compactAlignment(off int64) int {
+	align := maxPreservedAlignment
+	for off%int64(align) != 0 {
+		align /= 2
+	}
+	return align
+}
+
+// compactPlan returns the moves required to compact the data section of fimg, in ascending order
+// of offset, along with the end of the compacted data section. Data objects keep their relative
+// order, and each is placed at the lowest offset that preserves its alignment.
+func (fimg *FileImage) compactPlan() ([]compactMove, int64) {
+	var order []int
+	for i, d := range fimg.DescrArr {
+		if d.Used {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return fimg.DescrArr[order[i]].Fileoff < fimg.DescrArr[order[j]].Fileoff
+	})
+
+	moves := make([]compactMove, 0, len(order))
+	end := fimg.Header.Dataoff
+	for _, i := range order {
+		d := fimg.DescrArr[i]
+		off := nextAligned(end, compactAlignment(d.Fileoff))
+		moves = append(moves, compactMove{index: i, fileoff: off, storelen: off + d.Filelen - end})
+		end = off + d.Filelen
+	}
+	return moves, end
+}
+
+// moveData copies n bytes of data within fimg from offset src to offset dst, using buf. As data
+// is copied in ascending order, dst must not be greater than src.
+func moveData(fimg *FileImage, dst, src, n int64, buf []byte) error {
+	for n > 0 {
+		b := buf
+		if n < int64(len(b)) {
+			b = b[:n]
+		}
+
+		if _, err := fimg.Fp.ReadAt(b, src); err != nil {
+			return fmt.Errorf("reading data object: %s", err)
+		}
+		if _, err := fimg.Fp.Seek(dst, 0); err != nil {
+			return fmt.Errorf("seeking to data object offset: %s", err)
+		}
+		if _, err := fimg.Fp.Write(b); err != nil {
+			return fmt.Errorf("writing data object: %s", err)
+		}
+
+		dst += int64(len(b))
+		src += int64(len(b))
+		n -= int64(len(b))
+	}
+	return nil
+}
+
+// compact moves the data objects of fimg towards the start of the data section, so that space
+// left by deleted data objects is reclaimed, and truncates the file accordingly.
+func (fimg *FileImage) compact() error {
+	if _, err := fimg.CheckTruncated(); err != nil {
+		return err
+	}
+	if err := fimg.checkStructure(); err != nil {
+		return err
+	}
+
+	moves, end := fimg.compactPlan()
+	buf := fimg.buffer()
+
+	for _, m := range moves {
+		d := &fimg.DescrArr[m.index]
+		if m.fileoff == d.Fileoff && m.storelen == d.Storelen {
+			continue
+		}
+
+		if m.fileoff != d.Fileoff {
+			if err := moveData(fimg, m.fileoff, d.Fileoff, d.Filelen, buf); err != nil {
+				return err
+			}
+		}
+
+		// descriptors are written as each data object is moved, so that an interruption leaves
+		// at most one data object out of place
+		d.Fileoff, d.Storelen = m.fileoff, m.storelen
+		if err := writeDescriptors(fimg); err != nil {
+			return err
+		}
+	}
+
+	fimg.Header.Datalen = end - fimg.Header.Dataoff
+	fimg.Header.Mtime = fimg.now()
+	if err := writeHeader(fimg); err != nil {
+		return err
+	}
+
+	if err := fimg.Fp.Truncate(end); err != nil {
+		return fmt.Errorf("truncating SIF file: %s", err)
+	}
+
+	if err := fimg.Fp.Sync(); err != nil {
+		return fmt.Errorf("while sync'ing compacted SIF file: %s", err)
+	}
+
+	return fimg.remap()
+}
+
+// CompactPlan describes the effect of compacting an image with Compact.
+type CompactPlan struct {
+	Moved       int   // number of data objects that would be moved
+	Reclaimable int64 // number of bytes by which the file would shrink
+}
+
+// PlanCompact returns a description of the effect of compacting the image with Compact, without
+// modifying it. The image may be loaded read-only.
+func (fimg *FileImage) PlanCompact() (*CompactPlan, error) {
+	if _, err := fimg.CheckTruncated(); err != nil {
+		return nil, err
+	}
+	if err := fimg.checkStructure(); err != nil {
+		return nil, err
+	}
+
+	moves, end := fimg.compactPlan()
+
+	p := &CompactPlan{Reclaimable: fimg.Filesize - end}
+	for _, m := range moves {
+		if m.fileoff != fimg.DescrArr[m.index].Fileoff {
+			p.Moved++
+		}
+	}
+	return p, nil
+}
+
+// Compact reclaims the space left in the data section of the image by deleted data objects. Data
+// objects are moved towards the start of the data section, keeping their relative order, and the
+// file is truncated to the end of the last data object. Offsets are not covered by signatures, so
+// signed images remain verifiable once compacted.
+//
+// Data objects are moved in place, so no additional disk space is required. The alignment of each
+// data object is preserved, up to 1MiB. The image must be loaded read-write, and must
+// not be truncated.
+func (fimg *FileImage) Compact() error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+
+	return fimg.guarded(fimg.compact)
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// createCompactTestImage creates an image at path holding a generic data object for each of
+// payloads, aligned as specified by alignments.
+func createCompactTestImage(t *testing.T, path string, payloads [][]byte, alignments []int) {
+	t.Helper()
+
+	cinfo := CreateInfo{
+		Pathname:   path,
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion2,
+		ID:         uuid.NewV4(),
+	}
+	for i, p := range payloads {
+		cinfo.InputDescr = append(cinfo.InputDescr, DescriptorInput{
+			Datatype:  DataGeneric,
+			Groupid:   DescrDefaultGroup,
+			Link:      DescrUnusedLink,
+			Size:      int64(len(p)),
+			Alignment: alignments[i],
+			Fname:     "generic",
+			Data:      p,
+		})
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkCompacted verifies that the data objects of the image at path hold the payloads specified
+// by ID, that the data section has no gaps beyond alignment, and that the file ends with the data
+// section.
+func checkCompacted(t *testing.T, path string, want map[uint32][]byte) {
+	t.Helper()
+
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	var storelen int64
+	for _, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+		storelen += d.Storelen
+
+		p, ok := want[d.ID]
+		if !ok {
+			t.Errorf("unexpected object %d", d.ID)
+			continue
+		}
+		if !bytes.Equal(d.GetData(&fimg), p) {
+			t.Errorf("object %d: data does not match", d.ID)
+		}
+		if d.Storelen-d.Filelen >= int64(os.Getpagesize()) {
+			t.Errorf("object %d: got %d bytes of padding", d.ID, d.Storelen-d.Filelen)
+		}
+	}
+
+	if got, want := storelen, fimg.Header.Datalen; got != want {
+		t.Errorf("got total storage length %v, want %v", got, want)
+	}
+	if got, want := fimg.Filesize, fimg.Header.Dataoff+fimg.Header.Datalen; got != want {
+		t.Errorf("got file size %v, want %v", got, want)
+	}
+	if err := fimg.checkStructure(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-compact-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	payloads := [][]byte{
+		bytes.Repeat([]byte{1}, 5000),
+		[]byte("second"),
+		bytes.Repeat([]byte{3}, 3*DefaultBufferSize/2),
+		[]byte("fourth"),
+		[]byte("fifth"),
+	}
+	alignments := []int{0, 0, 0, 8, 1}
+
+	tests := []struct {
+		name    string
+		deletes []uint32
+		flags   int
+		compact bool
+	}{
+		{name: "Compact", deletes: []uint32{1, 3}, compact: true},
+		{name: "CompactNoDeletes", compact: true},
+		{name: "DelCompactFirst", deletes: []uint32{1}, flags: DelCompact},
+		{name: "DelCompactMiddle", deletes: []uint32{2, 3}, flags: DelCompact},
+		{name: "DelCompactLast", deletes: []uint32{5}, flags: DelCompact},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".sif")
+			createCompactTestImage(t, path, payloads, alignments)
+
+			fimg, err := LoadContainer(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			before := fimg.Filesize
+
+			for _, id := range tt.deletes {
+				if err := fimg.DeleteObject(id, tt.flags); err != nil {
+					t.Fatalf("DeleteObject(%d): %v", id, err)
+				}
+			}
+			if tt.compact {
+				plan, err := fimg.PlanCompact()
+				if err != nil {
+					t.Fatalf("PlanCompact: %v", err)
+				}
+				planned := fimg.Filesize
+
+				if err := fimg.Compact(); err != nil {
+					t.Fatalf("Compact: %v", err)
+				}
+
+				if got, want := plan.Reclaimable, planned-fimg.Filesize; got != want {
+					t.Errorf("got %v bytes reclaimable, want %v", got, want)
+				}
+				if len(tt.deletes) == 0 && plan.Moved != 0 {
+					t.Errorf("got %v objects moved, want 0", plan.Moved)
+				}
+			}
+
+			var freed int64
+			want := make(map[uint32][]byte)
+			for i, p := range payloads {
+				want[uint32(i+1)] = p
+			}
+			for _, id := range tt.deletes {
+				freed += int64(len(payloads[id-1]))
+				delete(want, id)
+			}
+
+			// the data of the image must be readable without reloading
+			for id, p := range want {
+				d, _, err := fimg.GetFromDescrID(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(d.GetData(&fimg), p) {
+					t.Errorf("object %d: data does not match", id)
+				}
+				if d.Fileoff%int64(compactAlignment(d.Fileoff)) != 0 {
+					t.Errorf("object %d: offset %d not aligned", id, d.Fileoff)
+				}
+			}
+
+			if got := before - fimg.Filesize; got < freed {
+				t.Errorf("got %v bytes reclaimed, want at least %v", got, freed)
+			}
+
+			checkCompacted(t, path, want)
+		})
+	}
+}
+
+func TestCompactAlignment(t *testing.T) {
+	tests := []struct {
+		name string
+		off  int64
+		want int
+	}{
+		{name: "Page", off: int64(os.Getpagesize()) * 3, want: os.Getpagesize()},
+		{name: "Eight", off: 32768 + 8, want: 8},
+		{name: "Odd", off: 32768 + 1, want: 1},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compactAlignment(tt.off); got != tt.want {
+				t.Errorf("got alignment %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompactSealed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-compact-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "image.sif")
+	createCompactTestImage(t, path, [][]byte{[]byte("data")}, []int{0})
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	if err := fimg.Seal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fimg.Compact(); !errors.Is(err, ErrSealed) {
+		t.Errorf("got error %v, want %v", err, ErrSealed)
+	}
+}
+
+func TestCompactAfterAdd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-compact-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "image.sif")
+	createCompactTestImage(t, path, [][]byte{[]byte("first")}, []int{0})
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := []byte("second")
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(second)),
+		Fname:    "generic",
+		Data:     second,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// objects added since loading must not be mistaken for data beyond the end of the file
+	if err := fimg.DeleteObject(1, DelZero); err != nil {
+		t.Fatal(err)
+	}
+	if err := fimg.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkCompacted(t, path, map[uint32][]byte{2: second})
+}
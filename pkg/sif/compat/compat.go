@@ -0,0 +1,370 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package compat exposes the SIF implementation of package sif under the identifiers used by the
+// Apptainer fork, so that projects importing the fork can converge on this implementation by
+// changing import paths only. Types and constants are aliases of those in package sif, and values
+// may be passed freely between the two packages. FileImage and Descriptor wrap their sif
+// counterparts, and provide the accessor methods of the fork.
+//
+// The identifiers exported by this package are stable, and the values of the types and constants
+// exported match those of the fork. This package diverges from the fork as follows:
+//
+//   - DataOCIRootIndex (0x400a) is not provided, as package sif does not support OCI root index
+//     objects. Images holding them load, but the objects have a data type unknown to package sif.
+//   - HashBLAKE3 (6) is provided, though the fork defines no such hash type.
+//   - The SBOM formats of package sif (sif.SBOMFormat) are numbered differently from those of the
+//     fork, so SBOMFormat and Descriptor.SBOMMetadata are not provided.
+//   - Data types, cryptographic message formats and message types specific to package sif, such
+//     as sif.DataBuildLog and sif.FormatJWS, are not provided.
+//
+// TestDivergences records each divergence, and fails if package sif changes in a way that affects
+// it.
+package compat
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// Types renamed by the fork.
+type (
+	DataType    = sif.Datatype
+	FSType      = sif.Fstype
+	PartType    = sif.Parttype
+	HashType    = sif.Hashtype
+	FormatType  = sif.Formattype
+	MessageType = sif.Messagetype
+)
+
+// List of data types.
+const (
+	DataDeffile       = sif.DataDeffile
+	DataEnvVar        = sif.DataEnvVar
+	DataLabels        = sif.DataLabels
+	DataPartition     = sif.DataPartition
+	DataSignature     = sif.DataSignature
+	DataGenericJSON   = sif.DataGenericJSON
+	DataGeneric       = sif.DataGeneric
+	DataCryptoMessage = sif.DataCryptoMessage
+	DataSBOM          = sif.DataSBOM
+	DataOCIBlob       = sif.DataOCIBlob
+)
+
+// List of file system types.
+const (
+	FsSquash            = sif.FsSquash
+	FsExt3              = sif.FsExt3
+	FsImmuObj           = sif.FsImmuObj
+	FsRaw               = sif.FsRaw
+	FsEncryptedSquashfs = sif.FsEncryptedSquashfs
+)
+
+// List of partition types.
+const (
+	PartSystem  = sif.PartSystem
+	PartPrimSys = sif.PartPrimSys
+	PartData    = sif.PartData
+	PartOverlay = sif.PartOverlay
+)
+
+// List of hash types.
+const (
+	HashSHA256  = sif.HashSHA256
+	HashSHA384  = sif.HashSHA384
+	HashSHA512  = sif.HashSHA512
+	HashBLAKE2S = sif.HashBLAKE2S
+	HashBLAKE2B = sif.HashBLAKE2B
+	HashBLAKE3  = sif.HashBLAKE3
+)
+
+// List of cryptographic message formats and types.
+const (
+	FormatOpenPGP = sif.FormatOpenPGP
+	FormatPEM     = sif.FormatPEM
+
+	MessageClearSignature = sif.MessageClearSignature
+	MessageRSAOAEP        = sif.MessageRSAOAEP
+)
+
+// Errors returned by the fork, aliased to their equivalents in package sif.
+var (
+	ErrObjectNotFound  = sif.ErrNotFound
+	ErrMultipleObjects = sif.ErrMultValues
+)
+
+// ErrNoObjects is returned when an image contains no data objects.
+var ErrNoObjects = errors.New("no objects in image")
+
+// FileImage describes a loaded SIF image.
+type FileImage struct {
+	f *sif.FileImage
+}
+
+// Image returns the sif.FileImage wrapped by f.
+func (f *FileImage) Image() *sif.FileImage { return f.f }
+
+// loadOpts accumulates load options.
+type loadOpts struct {
+	flag int
+	opts []sif.LoadOpt
+}
+
+// LoadOpt are used to specify loading options.
+type LoadOpt func(*loadOpts) error
+
+// OptLoadWithFlag specifies flag (os.O_RDONLY etc.) to be used when opening the image.
+func OptLoadWithFlag(flag int) LoadOpt {
+	return func(lo *loadOpts) error {
+		lo.flag = flag
+		return nil
+	}
+}
+
+// OptLoadSIF passes opts through to package sif when the image is loaded.
+func OptLoadSIF(opts ...sif.LoadOpt) LoadOpt {
+	return func(lo *loadOpts) error {
+		lo.opts = append(lo.opts, opts...)
+		return nil
+	}
+}
+
+// LoadContainerFromPath loads a new SIF image from path. By default, the image is opened
+// read-only.
+func LoadContainerFromPath(path string, opts ...LoadOpt) (*FileImage, error) {
+	lo := loadOpts{flag: os.O_RDONLY}
+	for _, opt := range opts {
+		if err := opt(&lo); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := sif.LoadContainer(path, lo.flag&(os.O_WRONLY|os.O_RDWR) == 0, lo.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &FileImage{f: &f}, nil
+}
+
+// UnloadContainer unloads f, releasing associated resources.
+func (f *FileImage) UnloadContainer() error { return f.f.UnloadContainer() }
+
+// LaunchScript returns the image launch script.
+func (f *FileImage) LaunchScript() string { return trimZeroBytes(f.f.Header.Launch[:]) }
+
+// Version returns the SIF specification version of the image.
+func (f *FileImage) Version() string { return f.f.Header.GetVersion() }
+
+// PrimaryArch returns the primary CPU architecture of the image, as a Go GOARCH value.
+func (f *FileImage) PrimaryArch() string { return sif.GetGoArch(f.f.Header.GetArch()) }
+
+// ID returns the ID of the image.
+func (f *FileImage) ID() string { return f.f.Header.ID.String() }
+
+// CreatedAt returns the creation time of the image.
+func (f *FileImage) CreatedAt() time.Time { return time.Unix(f.f.Header.Ctime, 0) }
+
+// ModifiedAt returns the last modification time of the image.
+func (f *FileImage) ModifiedAt() time.Time { return time.Unix(f.f.Header.Mtime, 0) }
+
+// DescriptorsFree returns the number of free descriptors in the image.
+func (f *FileImage) DescriptorsFree() uint64 { return uint64(f.f.Header.Dfree) }
+
+// DescriptorsTotal returns the total number of descriptors in the image.
+func (f *FileImage) DescriptorsTotal() uint64 { return uint64(f.f.Header.Dtotal) }
+
+// DescriptorsOffset returns the offset of the descriptor table in the image.
+func (f *FileImage) DescriptorsOffset() int64 { return f.f.Header.Descroff }
+
+// DataOffset returns the offset of the data section of the image.
+func (f *FileImage) DataOffset() int64 { return f.f.Header.Dataoff }
+
+// DataSize returns the size of the data section of the image.
+func (f *FileImage) DataSize() int64 { return f.f.Header.Datalen }
+
+// DescriptorSelectorFunc returns true if d matches, and false otherwise.
+type DescriptorSelectorFunc func(d Descriptor) (bool, error)
+
+// WithDataType selects descriptors that have data type dt.
+func WithDataType(dt DataType) DescriptorSelectorFunc {
+	return func(d Descriptor) (bool, error) { return d.DataType() == dt, nil }
+}
+
+// WithID selects descriptors with ID id.
+func WithID(id uint32) DescriptorSelectorFunc {
+	return func(d Descriptor) (bool, error) { return d.ID() == id, nil }
+}
+
+// WithGroupID selects descriptors with group ID groupID.
+func WithGroupID(groupID uint32) DescriptorSelectorFunc {
+	return func(d Descriptor) (bool, error) { return d.GroupID() == groupID, nil }
+}
+
+// WithNoGroup selects descriptors that are not contained within an object group.
+func WithNoGroup() DescriptorSelectorFunc {
+	return func(d Descriptor) (bool, error) { return d.GroupID() == 0, nil }
+}
+
+// WithPartitionType selects descriptors containing a partition of type pt.
+func WithPartitionType(pt PartType) DescriptorSelectorFunc {
+	return func(d Descriptor) (bool, error) {
+		if d.DataType() != DataPartition {
+			return false, nil
+		}
+		got, err := d.d.GetPartType()
+		return got == pt, err
+	}
+}
+
+// selects returns true if d is selected by all of fns.
+func selects(d Descriptor, fns []DescriptorSelectorFunc) (bool, error) {
+	for _, fn := range fns {
+		if ok, err := fn(d); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// GetDescriptors returns the descriptors of f selected by all of fns.
+func (f *FileImage) GetDescriptors(fns ...DescriptorSelectorFunc) ([]Descriptor, error) {
+	var ds []Descriptor
+	for _, sd := range f.f.GetDescriptors() {
+		d := Descriptor{d: sd, f: f.f}
+		ok, err := selects(d, fns)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ds = append(ds, d)
+		}
+	}
+	return ds, nil
+}
+
+// GetDescriptor returns the single descriptor of f selected by all of fns. If no descriptor is
+// selected, ErrObjectNotFound is returned. If more than one is selected, ErrMultipleObjects is
+// returned. If f contains no data objects, ErrNoObjects is returned.
+func (f *FileImage) GetDescriptor(fns ...DescriptorSelectorFunc) (Descriptor, error) {
+	if f.f.Header.Dtotal == f.f.Header.Dfree {
+		return Descriptor{}, ErrNoObjects
+	}
+
+	ds, err := f.GetDescriptors(fns...)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	switch len(ds) {
+	case 0:
+		return Descriptor{}, ErrObjectNotFound
+	case 1:
+		return ds[0], nil
+	}
+	return Descriptor{}, ErrMultipleObjects
+}
+
+// Descriptor describes a data object in a SIF image.
+type Descriptor struct {
+	d sif.Descriptor
+	f *sif.FileImage
+}
+
+// Descriptor returns the sif.Descriptor wrapped by d.
+func (d Descriptor) Descriptor() sif.Descriptor { return d.d }
+
+// DataType returns the type of data object.
+func (d Descriptor) DataType() DataType { return d.d.Datatype }
+
+// ID returns the data object ID of d.
+func (d Descriptor) ID() uint32 { return d.d.ID }
+
+// GroupID returns the data object group ID of d, or zero if d is not part of a data object group.
+func (d Descriptor) GroupID() uint32 { return d.d.Groupid &^ sif.DescrGroupMask }
+
+// LinkedID returns the object/group ID d is linked to, or zero if d does not contain a linked ID.
+// If isGroup is true, the returned id is an object group ID. Otherwise, the returned id is a data
+// object ID.
+func (d Descriptor) LinkedID() (id uint32, isGroup bool) {
+	return d.d.Link &^ sif.DescrGroupMask, d.d.Link&sif.DescrGroupMask == sif.DescrGroupMask
+}
+
+// Offset returns the offset of the data object.
+func (d Descriptor) Offset() int64 { return d.d.Fileoff }
+
+// Size returns the data object size.
+func (d Descriptor) Size() int64 { return d.d.Filelen }
+
+// CreatedAt returns the creation time of the data object.
+func (d Descriptor) CreatedAt() time.Time { return time.Unix(d.d.Ctime, 0) }
+
+// ModifiedAt returns the modification time of the data object.
+func (d Descriptor) ModifiedAt() time.Time { return time.Unix(d.d.Mtime, 0) }
+
+// Name returns the name of the data object.
+func (d Descriptor) Name() string { return d.d.GetName() }
+
+// PartitionMetadata gets metadata for a partition data object.
+func (d Descriptor) PartitionMetadata() (fs FSType, pt PartType, arch string, err error) {
+	if fs, err = d.d.GetFsType(); err != nil {
+		return 0, 0, "", err
+	}
+	if pt, err = d.d.GetPartType(); err != nil {
+		return 0, 0, "", err
+	}
+	a, err := d.d.GetArch()
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return fs, pt, sif.GetGoArch(trimZeroBytes(a[:])), nil
+}
+
+// SignatureMetadata gets metadata for a signature data object.
+func (d Descriptor) SignatureMetadata() (ht HashType, fp []byte, err error) {
+	if ht, err = d.d.GetHashType(); err != nil {
+		return 0, nil, err
+	}
+	if fp, err = d.d.GetEntity(); err != nil {
+		return 0, nil, err
+	}
+	return ht, fp[:20], nil
+}
+
+// CryptoMessageMetadata gets metadata for a crypto message data object.
+func (d Descriptor) CryptoMessageMetadata() (FormatType, MessageType, error) {
+	ft, err := d.d.GetFormatType()
+	if err != nil {
+		return 0, 0, err
+	}
+	mt, err := d.d.GetMessageType()
+	if err != nil {
+		return 0, 0, err
+	}
+	return ft, mt, nil
+}
+
+// GetData returns the data object associated with descriptor d.
+func (d Descriptor) GetData() ([]byte, error) {
+	b := make([]byte, d.d.Filelen)
+	if _, err := io.ReadFull(d.GetReader(), b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// GetReader returns a io.Reader that reads the data object associated with descriptor d.
+func (d Descriptor) GetReader() io.Reader {
+	return d.d.GetReadSeeker(d.f)
+}
+
+// trimZeroBytes returns s as a string, up to the first zero byte.
+func trimZeroBytes(s []byte) string {
+	return strings.TrimRight(string(s), "\x00")
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package compat
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+const testImage = "../testdata/testcontainer2.sif"
+
+// TestValues checks that the values of package sif have not diverged from those of the fork, which
+// are fixed by the SIF specification.
+func TestValues(t *testing.T) {
+	tests := []struct {
+		name string
+		got  int64
+		want int64
+	}{
+		{"DataDeffile", int64(DataDeffile), 0x4001},
+		{"DataEnvVar", int64(DataEnvVar), 0x4002},
+		{"DataLabels", int64(DataLabels), 0x4003},
+		{"DataPartition", int64(DataPartition), 0x4004},
+		{"DataSignature", int64(DataSignature), 0x4005},
+		{"DataGenericJSON", int64(DataGenericJSON), 0x4006},
+		{"DataGeneric", int64(DataGeneric), 0x4007},
+		{"DataCryptoMessage", int64(DataCryptoMessage), 0x4008},
+		{"DataSBOM", int64(DataSBOM), 0x4009},
+		{"DataOCIBlob", int64(DataOCIBlob), 0x400b},
+		{"FsSquash", int64(FsSquash), 1},
+		{"FsExt3", int64(FsExt3), 2},
+		{"FsImmuObj", int64(FsImmuObj), 3},
+		{"FsRaw", int64(FsRaw), 4},
+		{"FsEncryptedSquashfs", int64(FsEncryptedSquashfs), 5},
+		{"PartSystem", int64(PartSystem), 1},
+		{"PartPrimSys", int64(PartPrimSys), 2},
+		{"PartData", int64(PartData), 3},
+		{"PartOverlay", int64(PartOverlay), 4},
+		{"HashSHA256", int64(HashSHA256), 1},
+		{"HashSHA384", int64(HashSHA384), 2},
+		{"HashSHA512", int64(HashSHA512), 3},
+		{"HashBLAKE2S", int64(HashBLAKE2S), 4},
+		{"HashBLAKE2B", int64(HashBLAKE2B), 5},
+		{"HashBLAKE3", int64(HashBLAKE3), 6},
+		{"FormatOpenPGP", int64(FormatOpenPGP), 1},
+		{"FormatPEM", int64(FormatPEM), 2},
+		{"MessageClearSignature", int64(MessageClearSignature), 0x100},
+		{"MessageRSAOAEP", int64(MessageRSAOAEP), 0x200},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%v: got %#x, want %#x", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// TestDivergences checks the ways in which this package diverges from the fork, as listed in the
+// package documentation. If this test fails, the documentation must be updated.
+func TestDivergences(t *testing.T) {
+	// DataOCIRootIndex is not known to package sif.
+	const dataOCIRootIndex = sif.Datatype(0x400a)
+	for _, dt := range sif.AllDatatypes() {
+		if dt == dataOCIRootIndex {
+			t.Errorf("package sif supports data type %#x, which may now be provided", int32(dt))
+		}
+	}
+
+	// HashBLAKE3 is an extension, not defined by the fork.
+	if got, want := int64(HashBLAKE3), int64(6); got != want {
+		t.Errorf("HashBLAKE3: got %#x, want %#x", got, want)
+	}
+
+	// The SBOM formats of package sif are numbered differently from those of the fork, which
+	// defines CycloneDX (JSON) 1, CycloneDX (XML) 2, GitHub (JSON) 3, SPDX (JSON) 4, SPDX (RDF) 5,
+	// SPDX (tag-value) 6, SPDX (YAML) 7 and Syft (JSON) 8.
+	sbomFormats := []struct {
+		name string
+		got  sif.SBOMFormat
+		want int64
+	}{
+		{"SBOMFormatCycloneDXJSON", sif.SBOMFormatCycloneDXJSON, 1},
+		{"SBOMFormatCycloneDXXML", sif.SBOMFormatCycloneDXXML, 2},
+		{"SBOMFormatSPDXJSON", sif.SBOMFormatSPDXJSON, 3},
+		{"SBOMFormatSPDXTagValue", sif.SBOMFormatSPDXTagValue, 4},
+	}
+	for _, f := range sbomFormats {
+		if int64(f.got) != f.want {
+			t.Errorf("%v: got %#x, want %#x", f.name, int64(f.got), f.want)
+		}
+	}
+
+	// Data types specific to package sif are numbered apart from those of the fork.
+	for _, dt := range sif.AllDatatypes() {
+		switch dt {
+		case DataDeffile, DataEnvVar, DataLabels, DataPartition, DataSignature, DataGenericJSON,
+			DataGeneric, DataCryptoMessage, DataSBOM, DataOCIBlob:
+			continue
+		}
+		if dt <= dataOCIRootIndex+1 {
+			t.Errorf("data type %v (%#x) collides with the range of the fork", dt, int32(dt))
+		}
+	}
+}
+
+// TestFileImage checks that the accessors of FileImage agree with package sif.
+func TestFileImage(t *testing.T) {
+	f, err := LoadContainerFromPath(testImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	h := f.Image().Header
+
+	if got, want := f.LaunchScript(), "#!/usr/bin/env run-singularity\n"; got != want {
+		t.Errorf("got launch script %q, want %q", got, want)
+	}
+	if got, want := f.Version(), h.GetVersion(); got != want {
+		t.Errorf("got version %v, want %v", got, want)
+	}
+	if got, want := f.PrimaryArch(), "amd64"; got != want {
+		t.Errorf("got arch %v, want %v", got, want)
+	}
+	if got, want := f.ID(), "293e8b11-dbd0-47e6-b0b9-390772c12be8"; got != want {
+		t.Errorf("got ID %v, want %v", got, want)
+	}
+	if got, want := f.CreatedAt().Unix(), h.Ctime; got != want {
+		t.Errorf("got creation time %v, want %v", got, want)
+	}
+	if got, want := f.ModifiedAt().Unix(), h.Mtime; got != want {
+		t.Errorf("got modification time %v, want %v", got, want)
+	}
+	if got, want := f.DescriptorsFree(), uint64(45); got != want {
+		t.Errorf("got %v free descriptors, want %v", got, want)
+	}
+	if got, want := f.DescriptorsTotal(), uint64(48); got != want {
+		t.Errorf("got %v total descriptors, want %v", got, want)
+	}
+	if got, want := f.DescriptorsOffset(), h.Descroff; got != want {
+		t.Errorf("got descriptors offset %v, want %v", got, want)
+	}
+	if got, want := f.DataOffset(), h.Dataoff; got != want {
+		t.Errorf("got data offset %v, want %v", got, want)
+	}
+	if got, want := f.DataSize(), h.Datalen; got != want {
+		t.Errorf("got data size %v, want %v", got, want)
+	}
+}
+
+func TestLoadContainerFromPath(t *testing.T) {
+	f, err := LoadContainerFromPath(testImage, OptLoadWithFlag(os.O_RDONLY), OptLoadSIF(sif.OptLoadStrict(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadContainerFromPath("not-found.sif"); err == nil {
+		t.Error("unexpected success loading missing image")
+	}
+}
+
+func TestGetDescriptors(t *testing.T) {
+	f, err := LoadContainerFromPath(testImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	tests := []struct {
+		name    string
+		fns     []DescriptorSelectorFunc
+		wantIDs []uint32
+		wantErr error
+	}{
+		{"All", nil, []uint32{1, 2, 3}, ErrMultipleObjects},
+		{"DataType", []DescriptorSelectorFunc{WithDataType(DataSignature)}, []uint32{3}, nil},
+		{"ID", []DescriptorSelectorFunc{WithID(1)}, []uint32{1}, nil},
+		{"GroupID", []DescriptorSelectorFunc{WithGroupID(1), WithID(2)}, []uint32{2}, nil},
+		{"NoGroup", []DescriptorSelectorFunc{WithNoGroup()}, nil, ErrObjectNotFound},
+		{"PartitionType", []DescriptorSelectorFunc{WithPartitionType(PartPrimSys)}, []uint32{2}, nil},
+		{"PartitionTypeNotFound", []DescriptorSelectorFunc{WithPartitionType(PartData)}, nil, ErrObjectNotFound},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ds, err := f.GetDescriptors(tt.fns...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []uint32
+			for _, d := range ds {
+				ids = append(ids, d.ID())
+			}
+			if len(ids) != len(tt.wantIDs) {
+				t.Fatalf("got IDs %v, want %v", ids, tt.wantIDs)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIDs[i] {
+					t.Fatalf("got IDs %v, want %v", ids, tt.wantIDs)
+				}
+			}
+
+			d, err := f.GetDescriptor(tt.fns...)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err == nil && d.ID() != tt.wantIDs[0] {
+				t.Errorf("got ID %v, want %v", d.ID(), tt.wantIDs[0])
+			}
+		})
+	}
+}
+
+func TestGetDescriptorNoObjects(t *testing.T) {
+	f := FileImage{f: &sif.FileImage{Header: sif.Header{Dfree: 48, Dtotal: 48}}}
+
+	if _, err := f.GetDescriptor(); !errors.Is(err, ErrNoObjects) {
+		t.Errorf("got error %v, want %v", err, ErrNoObjects)
+	}
+}
+
+// TestDescriptor checks that the accessors of Descriptor agree with package sif.
+func TestDescriptor(t *testing.T) {
+	f, err := LoadContainerFromPath(testImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	for _, d := range f.Image().GetDescriptors() {
+		d := d
+
+		cd, err := f.GetDescriptor(WithID(d.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := cd.DataType(), d.Datatype; got != want {
+			t.Errorf("object %v: got data type %v, want %v", d.ID, got, want)
+		}
+		if got, want := cd.GroupID(), d.Groupid&^sif.DescrGroupMask; got != want {
+			t.Errorf("object %v: got group ID %v, want %v", d.ID, got, want)
+		}
+		if got, want := cd.Offset(), d.Fileoff; got != want {
+			t.Errorf("object %v: got offset %v, want %v", d.ID, got, want)
+		}
+		if got, want := cd.Size(), d.Filelen; got != want {
+			t.Errorf("object %v: got size %v, want %v", d.ID, got, want)
+		}
+		if got, want := cd.Name(), d.GetName(); got != want {
+			t.Errorf("object %v: got name %v, want %v", d.ID, got, want)
+		}
+		if got, want := cd.CreatedAt().Unix(), d.Ctime; got != want {
+			t.Errorf("object %v: got creation time %v, want %v", d.ID, got, want)
+		}
+		if got, want := cd.ModifiedAt().Unix(), d.Mtime; got != want {
+			t.Errorf("object %v: got modification time %v, want %v", d.ID, got, want)
+		}
+
+		b, err := cd.GetData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, d.GetData(f.Image())) {
+			t.Errorf("object %v: data does not match", d.ID)
+		}
+	}
+
+	part, err := f.GetDescriptor(WithDataType(DataPartition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, pt, arch, err := part.PartitionMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs != FsSquash || pt != PartPrimSys || arch != "amd64" {
+		t.Errorf("got partition metadata %v/%v/%v", fs, pt, arch)
+	}
+
+	sig, err := f.GetDescriptor(WithDataType(DataSignature))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, isGroup := sig.LinkedID(); id != 2 || isGroup {
+		t.Errorf("got linked ID %v (group %v), want 2", id, isGroup)
+	}
+	ht, fp, err := sig.SignatureMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht != HashSHA384 || len(fp) != 20 {
+		t.Errorf("got signature metadata %v/%X", ht, fp)
+	}
+
+	if _, _, err := sig.CryptoMessageMetadata(); err == nil {
+		t.Error("unexpected success getting crypto message metadata of signature")
+	}
+}
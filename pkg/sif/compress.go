@@ -0,0 +1,294 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A data object may be compressed as it is written, by setting the Compression field of its
+// DescriptorInput. The compression method and uncompressed size of the object are recorded in a
+// trailer at the end of the Extra field of its descriptor, after any datatype specific data.
+// GetData and GetReader decompress the object transparently, while GetReadSeeker and Extent refer
+// to the data as stored, which is what signatures cover.
+//
+// OCI config and blob objects use the whole of the Extra field, and cannot be compressed. OCI
+// blobs are typically compressed already.
+//
+// The uncompressed size recorded in the trailer is not trusted. GetData holds the whole object in
+// memory, so it refuses objects larger than the limit set by OptLoadMaxDecompressedSize, while
+// GetReader decompresses the object as it is read, and is preferred for large objects.
+
+// DefaultMaxDecompressedSize is the largest uncompressed size of a data object that GetData will
+// decompress into memory, if not specified.
+const DefaultMaxDecompressedSize = 256 << 20
+
+var (
+	errCompressionUnsupported = errors.New("compression unsupported")
+	errStreamCompressed       = errors.New("streamed data object cannot be compressed")
+	errDecompressedSize       = errors.New("max decompressed size must not be negative")
+	errDecompressedTooLarge   = errors.New("decompressed data object too large")
+)
+
+// OptLoadMaxDecompressedSize specifies the largest uncompressed size, in bytes, of a data object
+// that GetData will decompress into memory. If n is zero, DefaultMaxDecompressedSize is used.
+// GetReader is not subject to the limit.
+func OptLoadMaxDecompressedSize(n int64) LoadOpt {
+	return func(lo *loadOpts) error {
+		if n < 0 {
+			return errDecompressedSize
+		}
+		lo.maxDecompressedSize = n
+		return nil
+	}
+}
+
+// maxDecompressedSize returns the largest uncompressed size of a data object that fimg will
+// decompress into memory.
+func (fimg *FileImage) maxDecompressedSize() int64 {
+	if fimg.maxDecompressed > 0 {
+		return fimg.maxDecompressed
+	}
+	return DefaultMaxDecompressedSize
+}
+
+// compressionMagic identifies the compression trailer of a descriptor.
+const compressionMagic = "SIFZ"
+
+// compressionTrailer is stored in the last bytes of the Extra field of a compressed data object.
+type compressionTrailer struct {
+	Magic       [4]byte
+	Compression Compression
+	Size        int64 // uncompressed size of the data object
+}
+
+// compressionTrailerOff is the offset of the compression trailer within the Extra field.
+var compressionTrailerOff = DescrMaxPrivLen - binary.Size(compressionTrailer{})
+
+// ParseCompression returns the compression method named s, as named by Compression.String. The
+// comparison is case-insensitive, and an empty name selects CompressionNone.
+func ParseCompression(s string) (Compression, error) {
+	if s == "" {
+		return CompressionNone, nil
+	}
+	for c := CompressionNone; c <= CompressionGzip; c++ {
+		if strings.EqualFold(s, c.String()) {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: compression %q", ErrUnknownType, s)
+}
+
+// checkCompression returns an error if data objects of type dt cannot be compressed with c.
+func checkCompression(dt Datatype, c Compression) error {
+	switch c {
+	case CompressionNone:
+		return nil
+	case CompressionGzip:
+	default:
+		return fmt.Errorf("%w: %v", errCompressionUnsupported, c)
+	}
+
+	if dt == DataOCIConfig || dt == DataOCIBlob {
+		return fmt.Errorf("%w: %v objects", errCompressionUnsupported, dt)
+	}
+	return nil
+}
+
+// trailer returns the compression trailer of d, if any.
+func (d *Descriptor) trailer() (compressionTrailer, bool) {
+	var t compressionTrailer
+	b := bytes.NewReader(d.Extra[compressionTrailerOff:])
+	if err := binary.Read(b, binary.LittleEndian, &t); err != nil {
+		return compressionTrailer{}, false
+	}
+	if string(t.Magic[:]) != compressionMagic || t.Compression == CompressionNone {
+		return compressionTrailer{}, false
+	}
+	return t, true
+}
+
+// setTrailer stores t as the compression trailer of d. If t does not describe a compressed object,
+// the Extra field of d is left unchanged.
+func (d *Descriptor) setTrailer(t compressionTrailer) {
+	if t.Compression == CompressionNone {
+		return
+	}
+
+	copy(t.Magic[:], compressionMagic)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, t) // nolint:errcheck
+	copy(d.Extra[compressionTrailerOff:], b.Bytes())
+}
+
+// GetCompression returns the method used to compress the data object described by d, or
+// CompressionNone if it is not compressed.
+func (d *Descriptor) GetCompression() Compression {
+	t, ok := d.trailer()
+	if !ok {
+		return CompressionNone
+	}
+	return t.Compression
+}
+
+// GetSize returns the size of the data object described by d, once decompressed. If the object
+// is not compressed, this is the size of the object as stored.
+func (d *Descriptor) GetSize() int64 {
+	t, ok := d.trailer()
+	if !ok {
+		return d.Filelen
+	}
+	return t.Size
+}
+
+// compressWriter returns a writer that compresses data written to it with c, and writes it to w.
+// The returned writer must be closed to flush the compressed data.
+func compressWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("%w: %v", errCompressionUnsupported, c)
+}
+
+// decompressReader returns a reader that decompresses data read from r with c.
+func decompressReader(r io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		zr.Multistream(false)
+		return zr, nil
+	}
+	return nil, fmt.Errorf("%w: %v", errCompressionUnsupported, c)
+}
+
+// decompress returns the decompressed content of the data object described by d. An error is
+// returned if the recorded uncompressed size exceeds the limit of fimg.
+func (d *Descriptor) decompress(fimg *FileImage) ([]byte, error) {
+	t, _ := d.trailer()
+
+	if max := fimg.maxDecompressedSize(); t.Size < 0 || t.Size > max {
+		return nil, fmt.Errorf("%w: %d bytes, limit is %d", errDecompressedTooLarge, t.Size, max)
+	}
+
+	r := io.NewSectionReader(fimg.limitReaderAt(fimg.Fp), d.Fileoff, d.Filelen)
+	zr, err := decompressReader(r, t.Compression)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing data object: %s", err)
+	}
+	defer zr.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(zr, t.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing data object: %s", err)
+	}
+	if int64(len(b)) != t.Size {
+		return nil, fmt.Errorf("decompressing data object: got %d bytes, want %d", len(b), t.Size)
+	}
+	return b, nil
+}
+
+// decompressReaderAt is an io.ReaderAt that decompresses a data object as it is read, without
+// holding it in memory. Reads at increasing offsets continue a single decompression stream, which
+// is restarted from the beginning of the object when an earlier offset is read.
+type decompressReaderAt struct {
+	mu   sync.Mutex
+	r    *io.SectionReader // data object as stored
+	c    Compression
+	size int64 // uncompressed size recorded in the trailer
+
+	zr  io.ReadCloser // current decompression stream, if any
+	pos int64         // offset of zr within the uncompressed data
+}
+
+// newDecompressReaderAt returns an io.ReaderAt that decompresses the data object described by d.
+func (d *Descriptor) newDecompressReaderAt(fimg *FileImage) *decompressReaderAt {
+	t, _ := d.trailer()
+
+	return &decompressReaderAt{
+		r:    io.NewSectionReader(fimg.limitReaderAt(fimg.Fp), d.Fileoff, d.Filelen),
+		c:    t.Compression,
+		size: t.Size,
+	}
+}
+
+// ReadAt reads len(p) bytes of the decompressed data starting at offset off.
+func (r *decompressReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.zr == nil || off < r.pos {
+		zr, err := decompressReader(io.NewSectionReader(r.r, 0, r.r.Size()), r.c)
+		if err != nil {
+			return 0, fmt.Errorf("decompressing data object: %w", err)
+		}
+		r.zr, r.pos = zr, 0
+	}
+
+	if off > r.pos {
+		n, err := io.CopyN(ioutil.Discard, r.zr, off-r.pos)
+		r.pos += n
+		if err != nil {
+			return 0, r.readErr(err)
+		}
+	}
+
+	want := p
+	if rem := r.size - off; int64(len(want)) > rem {
+		want = want[:rem]
+	}
+
+	n, err := io.ReadFull(r.zr, want)
+	r.pos += int64(n)
+	if err != nil {
+		return n, r.readErr(err)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readErr returns the error to report when reading the decompression stream fails with err. The
+// stream is discarded, so that a subsequent read restarts it.
+func (r *decompressReaderAt) readErr(err error) error {
+	r.zr = nil
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("decompressing data object: %w", err)
+}
+
+// errReaderAt is an io.ReaderAt that returns err.
+type errReaderAt struct {
+	err error
+}
+
+// ReadAt returns r.err.
+func (r errReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,342 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Compression
+		wantErr error
+	}{
+		{"Empty", "", CompressionNone, nil},
+		{"None", "none", CompressionNone, nil},
+		{"Gzip", "gzip", CompressionGzip, nil},
+		{"GzipUpper", "GZIP", CompressionGzip, nil},
+		{"Unknown", "lz4", 0, ErrUnknownType},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCompression(tt.s)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got compression %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateContainerCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-compress-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	deffile := []byte(strings.Repeat("bootstrap: library\nfrom: alpine\n", 256))
+	meta := []byte(`{"key":"value"}`)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "compressed.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			{
+				Datatype:    DataDeffile,
+				Groupid:     DescrDefaultGroup,
+				Link:        DescrUnusedLink,
+				Size:        int64(len(deffile)),
+				Fname:       "deffile",
+				Data:        deffile,
+				Compression: CompressionGzip,
+			},
+			{
+				Datatype:    DataGenericJSON,
+				Groupid:     DescrDefaultGroup,
+				Link:        DescrUnusedLink,
+				Size:        int64(len(meta)),
+				Fname:       "meta.json",
+				Fp:          bytes.NewReader(meta),
+				Compression: CompressionGzip,
+			},
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	for i, want := range [][]byte{deffile, meta} {
+		d, _, err := fimg.GetFromDescrID(uint32(i + 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := d.GetCompression(), CompressionGzip; got != want {
+			t.Errorf("%v: got compression %v, want %v", d.GetName(), got, want)
+		}
+		if got, want := d.GetSize(), int64(len(want)); got != want {
+			t.Errorf("%v: got size %v, want %v", d.GetName(), got, want)
+		}
+		if !bytes.Equal(d.GetData(&fimg), want) {
+			t.Errorf("%v: data does not match", d.GetName())
+		}
+
+		b, err := ioutil.ReadAll(d.GetReader(&fimg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, want) {
+			t.Errorf("%v: reader data does not match", d.GetName())
+		}
+	}
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Filelen >= d.GetSize() {
+		t.Errorf("got stored length %v, want less than %v", d.Filelen, d.GetSize())
+	}
+}
+
+func TestCreateContainerCompressionUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-compress-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := DescriptorInput{
+		Datatype:    DataOCIBlob,
+		Groupid:     DescrDefaultGroup,
+		Link:        DescrUnusedLink,
+		Size:        4,
+		Fname:       "blob",
+		Data:        []byte("blob"),
+		Compression: CompressionGzip,
+	}
+	if err := input.SetOCIBlobExtra(testOCILayerType, "sha256:"+strings.Repeat("a", 64)); err != nil {
+		t.Fatal(err)
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "unsupported.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{input},
+	}
+	if _, err := CreateContainer(cinfo); !errors.Is(err, errCompressionUnsupported) {
+		t.Errorf("got error %v, want %v", err, errCompressionUnsupported)
+	}
+}
+
+func TestCreateContainerWriterCompressed(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			{
+				Datatype:    DataDeffile,
+				Groupid:     DescrDefaultGroup,
+				Link:        DescrUnusedLink,
+				Size:        8,
+				Fname:       "deffile",
+				Data:        []byte("deffile!"),
+				Compression: CompressionGzip,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if got, want := CreateContainerWriter(&buf, cinfo), errStreamCompressed; !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+}
+
+// createCompressed creates an image in dir holding data, compressed, as its only data object, and
+// returns its path.
+func createCompressed(t *testing.T, dir string, data []byte) string {
+	t.Helper()
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "compressed.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			{
+				Datatype:    DataGeneric,
+				Groupid:     DescrDefaultGroup,
+				Link:        DescrUnusedLink,
+				Size:        int64(len(data)),
+				Fname:       "data",
+				Data:        data,
+				Compression: CompressionGzip,
+			},
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+	return cinfo.Pathname
+}
+
+func TestOptLoadMaxDecompressedSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-compress-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	path := createCompressed(t, dir, data)
+
+	tests := []struct {
+		name     string
+		n        int64
+		size     int64 // uncompressed size recorded in the trailer, if non-zero
+		wantErr  error
+		wantData bool
+	}{
+		{name: "Default", wantData: true},
+		{name: "Exact", n: int64(len(data)), wantData: true},
+		{name: "Smaller", n: int64(len(data)) - 1},
+		{name: "Negative", n: -1, wantErr: errDecompressedSize},
+		{name: "ForgedSize", size: 1 << 62},
+		{name: "NegativeSize", size: -1},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fimg, err := LoadContainer(path, true, OptLoadMaxDecompressedSize(tt.n))
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			d, _, err := fimg.GetFromDescrID(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.size != 0 {
+				d.setTrailer(compressionTrailer{Compression: CompressionGzip, Size: tt.size})
+			}
+
+			b := d.GetData(&fimg)
+			if got, want := b != nil, tt.wantData; got != want {
+				t.Fatalf("got data %v, want %v", got, want)
+			}
+			if b != nil && !bytes.Equal(b, data) {
+				t.Error("data does not match")
+			}
+		})
+	}
+}
+
+func TestGetReaderCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-compress-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 64<<10)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+	path := createCompressed(t, dir, data)
+
+	// The reader is not subject to the limit on decompressing into memory.
+	fimg, err := LoadContainer(path, true, OptLoadMaxDecompressedSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("ReadAt", func(t *testing.T) {
+		r := d.GetReader(&fimg)
+
+		if got, want := r.Size(), int64(len(data)); got != want {
+			t.Fatalf("got size %v, want %v", got, want)
+		}
+
+		// Read forwards, backwards and across the end of the object.
+		for _, off := range []int64{0, 100, 40000, 10, int64(len(data)) - 50, 0} {
+			b := make([]byte, 100)
+			n, err := r.ReadAt(b, off)
+
+			want := data[off:]
+			if len(want) > len(b) {
+				want = want[:len(b)]
+			}
+			if len(want) < len(b) {
+				if err != io.EOF {
+					t.Fatalf("offset %v: got error %v, want %v", off, err, io.EOF)
+				}
+			} else if err != nil {
+				t.Fatalf("offset %v: %v", off, err)
+			}
+			if !bytes.Equal(b[:n], want) {
+				t.Errorf("offset %v: data does not match", off)
+			}
+		}
+	})
+
+	t.Run("ReadAll", func(t *testing.T) {
+		b, err := ioutil.ReadAll(d.GetReader(&fimg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Error("data does not match")
+		}
+	})
+
+	t.Run("ForgedSize", func(t *testing.T) {
+		forged := *d
+		forged.setTrailer(compressionTrailer{Compression: CompressionGzip, Size: 1 << 62})
+
+		_, err := ioutil.ReadAll(forged.GetReader(&fimg))
+		if got, want := err, io.ErrUnexpectedEOF; !errors.Is(got, want) {
+			t.Errorf("got error %v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ctxReader is an io.Reader that fails once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// withContext returns a copy of input, the data of which is read through a reader that fails
+// once ctx is done.
+func withContext(ctx context.Context, input DescriptorInput) DescriptorInput {
+	r := input.Fp
+	if input.Data != nil {
+		// there is nothing to interrupt when copying empty data
+		if len(input.Data) == 0 {
+			return input
+		}
+		r = bytes.NewReader(input.Data)
+		input.Size = int64(len(input.Data))
+	}
+	if r == nil {
+		return input
+	}
+
+	input.Data = nil
+	input.Fp = &ctxReader{ctx: ctx, r: r}
+	return input
+}
+
+// AddObjectContext is like AddObject, but stops copying the data object once ctx is done. In
+// that case, an error wrapping the error of ctx is returned, and the image is left as it was
+// before the call.
+func (fimg *FileImage) AddObjectContext(ctx context.Context, input DescriptorInput) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := fimg.AddObject(withContext(ctx, input)); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("adding data object: %w", ctxErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// removeImage removes the image named name, along with its companion stripe files if striped.
+func removeImage(name string, striped bool) {
+	for i := 1; striped; i++ {
+		if err := os.Remove(stripeName(name, i)); err != nil {
+			break
+		}
+	}
+	_ = os.Remove(name)
+}
+
+// CreateContainerContext is like CreateContainer, but stops copying data objects once ctx is
+// done. In that case, the partially written image is removed, and an error wrapping the error of
+// ctx is returned.
+func CreateContainerContext(ctx context.Context, cinfo CreateInfo) (*FileImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	inputs := make([]DescriptorInput, 0, len(cinfo.InputDescr))
+	for _, input := range cinfo.InputDescr {
+		inputs = append(inputs, withContext(ctx, input))
+	}
+	cinfo.InputDescr = inputs
+
+	fimg, err := CreateContainer(cinfo)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			removeImage(cinfo.Pathname, cinfo.StripeSize != 0)
+			return nil, fmt.Errorf("creating container: %w", ctxErr)
+		}
+		return nil, err
+	}
+	return fimg, nil
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// cancelReader is an io.Reader that cancels a context once it has been read from.
+type cancelReader struct {
+	r      *bytes.Reader
+	cancel context.CancelFunc
+}
+
+func (cr *cancelReader) Read(p []byte) (int, error) {
+	defer cr.cancel()
+	return cr.r.Read(p[:1])
+}
+
+func TestAddObjectContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-context-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	payload := bytes.Repeat([]byte("0123456789"), 1024)
+
+	tests := []struct {
+		name      string
+		cancel    bool // cancel the context part way through the copy
+		cancelled bool // cancel the context before the call
+		wantErr   error
+	}{
+		{name: "OK"},
+		{name: "Cancelled", cancelled: true, wantErr: context.Canceled},
+		{name: "CancelledDuringCopy", cancel: true, wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				ID:         uuid.NewV4(),
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			input := DescriptorInput{
+				Datatype: DataGeneric,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     int64(len(payload)),
+				Fname:    "generic",
+				Data:     payload,
+			}
+			if tt.cancel {
+				input.Data = nil
+				input.Fp = &cancelReader{r: bytes.NewReader(payload), cancel: cancel}
+			}
+			if tt.cancelled {
+				cancel()
+			}
+
+			h := fimg.Header
+
+			before, err := os.Stat(cinfo.Pathname)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := fimg.AddObjectContext(ctx, input), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			fi, err := os.Stat(cinfo.Pathname)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr != nil {
+				if fimg.Header != h {
+					t.Error("header modified by cancelled addition")
+				}
+				if got, want := fi.Size(), before.Size(); got != want {
+					t.Errorf("got file size %v, want %v", got, want)
+				}
+				return
+			}
+
+			d, _, err := fimg.GetFromDescrID(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := d.Filelen, int64(len(payload)); got != want {
+				t.Errorf("got length %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCreateContainerContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-context-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	payload := bytes.Repeat([]byte("0123456789"), 1024)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			{
+				Datatype: DataGeneric,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     int64(len(payload)),
+				Fname:    "first",
+				Data:     payload,
+			},
+			{
+				Datatype: DataGeneric,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     int64(len(payload)),
+				Fname:    "second",
+				Fp:       &cancelReader{r: bytes.NewReader(payload), cancel: cancel},
+			},
+		},
+	}
+
+	if _, err := CreateContainerContext(ctx, cinfo); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if _, err := os.Stat(cinfo.Pathname); !os.IsNotExist(err) {
+		t.Errorf("partially written image not removed: %v", err)
+	}
+
+	// the same inputs are written in full when not cancelled
+	cinfo.InputDescr[1].Fp = bytes.NewReader(payload)
+	if _, err := CreateContainerContext(context.Background(), cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	for _, id := range []uint32{1, 2} {
+		d, _, err := fimg.GetFromDescrID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(d.GetData(&fimg), payload) {
+			t.Errorf("object %d: data does not match", id)
+		}
+	}
+}
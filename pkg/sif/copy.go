@@ -0,0 +1,149 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// A data object may be copied from one image to another with CopyObject, without extracting it
+// to a temporary file. The data is copied as stored, so compressed objects are not recompressed,
+// and the descriptor metadata of the object, including its name, timestamps, ownership and
+// datatype specific data, is copied along with it. Where both images are files on disk, the copy
+// is offloaded to the kernel, which may share extents between the files where the file system
+// supports it.
+
+// copyOpts accumulates object copy options.
+type copyOpts struct {
+	groupID *uint32
+	link    *uint32
+}
+
+// CopyOpt are used to specify object copy options.
+type CopyOpt func(*copyOpts) error
+
+// OptCopyGroupID specifies that the copied object be a member of the object group with the
+// specified groupID in the destination image, rather than of the group of the source object. A
+// groupID of zero specifies that the copied object be a member of no group.
+func OptCopyGroupID(groupID uint32) CopyOpt {
+	return func(co *copyOpts) error {
+		if groupID == 0 {
+			groupID = DescrUnusedGroup
+		} else if err := checkGroupID(groupID); err != nil {
+			return err
+		} else {
+			groupID |= DescrGroupMask
+		}
+		co.groupID = &groupID
+		return nil
+	}
+}
+
+// OptCopyLink specifies the link of the copied object, as for the Link field of DescriptorInput,
+// rather than the link of the source object. As IDs are not preserved by a copy, the links of
+// objects such as signatures usually need to be remapped.
+func OptCopyLink(link uint32) CopyOpt {
+	return func(co *copyOpts) error {
+		co.link = &link
+		return nil
+	}
+}
+
+// CopyObject copies the data object with the specified id from src to dst, which may be the same
+// image, and returns the ID of the copy. The copy keeps the group and link of the source object,
+// unless specified otherwise by opts. As for AddObject, the descriptor table of dst is grown if
+// no descriptor is free, where the image version permits.
+func CopyObject(dst, src *FileImage, id uint32, opts ...CopyOpt) (uint32, error) {
+	co := copyOpts{}
+	for _, opt := range opts {
+		if err := opt(&co); err != nil {
+			return 0, err
+		}
+	}
+
+	if src.IsThin() {
+		return 0, ErrThin
+	}
+	if err := dst.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	// grow the descriptor table if full, where the image version permits; where dst is src, the
+	// data section may be moved, so this precedes looking up the source object
+	if dst.Header.Dfree == 0 {
+		if err := dst.guarded(dst.growDescriptors); err != nil {
+			return 0, err
+		}
+	}
+
+	// take a copy of the source descriptor, as dst may be src
+	sd, _, err := src.GetFromDescrID(id)
+	if err != nil {
+		return 0, err
+	}
+	d := *sd
+
+	input := DescriptorInput{
+		Datatype: d.Datatype,
+		Groupid:  d.Groupid,
+		Link:     d.Link,
+		Size:     d.Filelen,
+		Fname:    d.GetName(),
+	}
+	if co.groupID != nil {
+		input.Groupid = *co.groupID
+	}
+	if co.link != nil {
+		input.Link = *co.link
+	}
+	input.Extra.Write(d.Extra[:])
+
+	if input.Fp, err = src.copyReader(dst, &d); err != nil {
+		return 0, err
+	}
+
+	idx, err := dst.stageAdd(input)
+	if err != nil {
+		return 0, fmt.Errorf("copying data object %d: %w", id, err)
+	}
+
+	// the data is written as stored, so the Extra field of the source, including any compression
+	// and checksum trailers, applies to the copy as is
+	nd := &dst.DescrArr[idx]
+	nd.Ctime = d.Ctime
+	nd.Mtime = d.Mtime
+	nd.UID = d.UID
+	nd.Gid = d.Gid
+	nd.Name = d.Name
+	nd.Extra = d.Extra
+
+	if err := dst.commitAdd(); err != nil {
+		return 0, err
+	}
+	return nd.ID, nil
+}
+
+// copyReader returns a reader of the data object described by d, as stored in fimg, to be copied
+// to dst. Where both images are separate files on disk, the reader is limited to the object within
+// the file of fimg, so the copy may be offloaded to the kernel.
+func (fimg *FileImage) copyReader(dst *FileImage, d *Descriptor) (io.Reader, error) {
+	f, ok := fimg.Fp.(*os.File)
+	if _, dok := dst.Fp.(*os.File); !ok || !dok {
+		return d.GetReadSeeker(fimg), nil
+	}
+
+	// the offset of a file shared with dst must not be disturbed, and rate limits must be honoured
+	if fimg.Fp == dst.Fp || fimg.limiter != nil || d.Filelen == 0 {
+		return d.GetReadSeeker(fimg), nil
+	}
+
+	if _, err := f.Seek(d.Fileoff, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seeking to data object %d: %s", d.ID, err)
+	}
+	return io.LimitReader(f, d.Filelen), nil
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestCopyObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-copy-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("some data to be copied"), 1024)
+
+	part := DescriptorInput{
+		Datatype:    DataPartition,
+		Groupid:     DescrDefaultGroup,
+		Link:        DescrUnusedLink,
+		Size:        int64(len(data)),
+		Fname:       "rootfs",
+		Data:        data,
+		Compression: CompressionGzip,
+		Checksum:    HashSHA256,
+	}
+	if err := part.SetPartExtra(FsSquash, PartPrimSys, HdrArchAMD64); err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(name string, inputs ...DescriptorInput) *FileImage {
+		cinfo := CreateInfo{
+			Pathname:   filepath.Join(dir, name+".sif"),
+			Launchstr:  HdrLaunch,
+			Sifversion: HdrVersion3,
+			ID:         uuid.NewV4(),
+			DescrCount: 2,
+			InputDescr: inputs,
+		}
+		if _, err := CreateContainer(cinfo); err != nil {
+			t.Fatal(err)
+		}
+
+		fimg, err := LoadContainer(cinfo.Pathname, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &fimg
+	}
+
+	empty := DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     1,
+		Fname:    "empty",
+		Data:     []byte{},
+	}
+
+	tests := []struct {
+		name      string
+		id        uint32
+		same      bool
+		opts      []CopyOpt
+		wantGroup uint32
+		wantLink  uint32
+		wantErr   error
+	}{
+		{name: "Partition", id: 1, wantGroup: DescrDefaultGroup, wantLink: DescrUnusedLink},
+		{name: "Empty", id: 2, wantGroup: DescrDefaultGroup, wantLink: 1},
+		{
+			name:      "Remapped",
+			id:        2,
+			opts:      []CopyOpt{OptCopyGroupID(5), OptCopyLink(DescrUnusedLink)},
+			wantGroup: 5 | DescrGroupMask,
+			wantLink:  DescrUnusedLink,
+		},
+		{
+			name:      "Ungrouped",
+			id:        2,
+			opts:      []CopyOpt{OptCopyGroupID(0)},
+			wantGroup: DescrUnusedGroup,
+			wantLink:  1,
+		},
+		{name: "SameImage", id: 2, same: true, wantGroup: DescrDefaultGroup, wantLink: 1},
+		{name: "GroupInvalid", id: 1, opts: []CopyOpt{OptCopyGroupID(DescrGroupMask)}, wantErr: errGroupIDInvalid},
+		{name: "NotFound", id: 3, wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			src := create(tt.name+"-src", part, empty)
+			defer src.UnloadContainer() // nolint:errcheck
+
+			dst := src
+			if !tt.same {
+				dst = create(tt.name + "-dst")
+				defer dst.UnloadContainer() // nolint:errcheck
+			}
+
+			id, err := CopyObject(dst, src, tt.id, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// the descriptor table of the image is grown when copying within it
+			if tt.same && id != 3 {
+				t.Errorf("got ID %v, want %v", id, 3)
+			}
+
+			// check the copy as loaded from disk
+			path := dst.Fp.Name()
+			if err := dst.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+			fimg, err := LoadContainer(path, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			sd, _, err := src.GetFromDescrID(tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, _, err := fimg.GetFromDescrID(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := d.Groupid, tt.wantGroup; got != want {
+				t.Errorf("got group %#x, want %#x", got, want)
+			}
+			if got, want := d.Link, tt.wantLink; got != want {
+				t.Errorf("got link %v, want %v", got, want)
+			}
+			if got, want := d.GetName(), sd.GetName(); got != want {
+				t.Errorf("got name %q, want %q", got, want)
+			}
+			if d.Ctime != sd.Ctime || d.Mtime != sd.Mtime || d.UID != sd.UID || d.Gid != sd.Gid {
+				t.Errorf("got times and owner %v %v %v %v, want %v %v %v %v",
+					d.Ctime, d.Mtime, d.UID, d.Gid, sd.Ctime, sd.Mtime, sd.UID, sd.Gid)
+			}
+			if d.Extra != sd.Extra {
+				t.Error("extra data differs")
+			}
+
+			if tt.id != 1 {
+				return
+			}
+
+			if got, want := fimg.Header.GetArch(), HdrArchAMD64; got != want {
+				t.Errorf("got arch %q, want %q", got, want)
+			}
+			if err := d.VerifyData(&fimg); err != nil {
+				t.Error(err)
+			}
+			b, err := ioutil.ReadAll(d.GetReader(&fimg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, data) {
+				t.Error("data differs")
+			}
+		})
+	}
+}
+
+func TestCopyObjectPrimPart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-copy-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	part := DescriptorInput{
+		Datatype: DataPartition,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     4,
+		Fname:    "rootfs",
+		Data:     []byte("data"),
+	}
+	if err := part.SetPartExtra(FsSquash, PartPrimSys, HdrArchAMD64); err != nil {
+		t.Fatal(err)
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{part},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	// an image may hold only one primary partition, so the copy is refused and the image is
+	// left unchanged
+	if _, err := CopyObject(&fimg, &fimg, 1); err == nil {
+		t.Fatal("got nil error")
+	}
+	if got, want := fimg.Header.Dfree, int64(DescrNumEntries-1); got != want {
+		t.Errorf("got %v free descriptors, want %v", got, want)
+	}
+}
@@ -11,15 +11,30 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"os/user"
 	"path"
+	"sort"
 	"strconv"
-	"time"
 )
 
+var (
+	errDescrCountInvalid  = errors.New("descriptor count invalid")
+	errDataOffsetInvalid  = errors.New("data offset invalid")
+	errNotSystemPartition = errors.New("not a system partition")
+	errAlignmentInvalid   = errors.New("alignment invalid")
+)
+
+// DefaultFileMode is the permissions of image files created by CreateContainer, unless the Mode
+// field of CreateInfo is set. Images are executable, as they may be run using their launch
+// script. As with os.OpenFile, the umask of the process is applied when a file is created, and
+// the permissions of an existing file are not changed.
+const DefaultFileMode os.FileMode = 0755
+
 // Find next offset aligned to block size.
 func nextAligned(offset int64, align int) int64 {
 	align64 := uint64(align)
@@ -80,59 +95,153 @@ func fillDescriptor(fimg *FileImage, index int, input DescriptorInput) (err erro
 	descr.Used = true
 	descr.Groupid = input.Groupid
 	descr.Link = input.Link
+	if err := checkCompression(input.Datatype, input.Compression); err != nil {
+		return err
+	}
+	if err := checkChecksum(input.Datatype, input.Checksum); err != nil {
+		return err
+	}
+	if err := checkSecrets(input); err != nil {
+		return err
+	}
+
 	align := os.Getpagesize()
 	if input.Alignment != 0 {
+		if input.Alignment < 0 || input.Alignment&(input.Alignment-1) != 0 {
+			return fmt.Errorf("%w: %d is not a power of two", errAlignmentInvalid, input.Alignment)
+		}
 		align = input.Alignment
 	}
+	if input.Size < 0 {
+		return fmt.Errorf("%w: data object size %d", errSizeInvalid, input.Size)
+	}
 	descr.Fileoff, err = setFileOffNA(fimg, align)
 	if err != nil {
 		return
 	}
+	if _, err := addSize(descr.Fileoff, input.Size); err != nil {
+		return fmt.Errorf("data object too large: %w", err)
+	}
 	descr.Filelen = input.Size
 	descr.Storelen = descr.Fileoff + descr.Filelen - curoff
-	descr.Ctime = time.Now().Unix()
-	descr.Mtime = time.Now().Unix()
-	descr.UID, descr.Gid, err = getUserIDs()
+	descr.Ctime = fimg.now()
+	descr.Mtime = fimg.now()
+	descr.UID, descr.Gid, err = fimg.userIDs()
 	if err != nil {
 		return fmt.Errorf("filling descriptor: %s", err)
 	}
 	descr.SetName(path.Base(input.Fname))
 	descr.SetExtra(input.Extra.Bytes())
+	descr.setTrailer(compressionTrailer{Compression: input.Compression, Size: input.Size})
 
-	// Check that none or only 1 primary partition is ever set
-	if descr.Datatype == DataPartition {
-		ptype, err := descr.GetPartType()
+	return fimg.addPrimPart(descr)
+}
+
+// addPrimPart checks that none or only 1 primary partition is ever set, following the use of
+// descr. If descr is a primary partition, it is recorded as such, and the global header Arch
+// field is derived from it.
+func (fimg *FileImage) addPrimPart(descr *Descriptor) error {
+	if descr.Datatype != DataPartition {
+		return nil
+	}
+
+	ptype, err := descr.GetPartType()
+	if err != nil {
+		return err
+	}
+	if ptype != PartPrimSys {
+		return nil
+	}
+
+	arch, err := descr.GetArch()
+	if err != nil {
+		return err
+	}
+
+	// multi-architecture images may hold one primary partition per architecture
+	if fimg.IsMultiArch() {
+		indices, err := fimg.primParts(trimZeroBytes(arch[:]))
 		if err != nil {
 			return err
 		}
-		if ptype == PartPrimSys {
-			if fimg.PrimPartID != 0 {
-				return fmt.Errorf("only 1 FS data object may be a primary partition")
-			}
-			fimg.PrimPartID = descr.ID
-			arch, err := descr.GetArch()
-			if err != nil {
-				return err
-			}
-			copy(fimg.Header.Arch[:], arch[:])
+		if len(indices) > 1 {
+			return fmt.Errorf("only 1 FS data object may be a primary partition for arch %v",
+				GetGoArch(trimZeroBytes(arch[:])))
 		}
+		fimg.setPrimPartID()
+		return nil
 	}
 
-	return
+	if fimg.PrimPartID != 0 && fimg.PrimPartID != descr.ID {
+		return fmt.Errorf("only 1 FS data object may be a primary partition")
+	}
+	fimg.PrimPartID = descr.ID
+	fimg.deriveArch(arch)
+
+	return nil
 }
 
 // Write new data object to the SIF file.
 func writeDataObject(fimg *FileImage, index int, input DescriptorInput) error {
+	var f io.Writer = fimg.Fp
+
+	// zero blocks may be skipped only where holes are supported by a file on disk
+	var sw *sparseWriter
+	if _, ok := fimg.Fp.(*os.File); ok && input.Sparse {
+		var err error
+		if sw, err = newSparseWriter(fimg.Fp); err != nil {
+			return err
+		}
+		f = sw
+	}
+
 	// if we have bytes in input.data use that instead of an input file
+	w := fimg.contentWriter(fimg.limitWriter(f))
+	for _, h := range input.Hashes {
+		w = io.MultiWriter(w, h)
+	}
+
+	var ch hash.Hash
+	if input.Checksum != 0 {
+		var err error
+		if ch, err = newChecksumHash(input.Checksum); err != nil {
+			return err
+		}
+		w = io.MultiWriter(w, ch)
+	}
+
+	// compress data as it is written, counting the bytes stored
+	var zw io.WriteCloser
+	var stored *countWriter
+	if input.Compression != CompressionNone {
+		stored = &countWriter{w: w}
+
+		var err error
+		if zw, err = compressWriter(stored, input.Compression); err != nil {
+			return err
+		}
+		w = zw
+	}
+
 	if input.Data != nil {
-		if _, err := fimg.Fp.Write(input.Data); err != nil {
+		if _, err := w.Write(input.Data); err != nil {
 			return fmt.Errorf("copying data object data to SIF file: %s", err)
 		}
 	} else {
-		n, err := io.Copy(fimg.Fp, input.Fp)
+		r := input.Fp
+		// read no more than one byte beyond the declared size, to detect oversized input; a reader
+		// already limited to the declared size is left unwrapped, so that copying from a file may
+		// be offloaded to the kernel
+		if lr, ok := r.(*io.LimitedReader); input.Size != 0 && !(ok && lr.N == input.Size) {
+			r = io.LimitReader(r, input.Size+1)
+		}
+		n, err := io.CopyBuffer(w, r, fimg.buffer())
 		if err != nil {
 			return fmt.Errorf("copying data object file to SIF file: %s", err)
 		}
+		if n > input.Size && input.Size != 0 {
+			return fmt.Errorf("data object larger than declared size %d", input.Size)
+		}
 		if n != input.Size && input.Size != 0 {
 			return fmt.Errorf("short write while copying to SIF file")
 		}
@@ -144,18 +253,39 @@ func writeDataObject(fimg *FileImage, index int, input DescriptorInput) error {
 		}
 	}
 
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("compressing data object: %s", err)
+		}
+
+		descr := &fimg.DescrArr[index]
+		descr.setTrailer(compressionTrailer{Compression: input.Compression, Size: descr.Filelen})
+		descr.Storelen += stored.n - descr.Filelen
+		descr.Filelen = stored.n
+	}
+
+	if ch != nil {
+		t := checksumTrailer{Hashtype: input.Checksum}
+		copy(t.Digest[:], ch.Sum(nil))
+		fimg.DescrArr[index].setChecksum(t)
+	}
+
+	if sw != nil {
+		return sw.finish()
+	}
 	return nil
 }
 
-// Find a free descriptor and create a memory representation for addition to the SIF file.
-func createDescriptor(fimg *FileImage, input DescriptorInput) (err error) {
+// Find a free descriptor and create a memory representation for addition to the SIF file,
+// returning the index of the descriptor.
+func createDescriptor(fimg *FileImage, input DescriptorInput) (int, error) {
 	var (
 		idx int
 		v   Descriptor
 	)
 
 	if fimg.Header.Dfree == 0 {
-		return fmt.Errorf("no descriptor table free entry")
+		return 0, ErrNoFreeDescriptor
 	}
 
 	// look for a free entry in the descriptor table
@@ -165,7 +295,17 @@ func createDescriptor(fimg *FileImage, input DescriptorInput) (err error) {
 		}
 	}
 	if int64(idx) == fimg.Header.Dtotal-1 && fimg.DescrArr[idx].Used {
-		return fmt.Errorf("no descriptor table free entry, warning: header.Dfree was > 0")
+		return 0, fmt.Errorf("%w, warning: header.Dfree was > 0", ErrNoFreeDescriptor)
+	}
+
+	return idx, createDescriptorAt(fimg, idx, input)
+}
+
+// Create a memory representation of the descriptor at the free entry idx of the descriptor table,
+// and write its data object at the current file offset.
+func createDescriptorAt(fimg *FileImage, idx int, input DescriptorInput) (err error) {
+	if fimg.Header.Dfree == 0 || fimg.DescrArr[idx].Used {
+		return ErrNoFreeDescriptor
 	}
 
 	// fill in SIF file descriptor
@@ -179,16 +319,42 @@ func createDescriptor(fimg *FileImage, input DescriptorInput) (err error) {
 	}
 
 	// update some global header fields from adding this new descriptor
+	if fimg.Header.Datalen, err = addSize(fimg.Header.Datalen, fimg.DescrArr[idx].Storelen); err != nil {
+		return fmt.Errorf("data section: %w", err)
+	}
 	fimg.Header.Dfree--
-	fimg.Header.Datalen += fimg.DescrArr[idx].Storelen
 
 	return
 }
 
+// placementRank returns the rank of the region in which objects with placement hint p are placed.
+func placementRank(p Placement) int {
+	switch p {
+	case PlacementHot:
+		return 0
+	case PlacementCold:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// placementOrder returns the indices of inputs in the order their data objects are to be written.
+func placementOrder(inputs []DescriptorInput) []int {
+	order := make([]int, len(inputs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return placementRank(inputs[order[i]].Placement) < placementRank(inputs[order[j]].Placement)
+	})
+	return order
+}
+
 // Release and write the data object descriptor to backing storage (SIF container file).
 func writeDescriptors(fimg *FileImage) error {
 	// first, move to descriptor start offset
-	if _, err := fimg.Fp.Seek(DescrStartOffset, 0); err != nil {
+	if _, err := fimg.Fp.Seek(fimg.Header.Descroff, 0); err != nil {
 		return fmt.Errorf("seeking to descriptor start offset: %s", err)
 	}
 
@@ -213,15 +379,133 @@ func writeHeader(fimg *FileImage) error {
 		return fmt.Errorf("binary writing header to buf: %s", err)
 	}
 
+	// the header extension immediately follows the global header
+	if hasHeaderExt(fimg.Header.GetVersion()) {
+		sm, err := fimg.syncStripeMap()
+		if err != nil {
+			return fmt.Errorf("writing stripe map: %s", err)
+		}
+		if err := writeHeaderExt(fimg.Fp, &fimg.Header, fimg.DescrArr, fimg.flags, sm); err != nil {
+			return fmt.Errorf("writing header extension: %s", err)
+		}
+		fimg.descrCRCErr = nil
+	}
+
 	return nil
 }
 
+// layout returns the number of descriptors to reserve, and the offset at which data objects
+// start, validating any values specified in cinfo.
+func (cinfo CreateInfo) layout() (count, dataoff int64, err error) {
+	count = cinfo.DescrCount
+	if count == 0 {
+		count = DescrNumEntries
+
+		// a dynamic table is sized to hold all inputs
+		if n := int64(len(cinfo.InputDescr)); n > count && hasDynamicTable(cinfo.Sifversion) {
+			count = n
+		}
+	}
+	if count < 1 || count > DescrMaxEntries {
+		return 0, 0, fmt.Errorf("%w: %d not in range [1, %d]", errDescrCountInvalid, count, DescrMaxEntries)
+	}
+
+	// data must not overlap the descriptor table
+	end := DescrStartOffset + count*int64(binary.Size(Descriptor{}))
+
+	dataoff = cinfo.DataOffset
+	if dataoff == 0 {
+		dataoff = DataStartOffset
+		if dataoff < end {
+			dataoff = nextAligned(end, DescrStartOffset)
+		}
+	}
+	if dataoff < end {
+		return 0, 0, fmt.Errorf("%w: %d overlaps descriptor table ending at %d", errDataOffsetInvalid, dataoff, end)
+	}
+
+	// the stripe map is recorded in the header extension, and the main file of a striped image
+	// must hold the entire descriptor table
+	if cinfo.StripeSize != 0 && !hasHeaderExt(cinfo.Sifversion) {
+		return 0, 0, errStripeUnsupported
+	}
+	if cinfo.StripeSize != 0 && cinfo.StripeSize < dataoff {
+		return 0, 0, fmt.Errorf("%w: %d is smaller than data offset %d",
+			errStripeSizeInvalid, cinfo.StripeSize, dataoff)
+	}
+
+	return count, dataoff, nil
+}
+
 // CreateContainer is responsible for the creation of a new SIF container
 // file. It takes the creation information specification as input
 // and produces an output file as specified in the input data.
+//
+// Data objects are placed in the data section according to their Placement
+// hint, and are otherwise written in input order.
+//
+// By default, DescrNumEntries descriptors are reserved and data objects
+// start at DataStartOffset. Small images may reduce these by setting
+// DescrCount and DataOffset, and images holding many objects may increase
+// them.
 func CreateContainer(cinfo CreateInfo) (fimg *FileImage, err error) {
-	fimg = &FileImage{}
-	fimg.DescrArr = make([]Descriptor, DescrNumEntries)
+	if fimg, err = newFileImage(cinfo); err != nil {
+		return nil, err
+	}
+
+	// Create container file
+	if cinfo.StripeSize != 0 {
+		fimg.Fp, err = createStriped(cinfo.Pathname, cinfo.StripeSize, cinfo.fileMode())
+	} else {
+		fimg.Fp, err = os.OpenFile(cinfo.Pathname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, cinfo.fileMode())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("container file creation failed: %s", err)
+	}
+	defer fimg.Fp.Close()
+
+	err = writeContainer(fimg, cinfo.InputDescr)
+	return
+}
+
+// fileMode returns the permissions of the file(s) created as specified by cinfo.
+func (cinfo CreateInfo) fileMode() os.FileMode {
+	if cinfo.Mode == 0 {
+		return DefaultFileMode
+	}
+	return cinfo.Mode.Perm()
+}
+
+// fileMode returns the permissions of the file underlying fimg, plus write permission for the
+// owner, to be given to files derived from it, so that a copy of an image is no more accessible to
+// others than the image. If the permissions of fimg cannot be determined, DefaultFileMode is
+// returned.
+func (fimg *FileImage) fileMode() os.FileMode {
+	if fimg.Fp != nil {
+		if fi, err := fimg.Fp.Stat(); err == nil {
+			return fi.Mode().Perm() | 0200
+		}
+	}
+	return DefaultFileMode
+}
+
+// newFileImage returns a FileImage holding a fresh global header and descriptor table laid out as
+// specified by cinfo, with no backing file.
+func newFileImage(cinfo CreateInfo) (*FileImage, error) {
+	count, dataoff, err := cinfo.layout()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(cinfo.InputDescr)) > count {
+		return nil, ErrNoFreeDescriptor
+	}
+
+	if cinfo.BufferSize < 0 {
+		return nil, errBufferSize
+	}
+
+	fimg := &FileImage{clock: cinfo.Clock, bufferSize: cinfo.BufferSize}
+	fimg.DescrArr = make([]Descriptor, count)
 
 	// Prepare a fresh global header
 	copy(fimg.Header.Launch[:], cinfo.Launchstr)
@@ -229,42 +513,51 @@ func CreateContainer(cinfo CreateInfo) (fimg *FileImage, err error) {
 	copy(fimg.Header.Version[:], cinfo.Sifversion)
 	copy(fimg.Header.Arch[:], HdrArchUnknown)
 	copy(fimg.Header.ID[:], cinfo.ID[:])
-	fimg.Header.Ctime = time.Now().Unix()
-	fimg.Header.Mtime = time.Now().Unix()
-	fimg.Header.Dfree = DescrNumEntries
-	fimg.Header.Dtotal = DescrNumEntries
+	fimg.Header.Ctime = fimg.now()
+	fimg.Header.Mtime = fimg.now()
+	fimg.Header.Dfree = count
+	fimg.Header.Dtotal = count
 	fimg.Header.Descroff = DescrStartOffset
-	fimg.Header.Dataoff = DataStartOffset
+	fimg.Header.Dataoff = dataoff
 
-	// Create container file
-	fimg.Fp, err = os.OpenFile(cinfo.Pathname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		return nil, fmt.Errorf("container file creation failed: %s", err)
+	fimg.setReproducible(cinfo)
+
+	if cinfo.DescrChecksum {
+		if !hasHeaderExt(cinfo.Sifversion) {
+			return nil, errDescrCRCUnsupported
+		}
+		fimg.flags |= hdrFlagDescrCRC
 	}
-	defer fimg.Fp.Close()
 
+	return fimg, nil
+}
+
+// writeContainer writes the data objects described by inputs to fimg.Fp, followed by the
+// descriptor table and global header.
+func writeContainer(fimg *FileImage, inputs []DescriptorInput) error {
 	// set file pointer to start of data section */
-	if _, err = fimg.Fp.Seek(DataStartOffset, 0); err != nil {
-		return nil, fmt.Errorf("setting file offset pointer to DataStartOffset: %s", err)
+	if _, err := fimg.Fp.Seek(fimg.Header.Dataoff, 0); err != nil {
+		return fmt.Errorf("setting file offset pointer to data offset: %s", err)
 	}
 
-	for _, v := range cinfo.InputDescr {
-		if err = createDescriptor(fimg, v); err != nil {
-			return
+	// Data objects are written in placement order, but descriptors keep their input order
+	for _, i := range placementOrder(inputs) {
+		if err := createDescriptorAt(fimg, i, inputs[i]); err != nil {
+			return err
 		}
 	}
 
 	// Write down the descriptor array
-	if err = writeDescriptors(fimg); err != nil {
-		return
+	if err := writeDescriptors(fimg); err != nil {
+		return err
 	}
 
-	// Write down global header to file
-	if err = writeHeader(fimg); err != nil {
-		return
+	if err := fimg.deriveID(); err != nil {
+		return err
 	}
 
-	return
+	// Write down global header to file
+	return writeHeader(fimg)
 }
 
 func zeroData(fimg *FileImage, descr *Descriptor) error {
@@ -294,15 +587,6 @@ func zeroData(fimg *FileImage, descr *Descriptor) error {
 }
 
 func resetDescriptor(fimg *FileImage, index int) error {
-	// If we remove the primary partition, set the global header Arch field to HdrArchUnknown
-	// to indicate that the SIF file doesn't include a primary partition and no dependency
-	// on any architecture exists.
-	_, idx, _ := fimg.GetPartPrimSys()
-	if idx == index {
-		fimg.PrimPartID = 0
-		copy(fimg.Header.Arch[:], HdrArchUnknown)
-	}
-
 	offset := fimg.Header.Descroff + int64(index)*int64(binary.Size(fimg.DescrArr[0]))
 
 	// first, move to descriptor offset
@@ -315,37 +599,129 @@ func resetDescriptor(fimg *FileImage, index int) error {
 		return fmt.Errorf("binary writing empty descriptor: %s", err)
 	}
 
+	// keep the in-memory copy in sync, so the descriptor is not written back by a later update
+	releaseDescriptor(fimg, index)
+
 	return nil
 }
 
-// AddObject add a new data object and its descriptor into the specified SIF file.
-func (fimg *FileImage) AddObject(input DescriptorInput) error {
+// releaseDescriptor frees the descriptor at index in memory only.
+func releaseDescriptor(fimg *FileImage, index int) {
+	// If we remove the primary partition, set the global header Arch field to HdrArchUnknown
+	// to indicate that the SIF file doesn't include a primary partition and no dependency
+	// on any architecture exists. Multi-architecture images keep their header Arch field.
+	if _, idx, _ := fimg.GetPartPrimSys(); idx == index && !fimg.IsMultiArch() {
+		fimg.PrimPartID = 0
+		var unknown [HdrArchLen]byte
+		copy(unknown[:], HdrArchUnknown)
+		fimg.deriveArch(unknown)
+	}
+
+	fimg.DescrArr[index] = Descriptor{}
+
+	if fimg.IsMultiArch() {
+		fimg.setPrimPartID()
+	}
+}
+
+// stageAdd writes the data object described by input to the end of the data section, and creates
+// its descriptor in memory only, returning the index of the descriptor.
+func (fimg *FileImage) stageAdd(input DescriptorInput) (int, error) {
+	// note the size of the file, so partially written data can be discarded
+	size, err := fimg.Fp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("seeking to end of file: %s", err)
+	}
+
 	// set file pointer to the end of data section
 	if _, err := fimg.Fp.Seek(fimg.Header.Dataoff+fimg.Header.Datalen, 0); err != nil {
-		return fmt.Errorf("setting file offset pointer to DataStartOffset: %s", err)
+		return 0, fmt.Errorf("setting file offset pointer to DataStartOffset: %s", err)
 	}
 
-	// create a new descriptor entry from input data
-	if err := createDescriptor(fimg, input); err != nil {
-		return err
+	// create a new descriptor entry from input data, restoring the state of the image if the data
+	// object cannot be written, such as when a stream is interrupted
+	descrs := append([]Descriptor(nil), fimg.DescrArr...)
+	h, primPartID := fimg.Header, fimg.PrimPartID
+	idx, err := createDescriptor(fimg, input)
+	if err != nil {
+		fimg.DescrArr, fimg.Header, fimg.PrimPartID = descrs, h, primPartID
+
+		// discard partially written data; block devices cannot be truncated, and data beyond the
+		// data section is ignored in any case
+		_ = fimg.Fp.Truncate(size)
+
+		return 0, err
 	}
+	return idx, nil
+}
 
-	// write down the descriptor array
-	if err := writeDescriptors(fimg); err != nil {
+// AddObject add a new data object and its descriptor into the specified SIF file.
+//
+// If no descriptor is free, the descriptor table of images of HdrVersion3 or later is grown, which
+// may require the data section to be moved. The table of images of earlier versions is fixed, and
+// ErrNoFreeDescriptor is returned.
+func (fimg *FileImage) AddObject(input DescriptorInput) error {
+	if err := fimg.checkWritable(); err != nil {
 		return err
 	}
 
-	fimg.Header.Mtime = time.Now().Unix()
-	// write down global header to file
-	if err := writeHeader(fimg); err != nil {
-		return err
+	// grow the descriptor table if full, where the image version permits
+	if fimg.Header.Dfree == 0 {
+		if err := fimg.guarded(fimg.growDescriptors); err != nil {
+			return err
+		}
 	}
 
-	if err := fimg.Fp.Sync(); err != nil {
-		return fmt.Errorf("while sync'ing new data object to SIF file: %s", err)
+	if _, err := fimg.stageAdd(input); err != nil {
+		return err
 	}
 
-	return nil
+	return fimg.commitAdd()
+}
+
+// commitAdd writes the descriptor table and global header, following the addition of a data
+// object.
+func (fimg *FileImage) commitAdd() error {
+	return fimg.guarded(func() error {
+		// write down the descriptor array
+		if err := writeDescriptors(fimg); err != nil {
+			return err
+		}
+
+		fimg.Header.Mtime = fimg.now()
+		// write down global header to file
+		if err := writeHeader(fimg); err != nil {
+			return err
+		}
+
+		if err := fimg.Fp.Sync(); err != nil {
+			return fmt.Errorf("while sync'ing new data object to SIF file: %s", err)
+		}
+
+		// the file now extends to at least the end of the data section
+		if end := fimg.Header.Dataoff + fimg.Header.Datalen; end > fimg.Filesize {
+			fimg.Filesize = end
+		}
+
+		return nil
+	})
+}
+
+// AddObjectFromReader adds a new data object, read from r, and its descriptor into the specified
+// SIF file. The data object is copied from r as it is read, so it need not be held in memory, and
+// the Data and Fp fields of input are ignored.
+//
+// If input.Size is non-zero, r must supply exactly that many bytes. Otherwise, r is read until
+// EOF, and the size of the data object is determined by the number of bytes read. If an error
+// occurs while reading r, the descriptors and global header of the image are left unchanged.
+func (fimg *FileImage) AddObjectFromReader(r io.Reader, input DescriptorInput) error {
+	if r == nil {
+		return fmt.Errorf("provided reader for data object is invalid")
+	}
+
+	input.Data = nil
+	input.Fp = r
+	return fimg.AddObject(input)
 }
 
 // descrIsLast return true if passed descriptor's object is the last in a SIF file.
@@ -382,53 +758,62 @@ func compactAtDescr(fimg *FileImage, descr *Descriptor) error {
 // DeleteObject removes data from a SIF file referred to by id. The descriptor for the
 // data object is free'd and can be reused later. There's currently 2 clean mode specified
 // by flags: DelZero, to zero out the data region for security and DelCompact to
-// remove and shink the file compacting the unused area.
+// remove and shink the file compacting the unused area. With DelCompact, the data objects
+// following the deleted one are moved as described by Compact.
 func (fimg *FileImage) DeleteObject(id uint32, flags int) error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+
 	descr, index, err := fimg.GetFromDescrID(id)
 	if err != nil {
 		return err
 	}
 
-	switch flags {
-	case DelZero:
-		if err = zeroData(fimg, descr); err != nil {
-			return err
-		}
-	case DelCompact:
-		if objectIsLast(fimg, descr) {
-			if err = compactAtDescr(fimg, descr); err != nil {
+	// data is compacted before the descriptor is reset, so both must complete together
+	return fimg.guarded(func() error {
+		compact := false
+
+		switch flags {
+		case DelZero:
+			if err = zeroData(fimg, descr); err != nil {
 				return err
 			}
-		} else {
-			return fmt.Errorf("method (DelCompact) not implemented yet")
-		}
-	default:
-		if objectIsLast(fimg, descr) {
-			if err = compactAtDescr(fimg, descr); err != nil {
-				return err
+		case DelCompact:
+			compact = true
+		default:
+			if objectIsLast(fimg, descr) {
+				if err = compactAtDescr(fimg, descr); err != nil {
+					return err
+				}
 			}
 		}
-	}
 
-	// update some global header fields from deleting this descriptor
-	fimg.Header.Dfree++
-	fimg.Header.Mtime = time.Now().Unix()
+		// update some global header fields from deleting this descriptor
+		fimg.Header.Dfree++
+		fimg.Header.Mtime = fimg.now()
 
-	// zero out the unused descriptor
-	if err = resetDescriptor(fimg, index); err != nil {
-		return err
-	}
+		// zero out the unused descriptor
+		if err = resetDescriptor(fimg, index); err != nil {
+			return err
+		}
 
-	// update global header
-	if err = writeHeader(fimg); err != nil {
-		return err
-	}
+		// update global header
+		if err = writeHeader(fimg); err != nil {
+			return err
+		}
 
-	if err := fimg.Fp.Sync(); err != nil {
-		return fmt.Errorf("while sync'ing deleted data object to SIF file: %s", err)
-	}
+		if err := fimg.Fp.Sync(); err != nil {
+			return fmt.Errorf("while sync'ing deleted data object to SIF file: %s", err)
+		}
 
-	return nil
+		// reclaim the space of the object by moving the following objects down
+		if compact {
+			return fimg.compact()
+		}
+
+		return nil
+	})
 }
 
 // SetPartExtra serializes the partition and fs type info into a binary buffer.
@@ -437,7 +822,7 @@ func (di *DescriptorInput) SetPartExtra(fs Fstype, part Parttype, arch string) e
 		Fstype:   fs,
 		Parttype: part,
 	}
-	if arch == HdrArchUnknown {
+	if arch == HdrArchUnknown || arch == HdrArchMulti {
 		return fmt.Errorf("architecture not supported: %v", arch)
 	}
 	copy(extra.Arch[:], arch)
@@ -482,6 +867,19 @@ func (di *DescriptorInput) SetCryptoMsgExtra(format Formattype, message Messaget
 	return nil
 }
 
+// SetSBOMExtra serializes the SBOM format info into a binary buffer.
+func (di *DescriptorInput) SetSBOMExtra(format SBOMFormat) error {
+	extra := SBOM{
+		Format: format,
+	}
+
+	// serialize the SBOM data for integration with the base descriptor input
+	if err := binary.Write(&di.Extra, binary.LittleEndian, extra); err != nil {
+		return err
+	}
+	return nil
+}
+
 // SetName sets the byte array field "Name" to the value of string "name".
 func (d *Descriptor) SetName(name string) {
 	copy(d.Name[:], name)
@@ -498,15 +896,56 @@ func (d *Descriptor) SetExtra(extra []byte) {
 	}
 }
 
-// SetPrimPart sets the specified system partition to be the primary one.
+// setPartType sets the partition type of the partition described by d to ptype, preserving its
+// filesystem type and architecture.
+func (d *Descriptor) setPartType(ptype Parttype) error {
+	fs, err := d.GetFsType()
+	if err != nil {
+		return err
+	}
+
+	arch, err := d.GetArch()
+	if err != nil {
+		return err
+	}
+
+	extra := Partition{
+		Fstype:   fs,
+		Parttype: ptype,
+		Arch:     arch,
+	}
+
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, extra); err != nil {
+		return err
+	}
+	t, _ := d.trailer()
+	c, _ := d.checksum()
+	d.SetExtra(b.Bytes())
+	d.setChecksum(c)
+	d.setTrailer(t)
+	return nil
+}
+
+// SetPrimPart sets the system partition with the specified ID to be the primary one. The previous
+// primary system partition, if any, is demoted to a system partition, and the global header Arch
+// field is updated to the architecture of the new primary partition, unless it has been set
+// explicitly with SetArch. The partition must be of type PartSystem or PartPrimSys.
+//
+// In a multi-architecture image, only the previous primary system partition of the same
+// architecture is demoted.
 func (fimg *FileImage) SetPrimPart(id uint32) error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+
 	descr, _, err := fimg.GetFromDescrID(id)
 	if err != nil {
 		return err
 	}
 
 	if descr.Datatype != DataPartition {
-		return fmt.Errorf("not a volume partition")
+		return fmt.Errorf("%w: object %d is of type %v", errNotSystemPartition, id, descr.Datatype)
 	}
 
 	ptype, err := descr.GetPartType()
@@ -520,17 +959,7 @@ func (fimg *FileImage) SetPrimPart(id uint32) error {
 	}
 
 	if ptype != PartSystem {
-		return fmt.Errorf("partition must be of system type")
-	}
-
-	olddescr, _, err := fimg.GetPartPrimSys()
-	if err != nil && err != ErrNotFound {
-		return err
-	}
-
-	fs, err := descr.GetFsType()
-	if err != nil {
-		return nil
+		return fmt.Errorf("%w: partition %d is of type %v", errNotSystemPartition, id, ptype)
 	}
 
 	arch, err := descr.GetArch()
@@ -538,58 +967,44 @@ func (fimg *FileImage) SetPrimPart(id uint32) error {
 		return err
 	}
 
-	copy(fimg.Header.Arch[:], arch[:])
-	fimg.PrimPartID = descr.ID
-
-	extra := Partition{
-		Fstype:   fs,
-		Parttype: PartPrimSys,
+	var olddescr *Descriptor
+	if fimg.IsMultiArch() {
+		olddescr, _, err = fimg.GetPartPrimSysForArch(GetGoArch(trimZeroBytes(arch[:])))
+	} else {
+		olddescr, _, err = fimg.GetPartPrimSys()
 	}
-	copy(extra.Arch[:], arch[:])
-
-	var extrabuf bytes.Buffer
-	if err := binary.Write(&extrabuf, binary.LittleEndian, extra); err != nil {
+	if err != nil && !errors.Is(err, ErrNotFound) {
 		return err
 	}
-	descr.SetExtra(extrabuf.Bytes())
 
 	if olddescr != nil {
-		oldfs, err := olddescr.GetFsType()
-		if err != nil {
-			return nil
-		}
-		oldarch, err := olddescr.GetArch()
-		if err != nil {
-			return nil
-		}
-
-		oldextra := Partition{
-			Fstype:   oldfs,
-			Parttype: PartSystem,
-		}
-		copy(oldextra.Arch[:], oldarch[:])
-
-		var oldextrabuf bytes.Buffer
-		if err := binary.Write(&oldextrabuf, binary.LittleEndian, oldextra); err != nil {
+		if err := olddescr.setPartType(PartSystem); err != nil {
 			return err
 		}
-		olddescr.SetExtra(oldextrabuf.Bytes())
 	}
-
-	// write down the descriptor array
-	if err := writeDescriptors(fimg); err != nil {
+	if err := descr.setPartType(PartPrimSys); err != nil {
 		return err
 	}
 
-	fimg.Header.Mtime = time.Now().Unix()
-	// write down global header to file
-	if err := writeHeader(fimg); err != nil {
-		return err
-	}
+	fimg.deriveArch(arch)
+	fimg.setPrimPartID()
 
-	if err := fimg.Fp.Sync(); err != nil {
-		return fmt.Errorf("while sync'ing new data object to SIF file: %s", err)
-	}
+	return fimg.guarded(func() error {
+		// write down the descriptor array
+		if err := writeDescriptors(fimg); err != nil {
+			return err
+		}
 
-	return nil
+		fimg.Header.Mtime = fimg.now()
+		// write down global header to file
+		if err := writeHeader(fimg); err != nil {
+			return err
+		}
+
+		if err := fimg.Fp.Sync(); err != nil {
+			return fmt.Errorf("while sync'ing new data object to SIF file: %s", err)
+		}
+
+		return nil
+	})
 }
@@ -8,10 +8,14 @@ package sif
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -136,6 +140,421 @@ func TestCreateContainer(t *testing.T) {
 	}
 }
 
+func TestCreateContainerLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-layout-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name        string
+		count       int64
+		dataOffset  int64
+		stripeSize  int64
+		wantErr     error
+		wantCount   int64
+		wantDataOff int64
+	}{
+		{name: "Default", wantCount: DescrNumEntries, wantDataOff: DataStartOffset},
+		{name: "Tiny", count: 1, dataOffset: 4096 + descrLen, wantCount: 1, wantDataOff: 4096 + descrLen},
+		{name: "FewDescriptors", count: 4, wantCount: 4, wantDataOff: DataStartOffset},
+		{name: "ManyDescriptors", count: 1000, wantCount: 1000, wantDataOff: 589824},
+		{name: "CountNegative", count: -1, wantErr: errDescrCountInvalid},
+		{name: "CountTooLarge", count: DescrMaxEntries + 1, wantErr: errDescrCountInvalid},
+		{name: "DataOffsetOverlap", count: 2, dataOffset: 4096 + descrLen, wantErr: errDataOffsetInvalid},
+		{name: "StripeTooSmall", count: 1000, stripeSize: DataStartOffset, wantErr: errStripeSizeInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion2,
+				ID:         uuid.NewV4(),
+				StripeSize: tt.stripeSize,
+				DescrCount: tt.count,
+				DataOffset: tt.dataOffset,
+				InputDescr: []DescriptorInput{
+					{
+						Datatype:  DataGeneric,
+						Groupid:   DescrDefaultGroup,
+						Link:      DescrUnusedLink,
+						Size:      4,
+						Alignment: 1,
+						Fname:     "generic",
+						Data:      []byte("data"),
+					},
+				},
+			}
+
+			_, err := CreateContainer(cinfo)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			content, err := ioutil.ReadFile(cinfo.Pathname)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Load both memory mapped and buffered, as buffered mode must read the entire
+			// descriptor table.
+			mapped, err := LoadContainer(cinfo.Pathname, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mapped.UnloadContainer() // nolint:errcheck
+
+			buffered, err := LoadContainerFp(&mockSifReadWriter{buf: content, name: cinfo.Pathname}, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, fimg := range []*FileImage{&mapped, &buffered} {
+				if got, want := fimg.Header.Dtotal, tt.wantCount; got != want {
+					t.Errorf("got %v descriptors, want %v", got, want)
+				}
+				if got, want := int64(len(fimg.DescrArr)), tt.wantCount; got != want {
+					t.Errorf("got %v descriptors loaded, want %v", got, want)
+				}
+				if got, want := fimg.Header.Dataoff, tt.wantDataOff; got != want {
+					t.Errorf("got data offset %v, want %v", got, want)
+				}
+
+				d, _, err := fimg.GetFromDescrID(1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := d.Fileoff, tt.wantDataOff; got != want {
+					t.Errorf("got object offset %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateContainerAlignment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-align-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name      string
+		alignment int
+		wantAlign int64
+		wantErr   error
+	}{
+		{name: "Default", wantAlign: int64(os.Getpagesize())},
+		{name: "4KiB", alignment: 4 << 10, wantAlign: 4 << 10},
+		{name: "1MiB", alignment: 1 << 20, wantAlign: 1 << 20},
+		{name: "NotPowerOfTwo", alignment: 3000, wantErr: errAlignmentInvalid},
+		{name: "Negative", alignment: -4096, wantErr: errAlignmentInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				ID:         uuid.NewV4(),
+				InputDescr: []DescriptorInput{
+					{
+						Datatype: DataGeneric,
+						Groupid:  DescrDefaultGroup,
+						Link:     DescrUnusedLink,
+						Size:     3,
+						Fname:    "first",
+						Data:     []byte("one"),
+					},
+					{
+						Datatype:  DataGeneric,
+						Groupid:   DescrDefaultGroup,
+						Link:      DescrUnusedLink,
+						Size:      3,
+						Alignment: tt.alignment,
+						Fname:     "second",
+						Data:      []byte("two"),
+					},
+				},
+			}
+
+			_, err := CreateContainer(cinfo)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			d, _, err := fimg.GetFromDescrID(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Fileoff%tt.wantAlign != 0 {
+				t.Errorf("got offset %v, want alignment %v", d.Fileoff, tt.wantAlign)
+			}
+			if got, want := string(d.GetData(&fimg)), "two"; got != want {
+				t.Errorf("got data %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestCreateContainerMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-mode-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name       string
+		mode       os.FileMode
+		stripeSize int64
+		wantMode   os.FileMode
+	}{
+		{name: "Default", wantMode: DefaultFileMode},
+		{name: "Private", mode: 0600, wantMode: 0600},
+		{name: "PrivateStriped", mode: 0600, stripeSize: DataStartOffset, wantMode: 0600},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// The umask of the process applies, so compare against a file created with wantMode.
+			ref := filepath.Join(dir, tt.name+".ref")
+			f, err := os.OpenFile(ref, os.O_RDWR|os.O_CREATE|os.O_EXCL, tt.wantMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			fi, err := os.Stat(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := fi.Mode().Perm()
+
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion2,
+				ID:         uuid.NewV4(),
+				StripeSize: tt.stripeSize,
+				Mode:       tt.mode,
+				InputDescr: []DescriptorInput{
+					{
+						Datatype: DataGeneric,
+						Groupid:  DescrDefaultGroup,
+						Link:     DescrUnusedLink,
+						Size:     DataStartOffset,
+						Fname:    "data",
+						Data:     make([]byte, DataStartOffset),
+					},
+				},
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			names := []string{cinfo.Pathname}
+			if tt.stripeSize != 0 {
+				names = append(names, stripeName(cinfo.Pathname, 1))
+			}
+			for _, name := range names {
+				fi, err := os.Stat(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := fi.Mode().Perm(); got != want {
+					t.Errorf("%v: got mode %v, want %v", filepath.Base(name), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateContainerPlacement(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-placement-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := func(name string, p Placement) DescriptorInput {
+		return DescriptorInput{
+			Datatype:  DataGeneric,
+			Groupid:   DescrDefaultGroup,
+			Link:      DescrUnusedLink,
+			Size:      int64(len(name)),
+			Alignment: 1,
+			Placement: p,
+			Fname:     name,
+			Data:      []byte(name),
+		}
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			input("cold1", PlacementCold),
+			input("default1", PlacementDefault),
+			input("hot1", PlacementHot),
+			input("default2", PlacementDefault),
+			input("hot2", PlacementHot),
+			input("cold2", PlacementCold),
+		},
+	}
+
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	// Descriptors keep their input order.
+	for i, in := range cinfo.InputDescr {
+		d, _, err := fimg.GetFromDescrID(uint32(i + 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := d.GetName(), in.Fname; got != want {
+			t.Errorf("descriptor %v: got name %v, want %v", i+1, got, want)
+		}
+		if got, want := string(d.GetData(&fimg)), in.Fname; got != want {
+			t.Errorf("descriptor %v: got data %v, want %v", i+1, got, want)
+		}
+	}
+
+	// Data objects are placed hot, default, then cold, preserving input order within each.
+	wantOrder := []string{"hot1", "hot2", "default1", "default2", "cold1", "cold2"}
+
+	off := fimg.Header.Dataoff
+	for _, name := range wantOrder {
+		ds, _, err := fimg.GetFromDescr(Descriptor{Groupid: DescrDefaultGroup})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, d := range ds {
+			if d.GetName() == name {
+				found = true
+				if got, want := d.Fileoff, off; got != want {
+					t.Errorf("%v: got offset %v, want %v", name, got, want)
+				}
+				off += d.Filelen
+			}
+		}
+		if !found {
+			t.Fatalf("%v: object not found", name)
+		}
+	}
+}
+
+func TestCreateContainerReproducible(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-reproducible-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// create creates a reproducible image holding data, and returns its content.
+	create := func(name string, id uuid.UUID, data string) []byte {
+		cinfo := CreateInfo{
+			Pathname:   filepath.Join(dir, name),
+			Launchstr:  HdrLaunch,
+			Sifversion: HdrVersion,
+			ID:         id,
+			InputDescr: []DescriptorInput{
+				{
+					Datatype: DataDeffile,
+					Groupid:  DescrDefaultGroup,
+					Link:     DescrUnusedLink,
+					Size:     int64(len(data)),
+					Fname:    "deffile",
+					Fp:       bytes.NewReader([]byte(data)),
+				},
+			},
+			Reproducible: true,
+			Time:         ts,
+		}
+		if _, err := CreateContainer(cinfo); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(cinfo.Pathname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// header returns the global header of the image content b.
+	header := func(b []byte) Header {
+		fimg, err := LoadContainerReaderAt(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		d := fimg.DescrArr[0]
+		if d.Ctime != ts.Unix() || d.Mtime != ts.Unix() || d.UID != 0 || d.Gid != 0 {
+			t.Errorf("got descriptor times %v/%v owner %v/%v", d.Ctime, d.Mtime, d.UID, d.Gid)
+		}
+		return fimg.Header
+	}
+
+	a := create("a.sif", uuid.Nil, "bootstrap: busybox")
+	b := create("b.sif", uuid.Nil, "bootstrap: busybox")
+	c := create("c.sif", uuid.Nil, "bootstrap: docker")
+
+	if !bytes.Equal(a, b) {
+		t.Error("images created from the same inputs differ")
+	}
+
+	ha, hc := header(a), header(c)
+	if got, want := ha.Ctime, ts.Unix(); got != want {
+		t.Errorf("got ctime %v, want %v", got, want)
+	}
+	if uuid.Equal(ha.ID, uuid.Nil) {
+		t.Error("got nil image ID")
+	}
+	if uuid.Equal(ha.ID, hc.ID) {
+		t.Error("images with different content have the same ID")
+	}
+
+	id := uuid.NewV4()
+	if got := header(create("d.sif", id, "bootstrap: busybox")).ID; !uuid.Equal(got, id) {
+		t.Errorf("got ID %v, want %v", got, id)
+	}
+}
+
 func TestAddDelObject(t *testing.T) {
 	// data we need to create a dummy labels descriptor
 	labinput := DescriptorInput{
@@ -288,6 +707,123 @@ func TestAddObjectPipe(t *testing.T) {
 	}
 }
 
+func TestAddObjectFromReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-add-reader-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	payload := bytes.Repeat([]byte("0123456789"), 1024)
+
+	errRead := errors.New("read error")
+
+	tests := []struct {
+		name    string
+		r       io.Reader
+		size    int64
+		wantErr bool
+		wantLen int64
+	}{
+		{name: "NilReader", wantErr: true},
+		{name: "Sized", r: bytes.NewReader(payload), size: int64(len(payload)), wantLen: int64(len(payload))},
+		{name: "Unsized", r: bytes.NewReader(payload), wantLen: int64(len(payload))},
+		{name: "Short", r: bytes.NewReader(payload), size: int64(len(payload)) + 1, wantErr: true},
+		{name: "Long", r: bytes.NewReader(payload), size: int64(len(payload)) - 1, wantErr: true},
+		{
+			name:    "ReadError",
+			r:       io.MultiReader(bytes.NewReader(payload), iotestErrReader{errRead}),
+			size:    2 * int64(len(payload)),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				ID:         uuid.NewV4(),
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			h := fimg.Header
+
+			err = fimg.AddObjectFromReader(tt.r, DescriptorInput{
+				Datatype: DataGeneric,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     tt.size,
+				Fname:    "generic",
+				Data:     []byte("ignored"),
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				// The image must be left unchanged, and usable.
+				if fimg.Header != h {
+					t.Errorf("got header %+v, want %+v", fimg.Header, h)
+				}
+				for _, d := range fimg.DescrArr {
+					if d.Used {
+						t.Errorf("unexpected descriptor %d in use", d.ID)
+					}
+				}
+
+				err := fimg.AddObjectFromReader(bytes.NewReader(payload), DescriptorInput{
+					Datatype: DataGeneric,
+					Groupid:  DescrDefaultGroup,
+					Link:     DescrUnusedLink,
+					Size:     int64(len(payload)),
+					Fname:    "generic",
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err = LoadContainer(cinfo.Pathname, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d, _, err := fimg.GetFromDescrID(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := d.GetData(&fimg), payload; !bytes.Equal(got, want) {
+				t.Errorf("got %d bytes of data, want %d", len(got), len(want))
+			}
+			if tt.wantLen != 0 {
+				if got, want := d.Filelen, tt.wantLen; got != want {
+					t.Errorf("got length %d, want %d", got, want)
+				}
+			}
+		})
+	}
+}
+
+// iotestErrReader returns err from every call to Read.
+type iotestErrReader struct{ err error }
+
+func (r iotestErrReader) Read(p []byte) (int, error) { return 0, r.err }
+
 func TestSetPrimPart(t *testing.T) {
 	// the code treats a DescriptorInput with a non-nil Fp field and
 	// a Size == 0 field as a "pipe"
@@ -355,6 +891,109 @@ func TestSetPrimPart(t *testing.T) {
 	}
 }
 
+func TestSetPrimPartMultiArch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-setprim-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	part := func(t *testing.T, pt Parttype, arch string) DescriptorInput {
+		di := DescriptorInput{
+			Datatype: DataPartition,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     4,
+			Fname:    "part",
+			Data:     []byte("part"),
+		}
+		if err := di.SetPartExtra(FsSquash, pt, arch); err != nil {
+			t.Fatal(err)
+		}
+		return di
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			part(t, PartPrimSys, HdrArchAMD64),
+			part(t, PartSystem, HdrArchARM64),
+			part(t, PartData, HdrArchARM64),
+			{
+				Datatype: DataGeneric,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     4,
+				Fname:    "generic",
+				Data:     []byte("data"),
+			},
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		id      uint32
+		wantErr error
+	}{
+		{"NotFound", 5, ErrNotFound},
+		{"Generic", 4, errNotSystemPartition},
+		{"DataPartition", 3, errNotSystemPartition},
+		{"AlreadyPrimary", 1, nil},
+		{"System", 2, nil},
+	}
+
+	for _, tt := range tests {
+		if err := fimg.SetPrimPart(tt.id); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%v: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload the image, to check the change of primary partition is persisted.
+	fimg, err = LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	if got, want := fimg.PrimPartID, uint32(2); got != want {
+		t.Errorf("got primary partition %v, want %v", got, want)
+	}
+	if got, want := fimg.Header.GetArch(), HdrArchARM64; got != want {
+		t.Errorf("got arch %q, want %q", got, want)
+	}
+
+	wantTypes := map[uint32]Parttype{1: PartSystem, 2: PartPrimSys, 3: PartData}
+	for id, want := range wantTypes {
+		d, _, err := fimg.GetFromDescrID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := d.GetPartType(); err != nil {
+			t.Error(err)
+		} else if got != want {
+			t.Errorf("partition %v: got type %v, want %v", id, got, want)
+		}
+		if fs, err := d.GetFsType(); err != nil || fs != FsSquash {
+			t.Errorf("partition %v: got filesystem %v (%v), want %v", id, fs, err, FsSquash)
+		}
+	}
+}
+
 // cpFile is a simple function to copy the test container to a file.
 func cpFile(fromFile, toFile string) error {
 	s, err := os.Open(fromFile)
@@ -0,0 +1,91 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AllDatatypes returns the datatypes known to this implementation, in ascending order.
+func AllDatatypes() []Datatype {
+	return []Datatype{
+		DataDeffile,
+		DataEnvVar,
+		DataLabels,
+		DataPartition,
+		DataSignature,
+		DataGenericJSON,
+		DataGeneric,
+		DataCryptoMessage,
+		DataSBOM,
+		DataOCIBlob,
+		DataBuildLog,
+		DataBundle,
+		DataHealthCheck,
+		DataOCIConfig,
+		DataPlaceholder,
+		DataSecrets,
+		DataProvenance,
+	}
+}
+
+// AllFstypes returns the file system types known to this implementation, in ascending order.
+func AllFstypes() []Fstype {
+	return []Fstype{
+		FsSquash,
+		FsExt3,
+		FsImmuObj,
+		FsRaw,
+		FsEncryptedSquashfs,
+	}
+}
+
+// AllParttypes returns the partition types known to this implementation, in ascending order.
+func AllParttypes() []Parttype {
+	return []Parttype{
+		PartSystem,
+		PartPrimSys,
+		PartData,
+		PartOverlay,
+	}
+}
+
+// ParseDatatype returns the datatype whose string representation, as returned by its String
+// method, is s. The comparison is case-insensitive. If s does not name a known datatype, an error
+// wrapping ErrUnknownType is returned.
+func ParseDatatype(s string) (Datatype, error) {
+	for _, t := range AllDatatypes() {
+		if strings.EqualFold(s, t.String()) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: datatype %q", ErrUnknownType, s)
+}
+
+// ParseFstype returns the file system type whose string representation, as returned by its String
+// method, is s. The comparison is case-insensitive. If s does not name a known file system type,
+// an error wrapping ErrUnknownType is returned.
+func ParseFstype(s string) (Fstype, error) {
+	for _, t := range AllFstypes() {
+		if strings.EqualFold(s, t.String()) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: fstype %q", ErrUnknownType, s)
+}
+
+// ParseParttype returns the partition type whose string representation, as returned by its String
+// method, is s. The comparison is case-insensitive. If s does not name a known partition type, an
+// error wrapping ErrUnknownType is returned.
+func ParseParttype(s string) (Parttype, error) {
+	for _, t := range AllParttypes() {
+		if strings.EqualFold(s, t.String()) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: parttype %q", ErrUnknownType, s)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestDatatypeValues pins the numeric value of each datatype, as recorded in images. Values
+// 0x4001 through 0x400b are shared with other SIF implementations.
+func TestDatatypeValues(t *testing.T) {
+	tests := []struct {
+		dt   Datatype
+		want int32
+	}{
+		{DataDeffile, 0x4001},
+		{DataEnvVar, 0x4002},
+		{DataLabels, 0x4003},
+		{DataPartition, 0x4004},
+		{DataSignature, 0x4005},
+		{DataGenericJSON, 0x4006},
+		{DataGeneric, 0x4007},
+		{DataCryptoMessage, 0x4008},
+		{DataSBOM, 0x4009},
+		{DataOCIBlob, 0x400b},
+		{DataBuildLog, 0x4101},
+		{DataBundle, 0x4102},
+		{DataHealthCheck, 0x4103},
+		{DataOCIConfig, 0x4104},
+		{DataPlaceholder, 0x4105},
+		{DataSecrets, 0x4106},
+		{DataProvenance, 0x4107},
+	}
+
+	if got, want := len(AllDatatypes()), len(tests); got != want {
+		t.Errorf("got %v datatypes, want %v", got, want)
+	}
+
+	for _, tt := range tests {
+		if got := int32(tt.dt); got != tt.want {
+			t.Errorf("%v: got value %#x, want %#x", tt.dt, got, tt.want)
+		}
+	}
+
+	all := AllDatatypes()
+	for i := 1; i < len(all); i++ {
+		if all[i] <= all[i-1] {
+			t.Errorf("datatypes not in ascending order: %v follows %v", all[i], all[i-1])
+		}
+	}
+}
+
+func TestParseDatatype(t *testing.T) {
+	for _, want := range AllDatatypes() {
+		got, err := ParseDatatype(want.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got datatype %v, want %v", got, want)
+		}
+	}
+
+	if got, err := ParseDatatype("json.generic"); err != nil || got != DataGenericJSON {
+		t.Errorf("got datatype %v (%v), want %v", got, err, DataGenericJSON)
+	}
+
+	for _, s := range []string{"", "Unknown", "JSON"} {
+		if _, err := ParseDatatype(s); !errors.Is(err, ErrUnknownType) {
+			t.Errorf("%q: got error %v, want %v", s, err, ErrUnknownType)
+		}
+	}
+}
+
+func TestParseFstype(t *testing.T) {
+	for _, want := range AllFstypes() {
+		got, err := ParseFstype(want.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got fstype %v, want %v", got, want)
+		}
+	}
+
+	for _, s := range []string{"", "Unknown fs-type", "ext4"} {
+		if _, err := ParseFstype(s); !errors.Is(err, ErrUnknownType) {
+			t.Errorf("%q: got error %v, want %v", s, err, ErrUnknownType)
+		}
+	}
+}
+
+func TestParseParttype(t *testing.T) {
+	for _, want := range AllParttypes() {
+		got, err := ParseParttype(want.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got parttype %v, want %v", got, want)
+		}
+	}
+
+	for _, s := range []string{"", "Unknown part-type", "Primary"} {
+		if _, err := ParseParttype(s); !errors.Is(err, ErrUnknownType) {
+			t.Errorf("%q: got error %v, want %v", s, err, ErrUnknownType)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// testFingerprint is the fingerprint of the signing key recorded in test signatures.
+const testFingerprint = "F69C21F759C8EA06FD32CCF4536523CE1E109AF3"
+
+// testPartInput returns input for a squashfs primary system partition in group 1.
+func testPartInput(t *testing.T) DescriptorInput {
+	t.Helper()
+
+	di := DescriptorInput{
+		Datatype: DataPartition,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     8,
+		Fname:    "rootfs",
+		Data:     []byte("squashfs"),
+	}
+	if err := di.SetPartExtra(FsSquash, PartPrimSys, HdrArchAMD64); err != nil {
+		t.Fatal(err)
+	}
+	return di
+}
+
+// testDeffileInput returns input for a definition file in group 1, linked to link.
+func testDeffileInput(link uint32) DescriptorInput {
+	return DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     link,
+		Size:     4,
+		Fname:    "deffile",
+		Data:     []byte("data"),
+	}
+}
+
+// testSigInput returns input for a signature holding data, linked to link, which may be an object
+// or a group.
+func testSigInput(t *testing.T, link uint32, data string) DescriptorInput {
+	t.Helper()
+
+	di := DescriptorInput{
+		Datatype: DataSignature,
+		Groupid:  DescrUnusedGroup,
+		Link:     link,
+		Size:     int64(len(data)),
+		Data:     []byte(data),
+	}
+	if err := di.SetSignExtra(HashSHA256, testFingerprint); err != nil {
+		t.Fatal(err)
+	}
+	return di
+}
+
+// createTestImage creates an image at path holding objects described by inputs, and returns path.
+func createTestImage(t *testing.T, path string, inputs ...DescriptorInput) string {
+	t.Helper()
+
+	cinfo := CreateInfo{
+		Pathname:   path,
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: inputs,
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -30,6 +30,24 @@ func (d Datatype) String() string {
 		return "Generic/Raw"
 	case DataCryptoMessage:
 		return "Cryptographic Message"
+	case DataBuildLog:
+		return "Build.Log"
+	case DataBundle:
+		return "Bundle"
+	case DataHealthCheck:
+		return "Health.Check"
+	case DataSBOM:
+		return "SBOM"
+	case DataOCIConfig:
+		return "OCI.Config"
+	case DataOCIBlob:
+		return "OCI.Blob"
+	case DataPlaceholder:
+		return "Placeholder"
+	case DataSecrets:
+		return "Secrets"
+	case DataProvenance:
+		return "Provenance"
 	}
 	return "Unknown"
 }
@@ -63,19 +81,19 @@ func readableSize(size uint64) string {
 
 // FmtHeader formats the output of a SIF file global header.
 func (fimg *FileImage) FmtHeader() string {
-	s := fmt.Sprintln("Launch:  ", trimZeroBytes(fimg.Header.Launch[:]))
-	s += fmt.Sprintln("Magic:   ", trimZeroBytes(fimg.Header.Magic[:]))
-	s += fmt.Sprintln("Version: ", trimZeroBytes(fimg.Header.Version[:]))
-	s += fmt.Sprintln("Arch:    ", GetGoArch(trimZeroBytes(fimg.Header.Arch[:])))
-	s += fmt.Sprintln("ID:      ", fimg.Header.ID)
-	s += fmt.Sprintln("Ctime:   ", time.Unix(fimg.Header.Ctime, 0).UTC())
-	s += fmt.Sprintln("Mtime:   ", time.Unix(fimg.Header.Mtime, 0).UTC())
-	s += fmt.Sprintln("Dfree:   ", fimg.Header.Dfree)
-	s += fmt.Sprintln("Dtotal:  ", fimg.Header.Dtotal)
-	s += fmt.Sprintln("Descoff: ", fimg.Header.Descroff)
-	s += fmt.Sprintln("Descrlen:", readableSize(uint64(fimg.Header.Descrlen)))
-	s += fmt.Sprintln("Dataoff: ", fimg.Header.Dataoff)
-	s += fmt.Sprintln("Datalen: ", readableSize(uint64(fimg.Header.Datalen)))
+	s := fmt.Sprintln(label("Launch:", 9), trimZeroBytes(fimg.Header.Launch[:]))
+	s += fmt.Sprintln(label("Magic:", 9), trimZeroBytes(fimg.Header.Magic[:]))
+	s += fmt.Sprintln(label("Version:", 9), trimZeroBytes(fimg.Header.Version[:]))
+	s += fmt.Sprintln(label("Arch:", 9), GetGoArch(trimZeroBytes(fimg.Header.Arch[:])))
+	s += fmt.Sprintln(label("ID:", 9), fimg.Header.ID)
+	s += fmt.Sprintln(label("Ctime:", 9), time.Unix(fimg.Header.Ctime, 0).UTC())
+	s += fmt.Sprintln(label("Mtime:", 9), time.Unix(fimg.Header.Mtime, 0).UTC())
+	s += fmt.Sprintln(label("Dfree:", 9), fimg.Header.Dfree)
+	s += fmt.Sprintln(label("Dtotal:", 9), fimg.Header.Dtotal)
+	s += fmt.Sprintln(label("Descoff:", 9), fimg.Header.Descroff)
+	s += fmt.Sprintln(label("Descrlen:", 9), readableSize(uint64(fimg.Header.Descrlen)))
+	s += fmt.Sprintln(label("Dataoff:", 9), fimg.Header.Dataoff)
+	s += fmt.Sprintln(label("Datalen:", 9), readableSize(uint64(fimg.Header.Datalen)))
 
 	return s
 }
@@ -97,6 +115,11 @@ func fstypeStr(ftype Fstype) string {
 	return "Unknown fs-type"
 }
 
+// String returns a string representation of the file system type.
+func (t Fstype) String() string {
+	return fstypeStr(t)
+}
+
 // parttypeStr returns a string representation of a partition type.
 func parttypeStr(ptype Parttype) string {
 	switch ptype {
@@ -112,6 +135,11 @@ func parttypeStr(ptype Parttype) string {
 	return "Unknown part-type"
 }
 
+// String returns a string representation of the partition type.
+func (t Parttype) String() string {
+	return parttypeStr(t)
+}
+
 // hashtypeStr returns a string representation of a  hash type.
 func hashtypeStr(htype Hashtype) string {
 	switch htype {
@@ -125,6 +153,8 @@ func hashtypeStr(htype Hashtype) string {
 		return "BLAKE2S"
 	case HashBLAKE2B:
 		return "BLAKE2B"
+	case HashBLAKE3:
+		return "BLAKE3"
 	}
 	return "Unknown hash-type"
 }
@@ -136,6 +166,10 @@ func formattypeStr(ftype Formattype) string {
 		return "OpenPGP"
 	case FormatPEM:
 		return "PEM"
+	case FormatJWS:
+		return "JWS"
+	case FormatSigEnvelope:
+		return "Signature Envelope"
 	}
 	return "Unknown format-type"
 }
@@ -147,13 +181,69 @@ func messagetypeStr(mtype Messagetype) string {
 		return "Clear Signature"
 	case MessageRSAOAEP:
 		return "RSA-OAEP"
+	case MessageNotationSignature:
+		return "Notation Signature"
+	case MessagePQSignature:
+		return "Post-Quantum Signature"
 	}
 	return "Unknown message-type"
 }
 
+// sbomformatStr returns a string representation of an SBOM format.
+func sbomformatStr(f SBOMFormat) string {
+	switch f {
+	case SBOMFormatCycloneDXJSON:
+		return "CycloneDX-JSON"
+	case SBOMFormatCycloneDXXML:
+		return "CycloneDX-XML"
+	case SBOMFormatSPDXJSON:
+		return "SPDX-JSON"
+	case SBOMFormatSPDXTagValue:
+		return "SPDX-TagValue"
+	}
+	return "Unknown sbom-format"
+}
+
+// String returns a string representation of the SBOM format.
+func (f SBOMFormat) String() string {
+	return sbomformatStr(f)
+}
+
+// compressionStr returns a string representation of a compression method.
+func compressionStr(c Compression) string {
+	switch c {
+	case CompressionNone:
+		return "None"
+	case CompressionGzip:
+		return "Gzip"
+	}
+	return "Unknown compression"
+}
+
+// String returns a string representation of the compression method.
+func (c Compression) String() string {
+	return compressionStr(c)
+}
+
+// secretscipherStr returns a string representation of a secrets cipher.
+func secretscipherStr(c SecretsCipher) string {
+	switch c {
+	case SecretsAES256GCM:
+		return "AES-256-GCM"
+	}
+	return "Unknown secrets-cipher"
+}
+
+// String returns a string representation of the secrets cipher.
+func (c SecretsCipher) String() string {
+	return secretscipherStr(c)
+}
+
 // FmtDescrList formats the output of a list of all active descriptors from a SIF file.
 func (fimg *FileImage) FmtDescrList() string {
-	s := fmt.Sprintf("%-4s %-8s %-8s %-26s %s\n", "ID", "|GROUP", "|LINK", "|SIF POSITION (start-end)", "|TYPE")
+	s := fmt.Sprintf("%-4s %-8s %-8s %-26s %s\n",
+		Message("ID"), "|"+Message("GROUP"), "|"+Message("LINK"),
+		"|"+Message("SIF POSITION (start-end)"), "|"+Message("TYPE"))
 	s += fmt.Sprintln("------------------------------------------------------------------------------")
 
 	for _, v := range fimg.DescrArr {
@@ -162,12 +252,12 @@ func (fimg *FileImage) FmtDescrList() string {
 		} else {
 			s += fmt.Sprintf("%-4d ", v.ID)
 			if v.Groupid == DescrUnusedGroup {
-				s += fmt.Sprintf("|%-7s ", "NONE")
+				s += fmt.Sprintf("|%-7s ", Message("NONE"))
 			} else {
 				s += fmt.Sprintf("|%-7d ", v.Groupid&^DescrGroupMask)
 			}
 			if v.Link == DescrUnusedLink {
-				s += fmt.Sprintf("|%-7s ", "NONE")
+				s += fmt.Sprintf("|%-7s ", Message("NONE"))
 			} else {
 				if v.Link&DescrGroupMask == DescrGroupMask {
 					s += fmt.Sprintf("|%-3d (G) ", v.Link&^DescrGroupMask)
@@ -184,16 +274,28 @@ func (fimg *FileImage) FmtDescrList() string {
 				f, _ := v.GetFsType()
 				p, _ := v.GetPartType()
 				a, _ := v.GetArch()
-				s += fmt.Sprintf("|%s (%s/%s/%s)\n", v.Datatype, fstypeStr(f), parttypeStr(p), GetGoArch(trimZeroBytes(a[:])))
+				s += fmt.Sprintf("|%s (%s/%s/%s)\n", Message(v.Datatype.String()), Message(fstypeStr(f)), Message(parttypeStr(p)), GetGoArch(trimZeroBytes(a[:])))
 			case DataSignature:
 				h, _ := v.GetHashType()
-				s += fmt.Sprintf("|%s (%s)\n", v.Datatype, hashtypeStr(h))
+				s += fmt.Sprintf("|%s (%s)\n", Message(v.Datatype.String()), Message(hashtypeStr(h)))
 			case DataCryptoMessage:
 				f, _ := v.GetFormatType()
 				m, _ := v.GetMessageType()
-				s += fmt.Sprintf("|%s (%s/%s)\n", v.Datatype, formattypeStr(f), messagetypeStr(m))
+				s += fmt.Sprintf("|%s (%s/%s)\n", Message(v.Datatype.String()), Message(formattypeStr(f)), Message(messagetypeStr(m)))
+			case DataSBOM:
+				f, _ := v.GetSBOMFormat()
+				s += fmt.Sprintf("|%s (%s)\n", Message(v.Datatype.String()), Message(sbomformatStr(f)))
+			case DataOCIConfig, DataOCIBlob:
+				m, _ := v.GetOCIMediaType()
+				s += fmt.Sprintf("|%s (%s)\n", Message(v.Datatype.String()), m)
+			case DataPlaceholder:
+				t, _ := v.GetPlaceholderType()
+				s += fmt.Sprintf("|%s (%s)\n", Message(v.Datatype.String()), Message(t.String()))
+			case DataSecrets:
+				c, _ := v.GetSecretsCipher()
+				s += fmt.Sprintf("|%s (%s)\n", Message(v.Datatype.String()), Message(secretscipherStr(c)))
 			default:
-				s += fmt.Sprintf("|%s\n", v.Datatype)
+				s += fmt.Sprintf("|%s\n", Message(v.Datatype.String()))
 			}
 		}
 	}
@@ -209,49 +311,71 @@ func (fimg *FileImage) FmtDescrInfo(id uint32) string {
 		if !v.Used {
 			continue
 		} else if v.ID == id {
-			s = fmt.Sprintln("Descr slot#:", i)
-			s += fmt.Sprintln("  Datatype: ", v.Datatype)
-			s += fmt.Sprintln("  ID:       ", v.ID)
-			s += fmt.Sprintln("  Used:     ", v.Used)
+			s = fmt.Sprintln(Message("Descr slot#:"), i)
+			s += fmt.Sprintln("  "+label("Datatype:", 10), Message(v.Datatype.String()))
+			s += fmt.Sprintln("  "+label("ID:", 10), v.ID)
+			s += fmt.Sprintln("  "+label("Used:", 10), v.Used)
 			if v.Groupid == DescrUnusedGroup {
-				s += fmt.Sprintln("  Groupid:  ", "NONE")
+				s += fmt.Sprintln("  "+label("Groupid:", 10), Message("NONE"))
 			} else {
-				s += fmt.Sprintln("  Groupid:  ", v.Groupid&^DescrGroupMask)
+				s += fmt.Sprintln("  "+label("Groupid:", 10), v.Groupid&^DescrGroupMask)
 			}
 			if v.Link == DescrUnusedLink {
-				s += fmt.Sprintln("  Link:     ", "NONE")
+				s += fmt.Sprintln("  "+label("Link:", 10), Message("NONE"))
 			} else {
 				if v.Link&DescrGroupMask == DescrGroupMask {
-					s += fmt.Sprintln("  Link:     ", v.Link&^DescrGroupMask, "(G)")
+					s += fmt.Sprintln("  "+label("Link:", 10), v.Link&^DescrGroupMask, "(G)")
 				} else {
-					s += fmt.Sprintln("  Link:     ", v.Link)
+					s += fmt.Sprintln("  "+label("Link:", 10), v.Link)
 				}
 			}
-			s += fmt.Sprintln("  Fileoff:  ", v.Fileoff)
-			s += fmt.Sprintln("  Filelen:  ", v.Filelen)
-			s += fmt.Sprintln("  Ctime:    ", time.Unix(v.Ctime, 0).UTC())
-			s += fmt.Sprintln("  Mtime:    ", time.Unix(v.Mtime, 0).UTC())
-			s += fmt.Sprintln("  UID:      ", v.UID)
-			s += fmt.Sprintln("  Gid:      ", v.Gid)
-			s += fmt.Sprintln("  Name:     ", trimZeroBytes(v.Name[:]))
+			s += fmt.Sprintln("  "+label("Fileoff:", 10), v.Fileoff)
+			s += fmt.Sprintln("  "+label("Filelen:", 10), v.Filelen)
+			if c := v.GetCompression(); c != CompressionNone {
+				s += fmt.Sprintln("  "+label("Compress:", 10), Message(compressionStr(c)))
+				s += fmt.Sprintln("  "+label("Size:", 10), v.GetSize())
+			}
+			s += fmt.Sprintln("  "+label("Ctime:", 10), time.Unix(v.Ctime, 0).UTC())
+			s += fmt.Sprintln("  "+label("Mtime:", 10), time.Unix(v.Mtime, 0).UTC())
+			s += fmt.Sprintln("  "+label("UID:", 10), v.UID)
+			s += fmt.Sprintln("  "+label("Gid:", 10), v.Gid)
+			s += fmt.Sprintln("  "+label("Name:", 10), trimZeroBytes(v.Name[:]))
 			switch v.Datatype {
 			case DataPartition:
 				f, _ := v.GetFsType()
 				p, _ := v.GetPartType()
 				a, _ := v.GetArch()
-				s += fmt.Sprintln("  Fstype:   ", fstypeStr(f))
-				s += fmt.Sprintln("  Parttype: ", parttypeStr(p))
-				s += fmt.Sprintln("  Arch:     ", GetGoArch(trimZeroBytes(a[:])))
+				s += fmt.Sprintln("  "+label("Fstype:", 10), Message(fstypeStr(f)))
+				s += fmt.Sprintln("  "+label("Parttype:", 10), Message(parttypeStr(p)))
+				s += fmt.Sprintln("  "+label("Arch:", 10), GetGoArch(trimZeroBytes(a[:])))
 			case DataSignature:
 				h, _ := v.GetHashType()
 				e, _ := v.GetEntityString()
-				s += fmt.Sprintln("  Hashtype: ", hashtypeStr(h))
-				s += fmt.Sprintln("  Entity:   ", e)
+				s += fmt.Sprintln("  "+label("Hashtype:", 10), Message(hashtypeStr(h)))
+				s += fmt.Sprintln("  "+label("Entity:", 10), e)
 			case DataCryptoMessage:
 				f, _ := v.GetFormatType()
 				m, _ := v.GetMessageType()
-				s += fmt.Sprintln("  Fmttype:  ", formattypeStr(f))
-				s += fmt.Sprintln("  Msgtype:  ", messagetypeStr(m))
+				s += fmt.Sprintln("  "+label("Fmttype:", 10), Message(formattypeStr(f)))
+				s += fmt.Sprintln("  "+label("Msgtype:", 10), Message(messagetypeStr(m)))
+			case DataSBOM:
+				f, _ := v.GetSBOMFormat()
+				s += fmt.Sprintln("  "+label("Format:", 10), Message(sbomformatStr(f)))
+			case DataOCIConfig, DataOCIBlob:
+				m, _ := v.GetOCIMediaType()
+				d, _ := v.GetOCIDigest()
+				s += fmt.Sprintln("  "+label("Mediatype:", 10), m)
+				s += fmt.Sprintln("  "+label("Digest:", 10), d)
+			case DataPlaceholder:
+				t, _ := v.GetPlaceholderType()
+				d, _ := v.GetPlaceholderDigest()
+				s += fmt.Sprintln("  "+label("Bindtype:", 10), Message(t.String()))
+				if d != "" {
+					s += fmt.Sprintln("  "+label("Approved:", 10), d)
+				}
+			case DataSecrets:
+				c, _ := v.GetSecretsCipher()
+				s += fmt.Sprintln("  "+label("Cipher:", 10), Message(secretscipherStr(c)))
 			}
 
 			return s
@@ -0,0 +1,96 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrNoFsInfo is the code for when the file system of a partition does not record the requested
+// information. Squashfs, for example, records neither a UUID nor a label.
+var ErrNoFsInfo = errors.New("file system does not record requested information")
+
+// Layout of the ext2/3/4 superblock, relative to the start of the file system.
+const (
+	extSuperblockOffset = 1024
+	extMagicOffset      = 56
+	extUUIDOffset       = 104
+	extLabelOffset      = 120
+	extLabelLen         = 16
+	extMagic            = 0xef53
+)
+
+// extFsInfo holds the identifying fields of an ext2/3/4 superblock.
+type extFsInfo struct {
+	uuid  uuid.UUID
+	label string
+}
+
+// readExtFsInfo reads the identifying fields of the ext superblock of the partition described by
+// d.
+func (d *Descriptor) readExtFsInfo(fimg *FileImage) (extFsInfo, error) {
+	var r io.ReaderAt = fimg.Reader
+	if fimg.Amodebuf {
+		r = fimg.Fp
+	}
+
+	b := make([]byte, extLabelOffset+extLabelLen)
+	sr := io.NewSectionReader(r, d.Fileoff, d.Filelen)
+	if _, err := sr.ReadAt(b, extSuperblockOffset); err != nil {
+		return extFsInfo{}, fmt.Errorf("while reading ext superblock: %s", err)
+	}
+
+	if m := binary.LittleEndian.Uint16(b[extMagicOffset:]); m != extMagic {
+		return extFsInfo{}, fmt.Errorf("invalid ext superblock magic %#x", m)
+	}
+
+	var info extFsInfo
+	copy(info.uuid[:], b[extUUIDOffset:])
+	info.label = string(bytes.TrimRight(b[extLabelOffset:extLabelOffset+extLabelLen], "\x00"))
+	return info, nil
+}
+
+// fsInfo returns the identifying fields of the file system held in the partition described by d.
+func (d *Descriptor) fsInfo(fimg *FileImage) (extFsInfo, error) {
+	fs, err := d.GetFsType()
+	if err != nil {
+		return extFsInfo{}, err
+	}
+
+	switch fs {
+	case FsExt3:
+		return d.readExtFsInfo(fimg)
+	default:
+		return extFsInfo{}, ErrNoFsInfo
+	}
+}
+
+// GetFsUUID returns the UUID recorded by the file system held in the partition described by d.
+// If the file system does not record a UUID, ErrNoFsInfo is returned.
+func (d *Descriptor) GetFsUUID(fimg *FileImage) (uuid.UUID, error) {
+	info, err := d.fsInfo(fimg)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return info.uuid, nil
+}
+
+// GetFsLabel returns the volume label recorded by the file system held in the partition described
+// by d. If the file system does not record a label, ErrNoFsInfo is returned. A file system that
+// supports labels but has none returns an empty label.
+func (d *Descriptor) GetFsLabel(fimg *FileImage) (string, error) {
+	info, err := d.fsInfo(fimg)
+	if err != nil {
+		return "", err
+	}
+	return info.label, nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestDescriptor_GetFsInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-fsinfo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fsID := uuid.FromStringOrNil("8c5f3b0e-7a0e-4a0c-9bde-3f0e9b0f6e1d")
+
+	// a minimal ext3 file system, holding only the identifying fields of the superblock
+	ext := make([]byte, 2*extSuperblockOffset)
+	binary.LittleEndian.PutUint16(ext[extSuperblockOffset+extMagicOffset:], extMagic)
+	copy(ext[extSuperblockOffset+extUUIDOffset:], fsID[:])
+	copy(ext[extSuperblockOffset+extLabelOffset:], "rootfs")
+
+	badExt := make([]byte, 2*extSuperblockOffset)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "fsinfo.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+	}
+
+	parts := []struct {
+		fs    Fstype
+		ptype Parttype
+		data  []byte
+	}{
+		{FsExt3, PartPrimSys, ext},
+		{FsSquash, PartData, []byte("hsqs")},
+		{FsExt3, PartData, badExt},
+	}
+	for _, p := range parts {
+		di := DescriptorInput{
+			Datatype: DataPartition,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Fname:    "part",
+			Data:     p.data,
+			Size:     int64(len(p.data)),
+		}
+		if err := di.SetPartExtra(p.fs, p.ptype, GetSIFArch(runtime.GOARCH)); err != nil {
+			t.Fatal(err)
+		}
+		cinfo.InputDescr = append(cinfo.InputDescr, di)
+	}
+	cinfo.InputDescr = append(cinfo.InputDescr, DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "generic",
+		Data:     []byte{0},
+		Size:     1,
+	})
+
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	tests := []struct {
+		name      string
+		id        uint32
+		wantErr   bool
+		wantIs    error
+		wantUUID  uuid.UUID
+		wantLabel string
+	}{
+		{name: "Ext3", id: 1, wantUUID: fsID, wantLabel: "rootfs"},
+		{name: "Squashfs", id: 2, wantErr: true, wantIs: ErrNoFsInfo},
+		{name: "BadSuperblock", id: 3, wantErr: true},
+		{name: "NotPartition", id: 4, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			d, _, err := fimg.GetFromDescrID(tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id, err := d.GetFsUUID(&fimg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Fatalf("got error %v, want %v", err, tt.wantIs)
+			}
+			if got, want := id, tt.wantUUID; !uuid.Equal(got, want) {
+				t.Errorf("got UUID %v, want %v", got, want)
+			}
+
+			label, err := d.GetFsLabel(&fimg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got, want := label, tt.wantLabel; got != want {
+				t.Errorf("got label %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// An object group has no descriptor of its own, and exists while one or more data objects are
+// members of it. Group IDs are recorded in descriptors with DescrGroupMask set, while the functions
+// below accept and return group IDs as displayed, without DescrGroupMask.
+
+var (
+	errGroupIDInvalid    = errors.New("group ID invalid")
+	errGroupIDsExhausted = errors.New("no group IDs available")
+)
+
+// checkGroupID returns an error if groupID is not a valid group ID, as displayed.
+func checkGroupID(groupID uint32) error {
+	if groupID == 0 || groupID&DescrGroupMask != 0 {
+		return fmt.Errorf("%w: %d", errGroupIDInvalid, groupID)
+	}
+	return nil
+}
+
+// GetGroupIDs returns the IDs of the object groups in the image, in ascending order.
+func (fimg *FileImage) GetGroupIDs() []uint32 {
+	seen := make(map[uint32]bool)
+
+	var ids []uint32
+	fimg.WithDescriptors(func(d Descriptor) bool {
+		if d.Groupid == DescrUnusedGroup {
+			return false
+		}
+		if id := d.Groupid &^ DescrGroupMask; !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+		return false
+	})
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// NewGroupID returns an ID for a new object group, greater than that of any existing group. The
+// group exists once a data object is added to it, with AddObjectToGroup, or by setting the Groupid
+// of a DescriptorInput to the returned ID with DescrGroupMask set.
+func (fimg *FileImage) NewGroupID() (uint32, error) {
+	var id uint32
+	if ids := fimg.GetGroupIDs(); len(ids) > 0 {
+		id = ids[len(ids)-1]
+	}
+
+	if id+1 >= DescrGroupMask {
+		return 0, errGroupIDsExhausted
+	}
+	return id + 1, nil
+}
+
+// AddObjectToGroup makes the data object with the specified id a member of the object group with
+// the specified groupID, creating the group if it does not exist. If the object is a member of
+// another group, it is moved. Signatures covering either group will fail verification until the
+// group is signed again.
+func (fimg *FileImage) AddObjectToGroup(id, groupID uint32) error {
+	if err := checkGroupID(groupID); err != nil {
+		return err
+	}
+
+	d, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+	if d.Groupid == groupID|DescrGroupMask {
+		return nil
+	}
+
+	return fimg.updateObject(id, func(d *Descriptor) {
+		d.Groupid = groupID | DescrGroupMask
+		d.Mtime = fimg.now()
+	})
+}
+
+// RemoveObjectFromGroup removes the data object with the specified id from its object group, if
+// any. Once its last member is removed, the group no longer exists. Signatures covering the group
+// will fail verification until the group is signed again.
+func (fimg *FileImage) RemoveObjectFromGroup(id uint32) error {
+	d, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+	if d.Groupid == DescrUnusedGroup {
+		return nil
+	}
+
+	return fimg.updateObject(id, func(d *Descriptor) {
+		d.Groupid = DescrUnusedGroup
+		d.Mtime = fimg.now()
+	})
+}
+
+// DeleteGroup deletes the data objects of the object group with the specified groupID, along with
+// the signatures linked to the group or to any of its objects. The deletion is made in a single
+// transaction, so either all objects are deleted, or none are. The space occupied by the deleted
+// objects may be reclaimed with Compact.
+//
+// If the group does not exist, an error wrapping ErrNotFound is returned.
+func (fimg *FileImage) DeleteGroup(groupID uint32) error {
+	if err := checkGroupID(groupID); err != nil {
+		return err
+	}
+
+	members := make(map[uint32]bool)
+	for _, d := range fimg.GetDescriptors(WithGroup(groupID)) {
+		members[d.ID] = true
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("group %d: %w", groupID, ErrNotFound)
+	}
+
+	var ids []uint32
+	fimg.WithDescriptors(func(d Descriptor) bool {
+		signature := d.Datatype == DataSignature &&
+			(d.Link == groupID|DescrGroupMask || d.Link&DescrGroupMask == 0 && members[d.Link])
+		if members[d.ID] || signature {
+			ids = append(ids, d.ID)
+		}
+		return false
+	})
+
+	t := fimg.Begin()
+	for _, id := range ids {
+		if err := t.DeleteObject(id); err != nil {
+			t.Rollback() // nolint:errcheck
+			return err
+		}
+	}
+	return t.Commit()
+}
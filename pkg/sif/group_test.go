@@ -0,0 +1,218 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// createGroupImage creates an image at dir/name, holding two objects in group 1, a signature
+// linked to group 1, and an object that is not a member of any group.
+func createGroupImage(t *testing.T, dir, name string) string {
+	generic := DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Size:     7,
+		Fname:    "generic",
+		Data:     []byte("generic"),
+	}
+
+	return createTestImage(t, filepath.Join(dir, name),
+		testPartInput(t),
+		testDeffileInput(DescrUnusedLink),
+		testSigInput(t, DescrDefaultGroup, "signature"),
+		generic,
+	)
+}
+
+func TestGroupIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-group-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fimg, err := LoadContainer(createGroupImage(t, dir, "ids.sif"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	if got, want := fimg.GetGroupIDs(), []uint32{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got group IDs %v, want %v", got, want)
+	}
+
+	id, err := fimg.NewGroupID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := id, uint32(2); got != want {
+		t.Errorf("got new group ID %v, want %v", got, want)
+	}
+}
+
+func TestGroupMembership(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-group-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		fn      func(fimg *FileImage) error
+		wantErr error
+		wantIDs []uint32
+		wantGID uint32
+	}{
+		{
+			name:    "AddNewGroup",
+			fn:      func(fimg *FileImage) error { return fimg.AddObjectToGroup(4, 2) },
+			wantIDs: []uint32{1, 2},
+			wantGID: 2 | DescrGroupMask,
+		},
+		{
+			name:    "AddExistingGroup",
+			fn:      func(fimg *FileImage) error { return fimg.AddObjectToGroup(4, 1) },
+			wantIDs: []uint32{1},
+			wantGID: 1 | DescrGroupMask,
+		},
+		{
+			name:    "AddGroupIDZero",
+			fn:      func(fimg *FileImage) error { return fimg.AddObjectToGroup(4, 0) },
+			wantErr: errGroupIDInvalid,
+			wantIDs: []uint32{1},
+			wantGID: DescrUnusedGroup,
+		},
+		{
+			name:    "AddGroupIDMask",
+			fn:      func(fimg *FileImage) error { return fimg.AddObjectToGroup(4, 1|DescrGroupMask) },
+			wantErr: errGroupIDInvalid,
+			wantIDs: []uint32{1},
+			wantGID: DescrUnusedGroup,
+		},
+		{
+			name:    "AddNotFound",
+			fn:      func(fimg *FileImage) error { return fimg.AddObjectToGroup(9, 1) },
+			wantErr: ErrNotFound,
+			wantIDs: []uint32{1},
+			wantGID: DescrUnusedGroup,
+		},
+		{
+			name:    "RemoveUngrouped",
+			fn:      func(fimg *FileImage) error { return fimg.RemoveObjectFromGroup(4) },
+			wantIDs: []uint32{1},
+			wantGID: DescrUnusedGroup,
+		},
+		{
+			name: "MoveAndRemove",
+			fn: func(fimg *FileImage) error {
+				if err := fimg.AddObjectToGroup(4, 3); err != nil {
+					return err
+				}
+				return fimg.RemoveObjectFromGroup(4)
+			},
+			wantIDs: []uint32{1},
+			wantGID: DescrUnusedGroup,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := createGroupImage(t, dir, tt.name+".sif")
+
+			fimg, err := LoadContainer(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := tt.fn(&fimg), tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			// changes must persist once the image is reloaded
+			fimg, err = LoadContainer(path, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			if got, want := fimg.GetGroupIDs(), tt.wantIDs; !reflect.DeepEqual(got, want) {
+				t.Errorf("got group IDs %v, want %v", got, want)
+			}
+
+			d, _, err := fimg.GetFromDescrID(4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := d.Groupid, tt.wantGID; got != want {
+				t.Errorf("got group ID %#x, want %#x", got, want)
+			}
+		})
+	}
+}
+
+func TestDeleteGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-group-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		groupID uint32
+		wantErr error
+		wantIDs []uint32
+	}{
+		{"OK", 1, nil, []uint32{4}},
+		{"NotFound", 2, ErrNotFound, []uint32{1, 2, 3, 4}},
+		{"GroupIDInvalid", 0, errGroupIDInvalid, []uint32{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := createGroupImage(t, dir, tt.name+".sif")
+
+			fimg, err := LoadContainer(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := fimg.DeleteGroup(tt.groupID), tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err = LoadContainer(path, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			var ids []uint32
+			for _, d := range fimg.GetDescriptors() {
+				ids = append(ids, d.ID)
+			}
+			if got, want := ids, tt.wantIDs; !reflect.DeepEqual(got, want) {
+				t.Errorf("got object IDs %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Starting with HdrVersion3 ("03"), the descriptor table of an image is grown on demand when a
+// data object is added and no descriptor is free. The table remains contiguous and precedes the
+// data section, so readers locate it from the global header as for any other image. Where the
+// space between the table and the data section is insufficient, the data section is moved
+// towards the end of the file by a whole number of pages, preserving the alignment of data
+// objects up to 1MiB. Images of earlier versions keep a fixed number of descriptors.
+
+// hasDynamicTable returns true if the descriptor table of images of version v may be grown.
+func hasDynamicTable(v string) bool {
+	return v >= HdrVersion3
+}
+
+// growCount returns the number of descriptors to which a table of n descriptors is grown.
+func growCount(n int64) int64 {
+	count := 2 * n
+	if count < DescrNumEntries {
+		count = DescrNumEntries
+	}
+	if count > DescrMaxEntries {
+		count = DescrMaxEntries
+	}
+	return count
+}
+
+// canGrowDescriptors returns the number of descriptors to which the descriptor table of fimg may
+// be grown, along with the distance by which the data section must be moved to make room for it.
+// If the table cannot be grown, ErrNoFreeDescriptor is returned.
+func (fimg *FileImage) canGrowDescriptors() (count, delta int64, err error) {
+	if !hasDynamicTable(fimg.Header.GetVersion()) {
+		return 0, 0, ErrNoFreeDescriptor
+	}
+
+	count = growCount(fimg.Header.Dtotal)
+	if count <= fimg.Header.Dtotal {
+		return 0, 0, fmt.Errorf("%w: table holds maximum of %d descriptors", ErrNoFreeDescriptor, DescrMaxEntries)
+	}
+
+	if end := fimg.Header.Descroff + count*int64(binary.Size(Descriptor{})); end > fimg.Header.Dataoff {
+		// moving by a multiple of the largest alignment of any data object preserves them all
+		align := os.Getpagesize()
+		for _, d := range fimg.DescrArr {
+			if a := compactAlignment(d.Fileoff); d.Used && a > align {
+				align = a
+			}
+		}
+		delta = nextAligned(end-fimg.Header.Dataoff, align)
+	}
+
+	// the main file of a striped image must hold the entire descriptor table
+	if sf, ok := fimg.Fp.(*stripedFile); ok && fimg.Header.Dataoff+delta > sf.size {
+		return 0, 0, fmt.Errorf("%w: table would exceed stripe size %d", ErrNoFreeDescriptor, sf.size)
+	}
+
+	return count, delta, nil
+}
+
+// moveDataUp copies n bytes of data within fimg from offset src to offset dst, using buf. As data
+// is copied in descending order, dst must not be less than src.
+func moveDataUp(fimg *FileImage, dst, src, n int64, buf []byte) error {
+	for n > 0 {
+		b := buf
+		if n < int64(len(b)) {
+			b = b[:n]
+		}
+		n -= int64(len(b))
+
+		if _, err := fimg.Fp.ReadAt(b, src+n); err != nil {
+			return fmt.Errorf("reading data object: %s", err)
+		}
+		if _, err := fimg.Fp.Seek(dst+n, 0); err != nil {
+			return fmt.Errorf("seeking to data object offset: %s", err)
+		}
+		if _, err := fimg.Fp.Write(b); err != nil {
+			return fmt.Errorf("writing data object: %s", err)
+		}
+	}
+	return nil
+}
+
+// growDescriptors grows the descriptor table of fimg, moving the data section if required.
+func (fimg *FileImage) growDescriptors() error {
+	count, delta, err := fimg.canGrowDescriptors()
+	if err != nil {
+		return err
+	}
+
+	if delta > 0 {
+		if _, err := fimg.CheckTruncated(); err != nil {
+			return err
+		}
+
+		var order []int
+		for i, d := range fimg.DescrArr {
+			if d.Used {
+				order = append(order, i)
+			}
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return fimg.DescrArr[order[i]].Fileoff > fimg.DescrArr[order[j]].Fileoff
+		})
+
+		// data objects are moved last to first, so none is overwritten before it is moved, and
+		// descriptors are written as each is moved, so that an interruption leaves at most one
+		// data object out of place
+		buf := fimg.buffer()
+		for _, i := range order {
+			d := &fimg.DescrArr[i]
+			if err := moveDataUp(fimg, d.Fileoff+delta, d.Fileoff, d.Filelen, buf); err != nil {
+				return err
+			}
+
+			d.Fileoff += delta
+			if err := writeDescriptors(fimg); err != nil {
+				return err
+			}
+		}
+	}
+
+	fimg.DescrArr = append(fimg.DescrArr, make([]Descriptor, count-fimg.Header.Dtotal)...)
+	fimg.Header.Dfree += count - fimg.Header.Dtotal
+	fimg.Header.Dtotal = count
+	fimg.Header.Dataoff += delta
+
+	if err := writeDescriptors(fimg); err != nil {
+		return err
+	}
+
+	fimg.Header.Mtime = fimg.now()
+	if err := writeHeader(fimg); err != nil {
+		return err
+	}
+
+	if err := fimg.Fp.Sync(); err != nil {
+		return fmt.Errorf("while sync'ing grown descriptor table to SIF file: %s", err)
+	}
+
+	return fimg.remap()
+}
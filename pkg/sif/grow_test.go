@@ -0,0 +1,221 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestGrowDescriptors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-grow-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := func(i int) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("object %d\n", i)), 1000)
+	}
+	input := func(i int) DescriptorInput {
+		return DescriptorInput{
+			Datatype: DataGeneric,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     int64(len(data(i))),
+			Fname:    fmt.Sprintf("object-%d", i),
+			Data:     data(i),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		version     string
+		dataOffset  int64
+		alignment   int
+		wantErr     error
+		wantDtotal  int64
+		wantDataoff int64
+	}{
+		{
+			name:        "InPlace",
+			version:     HdrVersion3,
+			wantDtotal:  DescrNumEntries,
+			wantDataoff: DataStartOffset,
+		},
+		{
+			name:        "MoveData",
+			version:     HdrVersion3,
+			dataOffset:  8192,
+			wantDtotal:  DescrNumEntries,
+			wantDataoff: 8192 + nextAligned(DescrStartOffset+DescrNumEntries*585-8192, os.Getpagesize()),
+		},
+		{
+			name:        "MoveDataAligned",
+			version:     HdrVersion3,
+			dataOffset:  8192,
+			alignment:   1 << 20,
+			wantDtotal:  DescrNumEntries,
+			wantDataoff: 8192 + nextAligned(DescrStartOffset+DescrNumEntries*585-8192, 1<<20),
+		},
+		{
+			name:    "FixedTable",
+			version: HdrVersion2,
+			wantErr: ErrNoFreeDescriptor,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			aligned := input(2)
+			aligned.Alignment = tt.alignment
+
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: tt.version,
+				ID:         uuid.NewV4(),
+				InputDescr: []DescriptorInput{input(1), aligned},
+				DescrCount: 2,
+				DataOffset: tt.dataOffset,
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = fimg.AddObject(input(3))
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				fimg.UnloadContainer() // nolint:errcheck
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+			if err != nil {
+				return
+			}
+
+			// Reload the image, to check the grown table is read back.
+			fimg, err = LoadContainer(cinfo.Pathname, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			if got, want := fimg.Header.Dtotal, tt.wantDtotal; got != want {
+				t.Errorf("got %v descriptors, want %v", got, want)
+			}
+			if got, want := fimg.Header.Dfree, tt.wantDtotal-3; got != want {
+				t.Errorf("got %v free descriptors, want %v", got, want)
+			}
+			if got, want := fimg.Header.Dataoff, tt.wantDataoff; got != want {
+				t.Errorf("got data offset %v, want %v", got, want)
+			}
+			if err := fimg.checkStructure(); err != nil {
+				t.Error(err)
+			}
+
+			for i := 1; i <= 3; i++ {
+				d, _, err := fimg.GetFromDescrID(uint32(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(d.GetData(&fimg), data(i)) {
+					t.Errorf("object %d: data does not match", i)
+				}
+				if d.Fileoff%int64(os.Getpagesize()) != 0 {
+					t.Errorf("object %d: offset %d not aligned", i, d.Fileoff)
+				}
+			}
+
+			if tt.alignment != 0 {
+				d, _, err := fimg.GetFromDescrID(2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d.Fileoff%int64(tt.alignment) != 0 {
+					t.Errorf("got offset %v, want alignment %v", d.Fileoff, tt.alignment)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateContainerDynamicTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-grow-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inputs := make([]DescriptorInput, DescrNumEntries+2)
+	for i := range inputs {
+		inputs[i] = DescriptorInput{
+			Datatype: DataGeneric,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     1,
+			Fname:    "generic",
+			Data:     []byte{byte(i)},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		version    string
+		wantErr    error
+		wantDtotal int64
+	}{
+		{name: "Dynamic", version: HdrVersion3, wantDtotal: DescrNumEntries + 2},
+		{name: "Fixed", version: HdrVersion2, wantErr: ErrNoFreeDescriptor},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: tt.version,
+				ID:         uuid.NewV4(),
+				InputDescr: inputs,
+			}
+			_, err := CreateContainer(cinfo)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			if got, want := fimg.Header.Dtotal, tt.wantDtotal; got != want {
+				t.Errorf("got %v descriptors, want %v", got, want)
+			}
+			if got, want := fimg.Header.Dfree, int64(0); got != want {
+				t.Errorf("got %v free descriptors, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Mutations update the descriptor table and global header in a sequence of writes. A process
+// terminated part way through the sequence may leave descriptors that do not agree with the
+// header, or that reference data that has been truncated. Data objects themselves are written
+// before the sequence begins, so interrupting a long copy is safe.
+
+// guardedSignals are the termination signals deferred during mutations.
+var guardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+
+// raise delivers sig to the current process.
+var raise = func(sig os.Signal) error {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+// OptLoadSignalGuard specifies whether termination signals (SIGINT, SIGTERM and SIGHUP) received
+// while the descriptor table and global header are being written are deferred until the writes
+// complete, so that interrupting a program such as siftool does not corrupt the image. A deferred
+// signal is raised again once the writes complete, and is then handled as it would otherwise
+// have been.
+//
+// The guard is intended for programs that do not handle these signals themselves. Programs that
+// do are notified of a signal as soon as it is received, and again when it is raised.
+func OptLoadSignalGuard(b bool) LoadOpt {
+	return func(lo *loadOpts) error {
+		lo.signalGuard = b
+		return nil
+	}
+}
+
+// guarded calls fn, deferring termination signals until it returns if fimg was loaded with
+// OptLoadSignalGuard.
+func (fimg *FileImage) guarded(fn func() error) error {
+	if !fimg.signalGuard {
+		return fn()
+	}
+
+	ch := make(chan os.Signal, len(guardedSignals))
+	signal.Notify(ch, guardedSignals...)
+
+	err := fn()
+
+	signal.Stop(ch)
+	close(ch)
+
+	// Raise deferred signals, now that the default handling is restored.
+	for sig := range ch {
+		if rerr := raise(sig); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+
+	return err
+}
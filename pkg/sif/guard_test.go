@@ -0,0 +1,70 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGuarded(t *testing.T) {
+	// Receive SIGHUP in the test, so the test process is not terminated if the guard fails.
+	testCh := make(chan os.Signal, 1)
+	signal.Notify(testCh, syscall.SIGHUP)
+	defer signal.Stop(testCh)
+
+	var raised []os.Signal
+	defer func(r func(os.Signal) error) { raise = r }(raise)
+	raise = func(sig os.Signal) error {
+		raised = append(raised, sig)
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		guard      bool
+		err        error
+		wantRaised []os.Signal
+	}{
+		{name: "Unguarded"},
+		{name: "Guarded", guard: true, wantRaised: []os.Signal{syscall.SIGHUP}},
+		{name: "GuardedError", guard: true, err: io.EOF, wantRaised: []os.Signal{syscall.SIGHUP}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			raised = nil
+
+			fimg := FileImage{signalGuard: tt.guard}
+
+			err := fimg.guarded(func() error {
+				if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+					t.Fatal(err)
+				}
+				<-testCh
+
+				// Allow the signal to be delivered to the guard.
+				time.Sleep(10 * time.Millisecond)
+
+				return tt.err
+			})
+			if got, want := err, tt.err; !errors.Is(got, want) {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+
+			if got, want := raised, tt.wantRaised; !reflect.DeepEqual(got, want) {
+				t.Errorf("got raised signals %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Starting with HdrVersion2 ("02"), the global header is immediately followed by a header
+// extension. The extension records the on-disk sizes of the header and descriptor structures,
+// and CRC-32C checksums of both itself and the global header, so corruption is detected before
+// any descriptor is parsed. The extension records its own length, so fields may be appended to it
+// in future versions without breaking existing readers. It also carries image flags, such as
+// whether the image is sealed. Images of earlier versions have no extension and are not checked.
+//
+// Optionally, the extension also records a CRC-32C checksum of the descriptor table, so that
+// bit-rot in the metadata of data objects is detected as an image is loaded, whether or not it is
+// signed. The checksum is enabled with the DescrChecksum field of CreateInfo, or with
+// SetDescrChecksum, and is then updated each time the descriptor table is written. An extension
+// written by an implementation unaware of the checksum omits it, and the table is not checked.
+//
+// For an image striped across companion files, the extension also records the stripe map: the
+// size of each stripe, and the number of files holding them. Companion files are only opened
+// where the main file records a stripe map.
+
+// ErrHeaderChecksum is the code for when the checksum of the global header or header extension
+// does not match its contents.
+var ErrHeaderChecksum = errors.New("header checksum mismatch")
+
+// ErrDescrChecksum is the code for when the checksum of the descriptor table does not match its
+// contents.
+var ErrDescrChecksum = errors.New("descriptor table checksum mismatch")
+
+var (
+	errHeaderExtMissing     = errors.New("header extension missing")
+	errHeaderExtLenInvalid  = errors.New("header extension length invalid")
+	errStructSizeUnexpected = errors.New("unexpected on-disk structure size")
+	errDescrCRCUnsupported  = errors.New("descriptor table checksum requires SIF version 02 or later")
+	errStripeMapMissing     = errors.New("header extension of striped image lacks stripe map")
+)
+
+const (
+	hdrExtMagic     = "SIF_HEXT"
+	hdrExtCRCOffset = 12 // offset of the CRC field within the extension
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// headerExt is the header extension that follows the global header.
+type headerExt struct {
+	Magic     [8]byte // "SIF_HEXT"
+	Len       uint32  // length of the extension, including fields unknown to this implementation
+	CRC       uint32  // CRC-32C of the extension, computed with this field zeroed
+	HeaderLen uint32  // size of the global header
+	DescrLen  uint32  // size of each descriptor
+	HeaderCRC uint32  // CRC-32C of the global header
+	Flags     uint32  // image flags (hdrFlag*)
+}
+
+// headerExtDescr is appended to the header extension when the descriptor table checksum is
+// enabled.
+type headerExtDescr struct {
+	DescrCRC uint32 // CRC-32C of the descriptor table
+}
+
+// headerExtStripe is appended to the header extension of a striped image, following any
+// headerExtDescr.
+type headerExtStripe struct {
+	StripeSize  int64  // size of each stripe
+	StripeCount uint32 // number of files holding stripes, including the main file
+	Reserved    uint32
+}
+
+// headerExtInfo holds the values recorded in a validated header extension.
+type headerExtInfo struct {
+	flags    uint32    // image flags (hdrFlag*)
+	descrCRC uint32    // CRC-32C of the descriptor table, if hasDescr
+	hasDescr bool      // extension records a descriptor table checksum
+	stripes  stripeMap // stripe map, if flags include hdrFlagStriped
+}
+
+// Header extension flags.
+const (
+	hdrFlagSealed       uint32 = 1 << iota // image is sealed, and may not be modified
+	hdrFlagArchExplicit                    // header arch is set explicitly, not derived
+	hdrFlagThin                            // data objects are held in a content-addressed store
+	hdrFlagDescrCRC                        // extension records a checksum of the descriptor table
+	hdrFlagStriped                         // image is striped, and extension records the stripe map
+)
+
+// hasHeaderExt returns true if images of version v include a header extension.
+func hasHeaderExt(v string) bool {
+	return v >= HdrVersion2
+}
+
+// headerCRC returns the CRC-32C of the encoded global header h.
+func headerCRC(h *Header) (uint32, error) {
+	b := bytes.Buffer{}
+	if err := binary.Write(&b, binary.LittleEndian, h); err != nil {
+		return 0, err
+	}
+	return crc32.Checksum(b.Bytes(), castagnoli), nil
+}
+
+// descrCRC returns the CRC-32C of the encoded descriptor table descrs.
+func descrCRC(descrs []Descriptor) (uint32, error) {
+	b := bytes.Buffer{}
+	if err := binary.Write(&b, binary.LittleEndian, descrs); err != nil {
+		return 0, err
+	}
+	return crc32.Checksum(b.Bytes(), castagnoli), nil
+}
+
+// writeHeaderExt writes the header extension corresponding to global header h to w, with the
+// specified flags. If flags include hdrFlagDescrCRC, a checksum of descrs is appended. If flags
+// include hdrFlagStriped, the stripe map sm is appended.
+func writeHeaderExt(w io.Writer, h *Header, descrs []Descriptor, flags uint32, sm stripeMap) error {
+	hcrc, err := headerCRC(h)
+	if err != nil {
+		return err
+	}
+
+	withDescr := flags&hdrFlagDescrCRC != 0
+	withStripe := flags&hdrFlagStriped != 0
+
+	n := binary.Size(headerExt{})
+	if withDescr {
+		n += binary.Size(headerExtDescr{})
+	}
+	if withStripe {
+		n += binary.Size(headerExtStripe{})
+	}
+
+	ext := headerExt{
+		Len:       uint32(n),
+		HeaderLen: uint32(binary.Size(Header{})),
+		DescrLen:  uint32(binary.Size(Descriptor{})),
+		HeaderCRC: hcrc,
+		Flags:     flags,
+	}
+	copy(ext.Magic[:], hdrExtMagic)
+
+	b := bytes.Buffer{}
+	if err := binary.Write(&b, binary.LittleEndian, ext); err != nil {
+		return err
+	}
+	if withDescr {
+		dcrc, err := descrCRC(descrs)
+		if err != nil {
+			return err
+		}
+		if err := binary.Write(&b, binary.LittleEndian, headerExtDescr{DescrCRC: dcrc}); err != nil {
+			return err
+		}
+	}
+	if withStripe {
+		s := headerExtStripe{StripeSize: sm.size, StripeCount: uint32(sm.count)}
+		if err := binary.Write(&b, binary.LittleEndian, s); err != nil {
+			return err
+		}
+	}
+	binary.LittleEndian.PutUint32(b.Bytes()[hdrExtCRCOffset:], crc32.Checksum(b.Bytes(), castagnoli))
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// checkHeaderExt validates the header extension read from r against global header h, and returns
+// the values it records. If h describes an image without an extension, no values are returned.
+func checkHeaderExt(r io.ReaderAt, h *Header) (headerExtInfo, error) {
+	if !hasHeaderExt(h.GetVersion()) {
+		return headerExtInfo{}, nil
+	}
+
+	off := int64(binary.Size(Header{}))
+
+	var ext headerExt
+	sr := io.NewSectionReader(r, off, int64(binary.Size(ext)))
+	if err := binary.Read(sr, binary.LittleEndian, &ext); err != nil {
+		return headerExtInfo{}, fmt.Errorf("reading header extension: %s", err)
+	}
+
+	if string(ext.Magic[:]) != hdrExtMagic {
+		return headerExtInfo{}, errHeaderExtMissing
+	}
+
+	// The extension may be longer than understood by this implementation, but must not extend
+	// into the descriptor table.
+	if int64(ext.Len) < int64(binary.Size(ext)) || off+int64(ext.Len) > h.Descroff {
+		return headerExtInfo{}, fmt.Errorf("%w: %d", errHeaderExtLenInvalid, ext.Len)
+	}
+
+	b := make([]byte, ext.Len)
+	if _, err := r.ReadAt(b, off); err != nil {
+		return headerExtInfo{}, fmt.Errorf("reading header extension: %s", err)
+	}
+	binary.LittleEndian.PutUint32(b[hdrExtCRCOffset:], 0)
+
+	if crc32.Checksum(b, castagnoli) != ext.CRC {
+		return headerExtInfo{}, fmt.Errorf("%w: header extension", ErrHeaderChecksum)
+	}
+
+	if hcrc, err := headerCRC(h); err != nil {
+		return headerExtInfo{}, err
+	} else if hcrc != ext.HeaderCRC {
+		return headerExtInfo{}, fmt.Errorf("%w: global header", ErrHeaderChecksum)
+	}
+
+	if got, want := ext.HeaderLen, uint32(binary.Size(Header{})); got != want {
+		return headerExtInfo{}, fmt.Errorf("%w: header is %d bytes, want %d", errStructSizeUnexpected, got, want)
+	}
+	if got, want := ext.DescrLen, uint32(binary.Size(Descriptor{})); got != want {
+		return headerExtInfo{}, fmt.Errorf("%w: descriptor is %d bytes, want %d", errStructSizeUnexpected, got, want)
+	}
+
+	info := headerExtInfo{flags: ext.Flags}
+
+	// the descriptor table checksum is only present if written by an implementation aware of it
+	off = int64(binary.Size(ext))
+	if n := int64(binary.Size(headerExtDescr{})); ext.Flags&hdrFlagDescrCRC != 0 && int64(len(b)) >= off+n {
+		info.descrCRC = binary.LittleEndian.Uint32(b[off:])
+		info.hasDescr = true
+		off += n
+	}
+
+	// a striped image cannot be read without its stripe map
+	if ext.Flags&hdrFlagStriped != 0 {
+		var s headerExtStripe
+		if int64(len(b)) < off+int64(binary.Size(s)) {
+			return headerExtInfo{}, errStripeMapMissing
+		}
+		if err := binary.Read(bytes.NewReader(b[off:]), binary.LittleEndian, &s); err != nil {
+			return headerExtInfo{}, fmt.Errorf("reading stripe map: %s", err)
+		}
+		info.stripes = stripeMap{size: s.StripeSize, count: int(s.StripeCount)}
+	}
+
+	return info, nil
+}
+
+// checkDescrCRC returns an error wrapping ErrDescrChecksum if info records a checksum of the
+// descriptor table that does not match descrs.
+func checkDescrCRC(descrs []Descriptor, info headerExtInfo) error {
+	if !info.hasDescr {
+		return nil
+	}
+
+	dcrc, err := descrCRC(descrs)
+	if err != nil {
+		return err
+	}
+	if dcrc != info.descrCRC {
+		return fmt.Errorf("%w: got %#08x, want %#08x", ErrDescrChecksum, dcrc, info.descrCRC)
+	}
+	return nil
+}
+
+// OptLoadIgnoreDescrChecksum specifies whether an image whose descriptor table does not match its
+// checksum is loaded, rather than loading failing with an error wrapping ErrDescrChecksum. A write
+// interrupted between updating the descriptor table and the global header leaves such an image.
+// The mismatch is reported by Validate, and the checksum is rewritten by RepairInPlace.
+func OptLoadIgnoreDescrChecksum(b bool) LoadOpt {
+	return func(lo *loadOpts) error {
+		lo.ignoreDescrCRC = b
+		return nil
+	}
+}
+
+// loadDescrCRC checks the descriptor table of fimg against the checksum recorded in info. If
+// ignore is set, a mismatch is retained for Validate to report, rather than returned.
+func (fimg *FileImage) loadDescrCRC(info headerExtInfo, ignore bool) error {
+	err := checkDescrCRC(fimg.DescrArr, info)
+	if ignore && errors.Is(err, ErrDescrChecksum) {
+		fimg.descrCRCErr = err
+		return nil
+	}
+	return err
+}
+
+// HasDescrChecksum returns true if the image records a checksum of its descriptor table.
+func (fimg *FileImage) HasDescrChecksum() bool {
+	return fimg.flags&hdrFlagDescrCRC != 0
+}
+
+// SetDescrChecksum enables or disables the checksum of the descriptor table. Once enabled, the
+// checksum is updated each time the descriptor table is written, and verified when the image is
+// loaded. Enabling the checksum requires an image of SIF version 02 or later.
+func (fimg *FileImage) SetDescrChecksum(enable bool) error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+
+	if enable {
+		if !hasHeaderExt(fimg.Header.GetVersion()) {
+			return errDescrCRCUnsupported
+		}
+		fimg.flags |= hdrFlagDescrCRC
+	} else {
+		fimg.flags &^= hdrFlagDescrCRC
+	}
+
+	return fimg.guarded(func() error {
+		fimg.Header.Mtime = fimg.now()
+		if err := writeHeader(fimg); err != nil {
+			return err
+		}
+
+		if err := fimg.Fp.Sync(); err != nil {
+			return fmt.Errorf("while sync'ing SIF file: %s", err)
+		}
+
+		return nil
+	})
+}
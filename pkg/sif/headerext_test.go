@@ -0,0 +1,393 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestHeaderExt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-hdrext-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	create := func(version string) []byte {
+		cinfo := CreateInfo{
+			Pathname:   filepath.Join(dir, "image.sif"),
+			Launchstr:  HdrLaunch,
+			Sifversion: version,
+			ID:         uuid.NewV4(),
+		}
+		if _, err := CreateContainer(cinfo); err != nil {
+			t.Fatal(err)
+		}
+
+		// Modify the image, to ensure the extension is kept up to date as the header changes.
+		fimg, err := LoadContainer(cinfo.Pathname, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = fimg.AddObject(DescriptorInput{
+			Datatype: DataGeneric,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     4,
+			Fname:    "generic",
+			Data:     []byte("data"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fimg.UnloadContainer(); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(cinfo.Pathname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	v1 := create(HdrVersion1)
+	v2 := create(HdrVersion2)
+
+	// corrupt returns a copy of b, with the byte at offset off inverted.
+	corrupt := func(b []byte, off int) []byte {
+		c := append([]byte(nil), b...)
+		c[off] ^= 0xff
+		return c
+	}
+
+	// withExtLen returns a copy of b, with the extension length set to n and checksum updated.
+	withExtLen := func(b []byte, n uint32) []byte {
+		c := append([]byte(nil), b...)
+		ext := c[headerLen:]
+		binary.LittleEndian.PutUint32(ext[8:], n)
+		binary.LittleEndian.PutUint32(ext[hdrExtCRCOffset:], 0)
+		binary.LittleEndian.PutUint32(ext[hdrExtCRCOffset:], crc32.Checksum(ext[:n], castagnoli))
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		b       []byte
+		wantErr error
+	}{
+		{name: "Version1", b: v1},
+		{name: "Version1Unchecked", b: corrupt(v1, headerLen)},
+		{name: "Version2", b: v2},
+		{name: "Version2Appended", b: withExtLen(v2, 64)},
+		{name: "HeaderCorrupt", b: corrupt(v2, 64), wantErr: ErrHeaderChecksum},
+		{name: "ExtensionCorrupt", b: corrupt(v2, headerLen+20), wantErr: ErrHeaderChecksum},
+		{name: "ExtensionMissing", b: corrupt(v2, headerLen), wantErr: errHeaderExtMissing},
+		{name: "ExtensionShort", b: withExtLen(v2, 8), wantErr: errHeaderExtLenInvalid},
+		{name: "ExtensionLong", b: corrupt(withExtLen(v2, 64), headerLen+8+1), wantErr: errHeaderExtLenInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ProbeHeader(bytes.NewReader(tt.b)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ProbeHeader: got error %v, want %v", err, tt.wantErr)
+			}
+
+			fimg, err := LoadContainerFp(&mockSifReadWriter{buf: tt.b, name: "image.sif"}, true)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoadContainerFp: got error %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil {
+				if got, want := len(fimg.DescrArr), DescrNumEntries; got != want {
+					t.Errorf("got %v descriptors, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDescrChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-hdrext-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// nameOff is the offset of a byte in the name of the first data object.
+	const nameOff = DescrStartOffset + 73
+
+	create := func(name string, checksum, enable bool) []byte {
+		cinfo := CreateInfo{
+			Pathname:      filepath.Join(dir, name+".sif"),
+			Launchstr:     HdrLaunch,
+			Sifversion:    HdrVersion2,
+			ID:            uuid.NewV4(),
+			DescrChecksum: checksum,
+		}
+		if _, err := CreateContainer(cinfo); err != nil {
+			t.Fatal(err)
+		}
+
+		fimg, err := LoadContainer(cinfo.Pathname, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enable {
+			if err := fimg.SetDescrChecksum(true); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Modify the descriptor table, to ensure the checksum is kept up to date.
+		err = fimg.AddObject(DescriptorInput{
+			Datatype: DataGeneric,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     4,
+			Fname:    "generic",
+			Data:     []byte("data"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fimg.SetObjectName(1, "renamed"); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fimg.HasDescrChecksum(), checksum || enable; got != want {
+			t.Errorf("got checksum %v, want %v", got, want)
+		}
+		if err := fimg.UnloadContainer(); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(cinfo.Pathname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	plain := create("plain", false, false)
+	created := create("created", true, false)
+	enabled := create("enabled", false, true)
+
+	// corrupt returns a copy of b, with the byte at offset off inverted.
+	corrupt := func(b []byte, off int) []byte {
+		c := append([]byte(nil), b...)
+		c[off] ^= 0xff
+		return c
+	}
+
+	// truncateExt returns a copy of b, with the extension shortened as if written by an
+	// implementation unaware of the descriptor table checksum.
+	truncateExt := func(b []byte) []byte {
+		c := append([]byte(nil), b...)
+		n := uint32(binary.Size(headerExt{}))
+		ext := c[headerLen:]
+		binary.LittleEndian.PutUint32(ext[8:], n)
+		binary.LittleEndian.PutUint32(ext[hdrExtCRCOffset:], 0)
+		binary.LittleEndian.PutUint32(ext[hdrExtCRCOffset:], crc32.Checksum(ext[:n], castagnoli))
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		b       []byte
+		wantErr error
+	}{
+		{name: "Plain", b: plain},
+		{name: "PlainUnchecked", b: corrupt(plain, nameOff)},
+		{name: "Created", b: created},
+		{name: "CreatedCorrupt", b: corrupt(created, nameOff), wantErr: ErrDescrChecksum},
+		{name: "Enabled", b: enabled},
+		{name: "EnabledCorrupt", b: corrupt(enabled, nameOff), wantErr: ErrDescrChecksum},
+		{name: "ChecksumCorrupt", b: corrupt(created, headerLen+28), wantErr: ErrHeaderChecksum},
+		{name: "ChecksumOmitted", b: corrupt(truncateExt(created), nameOff)},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadContainerFp(&mockSifReadWriter{buf: tt.b, name: "image.sif"}, true); !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoadContainerFp: got error %v, want %v", err, tt.wantErr)
+			}
+
+			if _, err := LoadContainerReader(bytes.NewReader(tt.b)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoadContainerReader: got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOptLoadIgnoreDescrChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-hdrext-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cinfo := CreateInfo{
+		Pathname:      filepath.Join(dir, "image.sif"),
+		Launchstr:     HdrLaunch,
+		Sifversion:    HdrVersion2,
+		ID:            uuid.NewV4(),
+		DescrChecksum: true,
+		InputDescr: []DescriptorInput{{
+			Datatype: DataGeneric,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     4,
+			Fname:    "generic",
+			Data:     []byte("data"),
+		}},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	// Modify the descriptor table without updating the checksum, as an interrupted write would.
+	f, err := os.OpenFile(cinfo.Pathname, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("x"), DescrStartOffset+73); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := LoadContainer(cinfo.Pathname, true); !errors.Is(err, ErrDescrChecksum) {
+		t.Fatalf("got error %v, want %v", err, ErrDescrChecksum)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false, OptLoadIgnoreDescrChecksum(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Validate(&fimg).Err(); !errors.Is(err, ErrDescrChecksum) {
+		t.Errorf("got validation error %v, want %v", err, ErrDescrChecksum)
+	}
+
+	r, err := RepairInPlace(&fimg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(r.Repaired), 1; got != want {
+		t.Fatalf("got %v repairs, want %v", got, want)
+	}
+	if err := r.Repaired[0].Err; !errors.Is(err, ErrDescrChecksum) {
+		t.Errorf("got repair %v, want %v", err, ErrDescrChecksum)
+	}
+	if !r.Remaining.OK() {
+		t.Errorf("unexpected problems remaining: %v", r.Remaining.Err())
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err = LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetDescrChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-hdrext-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cinfo := CreateInfo{
+		Pathname:      filepath.Join(dir, "v1.sif"),
+		Launchstr:     HdrLaunch,
+		Sifversion:    HdrVersion1,
+		ID:            uuid.NewV4(),
+		DescrChecksum: true,
+	}
+	if _, err := CreateContainer(cinfo); !errors.Is(err, errDescrCRCUnsupported) {
+		t.Errorf("got error %v, want %v", err, errDescrCRCUnsupported)
+	}
+
+	cinfo.DescrChecksum = false
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	if err := fimg.SetDescrChecksum(true); !errors.Is(err, errDescrCRCUnsupported) {
+		t.Errorf("got error %v, want %v", err, errDescrCRCUnsupported)
+	}
+	if err := fimg.SetDescrChecksum(false); err != nil {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestCreateVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-hdrext-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name        string
+		version     string
+		wantVersion string
+		wantExt     bool
+	}{
+		{name: "Default", version: HdrVersion, wantVersion: "01", wantExt: false},
+		{name: "Version2", version: HdrVersion2, wantVersion: "02", wantExt: true},
+		{name: "Version3", version: HdrVersion3, wantVersion: "03", wantExt: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: tt.version,
+				ID:         uuid.NewV4(),
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			if got, want := fimg.Header.GetVersion(), tt.wantVersion; got != want {
+				t.Errorf("got version %v, want %v", got, want)
+			}
+			if got, want := hasHeaderExt(fimg.Header.GetVersion()), tt.wantExt; got != want {
+				t.Errorf("got header extension %v, want %v", got, want)
+			}
+		})
+	}
+}
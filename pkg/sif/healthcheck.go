@@ -0,0 +1,239 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A health check object defines how a container run from the image may be probed, so that an
+// orchestrator can derive its startup, liveness and readiness probes from the image itself rather
+// than from separate configuration. Each probe runs a command within the container, and succeeds
+// if the command exits with status zero.
+
+var (
+	errProbeKindInvalid    = errors.New("probe kind invalid")
+	errProbeKindDuplicate  = errors.New("probe kind duplicated")
+	errProbeCommandEmpty   = errors.New("probe command empty")
+	errProbeIntervalZero   = errors.New("probe interval must be positive")
+	errProbeValueNegative  = errors.New("probe timeout, start period and retries must not be negative")
+	errHealthCheckNoProbes = errors.New("health check contains no probes")
+)
+
+// HealthCheckName is the default name of health check objects.
+const HealthCheckName = "healthcheck.json"
+
+// ProbeKind represents the purpose of a health check probe.
+type ProbeKind string
+
+// List of supported probe kinds.
+const (
+	ProbeStartup   ProbeKind = "startup"   // container has finished starting
+	ProbeLiveness  ProbeKind = "liveness"  // container is running, and need not be restarted
+	ProbeReadiness ProbeKind = "readiness" // container is ready to accept work
+)
+
+// Probe represents a health check probe.
+type Probe struct {
+	Kind        ProbeKind     // purpose of the probe
+	Command     []string      // command and arguments to run within the container
+	Interval    time.Duration // time between runs of the probe
+	Timeout     time.Duration // time after which a run of the probe fails, or zero if unlimited
+	StartPeriod time.Duration // time after start during which failures are not counted
+	Retries     int           // consecutive failures after which the probe fails, or zero for one
+}
+
+// rawProbe is the JSON encoding of a Probe. Durations are encoded as strings such as "30s".
+type rawProbe struct {
+	Kind        ProbeKind `json:"kind"`
+	Command     []string  `json:"command"`
+	Interval    string    `json:"interval"`
+	Timeout     string    `json:"timeout,omitempty"`
+	StartPeriod string    `json:"startPeriod,omitempty"`
+	Retries     int       `json:"retries,omitempty"`
+}
+
+// MarshalJSON encodes p, with durations encoded as strings such as "30s".
+func (p Probe) MarshalJSON() ([]byte, error) {
+	raw := rawProbe{
+		Kind:     p.Kind,
+		Command:  p.Command,
+		Interval: p.Interval.String(),
+		Retries:  p.Retries,
+	}
+	if p.Timeout != 0 {
+		raw.Timeout = p.Timeout.String()
+	}
+	if p.StartPeriod != 0 {
+		raw.StartPeriod = p.StartPeriod.String()
+	}
+	return json.Marshal(raw)
+}
+
+// UnmarshalJSON decodes p from b.
+func (p *Probe) UnmarshalJSON(b []byte) error {
+	var raw rawProbe
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	parse := func(s string) (time.Duration, error) {
+		if s == "" {
+			return 0, nil
+		}
+		return time.ParseDuration(s)
+	}
+
+	interval, err := parse(raw.Interval)
+	if err != nil {
+		return err
+	}
+	timeout, err := parse(raw.Timeout)
+	if err != nil {
+		return err
+	}
+	startPeriod, err := parse(raw.StartPeriod)
+	if err != nil {
+		return err
+	}
+
+	*p = Probe{
+		Kind:        raw.Kind,
+		Command:     raw.Command,
+		Interval:    interval,
+		Timeout:     timeout,
+		StartPeriod: startPeriod,
+		Retries:     raw.Retries,
+	}
+	return nil
+}
+
+// check returns an error if p is not a valid probe.
+func (p Probe) check() error {
+	switch p.Kind {
+	case ProbeStartup, ProbeLiveness, ProbeReadiness:
+	default:
+		return fmt.Errorf("%w: %q", errProbeKindInvalid, p.Kind)
+	}
+
+	if len(p.Command) == 0 || p.Command[0] == "" {
+		return fmt.Errorf("%v probe: %w", p.Kind, errProbeCommandEmpty)
+	}
+	if p.Interval <= 0 {
+		return fmt.Errorf("%v probe: %w", p.Kind, errProbeIntervalZero)
+	}
+	if p.Timeout < 0 || p.StartPeriod < 0 || p.Retries < 0 {
+		return fmt.Errorf("%v probe: %w", p.Kind, errProbeValueNegative)
+	}
+	return nil
+}
+
+// HealthCheck represents the health check probes of an image. At most one probe of each kind is
+// defined.
+type HealthCheck struct {
+	Probes []Probe `json:"probes"`
+}
+
+// check returns an error if hc is not a valid health check.
+func (hc *HealthCheck) check() error {
+	if len(hc.Probes) == 0 {
+		return errHealthCheckNoProbes
+	}
+
+	kinds := make(map[ProbeKind]bool)
+	for _, p := range hc.Probes {
+		if err := p.check(); err != nil {
+			return err
+		}
+		if kinds[p.Kind] {
+			return fmt.Errorf("%w: %q", errProbeKindDuplicate, p.Kind)
+		}
+		kinds[p.Kind] = true
+	}
+	return nil
+}
+
+// Probe returns the probe of the specified kind, and true, or false if hc defines no such probe.
+func (hc *HealthCheck) Probe(kind ProbeKind) (Probe, bool) {
+	for _, p := range hc.Probes {
+		if p.Kind == kind {
+			return p, true
+		}
+	}
+	return Probe{}, false
+}
+
+// Startup returns the startup probe of hc, and true, or false if hc defines none.
+func (hc *HealthCheck) Startup() (Probe, bool) {
+	return hc.Probe(ProbeStartup)
+}
+
+// Liveness returns the liveness probe of hc, and true, or false if hc defines none.
+func (hc *HealthCheck) Liveness() (Probe, bool) {
+	return hc.Probe(ProbeLiveness)
+}
+
+// Readiness returns the readiness probe of hc, and true, or false if hc defines none.
+func (hc *HealthCheck) Readiness() (Probe, bool) {
+	return hc.Probe(ProbeReadiness)
+}
+
+// ReadHealthCheck reads a health check from r, as written by NewHealthCheckInput.
+func ReadHealthCheck(r io.Reader) (*HealthCheck, error) {
+	var hc HealthCheck
+	if err := json.NewDecoder(r).Decode(&hc); err != nil {
+		return nil, fmt.Errorf("decoding health check: %s", err)
+	}
+	if err := hc.check(); err != nil {
+		return nil, err
+	}
+	return &hc, nil
+}
+
+// NewHealthCheckInput returns a DescriptorInput for a health check object holding the probes of
+// hc, in the default object group. Each probe must be of a known kind, with a command and a
+// positive interval, and at most one probe of each kind may be defined.
+func NewHealthCheckInput(hc *HealthCheck) (DescriptorInput, error) {
+	if err := hc.check(); err != nil {
+		return DescriptorInput{}, err
+	}
+
+	b, err := json.Marshal(hc)
+	if err != nil {
+		return DescriptorInput{}, err
+	}
+
+	return DescriptorInput{
+		Datatype: DataHealthCheck,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(b)),
+		Fname:    HealthCheckName,
+		Data:     b,
+	}, nil
+}
+
+// GetHealthCheck reads the health check from the data object described by d.
+func (d *Descriptor) GetHealthCheck(fimg *FileImage) (*HealthCheck, error) {
+	if d.Datatype != DataHealthCheck {
+		return nil, fmt.Errorf("expected DataHealthCheck, got %v", d.Datatype)
+	}
+	return ReadHealthCheck(d.GetReadSeeker(fimg))
+}
+
+// GetHealthCheck reads the health check of the image. If the image contains no health check,
+// ErrNotFound is returned. If it contains more than one, ErrMultValues is returned.
+func (fimg *FileImage) GetHealthCheck() (*HealthCheck, error) {
+	d, err := fimg.GetDescriptor(WithDataType(DataHealthCheck))
+	if err != nil {
+		return nil, err
+	}
+	return d.GetHealthCheck(fimg)
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestNewHealthCheckInput(t *testing.T) {
+	liveness := Probe{
+		Kind:     ProbeLiveness,
+		Command:  []string{"/bin/check", "--live"},
+		Interval: 30 * time.Second,
+	}
+
+	tests := []struct {
+		name     string
+		hc       HealthCheck
+		wantErr  error
+		wantData string
+	}{
+		{
+			name:    "NoProbes",
+			wantErr: errHealthCheckNoProbes,
+		},
+		{
+			name:    "KindInvalid",
+			hc:      HealthCheck{Probes: []Probe{{Kind: "other", Command: []string{"true"}, Interval: time.Second}}},
+			wantErr: errProbeKindInvalid,
+		},
+		{
+			name:    "KindDuplicate",
+			hc:      HealthCheck{Probes: []Probe{liveness, liveness}},
+			wantErr: errProbeKindDuplicate,
+		},
+		{
+			name:    "CommandEmpty",
+			hc:      HealthCheck{Probes: []Probe{{Kind: ProbeStartup, Interval: time.Second}}},
+			wantErr: errProbeCommandEmpty,
+		},
+		{
+			name:    "IntervalZero",
+			hc:      HealthCheck{Probes: []Probe{{Kind: ProbeStartup, Command: []string{"true"}}}},
+			wantErr: errProbeIntervalZero,
+		},
+		{
+			name: "RetriesNegative",
+			hc: HealthCheck{Probes: []Probe{
+				{Kind: ProbeStartup, Command: []string{"true"}, Interval: time.Second, Retries: -1},
+			}},
+			wantErr: errProbeValueNegative,
+		},
+		{
+			name:     "Liveness",
+			hc:       HealthCheck{Probes: []Probe{liveness}},
+			wantData: `{"probes":[{"kind":"liveness","command":["/bin/check","--live"],"interval":"30s"}]}`,
+		},
+		{
+			name: "AllFields",
+			hc: HealthCheck{Probes: []Probe{{
+				Kind:        ProbeStartup,
+				Command:     []string{"true"},
+				Interval:    time.Second,
+				Timeout:     500 * time.Millisecond,
+				StartPeriod: time.Minute,
+				Retries:     3,
+			}}},
+			wantData: `{"probes":[{"kind":"startup","command":["true"],"interval":"1s",` +
+				`"timeout":"500ms","startPeriod":"1m0s","retries":3}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := NewHealthCheckInput(&tt.hc)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			if got, want := string(input.Data), tt.wantData; got != want {
+				t.Errorf("got data %v, want %v", got, want)
+			}
+			if got, want := input.Datatype, DataHealthCheck; got != want {
+				t.Errorf("got datatype %v, want %v", got, want)
+			}
+
+			hc, err := ReadHealthCheck(strings.NewReader(tt.wantData))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(hc, &tt.hc) {
+				t.Errorf("got health check %+v, want %+v", hc, &tt.hc)
+			}
+		})
+	}
+}
+
+func TestReadHealthCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"Malformed", `{"probes":`, nil},
+		{"Duration", `{"probes":[{"kind":"startup","command":["true"],"interval":"soon"}]}`, nil},
+		{"Invalid", `{"probes":[{"kind":"startup","command":["true"]}]}`, errProbeIntervalZero},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadHealthCheck(strings.NewReader(tt.data))
+			if err == nil {
+				t.Fatal("unexpected success")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetHealthCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-healthcheck-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hc := HealthCheck{Probes: []Probe{
+		{Kind: ProbeReadiness, Command: []string{"/bin/ready"}, Interval: 10 * time.Second},
+		{Kind: ProbeLiveness, Command: []string{"/bin/live"}, Interval: time.Minute, Retries: 3},
+	}}
+
+	input, err := NewHealthCheckInput(&hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{input},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	got, err := fimg.GetHealthCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, &hc) {
+		t.Errorf("got health check %+v, want %+v", got, &hc)
+	}
+
+	if p, ok := got.Liveness(); !ok || p.Retries != 3 {
+		t.Errorf("got liveness probe %+v, %v", p, ok)
+	}
+	if p, ok := got.Readiness(); !ok || p.Interval != 10*time.Second {
+		t.Errorf("got readiness probe %+v, %v", p, ok)
+	}
+	if _, ok := got.Startup(); ok {
+		t.Error("unexpected startup probe")
+	}
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.GetName(), HealthCheckName; got != want {
+		t.Errorf("got name %v, want %v", got, want)
+	}
+	if got, want := d.GetMediaType(), "application/vnd.sylabs.sif.object.healthcheck.v1+json"; got != want {
+		t.Errorf("got media type %v, want %v", got, want)
+	}
+
+	empty := FileImage{}
+	if _, err := empty.GetHealthCheck(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrNotFound)
+	}
+}
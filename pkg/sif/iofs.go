@@ -0,0 +1,177 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The data objects of an image may be accessed through the io/fs interfaces, so that code written
+// against fs.FS, such as fs.WalkDir or http.FS, may operate on the content of an image. The view
+// is flat: the root directory holds one read-only file per data object, named by its descriptor
+// name. Objects with no name, with a name that is not a valid file name or is a decimal number,
+// or with a name shared with another object, are named by their decimal ID instead.
+
+// objectFS implements fs.FS over the data objects of an image.
+type objectFS struct {
+	fimg    *FileImage
+	modTime time.Time
+	names   []string               // file names, in order of object ID
+	objects map[string]*Descriptor // objects, by file name
+}
+
+// FS returns a read-only fs.FS view of the data objects of the image. The view reflects the
+// objects present when FS is called, so a new view must be obtained after the image is modified.
+func (fimg *FileImage) FS() fs.FS {
+	fsys := &objectFS{
+		fimg:    fimg,
+		modTime: time.Unix(fimg.Header.Mtime, 0),
+		objects: make(map[string]*Descriptor),
+	}
+
+	ds := fimg.GetDescriptors()
+
+	count := make(map[string]int)
+	for _, d := range ds {
+		count[d.GetName()]++
+	}
+
+	for i := range ds {
+		d := &ds[i]
+
+		// Decimal names are reserved for IDs, so that file names are unique.
+		name := d.GetName()
+		if _, err := strconv.ParseUint(name, 10, 64); err == nil ||
+			name == "." || strings.Contains(name, "/") || !fs.ValidPath(name) || count[name] > 1 {
+			name = strconv.FormatUint(uint64(d.ID), 10)
+		}
+
+		fsys.names = append(fsys.names, name)
+		fsys.objects[name] = d
+	}
+
+	return fsys
+}
+
+// Open opens the named file, which is either "." or the name of a data object.
+func (fsys *objectFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return &objectDir{fsys: fsys}, nil
+	}
+
+	d, ok := fsys.objects[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &objectFile{
+		info: objectInfo{name: name, d: d},
+		rs:   d.GetReader(fsys.fimg),
+	}, nil
+}
+
+// objectInfo implements fs.FileInfo and fs.DirEntry for a data object.
+type objectInfo struct {
+	name string
+	d    *Descriptor
+}
+
+func (fi objectInfo) Name() string               { return fi.name }
+func (fi objectInfo) Size() int64                { return fi.d.GetSize() }
+func (fi objectInfo) Mode() fs.FileMode          { return 0444 }
+func (fi objectInfo) ModTime() time.Time         { return time.Unix(fi.d.Mtime, 0) }
+func (fi objectInfo) IsDir() bool                { return false }
+func (fi objectInfo) Sys() interface{}           { return *fi.d }
+func (fi objectInfo) Type() fs.FileMode          { return 0 }
+func (fi objectInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+// objectFile implements fs.File for a data object.
+type objectFile struct {
+	info objectInfo
+	rs   io.ReadSeeker
+}
+
+// Stat returns a FileInfo describing the data object. The Sys method of the FileInfo returns the
+// Descriptor of the object.
+func (f *objectFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// Read reads from the data object.
+func (f *objectFile) Read(b []byte) (int, error) {
+	return f.rs.Read(b)
+}
+
+// Seek sets the offset for the next Read.
+func (f *objectFile) Seek(offset int64, whence int) (int64, error) {
+	return f.rs.Seek(offset, whence)
+}
+
+// Close does nothing. The image is owned by the caller.
+func (f *objectFile) Close() error {
+	return nil
+}
+
+// rootInfo implements fs.FileInfo for the root directory.
+type rootInfo struct {
+	modTime time.Time
+}
+
+func (fi rootInfo) Name() string       { return "." }
+func (fi rootInfo) Size() int64        { return 0 }
+func (fi rootInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (fi rootInfo) ModTime() time.Time { return fi.modTime }
+func (fi rootInfo) IsDir() bool        { return true }
+func (fi rootInfo) Sys() interface{}   { return nil }
+
+// objectDir implements fs.ReadDirFile for the root directory.
+type objectDir struct {
+	fsys *objectFS
+	off  int
+}
+
+// Stat returns a FileInfo describing the root directory.
+func (dir *objectDir) Stat() (fs.FileInfo, error) {
+	return rootInfo{modTime: dir.fsys.modTime}, nil
+}
+
+// Read returns an error, as the root is a directory.
+func (dir *objectDir) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: fs.ErrInvalid}
+}
+
+// ReadDir returns the entries of the root directory, in order of object ID, as described by
+// fs.ReadDirFile.
+func (dir *objectDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	names := dir.fsys.names[dir.off:]
+	if n > 0 && len(names) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(names) {
+		names = names[:n]
+	}
+
+	entries := make([]fs.DirEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, objectInfo{name: name, d: dir.fsys.objects[name]})
+	}
+	dir.off += len(names)
+
+	return entries, nil
+}
+
+// Close does nothing.
+func (dir *objectDir) Close() error {
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-fs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := func(name, data string) DescriptorInput {
+		return DescriptorInput{
+			Datatype: DataGeneric,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     int64(len(data)),
+			Fname:    name,
+			Data:     []byte(data),
+		}
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "fs.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			input("busybox.def", "bootstrap: busybox"),
+			input("", "unnamed"),
+			input("dup", "first"),
+			input("dup", "second"),
+			input("1", "decimal"),
+			input(".", "dot"),
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	fsys := fimg.FS()
+
+	want := map[string]string{
+		"busybox.def": "bootstrap: busybox",
+		"2":           "unnamed",
+		"3":           "first",
+		"4":           "second",
+		"5":           "decimal",
+		"6":           "dot",
+	}
+
+	if err := fstest.TestFS(fsys, "busybox.def", "2", "3", "4", "5", "6"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range want {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if got, want := b, []byte(data); !bytes.Equal(got, want) {
+			t.Errorf("%v: got data %q, want %q", name, got, want)
+		}
+	}
+
+	fi, err := fs.Stat(fsys, "busybox.def")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := fi.Sys().(Descriptor); !ok || d.ID != 1 {
+		t.Errorf("got sys %v, want descriptor 1", fi.Sys())
+	}
+
+	if _, err := fsys.Open("dup"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := fsys.Open("../busybox.def"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("got error %v, want %v", err, fs.ErrInvalid)
+	}
+}
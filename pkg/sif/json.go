@@ -0,0 +1,246 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+)
+
+// JSONVersion is the version of the JSON documents produced by HeaderJSON and DescriptorsJSON.
+// Fields may be added to the documents without changing the version. The version is incremented
+// if a field is removed, renamed, or its meaning changes.
+const JSONVersion = 1
+
+// HeaderInfo is the JSON document produced by HeaderJSON.
+type HeaderInfo struct {
+	JSONVersion  int    `json:"jsonVersion"`
+	Launch       string `json:"launch"`
+	Magic        string `json:"magic"`
+	Version      string `json:"version"`
+	Arch         string `json:"arch"`
+	ID           string `json:"id"`
+	Ctime        int64  `json:"ctime"`
+	Mtime        int64  `json:"mtime"`
+	Dfree        int64  `json:"dfree"`
+	Dtotal       int64  `json:"dtotal"`
+	Descroff     int64  `json:"descroff"`
+	Descrlen     int64  `json:"descrlen"`
+	Dataoff      int64  `json:"dataoff"`
+	Datalen      int64  `json:"datalen"`
+	Sealed       bool   `json:"sealed"`
+	Thin         bool   `json:"thin"`
+	ArchExplicit bool   `json:"archExplicit"`
+}
+
+// DescriptorList is the JSON document produced by DescriptorsJSON.
+type DescriptorList struct {
+	JSONVersion int              `json:"jsonVersion"`
+	Descriptors []DescriptorInfo `json:"descriptors"`
+}
+
+// DescriptorInfo describes a used descriptor in a DescriptorList.
+type DescriptorInfo struct {
+	Slot          int                `json:"slot"` // index of the descriptor in the descriptor table
+	ID            uint32             `json:"id"`
+	Group         uint32             `json:"group,omitempty"`     // group ID, or zero if none
+	Link          uint32             `json:"link,omitempty"`      // linked object or group ID, or zero if none
+	LinkGroup     bool               `json:"linkGroup,omitempty"` // if true, Link is a group ID
+	Datatype      string             `json:"datatype"`
+	Name          string             `json:"name"`
+	Fileoff       int64              `json:"fileoff"`
+	Filelen       int64              `json:"filelen"`
+	Storelen      int64              `json:"storelen"`
+	Compression   string             `json:"compression,omitempty"` // compression method, if compressed
+	Size          int64              `json:"size,omitempty"`        // decompressed size, if compressed
+	Ctime         int64              `json:"ctime"`
+	Mtime         int64              `json:"mtime"`
+	UID           int64              `json:"uid"`
+	Gid           int64              `json:"gid"`
+	Partition     *PartitionInfo     `json:"partition,omitempty"`
+	Signature     *SignatureInfo     `json:"signature,omitempty"`
+	CryptoMessage *CryptoMessageInfo `json:"cryptoMessage,omitempty"`
+	SBOM          *SBOMInfo          `json:"sbom,omitempty"`
+	OCIBlob       *OCIBlobInfo       `json:"ociBlob,omitempty"`
+	Placeholder   *PlaceholderInfo   `json:"placeholder,omitempty"`
+	Secrets       *SecretsInfo       `json:"secrets,omitempty"`
+}
+
+// PartitionInfo describes the Extra field of a partition descriptor.
+type PartitionInfo struct {
+	Fstype   string `json:"fstype"`
+	Parttype string `json:"parttype"`
+	Arch     string `json:"arch"`
+}
+
+// SignatureInfo describes the Extra field of a signature descriptor.
+type SignatureInfo struct {
+	Hashtype string `json:"hashtype"`
+	Entity   string `json:"entity"`
+}
+
+// CryptoMessageInfo describes the Extra field of a cryptographic message descriptor.
+type CryptoMessageInfo struct {
+	Formattype  string `json:"formattype"`
+	Messagetype string `json:"messagetype"`
+}
+
+// SBOMInfo describes the Extra field of a software bill of materials descriptor.
+type SBOMInfo struct {
+	Format string `json:"format"`
+}
+
+// OCIBlobInfo describes the Extra field of an OCI config or blob descriptor.
+type OCIBlobInfo struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+// PlaceholderInfo describes the Extra field of a placeholder descriptor.
+type PlaceholderInfo struct {
+	Datatype string `json:"datatype"`
+	Digest   string `json:"digest,omitempty"`
+}
+
+// SecretsInfo describes the Extra field of a secrets descriptor.
+type SecretsInfo struct {
+	Cipher string `json:"cipher"`
+}
+
+// getHeaderInfo returns a description of the global header of fimg.
+func (fimg *FileImage) getHeaderInfo() HeaderInfo {
+	return HeaderInfo{
+		JSONVersion:  JSONVersion,
+		Launch:       trimZeroBytes(fimg.Header.Launch[:]),
+		Magic:        trimZeroBytes(fimg.Header.Magic[:]),
+		Version:      trimZeroBytes(fimg.Header.Version[:]),
+		Arch:         GetGoArch(trimZeroBytes(fimg.Header.Arch[:])),
+		ID:           fimg.Header.ID.String(),
+		Ctime:        fimg.Header.Ctime,
+		Mtime:        fimg.Header.Mtime,
+		Dfree:        fimg.Header.Dfree,
+		Dtotal:       fimg.Header.Dtotal,
+		Descroff:     fimg.Header.Descroff,
+		Descrlen:     fimg.Header.Descrlen,
+		Dataoff:      fimg.Header.Dataoff,
+		Datalen:      fimg.Header.Datalen,
+		Sealed:       fimg.IsSealed(),
+		Thin:         fimg.IsThin(),
+		ArchExplicit: fimg.IsArchExplicit(),
+	}
+}
+
+// getDescriptorInfo returns a description of descriptor v, found at index slot of the descriptor
+// table.
+func getDescriptorInfo(slot int, v Descriptor) DescriptorInfo {
+	di := DescriptorInfo{
+		Slot:     slot,
+		ID:       v.ID,
+		Datatype: v.Datatype.String(),
+		Name:     trimZeroBytes(v.Name[:]),
+		Fileoff:  v.Fileoff,
+		Filelen:  v.Filelen,
+		Storelen: v.Storelen,
+		Ctime:    v.Ctime,
+		Mtime:    v.Mtime,
+		UID:      v.UID,
+		Gid:      v.Gid,
+	}
+
+	if c := v.GetCompression(); c != CompressionNone {
+		di.Compression = c.String()
+		di.Size = v.GetSize()
+	}
+
+	if v.Groupid != DescrUnusedGroup {
+		di.Group = v.Groupid &^ DescrGroupMask
+	}
+
+	if v.Link != DescrUnusedLink {
+		if v.Link&DescrGroupMask == DescrGroupMask {
+			di.Link = v.Link &^ DescrGroupMask
+			di.LinkGroup = true
+		} else {
+			di.Link = v.Link
+		}
+	}
+
+	switch v.Datatype {
+	case DataPartition:
+		f, _ := v.GetFsType()
+		p, _ := v.GetPartType()
+		a, _ := v.GetArch()
+		di.Partition = &PartitionInfo{
+			Fstype:   fstypeStr(f),
+			Parttype: parttypeStr(p),
+			Arch:     GetGoArch(trimZeroBytes(a[:])),
+		}
+	case DataSignature:
+		h, _ := v.GetHashType()
+		e, _ := v.GetEntityString()
+		di.Signature = &SignatureInfo{
+			Hashtype: hashtypeStr(h),
+			Entity:   e,
+		}
+	case DataCryptoMessage:
+		f, _ := v.GetFormatType()
+		m, _ := v.GetMessageType()
+		di.CryptoMessage = &CryptoMessageInfo{
+			Formattype:  formattypeStr(f),
+			Messagetype: messagetypeStr(m),
+		}
+	case DataSBOM:
+		f, _ := v.GetSBOMFormat()
+		di.SBOM = &SBOMInfo{
+			Format: sbomformatStr(f),
+		}
+	case DataOCIConfig, DataOCIBlob:
+		m, _ := v.GetOCIMediaType()
+		d, _ := v.GetOCIDigest()
+		di.OCIBlob = &OCIBlobInfo{
+			MediaType: m,
+			Digest:    d,
+		}
+	case DataPlaceholder:
+		t, _ := v.GetPlaceholderType()
+		d, _ := v.GetPlaceholderDigest()
+		di.Placeholder = &PlaceholderInfo{
+			Datatype: t.String(),
+			Digest:   d,
+		}
+	case DataSecrets:
+		c, _ := v.GetSecretsCipher()
+		di.Secrets = &SecretsInfo{
+			Cipher: secretscipherStr(c),
+		}
+	}
+
+	return di
+}
+
+// HeaderJSON returns a JSON document, described by HeaderInfo, holding the global header of the
+// image. Unlike FmtHeader, the output is not localized, and sizes are given in bytes.
+func (fimg *FileImage) HeaderJSON() ([]byte, error) {
+	return json.Marshal(fimg.getHeaderInfo())
+}
+
+// DescriptorsJSON returns a JSON document, described by DescriptorList, holding the used
+// descriptors of the image, in descriptor table order. Unlike FmtDescrList and FmtDescrInfo, the
+// output is not localized.
+func (fimg *FileImage) DescriptorsJSON() ([]byte, error) {
+	l := DescriptorList{
+		JSONVersion: JSONVersion,
+		Descriptors: []DescriptorInfo{},
+	}
+
+	for i, v := range fimg.DescrArr {
+		if !v.Used {
+			continue
+		}
+		l.Descriptors = append(l.Descriptors, getDescriptorInfo(i, v))
+	}
+
+	return json.Marshal(l)
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// compactJSON returns s with insignificant whitespace removed.
+func compactJSON(t *testing.T, s string) string {
+	t.Helper()
+
+	b := bytes.Buffer{}
+	if err := json.Compact(&b, []byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestFileImage_HeaderJSON(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatalf(`Could not load test container: %v`, err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	want := compactJSON(t, `{
+		"jsonVersion": 1,
+		"launch": "#!/usr/bin/env run-singularity\n",
+		"magic": "SIF_MAGIC",
+		"version": "00",
+		"arch": "amd64",
+		"id": "293e8b11-dbd0-47e6-b0b9-390772c12be8",
+		"ctime": 1534232759,
+		"mtime": 1534232856,
+		"dfree": 45,
+		"dtotal": 48,
+		"descroff": 4096,
+		"descrlen": 28080,
+		"dataoff": 32768,
+		"datalen": 1721275,
+		"sealed": false,
+		"thin": false,
+		"archExplicit": false
+	}`)
+
+	b, err := fimg.HeaderJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != want {
+		t.Errorf("got header:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFileImage_DescriptorsJSON(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatalf(`Could not load test container: %v`, err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	want := compactJSON(t, `{
+		"jsonVersion": 1,
+		"descriptors": [
+			{
+				"slot": 0,
+				"id": 1,
+				"group": 1,
+				"datatype": "Def.FILE",
+				"name": "busybox.deffile",
+				"fileoff": 32768,
+				"filelen": 62,
+				"storelen": 62,
+				"ctime": 1534232759,
+				"mtime": 1534232759,
+				"uid": 1002,
+				"gid": 1002
+			},
+			{
+				"slot": 1,
+				"id": 2,
+				"group": 1,
+				"datatype": "FS",
+				"name": "busybox.squash",
+				"fileoff": 1048576,
+				"filelen": 704512,
+				"storelen": 1720258,
+				"ctime": 1534232759,
+				"mtime": 1534232759,
+				"uid": 1002,
+				"gid": 1002,
+				"partition": {"fstype": "Squashfs", "parttype": "*System", "arch": "amd64"}
+			},
+			{
+				"slot": 2,
+				"id": 3,
+				"group": 1,
+				"link": 2,
+				"datatype": "Signature",
+				"name": "part-signature",
+				"fileoff": 1753088,
+				"filelen": 955,
+				"storelen": 955,
+				"ctime": 1534232856,
+				"mtime": 1534232856,
+				"uid": 1002,
+				"gid": 1002,
+				"signature": {"hashtype": "SHA384", "entity": "9F2B6C36D999A3E91CB3104720671590C12D4222"}
+			}
+		]
+	}`)
+
+	b, err := fimg.DescriptorsJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != want {
+		t.Errorf("got descriptors:\n%s\nwant:\n%s", got, want)
+	}
+
+	// the document must decode into the exported types
+	var l DescriptorList
+	if err := json.Unmarshal(b, &l); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := l.Descriptors[2].Link, uint32(2); got != want {
+		t.Errorf("got link %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// ExtentKind represents the contents of a region of a SIF file.
+type ExtentKind int
+
+// List of extent kinds.
+const (
+	ExtentHeader      ExtentKind = iota // global header
+	ExtentDescriptors                   // descriptor table, including free descriptors
+	ExtentObject                        // data object
+	ExtentFree                          // space not used by any of the above
+)
+
+// String returns a string representation of the extent kind.
+func (k ExtentKind) String() string {
+	switch k {
+	case ExtentHeader:
+		return "Header"
+	case ExtentDescriptors:
+		return "Descriptors"
+	case ExtentObject:
+		return "Object"
+	case ExtentFree:
+		return "Free"
+	}
+	return "Unknown extent-kind"
+}
+
+// Extent describes a region of a SIF file.
+type Extent struct {
+	Kind   ExtentKind // contents of the region
+	Offset int64      // offset of the region from the start of the file
+	Size   int64      // size of the region in bytes
+	ID     uint32     // ID of the data object, if Kind is ExtentObject
+}
+
+// Layout returns the regions of the image, in ascending order of offset. The regions cover the
+// entire file, with space not used by the global header, descriptor table or a data object, such
+// as alignment padding or space left by deleted data objects, reported as ExtentFree.
+func (fimg *FileImage) Layout() []Extent {
+	used := []Extent{
+		{Kind: ExtentHeader, Offset: 0, Size: int64(binary.Size(fimg.Header))},
+		{
+			Kind:   ExtentDescriptors,
+			Offset: fimg.Header.Descroff,
+			Size:   fimg.Header.Dtotal * int64(binary.Size(Descriptor{})),
+		},
+	}
+	for _, d := range fimg.DescrArr {
+		if d.Used {
+			used = append(used, Extent{Kind: ExtentObject, Offset: d.Fileoff, Size: d.Filelen, ID: d.ID})
+		}
+	}
+	sort.SliceStable(used, func(i, j int) bool { return used[i].Offset < used[j].Offset })
+
+	var layout []Extent
+	var end int64
+	free := func(off int64) {
+		if off > end {
+			layout = append(layout, Extent{Kind: ExtentFree, Offset: end, Size: off - end})
+			end = off
+		}
+	}
+
+	for _, e := range used {
+		free(e.Offset)
+		layout = append(layout, e)
+		if e.Offset+e.Size > end {
+			end = e.Offset + e.Size
+		}
+	}
+	free(fimg.Filesize)
+
+	return layout
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-layout-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     5,
+		Fname:    "generic",
+		Data:     []byte("data\n"),
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{input, input},
+		DescrCount: 2,
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	page := int64(os.Getpagesize())
+	want := []Extent{
+		{Kind: ExtentHeader, Offset: 0, Size: 128},
+		{Kind: ExtentFree, Offset: 128, Size: DescrStartOffset - 128},
+		{Kind: ExtentDescriptors, Offset: DescrStartOffset, Size: 2 * 585},
+		{Kind: ExtentFree, Offset: DescrStartOffset + 2*585, Size: DataStartOffset - DescrStartOffset - 2*585},
+		{Kind: ExtentObject, Offset: DataStartOffset, Size: 5, ID: 1},
+		{Kind: ExtentFree, Offset: DataStartOffset + 5, Size: page - 5},
+		{Kind: ExtentObject, Offset: DataStartOffset + page, Size: 5, ID: 2},
+	}
+
+	if got := fimg.Layout(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got layout %+v, want %+v", got, want)
+	}
+}
+
+func TestLayoutCoversFile(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	var end int64
+	objects := 0
+	for _, e := range fimg.Layout() {
+		if e.Offset != end {
+			t.Errorf("%v extent at offset %d, want %d", e.Kind, e.Offset, end)
+		}
+		if e.Size <= 0 {
+			t.Errorf("%v extent at offset %d has size %d", e.Kind, e.Offset, e.Size)
+		}
+		if e.Kind == ExtentObject {
+			objects++
+		}
+		end = e.Offset + e.Size
+	}
+
+	if got, want := end, fimg.Filesize; got != want {
+		t.Errorf("got end %d, want %d", got, want)
+	}
+	if got, want := objects, 3; got != want {
+		t.Errorf("got %d objects, want %d", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The links between data objects form a directed graph. A data object whose Link references an
+// object, such as a signature covering a single object, has an edge to that object. A data object
+// whose Link references an object group has an edge to each member of the group.
+
+// ErrLinkCycle is returned when the links between data objects form a cycle.
+var ErrLinkCycle = errors.New("descriptor links form a cycle")
+
+// linkGraph holds the edges between the used descriptors of an image, by descriptor index.
+type linkGraph struct {
+	fimg *FileImage
+	out  map[int][]int // indexes of the descriptors each descriptor links to
+	in   map[int][]int // indexes of the descriptors linking to each descriptor
+	byID map[uint32]int
+}
+
+// newLinkGraph returns the link graph of the used descriptors of fimg.
+func newLinkGraph(fimg *FileImage) *linkGraph {
+	g := &linkGraph{
+		fimg: fimg,
+		out:  make(map[int][]int),
+		in:   make(map[int][]int),
+		byID: make(map[uint32]int),
+	}
+
+	groups := make(map[uint32][]int)
+	for i, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+		if _, ok := g.byID[d.ID]; !ok {
+			g.byID[d.ID] = i
+		}
+		if d.Groupid != DescrUnusedGroup {
+			groups[d.Groupid] = append(groups[d.Groupid], i)
+		}
+	}
+
+	for i, d := range fimg.DescrArr {
+		if !d.Used || d.Link == DescrUnusedLink {
+			continue
+		}
+
+		var targets []int
+		if d.Link&DescrGroupMask != 0 {
+			targets = groups[d.Link]
+		} else if j, ok := g.byID[d.Link]; ok {
+			targets = []int{j}
+		}
+
+		for _, j := range targets {
+			g.out[i] = append(g.out[i], j)
+			g.in[j] = append(g.in[j], i)
+		}
+	}
+
+	return g
+}
+
+// walk returns the descriptors reachable from the descriptor at index i by following edges,
+// along with their indexes, in breadth-first order. The descriptor at index i is not included,
+// unless it is part of a cycle.
+func (g *linkGraph) walk(i int, edges map[int][]int) ([]*Descriptor, []int) {
+	var descrs []*Descriptor
+	var indexes []int
+
+	seen := make(map[int]bool)
+	queue := edges[i]
+	for len(queue) > 0 {
+		j := queue[0]
+		queue = queue[1:]
+
+		if seen[j] {
+			continue
+		}
+		seen[j] = true
+
+		indexes = append(indexes, j)
+		descrs = append(descrs, &g.fimg.DescrArr[j])
+		queue = append(queue, edges[j]...)
+	}
+
+	return descrs, indexes
+}
+
+// cycle returns the IDs of the data objects forming a cycle in g, in link order, or nil if the
+// graph contains no cycle.
+func (g *linkGraph) cycle() []uint32 {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[int]int)
+
+	var path []int
+	var found []int
+
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		state[i] = visiting
+		path = append(path, i)
+
+		for _, j := range g.out[i] {
+			switch state[j] {
+			case visiting:
+				for k := range path {
+					if path[k] == j {
+						found = path[k:]
+						return true
+					}
+				}
+			case unvisited:
+				if visit(j) {
+					return true
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[i] = visited
+		return false
+	}
+
+	for i, d := range g.fimg.DescrArr {
+		if d.Used && state[i] == unvisited && visit(i) {
+			ids := make([]uint32, 0, len(found))
+			for _, j := range found {
+				ids = append(ids, g.fimg.DescrArr[j].ID)
+			}
+			return ids
+		}
+	}
+	return nil
+}
+
+// GetLinkedDescrsByID searches for the descriptors that the descriptor with the specified id links
+// to, directly or by way of other descriptors. A link to an object group reaches each member of
+// the group. Descriptors are returned in breadth-first order, each at most once.
+func (fimg *FileImage) GetLinkedDescrsByID(id uint32) ([]*Descriptor, []int, error) {
+	_, i, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g := newLinkGraph(fimg)
+	descrs, indexes := g.walk(i, g.out)
+	if len(descrs) == 0 {
+		return nil, nil, ErrNotFound
+	}
+
+	return descrs, indexes, nil
+}
+
+// GetDescrsLinkingTo searches for the descriptors that link to the descriptor with the specified
+// id, directly or by way of other descriptors. A link to an object group reaches each member of
+// the group. Descriptors are returned in breadth-first order, each at most once.
+func (fimg *FileImage) GetDescrsLinkingTo(id uint32) ([]*Descriptor, []int, error) {
+	_, i, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g := newLinkGraph(fimg)
+	descrs, indexes := g.walk(i, g.in)
+	if len(descrs) == 0 {
+		return nil, nil, ErrNotFound
+	}
+
+	return descrs, indexes, nil
+}
+
+// CheckLinkCycles returns an error wrapping ErrLinkCycle if the links between the data objects of
+// fimg form a cycle. The error identifies the objects forming the cycle.
+func (fimg *FileImage) CheckLinkCycles() error {
+	if ids := newLinkGraph(fimg).cycle(); ids != nil {
+		return fmt.Errorf("%w: objects %v", ErrLinkCycle, ids)
+	}
+	return nil
+}
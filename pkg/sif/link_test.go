@@ -0,0 +1,136 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// createLinkImage creates an image at dir/name holding a partition and a definition file linked to
+// it in group 1, a signature linked to group 1, and a countersignature linked to the signature.
+func createLinkImage(t *testing.T, dir, name string) string {
+	return createTestImage(t, filepath.Join(dir, name),
+		testPartInput(t),
+		testDeffileInput(1),
+		testSigInput(t, DescrDefaultGroup, "signature"),
+		testSigInput(t, 3, "countersig"),
+	)
+}
+
+func TestGetLinkedDescrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-link-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fimg, err := LoadContainer(createLinkImage(t, dir, "link.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	tests := []struct {
+		name    string
+		fn      func(id uint32) ([]*Descriptor, []int, error)
+		id      uint32
+		wantErr error
+		wantIDs []uint32
+	}{
+		{"LinkedCountersig", fimg.GetLinkedDescrsByID, 4, nil, []uint32{3, 1, 2}},
+		{"LinkedSignature", fimg.GetLinkedDescrsByID, 3, nil, []uint32{1, 2}},
+		{"LinkedDeffile", fimg.GetLinkedDescrsByID, 2, nil, []uint32{1}},
+		{"LinkedNone", fimg.GetLinkedDescrsByID, 1, ErrNotFound, nil},
+		{"LinkedMissing", fimg.GetLinkedDescrsByID, 9, ErrNotFound, nil},
+		{"LinkingPartition", fimg.GetDescrsLinkingTo, 1, nil, []uint32{2, 3, 4}},
+		{"LinkingDeffile", fimg.GetDescrsLinkingTo, 2, nil, []uint32{3, 4}},
+		{"LinkingNone", fimg.GetDescrsLinkingTo, 4, ErrNotFound, nil},
+		{"LinkingMissing", fimg.GetDescrsLinkingTo, 9, ErrNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			descrs, indexes, err := tt.fn(tt.id)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			var ids []uint32
+			for i, d := range descrs {
+				ids = append(ids, d.ID)
+
+				if got, want := d, &fimg.DescrArr[indexes[i]]; got != want {
+					t.Errorf("descriptor %v: index %v does not match", d.ID, indexes[i])
+				}
+			}
+			if got, want := ids, tt.wantIDs; !reflect.DeepEqual(got, want) {
+				t.Errorf("got IDs %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckLinkCycles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-link-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		corrupt func(fimg *FileImage)
+		wantErr error
+		wantIDs []uint32
+	}{
+		{
+			name:    "OK",
+			corrupt: func(fimg *FileImage) {},
+		},
+		{
+			name:    "Cycle",
+			corrupt: func(fimg *FileImage) { fimg.DescrArr[0].Link = 4 },
+			wantErr: ErrLinkCycle,
+			wantIDs: []uint32{1, 4, 3},
+		},
+		{
+			name:    "OwnGroup",
+			corrupt: func(fimg *FileImage) { fimg.DescrArr[1].Link = DescrDefaultGroup },
+			wantErr: ErrLinkCycle,
+			wantIDs: []uint32{2},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fimg, err := LoadContainer(createLinkImage(t, dir, tt.name+".sif"), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			tt.corrupt(&fimg)
+
+			if got, want := fimg.CheckLinkCycles(), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if got, want := newLinkGraph(&fimg).cycle(), tt.wantIDs; !reflect.DeepEqual(got, want) {
+				t.Errorf("got cycle %v, want %v", got, want)
+			}
+
+			if got, want := Validate(&fimg).Err(), tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("got validation error %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ package sif
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -34,6 +35,17 @@ func readDescriptors(fimg *FileImage) error {
 		return fmt.Errorf("seek() setting to descriptors start: %s", err)
 	}
 
+	// check the size of the table before allocating it, as the count may be corrupt
+	n, err := descrTableLen(fimg.Header.Dtotal)
+	if err != nil {
+		return fmt.Errorf("descriptor table: %w", err)
+	}
+	if end, err := addSize(fimg.Header.Descroff, n); err != nil {
+		return fmt.Errorf("descriptor table: %w", err)
+	} else if size := fimg.Reader.Size(); end > size {
+		return fmt.Errorf("%w: descriptor table ends at %d, beyond end of image at %d", errSectionBounds, end, size)
+	}
+
 	// Initialize descriptor array (slice) and read them all from file
 	fimg.DescrArr = make([]Descriptor, fimg.Header.Dtotal)
 	if err := binary.Read(fimg.Reader, binary.LittleEndian, &fimg.DescrArr); err != nil {
@@ -41,23 +53,29 @@ func readDescriptors(fimg *FileImage) error {
 		return fmt.Errorf("reading descriptor array from container file: %s", err)
 	}
 
-	descr, _, err := fimg.GetPartPrimSys()
-	if err == nil {
-		fimg.PrimPartID = descr.ID
+	if err := checkExtents(fimg); err != nil {
+		fimg.DescrArr = nil
+		return err
 	}
 
+	fimg.setPrimPartID()
+
 	return nil
 }
 
 // Look at key fields from the global header to assess SIF validity.
 // `runnable' checks is current container can run on host.
 func isValidSif(fimg *FileImage) error {
-	// check various header fields
-	if trimZeroBytes(fimg.Header.Magic[:]) != HdrMagic {
-		return fmt.Errorf("invalid SIF file: Magic |%s| want |%s|", trimZeroBytes(fimg.Header.Magic[:]), HdrMagic)
+	return isValidHeader(&fimg.Header)
+}
+
+// Check the magic and version fields of a global header.
+func isValidHeader(h *Header) error {
+	if h.GetMagic() != HdrMagic {
+		return fmt.Errorf("invalid SIF file: Magic |%s| want |%s|", h.GetMagic(), HdrMagic)
 	}
-	if trimZeroBytes(fimg.Header.Version[:]) > HdrVersion {
-		return fmt.Errorf("invalid SIF file: Version %s want <= %s", trimZeroBytes(fimg.Header.Version[:]), HdrVersion)
+	if h.GetVersion() > HdrVersionMax {
+		return fmt.Errorf("invalid SIF file: Version %s want <= %s", h.GetVersion(), HdrVersionMax)
 	}
 
 	return nil
@@ -87,6 +105,11 @@ func (fimg *FileImage) mapFile(rdonly bool) error {
 
 	fimg.Filedata = nil
 
+	// only a single regular file can be memory mapped
+	if _, ok := fimg.Fp.(*os.File); !ok {
+		fimg.Amodebuf = true
+	}
+
 	if !fimg.Amodebuf {
 		prot := syscall.PROT_READ
 		flags := syscall.MAP_PRIVATE
@@ -110,7 +133,7 @@ func (fimg *FileImage) mapFile(rdonly bool) error {
 	}
 
 	if fimg.Filedata == nil {
-		fimg.Filedata = make([]byte, DataStartOffset)
+		fimg.Filedata = make([]byte, fimg.topOfFileLen())
 
 		// start by positioning us to the start of the file
 		_, err := fimg.Fp.Seek(0, io.SeekStart)
@@ -118,7 +141,7 @@ func (fimg *FileImage) mapFile(rdonly bool) error {
 			return fmt.Errorf("seek() setting to start of file: %s", err)
 		}
 
-		if n, err := fimg.Fp.Read(fimg.Filedata); n != DataStartOffset {
+		if _, err := io.ReadFull(fimg.Fp, fimg.Filedata); err != nil {
 			return fmt.Errorf("short read while reading top of file: %v", err)
 		}
 	}
@@ -129,6 +152,28 @@ func (fimg *FileImage) mapFile(rdonly bool) error {
 	return nil
 }
 
+// topOfFileLen returns the number of bytes to buffer from the top of the file when it cannot be
+// memory mapped. This covers the global header and descriptor table, the size of which may differ
+// from the default when the image was created with a custom descriptor count.
+func (fimg *FileImage) topOfFileLen() int64 {
+	n := int64(DataStartOffset)
+
+	var h Header
+	sr := io.NewSectionReader(fimg.Fp, 0, int64(binary.Size(h)))
+	if err := binary.Read(sr, binary.LittleEndian, &h); err == nil {
+		if tlen, err := descrTableLen(h.Dtotal); err == nil {
+			if end, err := addSize(h.Descroff, tlen); err == nil && end > n && end <= fimg.Filesize {
+				n = end
+			}
+		}
+	}
+
+	if n > fimg.Filesize {
+		n = fimg.Filesize
+	}
+	return n
+}
+
 func (fimg *FileImage) unmapFile() error {
 	if fimg.Amodebuf {
 		return nil
@@ -141,19 +186,25 @@ func (fimg *FileImage) unmapFile() error {
 
 // LoadContainer is responsible for loading a SIF container file. It takes
 // the container file name, and whether the file is opened as read-only
-// as arguments.
-func LoadContainer(filename string, rdonly bool) (FileImage, error) {
+// as arguments. Images striped across companion files (see CreateInfo)
+// are reassembled transparently, as described by the stripe map recorded
+// in the main file. Loading may be further configured with opts.
+func LoadContainer(filename string, rdonly bool, opts ...LoadOpt) (FileImage, error) {
 	mode := os.O_RDWR // open SIF read-write when adding and removing data objects
 	if rdonly {
 		mode = os.O_RDONLY // open SIF rdonly if mounting immutable partitions or inspecting the image
 	}
 
+	var f ReadWriter
 	f, err := os.OpenFile(filename, mode, 0)
+	if err == nil {
+		f, err = openStripedIfRecorded(f.(*os.File), mode)
+	}
 	if err != nil {
-		return FileImage{}, fmt.Errorf("opening(%s) container file: %v", modeToStr(mode), err)
+		return FileImage{}, fmt.Errorf("opening(%s) container file: %w", modeToStr(mode), err)
 	}
 
-	fimg, err := LoadContainerFp(f, rdonly)
+	fimg, err := LoadContainerFp(f, rdonly, opts...)
 	if err != nil {
 		_ = f.Close()
 		return FileImage{}, err
@@ -164,22 +215,59 @@ func LoadContainer(filename string, rdonly bool) (FileImage, error) {
 
 // LoadContainerFp is responsible for loading a SIF container file. It takes
 // a ReadWriter pointing to an opened file, and whether the file is opened as
-// read-only for arguments.
-func LoadContainerFp(fp ReadWriter, rdonly bool) (fimg FileImage, err error) {
+// read-only for arguments. Loading may be further configured with opts.
+func LoadContainerFp(fp ReadWriter, rdonly bool, opts ...LoadOpt) (fimg FileImage, err error) {
 	if fp == nil {
 		return fimg, fmt.Errorf("provided fp for file is invalid")
 	}
+
+	lo, err := getLoadOpts(opts)
+	if err != nil {
+		return fimg, err
+	}
 	fimg.Fp = fp
+	fimg.limiter = lo.limiter
+	fimg.signalGuard = lo.signalGuard
+	fimg.clock = lo.clock
+	fimg.bufferSize = lo.bufferSize
+	fimg.maxDecompressed = lo.maxDecompressedSize
+
+	// lock the file before reading it, so that descriptors are not modified while loaded
+	if lo.lock {
+		if err = fimg.lock(rdonly); err != nil {
+			return
+		}
+	}
 
 	defer func() {
 		if err != nil {
 			if err := fimg.unmapFile(); err != nil {
 				log.Printf("could not unmap SIF: %v", err)
 			}
+			if err := fimg.unlock(); err != nil {
+				log.Printf("could not unlock SIF: %v", err)
+			}
 		}
 	}()
 
-	// get a memory map of the SIF file
+	// complete a transaction interrupted while writing the descriptor table and global header
+	if err = recoverJournal(fp, rdonly, lo.recoverJournal); err != nil {
+		return
+	}
+
+	// open any stripes added by the transaction, so that the image is sized correctly
+	if sf, ok := fp.(*stripedFile); ok {
+		var sm stripeMap
+		if sm, err = readStripeMap(sf); err != nil {
+			return
+		}
+		if err = sf.openStripes(sm); err != nil {
+			return
+		}
+	}
+
+	// get a memory map of the SIF file, unless buffered I/O was requested
+	fimg.Amodebuf = lo.buffered
 	if err = fimg.mapFile(rdonly); err != nil {
 		return
 	}
@@ -194,19 +282,46 @@ func LoadContainerFp(fp ReadWriter, rdonly bool) (fimg FileImage, err error) {
 		return
 	}
 
+	// validate header checksums, if present
+	ext, err := checkHeaderExt(fimg.Reader, &fimg.Header)
+	if err != nil {
+		return
+	}
+	fimg.flags = ext.flags
+
 	// read descriptor array from SIF file
 	if err = readDescriptors(&fimg); err != nil {
 		return
 	}
 
+	// validate descriptor table checksum, if present
+	if err = fimg.loadDescrCRC(ext, lo.ignoreDescrCRC); err != nil {
+		return
+	}
+
+	// reject unknown types, if requested
+	if lo.strict {
+		if err = fimg.checkStrict(); err != nil {
+			return
+		}
+	}
+
 	return fimg, nil
 }
 
 // LoadContainerReader is responsible for processing SIF data from a byte stream
 // and extract various components like the global header, descriptors and even
-// perhaps data, depending on how much is read from the source.
-func LoadContainerReader(b *bytes.Reader) (fimg FileImage, err error) {
+// perhaps data, depending on how much is read from the source. Loading may
+// be further configured with opts.
+func LoadContainerReader(b *bytes.Reader, opts ...LoadOpt) (fimg FileImage, err error) {
+	lo, err := getLoadOpts(opts)
+	if err != nil {
+		return fimg, err
+	}
+
 	fimg.Reader = b
+	fimg.limiter = lo.limiter
+	fimg.maxDecompressed = lo.maxDecompressedSize
 
 	// read global header from SIF file
 	if err = readHeader(&fimg); err != nil {
@@ -218,10 +333,28 @@ func LoadContainerReader(b *bytes.Reader) (fimg FileImage, err error) {
 		return
 	}
 
+	// validate header checksums, if present
+	ext, err := checkHeaderExt(fimg.Reader, &fimg.Header)
+	if err != nil {
+		return
+	}
+	fimg.flags = ext.flags
+
 	// in the case where the reader buffer doesn't include descriptor data, we
-	// don't return an error and DescrArr will be set to nil
+	// don't return an error and DescrArr will be set to nil, but corrupt sizes
+	// are rejected, as is a descriptor table that does not match its checksum
 	if readErr := readDescriptors(&fimg); readErr != nil {
+		if errors.Is(readErr, ErrSizeOverflow) || errors.Is(readErr, errDescrCountInvalid) {
+			return fimg, readErr
+		}
 		fmt.Println("Error reading descriptors: ", readErr)
+	} else if err = fimg.loadDescrCRC(ext, lo.ignoreDescrCRC); err != nil {
+		return
+	}
+
+	// reject unknown types, if requested
+	if lo.strict {
+		err = fimg.checkStrict()
 	}
 
 	return fimg, err
@@ -234,6 +367,9 @@ func (fimg *FileImage) UnloadContainer() (err error) {
 		if err = fimg.unmapFile(); err != nil {
 			return
 		}
+		if err = fimg.unlock(); err != nil {
+			return
+		}
 		if err = fimg.Fp.Close(); err != nil {
 			return fmt.Errorf("closing SIF file failed, corrupted: don't use: %s", err)
 		}
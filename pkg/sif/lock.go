@@ -0,0 +1,73 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// ErrLocked is the error returned when an image cannot be loaded with OptLoadLock, because a
+// conflicting lock is held on the image.
+var ErrLocked = errors.New("image locked")
+
+var errLockUnsupported = errors.New("locking not supported")
+
+// OptLoadLock specifies whether an advisory lock is held on the image file while it is loaded. An
+// image loaded read-only takes a shared lock, and an image loaded read-write takes an exclusive
+// lock. Any number of read-only loads may therefore overlap, such as verifying an image while it
+// is mounted, while a read-write load is refused as long as the image is loaded elsewhere, and
+// vice versa. Locks are taken without waiting: if a conflicting lock is held, loading fails with
+// an error wrapping ErrLocked.
+//
+// The lock is taken before the global header and descriptor table are read, so the descriptors
+// of an image loaded read-only cannot be modified by a cooperating process until it is unloaded.
+// Locks are advisory, and only exclude processes that take them, such as runtimes that lock images
+// they mount. Locking requires an image backed by a file.
+func OptLoadLock(b bool) LoadOpt {
+	return func(lo *loadOpts) error {
+		lo.lock = b
+		return nil
+	}
+}
+
+// lock takes a shared lock on the file backing fimg if rdonly is true, or an exclusive lock
+// otherwise.
+func (fimg *FileImage) lock(rdonly bool) error {
+	fd := fimg.Fp.Fd()
+	if fd == ^uintptr(0) {
+		return fmt.Errorf("%w: %s", errLockUnsupported, fimg.Fp.Name())
+	}
+
+	how := syscall.LOCK_EX
+	if rdonly {
+		how = syscall.LOCK_SH
+	}
+
+	if err := syscall.Flock(int(fd), how|syscall.LOCK_NB); errors.Is(err, syscall.EWOULDBLOCK) {
+		return fmt.Errorf("%w: %s", ErrLocked, fimg.Fp.Name())
+	} else if err != nil {
+		return fmt.Errorf("locking %s: %s", fimg.Fp.Name(), err)
+	}
+
+	fimg.locked = true
+	return nil
+}
+
+// unlock releases the lock held on the file backing fimg, if any.
+func (fimg *FileImage) unlock() error {
+	if !fimg.locked {
+		return nil
+	}
+
+	if err := syscall.Flock(int(fimg.Fp.Fd()), syscall.LOCK_UN); err != nil {
+		return fmt.Errorf("unlocking %s: %s", fimg.Fp.Name(), err)
+	}
+
+	fimg.locked = false
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestOptLoadLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-lock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		heldRdonly bool // whether the image already loaded is read-only
+		heldLock   bool // whether the image already loaded is locked
+		rdonly     bool
+		wantErr    error
+	}{
+		{name: "SharedShared", heldRdonly: true, heldLock: true, rdonly: true},
+		{name: "SharedExclusive", heldRdonly: true, heldLock: true, rdonly: false, wantErr: ErrLocked},
+		{name: "ExclusiveShared", heldRdonly: false, heldLock: true, rdonly: true, wantErr: ErrLocked},
+		{name: "ExclusiveExclusive", heldRdonly: false, heldLock: true, rdonly: false, wantErr: ErrLocked},
+		{name: "Unlocked", heldRdonly: false, heldLock: false, rdonly: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			held, err := LoadContainer(cinfo.Pathname, tt.heldRdonly, OptLoadLock(tt.heldLock))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, tt.rdonly, OptLoadLock(true))
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err == nil {
+				if err := fimg.UnloadContainer(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// once the held image is unloaded, its lock no longer conflicts
+			if err := held.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+			fimg, err = LoadContainer(cinfo.Pathname, tt.rdonly, OptLoadLock(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestOptLoadLockUnsupported(t *testing.T) {
+	f, err := os.Open("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadContainerReaderAt(f, fi.Size(), OptLoadLock(true)); !errors.Is(err, errLockUnsupported) {
+		t.Errorf("got error %v, want %v", err, errLockUnsupported)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build linux
+// +build linux
+
+package sif
+
+import "syscall"
+
+// madvDontDump excludes memory from core dumps. Its value is shared by all architectures.
+const madvDontDump = 0x10
+
+// allocLocked returns a buffer of n bytes, mapped separately from the Go heap so that it is not
+// copied by the garbage collector, excluded from core dumps, and locked into memory if permitted.
+// The buffer must be released with freeLocked.
+func allocLocked(n int) ([]byte, bool, error) {
+	if n == 0 {
+		return []byte{}, false, nil
+	}
+
+	b, err := syscall.Mmap(-1, 0, n, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, false, err
+	}
+	syscall.Madvise(b, madvDontDump) // nolint:errcheck
+
+	// Locking fails if the limit on locked memory of the process would be exceeded.
+	locked := syscall.Mlock(b) == nil
+	return b, locked, nil
+}
+
+// freeLocked releases the buffer b returned by allocLocked.
+func freeLocked(b []byte, locked bool) error {
+	if len(b) == 0 {
+		return nil
+	}
+	if locked {
+		syscall.Munlock(b) // nolint:errcheck
+	}
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build !linux
+// +build !linux
+
+package sif
+
+// allocLocked returns a buffer of n bytes. Memory locking is not supported on this platform, so
+// the buffer is not locked.
+func allocLocked(n int) ([]byte, bool, error) {
+	return make([]byte, n), false, nil
+}
+
+// freeLocked releases the buffer b returned by allocLocked.
+func freeLocked(b []byte, locked bool) error {
+	return nil
+}
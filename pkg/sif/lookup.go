@@ -38,6 +38,7 @@ func GetSIFArch(goarch string) (sifarch string) {
 		"mips64":   HdrArchMIPS64,
 		"mips64le": HdrArchMIPS64le,
 		"s390x":    HdrArchS390x,
+		"multi":    HdrArchMulti,
 	}
 
 	if sifarch, ok = archMap[goarch]; !ok {
@@ -62,6 +63,7 @@ func GetGoArch(sifarch string) (goarch string) {
 		HdrArchMIPS64:   "mips64",
 		HdrArchMIPS64le: "mips64le",
 		HdrArchS390x:    "s390x",
+		HdrArchMulti:    "multi",
 	}
 
 	if goarch, ok = archMap[sifarch]; !ok {
@@ -252,9 +254,28 @@ func (fimg *FileImage) GetFromDescr(descr Descriptor) ([]*Descriptor, []int, err
 	return descrs, indexes, nil
 }
 
-// GetData return a memory mapped byte slice mirroring the data object in a SIF file.
+// GetData return a memory mapped byte slice mirroring the data object in a SIF file. If the data
+// object is compressed, a slice holding the decompressed data is returned instead, provided its
+// size is within the limit set by OptLoadMaxDecompressedSize. The data of a
+// thin image is not held in the file, so nil is returned.
 func (d *Descriptor) GetData(fimg *FileImage) []byte {
+	if d.isThin(fimg) {
+		return nil
+	}
+
+	if d.GetCompression() != CompressionNone {
+		b, err := d.decompress(fimg)
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+
 	if fimg.Amodebuf {
+		if d.Filelen < 0 || int64(int(d.Filelen)) != d.Filelen {
+			return nil
+		}
+
 		data := make([]byte, d.Filelen)
 		if _, err := io.ReadFull(d.GetReadSeeker(fimg), data); err != nil {
 			return nil
@@ -262,7 +283,7 @@ func (d *Descriptor) GetData(fimg *FileImage) []byte {
 		return data
 	}
 
-	if d.Fileoff+d.Filelen > int64(len(fimg.Filedata)) {
+	if !d.inMapping(fimg) {
 		// there's not enough data in the file to account for the indicated
 		// payload. Is the header corrupted?
 		return nil
@@ -272,12 +293,63 @@ func (d *Descriptor) GetData(fimg *FileImage) []byte {
 }
 
 // GetReadSeeker returns a io.ReadSeeker that reads the data object associated with descriptor d
-// from image fimg.
+// from image fimg. If the data object is compressed, the data is read as stored. The data of a
+// thin image is not held in the file, so reads fail with an error wrapping ErrThin.
 func (d *Descriptor) GetReadSeeker(fimg *FileImage) io.ReadSeeker {
+	if d.isThin(fimg) {
+		return io.NewSectionReader(errReaderAt{ErrThin}, 0, d.Filelen)
+	}
+	return d.readSeeker(fimg)
+}
+
+// readSeeker returns an io.ReadSeeker that reads the data object associated with descriptor d
+// from fimg, whether or not fimg is thin.
+func (d *Descriptor) readSeeker(fimg *FileImage) io.ReadSeeker {
 	if fimg.Amodebuf {
-		return io.NewSectionReader(fimg.Fp, d.Fileoff, d.Filelen)
+		return fimg.limitReadSeeker(io.NewSectionReader(fimg.Fp, d.Fileoff, d.Filelen))
 	}
-	return io.NewSectionReader(fimg.Reader, d.Fileoff, d.Filelen)
+	return fimg.limitReadSeeker(io.NewSectionReader(fimg.Reader, d.Fileoff, d.Filelen))
+}
+
+// GetObjectReadSeeker returns an io.ReadSeeker that reads the data object associated with
+// descriptor d, as stored in fimg. Unlike GetReader, the data of compressed objects is not
+// decompressed.
+func (fimg *FileImage) GetObjectReadSeeker(d Descriptor) io.ReadSeeker {
+	return d.GetReadSeeker(fimg)
+}
+
+// GetReader returns an io.SectionReader that reads the data object associated with descriptor d
+// from the underlying file of fimg. The reader is bounded by the extent of the object, and does not
+// depend on fimg being memory mapped. As it implements io.ReaderAt, the reader may be shared by
+// goroutines reading different parts of the object.
+//
+// If the data object is compressed, the reader reads the decompressed data, decompressing it as it
+// is read rather than into memory. Reading sequentially is efficient, while reading an earlier
+// offset restarts decompression from the beginning of the object. The data of a thin image is not
+// held in the file, so reads fail with an error wrapping ErrThin.
+func (d *Descriptor) GetReader(fimg *FileImage) *io.SectionReader {
+	if d.isThin(fimg) {
+		return io.NewSectionReader(errReaderAt{ErrThin}, 0, d.Filelen)
+	}
+	if d.GetCompression() != CompressionNone {
+		if size := d.GetSize(); size < 0 {
+			return io.NewSectionReader(errReaderAt{errDecompressedTooLarge}, 0, 0)
+		}
+		return io.NewSectionReader(d.newDecompressReaderAt(fimg), 0, d.GetSize())
+	}
+	return io.NewSectionReader(fimg.limitReaderAt(fimg.Fp), d.Fileoff, d.Filelen)
+}
+
+// Extent returns the offset and length, in bytes, of the data object associated with descriptor
+// d. The extent may be used to access object data directly from the underlying file, such as by
+// serving it with sendfile, without reading it through this package.
+//
+// While an image is loaded read-only, the extent of an object does not change. Images loaded
+// read-write may be modified, such as by DeleteObject with DelCompact, and callers must not rely
+// on extents obtained prior to modification. For striped images, the offset is relative to the
+// start of the image as a whole, rather than to any one file.
+func (d *Descriptor) Extent() (offset, length int64) {
+	return d.Fileoff, d.Filelen
 }
 
 // GetName returns the name tag associated with the descriptor. Analogous to file name.
@@ -400,6 +472,21 @@ func (d *Descriptor) GetMessageType() (Messagetype, error) {
 	return cinfo.Messagetype, nil
 }
 
+// GetSBOMFormat extracts the SBOMFormat field from the Extra field of a Software Bill of Materials Descriptor.
+func (d *Descriptor) GetSBOMFormat() (SBOMFormat, error) {
+	if d.Datatype != DataSBOM {
+		return -1, fmt.Errorf("expected DataSBOM, got %v", d.Datatype)
+	}
+
+	var sinfo SBOM
+	b := bytes.NewReader(d.Extra[:])
+	if err := binary.Read(b, binary.LittleEndian, &sinfo); err != nil {
+		return -1, fmt.Errorf("while extracting SBOM extra info: %s", err)
+	}
+
+	return sinfo.Format, nil
+}
+
 // GetPartPrimSys returns the primary system partition if present. There should
 // be only one primary system partition in a SIF file.
 func (fimg *FileImage) GetPartPrimSys() (*Descriptor, int, error) {
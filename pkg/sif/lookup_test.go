@@ -7,9 +7,13 @@ package sif
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
+
+	uuid "github.com/satori/go.uuid"
 )
 
 func TestGetHeader(t *testing.T) {
@@ -366,6 +370,103 @@ func TestGetReadSeeker(t *testing.T) {
 	}
 }
 
+func TestGetObjectReadSeeker(t *testing.T) {
+	fimg, err := LoadContainer(filepath.Join("testdata", "testcontainer2.sif"), true)
+	if err != nil {
+		t.Fatalf("failed to load container: %v", err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, err := fimg.GetDescriptor(WithID(3))
+	if err != nil {
+		t.Fatalf("failed to get descriptor: %v", err)
+	}
+
+	b, err := ioutil.ReadAll(fimg.GetObjectReadSeeker(d))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if got, want := string(b[5:10]), "BEGIN"; got != want {
+		t.Errorf("got data %#v, want %#v", got, want)
+	}
+}
+
+func TestGetReader(t *testing.T) {
+	fimg, err := LoadContainer(filepath.Join("testdata", "testcontainer2.sif"), true)
+	if err != nil {
+		t.Fatalf("failed to load container: %v", err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	// Get the signature block
+	descr, _, err := fimg.GetFromDescrID(3)
+	if err != nil {
+		t.Fatalf("failed to get descriptor: %v", err)
+	}
+
+	r := descr.GetReader(&fimg)
+	if got, want := r.Size(), descr.Filelen; got != want {
+		t.Errorf("got size %v, want %v", got, want)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if got, want := b, descr.GetData(&fimg); !bytes.Equal(got, want) {
+		t.Errorf("got data %#v, want %#v", got, want)
+	}
+
+	// Reads beyond the extent of the object are bounded.
+	p := make([]byte, 8)
+	n, err := r.ReadAt(p, descr.Filelen-5)
+	if got, want := err, io.EOF; got != want {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+	if got, want := p[:n], b[len(b)-5:]; !bytes.Equal(got, want) {
+		t.Errorf("got data %#v, want %#v", got, want)
+	}
+}
+
+func TestExtent(t *testing.T) {
+	fimg, err := LoadContainer(filepath.Join("testdata", "testcontainer2.sif"), true)
+	if err != nil {
+		t.Fatalf("failed to load container: %v", err)
+	}
+	defer func() {
+		if err := fimg.UnloadContainer(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	f, err := os.Open(filepath.Join("testdata", "testcontainer2.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, id := range []uint32{1, 2, 3} {
+		descr, _, err := fimg.GetFromDescrID(id)
+		if err != nil {
+			t.Fatalf("failed to get descriptor: %v", err)
+		}
+
+		off, n := descr.Extent()
+		if got, want := n, descr.Filelen; got != want {
+			t.Errorf("got length %v, want %v", got, want)
+		}
+
+		// Data read directly from the file using the extent must match object data.
+		b := make([]byte, n)
+		if _, err := f.ReadAt(b, off); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if got, want := b, descr.GetData(&fimg); !bytes.Equal(got, want) {
+			t.Errorf("object %d: data read using extent does not match", id)
+		}
+	}
+}
+
 func TestGetName(t *testing.T) {
 	// load the test container
 	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
@@ -517,6 +618,93 @@ func TestGetHashType(t *testing.T) {
 	}
 }
 
+func TestGetSBOMFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-sbom-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sbom := func(t *testing.T, f SBOMFormat, data string) DescriptorInput {
+		di := DescriptorInput{
+			Datatype: DataSBOM,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     int64(len(data)),
+			Fname:    "sbom",
+			Data:     []byte(data),
+		}
+		if err := di.SetSBOMExtra(f); err != nil {
+			t.Fatal(err)
+		}
+		return di
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			sbom(t, SBOMFormatCycloneDXJSON, `{"bomFormat":"CycloneDX"}`),
+			sbom(t, SBOMFormatSPDXTagValue, "SPDXVersion: SPDX-2.2\n"),
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true, OptLoadStrict(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	tests := []struct {
+		id         uint32
+		wantFormat SBOMFormat
+		wantString string
+	}{
+		{1, SBOMFormatCycloneDXJSON, "CycloneDX-JSON"},
+		{2, SBOMFormatSPDXTagValue, "SPDX-TagValue"},
+	}
+
+	for _, tt := range tests {
+		d, _, err := fimg.GetFromDescrID(tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := d.GetSBOMFormat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := f, tt.wantFormat; got != want {
+			t.Errorf("object %v: got format %v, want %v", tt.id, got, want)
+		}
+		if got, want := f.String(), tt.wantString; got != want {
+			t.Errorf("object %v: got string %v, want %v", tt.id, got, want)
+		}
+		if _, err := d.CheckContent(&fimg); err != nil {
+			t.Errorf("object %v: %v", tt.id, err)
+		}
+	}
+
+	if got, want := len(fimg.GetDescriptors(WithDataType(DataSBOM))), 2; got != want {
+		t.Errorf("got %v SBOMs, want %v", got, want)
+	}
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic := *d
+	generic.Datatype = DataGeneric
+	if _, err := generic.GetSBOMFormat(); err == nil {
+		t.Error("unexpected success getting SBOM format of generic object")
+	}
+}
+
 func TestGetEntity(t *testing.T) {
 	expected := []byte{159, 43, 108, 54, 217, 153, 163, 233, 28, 179, 16, 71, 32, 103, 21, 144, 193, 45, 66, 34}
 
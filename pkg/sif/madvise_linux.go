@@ -0,0 +1,16 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build linux
+// +build linux
+
+package sif
+
+import "syscall"
+
+// madvise advises the kernel how the memory b will be accessed.
+func madvise(b []byte, advice int) error {
+	return syscall.Madvise(b, advice)
+}
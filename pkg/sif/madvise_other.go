@@ -0,0 +1,15 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build !linux
+// +build !linux
+
+package sif
+
+// madvise does nothing, as advice is only a hint, and the standard library does not support
+// madvise(2) on this platform.
+func madvise(b []byte, advice int) error {
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+// MediaTypeSIF is the media type of a complete SIF image, suitable for use
+// in Content-Type headers and OCI descriptors.
+const MediaTypeSIF = "application/vnd.sylabs.sif.layer.v1.sif"
+
+// mediaTypeObjectPrefix is the common prefix of data object media types.
+const mediaTypeObjectPrefix = "application/vnd.sylabs.sif.object."
+
+// MediaType returns the media type of data objects of type d. Objects of
+// unknown type are described as "application/octet-stream".
+func (d Datatype) MediaType() string {
+	switch d {
+	case DataDeffile:
+		return mediaTypeObjectPrefix + "deffile.v1"
+	case DataEnvVar:
+		return mediaTypeObjectPrefix + "envvar.v1"
+	case DataLabels:
+		return mediaTypeObjectPrefix + "labels.v1+json"
+	case DataPartition:
+		return mediaTypeObjectPrefix + "partition.v1"
+	case DataSignature:
+		return mediaTypeObjectPrefix + "signature.v1"
+	case DataGenericJSON:
+		return mediaTypeObjectPrefix + "generic.v1+json"
+	case DataGeneric:
+		return mediaTypeObjectPrefix + "generic.v1"
+	case DataCryptoMessage:
+		return mediaTypeObjectPrefix + "cryptomessage.v1"
+	case DataBuildLog:
+		return mediaTypeObjectPrefix + "buildlog.v1"
+	case DataBundle:
+		return mediaTypeObjectPrefix + "bundle.v1+tar"
+	case DataHealthCheck:
+		return mediaTypeObjectPrefix + "healthcheck.v1+json"
+	case DataSBOM:
+		return mediaTypeObjectPrefix + "sbom.v1"
+	case DataOCIConfig:
+		return mediaTypeObjectPrefix + "ociconfig.v1"
+	case DataOCIBlob:
+		return mediaTypeObjectPrefix + "ociblob.v1"
+	case DataPlaceholder:
+		return mediaTypeObjectPrefix + "placeholder.v1"
+	case DataSecrets:
+		return mediaTypeObjectPrefix + "secrets.v1"
+	case DataProvenance:
+		return mediaTypeObjectPrefix + "provenance.v1+json"
+	}
+	return "application/octet-stream"
+}
+
+// GetMediaType returns the media type of the data object described by d.
+// For partitions, the media type is refined by file system type where
+// known. For OCI configs and blobs, the recorded OCI media type is returned.
+func (d *Descriptor) GetMediaType() string {
+	if d.Datatype == DataOCIConfig || d.Datatype == DataOCIBlob {
+		if m, err := d.GetOCIMediaType(); err == nil && m != "" {
+			return m
+		}
+	}
+	if d.Datatype == DataPartition {
+		if fs, err := d.GetFsType(); err == nil {
+			switch fs {
+			case FsSquash:
+				return mediaTypeObjectPrefix + "partition.v1.squashfs"
+			case FsExt3:
+				return mediaTypeObjectPrefix + "partition.v1.ext3"
+			case FsEncryptedSquashfs:
+				return mediaTypeObjectPrefix + "partition.v1.squashfs.encrypted"
+			}
+		}
+	}
+	return d.Datatype.MediaType()
+}
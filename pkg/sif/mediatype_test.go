@@ -0,0 +1,71 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"testing"
+)
+
+func TestDatatype_MediaType(t *testing.T) {
+	tests := []struct {
+		d    Datatype
+		want string
+	}{
+		{DataDeffile, "application/vnd.sylabs.sif.object.deffile.v1"},
+		{DataEnvVar, "application/vnd.sylabs.sif.object.envvar.v1"},
+		{DataLabels, "application/vnd.sylabs.sif.object.labels.v1+json"},
+		{DataPartition, "application/vnd.sylabs.sif.object.partition.v1"},
+		{DataSignature, "application/vnd.sylabs.sif.object.signature.v1"},
+		{DataGenericJSON, "application/vnd.sylabs.sif.object.generic.v1+json"},
+		{DataGeneric, "application/vnd.sylabs.sif.object.generic.v1"},
+		{DataCryptoMessage, "application/vnd.sylabs.sif.object.cryptomessage.v1"},
+		{DataBuildLog, "application/vnd.sylabs.sif.object.buildlog.v1"},
+		{DataBundle, "application/vnd.sylabs.sif.object.bundle.v1+tar"},
+		{DataHealthCheck, "application/vnd.sylabs.sif.object.healthcheck.v1+json"},
+		{DataSBOM, "application/vnd.sylabs.sif.object.sbom.v1"},
+		{DataOCIConfig, "application/vnd.sylabs.sif.object.ociconfig.v1"},
+		{DataOCIBlob, "application/vnd.sylabs.sif.object.ociblob.v1"},
+		{DataPlaceholder, "application/vnd.sylabs.sif.object.placeholder.v1"},
+		{DataSecrets, "application/vnd.sylabs.sif.object.secrets.v1"},
+		{DataProvenance, "application/vnd.sylabs.sif.object.provenance.v1+json"},
+		{0, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.d.String(), func(t *testing.T) {
+			if got, want := tt.d.MediaType(), tt.want; got != want {
+				t.Errorf("got media type %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDescriptor_GetMediaType(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	part, _, err := fimg.GetPartPrimSys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := part.GetMediaType(), "application/vnd.sylabs.sif.object.partition.v1.squashfs"; got != want {
+		t.Errorf("got partition media type %q, want %q", got, want)
+	}
+
+	sigs, _, err := fimg.GetFromDescr(Descriptor{Datatype: DataSignature})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := sigs[0].GetMediaType(), DataSignature.MediaType(); got != want {
+		t.Errorf("got signature media type %q, want %q", got, want)
+	}
+}
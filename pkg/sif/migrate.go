@@ -0,0 +1,157 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Images created before the primary partition convention may contain one or more system
+// partitions, none of which is marked PartPrimSys. Runtimes relying on the convention cannot
+// determine which partition to run from such images.
+
+// ErrPrimPartAmbiguous is the code for when a primary partition cannot be selected unambiguously.
+var ErrPrimPartAmbiguous = errors.New("primary partition ambiguous")
+
+var errNoSystemPartition = errors.New("no system partition found")
+
+// PrimPartSelection describes the selection of a primary partition.
+type PrimPartSelection struct {
+	ID         uint32   // ID of the selected partition
+	Candidates []uint32 // IDs of equally preferred partitions, if Ambiguous
+	Ambiguous  bool     // whether more than one partition was equally preferred
+	Existing   bool     // whether the selected partition was already the primary partition
+}
+
+// primPartCandidate is a system partition being considered as primary partition.
+type primPartCandidate struct {
+	d         *Descriptor
+	archMatch bool // arch matches the requested arch
+	squashfs  bool // file system is squashfs
+}
+
+// less returns true if c is preferred over o as primary partition. Partitions built for the
+// requested arch are preferred, followed by those in the lowest numbered group, followed by
+// squashfs partitions.
+func (c primPartCandidate) less(o primPartCandidate) bool {
+	if c.archMatch != o.archMatch {
+		return c.archMatch
+	}
+	if cg, og := c.d.Groupid&^DescrGroupMask, o.d.Groupid&^DescrGroupMask; cg != og {
+		return cg != 0 && (og == 0 || cg < og)
+	}
+	if c.squashfs != o.squashfs {
+		return c.squashfs
+	}
+	return false
+}
+
+// SelectPrimPart selects the partition that best fits the primary partition convention. If the
+// image already contains a primary partition, it is selected. Otherwise, a system partition is
+// selected heuristically. Partitions built for arch (a Go architecture name, such as "amd64") are
+// preferred, followed by those in the lowest numbered object group, followed by squashfs
+// partitions. If arch is empty, the architecture of partitions is not considered.
+//
+// If more than one partition is equally preferred, the largest is selected, and the selection is
+// marked Ambiguous. If the image contains no system partition, an error is returned.
+func (fimg *FileImage) SelectPrimPart(arch string) (PrimPartSelection, error) {
+	if d, _, err := fimg.GetPartPrimSys(); err == nil {
+		return PrimPartSelection{ID: d.ID, Existing: true}, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return PrimPartSelection{}, err
+	}
+
+	var cs []primPartCandidate
+	for i := range fimg.DescrArr {
+		d := &fimg.DescrArr[i]
+		if !d.Used || d.Datatype != DataPartition {
+			continue
+		}
+
+		pt, err := d.GetPartType()
+		if err != nil {
+			return PrimPartSelection{}, err
+		}
+		if pt != PartSystem {
+			continue
+		}
+
+		fs, err := d.GetFsType()
+		if err != nil {
+			return PrimPartSelection{}, err
+		}
+
+		a, err := d.GetArch()
+		if err != nil {
+			return PrimPartSelection{}, err
+		}
+
+		cs = append(cs, primPartCandidate{
+			d:         d,
+			archMatch: arch != "" && GetGoArch(trimZeroBytes(a[:])) == arch,
+			squashfs:  fs == FsSquash,
+		})
+	}
+
+	if len(cs) == 0 {
+		return PrimPartSelection{}, errNoSystemPartition
+	}
+
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].less(cs[j]) })
+
+	// Collect the partitions equally preferred to the first.
+	best := cs[:1]
+	for _, c := range cs[1:] {
+		if cs[0].less(c) {
+			break
+		}
+		best = append(best, c)
+	}
+
+	sel := PrimPartSelection{ID: best[0].d.ID}
+	if len(best) > 1 {
+		sel.Ambiguous = true
+
+		var size int64 = -1
+		for _, c := range best {
+			sel.Candidates = append(sel.Candidates, c.d.ID)
+			if c.d.Filelen > size {
+				sel.ID, size = c.d.ID, c.d.Filelen
+			}
+		}
+	}
+
+	return sel, nil
+}
+
+// MigratePrimPart converts an image created before the primary partition convention, by
+// selecting a primary partition with SelectPrimPart and setting it with SetPrimPart. If the image
+// already contains a primary partition, it is not modified.
+//
+// If the selection is ambiguous, the image is not modified, and an error wrapping
+// ErrPrimPartAmbiguous is returned alongside the selection, so the caller may report the
+// candidates or choose one explicitly with SetPrimPart.
+func (fimg *FileImage) MigratePrimPart(arch string) (PrimPartSelection, error) {
+	sel, err := fimg.SelectPrimPart(arch)
+	if err != nil {
+		return PrimPartSelection{}, err
+	}
+
+	if sel.Existing {
+		return sel, nil
+	}
+
+	if sel.Ambiguous {
+		return sel, fmt.Errorf("%w: candidates %v", ErrPrimPartAmbiguous, sel.Candidates)
+	}
+
+	if err := fimg.SetPrimPart(sel.ID); err != nil {
+		return sel, err
+	}
+	return sel, nil
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestMigratePrimPart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-migrate-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	part := func(t *testing.T, group uint32, fs Fstype, pt Parttype, arch string, size int) DescriptorInput {
+		di := DescriptorInput{
+			Datatype: DataPartition,
+			Groupid:  DescrGroupMask | group,
+			Link:     DescrUnusedLink,
+			Size:     int64(size),
+			Fname:    "part",
+			Data:     make([]byte, size),
+		}
+		if err := di.SetPartExtra(fs, pt, arch); err != nil {
+			t.Fatal(err)
+		}
+		return di
+	}
+
+	tests := []struct {
+		name    string
+		parts   func(t *testing.T) []DescriptorInput
+		arch    string
+		wantSel PrimPartSelection
+		wantErr error
+	}{
+		{
+			name: "Existing",
+			parts: func(t *testing.T) []DescriptorInput {
+				return []DescriptorInput{
+					part(t, 1, FsSquash, PartSystem, HdrArchAMD64, 8),
+					part(t, 1, FsSquash, PartPrimSys, HdrArchAMD64, 4),
+				}
+			},
+			wantSel: PrimPartSelection{ID: 2, Existing: true},
+		},
+		{
+			name: "NoSystemPartition",
+			parts: func(t *testing.T) []DescriptorInput {
+				return []DescriptorInput{
+					part(t, 1, FsSquash, PartData, HdrArchAMD64, 4),
+				}
+			},
+			wantErr: errNoSystemPartition,
+		},
+		{
+			name: "Single",
+			parts: func(t *testing.T) []DescriptorInput {
+				return []DescriptorInput{
+					part(t, 1, FsSquash, PartData, HdrArchAMD64, 8),
+					part(t, 1, FsSquash, PartSystem, HdrArchAMD64, 4),
+				}
+			},
+			wantSel: PrimPartSelection{ID: 2},
+		},
+		{
+			name: "Arch",
+			parts: func(t *testing.T) []DescriptorInput {
+				return []DescriptorInput{
+					part(t, 1, FsSquash, PartSystem, HdrArchARM64, 8),
+					part(t, 2, FsExt3, PartSystem, HdrArchAMD64, 4),
+				}
+			},
+			arch:    "amd64",
+			wantSel: PrimPartSelection{ID: 2},
+		},
+		{
+			name: "Group",
+			parts: func(t *testing.T) []DescriptorInput {
+				return []DescriptorInput{
+					part(t, 2, FsSquash, PartSystem, HdrArchAMD64, 8),
+					part(t, 1, FsExt3, PartSystem, HdrArchAMD64, 4),
+				}
+			},
+			arch:    "amd64",
+			wantSel: PrimPartSelection{ID: 2},
+		},
+		{
+			name: "Fstype",
+			parts: func(t *testing.T) []DescriptorInput {
+				return []DescriptorInput{
+					part(t, 1, FsExt3, PartSystem, HdrArchAMD64, 8),
+					part(t, 1, FsSquash, PartSystem, HdrArchAMD64, 4),
+				}
+			},
+			wantSel: PrimPartSelection{ID: 2},
+		},
+		{
+			name: "Ambiguous",
+			parts: func(t *testing.T) []DescriptorInput {
+				return []DescriptorInput{
+					part(t, 1, FsSquash, PartSystem, HdrArchAMD64, 4),
+					part(t, 1, FsSquash, PartSystem, HdrArchAMD64, 8),
+					part(t, 1, FsExt3, PartSystem, HdrArchAMD64, 16),
+				}
+			},
+			wantSel: PrimPartSelection{ID: 2, Candidates: []uint32{1, 2}, Ambiguous: true},
+			wantErr: ErrPrimPartAmbiguous,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				ID:         uuid.NewV4(),
+				InputDescr: tt.parts(t),
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sel, err := fimg.MigratePrimPart(tt.arch)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if got, want := sel, tt.wantSel; !reflect.DeepEqual(got, want) {
+				t.Errorf("got selection %+v, want %+v", got, want)
+			}
+
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The primary partition must be set, unless the selection was ambiguous.
+			fimg, err = LoadContainer(cinfo.Pathname, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			d, _, err := fimg.GetPartPrimSys()
+			if tt.wantErr != nil {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("got error %v, want %v", err, ErrNotFound)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := d.ID, tt.wantSel.ID; got != want {
+				t.Errorf("got primary partition %v, want %v", got, want)
+			}
+			if got, want := fimg.PrimPartID, tt.wantSel.ID; got != want {
+				t.Errorf("got PrimPartID %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// By default, the whole of an image is memory mapped when it is loaded. For an image holding
+// hundreds of gigabytes, this consumes a corresponding amount of address space, which matters on
+// memory constrained nodes even if only a small data object is read. An image loaded with
+// OptLoadBuffered is not mapped as a whole. Instead, individual data objects may be mapped with
+// Mmap, and unmapped when no longer needed.
+
+var errMmapUnsupported = errors.New("memory mapping unsupported")
+
+// OptLoadBuffered specifies whether the image is accessed through buffered I/O, rather than by
+// memory mapping the whole image. Data objects may still be mapped individually with Mmap.
+func OptLoadBuffered(b bool) LoadOpt {
+	return func(lo *loadOpts) error {
+		lo.buffered = b
+		return nil
+	}
+}
+
+// ObjectMapping is a read-only memory mapping of a single data object, obtained with Mmap. The
+// mapping remains valid until Close is called, even if the image is unloaded.
+type ObjectMapping struct {
+	mapped []byte // page aligned region mapped
+	data   []byte // data object, within mapped
+}
+
+// Mmap maps the data object associated with descriptor d, as stored in image fimg, into memory.
+// Only the pages holding the data object are mapped, regardless of whether fimg is itself memory
+// mapped. The caller must call Close on the returned mapping to unmap it.
+//
+// The mapping is read-only. Modifying its contents causes a fault. Compressed data objects are
+// mapped as stored.
+func (d *Descriptor) Mmap(fimg *FileImage) (*ObjectMapping, error) {
+	// only a single regular file can be memory mapped
+	f, ok := fimg.Fp.(*os.File)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errMmapUnsupported, fimg.Fp.Name())
+	}
+
+	if d.Fileoff < 0 || d.Filelen < 0 || d.Fileoff > fimg.Filesize-d.Filelen {
+		return nil, fmt.Errorf("data object %d extends past end of file", d.ID)
+	}
+
+	// mmap(2) refuses an empty mapping
+	if d.Filelen == 0 {
+		return &ObjectMapping{data: []byte{}}, nil
+	}
+
+	start := d.Fileoff &^ int64(syscall.Getpagesize()-1)
+	size := d.Fileoff + d.Filelen - start
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("data object %d is too big to be mapped", d.ID)
+	}
+
+	b, err := syscall.Mmap(int(f.Fd()), start, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("while mapping data object %d: %s", d.ID, err)
+	}
+
+	return &ObjectMapping{
+		mapped: b,
+		data:   b[d.Fileoff-start:],
+	}, nil
+}
+
+// Bytes returns the data object held by m. The returned slice must not be used once m is closed.
+// After Close, Bytes returns nil.
+func (m *ObjectMapping) Bytes() []byte {
+	return m.data
+}
+
+// Close unmaps m. Calling Close more than once has no effect.
+func (m *ObjectMapping) Close() error {
+	b := m.mapped
+	m.mapped, m.data = nil, nil
+
+	if b == nil {
+		return nil
+	}
+	if err := syscall.Munmap(b); err != nil {
+		return fmt.Errorf("while unmapping data object: %s", err)
+	}
+	return nil
+}
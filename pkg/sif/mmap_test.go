@@ -0,0 +1,114 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestMmap(t *testing.T) {
+	tests := []struct {
+		name     string
+		buffered bool
+	}{
+		{"Mapped", false},
+		{"Buffered", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fimg, err := LoadContainer(filepath.Join("testdata", "testcontainer2.sif"), true, OptLoadBuffered(tt.buffered))
+			if err != nil {
+				t.Fatalf("failed to load container: %v", err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			if got, want := fimg.Amodebuf, tt.buffered; got != want {
+				t.Errorf("got buffered %v, want %v", got, want)
+			}
+
+			for _, d := range fimg.GetDescriptors() {
+				want := d.GetData(&fimg)
+
+				m, err := d.Mmap(&fimg)
+				if err != nil {
+					t.Fatalf("failed to map data object %d: %v", d.ID, err)
+				}
+
+				if got := m.Bytes(); !bytes.Equal(got, want) {
+					t.Errorf("data object %d: got %v bytes mapped, want %v", d.ID, len(got), len(want))
+				}
+
+				if err := m.Close(); err != nil {
+					t.Error(err)
+				}
+				if err := m.Close(); err != nil {
+					t.Errorf("second close: %v", err)
+				}
+				if b := m.Bytes(); b != nil {
+					t.Errorf("got %v bytes after close, want none", len(b))
+				}
+			}
+		})
+	}
+}
+
+func TestMmapBounds(t *testing.T) {
+	fimg, err := LoadContainer(filepath.Join("testdata", "testcontainer2.sif"), true, OptLoadBuffered(true))
+	if err != nil {
+		t.Fatalf("failed to load container: %v", err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := *d
+	past.Filelen = fimg.Filesize
+	if _, err := past.Mmap(&fimg); err == nil {
+		t.Error("got nil error mapping past end of file")
+	}
+
+	empty := *d
+	empty.Filelen = 0
+	m, err := empty.Mmap(&fimg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(m.Bytes()); got != 0 {
+		t.Errorf("got %v bytes mapped, want none", got)
+	}
+	if err := m.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMmapUnsupported(t *testing.T) {
+	fimg, err := LoadContainer(filepath.Join("testdata", "testcontainer2.sif"), true)
+	if err != nil {
+		t.Fatalf("failed to load container: %v", err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fp := fimg.Fp
+	fimg.Fp = &mockSifReadWriter{}
+	defer func() { fimg.Fp = fp }()
+
+	if _, err := d.Mmap(&fimg); !errors.Is(err, errMmapUnsupported) {
+		t.Errorf("got error %v, want %v", err, errMmapUnsupported)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// OCI config and blob objects hold the content of an OCI image, so that a SIF image may carry an
+// OCI image in a single file. The Extra field of each records the OCI media type and digest of
+// the content, so the content may be located by digest as it would be in an OCI content store.
+
+var (
+	errOCIMediaTypeInvalid = errors.New("OCI media type invalid")
+	errOCIDigestInvalid    = errors.New("OCI digest invalid")
+)
+
+// ErrOCIDigestMismatch is the error returned when the content of an OCI config or blob object
+// does not match its digest.
+var ErrOCIDigestMismatch = errors.New("OCI digest mismatch")
+
+// ociDigestAlgorithms maps the OCI digest algorithms supported by this implementation to their
+// hash functions.
+var ociDigestAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// parseOCIDigest returns the hash function and encoded value of OCI digest s.
+func parseOCIDigest(s string) (func() hash.Hash, string, error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return nil, "", fmt.Errorf("%w: %q", errOCIDigestInvalid, s)
+	}
+
+	h, ok := ociDigestAlgorithms[s[:i]]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: algorithm not supported: %q", errOCIDigestInvalid, s[:i])
+	}
+
+	enc := s[i+1:]
+	if b, err := hex.DecodeString(enc); err != nil || len(b) != h().Size() || enc != strings.ToLower(enc) {
+		return nil, "", fmt.Errorf("%w: %q", errOCIDigestInvalid, s)
+	}
+
+	return h, enc, nil
+}
+
+// OCIDigest returns the OCI digest of the content read from r, using the sha256 algorithm.
+func OCIDigest(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SetOCIBlobExtra serializes the OCI media type and digest info into a binary buffer, for use
+// with objects of type DataOCIConfig and DataOCIBlob. The digest must use the sha256 or sha512
+// algorithm. The digest is not checked against the content of the object.
+func (di *DescriptorInput) SetOCIBlobExtra(mediaType, digest string) error {
+	if mediaType == "" || len(mediaType) > DescrMediaTypeLen || !strings.Contains(mediaType, "/") {
+		return fmt.Errorf("%w: %q", errOCIMediaTypeInvalid, mediaType)
+	}
+	if _, _, err := parseOCIDigest(digest); err != nil {
+		return err
+	}
+
+	var extra OCIBlob
+	copy(extra.MediaType[:], mediaType)
+	copy(extra.Digest[:], digest)
+
+	// serialize the OCI data for integration with the base descriptor input
+	if err := binary.Write(&di.Extra, binary.LittleEndian, extra); err != nil {
+		return err
+	}
+	return nil
+}
+
+// getOCIBlob extracts the OCIBlob from the Extra field of an OCI Config or Blob Descriptor.
+func (d *Descriptor) getOCIBlob() (OCIBlob, error) {
+	var oinfo OCIBlob
+
+	if d.Datatype != DataOCIConfig && d.Datatype != DataOCIBlob {
+		return oinfo, fmt.Errorf("expected DataOCIConfig or DataOCIBlob, got %v", d.Datatype)
+	}
+
+	b := bytes.NewReader(d.Extra[:])
+	if err := binary.Read(b, binary.LittleEndian, &oinfo); err != nil {
+		return oinfo, fmt.Errorf("while extracting OCI extra info: %s", err)
+	}
+
+	return oinfo, nil
+}
+
+// GetOCIMediaType extracts the OCI media type from the Extra field of an OCI Config or Blob
+// Descriptor.
+func (d *Descriptor) GetOCIMediaType() (string, error) {
+	oinfo, err := d.getOCIBlob()
+	if err != nil {
+		return "", err
+	}
+	return trimZeroBytes(oinfo.MediaType[:]), nil
+}
+
+// GetOCIDigest extracts the OCI digest from the Extra field of an OCI Config or Blob Descriptor.
+func (d *Descriptor) GetOCIDigest() (string, error) {
+	oinfo, err := d.getOCIBlob()
+	if err != nil {
+		return "", err
+	}
+	return trimZeroBytes(oinfo.Digest[:]), nil
+}
+
+// CheckOCIDigest checks that the content of the OCI config or blob object described by d matches
+// its digest. If it does not, ErrOCIDigestMismatch is returned.
+func (d *Descriptor) CheckOCIDigest(fimg *FileImage) error {
+	digest, err := d.GetOCIDigest()
+	if err != nil {
+		return err
+	}
+
+	h, enc, err := parseOCIDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	w := h()
+	if _, err := io.Copy(w, d.GetReadSeeker(fimg)); err != nil {
+		return fmt.Errorf("reading data object: %s", err)
+	}
+
+	if hex.EncodeToString(w.Sum(nil)) != enc {
+		return fmt.Errorf("%w: object %d", ErrOCIDigestMismatch, d.ID)
+	}
+	return nil
+}
+
+// WithOCIDigest selects OCI config and blob objects with the specified digest.
+func WithOCIDigest(digest string) DescriptorFilter {
+	return func(d Descriptor) bool {
+		got, err := d.GetOCIDigest()
+		return err == nil && got == digest
+	}
+}
+
+// GetOCIBlob returns the OCI config or blob object of the image with the specified digest. If the
+// image contains no such object, ErrNotFound is returned.
+func (fimg *FileImage) GetOCIBlob(digest string) (Descriptor, error) {
+	ds := fimg.GetDescriptors(WithOCIDigest(digest))
+	if len(ds) == 0 {
+		return Descriptor{}, ErrNotFound
+	}
+
+	// Identical content may be stored more than once, so the first is returned.
+	return ds[0], nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	testOCIConfigType = "application/vnd.oci.image.config.v1+json"
+	testOCILayerType  = "application/vnd.oci.image.layer.v1.tar"
+)
+
+func TestSetOCIBlobExtra(t *testing.T) {
+	sha256Digest := "sha256:" + strings.Repeat("a", 64)
+	sha512Digest := "sha512:" + strings.Repeat("b", 128)
+
+	tests := []struct {
+		name      string
+		mediaType string
+		digest    string
+		wantErr   error
+	}{
+		{"SHA256", testOCILayerType, sha256Digest, nil},
+		{"SHA512", testOCILayerType, sha512Digest, nil},
+		{"MediaTypeEmpty", "", sha256Digest, errOCIMediaTypeInvalid},
+		{"MediaTypeNoSlash", "layer", sha256Digest, errOCIMediaTypeInvalid},
+		{"MediaTypeTooLong", "application/" + strings.Repeat("x", DescrMediaTypeLen), sha256Digest, errOCIMediaTypeInvalid},
+		{"DigestNoAlgorithm", testOCILayerType, strings.Repeat("a", 64), errOCIDigestInvalid},
+		{"DigestAlgorithm", testOCILayerType, "md5:" + strings.Repeat("a", 32), errOCIDigestInvalid},
+		{"DigestLength", testOCILayerType, "sha256:" + strings.Repeat("a", 63), errOCIDigestInvalid},
+		{"DigestUpperCase", testOCILayerType, "sha256:" + strings.Repeat("A", 64), errOCIDigestInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			di := DescriptorInput{Datatype: DataOCIBlob}
+			err := di.SetOCIBlobExtra(tt.mediaType, tt.digest)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			var d Descriptor
+			d.Datatype = DataOCIBlob
+			d.SetExtra(di.Extra.Bytes())
+
+			if got, err := d.GetOCIMediaType(); err != nil || got != tt.mediaType {
+				t.Errorf("got media type %v (%v), want %v", got, err, tt.mediaType)
+			}
+			if got, err := d.GetOCIDigest(); err != nil || got != tt.digest {
+				t.Errorf("got digest %v (%v), want %v", got, err, tt.digest)
+			}
+		})
+	}
+}
+
+func TestGetOCIBlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-oci-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("layer content")
+
+	input := func(t *testing.T, dt Datatype, mediaType string, data []byte, digest string) DescriptorInput {
+		if digest == "" {
+			if digest, err = OCIDigest(bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		di := DescriptorInput{
+			Datatype: dt,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     int64(len(data)),
+			Fname:    "oci",
+			Data:     data,
+		}
+		if err := di.SetOCIBlobExtra(mediaType, digest); err != nil {
+			t.Fatal(err)
+		}
+		return di
+	}
+
+	badDigest := "sha256:" + strings.Repeat("0", 64)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			input(t, DataOCIConfig, testOCIConfigType, config, ""),
+			input(t, DataOCIBlob, testOCILayerType, layer, ""),
+			input(t, DataOCIBlob, testOCILayerType, []byte("corrupt"), badDigest),
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	layerDigest, err := OCIDigest(bytes.NewReader(layer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		digest        string
+		wantID        uint32
+		wantMediaType string
+		wantErr       error
+		wantCheckErr  error
+	}{
+		{"Layer", layerDigest, 2, testOCILayerType, nil, nil},
+		{"Corrupt", badDigest, 3, testOCILayerType, nil, ErrOCIDigestMismatch},
+		{"NotFound", "sha256:" + strings.Repeat("1", 64), 0, "", ErrNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := fimg.GetOCIBlob(tt.digest)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			if got, want := d.ID, tt.wantID; got != want {
+				t.Errorf("got ID %v, want %v", got, want)
+			}
+			if got, want := d.GetMediaType(), tt.wantMediaType; got != want {
+				t.Errorf("got media type %v, want %v", got, want)
+			}
+			if got, want := d.CheckOCIDigest(&fimg), tt.wantCheckErr; !errors.Is(got, want) {
+				t.Errorf("got check error %v, want %v", got, want)
+			}
+		})
+	}
+
+	d, err := fimg.GetDescriptor(WithDataType(DataOCIConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CheckOCIDigest(&fimg); err != nil {
+		t.Error(err)
+	}
+	if _, err := d.CheckContent(&fimg); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Offsets and lengths within an image are signed 64-bit integers, so images and data objects may
+// be as large as 8EiB. The values recorded in an image are not trusted, however. An extent whose
+// end cannot be represented would wrap around when its offset and length are added, and could
+// then pass bounds checks. Such extents are rejected when an image is loaded, so that arithmetic
+// on the extents of loaded descriptors cannot overflow. Sizes supplied by callers are checked as
+// data objects are added.
+
+var (
+	// ErrSizeOverflow is returned when an offset or length cannot be represented.
+	ErrSizeOverflow = errors.New("size exceeds representable range")
+
+	errSizeInvalid = errors.New("size invalid")
+)
+
+// addSize returns a+b, or an error wrapping ErrSizeOverflow if the sum cannot be represented.
+func addSize(a, b int64) (int64, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, fmt.Errorf("%w: %d + %d", ErrSizeOverflow, a, b)
+	}
+	return a + b, nil
+}
+
+// mulSize returns a*b, where a and b are not negative, or an error wrapping ErrSizeOverflow if the
+// product cannot be represented.
+func mulSize(a, b int64) (int64, error) {
+	if b != 0 && a > math.MaxInt64/b {
+		return 0, fmt.Errorf("%w: %d * %d", ErrSizeOverflow, a, b)
+	}
+	return a * b, nil
+}
+
+// descrTableLen returns the length in bytes of a descriptor table holding n descriptors.
+func descrTableLen(n int64) (int64, error) {
+	if n < 0 {
+		return 0, fmt.Errorf("%w: %d", errDescrCountInvalid, n)
+	}
+	return mulSize(n, int64(binary.Size(Descriptor{})))
+}
+
+// checkExtents returns an error wrapping ErrSizeOverflow if the global header of fimg, or one of
+// its used descriptors, records an extent whose end cannot be represented.
+func checkExtents(fimg *FileImage) error {
+	h := fimg.Header
+
+	if _, err := addSize(h.Descroff, h.Descrlen); err != nil {
+		return fmt.Errorf("descriptor table: %w", err)
+	}
+	if _, err := addSize(h.Dataoff, h.Datalen); err != nil {
+		return fmt.Errorf("data section: %w", err)
+	}
+
+	for _, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+		if _, err := addSize(d.Fileoff, d.Filelen); err != nil {
+			return fmt.Errorf("data object %d: %w", d.ID, err)
+		}
+	}
+	return nil
+}
+
+// inMapping returns true if the data object described by d lies within the memory mapping of
+// fimg, so that it may be sliced from fimg.Filedata.
+func (d *Descriptor) inMapping(fimg *FileImage) bool {
+	return d.Fileoff >= 0 && d.Filelen >= 0 && d.Fileoff <= int64(len(fimg.Filedata))-d.Filelen
+}
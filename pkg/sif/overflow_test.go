@@ -0,0 +1,270 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const terabyte = 1 << 40
+
+func TestAddSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    int64
+		want    int64
+		wantErr error
+	}{
+		{"Zero", 0, 0, 0, nil},
+		{"Giant", 500 * terabyte, 3 * terabyte, 503 * terabyte, nil},
+		{"Max", math.MaxInt64 - 1, 1, math.MaxInt64, nil},
+		{"Overflow", math.MaxInt64, 1, 0, ErrSizeOverflow},
+		{"OverflowGiant", math.MaxInt64 - terabyte, 2 * terabyte, 0, ErrSizeOverflow},
+		{"Negative", 1, -2, -1, nil},
+		{"Underflow", math.MinInt64, -1, 0, ErrSizeOverflow},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := addSize(tt.a, tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescrTableLen(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int64
+		wantErr error
+	}{
+		{"Default", DescrNumEntries, nil},
+		{"Negative", -1, errDescrCountInvalid},
+		{"Overflow", math.MaxInt64 / 2, ErrSizeOverflow},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := descrTableLen(tt.n); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// corruptImage creates an image at dir/name holding a single data object, applies corrupt to it,
+// and writes the descriptor table and global header back to the file.
+func corruptImage(t *testing.T, dir, name string, corrupt func(fimg *FileImage)) string {
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, name),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{{
+			Datatype: DataGeneric,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     4,
+			Fname:    "generic",
+			Data:     []byte("data"),
+		}},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	corrupt(&fimg)
+	if err := writeDescriptors(&fimg); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeHeader(&fimg); err != nil {
+		t.Fatal(err)
+	}
+	return cinfo.Pathname
+}
+
+func TestLoadGiantExtents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-overflow-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name          string
+		corrupt       func(fimg *FileImage)
+		wantErr       error
+		wantReaderErr error // LoadContainerReader tolerates a partial descriptor table
+	}{
+		{
+			name:          "ObjectOverflow",
+			corrupt:       func(fimg *FileImage) { fimg.DescrArr[0].Filelen = math.MaxInt64 - fimg.DescrArr[0].Fileoff + 1 },
+			wantErr:       ErrSizeOverflow,
+			wantReaderErr: ErrSizeOverflow,
+		},
+		{
+			name:          "ObjectUnderflow",
+			corrupt:       func(fimg *FileImage) { fimg.DescrArr[0].Fileoff, fimg.DescrArr[0].Filelen = math.MinInt64, -1 },
+			wantErr:       ErrSizeOverflow,
+			wantReaderErr: ErrSizeOverflow,
+		},
+		{
+			name:          "DataSectionOverflow",
+			corrupt:       func(fimg *FileImage) { fimg.Header.Datalen = math.MaxInt64 },
+			wantErr:       ErrSizeOverflow,
+			wantReaderErr: ErrSizeOverflow,
+		},
+		{
+			name:          "DescriptorCountNegative",
+			corrupt:       func(fimg *FileImage) { fimg.Header.Dtotal = -1 },
+			wantErr:       errDescrCountInvalid,
+			wantReaderErr: errDescrCountInvalid,
+		},
+		{
+			name:          "DescriptorCountOverflow",
+			corrupt:       func(fimg *FileImage) { fimg.Header.Dtotal = math.MaxInt64 / 2 },
+			wantErr:       ErrSizeOverflow,
+			wantReaderErr: ErrSizeOverflow,
+		},
+		{
+			name:    "DescriptorCountGiant",
+			corrupt: func(fimg *FileImage) { fimg.Header.Dtotal = terabyte },
+			wantErr: errSectionBounds,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := corruptImage(t, dir, tt.name+".sif", tt.corrupt)
+
+			for _, rdonly := range []bool{true, false} {
+				if _, err := LoadContainer(path, rdonly); !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %v, want %v", err, tt.wantErr)
+				}
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadContainerReader(bytes.NewReader(b)); !errors.Is(err, tt.wantReaderErr) {
+				t.Errorf("got reader error %v, want %v", err, tt.wantReaderErr)
+			}
+		})
+	}
+}
+
+func TestGiantObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-overflow-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a descriptor describing a 3TiB object, representable but beyond the end of the file
+	path := corruptImage(t, dir, "giant.sif", func(fimg *FileImage) {
+		fimg.DescrArr[0].Filelen = 3 * terabyte
+		fimg.DescrArr[0].Storelen = 3 * terabyte
+		fimg.Header.Datalen = 3 * terabyte
+	})
+
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := d.GetData(&fimg); b != nil {
+		t.Errorf("got %v bytes of data, want none", len(b))
+	}
+	if _, err := d.GetMappedReadSeeker(&fimg, AdviceSequential); err == nil {
+		t.Error("got nil error for mapped reader")
+	}
+
+	tos, err := fimg.CheckTruncated()
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("got error %v, want %v", err, ErrTruncated)
+	}
+	if got, want := len(tos), 1; got != want {
+		t.Fatalf("got %v truncated objects, want %v", got, want)
+	}
+	if got, want := tos[0].Missing, d.Fileoff+d.Filelen-fimg.Filesize; got != want {
+		t.Errorf("got %v bytes missing, want %v", got, want)
+	}
+
+	if err := Validate(&fimg).Err(); !errors.Is(err, errSectionBounds) {
+		t.Errorf("got validation error %v, want %v", err, errSectionBounds)
+	}
+}
+
+func TestAddObjectSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-overflow-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		size    int64
+		wantErr error
+	}{
+		{"Negative", -1, errSizeInvalid},
+		{"Overflow", math.MaxInt64, ErrSizeOverflow},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := corruptImage(t, dir, tt.name+".sif", func(fimg *FileImage) {})
+
+			fimg, err := LoadContainer(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			input := DescriptorInput{
+				Datatype: DataGeneric,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     tt.size,
+				Fname:    "generic",
+				Fp:       bytes.NewReader(nil),
+			}
+			if err := fimg.AddObject(input); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
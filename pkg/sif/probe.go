@@ -0,0 +1,57 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ProbeHeader reads and validates the global header at the start of r,
+// without reading the descriptors or data that follow it. Header
+// checksums are verified where present. Only the first few hundred bytes
+// of r are accessed, making ProbeHeader suitable for classifying files
+// cheaply, such as when sniffing uploads.
+func ProbeHeader(r io.ReaderAt) (Header, error) {
+	var h Header
+
+	sr := io.NewSectionReader(r, 0, int64(binary.Size(h)))
+	if err := binary.Read(sr, binary.LittleEndian, &h); err != nil {
+		return Header{}, fmt.Errorf("reading global header: %s", err)
+	}
+
+	if err := isValidHeader(&h); err != nil {
+		return Header{}, err
+	}
+
+	if _, err := checkHeaderExt(r, &h); err != nil {
+		return Header{}, err
+	}
+
+	return h, nil
+}
+
+// IsSIF reports whether r begins with a valid SIF global header.
+func IsSIF(r io.ReaderAt) bool {
+	_, err := ProbeHeader(r)
+	return err == nil
+}
+
+// GetMagic returns the magic string of the header.
+func (h *Header) GetMagic() string {
+	return trimZeroBytes(h.Magic[:])
+}
+
+// GetVersion returns the SIF specification version of the header.
+func (h *Header) GetVersion() string {
+	return trimZeroBytes(h.Version[:])
+}
+
+// GetArch returns the architecture code of the header.
+func (h *Header) GetArch() string {
+	return trimZeroBytes(h.Arch[:])
+}
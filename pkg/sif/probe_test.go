@@ -0,0 +1,70 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestProbeHeader(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	badMagic := append([]byte(nil), b[:DescrStartOffset]...)
+	copy(badMagic[HdrLaunchLen:], "NOT_MAGIC")
+
+	badVersion := append([]byte(nil), b[:DescrStartOffset]...)
+	copy(badVersion[HdrLaunchLen+HdrMagicLen:], "99")
+
+	tests := []struct {
+		name        string
+		b           []byte
+		wantErr     bool
+		wantVersion string
+		wantArch    string
+	}{
+		{"OK", b, false, "00", HdrArchAMD64},
+		{"HeaderOnly", b[:128], false, "00", HdrArchAMD64},
+		{"Short", b[:64], true, "", ""},
+		{"Empty", nil, true, "", ""},
+		{"BadMagic", badMagic, true, "", ""},
+		{"BadVersion", badVersion, true, "", ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.b)
+
+			h, err := ProbeHeader(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			if got, want := IsSIF(r), !tt.wantErr; got != want {
+				t.Errorf("got IsSIF %v, want %v", got, want)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got, want := h.GetMagic(), HdrMagic; got != want {
+				t.Errorf("got magic %q, want %q", got, want)
+			}
+			if got, want := h.GetVersion(), tt.wantVersion; got != want {
+				t.Errorf("got version %q, want %q", got, want)
+			}
+			if got, want := h.GetArch(), tt.wantArch; got != want {
+				t.Errorf("got arch %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// A provenance object records the images from which an image derives, such as the base image it
+// was built from, or the source it was bootstrapped from. Each parent is identified by its image
+// ID, the digest of its file, or a source reference, so that the ancestry of images may be traced
+// across a local store of images with a ProvenanceGraph. As image IDs are retained when an image
+// is modified, such as when it is signed, parents identified by image ID are found even if they
+// have changed since.
+
+var (
+	errParentKindInvalid   = errors.New("parent kind invalid")
+	errParentUnidentified  = errors.New("parent must be identified by image ID, digest or source")
+	errParentIDInvalid     = errors.New("parent image ID invalid")
+	errProvenanceNoParents = errors.New("provenance contains no parents")
+)
+
+// ProvenanceName is the default name of provenance objects.
+const ProvenanceName = "provenance.json"
+
+// ParentKind represents the relationship of an image to a parent.
+type ParentKind string
+
+// List of supported parent kinds.
+const (
+	ParentBase      ParentKind = "base"      // image from which the image was built
+	ParentBootstrap ParentKind = "bootstrap" // source from which the image was bootstrapped
+)
+
+// Parent describes an image from which an image derives. At least one of ImageID, Digest and
+// Source is set.
+type Parent struct {
+	Kind    ParentKind `json:"kind"`              // relationship to the parent
+	ImageID string     `json:"imageID,omitempty"` // ID of the parent, if a SIF image
+	Digest  string     `json:"digest,omitempty"`  // digest of the parent, such as "sha256:<hex>"
+	Source  string     `json:"source,omitempty"`  // reference to the parent, such as a URI
+}
+
+// check returns an error if p is not a valid parent.
+func (p Parent) check() error {
+	switch p.Kind {
+	case ParentBase, ParentBootstrap:
+	default:
+		return fmt.Errorf("%w: %q", errParentKindInvalid, p.Kind)
+	}
+
+	if p.ImageID == "" && p.Digest == "" && p.Source == "" {
+		return fmt.Errorf("%v parent: %w", p.Kind, errParentUnidentified)
+	}
+	if p.ImageID != "" {
+		if _, err := uuid.FromString(p.ImageID); err != nil {
+			return fmt.Errorf("%v parent: %w: %q", p.Kind, errParentIDInvalid, p.ImageID)
+		}
+	}
+	if p.Digest != "" {
+		if _, _, err := parseOCIDigest(p.Digest); err != nil {
+			return fmt.Errorf("%v parent: %w", p.Kind, err)
+		}
+	}
+	return nil
+}
+
+// ParentOf returns a Parent of the specified kind identifying fimg by its image ID and the digest
+// of its file. The digest is computed by reading the entire image.
+func ParentOf(kind ParentKind, fimg *FileImage) (Parent, error) {
+	digest, err := fimg.imageDigest()
+	if err != nil {
+		return Parent{}, err
+	}
+
+	p := Parent{
+		Kind:    kind,
+		ImageID: fimg.Header.ID.String(),
+		Digest:  digest,
+	}
+	return p, p.check()
+}
+
+// imageDigest returns the digest of the file holding fimg, of the form "sha256:<hex>".
+func (fimg *FileImage) imageDigest() (string, error) {
+	if fimg.Fp == nil {
+		return "", fmt.Errorf("computing image digest: image not loaded from a file")
+	}
+
+	d, err := OCIDigest(io.NewSectionReader(fimg.Fp, 0, fimg.Filesize))
+	if err != nil {
+		return "", fmt.Errorf("computing image digest: %s", err)
+	}
+	return d, nil
+}
+
+// Provenance represents the parents of an image.
+type Provenance struct {
+	Parents []Parent `json:"parents"`
+}
+
+// check returns an error if pv is not valid provenance.
+func (pv *Provenance) check() error {
+	if len(pv.Parents) == 0 {
+		return errProvenanceNoParents
+	}
+
+	for _, p := range pv.Parents {
+		if err := p.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadProvenance reads provenance from r, as written by NewProvenanceInput.
+func ReadProvenance(r io.Reader) (*Provenance, error) {
+	var pv Provenance
+	if err := json.NewDecoder(r).Decode(&pv); err != nil {
+		return nil, fmt.Errorf("decoding provenance: %s", err)
+	}
+	if err := pv.check(); err != nil {
+		return nil, err
+	}
+	return &pv, nil
+}
+
+// NewProvenanceInput returns a DescriptorInput for a provenance object holding the parents of pv,
+// in the default object group. Each parent must be of a known kind, and be identified by image
+// ID, digest or source.
+func NewProvenanceInput(pv *Provenance) (DescriptorInput, error) {
+	if err := pv.check(); err != nil {
+		return DescriptorInput{}, err
+	}
+
+	b, err := json.Marshal(pv)
+	if err != nil {
+		return DescriptorInput{}, err
+	}
+
+	return DescriptorInput{
+		Datatype: DataProvenance,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(b)),
+		Fname:    ProvenanceName,
+		Data:     b,
+	}, nil
+}
+
+// GetProvenance reads the provenance from the data object described by d.
+func (d *Descriptor) GetProvenance(fimg *FileImage) (*Provenance, error) {
+	if d.Datatype != DataProvenance {
+		return nil, fmt.Errorf("expected DataProvenance, got %v", d.Datatype)
+	}
+	return ReadProvenance(d.GetReadSeeker(fimg))
+}
+
+// GetProvenance reads the provenance of the image. If the image contains no provenance,
+// ErrNotFound is returned. If it contains more than one, ErrMultValues is returned.
+func (fimg *FileImage) GetProvenance() (*Provenance, error) {
+	d, err := fimg.GetDescriptor(WithDataType(DataProvenance))
+	if err != nil {
+		return nil, err
+	}
+	return d.GetProvenance(fimg)
+}
+
+// ProvenanceNode describes an image within a ProvenanceGraph.
+type ProvenanceNode struct {
+	Path    string   // path of the image
+	ImageID string   // ID of the image
+	Digest  string   // digest of the image, of the form "sha256:<hex>"
+	Parents []Parent // parents recorded in the image, if any
+}
+
+// derivesFrom returns true if n records o as a parent.
+func (n *ProvenanceNode) derivesFrom(o *ProvenanceNode) bool {
+	for _, p := range n.Parents {
+		if (p.ImageID != "" && p.ImageID == o.ImageID) || (p.Digest != "" && p.Digest == o.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProvenanceGraph describes the ancestry of the images in a local store.
+type ProvenanceGraph struct {
+	nodes []*ProvenanceNode
+}
+
+// NewProvenanceGraph returns the graph of the images in dir and its subdirectories, ordered by
+// path. Files that cannot be loaded as SIF images are skipped. The digest of each image is
+// computed, so each image is read in its entirety.
+func NewProvenanceGraph(dir string) (*ProvenanceGraph, error) {
+	g := &ProvenanceGraph{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		n, err := loadProvenanceNode(path)
+		if err != nil {
+			return err
+		}
+		if n != nil {
+			g.nodes = append(g.nodes, n)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// loadProvenanceNode returns the node describing the image at path, or nil if path cannot be
+// loaded as a SIF image.
+func loadProvenanceNode(path string) (*ProvenanceNode, error) {
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		return nil, nil // nolint:nilerr
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	n := &ProvenanceNode{
+		Path:    path,
+		ImageID: fimg.Header.ID.String(),
+	}
+
+	if n.Digest, err = fimg.imageDigest(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	pv, err := fimg.GetProvenance()
+	if errors.Is(err, ErrNotFound) {
+		return n, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	n.Parents = pv.Parents
+
+	return n, nil
+}
+
+// Nodes returns the images in g, ordered by path.
+func (g *ProvenanceGraph) Nodes() []*ProvenanceNode {
+	return g.nodes
+}
+
+// Lookup returns the images in g identified by ref, which is a path, image ID or digest. More than
+// one image may share an image ID, such as where an image has been copied and modified.
+func (g *ProvenanceGraph) Lookup(ref string) []*ProvenanceNode {
+	var nodes []*ProvenanceNode
+	for _, n := range g.nodes {
+		if n.Path == ref || n.ImageID == ref || n.Digest == ref {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// Parents returns the images in g recorded as parents of n.
+func (g *ProvenanceGraph) Parents(n *ProvenanceNode) []*ProvenanceNode {
+	var nodes []*ProvenanceNode
+	for _, o := range g.nodes {
+		if o != n && n.derivesFrom(o) {
+			nodes = append(nodes, o)
+		}
+	}
+	return nodes
+}
+
+// Ancestors returns the images in g from which n derives, directly or through other images in g,
+// nearest first.
+func (g *ProvenanceGraph) Ancestors(n *ProvenanceNode) []*ProvenanceNode {
+	return walkProvenance(g.Parents(n), map[*ProvenanceNode]bool{n: true}, g.Parents)
+}
+
+// Descendants returns the images in g that derive, directly or through other images in g, from
+// the image identified by ref, nearest first. The ref is an image ID, digest or source reference,
+// as recorded in the provenance of images deriving from it, or the path of an image in g. The
+// image identified by ref need not be in g, so that, for example, the images built from a base
+// image that has since been removed may be found.
+func (g *ProvenanceGraph) Descendants(ref string) []*ProvenanceNode {
+	roots := g.Lookup(ref)
+
+	var direct []*ProvenanceNode
+	for _, n := range g.nodes {
+		if n.recordsParent(ref) {
+			direct = append(direct, n)
+			continue
+		}
+		for _, r := range roots {
+			if r != n && n.derivesFrom(r) {
+				direct = append(direct, n)
+				break
+			}
+		}
+	}
+
+	seen := make(map[*ProvenanceNode]bool)
+	for _, r := range roots {
+		seen[r] = true
+	}
+	return walkProvenance(direct, seen, g.children)
+}
+
+// recordsParent returns true if n records a parent identified by ref.
+func (n *ProvenanceNode) recordsParent(ref string) bool {
+	for _, p := range n.Parents {
+		if p.ImageID == ref || p.Digest == ref || p.Source == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// children returns the images in g that record n as a parent.
+func (g *ProvenanceGraph) children(n *ProvenanceNode) []*ProvenanceNode {
+	var nodes []*ProvenanceNode
+	for _, o := range g.nodes {
+		if o != n && o.derivesFrom(n) {
+			nodes = append(nodes, o)
+		}
+	}
+	return nodes
+}
+
+// walk returns the nodes reachable from start by following next, breadth first, excluding those
+// in seen. Each node is returned once, even if the graph contains cycles.
+func walkProvenance(start []*ProvenanceNode, seen map[*ProvenanceNode]bool,
+	next func(*ProvenanceNode) []*ProvenanceNode) []*ProvenanceNode {
+	var nodes []*ProvenanceNode
+
+	queue := start
+	for len(queue) > 0 {
+		var level []*ProvenanceNode
+		for _, n := range queue {
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			nodes = append(nodes, n)
+			level = append(level, next(n)...)
+		}
+
+		// keep the order of each level stable, regardless of the order in which it was reached
+		sort.SliceStable(level, func(i, j int) bool { return level[i].Path < level[j].Path })
+		queue = level
+	}
+
+	return nodes
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestNewProvenanceInput(t *testing.T) {
+	id := uuid.NewV4().String()
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name    string
+		pv      Provenance
+		wantErr error
+	}{
+		{"OK", Provenance{Parents: []Parent{{Kind: ParentBase, ImageID: id, Digest: digest}}}, nil},
+		{"Source", Provenance{Parents: []Parent{{Kind: ParentBootstrap, Source: "docker://alpine"}}}, nil},
+		{"NoParents", Provenance{}, errProvenanceNoParents},
+		{"Kind", Provenance{Parents: []Parent{{Kind: "cousin", ImageID: id}}}, errParentKindInvalid},
+		{"Unidentified", Provenance{Parents: []Parent{{Kind: ParentBase}}}, errParentUnidentified},
+		{"ImageID", Provenance{Parents: []Parent{{Kind: ParentBase, ImageID: "x"}}}, errParentIDInvalid},
+		{"Digest", Provenance{Parents: []Parent{{Kind: ParentBase, Digest: "sha256:x"}}}, errOCIDigestInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			di, err := NewProvenanceInput(&tt.pv)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			pv, err := ReadProvenance(bytes.NewReader(di.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*pv, tt.pv) {
+				t.Errorf("got provenance %+v, want %+v", *pv, tt.pv)
+			}
+		})
+	}
+}
+
+// createProvenanceImage creates an image at path, with provenance recording parents if any.
+func createProvenanceImage(t *testing.T, path string, parents ...Parent) {
+	t.Helper()
+
+	cinfo := CreateInfo{
+		Pathname:   path,
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+	}
+
+	if len(parents) > 0 {
+		di, err := NewProvenanceInput(&Provenance{Parents: parents})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cinfo.InputDescr = append(cinfo.InputDescr, di)
+	}
+
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// parentOf returns a Parent of the specified kind identifying the image at path.
+func parentOf(t *testing.T, kind ParentKind, path string) Parent {
+	t.Helper()
+
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	p, err := ParentOf(kind, &fimg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestProvenanceGraph(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-provenance-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "base.sif")
+	child := filepath.Join(dir, "child.sif")
+	grandchild := filepath.Join(dir, "sub", "grandchild.sif")
+	bootstrapped := filepath.Join(dir, "bootstrapped.sif")
+
+	if err := os.Mkdir(filepath.Dir(grandchild), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	createProvenanceImage(t, base)
+	baseParent := parentOf(t, ParentBase, base)
+	createProvenanceImage(t, child, baseParent)
+
+	// identify the parent by image ID alone, which is retained if the parent is modified
+	childParent := parentOf(t, ParentBase, child)
+	childParent.Digest = ""
+	createProvenanceImage(t, grandchild, childParent)
+
+	createProvenanceImage(t, bootstrapped, Parent{Kind: ParentBootstrap, Source: "docker://alpine"})
+
+	// files other than images are skipped
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := NewProvenanceGraph(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := func(nodes []*ProvenanceNode) []string {
+		var s []string
+		for _, n := range nodes {
+			s = append(s, n.Path)
+		}
+		return s
+	}
+
+	if got, want := paths(g.Nodes()), []string{base, bootstrapped, child, grandchild}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got nodes %v, want %v", got, want)
+	}
+
+	lookup := func(ref string) *ProvenanceNode {
+		nodes := g.Lookup(ref)
+		if len(nodes) != 1 {
+			t.Fatalf("got %v nodes for %v, want 1", len(nodes), ref)
+		}
+		return nodes[0]
+	}
+
+	if got, want := lookup(baseParent.Digest).Path, base; got != want {
+		t.Errorf("got node %v, want %v", got, want)
+	}
+	if got, want := lookup(childParent.ImageID).Path, child; got != want {
+		t.Errorf("got node %v, want %v", got, want)
+	}
+
+	t.Run("Ancestors", func(t *testing.T) {
+		if got, want := paths(g.Ancestors(lookup(grandchild))), []string{child, base}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got ancestors %v, want %v", got, want)
+		}
+		if got := paths(g.Ancestors(lookup(base))); got != nil {
+			t.Errorf("got ancestors %v, want none", got)
+		}
+	})
+
+	tests := []struct {
+		name string
+		ref  string
+		want []string
+	}{
+		{"Digest", baseParent.Digest, []string{child, grandchild}},
+		{"ImageID", baseParent.ImageID, []string{child, grandchild}},
+		{"Path", child, []string{grandchild}},
+		{"Source", "docker://alpine", []string{bootstrapped}},
+		{"Unknown", "docker://busybox", nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Descendants"+tt.name, func(t *testing.T) {
+			if got := paths(g.Descendants(tt.ref)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got descendants %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// once the base image is removed, images deriving from it are still found
+	if err := os.Remove(base); err != nil {
+		t.Fatal(err)
+	}
+	if g, err = NewProvenanceGraph(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(g.Descendants(baseParent.Digest)), []string{child, grandchild}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got descendants %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var errRateInvalid = errors.New("rate limit invalid")
+
+// RateLimiter limits the bandwidth of data object I/O using a token bucket. A RateLimiter may be
+// shared between images, and between goroutines, to cap their combined bandwidth.
+type RateLimiter struct {
+	rate  float64 // bytes per second
+	burst int     // bucket capacity, in bytes
+
+	mu     sync.Mutex
+	tokens float64   // available tokens, negative while I/O is owed
+	last   time.Time // time tokens were last replenished
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter returns a RateLimiter that allows an average of bytesPerSec bytes per second,
+// with bursts of up to burst bytes.
+func NewRateLimiter(bytesPerSec int64, burst int) (*RateLimiter, error) {
+	if bytesPerSec <= 0 || burst <= 0 {
+		return nil, fmt.Errorf("%w: %d bytes/s, burst %d", errRateInvalid, bytesPerSec, burst)
+	}
+
+	l := &RateLimiter{
+		rate:   float64(bytesPerSec),
+		burst:  burst,
+		tokens: float64(burst),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+	l.last = l.now()
+	return l, nil
+}
+
+// wait takes n tokens from the bucket, blocking until they are available. Callers that take more
+// tokens than are available go into debt, which later callers must also wait out, so that the
+// combined rate is respected.
+func (l *RateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if d > 0 {
+		l.sleep(d)
+	}
+}
+
+// limit returns the number of bytes of an I/O of n bytes that may be performed at once.
+func (l *RateLimiter) limit(n int) int {
+	if n > l.burst {
+		return l.burst
+	}
+	return n
+}
+
+// Reader returns a reader that reads from r at the rate allowed by l.
+func (l *RateLimiter) Reader(r io.Reader) io.Reader {
+	return &rateLimitedReader{r: r, l: l}
+}
+
+// Writer returns a writer that writes to w at the rate allowed by l.
+func (l *RateLimiter) Writer(w io.Writer) io.Writer {
+	return &rateLimitedWriter{w: w, l: l}
+}
+
+type rateLimitedReader struct {
+	r io.Reader
+	l *RateLimiter
+}
+
+func (lr *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p[:lr.l.limit(len(p))])
+	lr.l.wait(n)
+	return n, err
+}
+
+type rateLimitedWriter struct {
+	w io.Writer
+	l *RateLimiter
+}
+
+func (lw *rateLimitedWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n, err := lw.w.Write(p[:lw.l.limit(len(p))])
+		lw.l.wait(n)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+type rateLimitedReaderAt struct {
+	r io.ReaderAt
+	l *RateLimiter
+}
+
+func (lr *rateLimitedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	var read int
+	for len(p) > 0 {
+		n, err := lr.r.ReadAt(p[:lr.l.limit(len(p))], off)
+		lr.l.wait(n)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		p = p[n:]
+		off += int64(n)
+	}
+	return read, nil
+}
+
+type rateLimitedReadSeeker struct {
+	io.Reader
+	s io.Seeker
+}
+
+func (rs *rateLimitedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return rs.s.Seek(offset, whence)
+}
+
+// OptLoadRateLimit specifies that data object I/O be limited by l. Reads through the
+// io.ReadSeeker returned by GetReadSeeker or the io.SectionReader returned by GetReader, and
+// writes of data objects by AddObject, are limited. Data accessed directly, such as with GetData,
+// is not.
+func OptLoadRateLimit(l *RateLimiter) LoadOpt {
+	return func(lo *loadOpts) error {
+		lo.limiter = l
+		return nil
+	}
+}
+
+// limitReadSeeker returns rs, limited by the rate limiter of fimg, if any.
+func (fimg *FileImage) limitReadSeeker(rs io.ReadSeeker) io.ReadSeeker {
+	if fimg.limiter == nil {
+		return rs
+	}
+	return &rateLimitedReadSeeker{Reader: fimg.limiter.Reader(rs), s: rs}
+}
+
+// limitReaderAt returns r, limited by the rate limiter of fimg, if any.
+func (fimg *FileImage) limitReaderAt(r io.ReaderAt) io.ReaderAt {
+	if fimg.limiter == nil {
+		return r
+	}
+	return &rateLimitedReaderAt{r: r, l: fimg.limiter}
+}
+
+// limitWriter returns w, limited by the rate limiter of fimg, if any.
+func (fimg *FileImage) limitWriter(w io.Writer) io.Writer {
+	if fimg.limiter == nil {
+		return w
+	}
+	return fimg.limiter.Writer(w)
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// newTestRateLimiter returns a RateLimiter using a fake clock, which advances only when the
+// limiter sleeps. The returned function reports the total time slept.
+func newTestRateLimiter(t *testing.T, bytesPerSec int64, burst int) (*RateLimiter, func() time.Duration) {
+	t.Helper()
+
+	l, err := NewRateLimiter(bytesPerSec, burst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(0, 0)
+	var slept time.Duration
+
+	l.now = func() time.Time { return now }
+	l.sleep = func(d time.Duration) {
+		now = now.Add(d)
+		slept += d
+	}
+	l.last = now
+
+	return l, func() time.Duration { return slept }
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		bytesPerSec int64
+		burst       int
+		wantErr     error
+	}{
+		{"ZeroRate", 0, 1, errRateInvalid},
+		{"ZeroBurst", 1, 0, errRateInvalid},
+		{"OK", 1, 1, nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRateLimiter(tt.bytesPerSec, tt.burst); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	data := bytes.Repeat([]byte{0xff}, 10*1024)
+
+	tests := []struct {
+		name string
+		copy func(l *RateLimiter) (int64, error)
+	}{
+		{
+			name: "Reader",
+			copy: func(l *RateLimiter) (int64, error) {
+				return io.Copy(ioutil.Discard, l.Reader(bytes.NewReader(data)))
+			},
+		},
+		{
+			name: "Writer",
+			copy: func(l *RateLimiter) (int64, error) {
+				n, err := l.Writer(ioutil.Discard).Write(data)
+				return int64(n), err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			l, slept := newTestRateLimiter(t, 1024, 1024)
+
+			n, err := tt.copy(l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := n, int64(len(data)); got != want {
+				t.Errorf("got %v bytes, want %v", got, want)
+			}
+
+			// The first burst is free, the remainder is limited to 1KiB/s.
+			if got, want := slept(), 9*time.Second; got != want {
+				t.Errorf("got %v slept, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestOptLoadRateLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-ratelimit-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte{0xff}, 4096)
+	generic := DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(data)),
+		Fname:    "generic",
+		Data:     data,
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	l, slept := newTestRateLimiter(t, 1024, 1024)
+
+	fimg, err := LoadContainer(cinfo.Pathname, false, OptLoadRateLimit(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	if err := fimg.AddObject(generic); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := slept(), 3*time.Second; got != want {
+		t.Errorf("got %v slept writing, want %v", got, want)
+	}
+
+	if err := fimg.remap(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(fimg.DescrArr[0].GetReadSeeker(&fimg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("data mismatch")
+	}
+	if got, want := slept(), 7*time.Second; got != want {
+		t.Errorf("got %v slept, want %v", got, want)
+	}
+	b, err = ioutil.ReadAll(fimg.DescrArr[0].GetReader(&fimg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("data mismatch")
+	}
+	if got, want := slept(), 11*time.Second; got != want {
+		t.Errorf("got %v slept, want %v", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Images need not be held in a file on disk. An image held in any io.ReaderAt, such as a blob in
+// object storage, an in-memory buffer, or a member of an archive, may be loaded read-only. The top
+// of the image is buffered when loading, and data objects are read from the io.ReaderAt on demand.
+
+var errReaderAtReadOnly = errors.New("image loaded from io.ReaderAt is read-only")
+
+// readerAtFile implements ReadWriter on top of an io.ReaderAt. Operations that modify the image
+// return errReaderAtReadOnly.
+type readerAtFile struct {
+	*io.SectionReader
+	name string
+}
+
+// Name returns the name of the image.
+func (rf *readerAtFile) Name() string {
+	return rf.name
+}
+
+// Fd returns an invalid file descriptor, as there is no file underlying the image.
+func (rf *readerAtFile) Fd() uintptr {
+	return ^uintptr(0)
+}
+
+// Write returns errReaderAtReadOnly.
+func (rf *readerAtFile) Write(b []byte) (int, error) {
+	return 0, errReaderAtReadOnly
+}
+
+// Truncate returns errReaderAtReadOnly.
+func (rf *readerAtFile) Truncate(size int64) error {
+	return errReaderAtReadOnly
+}
+
+// Sync does nothing, as the image cannot be modified.
+func (rf *readerAtFile) Sync() error {
+	return nil
+}
+
+// Close does nothing. The io.ReaderAt is owned by the caller.
+func (rf *readerAtFile) Close() error {
+	return nil
+}
+
+// Stat returns a FileInfo describing the image as a regular file.
+func (rf *readerAtFile) Stat() (os.FileInfo, error) {
+	return &readerAtFileInfo{name: rf.name, size: rf.Size()}, nil
+}
+
+// readerAtFileInfo describes an image loaded from an io.ReaderAt.
+type readerAtFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi *readerAtFileInfo) Name() string       { return fi.name }
+func (fi *readerAtFileInfo) Size() int64        { return fi.size }
+func (fi *readerAtFileInfo) Mode() os.FileMode  { return 0444 }
+func (fi *readerAtFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi *readerAtFileInfo) IsDir() bool        { return false }
+func (fi *readerAtFileInfo) Sys() interface{}   { return nil }
+
+// LoadContainerReaderAt loads a SIF image of size bytes from r, which need not be backed by a
+// file. Loading may be further configured with opts.
+//
+// The image is loaded read-only, and is not memory mapped, so data objects are read from r as
+// they are accessed. The caller must ensure r remains valid until the image is unloaded, and is
+// responsible for closing r, if required, once it is.
+func LoadContainerReaderAt(r io.ReaderAt, size int64, opts ...LoadOpt) (FileImage, error) {
+	if r == nil {
+		return FileImage{}, fmt.Errorf("provided reader for image is invalid")
+	}
+	if size < 0 {
+		return FileImage{}, fmt.Errorf("provided size for image is invalid: %d", size)
+	}
+
+	rf := &readerAtFile{SectionReader: io.NewSectionReader(r, 0, size)}
+	if n, ok := r.(interface{ Name() string }); ok {
+		rf.name = n.Name()
+	}
+
+	return LoadContainerFp(rf, true, opts...)
+}
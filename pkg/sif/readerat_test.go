@@ -0,0 +1,125 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLoadContainerReaderAt(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.UnloadContainer() // nolint:errcheck
+
+	fimg, err := LoadContainerReaderAt(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("failed to load image: %v", err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	if got, want := fimg.Header, want.Header; got != want {
+		t.Errorf("got header %+v, want %+v", got, want)
+	}
+	if got, want := fimg.DescrArr, want.DescrArr; !reflect.DeepEqual(got, want) {
+		t.Errorf("got descriptors %+v, want %+v", got, want)
+	}
+	if got, want := fimg.PrimPartID, want.PrimPartID; got != want {
+		t.Errorf("got primary partition %v, want %v", got, want)
+	}
+
+	for i, d := range want.DescrArr {
+		if !d.Used {
+			continue
+		}
+		if got, want := fimg.DescrArr[i].GetData(&fimg), d.GetData(&want); !bytes.Equal(got, want) {
+			t.Errorf("object %d: data mismatch", d.ID)
+		}
+	}
+
+	err = fimg.AddObject(DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Size:     4,
+		Data:     []byte("data"),
+	})
+	if got, want := err, errReaderAtReadOnly; !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+}
+
+func TestLoadContainerReaderAtName(t *testing.T) {
+	f, err := os.Open("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainerReaderAt(f, fi.Size())
+	if err != nil {
+		t.Fatalf("failed to load image: %v", err)
+	}
+
+	if got, want := fimg.Fp.Name(), f.Name(); got != want {
+		t.Errorf("got name %q, want %q", got, want)
+	}
+
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reader is owned by the caller, and must remain open.
+	if _, err := f.Stat(); err != nil {
+		t.Errorf("reader closed on unload: %v", err)
+	}
+}
+
+func TestLoadContainerReaderAtInvalid(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+		size int64
+	}{
+		{name: "NegativeSize", b: content, size: -1},
+		{name: "Empty", b: nil, size: 0},
+		{name: "Short", b: content[:64], size: 64},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadContainerReaderAt(bytes.NewReader(tt.b), tt.size); err == nil {
+				t.Error("unexpected success")
+			}
+		})
+	}
+
+	if _, err := LoadContainerReaderAt(nil, 0); err == nil {
+		t.Error("unexpected success with nil reader")
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Writes interrupted part way, such as by a crash while adding a data object, can leave the
+// descriptor table inconsistent with the global header, or leave data beyond the end of the data
+// section. RepairInPlace fixes those inconsistencies that can be resolved without guessing at the
+// intended content of the image.
+
+var errTrailingData = errors.New("trailing data beyond data section")
+
+// RepairReport describes the repairs made by RepairInPlace.
+type RepairReport struct {
+	Repaired  []Problem         // problems repaired, in the order repaired
+	Remaining *ValidationReport // problems found by Validate once repairs were made
+}
+
+// add records the repair of a problem with the data object with the specified id.
+func (r *RepairReport) add(id uint32, err error) {
+	r.Repaired = append(r.Repaired, Problem{ID: id, Err: err})
+}
+
+// RepairInPlace fixes recoverable inconsistencies in the structure of fimg, and returns a report of the
+// problems repaired, along with those that remain. Each repair is applied as follows:
+//
+//   - Used descriptors that cannot be relied upon, because their ID is zero or duplicated, or their
+//     data lies outside the data section or beyond the end of the file, are marked unused.
+//   - The length of the data section is adjusted to include the data of each remaining object, but
+//     not to extend beyond the end of the file.
+//   - Links referencing objects or groups that do not exist are cleared.
+//   - The descriptor counts recorded in the global header are recomputed.
+//   - Data beyond the end of the data section is truncated.
+//   - A descriptor table checksum mismatch ignored by OptLoadIgnoreDescrChecksum is resolved by
+//     rewriting the checksum.
+//
+// Problems that cannot be resolved without guessing at the intended content of the image, such as
+// overlapping data objects, are not repaired, and are reported in the Remaining field of the
+// report. If no repairs are needed, the image is not modified.
+//
+// The image must be loaded read-write. An image with an invalid global header cannot be repaired.
+// To repair an image cut short in transfer without modifying it, use FileImage.Repair instead.
+func RepairInPlace(fimg *FileImage) (*RepairReport, error) {
+	if err := fimg.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := isValidHeader(&fimg.Header); err != nil {
+		return nil, fmt.Errorf("%w: %v", errHeaderInvalid, err)
+	}
+
+	r := &RepairReport{}
+
+	repairDescriptors(fimg, r)
+	repairDataSection(fimg, r)
+	repairLinks(fimg, r)
+	repairCounts(fimg, r)
+
+	// the checksum is rewritten along with the global header
+	if fimg.descrCRCErr != nil {
+		r.add(0, fimg.descrCRCErr)
+	}
+
+	size := fimg.Filesize
+	if end := fimg.Header.Dataoff + fimg.Header.Datalen; size > end {
+		r.add(0, fmt.Errorf("%w: %d bytes at %d", errTrailingData, size-end, end))
+		size = end
+	}
+
+	if len(r.Repaired) > 0 {
+		err := fimg.guarded(func() error {
+			if err := writeDescriptors(fimg); err != nil {
+				return err
+			}
+
+			fimg.Header.Mtime = fimg.now()
+			if err := writeHeader(fimg); err != nil {
+				return err
+			}
+
+			if size < fimg.Filesize {
+				if err := fimg.Fp.Truncate(size); err != nil {
+					return fmt.Errorf("truncating SIF file: %s", err)
+				}
+			}
+
+			if err := fimg.Fp.Sync(); err != nil {
+				return fmt.Errorf("while sync'ing repaired SIF file: %s", err)
+			}
+
+			return fimg.remap()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.Remaining = Validate(fimg)
+	return r, nil
+}
+
+// repairDescriptors marks unused the used descriptors of fimg whose ID is zero or duplicated, or
+// whose data lies outside the data section or beyond the end of the file.
+func repairDescriptors(fimg *FileImage, r *RepairReport) {
+	start, size := fimg.Header.Dataoff, fimg.Filesize
+
+	ids := make(map[uint32]bool)
+	for i, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+
+		switch {
+		case d.ID == 0:
+			r.add(0, errDescrIDInvalid)
+		case ids[d.ID]:
+			r.add(d.ID, errDescrIDDuplicate)
+		case d.Fileoff < start || d.Filelen < 0 || d.Fileoff > size-d.Filelen:
+			r.add(d.ID, fmt.Errorf("%w: %d bytes at %d, file size %d", errObjectBounds, d.Filelen, d.Fileoff, size))
+		default:
+			ids[d.ID] = true
+			continue
+		}
+
+		releaseDescriptor(fimg, i)
+	}
+}
+
+// repairDataSection adjusts the length of the data section of fimg to include the data of each
+// used descriptor, without extending beyond the end of the file.
+func repairDataSection(fimg *FileImage, r *RepairReport) {
+	h := &fimg.Header
+
+	// data objects written before an interruption may lie beyond the recorded data section
+	end := h.Dataoff
+	for _, d := range fimg.DescrArr {
+		if d.Used && d.Fileoff+d.Filelen > end {
+			end = d.Fileoff + d.Filelen
+		}
+	}
+
+	switch {
+	case h.Datalen < end-h.Dataoff:
+		r.add(0, fmt.Errorf("%w: data section length %d, objects extend to %d", errSectionBounds, h.Datalen, end-h.Dataoff))
+		h.Datalen = end - h.Dataoff
+	case h.Datalen > 0 && h.Dataoff+h.Datalen > fimg.Filesize:
+		r.add(0, fmt.Errorf("%w: data section ends at %d, beyond end of image at %d",
+			errSectionBounds, h.Dataoff+h.Datalen, fimg.Filesize))
+		h.Datalen = end - h.Dataoff
+		if n := fimg.Filesize - h.Dataoff; n > h.Datalen {
+			h.Datalen = n
+		}
+	}
+}
+
+// repairLinks clears the links of the used descriptors of fimg that reference objects or groups
+// that do not exist.
+func repairLinks(fimg *FileImage, r *RepairReport) {
+	ids := make(map[uint32]bool)
+	groups := make(map[uint32]bool)
+	for _, d := range fimg.DescrArr {
+		if d.Used {
+			ids[d.ID] = true
+			groups[d.Groupid&^DescrGroupMask] = true
+		}
+	}
+
+	for i := range fimg.DescrArr {
+		d := &fimg.DescrArr[i]
+		if !d.Used || d.Link == DescrUnusedLink {
+			continue
+		}
+
+		if d.Link&DescrGroupMask != 0 {
+			if groups[d.Link&^DescrGroupMask] {
+				continue
+			}
+			r.add(d.ID, fmt.Errorf("%w: group %d", errLinkInvalid, d.Link&^DescrGroupMask))
+		} else {
+			if ids[d.Link] {
+				continue
+			}
+			r.add(d.ID, fmt.Errorf("%w: object %d", errLinkInvalid, d.Link))
+		}
+
+		d.Link = DescrUnusedLink
+	}
+}
+
+// repairCounts recomputes the descriptor counts recorded in the global header of fimg.
+func repairCounts(fimg *FileImage, r *RepairReport) {
+	h := &fimg.Header
+
+	var free int64
+	for _, d := range fimg.DescrArr {
+		if !d.Used {
+			free++
+		}
+	}
+
+	if got, want := h.Dtotal, int64(len(fimg.DescrArr)); got != want {
+		r.add(0, fmt.Errorf("%w: header records %d descriptors, table holds %d", errDescrCount, got, want))
+		h.Dtotal = want
+	}
+	if got, want := h.Descrlen, int64(binary.Size(fimg.DescrArr)); got != want {
+		r.add(0, fmt.Errorf("%w: header records %d bytes of descriptors, table holds %d", errDescrCount, got, want))
+		h.Descrlen = want
+	}
+	if got, want := h.Dfree, free; got != want {
+		r.add(0, fmt.Errorf("%w: header records %d free descriptors, table holds %d", errDescrCount, got, want))
+		h.Dfree = want
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepairInPlace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-repair-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	part, deffile := testPartInput(t), testDeffileInput(1)
+
+	tests := []struct {
+		name     string
+		corrupt  func(t *testing.T, fimg *FileImage)
+		wantErrs []error
+		wantIDs  []uint32
+		wantUsed int
+	}{
+		{
+			name:     "OK",
+			corrupt:  func(t *testing.T, fimg *FileImage) {},
+			wantUsed: 2,
+		},
+		{
+			name:     "Link",
+			corrupt:  func(t *testing.T, fimg *FileImage) { fimg.DescrArr[1].Link = 7 },
+			wantErrs: []error{errLinkInvalid},
+			wantIDs:  []uint32{2},
+			wantUsed: 2,
+		},
+		{
+			name:     "Dfree",
+			corrupt:  func(t *testing.T, fimg *FileImage) { fimg.Header.Dfree++ },
+			wantErrs: []error{errDescrCount},
+			wantIDs:  []uint32{0},
+			wantUsed: 2,
+		},
+		{
+			name: "DuplicateID",
+			corrupt: func(t *testing.T, fimg *FileImage) {
+				fimg.DescrArr[1].ID = 1
+			},
+			wantErrs: []error{errDescrIDDuplicate, errDescrCount},
+			wantIDs:  []uint32{1, 0},
+			wantUsed: 1,
+		},
+		{
+			name: "ObjectBounds",
+			corrupt: func(t *testing.T, fimg *FileImage) {
+				fimg.DescrArr[1].Fileoff = fimg.Filesize
+			},
+			wantErrs: []error{errObjectBounds, errDescrCount},
+			wantIDs:  []uint32{2, 0},
+			wantUsed: 1,
+		},
+		{
+			name: "DanglingAfterRelease",
+			corrupt: func(t *testing.T, fimg *FileImage) {
+				fimg.DescrArr[0].Fileoff = fimg.Filesize
+			},
+			wantErrs: []error{errObjectBounds, errLinkInvalid, errDescrCount},
+			wantIDs:  []uint32{1, 2, 0},
+			wantUsed: 1,
+		},
+		{
+			name: "InterruptedAdd",
+			corrupt: func(t *testing.T, fimg *FileImage) {
+				// the object was written, but the global header was not updated
+				fimg.Header.Datalen -= fimg.DescrArr[1].Storelen
+			},
+			wantErrs: []error{errSectionBounds},
+			wantIDs:  []uint32{0},
+			wantUsed: 2,
+		},
+		{
+			name: "TrailingData",
+			corrupt: func(t *testing.T, fimg *FileImage) {
+				if _, err := fimg.Fp.Seek(0, io.SeekEnd); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := fimg.Fp.Write([]byte("garbage")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErrs: []error{errTrailingData},
+			wantIDs:  []uint32{0},
+			wantUsed: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := createTestImage(t, filepath.Join(dir, tt.name+".sif"), part, deffile)
+
+			fimg, err := LoadContainer(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := fimg.Filesize
+
+			tt.corrupt(t, &fimg)
+			if err := writeDescriptors(&fimg); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeHeader(&fimg); err != nil {
+				t.Fatal(err)
+			}
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if fimg, err = LoadContainer(path, false); err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			r, err := RepairInPlace(&fimg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := len(r.Repaired), len(tt.wantErrs); got != want {
+				t.Fatalf("got %v repairs (%v), want %v", got, r.Repaired, want)
+			}
+			for i, p := range r.Repaired {
+				if got, want := p, tt.wantErrs[i]; !errors.Is(got, want) {
+					t.Errorf("repair %v: got error %v, want %v", i, got, want)
+				}
+				if got, want := p.ID, tt.wantIDs[i]; got != want {
+					t.Errorf("repair %v: got ID %v, want %v", i, got, want)
+				}
+			}
+
+			if err := r.Remaining.Err(); err != nil {
+				t.Errorf("got remaining problems: %v", err)
+			}
+			if got, want := fimg.Filesize, size; got != want {
+				t.Errorf("got file size %v, want %v", got, want)
+			}
+
+			// the repaired image must load and validate
+			rimg, err := LoadContainer(path, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rimg.UnloadContainer() // nolint:errcheck
+
+			if err := Validate(&rimg).Err(); err != nil {
+				t.Errorf("repaired image invalid: %v", err)
+			}
+			if got, want := int(rimg.Header.Dtotal-rimg.Header.Dfree), tt.wantUsed; got != want {
+				t.Errorf("got %v used descriptors, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errReplaceDatatype = errors.New("data object type mismatch")
+
+// ReplaceObject replaces the data object referred to by id with the data described by input. The
+// data object keeps its ID, group and link, so references to it, such as from signatures, remain
+// in place, while the data type of input must match that of the object. The Groupid and Link
+// fields of input are ignored.
+//
+// The new data is written to the end of the data section before the descriptor is updated, so an
+// interrupted replacement leaves the original data object intact. The space occupied by the
+// original data may be reclaimed with Compact.
+func (fimg *FileImage) ReplaceObject(id uint32, input DescriptorInput) error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+
+	if err := fimg.stageReplace(id, input); err != nil {
+		return err
+	}
+
+	return fimg.guarded(func() error {
+		// write down the descriptor array
+		if err := writeDescriptors(fimg); err != nil {
+			return err
+		}
+
+		fimg.Header.Mtime = fimg.now()
+		// write down global header to file
+		if err := writeHeader(fimg); err != nil {
+			return err
+		}
+
+		if err := fimg.Fp.Sync(); err != nil {
+			return fmt.Errorf("while sync'ing replaced data object to SIF file: %s", err)
+		}
+
+		// the new data lies beyond the end of the previous mapping
+		return fimg.remap()
+	})
+}
+
+// stageReplace writes the data described by input to the end of the data section, and updates the
+// descriptor of the data object referred to by id in memory only.
+func (fimg *FileImage) stageReplace(id uint32, input DescriptorInput) error {
+	descr, index, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+
+	if input.Datatype != descr.Datatype {
+		return fmt.Errorf("%w: got %v, want %v", errReplaceDatatype, input.Datatype, descr.Datatype)
+	}
+
+	// set file pointer to the end of data section
+	if _, err := fimg.Fp.Seek(fimg.Header.Dataoff+fimg.Header.Datalen, 0); err != nil {
+		return fmt.Errorf("setting file offset pointer to end of data section: %s", err)
+	}
+
+	input.Groupid = descr.Groupid
+	input.Link = descr.Link
+
+	// release the descriptor in memory only, so it may be filled from input, restoring the
+	// in-memory state of the image if the data object cannot be written
+	descrs := append([]Descriptor(nil), fimg.DescrArr...)
+	h, primPartID := fimg.Header, fimg.PrimPartID
+
+	fimg.DescrArr[index] = Descriptor{}
+	fimg.Header.Dfree++
+	if fimg.PrimPartID == id {
+		fimg.PrimPartID = 0
+	}
+
+	if err := createDescriptorAt(fimg, index, input); err != nil {
+		fimg.DescrArr, fimg.Header, fimg.PrimPartID = descrs, h, primPartID
+		return err
+	}
+
+	// as when deleting the primary partition, the image no longer depends on any architecture
+	if primPartID == id && fimg.PrimPartID == 0 {
+		var unknown [HdrArchLen]byte
+		copy(unknown[:], HdrArchUnknown)
+		fimg.deriveArch(unknown)
+	}
+
+	return nil
+}
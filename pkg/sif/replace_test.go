@@ -0,0 +1,209 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestReplaceObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-replace-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	original := []byte("bootstrap: library\nfrom: alpine\n")
+	replacement := bytes.Repeat([]byte("bootstrap: docker\n"), 512)
+
+	tests := []struct {
+		name    string
+		id      uint32
+		input   DescriptorInput
+		wantErr bool
+	}{
+		{
+			name:    "NotFound",
+			id:      9,
+			input:   DescriptorInput{Datatype: DataDeffile, Size: 4, Fname: "def", Data: []byte("data")},
+			wantErr: true,
+		},
+		{
+			name:    "DatatypeMismatch",
+			id:      1,
+			input:   DescriptorInput{Datatype: DataLabels, Size: 4, Fname: "def", Data: []byte("data")},
+			wantErr: true,
+		},
+		{
+			name: "ReadError",
+			id:   1,
+			input: DescriptorInput{
+				Datatype: DataDeffile,
+				Size:     int64(2 * len(replacement)),
+				Fname:    "def",
+				Fp:       io.MultiReader(bytes.NewReader(replacement), iotestErrReader{io.ErrUnexpectedEOF}),
+			},
+			wantErr: true,
+		},
+		{
+			name: "OK",
+			id:   1,
+			input: DescriptorInput{
+				Datatype: DataDeffile,
+				Groupid:  DescrUnusedGroup,
+				Link:     DescrUnusedLink,
+				Size:     int64(len(replacement)),
+				Fname:    "replaced",
+				Data:     replacement,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				ID:         uuid.NewV4(),
+				InputDescr: []DescriptorInput{
+					{
+						Datatype: DataDeffile,
+						Groupid:  DescrDefaultGroup,
+						Link:     DescrUnusedLink,
+						Size:     int64(len(original)),
+						Fname:    "def",
+						Data:     original,
+					},
+					{
+						Datatype: DataGeneric,
+						Groupid:  DescrUnusedGroup,
+						Link:     1,
+						Size:     7,
+						Fname:    "generic",
+						Data:     []byte("generic"),
+					},
+				},
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			descrs := append([]Descriptor(nil), fimg.DescrArr...)
+			h := fimg.Header
+
+			err = fimg.ReplaceObject(tt.id, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				if !reflect.DeepEqual(fimg.DescrArr, descrs) {
+					t.Error("descriptors modified by failed replacement")
+				}
+				if fimg.Header != h {
+					t.Error("header modified by failed replacement")
+				}
+				return
+			}
+
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+			if fimg, err = LoadContainer(cinfo.Pathname, true); err != nil {
+				t.Fatal(err)
+			}
+
+			d, _, err := fimg.GetFromDescrID(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := d.Groupid, descrs[0].Groupid; got != want {
+				t.Errorf("got group %v, want %v", got, want)
+			}
+			if got, want := d.GetName(), "replaced"; got != want {
+				t.Errorf("got name %v, want %v", got, want)
+			}
+			if !bytes.Equal(d.GetData(&fimg), replacement) {
+				t.Error("replaced data does not match")
+			}
+
+			g, _, err := fimg.GetFromDescrID(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := g.Link, uint32(1); got != want {
+				t.Errorf("got link %v, want %v", got, want)
+			}
+			if !bytes.Equal(g.GetData(&fimg), []byte("generic")) {
+				t.Error("unrelated data does not match")
+			}
+
+			if got, want := fimg.Header.Dfree, h.Dfree; got != want {
+				t.Errorf("got %v free descriptors, want %v", got, want)
+			}
+			if err := fimg.checkStructure(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestReplaceObjectErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-replace-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{{
+			Datatype: DataDeffile,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     4,
+			Fname:    "def",
+			Data:     []byte("data"),
+		}},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	input := DescriptorInput{Datatype: DataLabels, Size: 2, Fname: "labels", Data: []byte("{}")}
+	if err := fimg.ReplaceObject(1, input); !errors.Is(err, errReplaceDatatype) {
+		t.Errorf("got error %v, want %v", err, errReplaceDatatype)
+	}
+	if err := fimg.ReplaceObject(2, input); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Images are reproducible when created with the Reproducible field of CreateInfo set, so that
+// creating an image twice from the same inputs yields identical files. Timestamps are fixed, owner
+// IDs are zeroed, and if no ID is specified, the image ID is derived from the image content.
+
+var errReproducibleStreamID = errors.New("streamed reproducible image requires an ID")
+
+// reproducibleNamespace is the namespace of image IDs derived from image content.
+var reproducibleNamespace = uuid.NewV5(uuid.NamespaceURL, "https://github.com/sylabs/sif")
+
+// reproducibleState holds the state of the creation of a reproducible image.
+type reproducibleState struct {
+	time int64     // timestamp recorded in the image
+	h    hash.Hash // hash of the image content, if the image ID is to be derived from it
+}
+
+// setReproducible configures fimg for the creation of a reproducible image, as specified by
+// cinfo.
+func (fimg *FileImage) setReproducible(cinfo CreateInfo) {
+	if !cinfo.Reproducible {
+		return
+	}
+
+	fimg.repro = &reproducibleState{}
+	if !cinfo.Time.IsZero() {
+		fimg.repro.time = cinfo.Time.Unix()
+	}
+	if uuid.Equal(cinfo.ID, uuid.Nil) {
+		fimg.repro.h = sha256.New()
+	}
+
+	fimg.Header.Ctime = fimg.repro.time
+	fimg.Header.Mtime = fimg.repro.time
+}
+
+// userIDs returns the owner IDs to record for a data object added to fimg.
+func (fimg *FileImage) userIDs() (int64, int64, error) {
+	if fimg.repro != nil {
+		return 0, 0, nil
+	}
+	return getUserIDs()
+}
+
+// contentWriter returns w, additionally writing to the content hash of fimg, if any.
+func (fimg *FileImage) contentWriter(w io.Writer) io.Writer {
+	if fimg.repro == nil || fimg.repro.h == nil {
+		return w
+	}
+	return io.MultiWriter(w, fimg.repro.h)
+}
+
+// deriveID sets the image ID from the data objects written to fimg and its descriptors, if
+// required.
+func (fimg *FileImage) deriveID() error {
+	if fimg.repro == nil || fimg.repro.h == nil {
+		return nil
+	}
+
+	h := fimg.repro.h
+	if err := binary.Write(h, binary.LittleEndian, fimg.DescrArr); err != nil {
+		return err
+	}
+	h.Write(fimg.Header.Launch[:])  // nolint:errcheck
+	h.Write(fimg.Header.Version[:]) // nolint:errcheck
+
+	fimg.Header.ID = uuid.NewV5(reproducibleNamespace, hex.EncodeToString(h.Sum(nil)))
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var errScannerNameInvalid = errors.New("scanner name invalid")
+
+// ScanFunc examines the contents of a file system, such as for vulnerabilities or licenses, and
+// returns a report in JSON format.
+type ScanFunc func(fsys fs.FS) (json.RawMessage, error)
+
+// FSOpener returns a view of the partition of type fstype, read from r, as an fs.FS. This package
+// does not implement any file system, so callers provide one suitable for the partitions they
+// expect to encounter.
+type FSOpener func(fstype Fstype, r io.ReaderAt, size int64) (fs.FS, error)
+
+var (
+	scannersMu sync.RWMutex
+	scanners   = make(map[string]ScanFunc)
+)
+
+// RegisterScanner makes the scanner fn available under the given name. The name is stored as the
+// name of the data objects that hold its reports. If RegisterScanner is called twice with the same
+// name, the second registration replaces the first. If fn is nil, the scanner is unregistered.
+func RegisterScanner(name string, fn ScanFunc) error {
+	if name == "" || len(name) > DescrNameLen || strings.Contains(name, "/") {
+		return fmt.Errorf("%w: %q", errScannerNameInvalid, name)
+	}
+
+	scannersMu.Lock()
+	defer scannersMu.Unlock()
+
+	if fn == nil {
+		delete(scanners, name)
+	} else {
+		scanners[name] = fn
+	}
+	return nil
+}
+
+// Scanners returns the sorted names of registered scanners.
+func Scanners() []string {
+	scannersMu.RLock()
+	defer scannersMu.RUnlock()
+
+	names := make([]string, 0, len(scanners))
+	for name := range scanners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getScanner returns the scanner registered under name.
+func getScanner(name string) (ScanFunc, bool) {
+	scannersMu.RLock()
+	defer scannersMu.RUnlock()
+
+	fn, ok := scanners[name]
+	return fn, ok
+}
+
+// Scan runs each registered scanner against the primary system partition of fimg, opened as a
+// file system using open. Each report is stored as a JSON data object linked to the primary
+// system partition, and named after the scanner that produced it. Reports left by an earlier
+// scan with the same scanner are deleted.
+func (fimg *FileImage) Scan(open FSOpener) error {
+	part, _, err := fimg.GetPartPrimSys()
+	if err != nil {
+		return fmt.Errorf("while getting primary system partition: %w", err)
+	}
+
+	fstype, err := part.GetFsType()
+	if err != nil {
+		return err
+	}
+
+	var r io.ReaderAt = fimg.Reader
+	if fimg.Amodebuf {
+		r = fimg.Fp
+	}
+
+	fsys, err := open(fstype, io.NewSectionReader(r, part.Fileoff, part.Filelen), part.Filelen)
+	if err != nil {
+		return fmt.Errorf("while opening primary system partition: %w", err)
+	}
+
+	// Keep a copy of the partition ID, as part points into the descriptor array, which is
+	// modified as reports are added.
+	id := part.ID
+
+	for _, name := range Scanners() {
+		fn, ok := getScanner(name)
+		if !ok {
+			continue
+		}
+
+		report, err := fn(fsys)
+		if err != nil {
+			return fmt.Errorf("scanner %s failed: %w", name, err)
+		}
+
+		if err := fimg.deleteScanReports(id, name); err != nil {
+			return err
+		}
+
+		di := DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrDefaultGroup,
+			Link:     id,
+			Fname:    name,
+			Data:     report,
+			Size:     int64(len(report)),
+		}
+		if err := fimg.AddObject(di); err != nil {
+			return fmt.Errorf("while adding report from scanner %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// GetScanReports returns the scan reports linked to the object with the given id, keyed by the
+// name of the scanner that produced them.
+func (fimg *FileImage) GetScanReports(id uint32) (map[string]json.RawMessage, error) {
+	descrs, _, err := fimg.GetLinkedDescrsByType(id, DataGenericJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make(map[string]json.RawMessage, len(descrs))
+	for _, d := range descrs {
+		b := make([]byte, d.Filelen)
+		if _, err := io.ReadFull(d.GetReadSeeker(fimg), b); err != nil {
+			return nil, fmt.Errorf("while reading scan report %d: %w", d.ID, err)
+		}
+		reports[d.GetName()] = b
+	}
+	return reports, nil
+}
+
+// deleteScanReports deletes reports named name that are linked to the object with the given id.
+func (fimg *FileImage) deleteScanReports(id uint32, name string) error {
+	descrs, _, err := fimg.GetLinkedDescrsByType(id, DataGenericJSON)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Collect IDs first, as deleting modifies the descriptor array.
+	var ids []uint32
+	for _, d := range descrs {
+		if d.GetName() == name {
+			ids = append(ids, d.ID)
+		}
+	}
+
+	for _, id := range ids {
+		if err := fimg.DeleteObject(id, 0); err != nil {
+			return fmt.Errorf("while deleting previous report from scanner %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestRegisterScanner(t *testing.T) {
+	fn := func(fs.FS) (json.RawMessage, error) { return nil, nil }
+
+	tests := []struct {
+		name     string
+		scanName string
+		fn       ScanFunc
+		wantErr  error
+		want     []string
+	}{
+		{"Empty", "", fn, errScannerNameInvalid, []string{}},
+		{"TooLong", string(make([]byte, DescrNameLen+1)), fn, errScannerNameInvalid, []string{}},
+		{"Slash", "a/b", fn, errScannerNameInvalid, []string{}},
+		{"Register", "licenses", fn, nil, []string{"licenses"}},
+		{"Unregister", "licenses", nil, nil, []string{}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := RegisterScanner(tt.scanName, tt.fn), tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if got, want := Scanners(), tt.want; !reflect.DeepEqual(got, want) {
+				t.Errorf("got scanners %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-scan-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	partData := []byte{0xfa, 0xce, 0xfe, 0xed}
+
+	part := DescriptorInput{
+		Datatype: DataPartition,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "part",
+		Data:     partData,
+		Size:     int64(len(partData)),
+	}
+	if err := part.SetPartExtra(FsRaw, PartPrimSys, HdrArchAMD64); err != nil {
+		t.Fatal(err)
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "scan.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{part},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := fstest.MapFS{
+		"LICENSE": &fstest.MapFile{Data: []byte("BSD-3-Clause")},
+	}
+
+	// open checks it is passed the primary system partition, and returns fsys.
+	open := func(fstype Fstype, r io.ReaderAt, size int64) (fs.FS, error) {
+		if got, want := fstype, Fstype(FsRaw); got != want {
+			t.Errorf("got fstype %v, want %v", got, want)
+		}
+
+		b, err := ioutil.ReadAll(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := b, partData; !reflect.DeepEqual(got, want) {
+			t.Errorf("got partition data %v, want %v", got, want)
+		}
+
+		return fsys, nil
+	}
+
+	// licenses reports the contents of the LICENSE file.
+	licenses := func(fsys fs.FS) (json.RawMessage, error) {
+		b, err := fs.ReadFile(fsys, "LICENSE")
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]string{"license": string(b)})
+	}
+
+	if err := RegisterScanner("licenses", licenses); err != nil {
+		t.Fatal(err)
+	}
+	defer RegisterScanner("licenses", nil) // nolint:errcheck
+
+	// Scan twice, to check the first report is replaced.
+	for i := 0; i < 2; i++ {
+		fimg, err := LoadContainer(cinfo.Pathname, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fimg.Scan(open); err != nil {
+			t.Fatalf("failed to scan: %v", err)
+		}
+
+		if err := fimg.UnloadContainer(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	reports, err := fimg.GetScanReports(1)
+	if err != nil {
+		t.Fatalf("failed to get scan reports: %v", err)
+	}
+
+	want := map[string]json.RawMessage{
+		"licenses": json.RawMessage(`{"license":"BSD-3-Clause"}`),
+	}
+	if got := reports; !reflect.DeepEqual(got, want) {
+		t.Errorf("got reports %s, want %s", got, want)
+	}
+
+	descrs, _, err := fimg.GetLinkedDescrsByType(1, DataGenericJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(descrs), 1; got != want {
+		t.Errorf("got %v reports, want %v", got, want)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrSealed is the code for when an operation would modify a sealed image.
+var ErrSealed = errors.New("image is sealed")
+
+var (
+	errSealUnsupported = errors.New("sealing requires SIF version 02 or later")
+	errObjectBounds    = errors.New("data object out of bounds")
+	errObjectOverlap   = errors.New("data objects overlap")
+	errLinkInvalid     = errors.New("link references unknown object")
+)
+
+// ManifestName is the name of the manifest object added to an image when it is sealed.
+const ManifestName = "sif-manifest.json"
+
+// ManifestEntry describes a data object recorded in the manifest of a sealed image.
+type ManifestEntry struct {
+	ID       uint32 `json:"id"`
+	Name     string `json:"name"`
+	Datatype string `json:"datatype"`
+	Size     int64  `json:"size"`
+	Digest   string `json:"digest"`
+}
+
+// Manifest is the content of the manifest object added to an image when it is sealed.
+type Manifest struct {
+	Objects []ManifestEntry `json:"objects"`
+}
+
+// sealOpts accumulates image sealing options.
+type sealOpts struct {
+	sign func(*FileImage) error
+}
+
+// SealOpt are used to specify image sealing options.
+type SealOpt func(*sealOpts) error
+
+// OptSealSign specifies that fn be called to sign the image, after the manifest is added and
+// before the image is sealed. Signing is performed by the caller, typically using the integrity
+// package, as signatures must be added to the image while it may still be modified.
+func OptSealSign(fn func(*FileImage) error) SealOpt {
+	return func(so *sealOpts) error {
+		so.sign = fn
+		return nil
+	}
+}
+
+// IsSealed returns true if the image is sealed.
+func (fimg *FileImage) IsSealed() bool {
+	return fimg.flags&hdrFlagSealed != 0
+}
+
+// checkWritable returns ErrSealed, ErrThin or errReaderAtReadOnly if fimg may not be modified.
+func (fimg *FileImage) checkWritable() error {
+	if _, ok := fimg.Fp.(*readerAtFile); ok {
+		return errReaderAtReadOnly
+	}
+	if fimg.IsSealed() {
+		return ErrSealed
+	}
+	if fimg.IsThin() {
+		return ErrThin
+	}
+	return nil
+}
+
+// checkStructure validates the layout of the used descriptors in fimg. Each data object must lie
+// within the data section of the image, no two data objects may overlap, and each link must
+// reference an existing object or group.
+func (fimg *FileImage) checkStructure() error {
+	ids := make(map[uint32]bool)
+	groups := make(map[uint32]bool)
+	for _, d := range fimg.DescrArr {
+		if d.Used {
+			ids[d.ID] = true
+			groups[d.Groupid&^DescrGroupMask] = true
+		}
+	}
+
+	end := fimg.Header.Dataoff + fimg.Header.Datalen
+
+	for i, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+
+		if d.Fileoff < fimg.Header.Dataoff || d.Filelen < 0 || d.Fileoff > end-d.Filelen {
+			return fmt.Errorf("%w: object %d", errObjectBounds, d.ID)
+		}
+
+		for _, o := range fimg.DescrArr[i+1:] {
+			if !o.Used || d.Filelen == 0 || o.Filelen == 0 {
+				continue
+			}
+			if d.Fileoff < o.Fileoff+o.Filelen && o.Fileoff < d.Fileoff+d.Filelen {
+				return fmt.Errorf("%w: objects %d and %d", errObjectOverlap, d.ID, o.ID)
+			}
+		}
+
+		if d.Link == DescrUnusedLink {
+			continue
+		}
+		if d.Link&DescrGroupMask != 0 {
+			if !groups[d.Link&^DescrGroupMask] {
+				return fmt.Errorf("%w: object %d links to group %d", errLinkInvalid, d.ID, d.Link&^DescrGroupMask)
+			}
+		} else if !ids[d.Link] {
+			return fmt.Errorf("%w: object %d links to object %d", errLinkInvalid, d.ID, d.Link)
+		}
+	}
+
+	return nil
+}
+
+// getManifest returns a manifest describing the used descriptors in fimg.
+func (fimg *FileImage) getManifest() (Manifest, error) {
+	m := Manifest{Objects: []ManifestEntry{}}
+
+	for _, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(h, d.GetReadSeeker(fimg)); err != nil {
+			return Manifest{}, fmt.Errorf("computing digest of object %d: %s", d.ID, err)
+		}
+
+		m.Objects = append(m.Objects, ManifestEntry{
+			ID:       d.ID,
+			Name:     d.GetName(),
+			Datatype: d.Datatype.String(),
+			Size:     d.Filelen,
+			Digest:   "sha256:" + hex.EncodeToString(h.Sum(nil)),
+		})
+	}
+
+	return m, nil
+}
+
+// remap refreshes the view of fimg following the addition of data objects, so that their data
+// may be read.
+func (fimg *FileImage) remap() error {
+	if err := fimg.unmapFile(); err != nil {
+		return err
+	}
+	return fimg.mapFile(false)
+}
+
+// Seal finalizes the image for release. The structure of the image is validated, and a manifest
+// object recording the digest of each data object is added. If requested with OptSealSign, the
+// image is then signed. Finally, the image is marked as sealed, following which AddObject,
+// DeleteObject and SetPrimPart return ErrSealed.
+//
+// Sealing requires an image of SIF version 02 or later, loaded read-write.
+func (fimg *FileImage) Seal(opts ...SealOpt) error {
+	so := sealOpts{}
+	for _, opt := range opts {
+		if err := opt(&so); err != nil {
+			return err
+		}
+	}
+
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if !hasHeaderExt(fimg.Header.GetVersion()) {
+		return errSealUnsupported
+	}
+
+	if err := fimg.checkStructure(); err != nil {
+		return fmt.Errorf("validating image structure: %w", err)
+	}
+
+	m, err := fimg.getManifest()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	err = fimg.AddObject(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(b)),
+		Fname:    ManifestName,
+		Data:     b,
+	})
+	if err != nil {
+		return fmt.Errorf("adding manifest: %w", err)
+	}
+
+	if so.sign != nil {
+		if err := fimg.remap(); err != nil {
+			return err
+		}
+		if err := so.sign(fimg); err != nil {
+			return fmt.Errorf("signing image: %w", err)
+		}
+	}
+
+	fimg.flags |= hdrFlagSealed
+	if err := writeHeader(fimg); err != nil {
+		fimg.flags &^= hdrFlagSealed
+		return err
+	}
+
+	if err := fimg.Fp.Sync(); err != nil {
+		return fmt.Errorf("while sync'ing sealed SIF file: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestSeal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-seal-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	generic := DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     4,
+		Fname:    "generic",
+		Data:     []byte("data"),
+	}
+
+	create := func(name, version string) string {
+		cinfo := CreateInfo{
+			Pathname:   filepath.Join(dir, name),
+			Launchstr:  HdrLaunch,
+			Sifversion: version,
+			ID:         uuid.NewV4(),
+			InputDescr: []DescriptorInput{generic},
+		}
+		if _, err := CreateContainer(cinfo); err != nil {
+			t.Fatal(err)
+		}
+		return cinfo.Pathname
+	}
+
+	t.Run("Version1", func(t *testing.T) {
+		fimg, err := LoadContainer(create("v1.sif", HdrVersion1), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		if err := fimg.Seal(); !errors.Is(err, errSealUnsupported) {
+			t.Errorf("got error %v, want %v", err, errSealUnsupported)
+		}
+	})
+
+	t.Run("Sign", func(t *testing.T) {
+		path := create("v2.sif", HdrVersion2)
+
+		fimg, err := LoadContainer(path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The sign function must be able to read the manifest, and add objects to the image.
+		var manifest []byte
+		sign := func(f *FileImage) error {
+			d, _, err := f.GetFromDescrID(2)
+			if err != nil {
+				return err
+			}
+			manifest = append([]byte(nil), d.GetData(f)...)
+
+			sig := generic
+			sig.Fname = "signature"
+			sig.Link = DescrDefaultGroup
+			return f.AddObject(sig)
+		}
+
+		if err := fimg.Seal(OptSealSign(sign)); err != nil {
+			t.Fatal(err)
+		}
+
+		if !fimg.IsSealed() {
+			t.Error("image not sealed")
+		}
+		if err := fimg.AddObject(generic); !errors.Is(err, ErrSealed) {
+			t.Errorf("AddObject: got error %v, want %v", err, ErrSealed)
+		}
+		if err := fimg.UnloadContainer(); err != nil {
+			t.Fatal(err)
+		}
+
+		var m Manifest
+		if err := json.Unmarshal(manifest, &m); err != nil {
+			t.Fatalf("failed to read manifest from sign function: %v", err)
+		}
+		want := ManifestEntry{
+			ID:       1,
+			Name:     "generic",
+			Datatype: DataGeneric.String(),
+			Size:     4,
+			Digest:   "sha256:3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7",
+		}
+		if len(m.Objects) != 1 || m.Objects[0] != want {
+			t.Errorf("got manifest %+v, want %+v", m.Objects, want)
+		}
+
+		// The seal must persist.
+		fimg, err = LoadContainer(path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		if !fimg.IsSealed() {
+			t.Error("image not sealed after reload")
+		}
+		if got, want := fimg.Header.Dtotal-fimg.Header.Dfree, int64(3); got != want {
+			t.Errorf("got %v objects, want %v", got, want)
+		}
+		if err := fimg.AddObject(generic); !errors.Is(err, ErrSealed) {
+			t.Errorf("AddObject: got error %v, want %v", err, ErrSealed)
+		}
+		if err := fimg.DeleteObject(1, DelZero); !errors.Is(err, ErrSealed) {
+			t.Errorf("DeleteObject: got error %v, want %v", err, ErrSealed)
+		}
+		if err := fimg.SetPrimPart(1); !errors.Is(err, ErrSealed) {
+			t.Errorf("SetPrimPart: got error %v, want %v", err, ErrSealed)
+		}
+		if err := fimg.Seal(); !errors.Is(err, ErrSealed) {
+			t.Errorf("Seal: got error %v, want %v", err, ErrSealed)
+		}
+	})
+}
+
+func TestCheckStructure(t *testing.T) {
+	hdr := Header{Dataoff: 4096, Datalen: 200}
+
+	tests := []struct {
+		name    string
+		descrs  []Descriptor
+		wantErr error
+	}{
+		{
+			name: "OK",
+			descrs: []Descriptor{
+				{Used: true, ID: 1, Groupid: DescrDefaultGroup, Fileoff: 4096, Filelen: 100},
+				{Used: true, ID: 2, Link: 1, Fileoff: 4196, Filelen: 100},
+				{Used: true, ID: 3, Link: DescrDefaultGroup, Fileoff: 4296, Filelen: 0},
+			},
+		},
+		{
+			name: "OutOfBounds",
+			descrs: []Descriptor{
+				{Used: true, ID: 1, Fileoff: 4196, Filelen: 101},
+			},
+			wantErr: errObjectBounds,
+		},
+		{
+			name: "Overlap",
+			descrs: []Descriptor{
+				{Used: true, ID: 1, Fileoff: 4096, Filelen: 100},
+				{Used: true, ID: 2, Fileoff: 4195, Filelen: 100},
+			},
+			wantErr: errObjectOverlap,
+		},
+		{
+			name: "LinkObject",
+			descrs: []Descriptor{
+				{Used: true, ID: 1, Link: 2, Fileoff: 4096, Filelen: 100},
+			},
+			wantErr: errLinkInvalid,
+		},
+		{
+			name: "LinkGroup",
+			descrs: []Descriptor{
+				{Used: true, ID: 1, Groupid: DescrDefaultGroup, Link: DescrGroupMask | 2, Fileoff: 4096, Filelen: 100},
+			},
+			wantErr: errLinkInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fimg := FileImage{Header: hdr, DescrArr: tt.descrs}
+
+			if got, want := fimg.checkStructure(), tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
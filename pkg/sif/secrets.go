@@ -0,0 +1,195 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Secrets, such as credentials to be injected alongside an image, are stored in a DataSecrets
+// object. The content of a secrets object is always encrypted, using a key supplied by the
+// caller, and is only decrypted by OpenSecrets, into memory that is locked where possible, so that
+// it is not written to swap. Decrypted secrets are never written to a file by this package.
+
+var (
+	errNotSecrets          = errors.New("not a secrets object")
+	errSecretsNotEncrypted = errors.New("secrets object must be created with NewSecretsInput")
+	errSecretsKeyInvalid   = errors.New("secrets key invalid")
+
+	// ErrSecretsAuthentication is the error returned when secrets cannot be decrypted, as the key
+	// is incorrect or the object has been modified.
+	ErrSecretsAuthentication = errors.New("secrets authentication failed")
+)
+
+// SecretsKeySize is the size, in bytes, of the key used to encrypt secrets.
+const SecretsKeySize = 32
+
+// secretsNonceLen is the size, in bytes, of the nonce used to encrypt secrets.
+const secretsNonceLen = 12
+
+// newSecretsAEAD returns the AEAD used to encrypt secrets with key.
+func newSecretsAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != SecretsKeySize {
+		return nil, fmt.Errorf("%w: got %d bytes, want %d", errSecretsKeyInvalid, len(key), SecretsKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, secretsNonceLen)
+}
+
+// NewSecretsInput returns a DescriptorInput for a secrets object holding secrets, encrypted with
+// key, which must be SecretsKeySize bytes long. The caller remains responsible for clearing
+// secrets and key once they are no longer needed.
+func NewSecretsInput(key, secrets []byte) (DescriptorInput, error) {
+	aead, err := newSecretsAEAD(key)
+	if err != nil {
+		return DescriptorInput{}, err
+	}
+
+	extra := Secrets{Cipher: SecretsAES256GCM}
+	if _, err := io.ReadFull(rand.Reader, extra.Nonce[:]); err != nil {
+		return DescriptorInput{}, fmt.Errorf("generating nonce: %s", err)
+	}
+
+	data := aead.Seal(nil, extra.Nonce[:], secrets, nil)
+
+	di := DescriptorInput{
+		Datatype: DataSecrets,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(data)),
+		Fname:    "secrets",
+		Data:     data,
+	}
+
+	// serialize the secrets data for integration with the base descriptor input
+	if err := binary.Write(&di.Extra, binary.LittleEndian, extra); err != nil {
+		return DescriptorInput{}, err
+	}
+	return di, nil
+}
+
+// checkSecrets returns an error if input describes a secrets object that was not created with
+// NewSecretsInput.
+func checkSecrets(input DescriptorInput) error {
+	if input.Datatype != DataSecrets {
+		return nil
+	}
+
+	var extra Secrets
+	if err := binary.Read(bytes.NewReader(input.Extra.Bytes()), binary.LittleEndian, &extra); err != nil {
+		return errSecretsNotEncrypted
+	}
+	if extra.Cipher != SecretsAES256GCM {
+		return errSecretsNotEncrypted
+	}
+	return nil
+}
+
+// getSecrets extracts the Secrets from the Extra field of a Secrets Descriptor.
+func (d *Descriptor) getSecrets() (Secrets, error) {
+	var sinfo Secrets
+
+	if d.Datatype != DataSecrets {
+		return sinfo, fmt.Errorf("%w: got %v", errNotSecrets, d.Datatype)
+	}
+
+	b := bytes.NewReader(d.Extra[:])
+	if err := binary.Read(b, binary.LittleEndian, &sinfo); err != nil {
+		return sinfo, fmt.Errorf("while extracting secrets extra info: %s", err)
+	}
+
+	return sinfo, nil
+}
+
+// GetSecretsCipher extracts the cipher used to encrypt the secrets from the Extra field of a
+// Secrets Descriptor.
+func (d *Descriptor) GetSecretsCipher() (SecretsCipher, error) {
+	sinfo, err := d.getSecrets()
+	if err != nil {
+		return 0, err
+	}
+	return sinfo.Cipher, nil
+}
+
+// SecretBuffer holds decrypted secrets, in memory that is locked where possible. Destroy must be
+// called once the secrets are no longer needed, to clear and release the memory.
+type SecretBuffer struct {
+	b      []byte
+	locked bool
+}
+
+// Bytes returns the decrypted secrets. The returned slice must not be retained after Destroy is
+// called.
+func (sb *SecretBuffer) Bytes() []byte {
+	return sb.b
+}
+
+// Locked returns true if the memory holding the secrets is locked, so that it is not written to
+// swap. Locking may fail where the limit on locked memory of the process is exceeded.
+func (sb *SecretBuffer) Locked() bool {
+	return sb.locked
+}
+
+// Destroy clears the secrets held by sb, and releases the memory holding them.
+func (sb *SecretBuffer) Destroy() error {
+	if sb.b == nil {
+		return nil
+	}
+
+	for i := range sb.b {
+		sb.b[i] = 0
+	}
+
+	err := freeLocked(sb.b, sb.locked)
+	sb.b, sb.locked = nil, false
+	return err
+}
+
+// OpenSecrets decrypts the secrets held by the secrets object described by d using key, into
+// memory that is locked where possible. If key is incorrect, or the object has been modified, an
+// error wrapping ErrSecretsAuthentication is returned.
+func (d *Descriptor) OpenSecrets(fimg *FileImage, key []byte) (*SecretBuffer, error) {
+	sinfo, err := d.getSecrets()
+	if err != nil {
+		return nil, err
+	}
+	if sinfo.Cipher != SecretsAES256GCM {
+		return nil, fmt.Errorf("%w: secrets cipher %d", ErrUnknownType, sinfo.Cipher)
+	}
+
+	aead, err := newSecretsAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := d.GetData(fimg)
+	if len(data) < aead.Overhead() {
+		return nil, fmt.Errorf("%w: object %d is too short", ErrSecretsAuthentication, d.ID)
+	}
+
+	b, locked, err := allocLocked(len(data) - aead.Overhead())
+	if err != nil {
+		return nil, fmt.Errorf("allocating memory for secrets: %s", err)
+	}
+	sb := &SecretBuffer{b: b, locked: locked}
+
+	// The buffer has capacity for the plaintext, so it is decrypted in place without copying.
+	if _, err := aead.Open(b[:0], sinfo.Nonce[:], data, nil); err != nil {
+		sb.Destroy() // nolint:errcheck
+		return nil, fmt.Errorf("%w: object %d", ErrSecretsAuthentication, d.ID)
+	}
+	return sb, nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-secrets-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := bytes.Repeat([]byte{0x5a}, SecretsKeySize)
+	secrets := []byte("password=hunter2")
+
+	input, err := NewSecretsInput(key, secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "secrets.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{input},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(cinfo.Pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, secrets) {
+		t.Error("secrets stored in plaintext")
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true, OptLoadStrict(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := d.GetSecretsCipher(); err != nil {
+		t.Fatal(err)
+	} else if c != SecretsAES256GCM {
+		t.Errorf("got cipher %v, want %v", c, SecretsAES256GCM)
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		wantErr error
+	}{
+		{"OK", key, nil},
+		{"WrongKey", bytes.Repeat([]byte{0xa5}, SecretsKeySize), ErrSecretsAuthentication},
+		{"ShortKey", key[:16], errSecretsKeyInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sb, err := d.OpenSecrets(&fimg, tt.key)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			if got := sb.Bytes(); !bytes.Equal(got, secrets) {
+				t.Errorf("got secrets %q, want %q", got, secrets)
+			}
+
+			if err := sb.Destroy(); err != nil {
+				t.Fatal(err)
+			}
+			if sb.Bytes() != nil {
+				t.Error("secrets not released")
+			}
+		})
+	}
+}
+
+func TestSecretsNotEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-secrets-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "plaintext.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			{
+				Datatype: DataSecrets,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     8,
+				Fname:    "secrets",
+				Data:     []byte("hunter2!"),
+			},
+		},
+	}
+	if _, err := CreateContainer(cinfo); !errors.Is(err, errSecretsNotEncrypted) {
+		t.Errorf("got error %v, want %v", err, errSecretsNotEncrypted)
+	}
+}
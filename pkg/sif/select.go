@@ -0,0 +1,103 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+// DescriptorFilter returns true if descriptor d is selected.
+type DescriptorFilter func(d Descriptor) bool
+
+// WithDataType selects descriptors of data objects of type t.
+func WithDataType(t Datatype) DescriptorFilter {
+	return func(d Descriptor) bool {
+		return d.Datatype == t
+	}
+}
+
+// WithID selects the descriptor of the data object with the specified id.
+func WithID(id uint32) DescriptorFilter {
+	return func(d Descriptor) bool {
+		return d.ID == id
+	}
+}
+
+// WithGroup selects descriptors of data objects in the object group with the specified groupID.
+// The group ID is supplied as displayed, without DescrGroupMask.
+func WithGroup(groupID uint32) DescriptorFilter {
+	return func(d Descriptor) bool {
+		return d.Groupid == groupID|DescrGroupMask
+	}
+}
+
+// WithLinkedID selects descriptors of data objects linked to the data object with the specified
+// id.
+func WithLinkedID(id uint32) DescriptorFilter {
+	return func(d Descriptor) bool {
+		return d.Link&DescrGroupMask == 0 && d.Link == id
+	}
+}
+
+// WithLinkedGroup selects descriptors of data objects linked to the object group with the
+// specified groupID, such as signatures of the group. The group ID is supplied as displayed,
+// without DescrGroupMask.
+func WithLinkedGroup(groupID uint32) DescriptorFilter {
+	return func(d Descriptor) bool {
+		return d.Link == groupID|DescrGroupMask
+	}
+}
+
+// WithName selects descriptors of data objects with the specified name.
+func WithName(name string) DescriptorFilter {
+	return func(d Descriptor) bool {
+		return d.GetName() == name
+	}
+}
+
+// WithDescriptors calls fn with each used descriptor, in descriptor table order, until fn returns
+// true. Unlike ranging over DescrArr, unused descriptors are skipped, and callers do not depend on
+// the layout of the descriptor table.
+func (fimg *FileImage) WithDescriptors(fn func(d Descriptor) bool) {
+	for _, v := range fimg.DescrArr {
+		if !v.Used {
+			continue
+		}
+		if fn(v) {
+			return
+		}
+	}
+}
+
+// GetDescriptors returns the used descriptors selected by all filters, in descriptor table order.
+// If no filters are supplied, all used descriptors are returned.
+func (fimg *FileImage) GetDescriptors(filters ...DescriptorFilter) []Descriptor {
+	var descrs []Descriptor
+
+	fimg.WithDescriptors(func(d Descriptor) bool {
+		for _, f := range filters {
+			if !f(d) {
+				return false
+			}
+		}
+		descrs = append(descrs, d)
+		return false
+	})
+
+	return descrs
+}
+
+// GetDescriptor returns the single used descriptor selected by all filters. If no descriptor is
+// selected, ErrNotFound is returned. If more than one descriptor is selected, ErrMultValues is
+// returned.
+func (fimg *FileImage) GetDescriptor(filters ...DescriptorFilter) (Descriptor, error) {
+	descrs := fimg.GetDescriptors(filters...)
+
+	switch len(descrs) {
+	case 0:
+		return Descriptor{}, ErrNotFound
+	case 1:
+		return descrs[0], nil
+	default:
+		return Descriptor{}, ErrMultValues
+	}
+}
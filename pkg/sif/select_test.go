@@ -0,0 +1,102 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGetDescriptors(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	tests := []struct {
+		name    string
+		filters []DescriptorFilter
+		wantIDs []uint32
+	}{
+		{"All", nil, []uint32{1, 2, 3}},
+		{"DataType", []DescriptorFilter{WithDataType(DataPartition)}, []uint32{2}},
+		{"ID", []DescriptorFilter{WithID(3)}, []uint32{3}},
+		{"Group", []DescriptorFilter{WithGroup(1)}, []uint32{1, 2, 3}},
+		{"GroupNotFound", []DescriptorFilter{WithGroup(2)}, nil},
+		{"LinkedID", []DescriptorFilter{WithLinkedID(2)}, []uint32{3}},
+		{"LinkedGroup", []DescriptorFilter{WithLinkedGroup(1)}, nil},
+		{"Name", []DescriptorFilter{WithName("busybox.deffile")}, []uint32{1}},
+		{"Combined", []DescriptorFilter{WithGroup(1), WithDataType(DataSignature)}, []uint32{3}},
+		{"CombinedNotFound", []DescriptorFilter{WithDataType(DataDeffile), WithLinkedID(2)}, nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []uint32
+			for _, d := range fimg.GetDescriptors(tt.filters...) {
+				ids = append(ids, d.ID)
+			}
+
+			if got, want := ids, tt.wantIDs; !reflect.DeepEqual(got, want) {
+				t.Errorf("got IDs %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestGetDescriptor(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	tests := []struct {
+		name    string
+		filters []DescriptorFilter
+		wantID  uint32
+		wantErr error
+	}{
+		{"One", []DescriptorFilter{WithDataType(DataSignature)}, 3, nil},
+		{"NotFound", []DescriptorFilter{WithDataType(DataLabels)}, 0, ErrNotFound},
+		{"Multiple", []DescriptorFilter{WithGroup(1)}, 0, ErrMultValues},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := fimg.GetDescriptor(tt.filters...)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			if got, want := d.ID, tt.wantID; got != want {
+				t.Errorf("got ID %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithDescriptors(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	var ids []uint32
+	fimg.WithDescriptors(func(d Descriptor) bool {
+		ids = append(ids, d.ID)
+		return d.ID == 2
+	})
+
+	if got, want := ids, []uint32{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got IDs %v, want %v", got, want)
+	}
+}
@@ -84,8 +84,10 @@ package sif
 
 import (
 	"bytes"
+	"hash"
 	"io"
 	"os"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -94,7 +96,11 @@ import (
 const (
 	HdrLaunch       = "#!/usr/bin/env run-singularity\n"
 	HdrMagic        = "SIF_MAGIC" // SIF identification
-	HdrVersion      = "01"        // SIF SPEC VERSION
+	HdrVersion      = "01"        // SIF SPEC VERSION written by default
+	HdrVersion1     = "01"        // SIF SPEC VERSION without header checksums
+	HdrVersion2     = "02"        // SIF SPEC VERSION with a checksummed header extension
+	HdrVersion3     = "03"        // SIF SPEC VERSION with a descriptor table grown on demand
+	HdrVersionMax   = HdrVersion3 // latest SIF SPEC VERSION understood
 	HdrArchUnknown  = "00"        // Undefined/Unsupported arch
 	HdrArch386      = "01"        // 386 (i[3-6]86) arch code
 	HdrArchAMD64    = "02"        // AMD64 arch code
@@ -107,6 +113,7 @@ const (
 	HdrArchMIPS64   = "09"        // MIPS64 arch code
 	HdrArchMIPS64le = "10"        // MIPS64 little-endian arch code
 	HdrArchS390x    = "11"        // IBM s390x arch code
+	HdrArchMulti    = "99"        // multiple architectures, one primary partition per arch
 
 	HdrLaunchLen  = 32 // len("#!/usr/bin/env... ")
 	HdrMagicLen   = 10 // len("SIF_MAGIC")
@@ -114,6 +121,7 @@ const (
 	HdrArchLen    = 3  // len("99")
 
 	DescrNumEntries   = 48                 // the default total number of available descriptors
+	DescrMaxEntries   = 65536              // the maximum total number of available descriptors
 	DescrGroupMask    = 0xf0000000         // groups start at that offset
 	DescrUnusedGroup  = DescrGroupMask     // descriptor without a group
 	DescrDefaultGroup = DescrGroupMask | 1 // first groupid number created
@@ -121,6 +129,8 @@ const (
 	DescrEntityLen    = 256                // len("Joe Bloe <jbloe@gmail.com>...")
 	DescrNameLen      = 128                // descriptor name (string identifier)
 	DescrMaxPrivLen   = 384                // size reserved for descriptor specific data
+	DescrMediaTypeLen = 224                // len("application/vnd.oci.image.layer...")
+	DescrDigestLen    = 160                // len("sha512:...")
 	DescrStartOffset  = 4096               // where descriptors start after global header
 	DataStartOffset   = 32768              // where data object start after descriptors
 )
@@ -138,6 +148,21 @@ const (
 	DataGenericJSON                            // generic JSON meta-data
 	DataGeneric                                // generic / raw data
 	DataCryptoMessage                          // cryptographic message data object
+	DataSBOM                                   // software bill of materials
+	_                                          // reserved for the OCI root index (0x400a)
+	DataOCIBlob                                // OCI image layer or other blob
+)
+
+// List of SIF data types specific to this implementation. These are numbered apart from the types
+// above, so that they do not collide with types assigned by other implementations.
+const (
+	DataBuildLog    Datatype = iota + 0x4101 // structured image build log
+	DataBundle                               // bundle of named files
+	DataHealthCheck                          // health check probe definitions
+	DataOCIConfig                            // OCI image config
+	DataPlaceholder                          // space reserved for an object bound later
+	DataSecrets                              // encrypted secrets, such as credentials
+	DataProvenance                           // parent images from which the image derives
 )
 
 // Fstype represents the different SIF file system types found in partition data objects.
@@ -173,6 +198,7 @@ const (
 	HashSHA512
 	HashBLAKE2S
 	HashBLAKE2B
+	HashBLAKE3 // not FIPS approved, for data object checksums only
 )
 
 // Formattype represents the different formats used to store cryptographic message objects.
@@ -182,6 +208,8 @@ type Formattype int32
 const (
 	FormatOpenPGP Formattype = iota + 1
 	FormatPEM
+	FormatJWS
+	FormatSigEnvelope
 )
 
 // Messagetype represents the different messages stored within cryptographic message objects.
@@ -194,6 +222,32 @@ const (
 
 	// PEM formatted messages
 	MessageRSAOAEP Messagetype = 0x200
+
+	// JWS formatted messages
+	MessageNotationSignature Messagetype = 0x300
+
+	// signature envelope formatted messages
+	MessagePQSignature Messagetype = 0x400
+)
+
+// SBOMFormat represents the different formats used to store software bill of materials objects.
+type SBOMFormat int32
+
+// List of supported SBOM formats.
+const (
+	SBOMFormatCycloneDXJSON SBOMFormat = iota + 1 // CycloneDX, JSON encoded
+	SBOMFormatCycloneDXXML                        // CycloneDX, XML encoded
+	SBOMFormatSPDXJSON                            // SPDX, JSON encoded
+	SBOMFormatSPDXTagValue                        // SPDX, tag-value encoded
+)
+
+// Compression represents the different methods used to compress data objects.
+type Compression int32
+
+// List of supported compression methods.
+const (
+	CompressionNone Compression = iota // data object not compressed
+	CompressionGzip                    // gzip, as described by RFC 1952
 )
 
 // SIF data object deletion strategies.
@@ -202,6 +256,20 @@ const (
 	DelCompact            // free the space used by data object
 )
 
+// Placement represents a hint as to where a data object is placed within the data section of a
+// new SIF file. Hot objects are placed first, nearest the descriptor table, followed by objects
+// without a hint, followed by cold objects. Within each region, objects keep their input order.
+// Clustering small, frequently-read objects near the descriptor table improves locality for
+// readers that only inspect image metadata, such as over network file systems.
+type Placement int
+
+// List of supported placement hints.
+const (
+	PlacementDefault Placement = iota // placed in input order, after hot objects
+	PlacementHot                      // placed near the descriptor table
+	PlacementCold                     // placed at the end of the data section
+)
+
 // Descriptor represents the SIF descriptor type.
 type Descriptor struct {
 	Datatype Datatype // informs of descriptor type
@@ -260,6 +328,37 @@ type CryptoMessage struct {
 	Messagetype Messagetype
 }
 
+// SBOM represents the SIF software bill of materials object descriptor.
+type SBOM struct {
+	Format SBOMFormat
+}
+
+// OCIBlob represents the SIF OCI config and OCI blob data object descriptors.
+type OCIBlob struct {
+	MediaType [DescrMediaTypeLen]byte // OCI media type of the content
+	Digest    [DescrDigestLen]byte    // OCI digest of the content, such as "sha256:..."
+}
+
+// Placeholder represents the SIF placeholder data object descriptor.
+type Placeholder struct {
+	Datatype Datatype             // datatype of the object to be bound
+	Digest   [DescrDigestLen]byte // approved digest of the content, such as "sha256:...", if any
+}
+
+// SecretsCipher represents the ciphers used to encrypt secrets data objects.
+type SecretsCipher int32
+
+// List of supported secrets ciphers.
+const (
+	SecretsAES256GCM SecretsCipher = iota + 1 // AES-256 in Galois/Counter Mode
+)
+
+// Secrets represents the SIF secrets data object descriptor.
+type Secrets struct {
+	Cipher SecretsCipher         // cipher used to encrypt the secrets
+	Nonce  [secretsNonceLen]byte // nonce used to encrypt the secrets
+}
+
 // Header describes a loaded SIF file.
 type Header struct {
 	Launch [HdrLaunchLen]byte // #! shell execution line
@@ -309,29 +408,59 @@ type FileImage struct {
 	Reader     *bytes.Reader // reader on top of Mapdata
 	DescrArr   []Descriptor  // slice of loaded descriptors from SIF file
 	PrimPartID uint32        // ID of primary system partition if present
+
+	flags       uint32       // header extension flags, for SIF version 02 and later
+	limiter     *RateLimiter // limits data object I/O, if set
+	signalGuard bool         // defer termination signals during mutations
+	locked      bool         // advisory lock held on the backing file
+	clock       Clock        // source of timestamps, if not the system clock
+	bufferSize  int          // size of the buffer data objects are copied through, if set
+	descrCRCErr error        // descriptor table checksum mismatch ignored when loaded, if any
+
+	maxDecompressed int64 // largest data object GetData decompresses into memory, if set
+
+	repro *reproducibleState // set while a reproducible image is created
 }
 
 // CreateInfo wraps all SIF file creation info needed.
 type CreateInfo struct {
 	Pathname   string            // the end result output filename
 	Launchstr  string            // the shell run command
-	Sifversion string            // the SIF specification version used
+	Sifversion string            // the SIF specification version used, such as HdrVersion
 	ID         uuid.UUID         // image unique identifier
 	InputDescr []DescriptorInput // slice of input info for descriptor creation
+	StripeSize int64             // if non-zero, stripe data across companion files of this size (SIF 02+)
+	DescrCount int64             // descriptors to reserve, DescrNumEntries if zero
+	DataOffset int64             // where data objects start, derived from DescrCount if zero
+	Mode       os.FileMode       // permissions of the file(s) created, DefaultFileMode if zero
+
+	Reproducible bool      // fix timestamps and owner IDs, and derive ID from content if unset
+	Time         time.Time // timestamp recorded if Reproducible, the Unix epoch if zero
+	Clock        Clock     // source of timestamps if not Reproducible, the system clock if nil
+
+	DescrChecksum bool // record a checksum of the descriptor table, verified on load
+	BufferSize    int  // size of the buffer data objects are copied through, DefaultBufferSize if zero
 }
 
 // DescriptorInput describes the common info needed to create a data object descriptor.
 type DescriptorInput struct {
-	Datatype  Datatype // datatype being harvested for new descriptor
-	Groupid   uint32   // group to be set for new descriptor
-	Link      uint32   // link to be set for new descriptor
-	Size      int64    // size of the data object for the new descriptor
-	Alignment int      // Align requirement for data object
+	Datatype  Datatype  // datatype being harvested for new descriptor
+	Groupid   uint32    // group to be set for new descriptor
+	Link      uint32    // link to be set for new descriptor
+	Size      int64     // size of the data object for the new descriptor
+	Alignment int       // alignment of data object in bytes, a power of two (default page size)
+	Placement Placement // placement hint, honoured by CreateContainer only
+	Sparse    bool      // leave blocks of zeros as holes in the image file, where supported
+
+	Compression Compression // compress data object as it is written, read back transparently
+	Checksum    Hashtype    // record a checksum of the data object as stored, if non-zero
 
 	Fname string    // file containing data associated with the new descriptor
 	Fp    io.Reader // file pointer to opened 'fname'
 	Data  []byte    // loaded data from file
 
+	Hashes []hash.Hash // written the data object as stored, to obtain its digests in one pass
+
 	Image *FileImage  // loaded SIF file in memory
 	Descr *Descriptor // created end result descriptor
 
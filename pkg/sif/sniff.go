@@ -0,0 +1,172 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// ErrContentMismatch is the code for when the content of a data object does not match its
+// declared Datatype.
+var ErrContentMismatch = errors.New("content does not match declared type")
+
+// ContentType represents the type of data object content, as detected by sniffing.
+type ContentType string
+
+// List of detected content types.
+const (
+	ContentEmpty     ContentType = "empty"      // no content
+	ContentSquashfs  ContentType = "squashfs"   // squashfs file system
+	ContentExt       ContentType = "ext"        // ext2/3/4 file system
+	ContentGzip      ContentType = "gzip"       // gzip compressed data
+	ContentTar       ContentType = "tar"        // tar archive
+	ContentELF       ContentType = "elf"        // ELF executable or library
+	ContentPGPSigned ContentType = "pgp-signed" // OpenPGP clear-signed message
+	ContentJSON      ContentType = "json"       // JSON document
+	ContentText      ContentType = "text"       // UTF-8 text
+	ContentUnknown   ContentType = "unknown"    // unrecognized binary content
+)
+
+// sniffLen is the number of bytes read from the start of an object to detect its content. It is
+// large enough to contain the ext superblock magic.
+const sniffLen = 4096
+
+const pgpSignedHeader = "-----BEGIN PGP SIGNED MESSAGE-----"
+
+// SniffContent detects the type of content that begins with b. If b holds the complete content,
+// complete should be true, which allows JSON documents to be validated.
+func SniffContent(b []byte, complete bool) ContentType {
+	if len(b) == 0 {
+		return ContentEmpty
+	}
+
+	switch {
+	case bytes.HasPrefix(b, []byte("hsqs")), bytes.HasPrefix(b, []byte("sqsh")):
+		return ContentSquashfs
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		return ContentGzip
+	case bytes.HasPrefix(b, []byte{0x7f, 'E', 'L', 'F'}):
+		return ContentELF
+	case len(b) >= 262 && bytes.Equal(b[257:262], []byte("ustar")):
+		return ContentTar
+	case len(b) >= extSuperblockOffset+extMagicOffset+2 &&
+		binary.LittleEndian.Uint16(b[extSuperblockOffset+extMagicOffset:]) == extMagic:
+		return ContentExt
+	case bytes.HasPrefix(b, []byte(pgpSignedHeader)):
+		return ContentPGPSigned
+	}
+
+	if t := bytes.TrimLeft(b, " \t\r\n"); len(t) > 0 && (t[0] == '{' || t[0] == '[') {
+		if !complete || json.Valid(b) {
+			return ContentJSON
+		}
+	}
+
+	if isText(b, complete) {
+		return ContentText
+	}
+	return ContentUnknown
+}
+
+// isText returns true if b is UTF-8 text without NUL bytes. If b is not complete, a trailing
+// partial rune is permitted.
+func isText(b []byte, complete bool) bool {
+	if bytes.IndexByte(b, 0) >= 0 {
+		return false
+	}
+	if !complete {
+		for i := 0; i < utf8.UTFMax && len(b) > 0 && !utf8.Valid(b); i++ {
+			b = b[:len(b)-1]
+		}
+	}
+	return utf8.Valid(b)
+}
+
+// SniffContent detects the type of the content of the data object described by d.
+func (d *Descriptor) SniffContent(fimg *FileImage) (ContentType, error) {
+	n := d.Filelen
+	if n > sniffLen {
+		n = sniffLen
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.GetReadSeeker(fimg), b); err != nil {
+		return ContentUnknown, fmt.Errorf("reading data object: %s", err)
+	}
+
+	// JSON is validated in full when the object is small enough to have been read completely.
+	return SniffContent(b, n == d.Filelen), nil
+}
+
+// expectedContent returns the content types compatible with the declared type of d. If any
+// content is compatible, nil is returned.
+func (d *Descriptor) expectedContent() []ContentType {
+	switch d.Datatype {
+	case DataDeffile, DataEnvVar:
+		return []ContentType{ContentText}
+	case DataLabels, DataGenericJSON, DataHealthCheck, DataOCIConfig, DataProvenance:
+		return []ContentType{ContentJSON}
+	case DataBuildLog:
+		return []ContentType{ContentJSON, ContentText}
+	case DataBundle:
+		return []ContentType{ContentTar}
+	case DataSignature:
+		return []ContentType{ContentPGPSigned, ContentJSON, ContentText}
+	case DataSBOM:
+		f, err := d.GetSBOMFormat()
+		if err != nil {
+			return nil
+		}
+		switch f {
+		case SBOMFormatCycloneDXJSON, SBOMFormatSPDXJSON:
+			return []ContentType{ContentJSON}
+		case SBOMFormatCycloneDXXML, SBOMFormatSPDXTagValue:
+			return []ContentType{ContentText}
+		}
+	case DataPartition:
+		fs, err := d.GetFsType()
+		if err != nil {
+			return nil
+		}
+		switch fs {
+		case FsSquash:
+			return []ContentType{ContentSquashfs}
+		case FsExt3:
+			return []ContentType{ContentExt}
+		}
+	}
+	return nil
+}
+
+// CheckContent detects the type of the content of the data object described by d, and checks it
+// is compatible with the declared Datatype and, for partitions, file system type. The detected
+// type is returned. If it is not compatible, an error wrapping ErrContentMismatch is also
+// returned. Empty objects, and objects whose declared type does not imply a particular content
+// type, are always compatible.
+func (d *Descriptor) CheckContent(fimg *FileImage) (ContentType, error) {
+	ct, err := d.SniffContent(fimg)
+	if err != nil {
+		return ct, err
+	}
+
+	want := d.expectedContent()
+	if want == nil || ct == ContentEmpty {
+		return ct, nil
+	}
+	for _, w := range want {
+		if ct == w {
+			return ct, nil
+		}
+	}
+
+	return ct, fmt.Errorf("%w: object %d declared %v, content is %v", ErrContentMismatch, d.ID, d.Datatype, ct)
+}
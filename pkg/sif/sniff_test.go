@@ -0,0 +1,166 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestSniffContent(t *testing.T) {
+	tarHeader := make([]byte, 512)
+	copy(tarHeader[257:], "ustar\x0000")
+
+	extSuperblock := make([]byte, 2048)
+	binary.LittleEndian.PutUint16(extSuperblock[extSuperblockOffset+extMagicOffset:], extMagic)
+
+	tests := []struct {
+		name     string
+		b        []byte
+		complete bool
+		want     ContentType
+	}{
+		{"Empty", nil, true, ContentEmpty},
+		{"Squashfs", []byte("hsqs\x00\x00\x00\x00"), false, ContentSquashfs},
+		{"SquashfsBigEndian", []byte("sqsh\x00\x00\x00\x00"), false, ContentSquashfs},
+		{"Gzip", []byte{0x1f, 0x8b, 0x08, 0x00}, false, ContentGzip},
+		{"ELF", []byte{0x7f, 'E', 'L', 'F', 0x02, 0x01}, false, ContentELF},
+		{"Tar", tarHeader, false, ContentTar},
+		{"Ext", extSuperblock, false, ContentExt},
+		{"PGPSigned", []byte(pgpSignedHeader + "\nHash: SHA384\n"), true, ContentPGPSigned},
+		{"JSON", []byte(` {"a": [1, 2]}`), true, ContentJSON},
+		{"JSONArray", []byte(`[1, 2]`), true, ContentJSON},
+		{"JSONPartial", []byte(`{"a": [1, `), false, ContentJSON},
+		{"JSONInvalid", []byte(`{"a": [1, `), true, ContentText},
+		{"Text", []byte("bootstrap: docker\nfrom: alpine\n"), true, ContentText},
+		{"TextPartialRune", []byte("caf\xc3"), false, ContentText},
+		{"TextInvalidRune", []byte("caf\xc3"), true, ContentUnknown},
+		{"Binary", []byte{0x00, 0x01, 0x02, 0x03}, true, ContentUnknown},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := SniffContent(tt.b, tt.complete), tt.want; got != want {
+				t.Errorf("got content %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-sniff-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	object := func(dt Datatype, b []byte) DescriptorInput {
+		return DescriptorInput{
+			Datatype: dt,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     int64(len(b)),
+			Fname:    "object",
+			Data:     b,
+		}
+	}
+
+	partition := func(t *testing.T, fs Fstype, b []byte) DescriptorInput {
+		di := object(DataPartition, b)
+		if err := di.SetPartExtra(fs, PartPrimSys, HdrArchAMD64); err != nil {
+			t.Fatal(err)
+		}
+		return di
+	}
+
+	tests := []struct {
+		name    string
+		input   func(t *testing.T) DescriptorInput
+		want    ContentType
+		wantErr error
+	}{
+		{
+			name:  "Deffile",
+			input: func(t *testing.T) DescriptorInput { return object(DataDeffile, []byte("bootstrap: docker\n")) },
+			want:  ContentText,
+		},
+		{
+			name:    "DeffileSquashfs",
+			input:   func(t *testing.T) DescriptorInput { return object(DataDeffile, []byte("hsqs\x00\x00\x00\x00")) },
+			want:    ContentSquashfs,
+			wantErr: ErrContentMismatch,
+		},
+		{
+			name:  "GenericJSON",
+			input: func(t *testing.T) DescriptorInput { return object(DataGenericJSON, []byte(`{"a": 1}`)) },
+			want:  ContentJSON,
+		},
+		{
+			name:    "GenericJSONInvalid",
+			input:   func(t *testing.T) DescriptorInput { return object(DataGenericJSON, []byte(`{"a": `)) },
+			want:    ContentText,
+			wantErr: ErrContentMismatch,
+		},
+		{
+			name:  "Generic",
+			input: func(t *testing.T) DescriptorInput { return object(DataGeneric, []byte{0x00, 0x01}) },
+			want:  ContentUnknown,
+		},
+		{
+			name:  "PartitionSquashfs",
+			input: func(t *testing.T) DescriptorInput { return partition(t, FsSquash, []byte("hsqs\x00\x00\x00\x00")) },
+			want:  ContentSquashfs,
+		},
+		{
+			name:    "PartitionSquashfsGzip",
+			input:   func(t *testing.T) DescriptorInput { return partition(t, FsSquash, []byte{0x1f, 0x8b, 0x08, 0x00}) },
+			want:    ContentGzip,
+			wantErr: ErrContentMismatch,
+		},
+		{
+			name:  "PartitionRaw",
+			input: func(t *testing.T) DescriptorInput { return partition(t, FsRaw, []byte{0x1f, 0x8b, 0x08, 0x00}) },
+			want:  ContentGzip,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				ID:         uuid.NewV4(),
+				InputDescr: []DescriptorInput{tt.input(t)},
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			got, err := fimg.DescrArr[0].CheckContent(&fimg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got content %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Data objects such as overlay partitions are often mostly zeros. When the Sparse field of a
+// DescriptorInput is set, blocks of zeros written beyond the end of the image file are skipped
+// rather than written, leaving holes where the file system supports them. Holes read as zeros, so
+// the content of the image is unchanged, along with any digest or signature over it. Copying an
+// object from one image to another with Sparse set leaves the zero runs of the copy as holes,
+// whether or not they were holes in the source.
+
+// sparseBlockSize is the size of the blocks, aligned to the file offset, that are checked for
+// zeros when writing sparsely.
+const sparseBlockSize = 4096
+
+// zeroBlock is a block of zeros, against which blocks are compared.
+var zeroBlock [sparseBlockSize]byte
+
+// sparseWriter writes to f from its current offset, skipping blocks of zeros that lie beyond the
+// end of f. Skipped blocks that are not followed by data are accounted for by finish.
+type sparseWriter struct {
+	f    ReadWriter
+	off  int64 // offset of the next write
+	size int64 // size of f, beyond which skipped blocks read as zeros
+}
+
+// newSparseWriter returns a sparseWriter writing to f at its current offset.
+func newSparseWriter(f ReadWriter) (*sparseWriter, error) {
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("getting current file position: %s", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("getting file size: %s", err)
+	}
+	return &sparseWriter{f: f, off: off, size: fi.Size()}, nil
+}
+
+// skippable returns true if b, which is to be written at offset off, may be skipped.
+func (w *sparseWriter) skippable(b []byte, off int64) bool {
+	return off >= w.size && bytes.Equal(b, zeroBlock[:len(b)])
+}
+
+// Write writes b, skipping blocks of zeros beyond the end of the file.
+func (w *sparseWriter) Write(b []byte) (int, error) {
+	var n int
+
+	for n < len(b) {
+		// find the run of blocks to write, up to the next skippable block
+		start := n
+		for n < len(b) {
+			k := sparseBlockSize - int((w.off+int64(n))%sparseBlockSize)
+			if k > len(b)-n {
+				k = len(b) - n
+			}
+			if w.skippable(b[n:n+k], w.off+int64(n)) {
+				break
+			}
+			n += k
+		}
+
+		if start < n {
+			m, err := w.f.Write(b[start:n])
+			if end := w.off + int64(start+m); end > w.size {
+				w.size = end
+			}
+			if err != nil {
+				w.off += int64(start + m)
+				return start + m, err
+			}
+		}
+
+		// skip the run of zero blocks that follows
+		skip := n
+		for n < len(b) {
+			k := sparseBlockSize - int((w.off+int64(n))%sparseBlockSize)
+			if k > len(b)-n {
+				k = len(b) - n
+			}
+			if !w.skippable(b[n:n+k], w.off+int64(n)) {
+				break
+			}
+			n += k
+		}
+
+		if skip < n {
+			if _, err := w.f.Seek(int64(n-skip), io.SeekCurrent); err != nil {
+				w.off += int64(skip)
+				return skip, err
+			}
+		}
+	}
+
+	w.off += int64(n)
+	return n, nil
+}
+
+// finish extends the file to cover any blocks skipped at the end of the data written.
+func (w *sparseWriter) finish() error {
+	if w.off <= w.size {
+		return nil
+	}
+	if err := w.f.Truncate(w.off); err != nil {
+		return fmt.Errorf("extending file over skipped blocks: %s", err)
+	}
+	w.size = w.off
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// countingFile counts the bytes written to a file.
+type countingFile struct {
+	*os.File
+	n int64
+}
+
+func (f *countingFile) Write(b []byte) (int, error) {
+	n, err := f.File.Write(b)
+	f.n += int64(n)
+	return n, err
+}
+
+func TestSparseWriter(t *testing.T) {
+	data := make([]byte, 5*sparseBlockSize+10)
+	copy(data[2*sparseBlockSize+100:], "data")
+
+	tests := []struct {
+		name        string
+		existing    []byte // content of the file before writing
+		off         int64  // offset at which data is written
+		wantWritten int64
+	}{
+		{name: "Empty", wantWritten: sparseBlockSize},
+		{name: "Unaligned", off: 100, wantWritten: sparseBlockSize},
+		{name: "OverExisting", existing: bytes.Repeat([]byte{0xff}, 3*sparseBlockSize), wantWritten: 3 * sparseBlockSize},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tf, err := ioutil.TempFile("", "sif-sparse-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tf.Name())
+			defer tf.Close()
+
+			if _, err := tf.Write(tt.existing); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tf.Seek(tt.off, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+
+			f := &countingFile{File: tf}
+			sw, err := newSparseWriter(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// write in pieces, so runs of zeros span writes
+			for _, b := range [][]byte{data[:3000], data[3000:]} {
+				if n, err := sw.Write(b); err != nil {
+					t.Fatal(err)
+				} else if n != len(b) {
+					t.Fatalf("got %v bytes written, want %v", n, len(b))
+				}
+			}
+			if err := sw.finish(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := f.n, tt.wantWritten; got != want {
+				t.Errorf("got %v bytes written to file, want %v", got, want)
+			}
+
+			b, err := ioutil.ReadFile(tf.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := int64(len(b)), tt.off+int64(len(data)); got != want {
+				t.Fatalf("got file size %v, want %v", got, want)
+			}
+			if !bytes.Equal(b[tt.off:], data) {
+				t.Error("data does not match")
+			}
+		})
+	}
+}
+
+func TestCreateContainerSparse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-sparse-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	overlay := make([]byte, 1<<20)
+	copy(overlay[1<<19:], "overlay")
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "sparse.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			{
+				Datatype: DataGeneric,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     int64(len(overlay)),
+				Fname:    "overlay",
+				Data:     overlay,
+				Sparse:   true,
+			},
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d.GetData(&fimg), overlay) {
+		t.Error("data does not match")
+	}
+
+	// copying the object to another image preserves sparseness
+	input := DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     d.Filelen,
+		Fname:    "copy",
+		Sparse:   true,
+	}
+	if err := fimg.AddObjectFromReader(d.GetReader(&fimg), input); err != nil {
+		t.Fatal(err)
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err = LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, _, err = fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d.GetData(&fimg), overlay) {
+		t.Error("copied data does not match")
+	}
+	if got, want := fimg.Filesize, d.Fileoff+d.Filelen; got != want {
+		t.Errorf("got file size %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// A spec describes the content of a SIF image declaratively, so that the assembly of an image may
+// be reviewed and repeated. Objects are created in the order they are listed, so the ID of each
+// object is its 1-based position in the spec, and links between objects may be expressed with
+// those IDs. Signing instructions are recorded in the spec, but are carried out by the caller.
+
+var (
+	errSpecNoObjects       = errors.New("spec contains no objects")
+	errSpecSourceInvalid   = errors.New("exactly one of source or data must be specified")
+	errSpecLinkInvalid     = errors.New("link invalid")
+	errSpecExtraMissing    = errors.New("extra info missing")
+	errSpecExtraUnexpected = errors.New("extra info not expected")
+	errSpecTypeNotAllowed  = errors.New("datatype not allowed in spec")
+)
+
+// Spec describes a SIF image to be assembled by BuildSpec.
+type Spec struct {
+	Launch          string       `json:"launch,omitempty"`          // launch script, HdrLaunch if empty
+	Version         string       `json:"version,omitempty"`         // SIF version, HdrVersion if empty
+	ID              string       `json:"id,omitempty"`              // image UUID, generated if empty
+	DescriptorCount int64        `json:"descriptorCount,omitempty"` // descriptors to reserve
+	Reproducible    bool         `json:"reproducible,omitempty"`    // create a reproducible image
+	Timestamp       int64        `json:"timestamp,omitempty"`       // Unix time recorded if reproducible
+	Objects         []ObjectSpec `json:"objects"`                   // objects, in creation order
+	Sign            []SignSpec   `json:"sign,omitempty"`            // signing instructions
+}
+
+// ObjectSpec describes a data object of a SIF image.
+type ObjectSpec struct {
+	Type      string         `json:"type"`                // datatype, as named by Datatype.String
+	Source    string         `json:"source,omitempty"`    // file holding the data, relative to the spec
+	Data      string         `json:"data,omitempty"`      // inline data, in place of source
+	Name      string         `json:"name,omitempty"`      // object name, base name of source if empty
+	Group     uint32         `json:"group,omitempty"`     // object group, 0 for none
+	Link      uint32         `json:"link,omitempty"`      // ID of linked object, 0 for none
+	LinkGroup uint32         `json:"linkGroup,omitempty"` // linked object group, in place of link
+	Alignment int            `json:"alignment,omitempty"` // data alignment, in bytes
+	Compress  string         `json:"compress,omitempty"`  // compression, as named by Compression.String
+	Partition *PartitionSpec `json:"partition,omitempty"` // required for partition objects
+	SBOM      *SBOMSpec      `json:"sbom,omitempty"`      // required for SBOM objects
+	OCI       *OCISpec       `json:"oci,omitempty"`       // required for OCI config and blob objects
+}
+
+// PartitionSpec describes a partition object.
+type PartitionSpec struct {
+	Fstype   string `json:"fstype"`   // file system type, as named by Fstype.String
+	Parttype string `json:"parttype"` // partition type, as named by Parttype.String
+	Arch     string `json:"arch"`     // architecture, as named by GOARCH
+}
+
+// SBOMSpec describes an SBOM object.
+type SBOMSpec struct {
+	Format string `json:"format"` // SBOM format, as named by SBOMFormat.String
+}
+
+// OCISpec describes an OCI config or blob object.
+type OCISpec struct {
+	MediaType string `json:"mediaType"`        // OCI media type
+	Digest    string `json:"digest,omitempty"` // OCI digest, computed from the data if empty
+}
+
+// SignSpec describes a signing instruction.
+type SignSpec struct {
+	Key    string   `json:"key"`              // private key file, relative to the spec
+	Groups []uint32 `json:"groups,omitempty"` // object groups to sign, all groups if empty
+}
+
+// ReadSpec reads a JSON encoded spec from r. Unknown fields are rejected, so that misspelt fields
+// are not silently ignored.
+func ReadSpec(r io.Reader) (*Spec, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var s Spec
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("decoding spec: %w", err)
+	}
+	return &s, nil
+}
+
+// parseSBOMFormat returns the SBOM format named s. The comparison is case-insensitive.
+func parseSBOMFormat(s string) (SBOMFormat, error) {
+	for f := SBOMFormatCycloneDXJSON; isKnownSBOMFormat(f); f++ {
+		if strings.EqualFold(s, f.String()) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: sbom format %q", ErrUnknownType, s)
+}
+
+// setExtra sets the Extra field of di from the type-specific info of o.
+func (o ObjectSpec) setExtra(di *DescriptorInput, data io.ReadSeeker) error {
+	if (o.Partition != nil) != (di.Datatype == DataPartition) ||
+		(o.SBOM != nil) != (di.Datatype == DataSBOM) ||
+		(o.OCI != nil) != (di.Datatype == DataOCIConfig || di.Datatype == DataOCIBlob) {
+		if o.Partition == nil && o.SBOM == nil && o.OCI == nil {
+			return errSpecExtraMissing
+		}
+		return errSpecExtraUnexpected
+	}
+
+	switch {
+	case o.Partition != nil:
+		fs, err := ParseFstype(o.Partition.Fstype)
+		if err != nil {
+			return err
+		}
+		pt, err := ParseParttype(o.Partition.Parttype)
+		if err != nil {
+			return err
+		}
+		return di.SetPartExtra(fs, pt, GetSIFArch(o.Partition.Arch))
+
+	case o.SBOM != nil:
+		f, err := parseSBOMFormat(o.SBOM.Format)
+		if err != nil {
+			return err
+		}
+		return di.SetSBOMExtra(f)
+
+	case o.OCI != nil:
+		digest := o.OCI.Digest
+		if digest == "" {
+			var err error
+			if digest, err = OCIDigest(data); err != nil {
+				return err
+			}
+			if _, err := data.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		return di.SetOCIBlobExtra(o.OCI.MediaType, digest)
+	}
+	return nil
+}
+
+// input returns a DescriptorInput for the object described by o, with data read from files
+// relative to dir. The returned file, if any, must be closed by the caller.
+func (o ObjectSpec) input(dir string, objects int, groups map[uint32]bool) (DescriptorInput, *os.File, error) {
+	dt, err := ParseDatatype(o.Type)
+	if err != nil {
+		return DescriptorInput{}, nil, err
+	}
+
+	// Signatures are created by signing instructions, and crypto messages by encryption.
+	if dt == DataSignature || dt == DataCryptoMessage {
+		return DescriptorInput{}, nil, fmt.Errorf("%w: %v", errSpecTypeNotAllowed, dt)
+	}
+
+	if (o.Source == "") == (o.Data == "") {
+		return DescriptorInput{}, nil, errSpecSourceInvalid
+	}
+
+	c, err := ParseCompression(o.Compress)
+	if err != nil {
+		return DescriptorInput{}, nil, err
+	}
+
+	di := DescriptorInput{
+		Datatype:    dt,
+		Groupid:     DescrUnusedGroup,
+		Link:        DescrUnusedLink,
+		Alignment:   o.Alignment,
+		Compression: c,
+		Fname:       o.Name,
+	}
+	if o.Group != 0 {
+		di.Groupid = o.Group | DescrGroupMask
+	}
+
+	switch {
+	case o.Link != 0 && o.LinkGroup != 0:
+		return DescriptorInput{}, nil, fmt.Errorf("%w: both link and linkGroup specified", errSpecLinkInvalid)
+	case o.Link != 0:
+		if int(o.Link) > objects {
+			return DescriptorInput{}, nil, fmt.Errorf("%w: object %d not in spec", errSpecLinkInvalid, o.Link)
+		}
+		di.Link = o.Link
+	case o.LinkGroup != 0:
+		if !groups[o.LinkGroup] {
+			return DescriptorInput{}, nil, fmt.Errorf("%w: group %d not in spec", errSpecLinkInvalid, o.LinkGroup)
+		}
+		di.Link = o.LinkGroup | DescrGroupMask
+	}
+
+	var rs io.ReadSeeker
+	var fp *os.File
+
+	if o.Source != "" {
+		path := o.Source
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		if fp, err = os.Open(path); err != nil {
+			return DescriptorInput{}, nil, err
+		}
+
+		fi, err := fp.Stat()
+		if err != nil {
+			fp.Close()
+			return DescriptorInput{}, nil, err
+		}
+
+		if di.Fname == "" {
+			di.Fname = filepath.Base(o.Source)
+		}
+		di.Fp = fp
+		di.Size = fi.Size()
+		rs = fp
+	} else {
+		di.Data = []byte(o.Data)
+		di.Size = int64(len(di.Data))
+		rs = bytes.NewReader(di.Data)
+	}
+
+	if err := o.setExtra(&di, rs); err != nil {
+		if fp != nil {
+			fp.Close()
+		}
+		return DescriptorInput{}, nil, err
+	}
+
+	return di, fp, nil
+}
+
+// BuildSpec creates a SIF image at path holding the objects described by s. Sources are read
+// relative to dir. The signing instructions of s are not carried out.
+func BuildSpec(s *Spec, dir, path string) error {
+	if len(s.Objects) == 0 {
+		return errSpecNoObjects
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   path,
+		Launchstr:  s.Launch,
+		Sifversion: s.Version,
+		DescrCount: s.DescriptorCount,
+
+		Reproducible: s.Reproducible,
+	}
+	if cinfo.Launchstr == "" {
+		cinfo.Launchstr = HdrLaunch
+	}
+	if cinfo.Sifversion == "" {
+		cinfo.Sifversion = HdrVersion
+	}
+
+	if s.Timestamp != 0 {
+		cinfo.Time = time.Unix(s.Timestamp, 0)
+	}
+
+	// The ID of a reproducible image is derived from its content, unless specified.
+	if s.ID == "" && !s.Reproducible {
+		cinfo.ID = uuid.NewV4()
+	} else if s.ID != "" {
+		id, err := uuid.FromString(s.ID)
+		if err != nil {
+			return fmt.Errorf("parsing image ID: %s", err)
+		}
+		cinfo.ID = id
+	}
+
+	groups := make(map[uint32]bool)
+	for _, o := range s.Objects {
+		if o.Group != 0 {
+			groups[o.Group] = true
+		}
+	}
+
+	for i, o := range s.Objects {
+		di, fp, err := o.input(dir, len(s.Objects), groups)
+		if err != nil {
+			return fmt.Errorf("object %d: %w", i+1, err)
+		}
+		if fp != nil {
+			defer fp.Close()
+		}
+		cinfo.InputDescr = append(cinfo.InputDescr, di)
+	}
+
+	_, err := CreateContainer(cinfo)
+	return err
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{"Valid", `{"objects":[{"type":"Def.FILE","source":"busybox.def"}]}`, false},
+		{"UnknownField", `{"objects":[{"type":"Def.FILE","sorce":"busybox.def"}]}`, true},
+		{"Malformed", `{"objects":[`, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadSpec(strings.NewReader(tt.spec))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-spec-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The spec is read from testdata, so that sources are found relative to it.
+	spec := `{
+	"id": "a8e52bd9-9e38-4b5e-9d0a-0e0c8f3f3a7b",
+	"objects": [
+		{"type": "Def.FILE", "source": "busybox.def", "group": 1},
+		{
+			"type": "FS",
+			"source": "busybox.squash",
+			"group": 1,
+			"alignment": 4096,
+			"partition": {"fstype": "Squashfs", "parttype": "*System", "arch": "amd64"}
+		},
+		{"type": "JSON.Generic", "data": "{}", "name": "meta.json", "linkGroup": 1},
+		{"type": "SBOM", "data": "{}", "name": "sbom.json", "link": 2, "sbom": {"format": "cyclonedx-json"}}
+	]
+}`
+
+	s, err := ReadSpec(strings.NewReader(spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "image.sif")
+	if err := BuildSpec(s, "testdata", path); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	if got, want := f.Header.ID.String(), "a8e52bd9-9e38-4b5e-9d0a-0e0c8f3f3a7b"; got != want {
+		t.Errorf("got ID %v, want %v", got, want)
+	}
+
+	want := []struct {
+		dt    Datatype
+		name  string
+		group uint32
+		link  uint32
+	}{
+		{DataDeffile, "busybox.def", 1 | DescrGroupMask, DescrUnusedLink},
+		{DataPartition, "busybox.squash", 1 | DescrGroupMask, DescrUnusedLink},
+		{DataGenericJSON, "meta.json", DescrUnusedGroup, 1 | DescrGroupMask},
+		{DataSBOM, "sbom.json", DescrUnusedGroup, 2},
+	}
+
+	ds := f.GetDescriptors()
+	if got := len(ds); got != len(want) {
+		t.Fatalf("got %v objects, want %v", got, len(want))
+	}
+	for i, d := range ds {
+		w := want[i]
+		if d.ID != uint32(i+1) || d.Datatype != w.dt || d.GetName() != w.name ||
+			d.Groupid != w.group || d.Link != w.link {
+			t.Errorf("object %d: got %v %q group %#x link %#x", d.ID, d.Datatype, d.GetName(), d.Groupid, d.Link)
+		}
+	}
+
+	if fs, err := ds[1].GetFsType(); err != nil || fs != FsSquash {
+		t.Errorf("got fstype %v (%v), want %v", fs, err, FsSquash)
+	}
+	if pt, err := ds[1].GetPartType(); err != nil || pt != PartPrimSys {
+		t.Errorf("got parttype %v (%v), want %v", pt, err, PartPrimSys)
+	}
+	if ds[1].Fileoff%4096 != 0 {
+		t.Errorf("got partition offset %v, want alignment 4096", ds[1].Fileoff)
+	}
+	if sf, err := ds[3].GetSBOMFormat(); err != nil || sf != SBOMFormatCycloneDXJSON {
+		t.Errorf("got sbom format %v (%v), want %v", sf, err, SBOMFormatCycloneDXJSON)
+	}
+}
+
+func TestBuildSpecErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-spec-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		objects []ObjectSpec
+		wantErr error
+	}{
+		{"NoObjects", nil, errSpecNoObjects},
+		{"UnknownType", []ObjectSpec{{Type: "Bogus", Data: "x"}}, ErrUnknownType},
+		{"Signature", []ObjectSpec{{Type: "Signature", Data: "x"}}, errSpecTypeNotAllowed},
+		{"NoSource", []ObjectSpec{{Type: "Generic/Raw"}}, errSpecSourceInvalid},
+		{"SourceAndData", []ObjectSpec{{Type: "Generic/Raw", Source: "busybox.def", Data: "x"}}, errSpecSourceInvalid},
+		{"SourceMissing", []ObjectSpec{{Type: "Generic/Raw", Source: "missing"}}, os.ErrNotExist},
+		{"LinkID", []ObjectSpec{{Type: "Generic/Raw", Data: "x", Link: 2}}, errSpecLinkInvalid},
+		{"LinkGroup", []ObjectSpec{{Type: "Generic/Raw", Data: "x", LinkGroup: 1}}, errSpecLinkInvalid},
+		{"PartitionMissing", []ObjectSpec{{Type: "FS", Data: "x"}}, errSpecExtraMissing},
+		{
+			name:    "PartitionUnexpected",
+			objects: []ObjectSpec{{Type: "Generic/Raw", Data: "x", Partition: &PartitionSpec{}}},
+			wantErr: errSpecExtraUnexpected,
+		},
+		{
+			name: "FstypeUnknown",
+			objects: []ObjectSpec{{
+				Type:      "FS",
+				Data:      "x",
+				Partition: &PartitionSpec{Fstype: "NTFS", Parttype: "*System", Arch: "amd64"},
+			}},
+			wantErr: ErrUnknownType,
+		},
+		{
+			name:    "SBOMFormatUnknown",
+			objects: []ObjectSpec{{Type: "SBOM", Data: "x", SBOM: &SBOMSpec{Format: "bogus"}}},
+			wantErr: ErrUnknownType,
+		},
+		{
+			name:    "OCIMediaType",
+			objects: []ObjectSpec{{Type: "OCI.Blob", Data: "x", OCI: &OCISpec{MediaType: "bogus"}}},
+			wantErr: errOCIMediaTypeInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := Spec{Objects: tt.objects}
+
+			err := BuildSpec(&s, "testdata", filepath.Join(dir, tt.name+".sif"))
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownType is the code for when a descriptor in an image loaded in strict mode contains a
+// datatype, file system type, partition type, hash type, format type or message type not known
+// to this implementation.
+var ErrUnknownType = errors.New("unknown type")
+
+// loadOpts accumulates container loading options.
+type loadOpts struct {
+	strict         bool
+	limiter        *RateLimiter
+	signalGuard    bool
+	lock           bool
+	clock          Clock
+	buffered       bool
+	recoverJournal bool
+	bufferSize     int
+	ignoreDescrCRC bool
+
+	maxDecompressedSize int64
+}
+
+// LoadOpt are used to specify container loading options.
+type LoadOpt func(*loadOpts) error
+
+// OptLoadStrict specifies whether loading fails when a descriptor contains a type value not
+// known to this implementation, rather than the value being reported as "Unknown". This is
+// intended for validators that must not pass through content they cannot interpret.
+func OptLoadStrict(b bool) LoadOpt {
+	return func(lo *loadOpts) error {
+		lo.strict = b
+		return nil
+	}
+}
+
+// getLoadOpts applies opts, returning the resulting options.
+func getLoadOpts(opts []LoadOpt) (loadOpts, error) {
+	lo := loadOpts{}
+	for _, opt := range opts {
+		if err := opt(&lo); err != nil {
+			return loadOpts{}, err
+		}
+	}
+	return lo, nil
+}
+
+// isKnownDatatype returns true if t is a known datatype.
+func isKnownDatatype(t Datatype) bool {
+	for _, k := range AllDatatypes() {
+		if t == k {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownFstype returns true if t is a known file system type.
+func isKnownFstype(t Fstype) bool {
+	for _, k := range AllFstypes() {
+		if t == k {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownParttype returns true if t is a known partition type.
+func isKnownParttype(t Parttype) bool {
+	for _, k := range AllParttypes() {
+		if t == k {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownHashtype returns true if t is a known hash type.
+func isKnownHashtype(t Hashtype) bool {
+	switch t {
+	case HashSHA256, HashSHA384, HashSHA512, HashBLAKE2S, HashBLAKE2B, HashBLAKE3:
+		return true
+	}
+	return false
+}
+
+// isKnownFormattype returns true if t is a known format type.
+func isKnownFormattype(t Formattype) bool {
+	switch t {
+	case FormatOpenPGP, FormatPEM, FormatJWS, FormatSigEnvelope:
+		return true
+	}
+	return false
+}
+
+// isKnownMessagetype returns true if t is a known message type.
+func isKnownMessagetype(t Messagetype) bool {
+	switch t {
+	case MessageClearSignature, MessageRSAOAEP, MessageNotationSignature, MessagePQSignature:
+		return true
+	}
+	return false
+}
+
+// isKnownSBOMFormat returns true if f is a known SBOM format.
+func isKnownSBOMFormat(f SBOMFormat) bool {
+	switch f {
+	case SBOMFormatCycloneDXJSON, SBOMFormatCycloneDXXML, SBOMFormatSPDXJSON, SBOMFormatSPDXTagValue:
+		return true
+	}
+	return false
+}
+
+// checkKnownTypes returns an error wrapping ErrUnknownType if descriptor d contains a type value
+// not known to this implementation.
+func checkKnownTypes(d *Descriptor) error {
+	if !isKnownDatatype(d.Datatype) {
+		return fmt.Errorf("%w: descriptor %d: datatype %#x", ErrUnknownType, d.ID, int32(d.Datatype))
+	}
+
+	switch d.Datatype {
+	case DataPartition:
+		fs, err := d.GetFsType()
+		if err != nil {
+			return err
+		}
+		if !isKnownFstype(fs) {
+			return fmt.Errorf("%w: descriptor %d: fstype %d", ErrUnknownType, d.ID, fs)
+		}
+
+		pt, err := d.GetPartType()
+		if err != nil {
+			return err
+		}
+		if !isKnownParttype(pt) {
+			return fmt.Errorf("%w: descriptor %d: parttype %d", ErrUnknownType, d.ID, pt)
+		}
+
+	case DataSignature:
+		ht, err := d.GetHashType()
+		if err != nil {
+			return err
+		}
+		if !isKnownHashtype(ht) {
+			return fmt.Errorf("%w: descriptor %d: hashtype %d", ErrUnknownType, d.ID, ht)
+		}
+
+	case DataCryptoMessage:
+		ft, err := d.GetFormatType()
+		if err != nil {
+			return err
+		}
+		if !isKnownFormattype(ft) {
+			return fmt.Errorf("%w: descriptor %d: formattype %d", ErrUnknownType, d.ID, ft)
+		}
+
+		mt, err := d.GetMessageType()
+		if err != nil {
+			return err
+		}
+		if !isKnownMessagetype(mt) {
+			return fmt.Errorf("%w: descriptor %d: messagetype %#x", ErrUnknownType, d.ID, mt)
+		}
+
+	case DataSBOM:
+		f, err := d.GetSBOMFormat()
+		if err != nil {
+			return err
+		}
+		if !isKnownSBOMFormat(f) {
+			return fmt.Errorf("%w: descriptor %d: sbom format %d", ErrUnknownType, d.ID, f)
+		}
+
+	case DataPlaceholder:
+		t, err := d.GetPlaceholderType()
+		if err != nil {
+			return err
+		}
+		if !isKnownDatatype(t) {
+			return fmt.Errorf("%w: descriptor %d: placeholder datatype %#x", ErrUnknownType, d.ID, int32(t))
+		}
+
+	case DataSecrets:
+		c, err := d.GetSecretsCipher()
+		if err != nil {
+			return err
+		}
+		if c != SecretsAES256GCM {
+			return fmt.Errorf("%w: descriptor %d: secrets cipher %d", ErrUnknownType, d.ID, c)
+		}
+	}
+
+	return nil
+}
+
+// checkStrict validates the used descriptors of fimg, returning an error wrapping ErrUnknownType
+// if any contains a type value not known to this implementation.
+func (fimg *FileImage) checkStrict() error {
+	for i := range fimg.DescrArr {
+		if !fimg.DescrArr[i].Used {
+			continue
+		}
+		if err := checkKnownTypes(&fimg.DescrArr[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
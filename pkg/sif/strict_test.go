@@ -0,0 +1,69 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestLoadStrict(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var h Header
+	if err := binary.Read(bytes.NewReader(content), binary.LittleEndian, &h); err != nil {
+		t.Fatal(err)
+	}
+
+	descrLen := binary.Size(Descriptor{})
+	extraOff := descrLen - DescrMaxPrivLen
+
+	// withValue returns a copy of content, with the int32 at offset off within descriptor i set
+	// to v.
+	withValue := func(i, off int, v int32) []byte {
+		c := append([]byte(nil), content...)
+		binary.LittleEndian.PutUint32(c[int(h.Descroff)+i*descrLen+off:], uint32(v))
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		b       []byte
+		wantErr error
+	}{
+		{name: "Known", b: content},
+		{name: "Datatype", b: withValue(0, 0, 0x4fff), wantErr: ErrUnknownType},
+		{name: "Fstype", b: withValue(1, extraOff, 99), wantErr: ErrUnknownType},
+		{name: "Parttype", b: withValue(1, extraOff+4, 99), wantErr: ErrUnknownType},
+		{name: "Hashtype", b: withValue(2, extraOff, 99), wantErr: ErrUnknownType},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Without strict mode, unknown types are passed through.
+			if _, err := LoadContainerFp(&mockSifReadWriter{buf: tt.b, name: "image.sif"}, true); err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+
+			_, err := LoadContainerFp(&mockSifReadWriter{buf: tt.b, name: "image.sif"}, true, OptLoadStrict(true))
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("LoadContainerFp: got error %v, want %v", got, want)
+			}
+
+			_, err = LoadContainerReader(bytes.NewReader(tt.b), OptLoadStrict(true))
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Errorf("LoadContainerReader: got error %v, want %v", got, want)
+			}
+		})
+	}
+}
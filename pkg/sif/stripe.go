@@ -0,0 +1,406 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// A striped SIF image is stored as a main file followed by a series of companion files named
+// after the main file with a numeric suffix (image.sif, image.sif.0, image.sif.1, ...). Each file
+// holds one fixed-size stripe of the image, so the main file always holds the global header and
+// descriptor table. The main file is always padded to a full stripe and at least one companion
+// file is always present.
+//
+// The stripe size and the number of files holding the image are recorded in the header extension
+// of the main file (see headerExtStripe), so striping requires SIF version 02 or later. Companion
+// files are only opened where the main file records a stripe map, and only if their sizes are
+// consistent with it, so that unrelated files that happen to share the naming scheme are neither
+// read nor modified.
+
+var (
+	errStripeSizeInvalid  = errors.New("stripe size invalid")
+	errStripeUnsupported  = errors.New("striping requires SIF version 02 or later")
+	errStripeMapInvalid   = errors.New("stripe map invalid")
+	errStripeFileMismatch = errors.New("stripe file size does not match stripe map")
+)
+
+// stripeMap describes the layout of a striped image.
+type stripeMap struct {
+	size  int64 // size of each stripe
+	count int   // number of files holding stripes, including the main file
+}
+
+// stripeName returns the name of the file holding stripe i of the image named name.
+func stripeName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s.%d", name, i-1)
+}
+
+// readStripeMap reads the stripe map recorded in the header extension of the image in r. If the
+// image is not striped, a zero stripeMap is returned.
+func readStripeMap(r io.ReaderAt) (stripeMap, error) {
+	var h Header
+	if err := binary.Read(io.NewSectionReader(r, 0, int64(binary.Size(h))), binary.LittleEndian, &h); err != nil {
+		return stripeMap{}, err
+	}
+	if err := isValidHeader(&h); err != nil {
+		return stripeMap{}, err
+	}
+
+	ext, err := checkHeaderExt(r, &h)
+	if err != nil {
+		return stripeMap{}, err
+	}
+	return ext.stripes, nil
+}
+
+// syncStripeMap updates the image flags to reflect whether fimg is striped, and returns the
+// stripe map to record in the header extension. The files holding the data described by the
+// global header are created as needed, so that the stripe map is consistent with them.
+func (fimg *FileImage) syncStripeMap() (stripeMap, error) {
+	sf, ok := fimg.Fp.(*stripedFile)
+	if !ok {
+		fimg.flags &^= hdrFlagStriped
+		return stripeMap{}, nil
+	}
+	fimg.flags |= hdrFlagStriped
+
+	count := 2
+	if end := fimg.Header.Dataoff + fimg.Header.Datalen; end > 2*sf.size {
+		count = int((end-1)/sf.size) + 1
+	}
+	if _, err := sf.file(count - 1); err != nil {
+		return stripeMap{}, err
+	}
+	return stripeMap{size: sf.size, count: count}, nil
+}
+
+// stripedFile implements ReadWriter on top of a set of files each holding one stripe of a SIF
+// image.
+type stripedFile struct {
+	name  string      // name of the main file
+	flag  int         // flags used to open/create stripe files
+	size  int64       // size of each stripe
+	mode  os.FileMode // permissions of stripe files created
+	files []*os.File  // stripe files, files[0] being the main file
+	pos   int64       // current offset
+}
+
+// createStriped creates a new striped image named name, with stripes of the given size and
+// permissions mode.
+func createStriped(name string, size int64, mode os.FileMode) (*stripedFile, error) {
+	if size < DataStartOffset {
+		return nil, fmt.Errorf("%w: %d is smaller than %d", errStripeSizeInvalid, size, DataStartOffset)
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove stale companion files, if any.
+	for i := 1; ; i++ {
+		if err := os.Remove(stripeName(name, i)); err != nil {
+			break
+		}
+	}
+
+	sf := &stripedFile{name: name, flag: os.O_RDWR, size: size, mode: mode, files: []*os.File{f}}
+	if err := sf.Truncate(0); err != nil {
+		sf.Close()
+		return nil, err
+	}
+	return sf, nil
+}
+
+// openStripedIfRecorded returns the image held by the opened main file f. If the header extension
+// of f records a stripe map, the companion files it describes are opened with the specified flag,
+// and the striped image is returned. Otherwise, f itself is returned. On error, f is closed.
+func openStripedIfRecorded(f *os.File, flag int) (ReadWriter, error) {
+	// A main file that cannot be parsed is not treated as striped, leaving the loader to report
+	// the problem.
+	sm, err := readStripeMap(f)
+	if err != nil || sm.count == 0 {
+		return f, nil
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	sf := &stripedFile{
+		name:  f.Name(),
+		flag:  flag,
+		size:  sm.size,
+		mode:  fi.Mode().Perm(),
+		files: []*os.File{f},
+	}
+	if err := sf.openStripes(sm); err != nil {
+		sf.Close()
+		return nil, err
+	}
+	return sf, nil
+}
+
+// openStripes opens the files described by stripe map sm that are not already open, and checks
+// that the size of each file is consistent with sm. Files beyond those described by sm are
+// ignored.
+func (sf *stripedFile) openStripes(sm stripeMap) error {
+	if sm.size != sf.size || sm.count < 2 {
+		return fmt.Errorf("%w: %d files of %d bytes", errStripeMapInvalid, sm.count, sm.size)
+	}
+
+	for i := len(sf.files); i < sm.count; i++ {
+		f, err := os.OpenFile(stripeName(sf.name, i), sf.flag, 0)
+		if err != nil {
+			return err
+		}
+		sf.files = append(sf.files, f)
+	}
+
+	// All stripes but the last must be full for offsets to map correctly.
+	for i, f := range sf.files[:sm.count] {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if size := fi.Size(); size > sf.size || (i < sm.count-1 && size != sf.size) {
+			return fmt.Errorf("%w: %s is %d bytes, stripe size is %d",
+				errStripeFileMismatch, f.Name(), size, sf.size)
+		}
+	}
+	return nil
+}
+
+// file returns the file holding stripe i, creating it (and any stripes before it) as needed.
+func (sf *stripedFile) file(i int) (*os.File, error) {
+	for len(sf.files) <= i {
+		// Stripes before the new one must be full for offsets to map correctly.
+		if err := sf.files[len(sf.files)-1].Truncate(sf.size); err != nil {
+			return nil, err
+		}
+
+		f, err := os.OpenFile(stripeName(sf.name, len(sf.files)), sf.flag|os.O_CREATE, sf.mode)
+		if err != nil {
+			return nil, err
+		}
+		sf.files = append(sf.files, f)
+	}
+	return sf.files[i], nil
+}
+
+// Name returns the name of the main file.
+func (sf *stripedFile) Name() string {
+	return sf.name
+}
+
+// Fd returns the file descriptor of the main file.
+func (sf *stripedFile) Fd() uintptr {
+	return sf.files[0].Fd()
+}
+
+// Len returns the total size of the image.
+func (sf *stripedFile) Len() (int64, error) {
+	last := len(sf.files) - 1
+
+	fi, err := sf.files[last].Stat()
+	if err != nil {
+		return 0, err
+	}
+	return int64(last)*sf.size + fi.Size(), nil
+}
+
+// ReadAt reads len(b) bytes from the image starting at offset off.
+func (sf *stripedFile) ReadAt(b []byte, off int64) (n int, err error) {
+	for len(b) > 0 {
+		i := int(off / sf.size)
+		if i >= len(sf.files) {
+			return n, io.EOF
+		}
+
+		// Do not read past the end of the stripe, except from the last one.
+		chunk := b
+		if i < len(sf.files)-1 {
+			if rem := sf.size - off%sf.size; int64(len(chunk)) > rem {
+				chunk = chunk[:rem]
+			}
+		}
+
+		m, err := sf.files[i].ReadAt(chunk, off%sf.size)
+		n += m
+		off += int64(m)
+		b = b[m:]
+
+		if err == io.EOF && m == len(chunk) && i < len(sf.files)-1 {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// WriteAt writes len(b) bytes to the image starting at offset off.
+func (sf *stripedFile) WriteAt(b []byte, off int64) (n int, err error) {
+	for len(b) > 0 {
+		i := int(off / sf.size)
+
+		f, err := sf.file(i)
+		if err != nil {
+			return n, err
+		}
+
+		chunk := b
+		if rem := sf.size - off%sf.size; int64(len(chunk)) > rem {
+			chunk = chunk[:rem]
+		}
+
+		m, err := f.WriteAt(chunk, off%sf.size)
+		n += m
+		off += int64(m)
+		b = b[m:]
+
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Read reads up to len(b) bytes from the current offset.
+func (sf *stripedFile) Read(b []byte) (int, error) {
+	n, err := sf.ReadAt(b, sf.pos)
+	sf.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Write writes len(b) bytes at the current offset.
+func (sf *stripedFile) Write(b []byte) (int, error) {
+	n, err := sf.WriteAt(b, sf.pos)
+	sf.pos += int64(n)
+	return n, err
+}
+
+// Seek sets the offset for the next Read or Write.
+func (sf *stripedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += sf.pos
+	case io.SeekEnd:
+		size, err := sf.Len()
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, os.ErrInvalid
+	}
+
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	sf.pos = offset
+	return offset, nil
+}
+
+// Truncate changes the size of the image, removing companion files that are no longer needed.
+//
+// The main file always spans a full stripe and the first companion file is always present, so
+// that the layout of the image remains consistent with its stripe map.
+func (sf *stripedFile) Truncate(size int64) error {
+	i := int(size / sf.size)
+	if i < 1 {
+		// Zero the tail of the main file, and keep an empty first companion file.
+		if err := sf.files[0].Truncate(size); err != nil {
+			return err
+		}
+		if err := sf.files[0].Truncate(sf.size); err != nil {
+			return err
+		}
+		size = sf.size
+		i = 1
+	}
+
+	f, err := sf.file(i)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size - int64(i)*sf.size); err != nil {
+		return err
+	}
+
+	for len(sf.files) > i+1 {
+		last := len(sf.files) - 1
+		if err := sf.files[last].Close(); err != nil {
+			return err
+		}
+		if err := os.Remove(stripeName(sf.name, last)); err != nil {
+			return err
+		}
+		sf.files = sf.files[:last]
+	}
+	return nil
+}
+
+// Sync commits the contents of all stripe files to stable storage.
+func (sf *stripedFile) Sync() error {
+	for _, f := range sf.files {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all stripe files.
+func (sf *stripedFile) Close() error {
+	var err error
+	for _, f := range sf.files {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Stat returns a FileInfo describing the image as a whole.
+func (sf *stripedFile) Stat() (os.FileInfo, error) {
+	fi, err := sf.files[0].Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := sf.Len()
+	if err != nil {
+		return nil, err
+	}
+	return &stripedFileInfo{FileInfo: fi, size: size}, nil
+}
+
+// stripedFileInfo describes a striped image, reporting the total size of all stripes.
+type stripedFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+// Size returns the total size of the image.
+func (fi *stripedFileInfo) Size() int64 {
+	return fi.size
+}
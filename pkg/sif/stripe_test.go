@@ -0,0 +1,301 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestCreateContainerStriped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-stripe-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// two objects, each larger than a stripe, to force data across several companion files
+	payloads := [][]byte{
+		bytes.Repeat([]byte{0xfa, 0xce}, 3*DataStartOffset),
+		bytes.Repeat([]byte{0xfe, 0xed}, 2*DataStartOffset),
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "striped.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion2,
+		ID:         uuid.NewV4(),
+		StripeSize: DataStartOffset,
+	}
+	for _, p := range payloads {
+		cinfo.InputDescr = append(cinfo.InputDescr, DescriptorInput{
+			Datatype: DataGeneric,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Fname:    "generic",
+			Data:     p,
+			Size:     int64(len(p)),
+		})
+	}
+
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatalf("CreateContainer(cinfo): %s", err)
+	}
+
+	// main file must span exactly one stripe
+	fi, err := os.Stat(cinfo.Pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fi.Size(), int64(DataStartOffset); got != want {
+		t.Errorf("got main file size %d, want %d", got, want)
+	}
+	if !exists(stripeName(cinfo.Pathname, 1)) {
+		t.Fatalf("expected companion files next to %s", cinfo.Pathname)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", cinfo.Pathname, err)
+	}
+
+	for i, p := range payloads {
+		d, _, err := fimg.GetFromDescrID(uint32(i + 1))
+		if err != nil {
+			t.Fatalf("fimg.GetFromDescrID(%d): %s", i+1, err)
+		}
+		if !bytes.Equal(d.GetData(&fimg), p) {
+			t.Errorf("data object %d does not match input data", i+1)
+		}
+	}
+
+	// deleting the last object shrinks the image, and unused companion files are removed
+	n := 0
+	for exists(stripeName(cinfo.Pathname, n+1)) {
+		n++
+	}
+	if err := fimg.DeleteObject(2, DelCompact); err != nil {
+		t.Fatalf("fimg.DeleteObject(2, DelCompact): %s", err)
+	}
+	if _, err := os.Stat(stripeName(cinfo.Pathname, n)); !os.IsNotExist(err) {
+		t.Errorf("expected companion file %s to be removed", stripeName(cinfo.Pathname, n))
+	}
+
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Errorf("fimg.UnloadContainer(): %s", err)
+	}
+
+	// the remaining object is still intact after reloading
+	fimg, err = LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", cinfo.Pathname, err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	d, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatalf("fimg.GetFromDescrID(1): %s", err)
+	}
+	if !bytes.Equal(d.GetData(&fimg), payloads[0]) {
+		t.Error("data object 1 does not match input data")
+	}
+}
+
+func TestCreateContainerStripeSizeInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-stripe-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "striped.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion2,
+		ID:         uuid.NewV4(),
+		StripeSize: DataStartOffset - 1,
+	}
+
+	if _, err := CreateContainer(cinfo); err == nil {
+		t.Error("CreateContainer(cinfo): unexpected success")
+	}
+
+	if _, err := createStriped(cinfo.Pathname, cinfo.StripeSize, DefaultFileMode); !errors.Is(err, errStripeSizeInvalid) {
+		t.Errorf("got error %v, want %v", err, errStripeSizeInvalid)
+	}
+}
+
+// exists returns true if the file named name exists.
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func TestCreateContainerStripeUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-stripe-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "striped.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion1,
+		ID:         uuid.NewV4(),
+		StripeSize: DataStartOffset,
+	}
+
+	if _, err := CreateContainer(cinfo); !errors.Is(err, errStripeUnsupported) {
+		t.Errorf("got error %v, want %v", err, errStripeUnsupported)
+	}
+}
+
+func TestLoadContainerUnrelatedCompanion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-stripe-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion2,
+		ID:         uuid.NewV4(),
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatalf("CreateContainer(cinfo): %s", err)
+	}
+
+	// a file that happens to be named like a companion file must be neither read nor modified
+	other := stripeName(cinfo.Pathname, 1)
+	want := []byte("unrelated")
+	if err := ioutil.WriteFile(other, want, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", cinfo.Pathname, err)
+	}
+	if _, ok := fimg.Fp.(*stripedFile); ok {
+		t.Error("image unexpectedly loaded as striped")
+	}
+
+	input := DescriptorInput{
+		Datatype: DataGeneric,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "generic",
+		Data:     bytes.Repeat([]byte{0xfa, 0xce}, DataStartOffset),
+	}
+	input.Size = int64(len(input.Data))
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatalf("fimg.AddObject(input): %s", err)
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Errorf("fimg.UnloadContainer(): %s", err)
+	}
+
+	if got, err := ioutil.ReadFile(other); err != nil {
+		t.Errorf("unrelated file: %s", err)
+	} else if !bytes.Equal(got, want) {
+		t.Errorf("unrelated file modified: got %q, want %q", got, want)
+	}
+}
+
+func TestLoadContainerStripeMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-stripe-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte{0xfa, 0xce}, 3*DataStartOffset)
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "striped.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion2,
+		ID:         uuid.NewV4(),
+		StripeSize: DataStartOffset,
+		InputDescr: []DescriptorInput{{
+			Datatype: DataGeneric,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Fname:    "generic",
+			Data:     data,
+			Size:     int64(len(data)),
+		}},
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(t *testing.T)
+		wantErr error
+	}{
+		{
+			name: "Intact",
+		},
+		{
+			name: "Missing",
+			modify: func(t *testing.T) {
+				if err := os.Remove(stripeName(cinfo.Pathname, 2)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: os.ErrNotExist,
+		},
+		{
+			name: "Short",
+			modify: func(t *testing.T) {
+				if err := os.Truncate(stripeName(cinfo.Pathname, 1), DataStartOffset-1); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: errStripeFileMismatch,
+		},
+		{
+			name: "Long",
+			modify: func(t *testing.T) {
+				if err := os.Truncate(stripeName(cinfo.Pathname, 3), DataStartOffset+1); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: errStripeFileMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatalf("CreateContainer(cinfo): %s", err)
+			}
+			if tt.modify != nil {
+				tt.modify(t)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, true)
+			if err == nil {
+				defer fimg.UnloadContainer() // nolint:errcheck
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("LoadContainer(%s, true): %s", cinfo.Pathname, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
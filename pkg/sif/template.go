@@ -0,0 +1,349 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+)
+
+// A template image holds placeholder objects, which reserve space for a data object of a declared
+// type and maximum size, to be filled in later by Bind. The remaining objects of a template may be
+// signed before it is distributed, so that only the content of its placeholders is supplied at
+// deploy time. To keep such signatures valid, placeholders must be placed in an object group that
+// is not signed with the rest of the template.
+//
+// A placeholder may pin the digest of the content approved for it, in which case Bind accepts no
+// other content. The digest of the content bound to each placeholder is recorded in a JSON object
+// named BindingsName, which is placed in the object group of the first placeholder bound.
+
+var (
+	errPlaceholderSize     = errors.New("placeholder size invalid")
+	errPlaceholderDatatype = errors.New("datatype not supported for placeholder")
+	errNotPlaceholder      = errors.New("object is not a placeholder")
+	errBindDatatype        = errors.New("datatype does not match placeholder")
+	errBindSize            = errors.New("content exceeds placeholder size")
+	errBindUnseekable      = errors.New("content must be seekable to check approved digest")
+)
+
+// ErrBindDigestMismatch is the error returned when content bound to a placeholder does not match
+// the digest approved for it.
+var ErrBindDigestMismatch = errors.New("content does not match approved digest")
+
+// BindingsName is the name of the object recording the content bound to placeholders.
+const BindingsName = "sif-bindings.json"
+
+// Binding records the content bound to a placeholder.
+type Binding struct {
+	ID       uint32 `json:"id"`       // ID of the bound object
+	Datatype string `json:"datatype"` // datatype of the bound object
+	Size     int64  `json:"size"`     // size of the bound content
+	Digest   string `json:"digest"`   // digest of the bound content, of the form "sha256:<hex>"
+	Bound    int64  `json:"bound"`    // time the content was bound, as a Unix time
+}
+
+// zeroReader reads zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// NewPlaceholderInput returns a DescriptorInput for a placeholder object, reserving size bytes for
+// a data object of type dt. If digest is not empty, only content with that sha256 or sha512
+// digest may be bound to the placeholder. The placeholder is in the default object group, and
+// the Groupid of the returned input should be changed if that group is to be signed.
+func NewPlaceholderInput(dt Datatype, size int64, digest string) (DescriptorInput, error) {
+	if size <= 0 {
+		return DescriptorInput{}, fmt.Errorf("%w: %d", errPlaceholderSize, size)
+	}
+
+	// Signatures reference the objects they cover, so cannot be supplied later.
+	if dt == DataPlaceholder || dt == DataSignature || !isKnownDatatype(dt) {
+		return DescriptorInput{}, fmt.Errorf("%w: %v", errPlaceholderDatatype, dt)
+	}
+
+	if digest != "" {
+		if _, _, err := parseOCIDigest(digest); err != nil {
+			return DescriptorInput{}, err
+		}
+	}
+
+	di := DescriptorInput{
+		Datatype: DataPlaceholder,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     size,
+		Fname:    "placeholder",
+		Fp:       io.LimitReader(zeroReader{}, size),
+	}
+
+	extra := Placeholder{Datatype: dt}
+	copy(extra.Digest[:], digest)
+
+	// serialize the placeholder data for integration with the base descriptor input
+	if err := binary.Write(&di.Extra, binary.LittleEndian, extra); err != nil {
+		return DescriptorInput{}, err
+	}
+	return di, nil
+}
+
+// getPlaceholder extracts the Placeholder from the Extra field of a Placeholder Descriptor.
+func (d *Descriptor) getPlaceholder() (Placeholder, error) {
+	var pinfo Placeholder
+
+	if d.Datatype != DataPlaceholder {
+		return pinfo, fmt.Errorf("%w: got %v", errNotPlaceholder, d.Datatype)
+	}
+
+	b := bytes.NewReader(d.Extra[:])
+	if err := binary.Read(b, binary.LittleEndian, &pinfo); err != nil {
+		return pinfo, fmt.Errorf("while extracting placeholder extra info: %s", err)
+	}
+
+	return pinfo, nil
+}
+
+// GetPlaceholderType extracts the datatype of the object to be bound from the Extra field of a
+// Placeholder Descriptor.
+func (d *Descriptor) GetPlaceholderType() (Datatype, error) {
+	pinfo, err := d.getPlaceholder()
+	if err != nil {
+		return 0, err
+	}
+	return pinfo.Datatype, nil
+}
+
+// GetPlaceholderDigest extracts the approved digest of the content to be bound from the Extra
+// field of a Placeholder Descriptor. If no digest is approved, an empty string is returned.
+func (d *Descriptor) GetPlaceholderDigest() (string, error) {
+	pinfo, err := d.getPlaceholder()
+	if err != nil {
+		return "", err
+	}
+	return trimZeroBytes(pinfo.Digest[:]), nil
+}
+
+// checkApproved checks that the content of input matches the approved digest, leaving the content
+// to be read again.
+func checkApproved(input *DescriptorInput, digest string) error {
+	h, enc, err := parseOCIDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	w := h()
+	if input.Data != nil {
+		w.Write(input.Data) // nolint:errcheck
+	} else {
+		rs, ok := input.Fp.(io.ReadSeeker)
+		if !ok {
+			return errBindUnseekable
+		}
+		if _, err := io.Copy(w, rs); err != nil {
+			return err
+		}
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	if hex.EncodeToString(w.Sum(nil)) != enc {
+		return ErrBindDigestMismatch
+	}
+	return nil
+}
+
+// GetBindings returns the record of the content bound to the placeholders of the image. If no
+// content has been bound, ErrNotFound is returned.
+func (fimg *FileImage) GetBindings() ([]Binding, error) {
+	d, err := fimg.GetDescriptor(WithDataType(DataGenericJSON), WithName(BindingsName))
+	if err != nil {
+		return nil, err
+	}
+
+	var bs []Binding
+	if err := json.NewDecoder(d.GetReadSeeker(fimg)).Decode(&bs); err != nil {
+		return nil, fmt.Errorf("decoding bindings: %s", err)
+	}
+	return bs, nil
+}
+
+// writeBindings records bs in the bindings object of the image, adding the object to group
+// groupID if required.
+func (fimg *FileImage) writeBindings(bs []Binding, groupID uint32) error {
+	b, err := json.MarshalIndent(bs, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	input := DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  groupID,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(b)),
+		Fname:    BindingsName,
+		Data:     b,
+	}
+
+	d, err := fimg.GetDescriptor(WithDataType(DataGenericJSON), WithName(BindingsName))
+	if errors.Is(err, ErrNotFound) {
+		if err := fimg.AddObject(input); err != nil {
+			return err
+		}
+		return fimg.remap()
+	} else if err != nil {
+		return err
+	}
+	return fimg.ReplaceObject(d.ID, input)
+}
+
+// Bind fills the placeholder object referred to by id with the data described by input, which
+// must be of the datatype declared by the placeholder, and no larger than the space it reserves.
+// The object keeps its ID, and takes the datatype, name, Extra field and checksum of input. The
+// Groupid, Link, Alignment and Compression fields of input are ignored. If the placeholder pins an
+// approved digest, the data must match it, and ErrBindDigestMismatch is returned otherwise.
+//
+// The sha256 digest of the bound data is recorded in the object named BindingsName, and returned.
+func (fimg *FileImage) Bind(id uint32, input DescriptorInput) (string, error) {
+	if err := fimg.checkWritable(); err != nil {
+		return "", err
+	}
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return "", err
+	}
+
+	pinfo, err := descr.getPlaceholder()
+	if err != nil {
+		return "", err
+	}
+	if input.Datatype != pinfo.Datatype {
+		return "", fmt.Errorf("%w: got %v, want %v", errBindDatatype, input.Datatype, pinfo.Datatype)
+	}
+	if input.Size > descr.Filelen {
+		return "", fmt.Errorf("%w: %d bytes, %d reserved", errBindSize, input.Size, descr.Filelen)
+	}
+	if err := checkChecksum(input.Datatype, input.Checksum); err != nil {
+		return "", err
+	}
+
+	if approved := trimZeroBytes(pinfo.Digest[:]); approved != "" {
+		if err := checkApproved(&input, approved); err != nil {
+			return "", err
+		}
+	}
+
+	var r io.Reader = bytes.NewReader(input.Data)
+	if input.Data == nil {
+		r = input.Fp
+	}
+
+	// The data is written over the reserved space, and the remainder is cleared, so the image
+	// does not depend on the content that was bound before.
+	if _, err := fimg.Fp.Seek(descr.Fileoff, io.SeekStart); err != nil {
+		return "", fmt.Errorf("setting file offset pointer to placeholder: %s", err)
+	}
+
+	h := sha256.New()
+	w := fimg.limitWriter(fimg.Fp)
+	for _, ih := range input.Hashes {
+		w = io.MultiWriter(w, ih)
+	}
+
+	var ch hash.Hash
+	if input.Checksum != 0 {
+		if ch, err = newChecksumHash(input.Checksum); err != nil {
+			return "", err
+		}
+		w = io.MultiWriter(w, ch)
+	}
+	n, err := io.Copy(w, io.TeeReader(io.LimitReader(r, descr.Filelen+1), h))
+	if err != nil {
+		return "", fmt.Errorf("copying data object to SIF file: %s", err)
+	}
+	if n > descr.Filelen || (input.Size != 0 && n != input.Size) {
+		return "", fmt.Errorf("%w: %d bytes, %d reserved", errBindSize, n, descr.Filelen)
+	}
+	if _, err := io.Copy(w, io.LimitReader(zeroReader{}, descr.Filelen-n)); err != nil {
+		return "", fmt.Errorf("clearing placeholder: %s", err)
+	}
+	digest := "sha256:" + hex.EncodeToString(h.Sum(nil))
+
+	extra, err := ioutil.ReadAll(&input.Extra)
+	if err != nil {
+		return "", err
+	}
+
+	d := *descr
+	d.Datatype = input.Datatype
+	d.Filelen = n
+	d.Mtime = fimg.now()
+	d.SetName(input.Fname)
+	d.SetExtra(extra)
+	if ch != nil {
+		t := checksumTrailer{Hashtype: input.Checksum}
+		copy(t.Digest[:], ch.Sum(nil))
+		d.setChecksum(t)
+	}
+
+	prev, hdr, primPartID := *descr, fimg.Header, fimg.PrimPartID
+	*descr = d
+
+	if err := fimg.addPrimPart(descr); err != nil {
+		*descr, fimg.Header, fimg.PrimPartID = prev, hdr, primPartID
+		return "", err
+	}
+
+	err = fimg.guarded(func() error {
+		if err := writeDescriptors(fimg); err != nil {
+			return err
+		}
+
+		fimg.Header.Mtime = fimg.now()
+		if err := writeHeader(fimg); err != nil {
+			return err
+		}
+
+		if err := fimg.Fp.Sync(); err != nil {
+			return fmt.Errorf("while sync'ing bound data object to SIF file: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		*descr, fimg.Header, fimg.PrimPartID = prev, hdr, primPartID
+		return "", err
+	}
+
+	bs, err := fimg.GetBindings()
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+	bs = append(bs, Binding{
+		ID:       id,
+		Datatype: d.Datatype.String(),
+		Size:     n,
+		Digest:   digest,
+		Bound:    d.Mtime,
+	})
+
+	if err := fimg.writeBindings(bs, d.Groupid); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestNewPlaceholderInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		dt      Datatype
+		size    int64
+		digest  string
+		wantErr error
+	}{
+		{"Partition", DataPartition, 4096, "", nil},
+		{"Digest", DataPartition, 4096, "sha256:" + strings.Repeat("a", 64), nil},
+		{"SizeZero", DataPartition, 0, "", errPlaceholderSize},
+		{"Signature", DataSignature, 4096, "", errPlaceholderDatatype},
+		{"Placeholder", DataPlaceholder, 4096, "", errPlaceholderDatatype},
+		{"Unknown", Datatype(0), 4096, "", errPlaceholderDatatype},
+		{"DigestInvalid", DataPartition, 4096, "md5:abc", errOCIDigestInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			di, err := NewPlaceholderInput(tt.dt, tt.size, tt.digest)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			var d Descriptor
+			d.Datatype = di.Datatype
+			d.SetExtra(di.Extra.Bytes())
+
+			if got, err := d.GetPlaceholderType(); err != nil || got != tt.dt {
+				t.Errorf("got datatype %v (%v), want %v", got, err, tt.dt)
+			}
+			if got, err := d.GetPlaceholderDigest(); err != nil || got != tt.digest {
+				t.Errorf("got digest %v (%v), want %v", got, err, tt.digest)
+			}
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-template-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	approved := []byte("approved partition")
+	approvedDigest, err := OCIDigest(bytes.NewReader(approved))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	placeholder := func(t *testing.T, dt Datatype, size int64, digest string) DescriptorInput {
+		di, err := NewPlaceholderInput(dt, size, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return di
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "template.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			{
+				Datatype: DataDeffile,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     8,
+				Fname:    "deffile",
+				Data:     []byte("skeleton"),
+			},
+			placeholder(t, DataPartition, 64, approvedDigest),
+			placeholder(t, DataGeneric, 16, ""),
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partInput := func(t *testing.T, data []byte) DescriptorInput {
+		di := DescriptorInput{
+			Datatype: DataPartition,
+			Size:     int64(len(data)),
+			Fname:    "rootfs",
+			Data:     data,
+		}
+		if err := di.SetPartExtra(FsRaw, PartPrimSys, HdrArchAMD64); err != nil {
+			t.Fatal(err)
+		}
+		return di
+	}
+
+	genericInput := func(data []byte) DescriptorInput {
+		return DescriptorInput{
+			Datatype: DataGeneric,
+			Size:     int64(len(data)),
+			Fname:    "generic",
+			Fp:       bytes.NewReader(data),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		id      uint32
+		input   DescriptorInput
+		wantErr error
+	}{
+		{"NotPlaceholder", 1, genericInput([]byte("x")), errNotPlaceholder},
+		{"Datatype", 2, genericInput(approved), errBindDatatype},
+		{"NotApproved", 2, partInput(t, []byte("unapproved")), ErrBindDigestMismatch},
+		{"TooLarge", 3, genericInput(make([]byte, 17)), errBindSize},
+		{"Approved", 2, partInput(t, approved), nil},
+		{"Generic", 3, genericInput([]byte("generic")), nil},
+		{"AlreadyBound", 3, genericInput([]byte("generic")), errNotPlaceholder},
+	}
+
+	digests := make(map[uint32]string)
+	for _, tt := range tests {
+		digest, err := fimg.Bind(tt.id, tt.input)
+		if got, want := err, tt.wantErr; !errors.Is(got, want) {
+			t.Fatalf("%v: got error %v, want %v", tt.name, got, want)
+		}
+		if err == nil {
+			digests[tt.id] = digest
+		}
+	}
+
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg, err = LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	if got, want := digests[2], approvedDigest; got != want {
+		t.Errorf("got digest %v, want %v", got, want)
+	}
+
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := part.Datatype, DataPartition; got != want {
+		t.Errorf("got datatype %v, want %v", got, want)
+	}
+	if got, want := part.GetName(), "rootfs"; got != want {
+		t.Errorf("got name %v, want %v", got, want)
+	}
+	if got, want := part.GetData(&fimg), approved; !bytes.Equal(got, want) {
+		t.Errorf("got data %q, want %q", got, want)
+	}
+	if pt, err := part.GetPartType(); err != nil || pt != PartPrimSys {
+		t.Errorf("got parttype %v (%v), want %v", pt, err, PartPrimSys)
+	}
+	if got, want := fimg.PrimPartID, uint32(2); got != want {
+		t.Errorf("got primary partition %v, want %v", got, want)
+	}
+	if got, want := fimg.Header.GetArch(), HdrArchAMD64; got != want {
+		t.Errorf("got arch %q, want %q", got, want)
+	}
+
+	bs, err := fimg.GetBindings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(bs), 2; got != want {
+		t.Fatalf("got %v bindings, want %v", got, want)
+	}
+	for _, b := range bs {
+		if got, want := b.Digest, digests[b.ID]; got != want {
+			t.Errorf("object %v: got digest %v, want %v", b.ID, got, want)
+		}
+	}
+	if got, want := bs[0].Datatype, DataPartition.String(); got != want {
+		t.Errorf("got datatype %v, want %v", got, want)
+	}
+}
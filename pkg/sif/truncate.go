@@ -0,0 +1,154 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Images cut short in transfer retain a valid header and descriptor table, but the data of one or
+// more objects extends beyond the end of the file. Such images load successfully, and the damage
+// may go unnoticed until the missing data is read.
+
+// ErrTruncated is the code for when the data section of an image extends beyond the end of the
+// file.
+var ErrTruncated = errors.New("image truncated")
+
+var errNotTruncated = errors.New("image not truncated")
+
+// TruncatedObject describes a data object whose data extends beyond the end of the file.
+type TruncatedObject struct {
+	ID      uint32 // ID of the data object
+	Fileoff int64  // offset of the data object
+	Filelen int64  // declared length of the data object
+	Missing int64  // number of bytes of the data object beyond the end of the file
+}
+
+// CheckTruncated checks whether the data section of the image, as described by the global header,
+// extends beyond the end of the file. If so, an error wrapping ErrTruncated is returned, along with
+// the data objects that are incomplete, in descriptor order.
+func (fimg *FileImage) CheckTruncated() ([]TruncatedObject, error) {
+	var tos []TruncatedObject
+	for _, v := range fimg.DescrArr {
+		if !v.Used {
+			continue
+		}
+		if end := v.Fileoff + v.Filelen; end > fimg.Filesize {
+			missing := end - fimg.Filesize
+			if missing > v.Filelen {
+				missing = v.Filelen
+			}
+			tos = append(tos, TruncatedObject{
+				ID:      v.ID,
+				Fileoff: v.Fileoff,
+				Filelen: v.Filelen,
+				Missing: missing,
+			})
+		}
+	}
+
+	if want := fimg.Header.Dataoff + fimg.Header.Datalen; want > fimg.Filesize || len(tos) > 0 {
+		return tos, fmt.Errorf("%w: file size %d, want %d", ErrTruncated, fimg.Filesize, want)
+	}
+	return nil, nil
+}
+
+// Repair writes a copy of the truncated image to the file at path, containing only complete data
+// objects. The descriptors of incomplete objects are freed, and the objects removed are returned.
+// If the image is not truncated, an error is returned and no file is written. The file is created
+// with the permissions of the image, plus write permission for the owner.
+//
+// A repaired image no longer matches any manifest added by Seal, so it is not marked as sealed.
+// Signatures covering removed objects will fail verification. To repair other inconsistencies in
+// the structure of an image, modifying it in place, use RepairInPlace.
+func (fimg *FileImage) Repair(path string) ([]TruncatedObject, error) {
+	tos, err := fimg.CheckTruncated()
+	if err == nil {
+		return nil, errNotTruncated
+	} else if !errors.Is(err, ErrTruncated) {
+		return nil, err
+	}
+
+	// Copy everything up to the end of the last complete object.
+	end := fimg.Header.Dataoff
+	for _, v := range fimg.DescrArr {
+		if !v.Used || v.Fileoff+v.Filelen > fimg.Filesize {
+			continue
+		}
+		if e := v.Fileoff + v.Filelen; e > end {
+			end = e
+		}
+	}
+	if end > fimg.Filesize {
+		end = fimg.Filesize
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fimg.fileMode())
+	if err != nil {
+		return nil, fmt.Errorf("repaired file creation failed: %s", err)
+	}
+
+	if _, err := io.Copy(f, io.NewSectionReader(fimg.Fp, 0, end)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("copying image: %s", err)
+	}
+
+	rimg, err := LoadContainerFp(f, false)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if err := rimg.removeTruncated(tos); err != nil {
+		rimg.UnloadContainer() // nolint:errcheck
+		return nil, err
+	}
+
+	if err := rimg.UnloadContainer(); err != nil {
+		return nil, err
+	}
+	return tos, nil
+}
+
+// removeTruncated frees the descriptors of the objects in tos, and updates the global header to
+// reflect their removal.
+func (fimg *FileImage) removeTruncated(tos []TruncatedObject) error {
+	for _, to := range tos {
+		d, index, err := fimg.GetFromDescrID(to.ID)
+		if err != nil {
+			return err
+		}
+		fimg.Header.Datalen -= d.Storelen
+
+		if err := resetDescriptor(fimg, index); err != nil {
+			return err
+		}
+		fimg.Header.Dfree++
+	}
+
+	// Storage lengths include alignment padding, so may not account for the data section exactly.
+	if n := fimg.Filesize - fimg.Header.Dataoff; fimg.Header.Datalen > n {
+		fimg.Header.Datalen = n
+	}
+	if fimg.Header.Datalen < 0 {
+		fimg.Header.Datalen = 0
+	}
+
+	fimg.flags &^= hdrFlagSealed
+	fimg.Header.Mtime = fimg.now()
+	if err := writeHeader(fimg); err != nil {
+		return err
+	}
+
+	if err := fimg.Fp.Sync(); err != nil {
+		return fmt.Errorf("while sync'ing repaired SIF file: %s", err)
+	}
+
+	return nil
+}
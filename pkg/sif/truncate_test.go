@@ -0,0 +1,135 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-truncate-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	object := func(name string, size int) DescriptorInput {
+		return DescriptorInput{
+			Datatype: DataGeneric,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     int64(size),
+			Fname:    name,
+			Data:     bytes.Repeat([]byte(name[:1]), size),
+		}
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, "image.sif"),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			object("a", 16),
+			object("b", 8192),
+			object("c", 16),
+		},
+	}
+	fimg, err := CreateContainer(cinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := fimg.DescrArr[1]
+
+	t.Run("NotTruncated", func(t *testing.T) {
+		fimg, err := LoadContainer(cinfo.Pathname, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fimg.UnloadContainer() // nolint:errcheck
+
+		tos, err := fimg.CheckTruncated()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tos) != 0 {
+			t.Errorf("got truncated objects %+v, want none", tos)
+		}
+
+		if _, err := fimg.Repair(filepath.Join(dir, "not-truncated.sif")); !errors.Is(err, errNotTruncated) {
+			t.Errorf("got error %v, want %v", err, errNotTruncated)
+		}
+	})
+
+	// Cut the image short, part way through the second object.
+	if err := os.Truncate(cinfo.Pathname, b.Fileoff+100); err != nil {
+		t.Fatal(err)
+	}
+
+	fimg2, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg2.UnloadContainer() // nolint:errcheck
+
+	wantTruncated := []TruncatedObject{
+		{ID: 2, Fileoff: b.Fileoff, Filelen: 8192, Missing: 8092},
+		{ID: 3, Fileoff: fimg.DescrArr[2].Fileoff, Filelen: 16, Missing: 16},
+	}
+
+	tos, err := fimg2.CheckTruncated()
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("got error %v, want %v", err, ErrTruncated)
+	}
+	if got, want := tos, wantTruncated; !reflect.DeepEqual(got, want) {
+		t.Errorf("got truncated objects %+v, want %+v", got, want)
+	}
+
+	path := filepath.Join(dir, "repaired.sif")
+	tos, err = fimg2.Repair(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tos, wantTruncated; !reflect.DeepEqual(got, want) {
+		t.Errorf("got removed objects %+v, want %+v", got, want)
+	}
+
+	rimg, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rimg.UnloadContainer() // nolint:errcheck
+
+	if _, err := rimg.CheckTruncated(); err != nil {
+		t.Errorf("repaired image: %v", err)
+	}
+
+	if got, want := rimg.Header.Dfree, fimg.Header.Dfree+2; got != want {
+		t.Errorf("got %v free descriptors, want %v", got, want)
+	}
+
+	d, _, err := rimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.GetData(&rimg), bytes.Repeat([]byte("a"), 16); !bytes.Equal(got, want) {
+		t.Errorf("got data %q, want %q", got, want)
+	}
+
+	for _, id := range []uint32{2, 3} {
+		if _, _, err := rimg.GetFromDescrID(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("object %v: got error %v, want %v", id, err, ErrNotFound)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// A transaction stages several additions, replacements and deletions of data objects, and
+// commits them together. Data objects are written to the end of the data section as they are
+// staged, while the descriptor table and global header are only updated on commit. The updated
+// table and header are first written to a journal alongside the image. If the commit is
+// interrupted, the journal is replayed when the image is next loaded read-write with
+// OptLoadRecoverJournal, so that the image reflects either none or all of the staged operations.
+//
+// The journal records the ID and size of the image, and a checksum of the global header it
+// replaces. A journal is only replayed into the image it was written for, in the state it was
+// written in, and each record must lie within the image.
+
+var (
+	errTxnDone        = errors.New("transaction already committed or rolled back")
+	errTxnNoJournal   = errors.New("transaction requires an image loaded from a named file")
+	errJournalInvalid = errors.New("journal invalid")
+
+	// ErrJournalPending is the error returned when loading an image read-write without
+	// OptLoadRecoverJournal, while the journal of an interrupted transaction on the image is
+	// pending. Loading the image read-write with OptLoadRecoverJournal replays the journal.
+	ErrJournalPending = errors.New("image has a pending transaction journal")
+
+	// ErrJournalMismatch is the error returned when loading an image with OptLoadRecoverJournal,
+	// while a journal written for a different image, or for the image in a different state, is
+	// present.
+	ErrJournalMismatch = errors.New("journal does not match image")
+)
+
+// journalSuffix is appended to the name of an image to obtain the name of its journal.
+const journalSuffix = ".journal"
+
+// journalMagic identifies a journal file.
+var journalMagic = [8]byte{'S', 'I', 'F', 'J', 'R', 'N', 'L', 0}
+
+// journalRecord describes data to be written at an offset of the image.
+type journalRecord struct {
+	off  int64
+	data []byte
+}
+
+// journal describes the records of a commit, and the image to which they apply.
+type journal struct {
+	id     uuid.UUID // ID of the image
+	size   int64     // size of the image when the journal was written
+	hdrCRC uint32    // checksum of the global header replaced by the records
+	recs   []journalRecord
+}
+
+// OptLoadRecoverJournal specifies whether a transaction on the image that was interrupted once
+// its journal was written is completed as the image is loaded read-write. A journal is only
+// replayed if it was written for the image, and ErrJournalMismatch is returned otherwise. A
+// journal that was not completely written is discarded, as the image was not modified.
+//
+// Without this option, loading an image read-write fails with ErrJournalPending if a journal of
+// the image is pending. Images loaded read-only are never modified, and any journal is ignored.
+func OptLoadRecoverJournal(b bool) LoadOpt {
+	return func(lo *loadOpts) error {
+		lo.recoverJournal = b
+		return nil
+	}
+}
+
+// Txn is a transaction on an image, created by Begin.
+type Txn struct {
+	fimg *FileImage
+	err  error
+	done bool
+
+	// state of the image when the transaction began
+	descrs     []Descriptor
+	h          Header
+	primPartID uint32
+	size       int64
+}
+
+// Begin starts a transaction on fimg. Operations staged on the returned Txn are not visible in
+// the image until Commit is called, and are discarded by Rollback. Data objects staged in the
+// transaction are not accessible through fimg until the transaction is committed, and no other
+// updates may be made to fimg while the transaction is in progress.
+//
+// If fimg may not be modified, the error is returned by the operations of the transaction.
+func (fimg *FileImage) Begin() *Txn {
+	t := &Txn{
+		fimg:       fimg,
+		descrs:     append([]Descriptor(nil), fimg.DescrArr...),
+		h:          fimg.Header,
+		primPartID: fimg.PrimPartID,
+	}
+
+	if t.err = fimg.checkWritable(); t.err != nil {
+		return t
+	}
+	if journalName(fimg.Fp) == "" {
+		t.err = errTxnNoJournal
+		return t
+	}
+
+	t.size, t.err = fimg.Fp.Seek(0, io.SeekEnd)
+	if t.err != nil {
+		t.err = fmt.Errorf("seeking to end of file: %s", t.err)
+	}
+	return t
+}
+
+// check returns an error if operations may not be staged on t.
+func (t *Txn) check() error {
+	if t.done {
+		return errTxnDone
+	}
+	return t.err
+}
+
+// AddObject stages the addition of a new data object and its descriptor. Unlike
+// FileImage.AddObject, the descriptor table is not grown, and ErrNoFreeDescriptor is returned if
+// no descriptor is free.
+func (t *Txn) AddObject(input DescriptorInput) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	_, err := t.fimg.stageAdd(input)
+	return err
+}
+
+// ReplaceObject stages the replacement of the data object referred to by id with the data
+// described by input, as described by FileImage.ReplaceObject.
+func (t *Txn) ReplaceObject(id uint32, input DescriptorInput) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	return t.fimg.stageReplace(id, input)
+}
+
+// DeleteObject stages the removal of the data object referred to by id. The space occupied by the
+// data object may be reclaimed with Compact once the transaction is committed.
+func (t *Txn) DeleteObject(id uint32) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	_, index, err := t.fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+
+	t.fimg.Header.Dfree++
+	releaseDescriptor(t.fimg, index)
+	return nil
+}
+
+// Rollback discards the operations staged on t, restoring the image to its state when the
+// transaction began.
+func (t *Txn) Rollback() error {
+	if t.done {
+		return errTxnDone
+	}
+	t.done = true
+
+	if t.err != nil {
+		return nil
+	}
+	t.restore()
+
+	// discard staged data; block devices cannot be truncated, and data beyond the data section is
+	// ignored in any case
+	_ = t.fimg.Fp.Truncate(t.size)
+	return nil
+}
+
+// restore restores the in-memory state of the image to its state when the transaction began.
+func (t *Txn) restore() {
+	t.fimg.DescrArr, t.fimg.Header, t.fimg.PrimPartID = t.descrs, t.h, t.primPartID
+}
+
+// Commit writes the operations staged on t to the image. If Commit is interrupted once the
+// journal is written, the operations are completed when the image is next loaded read-write.
+func (t *Txn) Commit() error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	t.done = true
+
+	fimg := t.fimg
+	fimg.Header.Descrlen = int64(binary.Size(fimg.DescrArr))
+	fimg.Header.Mtime = fimg.now()
+
+	j, err := t.journal()
+	if err != nil {
+		t.restore()
+		return err
+	}
+
+	return fimg.guarded(func() error {
+		name := journalName(fimg.Fp)
+
+		// until the journal is complete, the image is unmodified
+		if err := writeJournal(name, j, fimg.fileMode()); err != nil {
+			os.Remove(name) // nolint:errcheck
+			t.restore()
+			return err
+		}
+
+		if err := applyJournal(fimg.Fp, j.recs); err != nil {
+			return err
+		}
+		fimg.descrCRCErr = nil
+
+		if err := removeJournal(name); err != nil {
+			return err
+		}
+
+		// the staged data lies beyond the end of the previous mapping
+		return fimg.remap()
+	})
+}
+
+// journal returns the journal of the commit of t.
+func (t *Txn) journal() (journal, error) {
+	recs, err := t.fimg.topRecords()
+	if err != nil {
+		return journal{}, err
+	}
+
+	size, err := t.fimg.Fp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return journal{}, fmt.Errorf("seeking to end of file: %s", err)
+	}
+
+	crc, err := headerCRC(&t.h)
+	if err != nil {
+		return journal{}, fmt.Errorf("computing header checksum: %s", err)
+	}
+
+	return journal{id: t.h.ID, size: size, hdrCRC: crc, recs: recs}, nil
+}
+
+// topRecords returns journal records holding the global header and descriptor table of fimg.
+func (fimg *FileImage) topRecords() ([]journalRecord, error) {
+	var h bytes.Buffer
+	if err := binary.Write(&h, binary.LittleEndian, fimg.Header); err != nil {
+		return nil, fmt.Errorf("binary writing header to buf: %s", err)
+	}
+	if hasHeaderExt(fimg.Header.GetVersion()) {
+		sm, err := fimg.syncStripeMap()
+		if err != nil {
+			return nil, fmt.Errorf("writing stripe map: %s", err)
+		}
+		if err := writeHeaderExt(&h, &fimg.Header, fimg.DescrArr, fimg.flags, sm); err != nil {
+			return nil, fmt.Errorf("writing header extension: %s", err)
+		}
+	}
+
+	var d bytes.Buffer
+	if err := binary.Write(&d, binary.LittleEndian, fimg.DescrArr); err != nil {
+		return nil, fmt.Errorf("binary writing descrtable to buf: %s", err)
+	}
+
+	return []journalRecord{
+		{off: fimg.Header.Descroff, data: d.Bytes()},
+		{off: 0, data: h.Bytes()},
+	}, nil
+}
+
+// journalName returns the name of the journal of the image opened as fp, or an empty string if
+// fp is not a named file.
+func journalName(fp ReadWriter) string {
+	if _, ok := fp.(*readerAtFile); ok || fp.Name() == "" {
+		return ""
+	}
+	return fp.Name() + journalSuffix
+}
+
+// encodeJournal returns the serialized form of j, followed by its checksum.
+func encodeJournal(j journal) []byte {
+	var b bytes.Buffer
+	b.Write(journalMagic[:])
+	b.Write(j.id[:])
+	binary.Write(&b, binary.LittleEndian, j.size)              // nolint:errcheck
+	binary.Write(&b, binary.LittleEndian, j.hdrCRC)            // nolint:errcheck
+	binary.Write(&b, binary.LittleEndian, uint32(len(j.recs))) // nolint:errcheck
+	for _, r := range j.recs {
+		binary.Write(&b, binary.LittleEndian, r.off)              // nolint:errcheck
+		binary.Write(&b, binary.LittleEndian, int64(len(r.data))) // nolint:errcheck
+		b.Write(r.data)
+	}
+	binary.Write(&b, binary.LittleEndian, crc32.Checksum(b.Bytes(), castagnoli)) // nolint:errcheck
+	return b.Bytes()
+}
+
+// decodeJournal returns the journal serialized in b, validating its checksum, and that each
+// record lies within the image.
+func decodeJournal(b []byte) (journal, error) {
+	var j journal
+
+	if len(b) < len(journalMagic)+len(j.id)+20 || !bytes.Equal(b[:len(journalMagic)], journalMagic[:]) {
+		return j, fmt.Errorf("%w: truncated journal", errJournalInvalid)
+	}
+
+	body := b[:len(b)-4]
+	if crc32.Checksum(body, castagnoli) != binary.LittleEndian.Uint32(b[len(b)-4:]) {
+		return j, fmt.Errorf("%w: checksum mismatch", errJournalInvalid)
+	}
+
+	r := bytes.NewReader(body[len(journalMagic):])
+
+	if _, err := io.ReadFull(r, j.id[:]); err != nil {
+		return j, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &j.size); err != nil {
+		return j, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &j.hdrCRC); err != nil {
+		return j, err
+	}
+	if j.size < 0 {
+		return j, fmt.Errorf("%w: invalid image size %d", errJournalInvalid, j.size)
+	}
+
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return j, err
+	}
+
+	for i := uint32(0); i < n; i++ {
+		var off, size int64
+		if err := binary.Read(r, binary.LittleEndian, &off); err != nil {
+			return j, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return j, err
+		}
+		if off < 0 || size < 0 || size > int64(r.Len()) {
+			return j, fmt.Errorf("%w: invalid record", errJournalInvalid)
+		}
+		if end, err := addSize(off, size); err != nil || end > j.size {
+			return j, fmt.Errorf("%w: record at %d of %d bytes beyond end of image at %d", errJournalInvalid, off, size, j.size)
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return j, err
+		}
+		j.recs = append(j.recs, journalRecord{off: off, data: data})
+	}
+	return j, nil
+}
+
+// checkJournal returns an error wrapping ErrJournalMismatch if j was not written for the image
+// opened as fp in its current state. The global header of the image must be the one replaced by
+// j, or the one written by j, should the journal have been applied but not removed.
+func checkJournal(fp ReadWriter, j journal) error {
+	size, err := fp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("seeking to end of file: %s", err)
+	}
+	if size != j.size {
+		return fmt.Errorf("%w: image size %d, journal written for %d", ErrJournalMismatch, size, j.size)
+	}
+
+	var h Header
+	if err := binary.Read(io.NewSectionReader(fp, 0, size), binary.LittleEndian, &h); err != nil {
+		return fmt.Errorf("reading global header: %s", err)
+	}
+	if h.ID != j.id {
+		return fmt.Errorf("%w: image ID %s, journal written for %s", ErrJournalMismatch, h.ID, j.id)
+	}
+
+	crc, err := headerCRC(&h)
+	if err != nil {
+		return fmt.Errorf("computing header checksum: %s", err)
+	}
+	if crc == j.hdrCRC {
+		return nil
+	}
+
+	// the journal may have been applied, but not removed
+	n := binary.Size(h)
+	for _, r := range j.recs {
+		if r.off == 0 && len(r.data) >= n && crc32.Checksum(r.data[:n], castagnoli) == crc {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: global header modified since journal was written", ErrJournalMismatch)
+}
+
+// writeJournal writes j to the journal name, and syncs it to storage.
+func writeJournal(name string, j journal, mode os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return fmt.Errorf("creating journal: %s", err)
+	}
+
+	if _, err := f.Write(encodeJournal(j)); err != nil {
+		f.Close() // nolint:errcheck
+		return fmt.Errorf("writing journal: %s", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close() // nolint:errcheck
+		return fmt.Errorf("while sync'ing journal: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing journal: %s", err)
+	}
+
+	syncDir(filepath.Dir(name))
+	return nil
+}
+
+// removeJournal removes the journal name, once its records have been applied.
+func removeJournal(name string) error {
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("removing journal: %s", err)
+	}
+	syncDir(filepath.Dir(name))
+	return nil
+}
+
+// syncDir syncs the directory dir to storage, so that the creation or removal of a file within it
+// is durable. Not all platforms support syncing directories, so errors are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()  // nolint:errcheck
+		d.Close() // nolint:errcheck
+	}
+}
+
+// applyJournal writes recs to fp, and syncs it to storage.
+func applyJournal(fp ReadWriter, recs []journalRecord) error {
+	for _, r := range recs {
+		if _, err := fp.Seek(r.off, io.SeekStart); err != nil {
+			return fmt.Errorf("seeking to journal record: %s", err)
+		}
+		if _, err := fp.Write(r.data); err != nil {
+			return fmt.Errorf("writing journal record: %s", err)
+		}
+	}
+
+	if err := fp.Sync(); err != nil {
+		return fmt.Errorf("while sync'ing journal records to SIF file: %s", err)
+	}
+	return nil
+}
+
+// recoverJournal handles the journal of a transaction on the image opened as fp that was
+// interrupted once its journal was written. If rdonly is true, the image cannot be updated, and
+// the journal is ignored. Otherwise, if replay is true, a journal written for the image is
+// replayed, and a journal that was not completely written is discarded, as the image was not
+// modified. If replay is false, ErrJournalPending is returned if a journal written for the image
+// is present.
+func recoverJournal(fp ReadWriter, rdonly, replay bool) error {
+	name := journalName(fp)
+	if rdonly || name == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading journal: %s", err)
+	}
+
+	j, err := decodeJournal(b)
+	if err != nil {
+		if !replay {
+			return nil
+		}
+		return removeJournal(name)
+	}
+
+	if err := checkJournal(fp, j); err != nil {
+		if !replay && errors.Is(err, ErrJournalMismatch) {
+			return nil
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if !replay {
+		return fmt.Errorf("%w: %s", ErrJournalPending, name)
+	}
+
+	if err := applyJournal(fp, j.recs); err != nil {
+		return err
+	}
+	return removeJournal(name)
+}
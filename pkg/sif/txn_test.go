@@ -0,0 +1,383 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// createTxnImage creates an image holding two definition files in dir, and returns its path.
+func createTxnImage(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	cinfo := CreateInfo{
+		Pathname:   filepath.Join(dir, name),
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			txnInput("one"),
+			txnInput("two"),
+		},
+	}
+	if _, err := CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+	return cinfo.Pathname
+}
+
+// txnInput returns a DescriptorInput for a definition file holding data.
+func txnInput(data string) DescriptorInput {
+	return DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(data)),
+		Fname:    "deffile",
+		Data:     []byte(data),
+	}
+}
+
+// checkTxnObjects checks that the image at path holds objects with the specified IDs and data.
+func checkTxnObjects(t *testing.T, path string, want map[uint32]string) {
+	t.Helper()
+
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	var n int
+	for _, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+		n++
+
+		if got, ok := want[d.ID]; !ok {
+			t.Errorf("unexpected object %v", d.ID)
+		} else if data := string(d.GetData(&fimg)); data != got {
+			t.Errorf("object %v: got data %q, want %q", d.ID, data, got)
+		}
+	}
+	if got, want := n, len(want); got != want {
+		t.Errorf("got %v objects, want %v", got, want)
+	}
+	if got, want := int64(n), fimg.Header.Dtotal-fimg.Header.Dfree; got != want {
+		t.Errorf("got %v objects, header records %v", got, want)
+	}
+}
+
+func TestTxn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-txn-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		commit   bool
+		wantObjs map[uint32]string
+	}{
+		{"Commit", true, map[uint32]string{2: "replaced", 3: "three"}},
+		{"Rollback", false, map[uint32]string{1: "one", 2: "two"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := createTxnImage(t, dir, tt.name+".sif")
+
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			txn := fimg.Begin()
+			if err := txn.AddObject(txnInput("three")); err != nil {
+				t.Fatal(err)
+			}
+			if err := txn.ReplaceObject(2, txnInput("replaced")); err != nil {
+				t.Fatal(err)
+			}
+			if err := txn.DeleteObject(1); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.commit {
+				err = txn.Commit()
+			} else {
+				err = txn.Rollback()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := txn.AddObject(txnInput("four")), errTxnDone; !errors.Is(got, want) {
+				t.Errorf("got error %v, want %v", got, want)
+			}
+
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat(path + journalSuffix); !os.IsNotExist(err) {
+				t.Errorf("journal not removed: %v", err)
+			}
+
+			if !tt.commit {
+				after, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := after.Size(), fi.Size(); got != want {
+					t.Errorf("got size %v, want %v", got, want)
+				}
+			}
+
+			checkTxnObjects(t, path, tt.wantObjs)
+		})
+	}
+}
+
+func TestTxnReadOnly(t *testing.T) {
+	fimg, err := LoadContainer(filepath.Join("testdata", "testcontainer2.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	fimg.Fp = &readerAtFile{}
+
+	txn := fimg.Begin()
+	if got, want := txn.DeleteObject(1), errReaderAtReadOnly; !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+	if got, want := txn.Commit(), errReaderAtReadOnly; !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+}
+
+// interruptTxn stages the addition of an object to the image at path, and writes the journal of
+// its commit without applying it, as though the commit were interrupted. If apply is true, the
+// journal is applied, as though the commit were interrupted before the journal was removed.
+func interruptTxn(t *testing.T, path string, apply bool) {
+	t.Helper()
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	txn := fimg.Begin()
+	if err := txn.AddObject(txnInput("three")); err != nil {
+		t.Fatal(err)
+	}
+	j, err := txn.journal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJournal(path+journalSuffix, j, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if apply {
+		if err := applyJournal(fimg.Fp, j.recs); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecoverJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-txn-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		apply    bool
+		truncate bool
+		wantObjs map[uint32]string
+	}{
+		{"Complete", false, false, map[uint32]string{1: "one", 2: "two", 3: "three"}},
+		{"Applied", true, false, map[uint32]string{1: "one", 2: "two", 3: "three"}},
+		{"Incomplete", false, true, map[uint32]string{1: "one", 2: "two"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := createTxnImage(t, dir, tt.name+".sif")
+
+			interruptTxn(t, path, tt.apply)
+
+			if tt.truncate {
+				if err := os.Truncate(path+journalSuffix, 16); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				// the journal is ignored by read-only loads
+				fimg, err := LoadContainer(path, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := fimg.UnloadContainer(); err != nil {
+					t.Fatal(err)
+				}
+
+				// the journal is only replayed on request
+				_, err = LoadContainer(path, false)
+				if got, want := err, ErrJournalPending; !errors.Is(got, want) {
+					t.Fatalf("got error %v, want %v", got, want)
+				}
+			}
+
+			fimg, err := LoadContainer(path, false, OptLoadRecoverJournal(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat(path + journalSuffix); !os.IsNotExist(err) {
+				t.Errorf("journal not removed: %v", err)
+			}
+
+			checkTxnObjects(t, path, tt.wantObjs)
+		})
+	}
+}
+
+func TestRecoverJournalMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-txn-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, path string)
+	}{
+		{"OtherImage", func(t *testing.T, path string) {
+			other := createTxnImage(t, dir, "other.sif")
+			interruptTxn(t, other, false)
+
+			if err := os.Rename(other+journalSuffix, path+journalSuffix); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"Resized", func(t *testing.T, path string) {
+			interruptTxn(t, path, false)
+
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Truncate(path, fi.Size()+1); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"HeaderModified", func(t *testing.T, path string) {
+			interruptTxn(t, path, false)
+
+			f, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			// overwrite the modification time in the global header
+			if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, 72); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := createTxnImage(t, dir, tt.name+".sif")
+
+			tt.modify(t, path)
+
+			_, err := LoadContainer(path, false, OptLoadRecoverJournal(true))
+			if got, want := err, ErrJournalMismatch; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+
+			// a journal not written for the image does not prevent it from being loaded
+			fimg, err := LoadContainer(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fimg.UnloadContainer(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat(path + journalSuffix); err != nil {
+				t.Errorf("journal removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeJournal(t *testing.T) {
+	j := journal{
+		id:   uuid.NewV4(),
+		size: 4096,
+		recs: []journalRecord{
+			{off: 0, data: []byte("header")},
+			{off: 4092, data: []byte("tail")},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		recs    []journalRecord
+		wantErr error
+	}{
+		{"Valid", j.recs, nil},
+		{"NegativeOffset", []journalRecord{{off: -1, data: []byte("x")}}, errJournalInvalid},
+		{"BeyondEnd", []journalRecord{{off: 4093, data: []byte("tail")}}, errJournalInvalid},
+		{"Overflow", []journalRecord{{off: math.MaxInt64, data: []byte("x")}}, errJournalInvalid},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			in := j
+			in.recs = tt.recs
+
+			got, err := decodeJournal(encodeJournal(in))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, in) {
+				t.Errorf("got journal %+v, want %+v", got, in)
+			}
+		})
+	}
+}
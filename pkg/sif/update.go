@@ -0,0 +1,87 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The name, timestamps and ownership of a data object may be updated after it is added. Other
+// than the modification time, these fields are covered by signatures, so signatures covering an
+// updated object will fail verification until the object is signed again.
+
+var errNameTooLong = errors.New("name too long")
+
+// updateObject applies update to the descriptor of the data object with the specified id, and
+// writes the descriptor table and global header.
+func (fimg *FileImage) updateObject(id uint32, update func(d *Descriptor)) error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+
+	update(descr)
+
+	return fimg.guarded(func() error {
+		// write down the descriptor array
+		if err := writeDescriptors(fimg); err != nil {
+			return err
+		}
+
+		fimg.Header.Mtime = fimg.now()
+		// write down global header to file
+		if err := writeHeader(fimg); err != nil {
+			return err
+		}
+
+		if err := fimg.Fp.Sync(); err != nil {
+			return fmt.Errorf("while sync'ing updated descriptor to SIF file: %s", err)
+		}
+
+		return nil
+	})
+}
+
+// SetObjectName renames the data object with the specified id to name, which must be no longer
+// than DescrNameLen bytes.
+func (fimg *FileImage) SetObjectName(id uint32, name string) error {
+	if len(name) > DescrNameLen {
+		return fmt.Errorf("%w: %d bytes, maximum %d", errNameTooLong, len(name), DescrNameLen)
+	}
+
+	return fimg.updateObject(id, func(d *Descriptor) {
+		d.SetName(name)
+		d.Mtime = fimg.now()
+	})
+}
+
+// SetObjectTimes sets the creation and modification times of the data object with the specified
+// id. A zero time leaves the corresponding timestamp unchanged.
+func (fimg *FileImage) SetObjectTimes(id uint32, ctime, mtime time.Time) error {
+	return fimg.updateObject(id, func(d *Descriptor) {
+		if !ctime.IsZero() {
+			d.Ctime = ctime.Unix()
+		}
+		if !mtime.IsZero() {
+			d.Mtime = mtime.Unix()
+		}
+	})
+}
+
+// SetObjectOwner sets the user and group IDs owning the data object with the specified id.
+func (fimg *FileImage) SetObjectOwner(id uint32, uid, gid int64) error {
+	return fimg.updateObject(id, func(d *Descriptor) {
+		d.UID = uid
+		d.Gid = gid
+		d.Mtime = fimg.now()
+	})
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestUpdateObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-update-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctime := time.Unix(1000000000, 0)
+	mtime := time.Unix(1500000000, 0)
+
+	tests := []struct {
+		name    string
+		id      uint32
+		update  func(fimg *FileImage, id uint32) error
+		check   func(t *testing.T, d *Descriptor)
+		wantErr error
+	}{
+		{
+			name:    "NotFound",
+			id:      9,
+			update:  func(fimg *FileImage, id uint32) error { return fimg.SetObjectName(id, "name") },
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "NameTooLong",
+			id:   1,
+			update: func(fimg *FileImage, id uint32) error {
+				return fimg.SetObjectName(id, strings.Repeat("x", DescrNameLen+1))
+			},
+			wantErr: errNameTooLong,
+		},
+		{
+			name:   "Name",
+			id:     1,
+			update: func(fimg *FileImage, id uint32) error { return fimg.SetObjectName(id, "renamed") },
+			check: func(t *testing.T, d *Descriptor) {
+				if got, want := d.GetName(), "renamed"; got != want {
+					t.Errorf("got name %q, want %q", got, want)
+				}
+			},
+		},
+		{
+			name:   "Times",
+			id:     1,
+			update: func(fimg *FileImage, id uint32) error { return fimg.SetObjectTimes(id, ctime, mtime) },
+			check: func(t *testing.T, d *Descriptor) {
+				if got, want := d.Ctime, ctime.Unix(); got != want {
+					t.Errorf("got ctime %v, want %v", got, want)
+				}
+				if got, want := d.Mtime, mtime.Unix(); got != want {
+					t.Errorf("got mtime %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name:   "Owner",
+			id:     1,
+			update: func(fimg *FileImage, id uint32) error { return fimg.SetObjectOwner(id, 1234, 5678) },
+			check: func(t *testing.T, d *Descriptor) {
+				if d.UID != 1234 || d.Gid != 5678 {
+					t.Errorf("got owner %v:%v, want 1234:5678", d.UID, d.Gid)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Pathname:   filepath.Join(dir, tt.name+".sif"),
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				ID:         uuid.NewV4(),
+				InputDescr: []DescriptorInput{
+					{
+						Datatype: DataDeffile,
+						Groupid:  DescrDefaultGroup,
+						Link:     DescrUnusedLink,
+						Size:     4,
+						Fname:    "deffile",
+						Data:     []byte("data"),
+					},
+				},
+			}
+			if _, err := CreateContainer(cinfo); err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainer(cinfo.Pathname, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fimg.Header.Mtime = 0
+
+			err = tt.update(&fimg, tt.id)
+			if uerr := fimg.UnloadContainer(); uerr != nil {
+				t.Fatal(uerr)
+			}
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			// the update persists
+			fimg, err = LoadContainer(cinfo.Pathname, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			if fimg.Header.Mtime == 0 {
+				t.Error("header mtime not updated")
+			}
+
+			d, _, err := fimg.GetFromDescrID(tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, d)
+		})
+	}
+}
+
+func TestUpdateObjectReadOnly(t *testing.T) {
+	fimg, err := LoadContainer(filepath.Join("testdata", "testcontainer2.sif"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	if err := fimg.SetObjectName(1, "renamed"); err == nil {
+		t.Error("got no error renaming object of read-only image")
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import "errors"
+
+// On Linux, data objects may be read using io_uring, which keeps several reads in flight without a
+// system call per read. This improves the throughput of hashing and extracting data objects where
+// many images are processed in parallel, and reading is bound by system call overhead. A URing may
+// be shared between goroutines, but serializes their reads, so each goroutine should create its
+// own for throughput.
+
+// ErrURingUnsupported is the error returned by NewURing when io_uring is not supported by the
+// operating system or kernel, or is not permitted. Callers should fall back to GetReader.
+var ErrURingUnsupported = errors.New("io_uring not supported")
+
+var errURingNoFile = errors.New("io_uring requires an image backed by a single file")
+
+const (
+	// DefaultURingDepth is the number of reads kept in flight by a URing, if not specified.
+	DefaultURingDepth = 8
+
+	// DefaultURingBlockSize is the size of each read made by a URing, if not specified.
+	DefaultURingBlockSize = 1 << 20
+)
@@ -0,0 +1,375 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package sif
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// io_uring system call numbers, which are shared by all architectures other than MIPS.
+const (
+	sysIOURingSetup = 425
+	sysIOURingEnter = 426
+)
+
+const (
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringOpReadv        = 1
+	uringEnterGetEvents = 1
+)
+
+// uringSQOffsets is struct io_sqring_offsets.
+type uringSQOffsets struct {
+	Head, Tail, RingMask, RingEntries, Flags, Dropped, Array, Resv1 uint32
+	Resv2                                                           uint64
+}
+
+// uringCQOffsets is struct io_cqring_offsets.
+type uringCQOffsets struct {
+	Head, Tail, RingMask, RingEntries, Overflow, CQEs, Flags, Resv1 uint32
+	Resv2                                                           uint64
+}
+
+// uringParams is struct io_uring_params.
+type uringParams struct {
+	SQEntries, CQEntries, Flags, SQThreadCPU, SQThreadIdle, Features, WQFd uint32
+	Resv                                                                   [3]uint32
+	SQOff                                                                  uringSQOffsets
+	CQOff                                                                  uringCQOffsets
+}
+
+// uringSQE is struct io_uring_sqe.
+type uringSQE struct {
+	Opcode   uint8
+	Flags    uint8
+	IOPrio   uint16
+	Fd       int32
+	Off      uint64
+	Addr     uint64
+	Len      uint32
+	RWFlags  uint32
+	UserData uint64
+	Pad      [3]uint64
+}
+
+// uringCQE is struct io_uring_cqe.
+type uringCQE struct {
+	UserData uint64
+	Res      int32
+	Flags    uint32
+}
+
+// ioRing is an io_uring instance, with its submission and completion queues mapped.
+type ioRing struct {
+	fd int
+
+	sqRing, cqRing, sqeMem []byte
+
+	sqTail, sqMask *uint32
+	sqArray        []uint32
+	sqes           []uringSQE
+
+	cqHead, cqTail, cqMask *uint32
+	cqes                   []uringCQE
+
+	pending uint32 // entries pushed but not yet submitted
+}
+
+// newIORing sets up an io_uring instance with at least entries submission queue entries.
+func newIORing(entries uint32) (*ioRing, error) {
+	var p uringParams
+
+	fd, _, errno := syscall.Syscall(sysIOURingSetup, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	switch errno {
+	case 0:
+	case syscall.ENOSYS, syscall.EPERM, syscall.EACCES:
+		return nil, fmt.Errorf("%w: %v", ErrURingUnsupported, errno)
+	default:
+		return nil, fmt.Errorf("setting up io_uring: %s", errno)
+	}
+
+	r := &ioRing{fd: int(fd)}
+
+	mmap := func(off int64, size uint32) ([]byte, error) {
+		return syscall.Mmap(r.fd, off, int(size), syscall.PROT_READ|syscall.PROT_WRITE,
+			syscall.MAP_SHARED|syscall.MAP_POPULATE)
+	}
+
+	var err error
+	if r.sqRing, err = mmap(uringOffSQRing, p.SQOff.Array+p.SQEntries*4); err != nil {
+		r.close() // nolint:errcheck
+		return nil, fmt.Errorf("mapping io_uring submission queue: %s", err)
+	}
+	if r.cqRing, err = mmap(uringOffCQRing, p.CQOff.CQEs+p.CQEntries*uint32(unsafe.Sizeof(uringCQE{}))); err != nil {
+		r.close() // nolint:errcheck
+		return nil, fmt.Errorf("mapping io_uring completion queue: %s", err)
+	}
+	if r.sqeMem, err = mmap(uringOffSQEs, p.SQEntries*uint32(unsafe.Sizeof(uringSQE{}))); err != nil {
+		r.close() // nolint:errcheck
+		return nil, fmt.Errorf("mapping io_uring submission queue entries: %s", err)
+	}
+
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[p.SQOff.Tail]))
+	r.sqMask = (*uint32)(unsafe.Pointer(&r.sqRing[p.SQOff.RingMask]))
+	r.sqArray = (*[1 << 16]uint32)(unsafe.Pointer(&r.sqRing[p.SQOff.Array]))[:p.SQEntries:p.SQEntries]
+	r.sqes = (*[1 << 16]uringSQE)(unsafe.Pointer(&r.sqeMem[0]))[:p.SQEntries:p.SQEntries]
+
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[p.CQOff.Head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[p.CQOff.Tail]))
+	r.cqMask = (*uint32)(unsafe.Pointer(&r.cqRing[p.CQOff.RingMask]))
+	r.cqes = (*[1 << 17]uringCQE)(unsafe.Pointer(&r.cqRing[p.CQOff.CQEs]))[:p.CQEntries:p.CQEntries]
+
+	return r, nil
+}
+
+// push adds sqe to the submission queue. The caller must not have more entries in flight than the
+// submission queue holds.
+func (r *ioRing) push(sqe uringSQE) {
+	tail := atomic.LoadUint32(r.sqTail)
+	idx := tail & *r.sqMask
+	r.sqes[idx] = sqe
+	r.sqArray[idx] = idx
+	atomic.StoreUint32(r.sqTail, tail+1)
+	r.pending++
+}
+
+// wait submits any pending entries, and returns the next completion, blocking until one is
+// available.
+func (r *ioRing) wait() (uringCQE, error) {
+	for {
+		if head := atomic.LoadUint32(r.cqHead); head != atomic.LoadUint32(r.cqTail) {
+			cqe := r.cqes[head&*r.cqMask]
+			atomic.StoreUint32(r.cqHead, head+1)
+			return cqe, nil
+		}
+
+		n, _, errno := syscall.Syscall6(sysIOURingEnter, uintptr(r.fd), uintptr(r.pending), 1,
+			uringEnterGetEvents, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return uringCQE{}, fmt.Errorf("entering io_uring: %s", errno)
+		}
+		r.pending -= uint32(n)
+	}
+}
+
+// close unmaps the queues of r, and closes it.
+func (r *ioRing) close() error {
+	for _, b := range [][]byte{r.sqeMem, r.cqRing, r.sqRing} {
+		if b != nil {
+			syscall.Munmap(b) // nolint:errcheck
+		}
+	}
+	return syscall.Close(r.fd)
+}
+
+// URing reads data objects of an image using io_uring. Calls to ReadAt and CopyObject may be made
+// from multiple goroutines, but are serialized on the ring.
+type URing struct {
+	mu   sync.Mutex // guards the ring, buffers and iovecs during each call
+	fimg *FileImage
+	f    *os.File
+	r    *ioRing
+	bufs [][]byte
+	iovs []syscall.Iovec
+
+	inflight int // reads submitted but not completed
+}
+
+// NewURing returns a URing that reads data objects of fimg using io_uring, keeping up to depth
+// reads of blockSize bytes in flight. If depth or blockSize is zero, DefaultURingDepth or
+// DefaultURingBlockSize is used. The image must be backed by a single file. If io_uring is not
+// supported by the kernel, or is not permitted, an error wrapping ErrURingUnsupported is
+// returned.
+func NewURing(fimg *FileImage, depth, blockSize int) (*URing, error) {
+	f, ok := fimg.Fp.(*os.File)
+	if !ok {
+		return nil, errURingNoFile
+	}
+
+	if depth <= 0 {
+		depth = DefaultURingDepth
+	}
+	if blockSize <= 0 {
+		blockSize = DefaultURingBlockSize
+	}
+
+	r, err := newIORing(uint32(depth))
+	if err != nil {
+		return nil, err
+	}
+
+	u := &URing{
+		fimg: fimg,
+		f:    f,
+		r:    r,
+		bufs: make([][]byte, depth),
+		iovs: make([]syscall.Iovec, depth),
+	}
+	for i := range u.bufs {
+		u.bufs[i] = make([]byte, blockSize)
+	}
+	return u, nil
+}
+
+// submit queues a read into b at offset off of the image, using the iovec of slot.
+func (u *URing) submit(slot int, b []byte, off int64) {
+	iov := &u.iovs[slot]
+	iov.Base = &b[0]
+	iov.SetLen(len(b))
+
+	u.r.push(uringSQE{
+		Opcode:   uringOpReadv,
+		Fd:       int32(u.f.Fd()),
+		Off:      uint64(off),
+		Addr:     uint64(uintptr(unsafe.Pointer(iov))),
+		Len:      1,
+		UserData: uint64(slot),
+	})
+	u.inflight++
+}
+
+// wait returns the next completion.
+func (u *URing) wait() (uringCQE, error) {
+	cqe, err := u.r.wait()
+	if err == nil {
+		u.inflight--
+	}
+	return cqe, err
+}
+
+// drain waits for all reads in flight to complete, so that their buffers may be reused.
+func (u *URing) drain() {
+	for u.inflight > 0 {
+		if _, err := u.wait(); err != nil {
+			return
+		}
+	}
+}
+
+// ReadAt reads len(p) bytes from the image at offset off, as described by io.ReaderAt.
+func (u *URing) ReadAt(p []byte, off int64) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var n int
+	for n < len(p) {
+		u.submit(0, p[n:], off+int64(n))
+
+		cqe, err := u.wait()
+		if err != nil {
+			return n, err
+		}
+		if cqe.Res < 0 {
+			return n, fmt.Errorf("reading SIF file: %s", syscall.Errno(-cqe.Res))
+		}
+		if cqe.Res == 0 {
+			return n, io.EOF
+		}
+		n += int(cqe.Res)
+	}
+	return n, nil
+}
+
+// CopyObject writes the data object associated with descriptor d to w, such as a hash or an
+// extracted file, and returns the number of bytes written. Reads of the object are kept in flight
+// while data is written to w. The data of a thin image is not held in the file, so an error
+// wrapping ErrThin is returned.
+func (u *URing) CopyObject(w io.Writer, d *Descriptor) (written int64, err error) {
+	if d.isThin(u.fimg) {
+		return 0, fmt.Errorf("reading data object: %w", ErrThin)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	defer u.drain()
+
+	depth := int64(len(u.bufs))
+	bs := int64(len(u.bufs[0]))
+	blocks := (d.Filelen + bs - 1) / bs
+
+	// block returns the buffer of the specified block.
+	block := func(i int64) []byte {
+		n := d.Filelen - i*bs
+		if n > bs {
+			n = bs
+		}
+		return u.bufs[i%depth][:n]
+	}
+
+	var issued int64
+	for ; issued < blocks && issued < depth; issued++ {
+		u.submit(int(issued), block(issued), d.Fileoff+issued*bs)
+	}
+
+	done := make([]bool, depth)
+	res := make([]int32, depth)
+
+	for next := int64(0); next < blocks; next++ {
+		slot := next % depth
+
+		for !done[slot] {
+			cqe, err := u.wait()
+			if err != nil {
+				return written, err
+			}
+			done[cqe.UserData], res[cqe.UserData] = true, cqe.Res
+		}
+		done[slot] = false
+
+		if res[slot] < 0 {
+			return written, fmt.Errorf("reading data object: %s", syscall.Errno(-res[slot]))
+		}
+
+		// Complete a short read synchronously.
+		b := block(next)
+		if n := int(res[slot]); n < len(b) {
+			if _, err := u.f.ReadAt(b[n:], d.Fileoff+next*bs+int64(n)); err != nil {
+				return written, fmt.Errorf("reading data object: %s", err)
+			}
+		}
+
+		n, err := w.Write(b)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+
+		if issued < blocks {
+			u.submit(int(slot), block(issued), d.Fileoff+issued*bs)
+			issued++
+		}
+	}
+
+	return written, nil
+}
+
+// Close releases the resources held by u. The image is not closed.
+func (u *URing) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.drain()
+	if err := u.r.close(); err != nil {
+		return fmt.Errorf("closing io_uring: %s", err)
+	}
+	return nil
+}
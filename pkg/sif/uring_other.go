@@ -0,0 +1,34 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build !linux || mips || mipsle || mips64 || mips64le
+// +build !linux mips mipsle mips64 mips64le
+
+package sif
+
+import "io"
+
+// URing reads data objects using io_uring, which is not supported on this platform.
+type URing struct{}
+
+// NewURing returns ErrURingUnsupported, as io_uring is not supported on this platform.
+func NewURing(fimg *FileImage, depth, blockSize int) (*URing, error) {
+	return nil, ErrURingUnsupported
+}
+
+// ReadAt returns ErrURingUnsupported.
+func (u *URing) ReadAt(p []byte, off int64) (int, error) {
+	return 0, ErrURingUnsupported
+}
+
+// CopyObject returns ErrURingUnsupported.
+func (u *URing) CopyObject(w io.Writer, d *Descriptor) (int64, error) {
+	return 0, ErrURingUnsupported
+}
+
+// Close does nothing.
+func (u *URing) Close() error {
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestURing(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	u, err := NewURing(&fimg, 2, 64)
+	if errors.Is(err, ErrURingUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close() // nolint:errcheck
+
+	for _, d := range fimg.GetDescriptors() {
+		d := d
+		t.Run(d.GetName(), func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := u.CopyObject(&buf, &d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := n, d.Filelen; got != want {
+				t.Errorf("got %v bytes written, want %v", got, want)
+			}
+			if got, want := buf.Bytes(), d.GetData(&fimg); !bytes.Equal(got, want) {
+				t.Errorf("got data mismatch")
+			}
+
+			b := make([]byte, d.Filelen)
+			if _, err := u.ReadAt(b, d.Fileoff); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := b, d.GetData(&fimg); !bytes.Equal(got, want) {
+				t.Errorf("got ReadAt data mismatch")
+			}
+		})
+	}
+}
+
+func TestURingReadAtParallel(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fimg.UnloadContainer() // nolint:errcheck
+
+	u, err := NewURing(&fimg, 2, 64)
+	if errors.Is(err, ErrURingUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close() // nolint:errcheck
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		for _, d := range fimg.GetDescriptors() {
+			wg.Add(1)
+			go func(d Descriptor) {
+				defer wg.Done()
+
+				b := make([]byte, d.Filelen)
+				if _, err := u.ReadAt(b, d.Fileoff); err != nil {
+					t.Error(err)
+					return
+				}
+				if got, want := b, d.GetData(&fimg); !bytes.Equal(got, want) {
+					t.Errorf("got ReadAt data mismatch for %v", d.GetName())
+				}
+			}(d)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Loading an image checks little more than its global header, so that images with minor defects
+// may still be inspected and repaired. Programs that accept images from untrusted sources should
+// call Validate before relying on the offsets and references recorded in the image.
+
+var (
+	errHeaderInvalid    = errors.New("global header invalid")
+	errSectionBounds    = errors.New("section out of bounds")
+	errDescrCount       = errors.New("descriptor count inconsistent")
+	errDescrIDInvalid   = errors.New("descriptor ID invalid")
+	errDescrIDDuplicate = errors.New("descriptor ID duplicated")
+	errArchMismatch     = errors.New("header arch does not match primary partition")
+)
+
+// Problem describes a problem found by Validate.
+type Problem struct {
+	ID  uint32 // ID of the data object concerned, or zero if the problem concerns the image
+	Err error  // description of the problem
+}
+
+// Error returns a description of p.
+func (p Problem) Error() string {
+	if p.ID == 0 {
+		return p.Err.Error()
+	}
+	return fmt.Sprintf("object %d: %v", p.ID, p.Err)
+}
+
+// Unwrap returns the error describing p.
+func (p Problem) Unwrap() error {
+	return p.Err
+}
+
+// ValidationReport describes the problems found by Validate.
+type ValidationReport struct {
+	Problems []Problem // problems found, in the order checked
+}
+
+// OK returns true if no problems were found.
+func (r *ValidationReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Err returns nil if no problems were found. Otherwise, an error wrapping the first problem found
+// is returned.
+func (r *ValidationReport) Err() error {
+	switch len(r.Problems) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("image invalid: %w", r.Problems[0])
+	default:
+		return fmt.Errorf("image invalid: %w (and %d more problems)", r.Problems[0], len(r.Problems)-1)
+	}
+}
+
+// add records a problem with the data object with the specified id.
+func (r *ValidationReport) add(id uint32, err error) {
+	r.Problems = append(r.Problems, Problem{ID: id, Err: err})
+}
+
+// Validate checks the structure of fimg, and returns a report of the problems found. The magic
+// and version of the global header are checked, along with the bounds of the descriptor table and
+// data section. Each data object must lie within the data section, no two data objects may
+// overlap, and each link must reference an existing object or group, without forming a cycle.
+// Unless the header arch of the image is set explicitly, it must match that of the primary system
+// partition. A descriptor table checksum mismatch ignored by OptLoadIgnoreDescrChecksum is
+// reported.
+//
+// Validate does not read the data objects of the image.
+func Validate(fimg *FileImage) *ValidationReport {
+	r := &ValidationReport{}
+
+	if err := isValidHeader(&fimg.Header); err != nil {
+		r.add(0, fmt.Errorf("%w: %v", errHeaderInvalid, err))
+
+		// the remaining fields of the header cannot be interpreted
+		return r
+	}
+
+	if fimg.descrCRCErr != nil {
+		r.add(0, fimg.descrCRCErr)
+	}
+
+	validateSections(fimg, r)
+	validateDescriptors(fimg, r)
+	if err := fimg.CheckLinkCycles(); err != nil {
+		r.add(0, err)
+	}
+	validateArch(fimg, r)
+
+	return r
+}
+
+// imageSize returns the size of fimg, or -1 if it is not known.
+func (fimg *FileImage) imageSize() int64 {
+	if fimg.Fp != nil {
+		return fimg.Filesize
+	}
+	if fimg.Reader != nil {
+		return fimg.Reader.Size()
+	}
+	return -1
+}
+
+// validateSections checks the bounds of the descriptor table and data section of fimg, and the
+// descriptor counts recorded in the global header.
+func validateSections(fimg *FileImage, r *ValidationReport) {
+	h := fimg.Header
+
+	if h.Descroff < int64(binary.Size(Header{})) || h.Descrlen < 0 {
+		r.add(0, fmt.Errorf("%w: descriptor table at %d overlaps header", errSectionBounds, h.Descroff))
+	}
+	if h.Dataoff < h.Descroff+h.Descrlen || h.Datalen < 0 {
+		r.add(0, fmt.Errorf("%w: data section at %d overlaps descriptor table", errSectionBounds, h.Dataoff))
+	}
+
+	// an empty data section may start beyond the end of the image
+	if size := fimg.imageSize(); size >= 0 {
+		if end := h.Descroff + h.Descrlen; end > size {
+			r.add(0, fmt.Errorf("%w: descriptor table ends at %d, beyond end of image at %d",
+				errSectionBounds, end, size))
+		}
+		if end := h.Dataoff + h.Datalen; h.Datalen > 0 && end > size {
+			r.add(0, fmt.Errorf("%w: data section ends at %d, beyond end of image at %d",
+				errSectionBounds, end, size))
+		}
+	}
+
+	if got, want := h.Dtotal, int64(len(fimg.DescrArr)); got != want {
+		r.add(0, fmt.Errorf("%w: header records %d descriptors, table holds %d", errDescrCount, got, want))
+	}
+	if got, want := h.Descrlen, int64(binary.Size(fimg.DescrArr)); got != want {
+		r.add(0, fmt.Errorf("%w: header records %d bytes of descriptors, table holds %d", errDescrCount, got, want))
+	}
+
+	var free int64
+	for _, d := range fimg.DescrArr {
+		if !d.Used {
+			free++
+		}
+	}
+	if got, want := h.Dfree, free; got != want {
+		r.add(0, fmt.Errorf("%w: header records %d free descriptors, table holds %d", errDescrCount, got, want))
+	}
+}
+
+// validateDescriptors checks the IDs, bounds and links of the used descriptors of fimg.
+func validateDescriptors(fimg *FileImage, r *ValidationReport) {
+	var used []Descriptor
+	ids := make(map[uint32]bool)
+	groups := make(map[uint32]bool)
+	for _, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+
+		if d.ID == 0 {
+			r.add(0, errDescrIDInvalid)
+			continue
+		}
+		if ids[d.ID] {
+			r.add(d.ID, errDescrIDDuplicate)
+			continue
+		}
+
+		used = append(used, d)
+		ids[d.ID] = true
+		groups[d.Groupid&^DescrGroupMask] = true
+	}
+
+	start, end := fimg.Header.Dataoff, fimg.Header.Dataoff+fimg.Header.Datalen
+
+	var inBounds []Descriptor
+	for _, d := range used {
+		if d.Fileoff < start || d.Filelen < 0 || d.Fileoff > end-d.Filelen {
+			r.add(d.ID, fmt.Errorf("%w: %d bytes at %d, data section spans [%d, %d)",
+				errObjectBounds, d.Filelen, d.Fileoff, start, end))
+		} else if d.Filelen > 0 {
+			inBounds = append(inBounds, d)
+		}
+
+		if d.Link == DescrUnusedLink {
+			continue
+		}
+		if d.Link&DescrGroupMask != 0 {
+			if !groups[d.Link&^DescrGroupMask] {
+				r.add(d.ID, fmt.Errorf("%w: group %d", errLinkInvalid, d.Link&^DescrGroupMask))
+			}
+		} else if !ids[d.Link] {
+			r.add(d.ID, fmt.Errorf("%w: object %d", errLinkInvalid, d.Link))
+		}
+	}
+
+	// once ordered by offset, an object can only overlap those that follow it, and only while
+	// they start before it ends
+	sort.SliceStable(inBounds, func(i, j int) bool { return inBounds[i].Fileoff < inBounds[j].Fileoff })
+	for i, d := range inBounds {
+		for _, o := range inBounds[i+1:] {
+			if o.Fileoff >= d.Fileoff+d.Filelen {
+				break
+			}
+			r.add(d.ID, fmt.Errorf("%w: object %d", errObjectOverlap, o.ID))
+		}
+	}
+}
+
+// validateArch checks that the header arch of fimg matches that of its primary system partition,
+// unless it is set explicitly.
+func validateArch(fimg *FileImage, r *ValidationReport) {
+	if fimg.IsMultiArch() {
+		return
+	}
+
+	arch, err := fimg.primPartArch()
+	if err != nil {
+		r.add(0, err)
+		return
+	}
+
+	if fimg.IsArchExplicit() {
+		return
+	}
+	if got, want := fimg.Header.GetArch(), trimZeroBytes(arch[:]); got != want {
+		r.add(0, fmt.Errorf("%w: header arch %q, primary partition arch %q", errArchMismatch, got, want))
+	}
+}
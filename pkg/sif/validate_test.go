@@ -0,0 +1,140 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-validate-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := createTestImage(t, filepath.Join(dir, "image.sif"), testPartInput(t), testDeffileInput(1))
+
+	tests := []struct {
+		name     string
+		corrupt  func(fimg *FileImage)
+		wantErrs []error
+		wantIDs  []uint32
+	}{
+		{
+			name:    "OK",
+			corrupt: func(fimg *FileImage) {},
+		},
+		{
+			name:     "Magic",
+			corrupt:  func(fimg *FileImage) { copy(fimg.Header.Magic[:], "NOT_MAGIC") },
+			wantErrs: []error{errHeaderInvalid},
+			wantIDs:  []uint32{0},
+		},
+		{
+			name:     "DescriptorTableBounds",
+			corrupt:  func(fimg *FileImage) { fimg.Header.Descroff = 8 },
+			wantErrs: []error{errSectionBounds},
+			wantIDs:  []uint32{0},
+		},
+		{
+			name:     "DataSectionBounds",
+			corrupt:  func(fimg *FileImage) { fimg.Header.Datalen += fimg.Filesize },
+			wantErrs: []error{errSectionBounds},
+			wantIDs:  []uint32{0},
+		},
+		{
+			name:     "Dfree",
+			corrupt:  func(fimg *FileImage) { fimg.Header.Dfree++ },
+			wantErrs: []error{errDescrCount},
+			wantIDs:  []uint32{0},
+		},
+		{
+			name:     "DuplicateID",
+			corrupt:  func(fimg *FileImage) { fimg.DescrArr[1].ID = 1 },
+			wantErrs: []error{errDescrIDDuplicate},
+			wantIDs:  []uint32{1},
+		},
+		{
+			name: "ObjectBounds",
+			corrupt: func(fimg *FileImage) {
+				fimg.DescrArr[1].Fileoff = fimg.Header.Dataoff + fimg.Header.Datalen
+			},
+			wantErrs: []error{errObjectBounds},
+			wantIDs:  []uint32{2},
+		},
+		{
+			name:     "Overlap",
+			corrupt:  func(fimg *FileImage) { fimg.DescrArr[1].Fileoff = fimg.DescrArr[0].Fileoff + 4 },
+			wantErrs: []error{errObjectOverlap},
+			wantIDs:  []uint32{1},
+		},
+		{
+			name:     "Link",
+			corrupt:  func(fimg *FileImage) { fimg.DescrArr[1].Link = 7 },
+			wantErrs: []error{errLinkInvalid},
+			wantIDs:  []uint32{2},
+		},
+		{
+			name:     "Arch",
+			corrupt:  func(fimg *FileImage) { copy(fimg.Header.Arch[:], HdrArchARM64) },
+			wantErrs: []error{errArchMismatch},
+			wantIDs:  []uint32{0},
+		},
+		{
+			name: "Multiple",
+			corrupt: func(fimg *FileImage) {
+				fimg.DescrArr[1].Link = 7
+				copy(fimg.Header.Arch[:], HdrArchARM64)
+			},
+			wantErrs: []error{errLinkInvalid, errArchMismatch},
+			wantIDs:  []uint32{2, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fimg, err := LoadContainer(path, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			tt.corrupt(&fimg)
+
+			r := Validate(&fimg)
+
+			if got, want := r.OK(), len(tt.wantErrs) == 0; got != want {
+				t.Errorf("got OK %v, want %v", got, want)
+			}
+			if got, want := len(r.Problems), len(tt.wantErrs); got != want {
+				t.Fatalf("got %v problems (%v), want %v", got, r.Err(), want)
+			}
+
+			for i, p := range r.Problems {
+				if got, want := p, tt.wantErrs[i]; !errors.Is(got, want) {
+					t.Errorf("problem %v: got error %v, want %v", i, got, want)
+				}
+				if got, want := p.ID, tt.wantIDs[i]; got != want {
+					t.Errorf("problem %v: got ID %v, want %v", i, got, want)
+				}
+			}
+
+			if len(tt.wantErrs) > 0 {
+				if got, want := r.Err(), tt.wantErrs[0]; !errors.Is(got, want) {
+					t.Errorf("got error %v, want %v", got, want)
+				}
+			} else if err := r.Err(); err != nil {
+				t.Errorf("got error %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Images need not be created in a file on disk. An image may be written to any io.WriteSeeker, or
+// streamed to an io.Writer, such as a pipe, a member of a tar archive, or an object store upload.
+// When streaming, the layout of the image is computed before any data is written, so that the
+// global header and descriptor table may be written first, and the size of each data object must
+// be known in advance.
+
+var (
+	errWriterOnly        = errors.New("image is being written, and cannot be read")
+	errStreamSeek        = errors.New("streamed image cannot seek backwards")
+	errStreamSizeUnknown = errors.New("streamed data object size must be specified")
+)
+
+// writerFile implements ReadWriter on top of an io.Writer, which may also implement io.Seeker.
+// Reads return errWriterOnly. If the io.Writer does not implement io.Seeker, only forward seeks
+// are supported, and are implemented by writing zeros.
+type writerFile struct {
+	w   io.Writer
+	off int64
+}
+
+// Read returns errWriterOnly.
+func (wf *writerFile) Read(b []byte) (int, error) {
+	return 0, errWriterOnly
+}
+
+// ReadAt returns errWriterOnly.
+func (wf *writerFile) ReadAt(b []byte, off int64) (int, error) {
+	return 0, errWriterOnly
+}
+
+// Write writes b at the current offset.
+func (wf *writerFile) Write(b []byte) (int, error) {
+	n, err := wf.w.Write(b)
+	wf.off += int64(n)
+	return n, err
+}
+
+// Seek sets the offset for the next Write.
+func (wf *writerFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := wf.w.(io.Seeker); ok {
+		off, err := s.Seek(offset, whence)
+		if err == nil {
+			wf.off = off
+		}
+		return off, err
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += wf.off
+	default:
+		return wf.off, errStreamSeek
+	}
+
+	if offset < wf.off {
+		return wf.off, fmt.Errorf("%w: from %d to %d", errStreamSeek, wf.off, offset)
+	}
+	if _, err := io.Copy(wf, io.LimitReader(zeroReader{}, offset-wf.off)); err != nil {
+		return wf.off, err
+	}
+	return wf.off, nil
+}
+
+// Name returns an empty name, as there is no file underlying the image.
+func (wf *writerFile) Name() string {
+	return ""
+}
+
+// Fd returns an invalid file descriptor, as there is no file underlying the image.
+func (wf *writerFile) Fd() uintptr {
+	return ^uintptr(0)
+}
+
+// Stat returns errWriterOnly.
+func (wf *writerFile) Stat() (os.FileInfo, error) {
+	return nil, errWriterOnly
+}
+
+// Sync does nothing. The io.Writer is owned by the caller.
+func (wf *writerFile) Sync() error {
+	return nil
+}
+
+// Truncate returns errWriterOnly.
+func (wf *writerFile) Truncate(size int64) error {
+	return errWriterOnly
+}
+
+// Close does nothing. The io.Writer is owned by the caller.
+func (wf *writerFile) Close() error {
+	return nil
+}
+
+// CreateContainerWriter creates a new SIF image as specified by cinfo, and writes it to w. The
+// Pathname and StripeSize fields of cinfo are ignored.
+//
+// If w implements io.Seeker, the image is written as by CreateContainer, with the data objects
+// written before the descriptor table and global header, and offsets are relative to the start of
+// w. Otherwise, the image is streamed to w from start to end, and the Size of each DescriptorInput
+// that is read from Fp must be specified, while data objects cannot be compressed or checksummed.
+func CreateContainerWriter(w io.Writer, cinfo CreateInfo) error {
+	fimg, err := newFileImage(cinfo)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := w.(io.Seeker); ok {
+		fimg.Fp = &writerFile{w: w}
+		return writeContainer(fimg, cinfo.InputDescr)
+	}
+
+	// The header is written first, so the image ID cannot be derived from the content.
+	if cinfo.Reproducible && uuid.Equal(cinfo.ID, uuid.Nil) {
+		return errReproducibleStreamID
+	}
+
+	for i, input := range cinfo.InputDescr {
+		if input.Data == nil && input.Size == 0 {
+			return fmt.Errorf("data object %d: %w", i+1, errStreamSizeUnknown)
+		}
+		if input.Compression != CompressionNone {
+			return fmt.Errorf("data object %d: %w", i+1, errStreamCompressed)
+		}
+		if input.Checksum != 0 {
+			return fmt.Errorf("data object %d: %w", i+1, errStreamChecksum)
+		}
+	}
+
+	// Lay out the descriptors without writing any data.
+	fimg.Fp = &writerFile{w: ioutil.Discard}
+
+	order := placementOrder(cinfo.InputDescr)
+	if _, err := fimg.Fp.Seek(fimg.Header.Dataoff, io.SeekStart); err != nil {
+		return err
+	}
+	for _, i := range order {
+		if err := fillDescriptor(fimg, i, cinfo.InputDescr[i]); err != nil {
+			return err
+		}
+		if _, err := fimg.Fp.Seek(cinfo.InputDescr[i].Size, io.SeekCurrent); err != nil {
+			return err
+		}
+		fimg.Header.Dfree--
+
+		var err error
+		if fimg.Header.Datalen, err = addSize(fimg.Header.Datalen, fimg.DescrArr[i].Storelen); err != nil {
+			return fmt.Errorf("data section: %w", err)
+		}
+	}
+	fimg.Header.Descrlen = int64(binary.Size(fimg.DescrArr))
+
+	// Stream the image from start to end.
+	fimg.Fp = &writerFile{w: w}
+
+	if err := writeHeader(fimg); err != nil {
+		return err
+	}
+	if err := writeDescriptors(fimg); err != nil {
+		return err
+	}
+
+	for _, i := range order {
+		if _, err := fimg.Fp.Seek(fimg.DescrArr[i].Fileoff, io.SeekStart); err != nil {
+			return fmt.Errorf("setting file offset pointer to data object: %s", err)
+		}
+		if err := writeDataObject(fimg, i, cinfo.InputDescr[i]); err != nil {
+			return fmt.Errorf("writing data object for SIF file: %s", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestCreateContainerWriter(t *testing.T) {
+	inputs := func() []DescriptorInput {
+		part := DescriptorInput{
+			Datatype:  DataPartition,
+			Groupid:   DescrDefaultGroup,
+			Link:      DescrUnusedLink,
+			Size:      10,
+			Fname:     "rootfs",
+			Fp:        strings.NewReader("0123456789"),
+			Placement: PlacementCold,
+		}
+		if err := part.SetPartExtra(FsRaw, PartPrimSys, HdrArchAMD64); err != nil {
+			t.Fatal(err)
+		}
+
+		return []DescriptorInput{
+			{
+				Datatype:  DataDeffile,
+				Groupid:   DescrDefaultGroup,
+				Link:      DescrUnusedLink,
+				Size:      8,
+				Fname:     "deffile",
+				Data:      []byte("deffile!"),
+				Alignment: 16,
+			},
+			part,
+			{
+				Datatype: DataGenericJSON,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Size:     2,
+				Fname:    "meta.json",
+				Data:     []byte("{}"),
+			},
+		}
+	}
+
+	cinfo := func() CreateInfo {
+		return CreateInfo{
+			Launchstr:  HdrLaunch,
+			Sifversion: HdrVersion,
+			ID:         uuid.NewV4(),
+			InputDescr: inputs(),
+		}
+	}
+
+	tf, err := ioutil.TempFile("", "sif-writer-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+
+	var buf bytes.Buffer
+
+	tests := []struct {
+		name    string
+		w       io.Writer
+		content func() ([]byte, error)
+	}{
+		{"WriteSeeker", tf, func() ([]byte, error) { return ioutil.ReadFile(tf.Name()) }},
+		{"Writer", &buf, func() ([]byte, error) { return buf.Bytes(), nil }},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CreateContainerWriter(tt.w, cinfo()); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := tt.content()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fimg, err := LoadContainerReaderAt(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fimg.UnloadContainer() // nolint:errcheck
+
+			want := map[string]string{
+				"deffile":   "deffile!",
+				"rootfs":    "0123456789",
+				"meta.json": "{}",
+			}
+
+			ds := fimg.GetDescriptors()
+			if got, want := len(ds), len(want); got != want {
+				t.Fatalf("got %v objects, want %v", got, want)
+			}
+			for _, d := range ds {
+				if got, want := string(d.GetData(&fimg)), want[d.GetName()]; got != want {
+					t.Errorf("%v: got data %q, want %q", d.GetName(), got, want)
+				}
+			}
+
+			if got, want := fimg.PrimPartID, uint32(2); got != want {
+				t.Errorf("got primary partition %v, want %v", got, want)
+			}
+			if ds[0].Fileoff%16 != 0 {
+				t.Errorf("got offset %v, want alignment 16", ds[0].Fileoff)
+			}
+			if ds[1].Fileoff < ds[2].Fileoff {
+				t.Errorf("got cold object at %v before object at %v", ds[1].Fileoff, ds[2].Fileoff)
+			}
+		})
+	}
+}
+
+func TestCreateContainerWriterSizeUnknown(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []DescriptorInput{
+			{
+				Datatype: DataGeneric,
+				Groupid:  DescrDefaultGroup,
+				Link:     DescrUnusedLink,
+				Fp:       strings.NewReader("unknown size"),
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if got, want := CreateContainerWriter(&buf, cinfo), errStreamSizeUnknown; !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got %v bytes written, want none", buf.Len())
+	}
+}
+
+func TestCreateContainerWriterReproducible(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:    HdrLaunch,
+		Sifversion:   HdrVersion,
+		Reproducible: true,
+	}
+
+	var buf bytes.Buffer
+	if got, want := CreateContainerWriter(&buf, cinfo), errReproducibleStreamID; !errors.Is(got, want) {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+
+	cinfo.ID = uuid.NewV4()
+	if err := CreateContainerWriter(&buf, cinfo); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+// Package sifserver implements an HTTP service exposing the SIF images in a directory, so that
+// platforms may inspect, retrieve and verify images without handling the SIF format themselves.
+//
+// The service responds to the following requests, with JSON bodies described by the types of
+// this package:
+//
+//	GET /v1/images                       list images (ImageList)
+//	GET /v1/images/{name}                inspect image (Image)
+//	GET /v1/images/{name}/objects/{id}   retrieve data object content
+//	GET /v1/images/{name}/verify         verify image signatures (Verification)
+//
+// Images are files in the directory with the extension ".sif". Data object content is served as
+// "application/octet-stream", and range requests are supported. Failed requests are answered
+// with an Error.
+//
+// To serve the images in a directory, verifying signatures against a keyring:
+//
+//	s, err := sifserver.NewServer(dir, sifserver.OptServerKeyRing(kr))
+//	...
+//	err = http.ListenAndServe(":8080", s)
+package sifserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sylabs/sif/pkg/integrity"
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+const (
+	apiPrefix = "/v1/images"
+	imageExt  = ".sif"
+)
+
+var (
+	errImageNotFound   = errors.New("image not found")
+	errObjectIDInvalid = errors.New("object ID invalid")
+	errNoKeyRing       = errors.New("verification not configured")
+)
+
+// Server serves the SIF images in a directory over HTTP. It is safe for concurrent use.
+type Server struct {
+	dir string          // Directory containing images.
+	kr  openpgp.KeyRing // Keyring to use for verification.
+}
+
+// ServerOpt are used to configure s.
+type ServerOpt func(s *Server) error
+
+// OptServerKeyRing sets the keyring used to verify images to kr. If no keyring is set, requests
+// to verify images are refused.
+func OptServerKeyRing(kr openpgp.KeyRing) ServerOpt {
+	return func(s *Server) error {
+		s.kr = kr
+		return nil
+	}
+}
+
+// NewServer returns a Server that serves the SIF images in dir, configured with opts.
+func NewServer(dir string, opts ...ServerOpt) (*Server, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("sifserver: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("sifserver: %s is not a directory", dir)
+	}
+
+	s := Server{dir: dir}
+
+	for _, opt := range opts {
+		if err := opt(&s); err != nil {
+			return nil, fmt.Errorf("sifserver: %w", err)
+		}
+	}
+
+	return &s, nil
+}
+
+// ServeHTTP responds to the request r.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+
+	if r.URL.Path == apiPrefix || r.URL.Path == apiPrefix+"/" {
+		s.serveList(w)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, apiPrefix+"/")
+	if rest == r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.Split(rest, "/")
+	switch {
+	case len(parts) == 1:
+		s.serveImage(w, parts[0])
+	case len(parts) == 3 && parts[1] == "objects":
+		s.serveObject(w, r, parts[0], parts[2])
+	case len(parts) == 2 && parts[1] == "verify":
+		s.serveVerify(w, parts[0])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// imagePath returns the path of the image with the specified name. Names that do not refer to an
+// image directly within the directory served by s are rejected.
+func (s *Server) imagePath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") ||
+		filepath.Ext(name) != imageExt {
+		return "", fmt.Errorf("%w: %q", errImageNotFound, name)
+	}
+
+	path := filepath.Join(s.dir, name)
+	if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("%w: %q", errImageNotFound, name)
+	}
+	return path, nil
+}
+
+// loadImage loads the image with the specified name read-only.
+func (s *Server) loadImage(name string) (sif.FileImage, error) {
+	path, err := s.imagePath(name)
+	if err != nil {
+		return sif.FileImage{}, err
+	}
+	return sif.LoadContainer(path, true)
+}
+
+// serveList responds with the list of images.
+func (s *Server) serveList(w http.ResponseWriter) {
+	fis, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	l := ImageList{Images: []ImageEntry{}}
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") ||
+			filepath.Ext(fi.Name()) != imageExt {
+			continue
+		}
+		l.Images = append(l.Images, ImageEntry{Name: fi.Name(), Size: fi.Size()})
+	}
+	sort.Slice(l.Images, func(i, j int) bool { return l.Images[i].Name < l.Images[j].Name })
+
+	writeJSON(w, http.StatusOK, l)
+}
+
+// serveImage responds with a description of the image with the specified name.
+func (s *Server) serveImage(w http.ResponseWriter, name string) {
+	f, err := s.loadImage(name)
+	if err != nil {
+		writeLoadError(w, err)
+		return
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	writeJSON(w, http.StatusOK, getImage(name, &f))
+}
+
+// serveObject responds with the content of data object id of the image with the specified name.
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, name, id string) {
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil || n == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %q", errObjectIDInvalid, id))
+		return
+	}
+
+	f, err := s.loadImage(name)
+	if err != nil {
+		writeLoadError(w, err)
+		return
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	if f.IsThin() {
+		writeError(w, http.StatusConflict, sif.ErrThin)
+		return
+	}
+
+	d, _, err := f.GetFromDescrID(uint32(n))
+	if errors.Is(err, sif.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, d.GetName(), time.Unix(d.Mtime, 0), d.GetReadSeeker(&f))
+}
+
+// serveVerify responds with the result of verifying the image with the specified name.
+func (s *Server) serveVerify(w http.ResponseWriter, name string) {
+	if s.kr == nil {
+		writeError(w, http.StatusNotImplemented, errNoKeyRing)
+		return
+	}
+
+	f, err := s.loadImage(name)
+	if err != nil {
+		writeLoadError(w, err)
+		return
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	writeJSON(w, http.StatusOK, verifyImage(&f, s.kr))
+}
+
+// getImage returns a description of image f, named name.
+func getImage(name string, f *sif.FileImage) Image {
+	im := Image{
+		Name: name,
+		Header: Header{
+			ID:      f.Header.ID.String(),
+			Version: f.Header.GetVersion(),
+			Arch:    sif.GetGoArch(f.Header.GetArch()),
+			Ctime:   f.Header.Ctime,
+			Mtime:   f.Header.Mtime,
+			Dfree:   f.Header.Dfree,
+			Dtotal:  f.Header.Dtotal,
+			Sealed:  f.IsSealed(),
+			Thin:    f.IsThin(),
+		},
+		Objects: []Object{},
+	}
+
+	for _, d := range f.DescrArr {
+		if !d.Used {
+			continue
+		}
+		im.Objects = append(im.Objects, getObject(d))
+	}
+	return im
+}
+
+// getObject returns a description of the data object described by d.
+func getObject(d sif.Descriptor) Object {
+	o := Object{
+		ID:       d.ID,
+		Name:     d.GetName(),
+		Datatype: d.Datatype.String(),
+		Offset:   d.Fileoff,
+		Size:     d.Filelen,
+	}
+
+	if d.Groupid != sif.DescrUnusedGroup {
+		o.Group = d.Groupid &^ sif.DescrGroupMask
+	}
+
+	if d.Link != sif.DescrUnusedLink {
+		if d.Link&sif.DescrGroupMask == sif.DescrGroupMask {
+			o.Link = d.Link &^ sif.DescrGroupMask
+			o.LinkGroup = true
+		} else {
+			o.Link = d.Link
+		}
+	}
+
+	if d.Datatype == sif.DataPartition {
+		if fs, err := d.GetFsType(); err == nil {
+			o.Fstype = fs.String()
+		}
+		if pt, err := d.GetPartType(); err == nil {
+			o.Parttype = pt.String()
+		}
+		if a, err := d.GetArch(); err == nil {
+			o.Arch = sif.GetGoArch(strings.TrimRight(string(a[:]), "\x00"))
+		}
+	}
+	return o
+}
+
+// verifyImage verifies the signatures of image f using keyring kr.
+func verifyImage(f *sif.FileImage, kr openpgp.KeyRing) Verification {
+	v := Verification{Signatures: []Signature{}}
+
+	cb := func(r integrity.VerifyResult) bool {
+		sig := Signature{
+			ID:       r.Signature(),
+			Signed:   r.Signed(),
+			Verified: r.Verified(),
+		}
+		if sig.Verified == nil {
+			sig.Verified = []uint32{}
+		}
+		if e := r.Entity(); e != nil && e.PrimaryKey != nil {
+			sig.Fingerprint = fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+		}
+		if err := r.Error(); err != nil {
+			sig.Error = err.Error()
+		}
+		v.Signatures = append(v.Signatures, sig)
+		return false
+	}
+
+	iv, err := integrity.NewVerifier(f, integrity.OptVerifyWithKeyRing(kr), integrity.OptVerifyCallback(cb))
+	if err == nil {
+		err = iv.Verify()
+	}
+
+	if err != nil {
+		v.Error = err.Error()
+	} else {
+		v.Verified = true
+	}
+	return v
+}
+
+// writeLoadError responds with an error encountered loading an image.
+func writeLoadError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errImageNotFound) {
+		writeError(w, http.StatusNotFound, err)
+	} else {
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// writeError responds with err, and the HTTP status code.
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, Error{Error: err.Error()})
+}
+
+// writeJSON responds with v encoded as JSON, and the HTTP status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v) // nolint:errcheck
+}
@@ -0,0 +1,351 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sifserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/integrity"
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// createTestImage creates an image at path containing a single generic object holding data. If e
+// is not nil, the image is signed with e.
+func createTestImage(t *testing.T, path string, data []byte, e *openpgp.Entity) {
+	t.Helper()
+
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{{
+			Datatype: sif.DataGeneric,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     sif.DescrUnusedLink,
+			Size:     int64(len(data)),
+			Fname:    "generic",
+			Data:     data,
+		}},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	if e == nil {
+		return
+	}
+
+	f, err := sif.LoadContainer(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer() // nolint:errcheck
+
+	s, err := integrity.NewSigner(&f, integrity.OptSignWithEntity(e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *openpgp.Entity, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "sifserver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := openpgp.NewEntity("Unit Test", "", "unit@test.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createTestImage(t, filepath.Join(dir, "signed.sif"), []byte("signed data"), e)
+	createTestImage(t, filepath.Join(dir, "unsigned.sif"), []byte("unsigned data"), nil)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "dir.sif"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServer(dir, OptServerKeyRing(openpgp.EntityList{e}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s)
+	return ts, e, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// get performs a GET request for path against ts, and decodes the JSON response into v, if v is
+// not nil.
+func get(t *testing.T, ts *httptest.Server, path string, v interface{}) *http.Response {
+	t.Helper()
+
+	res, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res
+}
+
+func TestNewServer(t *testing.T) {
+	f, err := ioutil.TempFile("", "sifserver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	if _, err := NewServer(f.Name()); err == nil {
+		t.Error("unexpected success for file")
+	}
+
+	if _, err := NewServer(filepath.Join(f.Name(), "missing")); err == nil {
+		t.Error("unexpected success for missing directory")
+	}
+}
+
+func TestServer_List(t *testing.T) {
+	ts, _, cleanup := newTestServer(t)
+	defer cleanup()
+
+	var l ImageList
+	if res := get(t, ts, "/v1/images", &l); res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusOK)
+	}
+
+	var names []string
+	for _, im := range l.Images {
+		names = append(names, im.Name)
+		if im.Size == 0 {
+			t.Errorf("%s: got zero size", im.Name)
+		}
+	}
+	if got, want := names, []string{"signed.sif", "unsigned.sif"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got images %v, want %v", got, want)
+	}
+}
+
+func TestServer_Image(t *testing.T) {
+	ts, _, cleanup := newTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantTypes  []string
+	}{
+		{
+			name:       "Signed",
+			path:       "/v1/images/signed.sif",
+			wantStatus: http.StatusOK,
+			wantTypes:  []string{"Generic/Raw", "Signature"},
+		},
+		{
+			name:       "Unsigned",
+			path:       "/v1/images/unsigned.sif",
+			wantStatus: http.StatusOK,
+			wantTypes:  []string{"Generic/Raw"},
+		},
+		{name: "Missing", path: "/v1/images/missing.sif", wantStatus: http.StatusNotFound},
+		{name: "NotImage", path: "/v1/images/notes.txt", wantStatus: http.StatusNotFound},
+		{name: "Directory", path: "/v1/images/dir.sif", wantStatus: http.StatusNotFound},
+		{name: "Traversal", path: "/v1/images/..%2Fsigned.sif", wantStatus: http.StatusNotFound},
+		{name: "UnknownPath", path: "/v1/images/signed.sif/other", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Get(ts.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if got, want := res.StatusCode, tt.wantStatus; got != want {
+				t.Fatalf("got status %v, want %v", got, want)
+			}
+
+			if tt.wantStatus == http.StatusOK {
+				var im Image
+				if err := json.NewDecoder(res.Body).Decode(&im); err != nil {
+					t.Fatal(err)
+				}
+
+				var types []string
+				for _, o := range im.Objects {
+					types = append(types, o.Datatype)
+				}
+				if got, want := types, tt.wantTypes; !reflect.DeepEqual(got, want) {
+					t.Errorf("got types %v, want %v", got, want)
+				}
+				if got, want := im.Objects[0].Group, uint32(1); got != want {
+					t.Errorf("got group %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_Object(t *testing.T) {
+	ts, _, cleanup := newTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name       string
+		path       string
+		rng        string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "OK", path: "/v1/images/signed.sif/objects/1", wantStatus: http.StatusOK, wantBody: "signed data"},
+		{
+			name:       "Range",
+			path:       "/v1/images/signed.sif/objects/1",
+			rng:        "bytes=7-",
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "data",
+		},
+		{name: "ObjectMissing", path: "/v1/images/signed.sif/objects/9", wantStatus: http.StatusNotFound},
+		{name: "ObjectIDZero", path: "/v1/images/signed.sif/objects/0", wantStatus: http.StatusBadRequest},
+		{name: "ObjectIDInvalid", path: "/v1/images/signed.sif/objects/x", wantStatus: http.StatusBadRequest},
+		{name: "ImageMissing", path: "/v1/images/missing.sif/objects/1", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.rng != "" {
+				req.Header.Set("Range", tt.rng)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if got, want := res.StatusCode, tt.wantStatus; got != want {
+				t.Fatalf("got status %v, want %v", got, want)
+			}
+
+			if tt.wantBody != "" {
+				b, err := ioutil.ReadAll(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := string(b), tt.wantBody; got != want {
+					t.Errorf("got body %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_Verify(t *testing.T) {
+	ts, e, cleanup := newTestServer(t)
+	defer cleanup()
+
+	var v Verification
+	if res := get(t, ts, "/v1/images/signed.sif/verify", &v); res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusOK)
+	}
+	if !v.Verified || v.Error != "" {
+		t.Errorf("got verified %v (%v), want true", v.Verified, v.Error)
+	}
+	if got, want := len(v.Signatures), 1; got != want {
+		t.Fatalf("got %v signatures, want %v", got, want)
+	}
+	sig := v.Signatures[0]
+	if got, want := sig.Verified, []uint32{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got verified objects %v, want %v", got, want)
+	}
+	if got, want := sig.Fingerprint, fmt.Sprintf("%X", e.PrimaryKey.Fingerprint); got != want {
+		t.Errorf("got fingerprint %v, want %v", got, want)
+	}
+
+	v = Verification{}
+	if res := get(t, ts, "/v1/images/unsigned.sif/verify", &v); res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusOK)
+	}
+	if v.Verified || v.Error == "" {
+		t.Errorf("got verified %v (%v), want false", v.Verified, v.Error)
+	}
+}
+
+func TestServer_VerifyNoKeyRing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sifserver-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	createTestImage(t, filepath.Join(dir, "unsigned.sif"), []byte("unsigned data"), nil)
+
+	s, err := NewServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	var e Error
+	if res := get(t, ts, "/v1/images/unsigned.sif/verify", &e); res.StatusCode != http.StatusNotImplemented {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusNotImplemented)
+	}
+	if e.Error == "" {
+		t.Error("got empty error")
+	}
+}
+
+func TestServer_Method(t *testing.T) {
+	ts, _, cleanup := newTestServer(t)
+	defer cleanup()
+
+	res, err := http.Post(ts.URL+"/v1/images", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if got, want := res.StatusCode, http.StatusMethodNotAllowed; got != want {
+		t.Fatalf("got status %v, want %v", got, want)
+	}
+}
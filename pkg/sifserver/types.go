@@ -0,0 +1,76 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sifserver
+
+// The types below describe the JSON bodies of service responses, and may be used by clients to
+// decode them.
+
+// ImageList is the response to a request to list images.
+type ImageList struct {
+	Images []ImageEntry `json:"images"`
+}
+
+// ImageEntry describes an image in an ImageList.
+type ImageEntry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Image is the response to a request to inspect an image.
+type Image struct {
+	Name    string   `json:"name"`
+	Header  Header   `json:"header"`
+	Objects []Object `json:"objects"`
+}
+
+// Header describes the global header of an image.
+type Header struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+	Arch    string `json:"arch"`
+	Ctime   int64  `json:"ctime"`
+	Mtime   int64  `json:"mtime"`
+	Dfree   int64  `json:"dfree"`
+	Dtotal  int64  `json:"dtotal"`
+	Sealed  bool   `json:"sealed,omitempty"`
+	Thin    bool   `json:"thin,omitempty"`
+}
+
+// Object describes a data object of an image.
+type Object struct {
+	ID        uint32 `json:"id"`
+	Group     uint32 `json:"group,omitempty"`     // Group ID, or zero if none.
+	Link      uint32 `json:"link,omitempty"`      // Linked object or group ID, or zero if none.
+	LinkGroup bool   `json:"linkGroup,omitempty"` // If true, Link is a group ID.
+	Name      string `json:"name"`
+	Datatype  string `json:"datatype"`
+	Offset    int64  `json:"offset"`
+	Size      int64  `json:"size"`
+	Fstype    string `json:"fstype,omitempty"`
+	Parttype  string `json:"parttype,omitempty"`
+	Arch      string `json:"arch,omitempty"`
+}
+
+// Verification is the response to a request to verify an image.
+type Verification struct {
+	Verified   bool        `json:"verified"`
+	Error      string      `json:"error,omitempty"`
+	Signatures []Signature `json:"signatures"`
+}
+
+// Signature describes the result of verifying a signature.
+type Signature struct {
+	ID          uint32   `json:"id"`
+	Fingerprint string   `json:"fingerprint,omitempty"`
+	Signed      []uint32 `json:"signed"`
+	Verified    []uint32 `json:"verified"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// Error is the response to a request that failed.
+type Error struct {
+	Error string `json:"error"`
+}
@@ -13,19 +13,17 @@ import (
 	"github.com/sylabs/sif/pkg/sif"
 )
 
-// Add implements 'siftool add' sub-command.
-func Add() *cobra.Command {
-	ret := &cobra.Command{
-		Use:   "add [OPTIONS] <containerfile> <dataobjectfile>",
-		Short: "Add a data object to a SIF file",
-		Args:  cobra.ExactArgs(2),
-	}
-
+// addFlags adds the flags describing a data object to ret, for the 'siftool add' and 'siftool
+// bind' sub-commands.
+func addFlags(ret *cobra.Command) siftool.AddOptions {
 	opts := siftool.AddOptions{
-		Datatype: ret.Flags().Int64("datatype", -1, `the type of data to add
+		Datatype: ret.Flags().Int64("datatype", -1, `the type of data
 [NEEDED, no default]:
   1-Deffile,   2-EnvVar,    3-Labels,
-  4-Partition, 5-Signature, 6-GenericJSON`),
+  4-Partition, 5-Signature, 6-GenericJSON,
+  7-Generic,   8-CryptoMessage, 9-BuildLog,
+  10-Bundle,   11-HealthCheck, 12-SBOM,
+  13-OCIConfig, 14-OCIBlob`),
 		Parttype: ret.Flags().Int64("parttype", -1, `the type of partition (with -datatype 4-Partition)
 [NEEDED, no default]:
   1-System,    2-PrimSys,   3-Data,
@@ -47,14 +45,21 @@ func Add() *cobra.Command {
 		Signentity: ret.Flags().String("signentity", "", `the entity that signs (with -datatype 5-Signature)
 [NEEDED, no default]:
   example: 433FE984155206BD962725E20E8713472A879943`),
+		SBOMFormat: ret.Flags().Int64("sbomformat", -1, `the SBOM format used (with -datatype 12-SBOM)
+[NEEDED, no default]:
+  1-CycloneDX-JSON, 2-CycloneDX-XML,
+  3-SPDX-JSON,      4-SPDX-TagValue`),
+		OCIMediaType: ret.Flags().String("ocimediatype", "", `the OCI media type (with -datatype 13-OCIConfig or 14-OCIBlob)
+[NEEDED, no default]:
+  example: application/vnd.oci.image.layer.v1.tar+gzip`),
+		OCIDigest: ret.Flags().String("ocidigest", "", `the OCI digest (with -datatype 13-OCIConfig or 14-OCIBlob)
+[default: computed from dataobjectfile]`),
 		Groupid:   ret.Flags().Int64("groupid", sif.DescrUnusedGroup, "set groupid [default: DescrUnusedGroup]"),
 		Link:      ret.Flags().Int64("link", sif.DescrUnusedLink, "set link pointer [default: DescrUnusedLink]"),
 		Alignment: ret.Flags().Int("alignment", 0, "set alignment constraint [default: aligned on page size]"),
 		Filename:  ret.Flags().String("filename", "", "set logical filename/handle [default: input filename]"),
-	}
-
-	ret.RunE = func(cmd *cobra.Command, args []string) error {
-		return siftool.Add(args[0], args[1], opts)
+		Sparse:    ret.Flags().Bool("sparse", false, "leave blocks of zeros as holes in the SIF file"),
+		Compress:  ret.Flags().String("compress", "", "compress the data object: gzip [default: none]"),
 	}
 
 	// function to set flag.DefVal to the "zero-value"
@@ -74,9 +79,29 @@ func Add() *cobra.Command {
 	fn("partarch", "0")
 	fn("signhash", "0")
 	fn("signentity", "")
+	fn("sbomformat", "0")
+	fn("ocimediatype", "")
+	fn("ocidigest", "")
 	fn("groupid", "0")
 	fn("link", "0")
 	fn("alignment", "0")
 
+	return opts
+}
+
+// Add implements 'siftool add' sub-command.
+func Add() *cobra.Command {
+	ret := &cobra.Command{
+		Use:   "add [OPTIONS] <containerfile> <dataobjectfile>",
+		Short: "Add a data object to a SIF file",
+		Args:  cobra.ExactArgs(2),
+	}
+
+	opts := addFlags(ret)
+
+	ret.RunE = func(cmd *cobra.Command, args []string) error {
+		return siftool.Add(args[0], args[1], opts)
+	}
+
 	return ret
 }
@@ -0,0 +1,56 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package siftool
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/sif/internal/app/siftool"
+)
+
+// Placeholder implements 'siftool placeholder' sub-command.
+func Placeholder() *cobra.Command {
+	ret := &cobra.Command{
+		Use:   "placeholder [OPTIONS] <containerfile>",
+		Short: "Reserve space in a SIF file for a data object bound later",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	datatype := ret.Flags().Int64("datatype", -1, "the type of data to be bound [NEEDED, no default]")
+	size := ret.Flags().Int64("size", 0, "the space to reserve, in bytes [NEEDED, no default]")
+	digest := ret.Flags().String("digest", "", "the approved digest of the data to be bound [default: any data]")
+	groupid := ret.Flags().Int64("groupid", 0, "set groupid, which should not be signed [default: 0]")
+
+	ret.RunE = func(cmd *cobra.Command, args []string) error {
+		return siftool.Placeholder(args[0], *datatype, *size, *digest, *groupid)
+	}
+
+	return ret
+}
+
+// Bind implements 'siftool bind' sub-command.
+func Bind() *cobra.Command {
+	ret := &cobra.Command{
+		Use:   "bind [OPTIONS] <descriptorid> <containerfile> <dataobjectfile>",
+		Short: "Fill a placeholder in a SIF file with a data object",
+		Args:  cobra.ExactArgs(3),
+	}
+
+	opts := addFlags(ret)
+
+	ret.RunE = func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("while converting input descriptor id: %s", err)
+		}
+
+		return siftool.Bind(args[1], id, args[2], opts)
+	}
+
+	return ret
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package siftool
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/sif/internal/app/siftool"
+)
+
+// Build implements 'siftool build' sub-command.
+func Build() *cobra.Command {
+	ret := &cobra.Command{
+		Use:   "build -f <specfile> <containerfile>",
+		Short: "Assemble a SIF file from a JSON spec",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	spec := ret.Flags().StringP("file", "f", "", "JSON spec describing the objects and signing of the image")
+
+	ret.RunE = func(cmd *cobra.Command, args []string) error {
+		if *spec == "" {
+			return fmt.Errorf("a spec file must be passed with -f")
+		}
+		return siftool.Build(*spec, args[0])
+	}
+
+	return ret
+}
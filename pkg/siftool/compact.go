@@ -0,0 +1,28 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package siftool
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/sif/internal/app/siftool"
+)
+
+// Compact implements 'siftool compact' sub-command.
+func Compact() *cobra.Command {
+	ret := &cobra.Command{
+		Use:   "compact [OPTIONS] <containerfile>",
+		Short: "Reclaim space left in a SIF file by deleted data objects",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	dryRun := ret.Flags().Bool("dry-run", false, "report the space that would be reclaimed, without modifying the file")
+
+	ret.RunE = func(cmd *cobra.Command, args []string) error {
+		return siftool.Compact(args[0], *dryRun)
+	}
+
+	return ret
+}
@@ -18,19 +18,24 @@ import (
 
 // Dump implements 'siftool dump' sub-command.
 func Dump() *cobra.Command {
-	return &cobra.Command{
-		Use:   "dump <descriptorid> <containerfile>",
+	ret := &cobra.Command{
+		Use:   "dump [OPTIONS] <descriptorid> <containerfile>",
 		Short: "Extract and output data objects from SIF files",
 		Args:  cobra.ExactArgs(2),
+	}
+
+	var opts siftool.DumpOptions
+	ret.Flags().StringVar(&opts.Output, "output", "", "write the data object to a file, rather than stdout")
+	ret.Flags().BoolVar(&opts.ClearQuarantine, "clear-quarantine", false, "on macOS, clear the quarantine attribute of the output file")
 
-		RunE: func(cmd *cobra.Command, args []string) error {
-			id, err := strconv.ParseUint(args[0], 10, 32)
-			if err != nil {
-				return fmt.Errorf("while converting input descriptor id: %s", err)
-			}
+	ret.RunE = func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("while converting input descriptor id: %s", err)
+		}
 
-			return siftool.Dump(id, args[1])
-		},
-		DisableFlagsInUseLine: true,
+		return siftool.Dump(id, args[1], opts)
 	}
+
+	return ret
 }
@@ -0,0 +1,41 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package siftool
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/sif/internal/app/siftool"
+)
+
+// Hash implements 'siftool hash' sub-command.
+func Hash() *cobra.Command {
+	ret := &cobra.Command{
+		Use:   "hash [OPTIONS] [descriptorid] <containerfile>",
+		Short: "Display digests of data objects or SIF files",
+		Args:  cobra.RangeArgs(1, 2),
+	}
+
+	alg := ret.Flags().String("alg", "sha256", "hash algorithm: sha256, sha384 or sha512")
+	all := ret.Flags().Bool("all", false, "display the digest of each data object")
+
+	ret.RunE = func(cmd *cobra.Command, args []string) error {
+		var id uint64
+		if len(args) == 2 {
+			var err error
+			if id, err = strconv.ParseUint(args[0], 10, 32); err != nil {
+				return fmt.Errorf("while converting input descriptor id: %s", err)
+			}
+			args = args[1:]
+		}
+
+		return siftool.Hash(args[0], *alg, id, *all)
+	}
+
+	return ret
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package siftool
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/sif/internal/app/siftool"
+)
+
+// Repair implements 'siftool repair' sub-command.
+func Repair() *cobra.Command {
+	ret := &cobra.Command{
+		Use:   "repair [OPTIONS] <containerfile>",
+		Short: "Report truncated data objects, or repair damaged SIF files",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	output := ret.Flags().String("output", "", "write a repaired SIF file containing only complete data objects")
+	inPlace := ret.Flags().Bool("in-place", false, "repair inconsistencies in the descriptor table and global header in place")
+	clearQuarantine := ret.Flags().Bool("clear-quarantine", false, "on macOS, clear the quarantine attribute of the output file")
+
+	ret.RunE = func(cmd *cobra.Command, args []string) error {
+		if *inPlace {
+			if *output != "" {
+				return fmt.Errorf("--in-place and --output are mutually exclusive")
+			}
+			return siftool.RepairInPlace(args[0])
+		}
+		return siftool.Repair(args[0], *output, *clearQuarantine)
+	}
+
+	return ret
+}
@@ -43,10 +43,17 @@ func Siftool() *cobra.Command {
 	Siftool.AddCommand(List())
 	Siftool.AddCommand(Info())
 	Siftool.AddCommand(Dump())
+	Siftool.AddCommand(Hash())
 	Siftool.AddCommand(New())
 	Siftool.AddCommand(Add())
 	Siftool.AddCommand(Del())
 	Siftool.AddCommand(Setprim())
+	Siftool.AddCommand(Repair())
+	Siftool.AddCommand(Compact())
+	Siftool.AddCommand(Stat())
+	Siftool.AddCommand(Build())
+	Siftool.AddCommand(Placeholder())
+	Siftool.AddCommand(Bind())
 
 	return Siftool
 }
@@ -0,0 +1,25 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package siftool
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/sif/internal/app/siftool"
+)
+
+// Stat implements 'siftool stat' sub-command.
+func Stat() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stat <containerfile>",
+		Short: "Display a map of the layout of a SIF file",
+		Args:  cobra.ExactArgs(1),
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return siftool.Stat(args[0])
+		},
+		DisableFlagsInUseLine: true,
+	}
+}